@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/collate"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/config"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/perms"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/secrets"
+)
+
+// sessionActivity is what one server publishes about its session for the
+// other servers on the host. Command is only set when the owner shares it.
+type sessionActivity struct {
+	PID     int        `json:"pid"`
+	Label   string     `json:"label,omitempty"`
+	Busy    bool       `json:"busy"`
+	Since   *time.Time `json:"since,omitempty"` // when the running command started
+	Command string     `json:"command,omitempty"`
+}
+
+// activityBoard shares what this server's session is doing with other
+// servers run by the same user, through one small file per server in a
+// shared directory, and reads theirs back. Nothing is published unless the
+// activity config section is set, and command previews only with
+// shareCommand.
+type activityBoard struct {
+	mutex   sync.Mutex
+	dir     string
+	path    string
+	current sessionActivity
+
+	publish      bool
+	shareCommand bool
+	loadWarning  float64
+	store        *secrets.Store
+}
+
+// newActivityBoard creates the board. Other servers' activity is read even
+// when this one publishes nothing.
+func newActivityBoard(cfg *config.Config, store *secrets.Store) *activityBoard {
+	dir := filepath.Join(os.TempDir(), fmt.Sprintf("mcp-bash-go-activity-%d", os.Getuid()))
+	board := &activityBoard{
+		dir:         dir,
+		path:        filepath.Join(dir, strconv.Itoa(os.Getpid())+".json"),
+		current:     sessionActivity{PID: os.Getpid()},
+		loadWarning: float64(runtime.NumCPU()),
+		store:       store,
+	}
+	if cfg.Activity != nil {
+		board.publish = true
+		board.shareCommand = cfg.Activity.ShareCommand
+		board.current.Label = cfg.Activity.Label
+		if cfg.Activity.LoadWarning > 0 {
+			board.loadWarning = cfg.Activity.LoadWarning
+		}
+		board.write()
+	}
+	return board
+}
+
+// begin records that command has started in this server's session
+func (ab *activityBoard) begin(command string) {
+	if !ab.publish {
+		return
+	}
+	ab.mutex.Lock()
+	defer ab.mutex.Unlock()
+	now := time.Now().UTC()
+	ab.current.Busy = true
+	ab.current.Since = &now
+	if ab.shareCommand {
+		ab.current.Command = commandPreview(ab.store.Redact(command))
+	}
+	ab.write()
+}
+
+// end records that the running command has finished
+func (ab *activityBoard) end() {
+	if !ab.publish {
+		return
+	}
+	ab.mutex.Lock()
+	defer ab.mutex.Unlock()
+	ab.current.Busy = false
+	ab.current.Since = nil
+	ab.current.Command = ""
+	ab.write()
+}
+
+// write replaces this server's file. Failures only cost other servers the
+// hint, so they are logged and otherwise ignored.
+func (ab *activityBoard) write() {
+	data, err := json.Marshal(ab.current)
+	if err != nil {
+		return
+	}
+	if err := perms.MkdirAll(ab.dir); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to share session activity: %v\n", err)
+		return
+	}
+	tmp := ab.path + ".tmp"
+	if err := perms.WriteFile(tmp, data); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to share session activity: %v\n", err)
+		return
+	}
+	if err := os.Rename(tmp, ab.path); err != nil {
+		os.Remove(tmp)
+		fmt.Fprintf(os.Stderr, "Failed to share session activity: %v\n", err)
+	}
+}
+
+// Close withdraws this server's file
+func (ab *activityBoard) Close() {
+	if ab.publish {
+		os.Remove(ab.path)
+	}
+}
+
+// others returns the activity published by other live servers. Files left
+// by servers that have exited are removed.
+func (ab *activityBoard) others() []sessionActivity {
+	others := []sessionActivity{}
+	entries, err := os.ReadDir(ab.dir)
+	if err != nil {
+		return others
+	}
+	// Files are named by pid, so this lists servers in pid order
+	collate.SortFunc(entries, fs.DirEntry.Name, collate.Natural)
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		pid, err := strconv.Atoi(name)
+		if !ok || err != nil || pid == os.Getpid() {
+			continue
+		}
+		path := filepath.Join(ab.dir, entry.Name())
+		if !processAlive(pid) {
+			os.Remove(path)
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var activity sessionActivity
+		if json.Unmarshal(data, &activity) == nil && activity.PID == pid {
+			others = append(others, activity)
+		}
+	}
+	return others
+}
+
+// loadWarningText returns a warning when the host's load average is over the
+// threshold while another server's session is running a command, or "".
+func (ab *activityBoard) loadWarningText() string {
+	load, ok := loadAverage()
+	if !ok || load <= ab.loadWarning {
+		return ""
+	}
+	var busy []string
+	for _, other := range ab.others() {
+		if !other.Busy {
+			continue
+		}
+		who := fmt.Sprintf("another session (pid %d)", other.PID)
+		if other.Label != "" {
+			who = fmt.Sprintf("another session (%s)", other.Label)
+		}
+		if other.Command != "" {
+			busy = append(busy, fmt.Sprintf("%s is running `%s`", who, other.Command))
+		} else {
+			busy = append(busy, who+" is running a command")
+		}
+	}
+	if len(busy) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Note: %s, load average %.1f; commands may be slower than usual",
+		strings.Join(busy, "; "), load)
+}
+
+// processAlive reports whether pid is a running process
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, os.ErrPermission)
+}
+
+// loadAverage returns the one-minute load average, where the host reports it
+func loadAverage() (float64, bool) {
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, false
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, false
+	}
+	load, err := strconv.ParseFloat(fields[0], 64)
+	return load, err == nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/bash"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/config"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/mcp"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/secrets"
+)
+
+// newAdmission creates the admission controller, or nil if no budget is
+// configured. Patterns were validated when the config was loaded.
+func newAdmission(cfg *config.Config) *bash.Admission {
+	if cfg.Admission == nil {
+		return nil
+	}
+	opts := bash.AdmissionOptions{
+		Units:   cfg.Admission.Units,
+		MaxWait: time.Duration(cfg.Admission.MaxWaitSeconds) * time.Second,
+	}
+	for _, heavy := range cfg.Admission.HeavyCommands {
+		opts.Heavy = append(opts.Heavy, bash.HeavyPattern{
+			Pattern: regexp.MustCompile(heavy.Pattern),
+			Units:   heavy.Units,
+			Label:   heavy.Label,
+		})
+	}
+	return bash.NewAdmission(opts)
+}
+
+// admit reserves the units command needs before it runs. It returns the
+// function that gives them back, to be deferred by the caller, or the
+// response to return instead of running the command.
+func admit(ctx context.Context, admission *bash.Admission, command string, weight *int,
+	store *secrets.Store) (func(), *mcp.CallToolResponse) {
+	if admission == nil {
+		return func() {}, nil
+	}
+	units, label := admission.Weigh(command, weight)
+	if label == "" {
+		label = commandPreview(store.Redact(command))
+	}
+	release, err := admission.Reserve(ctx, units, label)
+	if err == nil {
+		return release, nil
+	}
+
+	var response mcp.CallToolResponse
+	var budgetErr *bash.BudgetError
+	switch {
+	case errors.Is(err, bash.ErrCommandCancelled):
+		response = createErrorResponse("Command cancelled by the client")
+	case errors.As(err, &budgetErr):
+		fmt.Fprintf(os.Stderr, "Command refused: %v\n", err)
+		response = createErrorResponse(fmt.Sprintf("Command not run: %v. Try again once they have finished, "+
+			"or run it with a lower weight if it is lighter than it looks.", err))
+		response.StructuredContent = map[string]interface{}{
+			"budgetExhausted": map[string]interface{}{
+				"units":         budgetErr.Units,
+				"inUse":         budgetErr.InUse,
+				"capacity":      budgetErr.Capacity,
+				"holders":       budgetErr.Holders,
+				"waitedSeconds": budgetErr.Waited.Seconds(),
+			},
+		}
+	default:
+		response = createErrorResponse(fmt.Sprintf("Command not run: %v", err))
+	}
+	return nil, &response
+}
+
+// admissionStatus reports the budget for server_stats, or nil if none is
+// configured
+func admissionStatus(admission *bash.Admission) *bash.AdmissionStatus {
+	if admission == nil {
+		return nil
+	}
+	status := admission.Status()
+	return &status
+}
@@ -0,0 +1,464 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/bash"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/config"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/mcp"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/perms"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/secrets"
+)
+
+const (
+	// auditQueueSize is how many entries may wait for the writer before new
+	// ones are dropped rather than holding up the tool call
+	auditQueueSize = 1024
+
+	// auditFlushInterval is how often buffered entries are flushed to disk
+	auditFlushInterval = time.Second
+)
+
+// sessionTools are the tools that run in the bash session, whose entries
+// name it
+var sessionTools = map[string]bool{"bash": true, "bash_script_buffer": true}
+
+// auditEntry is one line of the audit log
+type auditEntry struct {
+	Time        string         `json:"time"`
+	Tool        string         `json:"tool"`
+	Session     int            `json:"session,omitempty"`
+	Command     string         `json:"command,omitempty"`
+	ExitCode    *int           `json:"exitCode,omitempty"`
+	IsError     bool           `json:"isError"`
+	DurationMs  int64          `json:"durationMs"`
+	OutputBytes int            `json:"outputBytes"`
+	OutputHash  string         `json:"outputHash"`
+	Client      mcp.ClientInfo `json:"client"`
+
+	// Confirmation is the phase of a call to a tool requiring confirmation:
+	// "preview" or "confirm"
+	Confirmation string `json:"confirmation,omitempty"`
+
+	// Watermark is the ID of the markers put around the response text, and
+	// the hashes of what they enclose
+	Watermark *auditWatermark `json:"watermark,omitempty"`
+
+	// PrevHash is the hash of the entry before, in a hash-chained log. The
+	// entry's own hash is added to its line when it is written.
+	PrevHash string `json:"prevHash,omitempty"`
+}
+
+// auditMarker is a line of a hash-chained log that records no call. A
+// "continuation" starts the file after a rotation, carrying the chain on
+// from the rotated one. A "resume" notes that the log didn't end at the
+// head recorded when the server last stopped.
+type auditMarker struct {
+	Time         string `json:"time"`
+	Marker       string `json:"marker"`
+	RecordedHead string `json:"recordedHead,omitempty"`
+	PrevHash     string `json:"prevHash,omitempty"`
+}
+
+const (
+	auditContinuation = "continuation"
+	auditResume       = "resume"
+)
+
+// chainedRecord is an entry or marker of a hash-chained log
+type chainedRecord interface {
+	setPrevHash(hash string)
+}
+
+func (e *auditEntry) setPrevHash(hash string)  { e.PrevHash = hash }
+func (m *auditMarker) setPrevHash(hash string) { m.PrevHash = hash }
+
+// auditLog appends a JSON line per tool call to the configured file. Entries
+// are queued and written by a single goroutine, so a slow or full disk never
+// holds up a command; what can't be written is reported on stderr.
+type auditLog struct {
+	path     string
+	maxBytes int64
+	store    *secrets.Store
+	chain    bool
+
+	queue chan auditEntry
+	done  chan struct{}
+	once  sync.Once
+
+	// Owned by the writer goroutine
+	file    *os.File
+	buf     *bufio.Writer
+	size    int64
+	dropped int
+
+	// head is the hash of the last entry written to a chained log, and
+	// savedHead the one last saved to path.head. resumed is set once the
+	// chain has been picked up from an existing log.
+	head      string
+	savedHead string
+	resumed   bool
+}
+
+// newAuditLog opens the audit log, or returns nil if none is configured
+func newAuditLog(cfg *config.Config, store *secrets.Store) (*auditLog, error) {
+	if cfg.AuditLog == "" {
+		return nil, nil
+	}
+	audit := &auditLog{
+		path:     cfg.AuditLog,
+		maxBytes: cfg.GetAuditLogMaxBytes(),
+		store:    store,
+		chain:    cfg.AuditLogHashChain,
+		queue:    make(chan auditEntry, auditQueueSize),
+		done:     make(chan struct{}),
+	}
+	if err := audit.open(); err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	go audit.run()
+	return audit, nil
+}
+
+// record queues an entry for a tool call that has been answered. A nil
+// *auditLog records nothing.
+func (a *auditLog) record(request mcp.CallToolRequest, response mcp.CallToolResponse, duration time.Duration,
+	session int, client mcp.ClientInfo, watermark *auditWatermark) {
+	if a == nil {
+		return
+	}
+
+	var output strings.Builder
+	for _, item := range response.Content {
+		output.WriteString(item.Text)
+	}
+	sum := sha256.Sum256([]byte(output.String()))
+
+	entry := auditEntry{
+		Time:        time.Now().UTC().Format(time.RFC3339Nano),
+		Tool:        request.Name,
+		Command:     a.store.Redact(auditCommand(request)),
+		IsError:     response.IsError,
+		DurationMs:  duration.Milliseconds(),
+		OutputBytes: output.Len(),
+		OutputHash:  "sha256:" + hex.EncodeToString(sum[:]),
+		Client:      client,
+
+		Confirmation: confirmationPhase(request, response),
+		Watermark:    watermark,
+	}
+	if sessionTools[request.Name] {
+		entry.Session = session
+	}
+	if code, ok := response.StructuredContent["exitCode"].(int); ok {
+		entry.ExitCode = &code
+	}
+
+	select {
+	case a.queue <- entry:
+	default:
+		fmt.Fprintf(os.Stderr, "Audit log queue full; dropped entry for %s call\n", request.Name)
+	}
+}
+
+// auditCommand returns what a tool call asked to run, or "" for tools that
+// don't run anything
+func auditCommand(request mcp.CallToolRequest) string {
+	switch request.Name {
+	case "exec":
+		if args, err := bash.ParseExecArgs(request.Arguments); err == nil {
+			return args.String()
+		}
+	case "fetch_artifact":
+		if args, err := bash.ParseFetchArgs(request.Arguments); err == nil {
+			return args.URL
+		}
+	case "bash_history":
+		if filter, err := bash.ParseHistoryArgs(request.Arguments); err == nil {
+			return filter
+		}
+	}
+	var params struct {
+		Command string `json:"command"`
+	}
+	if json.Unmarshal(request.Arguments, &params) == nil {
+		return params.Command
+	}
+	return ""
+}
+
+// Close flushes queued entries and closes the file
+func (a *auditLog) Close() {
+	if a == nil {
+		return
+	}
+	a.once.Do(func() {
+		close(a.queue)
+		<-a.done
+	})
+}
+
+// run writes queued entries until the queue is closed
+func (a *auditLog) run() {
+	defer close(a.done)
+	ticker := time.NewTicker(auditFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case entry, ok := <-a.queue:
+			if !ok {
+				a.flush()
+				if a.file != nil {
+					a.file.Close()
+				}
+				return
+			}
+			a.write(entry)
+		case <-ticker.C:
+			a.flush()
+		}
+	}
+}
+
+// write appends one entry, rotating the file first if it would grow past
+// maxBytes
+func (a *auditLog) write(entry auditEntry) {
+	line, hash, err := a.encode(&entry)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to encode audit log entry: %v\n", err)
+		return
+	}
+
+	if a.maxBytes > 0 && a.size > 0 && a.size+int64(len(line)) > a.maxBytes {
+		a.rotate()
+		if a.chain {
+			// The new file starts with a continuation, which the entry
+			// follows on from
+			if line, hash, err = a.encode(&entry); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to encode audit log entry: %v\n", err)
+				return
+			}
+		}
+	}
+	if a.buf == nil {
+		// A failed rotation leaves no file; try again on each entry
+		if err := a.open(); err != nil {
+			a.dropped++
+			fmt.Fprintf(os.Stderr, "Failed to write audit log (%d entries lost): %v\n", a.dropped, err)
+			return
+		}
+		if a.chain {
+			if line, hash, err = a.encode(&entry); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to encode audit log entry: %v\n", err)
+				return
+			}
+		}
+	}
+	if err := a.writeLine(line, hash); err != nil {
+		a.dropped++
+		fmt.Fprintf(os.Stderr, "Failed to write audit log (%d entries lost): %v\n", a.dropped, err)
+	}
+}
+
+// encode returns a record's line and, in a chained log, its hash, which
+// follows on from the current head
+func (a *auditLog) encode(record chainedRecord) ([]byte, string, error) {
+	if a.chain {
+		record.setPrevHash(a.head)
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return nil, "", err
+	}
+	var hash string
+	if a.chain {
+		if line, hash, err = sealAuditLine(line, a.head); err != nil {
+			return nil, "", err
+		}
+	}
+	return append(line, '\n'), hash, nil
+}
+
+// writeLine appends an encoded line to the open file, moving the chain
+// head on to its hash
+func (a *auditLog) writeLine(line []byte, hash string) error {
+	if _, err := a.buf.Write(line); err != nil {
+		a.buf.Reset(a.file)
+		return err
+	}
+	a.size += int64(len(line))
+	if a.chain {
+		a.head = hash
+	}
+	return nil
+}
+
+// writeMarker appends a marker to a chained log
+func (a *auditLog) writeMarker(marker auditMarker) {
+	marker.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	line, hash, err := a.encode(&marker)
+	if err == nil {
+		err = a.writeLine(line, hash)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write audit log %s record: %v\n", marker.Marker, err)
+	}
+}
+
+// sealAuditLine adds its hash to an encoded record: SHA-256 over the
+// previous entry's hash followed by the record in canonical form
+func sealAuditLine(line []byte, prevHash string) ([]byte, string, error) {
+	hash, err := auditHash(line, prevHash)
+	if err != nil {
+		return nil, "", err
+	}
+	sealed := append(line[:len(line)-1:len(line)-1], `,"hash":"`+hash+`"}`...)
+	return sealed, hash, nil
+}
+
+// auditHash returns the hash chaining a record, without its own hash, to
+// the entry before
+func auditHash(record []byte, prevHash string) (string, error) {
+	canonical, err := mcp.Canonicalize(record)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(append([]byte(prevHash), canonical...))
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// flush writes buffered entries to the file, then saves the chain head of
+// a chained log
+func (a *auditLog) flush() {
+	if a.buf == nil || a.buf.Buffered() == 0 {
+		return
+	}
+	if err := a.buf.Flush(); err != nil {
+		a.dropped++
+		fmt.Fprintf(os.Stderr, "Failed to flush audit log: %v\n", err)
+		a.buf.Reset(a.file)
+		return
+	}
+	if a.chain && a.head != a.savedHead {
+		if err := perms.WriteFile(a.path+".head", []byte(a.head+"\n")); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to save audit log chain head: %v\n", err)
+			return
+		}
+		a.savedHead = a.head
+	}
+}
+
+// rotate moves the current file to path.1, replacing any older one, and
+// starts a new file
+func (a *auditLog) rotate() {
+	a.flush()
+	a.file.Close()
+	a.file, a.buf, a.size = nil, nil, 0
+	if err := os.Rename(a.path, a.path+".1"); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to rotate audit log: %v\n", err)
+	}
+	if err := a.open(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to reopen audit log after rotation: %v\n", err)
+	}
+}
+
+// open opens the log file for appending. A chained log picks the chain up
+// where it left off the first time, and a new file after a rotation starts
+// with a continuation.
+func (a *auditLog) open() error {
+	file, err := perms.OpenFile(a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	a.file, a.buf, a.size = file, bufio.NewWriter(file), info.Size()
+
+	if !a.chain {
+		return nil
+	}
+	if !a.resumed {
+		a.resumed = true
+		a.resumeChain()
+	} else if a.size == 0 && a.head != "" {
+		a.writeMarker(auditMarker{Marker: auditContinuation})
+	}
+	return nil
+}
+
+// resumeChain picks up the chain of an existing log from its last entry.
+// When that isn't the head saved in path.head, the log was cut or added to
+// while the server was stopped; a resume marker keeps that on record.
+func (a *auditLog) resumeChain() {
+	data, _ := os.ReadFile(a.path + ".head")
+	recorded := strings.TrimSpace(string(data))
+	a.savedHead = recorded
+
+	if a.size == 0 {
+		// A new log, or a new file after a rotation
+		a.head = recorded
+		if recorded != "" {
+			a.writeMarker(auditMarker{Marker: auditContinuation})
+		}
+		return
+	}
+
+	last, err := lastAuditHash(a.path, a.size)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: audit log %s: %v\n", a.path, err)
+	}
+	a.head = last
+	if last != recorded {
+		fmt.Fprintf(os.Stderr, "Warning: audit log %s doesn't end at its recorded chain head; it was cut or added "+
+			"to while the server was stopped\n", a.path)
+		a.writeMarker(auditMarker{Marker: auditResume, RecordedHead: recorded})
+	}
+}
+
+// lastAuditHash returns the hash of the last line of a chained log of size
+// bytes, reading back from the end only as far as it has to
+func lastAuditHash(path string, size int64) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	for chunk := int64(64 * 1024); ; chunk *= 2 {
+		if chunk > size {
+			chunk = size
+		}
+		buf := make([]byte, chunk)
+		if _, err := file.ReadAt(buf, size-chunk); err != nil {
+			return "", err
+		}
+		if !bytes.HasSuffix(buf, []byte("\n")) {
+			return "", fmt.Errorf("the last entry is incomplete")
+		}
+		line := buf[:len(buf)-1]
+		start := bytes.LastIndexByte(line, '\n')
+		if start < 0 && chunk < size {
+			continue
+		}
+		var record struct {
+			Hash string `json:"hash"`
+		}
+		if err := json.Unmarshal(line[start+1:], &record); err != nil {
+			return "", fmt.Errorf("the last entry is not valid JSON: %w", err)
+		}
+		return record.Hash, nil
+	}
+}
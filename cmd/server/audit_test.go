@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/config"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/mcp"
+)
+
+// writeChainedAudit records n calls to a hash-chained audit log at path,
+// numbering their commands from first, and closes it
+func writeChainedAudit(t *testing.T, path string, maxBytes int64, first, n int) {
+	t.Helper()
+	audit, err := newAuditLog(&config.Config{AuditLog: path, AuditLogMaxBytes: maxBytes, AuditLogHashChain: true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := first; i < first+n; i++ {
+		request := mcp.CallToolRequest{Name: "bash", Arguments: json.RawMessage(fmt.Sprintf(`{"command":"echo %d"}`, i))}
+		response := mcp.CallToolResponse{Content: []mcp.ContentItem{{Type: "text", Text: fmt.Sprint(i)}}}
+		audit.record(request, response, time.Millisecond, 1, mcp.ClientInfo{Name: "test"}, nil)
+	}
+	audit.Close()
+}
+
+// auditLines returns the lines of an audit log file
+func auditLines(t *testing.T, path string) [][]byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.SplitAfter(bytes.TrimSuffix(data, []byte("\n")), []byte("\n"))
+}
+
+// writeAuditLines replaces an audit log file's lines
+func writeAuditLines(t *testing.T, path string, lines [][]byte) {
+	t.Helper()
+	data := bytes.Join(lines, nil)
+	if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+		data = append(data, '\n')
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// wantAuditBreak verifies files and checks the chain breaks at line of file
+// for a reason containing reason
+func wantAuditBreak(t *testing.T, files []string, head, file string, line int, reason string) {
+	t.Helper()
+	_, err := verifyAuditChain(files, head)
+	var broken *auditBreak
+	if !errors.As(err, &broken) {
+		t.Fatalf("verify = %v, want a broken link", err)
+	}
+	if broken.File != file || broken.Line != line || !strings.Contains(broken.Reason, reason) {
+		t.Errorf("broken at %v, want %s:%d: ...%s...", broken, file, line, reason)
+	}
+}
+
+func TestAuditHashChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	writeChainedAudit(t, path, 0, 0, 5)
+
+	result, err := verifyAuditChain([]string{path}, path+".head")
+	if err != nil || result.Entries != 5 {
+		t.Fatalf("verify = %+v, %v; want 5 entries intact", result, err)
+	}
+
+	// The chain carries on across a restart
+	writeChainedAudit(t, path, 0, 5, 2)
+	if result, err := verifyAuditChain([]string{path}, path+".head"); err != nil || result.Entries != 7 {
+		t.Fatalf("after a restart: %+v, %v", result, err)
+	}
+	original := auditLines(t, path)
+
+	tests := []struct {
+		name   string
+		tamper func(lines [][]byte) [][]byte
+		line   int
+		reason string
+	}{
+		{"changed entry", func(lines [][]byte) [][]byte {
+			lines[3] = bytes.Replace(lines[3], []byte("echo 3"), []byte("echo 9"), 1)
+			return lines
+		}, 4, "was changed"},
+		{"removed entry", func(lines [][]byte) [][]byte {
+			return append(lines[:2], lines[3:]...)
+		}, 3, "removed or added"},
+		{"truncated", func(lines [][]byte) [][]byte {
+			return lines[:5]
+		}, 5, "recorded head"},
+		{"cut mid-entry", func(lines [][]byte) [][]byte {
+			last := len(lines) - 1
+			lines[last] = lines[last][:len(lines[last])/2]
+			return lines
+		}, 7, "incomplete"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lines := make([][]byte, len(original))
+			for i, line := range original {
+				lines[i] = append([]byte(nil), line...)
+			}
+			lines = test.tamper(lines)
+			data := bytes.Join(lines, nil)
+			tampered := filepath.Join(t.TempDir(), "audit.log")
+			if err := os.WriteFile(tampered, data, 0600); err != nil {
+				t.Fatal(err)
+			}
+			wantAuditBreak(t, []string{tampered}, path+".head", tampered, test.line, test.reason)
+		})
+	}
+}
+
+func TestAuditHashChainResumeAfterTruncation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	writeChainedAudit(t, path, 0, 0, 4)
+
+	// Cut while the server was stopped: the restarted server notes it, so
+	// the break isn't hidden by the head it goes on to save
+	writeAuditLines(t, path, auditLines(t, path)[:3])
+	writeChainedAudit(t, path, 0, 4, 2)
+	wantAuditBreak(t, []string{path}, path+".head", path, 4, "resumed a log")
+}
+
+func TestAuditHashChainRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	writeChainedAudit(t, path, 1500, 0, 12)
+
+	lines := auditLines(t, path)
+	var marker auditMarker
+	if err := json.Unmarshal(lines[0], &marker); err != nil || marker.Marker != auditContinuation {
+		t.Fatalf("rotated file starts with %s, want a continuation", lines[0])
+	}
+	files := []string{path + ".1", path}
+	if _, err := verifyAuditChain(files, path+".head"); err != nil {
+		t.Fatalf("verify across the rotation: %v", err)
+	}
+	// The current file alone verifies from its continuation
+	if _, err := verifyAuditChain([]string{path}, path+".head"); err != nil {
+		t.Errorf("verify the current file: %v", err)
+	}
+
+	// Dropping the rotated file's last entry breaks the link to the new one
+	rotated := auditLines(t, path+".1")
+	writeAuditLines(t, path+".1", rotated[:len(rotated)-1])
+	wantAuditBreak(t, files, path+".head", path, 1, "removed or added")
+}
+
+func TestAuditHashChainStartsMidway(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	writeChainedAudit(t, path, 0, 0, 3)
+	writeAuditLines(t, path, auditLines(t, path)[1:])
+	wantAuditBreak(t, []string{path}, path+".head", path, 1, "missing")
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// auditBreak is the first place a hash-chained audit log fails to verify
+type auditBreak struct {
+	File   string
+	Line   int
+	Reason string
+}
+
+func (b *auditBreak) Error() string {
+	return fmt.Sprintf("%s:%d: %s", b.File, b.Line, b.Reason)
+}
+
+// auditVerification is what verifying a chained log found
+type auditVerification struct {
+	// Entries is how many chained lines were verified, and Unchained how
+	// many lines written before chaining was turned on were skipped
+	Entries   int
+	Unchained int
+	Head      string
+}
+
+// verifyAuditChain checks the hash chain through files, oldest first, then
+// that it ends at the head saved in headPath, if that exists. It returns
+// the first broken link as an *auditBreak.
+func verifyAuditChain(files []string, headPath string) (auditVerification, error) {
+	var result auditVerification
+	var prev string
+	chained := false
+	lastFile, lastLine := "", 0
+
+	for _, path := range files {
+		file, err := os.Open(path)
+		if err != nil {
+			return result, err
+		}
+		reader := bufio.NewReader(file)
+		for lineNo := 1; ; lineNo++ {
+			line, err := reader.ReadBytes('\n')
+			if err == io.EOF && len(line) == 0 {
+				break
+			}
+			fail := func(reason string, args ...interface{}) (auditVerification, error) {
+				file.Close()
+				return result, &auditBreak{File: path, Line: lineNo, Reason: fmt.Sprintf(reason, args...)}
+			}
+			if err == io.EOF {
+				return fail("the last entry is incomplete: the log was cut mid-entry")
+			}
+			if err != nil {
+				file.Close()
+				return result, err
+			}
+
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(line, &fields); err != nil {
+				return fail("not a JSON record: %v", err)
+			}
+			var record struct {
+				Hash         string `json:"hash"`
+				PrevHash     string `json:"prevHash"`
+				Marker       string `json:"marker"`
+				RecordedHead string `json:"recordedHead"`
+			}
+			json.Unmarshal(line, &record)
+			if record.Hash == "" {
+				if chained {
+					return fail("the entry has no hash")
+				}
+				// Written before chaining was turned on
+				result.Unchained++
+				continue
+			}
+
+			switch {
+			case !chained && record.Marker == auditContinuation:
+				// The file it continues from is gone; the chain is checked
+				// from here
+			case record.PrevHash != prev:
+				if !chained {
+					return fail("the chain starts part way: the entries before this one are missing")
+				}
+				return fail("prevHash doesn't match the entry before: entries between them were removed or added")
+			}
+			if record.Marker == auditResume && record.RecordedHead != record.PrevHash {
+				return fail("the server resumed a log that didn't end at its recorded head %s: entries at its end "+
+					"were removed or added while the server was stopped", record.RecordedHead)
+			}
+
+			delete(fields, "hash")
+			unsealed, err := json.Marshal(fields)
+			if err != nil {
+				return fail("%v", err)
+			}
+			hash, err := auditHash(unsealed, record.PrevHash)
+			if err != nil {
+				return fail("%v", err)
+			}
+			if hash != record.Hash {
+				return fail("the hash doesn't match the entry: it was changed after it was written")
+			}
+
+			prev, chained = hash, true
+			result.Entries++
+			lastFile, lastLine = path, lineNo
+		}
+		file.Close()
+	}
+	result.Head = prev
+
+	data, err := os.ReadFile(headPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return result, nil
+	}
+	if err != nil {
+		return result, err
+	}
+	if recorded := strings.TrimSpace(string(data)); recorded != prev {
+		return result, &auditBreak{File: lastFile, Line: lastLine, Reason: fmt.Sprintf("the log ends here, but "+
+			"its recorded head is %s: entries at the end were removed, or added behind the server's back",
+			recorded)}
+	}
+	return result, nil
+}
+
+// runVerifyAudit checks the audit log at path for -verify-audit, with the
+// file it was last rotated to first if that is still there, and returns the
+// exit code
+func runVerifyAudit(path string) int {
+	files := []string{path}
+	if _, err := os.Stat(path + ".1"); err == nil {
+		files = []string{path + ".1", path}
+	}
+	result, err := verifyAuditChain(files, path+".head")
+	var broken *auditBreak
+	if errors.As(err, &broken) {
+		fmt.Printf("Audit log chain broken at %v\n", broken)
+		fmt.Printf("%d entries verified before it\n", result.Entries)
+		return exitFailure
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to verify audit log: %v\n", err)
+		return exitFailure
+	}
+	if result.Entries == 0 {
+		fmt.Printf("%s has no hash-chained entries\n", strings.Join(files, ", "))
+		return exitFailure
+	}
+	fmt.Printf("Audit log %s verified: %d entries, chain head %s\n", strings.Join(files, ", "), result.Entries,
+		result.Head)
+	if result.Unchained > 0 {
+		fmt.Printf("%d earlier entries were written without hash chaining and are not covered\n", result.Unchained)
+	}
+	return exitOK
+}
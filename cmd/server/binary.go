@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/bash"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/mcp"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/secrets"
+)
+
+// binaryStdoutURI names the embedded resource holding non-media stdout
+const binaryStdoutURI = "bash://stdout"
+
+// attachBinaryStdout adds a base64-encoded command's captured stdout to
+// response: a note on what it is, then its content item. Secrets are
+// redacted from the raw bytes first, since redactResponse only sees text.
+// A nil capture leaves the response alone.
+func attachBinaryStdout(response *mcp.CallToolResponse, capture *bash.BinaryCapture, store *secrets.Store) {
+	if capture == nil {
+		return
+	}
+	data, total, err := capture.Read()
+	if err != nil {
+		prependWarning(response, fmt.Sprintf("Warning: %v", err))
+		return
+	}
+	if store.Len() > 0 {
+		data = []byte(store.Redact(string(data)))
+	}
+
+	// Stdout never reached the text output, which may now be empty
+	content := response.Content[:0]
+	for _, item := range response.Content {
+		if item.Type != "text" || item.Text != "" {
+			content = append(content, item)
+		}
+	}
+	response.Content = content
+
+	if response.StructuredContent == nil {
+		response.StructuredContent = map[string]interface{}{}
+	}
+	response.StructuredContent["stdoutBytes"] = total
+	if total == 0 {
+		prependWarning(response, "[stdout: empty]")
+		return
+	}
+
+	mimeType := http.DetectContentType(data)
+	response.StructuredContent["stdoutMimeType"] = mimeType
+	note := fmt.Sprintf("[stdout: %d bytes (%s), base64-encoded in the last content item]", total, mimeType)
+	if total > int64(len(data)) {
+		note = fmt.Sprintf("[stdout: the first %d of %d bytes (%s), base64-encoded in the last content item; "+
+			"the rest was dropped at the output size limit]", len(data), total, mimeType)
+	}
+	prependWarning(response, note)
+	response.Content = append(response.Content, mcp.BinaryContent(data, mimeType, binaryStdoutURI))
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/bash"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/config"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/mcp"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/truncate"
+)
+
+// exhaustedResponseBytes is the inline text each response may carry once the
+// output budget is used up. Output beyond it is cut from the middle, keeping
+// the head and tail where errors and summaries usually are.
+const exhaustedResponseBytes = 2048
+
+// outputBudget tracks the total inline bytes returned by tool calls over the
+// life of the server session. A zero limit disables the budget.
+type outputBudget struct {
+	mutex sync.Mutex
+	limit int64
+	used  int64
+}
+
+// newOutputBudget creates a budget of limit bytes (0 = unlimited)
+func newOutputBudget(limit int64) *outputBudget {
+	return &outputBudget{limit: limit}
+}
+
+// enabled reports whether a budget is configured
+func (b *outputBudget) enabled() bool {
+	return b.limit > 0
+}
+
+// remaining returns the bytes left in the budget (never negative)
+func (b *outputBudget) remaining() int64 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.used >= b.limit {
+		return 0
+	}
+	return b.limit - b.used
+}
+
+// reset clears usage so the full budget is available again
+func (b *outputBudget) reset() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.used = 0
+}
+
+// apply charges a response's inline content, its text, binary data and
+// structured content, against the budget. If the response fits in what
+// remains it passes through unchanged. Otherwise it is cut down to
+// max(remaining, exhaustedResponseBytes) and a warning is prepended. It
+// reports whether the response was cut.
+func (b *outputBudget) apply(response *mcp.CallToolResponse) bool {
+	if !b.enabled() {
+		return false
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	// Structured content is charged as the JSON it is sent as
+	structured := int64(0)
+	if len(response.StructuredContent) > 0 {
+		if data, err := json.Marshal(response.StructuredContent); err == nil {
+			structured = int64(len(data))
+		}
+	}
+	total := structured
+	for _, item := range response.Content {
+		total += int64(len(item.Text) + item.BinarySize())
+	}
+
+	remaining := b.limit - b.used
+	if remaining < 0 {
+		remaining = 0
+	}
+	if total <= remaining {
+		b.used += total
+		return false
+	}
+
+	allowance := remaining
+	if allowance < exhaustedResponseBytes {
+		allowance = exhaustedResponseBytes
+	}
+
+	// Structured content comes first, being small and what clients parse;
+	// it can't be cut, so if it doesn't fit it is left out. The rest of the
+	// allowance is shared across text items in order. Binary items can't
+	// be cut either, so one that doesn't fit is replaced by a note.
+	returned := int64(0)
+	var omitted []mcp.ContentItem
+	if structured > allowance {
+		response.StructuredContent = nil
+		omitted = append(omitted, mcp.ContentItem{Type: "text",
+			Text: fmt.Sprintf("[%d bytes of structured content omitted: output budget]", structured)})
+	} else {
+		returned += structured
+	}
+	for i := range response.Content {
+		if size := response.Content[i].BinarySize(); size > 0 {
+			if int64(size) > allowance-returned {
+				response.Content[i] = mcp.ContentItem{Type: "text",
+					Text: fmt.Sprintf("[%d bytes of base64 output omitted: output budget]", size)}
+			} else {
+				returned += int64(size)
+				continue
+			}
+		}
+		text := response.Content[i].Text
+		left := allowance - returned
+		if int64(len(text)) > left {
+			text = truncateMiddle(text, int(left))
+			response.Content[i].Text = text
+		}
+		returned += int64(len(text))
+	}
+	b.used += returned
+
+	warning := fmt.Sprintf("WARNING: output budget exhausted (%d of %d bytes used). This response was cut to %d bytes "+
+		"and later responses will be cut aggressively. Filter output (grep, head, tail, wc), write large results "+
+		"to files and read only the parts you need, or ask the operator to reset the budget.",
+		b.used, b.limit, returned)
+	response.Content = append(append([]mcp.ContentItem{{Type: "text", Text: warning}}, response.Content...),
+		omitted...)
+	return true
+}
+
+// truncateMiddle shortens s to at most max bytes, keeping its head and tail.
+func truncateMiddle(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	marker := fmt.Sprintf("\n... [%d bytes omitted: output budget] ...\n", len(s)-max)
+	if max <= len(marker) {
+		return truncate.Head(s, max)
+	}
+	keep := max - len(marker)
+	head := keep / 2
+	tail := keep - head
+	return truncate.Head(s, head) + marker + truncate.Tail(s, tail)
+}
+
+// handleSessionBudget implements the session_budget tool: report remaining
+// budget and reset it when given the operator's reset token.
+func handleSessionBudget(args json.RawMessage, budget *outputBudget, cfg *config.Config) mcp.CallToolResponse {
+	reset, token, err := bash.ParseSessionBudgetArgs(args)
+	if err != nil {
+		return createErrorResponse(err.Error())
+	}
+
+	if !budget.enabled() {
+		return mcp.CallToolResponse{
+			Content: []mcp.ContentItem{{Type: "text", Text: "No output budget is configured (outputBudgetBytes is 0)"}},
+		}
+	}
+
+	if reset {
+		if cfg.OutputBudgetResetToken == "" {
+			return createErrorResponse("budget reset is disabled: no outputBudgetResetToken is configured")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.OutputBudgetResetToken)) != 1 {
+			return createErrorResponse("budget reset refused: invalid reset_token")
+		}
+		budget.reset()
+	}
+
+	remaining := budget.remaining()
+	status := map[string]interface{}{
+		"limitBytes":     budget.limit,
+		"usedBytes":      budget.limit - remaining,
+		"remainingBytes": remaining,
+		"exhausted":      remaining == 0,
+		"reset":          reset,
+	}
+	text, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return createErrorResponse(fmt.Sprintf("failed to encode budget status: %v", err))
+	}
+
+	return mcp.CallToolResponse{
+		Content: []mcp.ContentItem{{Type: "text", Text: string(text)}},
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/config"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/mcp"
+)
+
+// textResponse is a response carrying a single text item
+func textResponse(text string) mcp.CallToolResponse {
+	return mcp.CallToolResponse{Content: []mcp.ContentItem{{Type: "text", Text: text}}}
+}
+
+func TestOutputBudgetChargesAndCuts(t *testing.T) {
+	budget := newOutputBudget(10000)
+
+	response := textResponse(strings.Repeat("a", 6000))
+	budget.apply(&response)
+	if len(response.Content) != 1 || budget.remaining() != 4000 {
+		t.Fatalf("a response within budget was changed, or not charged (remaining %d)", budget.remaining())
+	}
+
+	response = textResponse("HEAD" + strings.Repeat("b", 8000) + "TAIL")
+	budget.apply(&response)
+	if !strings.HasPrefix(response.Content[0].Text, "WARNING: output budget exhausted") {
+		t.Fatalf("no warning prepended: %q", response.Content[0].Text[:80])
+	}
+	cut := response.Content[1].Text
+	if len(cut) > 4000 || !strings.HasPrefix(cut, "HEAD") || !strings.HasSuffix(cut, "TAIL") {
+		t.Errorf("cut to %d bytes, want at most 4000 keeping head and tail", len(cut))
+	}
+	if budget.remaining() != 0 {
+		t.Errorf("remaining = %d, want 0", budget.remaining())
+	}
+
+	// Once exhausted, responses still get a small allowance
+	response = textResponse(strings.Repeat("c", 10000))
+	budget.apply(&response)
+	if got := len(response.Content[1].Text); got > exhaustedResponseBytes {
+		t.Errorf("exhausted response is %d bytes, want at most %d", got, exhaustedResponseBytes)
+	}
+}
+
+func TestOutputBudgetChargesStructuredContent(t *testing.T) {
+	budget := newOutputBudget(exhaustedResponseBytes)
+
+	structured := map[string]interface{}{"data": strings.Repeat("x", 1000)}
+	size, _ := json.Marshal(structured)
+	response := mcp.CallToolResponse{StructuredContent: structured}
+	budget.apply(&response)
+	if used := exhaustedResponseBytes - budget.remaining(); used != int64(len(size)) {
+		t.Errorf("charged %d bytes, want the %d bytes of JSON", used, len(size))
+	}
+
+	response = mcp.CallToolResponse{StructuredContent: map[string]interface{}{"data": strings.Repeat("y", 5000)}}
+	budget.apply(&response)
+	if response.StructuredContent != nil {
+		t.Errorf("structured content over the allowance was kept")
+	}
+	if last := response.Content[len(response.Content)-1].Text; !strings.Contains(last, "structured content omitted") {
+		t.Errorf("no omission note: %q", last)
+	}
+}
+
+func TestOutputBudgetDisabled(t *testing.T) {
+	budget := newOutputBudget(0)
+	response := textResponse(strings.Repeat("a", 100000))
+	budget.apply(&response)
+	if len(response.Content) != 1 || len(response.Content[0].Text) != 100000 {
+		t.Errorf("response changed with no budget configured")
+	}
+}
+
+func TestSessionBudgetReset(t *testing.T) {
+	cfg := &config.Config{OutputBudgetResetToken: "s3cret"}
+	budget := newOutputBudget(100)
+	response := textResponse(strings.Repeat("a", 100))
+	budget.apply(&response)
+
+	result := handleSessionBudget(json.RawMessage(`{"reset":true,"reset_token":"wrong"}`), budget, cfg)
+	if !result.IsError || budget.remaining() != 0 {
+		t.Errorf("reset with a wrong token: error %v, remaining %d", result.IsError, budget.remaining())
+	}
+
+	result = handleSessionBudget(json.RawMessage(`{"reset":true,"reset_token":"s3cret"}`), budget, cfg)
+	if result.IsError || budget.remaining() != 100 {
+		t.Errorf("reset with the token: %q, remaining %d", result.Content[0].Text, budget.remaining())
+	}
+
+	cfg.OutputBudgetResetToken = ""
+	result = handleSessionBudget(json.RawMessage(`{"reset":true,"reset_token":""}`), budget, cfg)
+	if !result.IsError {
+		t.Errorf("reset allowed with no token configured")
+	}
+}
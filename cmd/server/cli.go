@@ -0,0 +1,225 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/config"
+)
+
+// programName is the installed binary's name, used in help and completions
+const programName = "mcp-bash"
+
+// Exit codes
+const (
+	exitOK = 0
+	// exitFailure: the server couldn't start or stopped with an error
+	exitFailure = 1
+	// exitUsage: the command line was invalid
+	exitUsage = 2
+)
+
+// exitCodes document the exit codes in help output
+var exitCodes = []struct {
+	code int
+	doc  string
+}{
+	{exitOK, "success, or the server shut down on SIGINT/SIGTERM"},
+	{exitFailure, "startup failed: bad configuration, missing shell, or a listener or file that couldn't be opened; " +
+		"or -verify-audit or -verify-watermark found something that doesn't check out"},
+	{exitUsage, "invalid command line: unknown flag or command, or flags that can't be combined"},
+}
+
+// cliOptions are the parsed command-line flags
+type cliOptions struct {
+	version         bool
+	migrateConfig   bool
+	allowInsecure   bool
+	verifyAudit     string
+	verifyWatermark string
+	replay          replayFlags
+}
+
+// newFlagSet registers every command-line flag. Help and the completion
+// scripts are generated from the set, so a flag added here shows up in both.
+func newFlagSet(opts *cliOptions) *flag.FlagSet {
+	set := flag.NewFlagSet(programName, flag.ContinueOnError)
+	set.SetOutput(io.Discard)
+	set.BoolVar(&opts.version, "version", false, "print the version, commit and build time, then exit")
+	set.BoolVar(&opts.version, "v", false, "shorthand for -version")
+	set.BoolVar(&opts.migrateConfig, "migrate-config", false,
+		"rewrite config.json without deprecated settings, keeping the original as config.json.bak, then exit")
+	set.BoolVar(&opts.allowInsecure, "allow-insecure-config", false,
+		"only warn, instead of refusing to start, when other users could modify config.json or a file it names")
+	set.StringVar(&opts.verifyAudit, "verify-audit", "",
+		"check the hash chain of the audit log in `file`, reporting the first broken link, then exit")
+	set.StringVar(&opts.verifyWatermark, "verify-watermark", "",
+		"check the watermarked text in `file` against the configured audit log, then exit")
+	opts.replay.register(set)
+	return set
+}
+
+// parseFlags parses the command line for running the server. A -h or -help
+// flag returns flag.ErrHelp.
+func parseFlags(args []string) (cliOptions, error) {
+	var opts cliOptions
+	set := newFlagSet(&opts)
+	if err := set.Parse(args); err != nil {
+		return opts, err
+	}
+	if set.NArg() > 0 {
+		return opts, fmt.Errorf("unexpected argument %q", set.Arg(0))
+	}
+	if opts.version || opts.migrateConfig || opts.verifyAudit != "" || opts.verifyWatermark != "" {
+		return opts, nil
+	}
+	return opts, opts.replay.validate()
+}
+
+// subcommand is a command-line verb handled instead of running the server
+type subcommand struct {
+	name    string
+	args    string
+	summary string
+	// completions are the words offered for its argument
+	completions []string
+	run         func(args []string, stdout io.Writer) int
+}
+
+// subcommands returns the registered subcommands
+func subcommands() []subcommand {
+	return []subcommand{
+		{
+			name:    "help",
+			summary: "show this help",
+			run: func(args []string, stdout io.Writer) int {
+				writeHelp(stdout)
+				return exitOK
+			},
+		},
+		{
+			name:        "completion",
+			args:        "<shell>",
+			summary:     "print a completion script for " + joinOr(completionShellNames()),
+			completions: completionShellNames(),
+			run:         runCompletion,
+		},
+	}
+}
+
+// runSubcommand runs the subcommand args name, if they name one. A first
+// argument that is neither a flag nor a subcommand is a usage error.
+func runSubcommand(args []string) (code int, handled bool) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return 0, false
+	}
+	for _, cmd := range subcommands() {
+		if cmd.name == args[0] {
+			return cmd.run(args[1:], os.Stdout), true
+		}
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q; run '%s help' for usage\n", args[0], programName)
+	return exitUsage, true
+}
+
+// runMigrateConfig rewrites config.json for -migrate-config and returns the
+// exit code
+func runMigrateConfig() int {
+	path, changes, err := config.MigrateFile()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to migrate config: %v\n", err)
+		return exitFailure
+	}
+	if len(changes) == 0 {
+		fmt.Printf("%s has no deprecated settings; nothing to do\n", path)
+		return exitOK
+	}
+	fmt.Printf("Migrated %s (original saved as %s.bak):\n", path, path)
+	for _, change := range changes {
+		fmt.Printf("  %s\n", change)
+	}
+	return exitOK
+}
+
+// handleFlagError reports a flag parsing error and returns the exit code
+func handleFlagError(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		writeHelp(os.Stdout)
+		return exitOK
+	}
+	fmt.Fprintf(os.Stderr, "%v; run '%s help' for usage\n", err, programName)
+	return exitUsage
+}
+
+// writeHelp prints usage, the subcommands, every flag and the exit codes
+func writeHelp(w io.Writer) {
+	fmt.Fprintf(w, "Usage:\n  %s [flags]\n  %s <command> [args]\n\n", programName, programName)
+	fmt.Fprintf(w, "Runs the MCP bash server on stdio, or on TCP when config.json enables network\n"+
+		"mode. config.json is read from the executable's directory, then the current one.\n\n")
+
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range subcommands() {
+		fmt.Fprintf(w, "  %-20s %s\n", strings.TrimSpace(cmd.name+" "+cmd.args), cmd.summary)
+	}
+
+	fmt.Fprintln(w, "\nFlags:")
+	set := newFlagSet(&cliOptions{})
+	set.SetOutput(w)
+	set.PrintDefaults()
+
+	fmt.Fprintln(w, "\nExit status:")
+	for _, exit := range exitCodes {
+		fmt.Fprintf(w, "  %d  %s\n", exit.code, exit.doc)
+	}
+}
+
+// cliFlag describes a registered flag for the completion scripts
+type cliFlag struct {
+	// word is the flag as typed: -v for one-letter flags, --name otherwise
+	word     string
+	name     string
+	usage    string
+	takesArg bool
+	// file is set when the flag's argument is a file name
+	file bool
+}
+
+// registeredFlags lists the flag set's flags, sorted by name
+func registeredFlags() []cliFlag {
+	var flags []cliFlag
+	newFlagSet(&cliOptions{}).VisitAll(func(f *flag.Flag) {
+		argName, usage := flag.UnquoteUsage(f)
+		word := "--" + f.Name
+		if len(f.Name) == 1 {
+			word = "-" + f.Name
+		}
+		flags = append(flags, cliFlag{
+			word:     word,
+			name:     f.Name,
+			usage:    usage,
+			takesArg: !isBoolFlag(f),
+			file:     argName == "file",
+		})
+	})
+	sort.Slice(flags, func(i, j int) bool { return flags[i].name < flags[j].name })
+	return flags
+}
+
+// isBoolFlag reports whether f is a flag that takes no argument
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// joinOr joins words as "a, b or c"
+func joinOr(words []string) string {
+	if len(words) < 2 {
+		return strings.Join(words, "")
+	}
+	return strings.Join(words[:len(words)-1], ", ") + " or " + words[len(words)-1]
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// completionShellNames lists the shells completion scripts exist for
+func completionShellNames() []string {
+	return []string{"bash", "zsh", "fish"}
+}
+
+// completionWriter returns the generator of shell's completion script
+func completionWriter(shell string) (func(w io.Writer), bool) {
+	switch shell {
+	case "bash":
+		return writeBashCompletion, true
+	case "zsh":
+		return writeZshCompletion, true
+	case "fish":
+		return writeFishCompletion, true
+	}
+	return nil, false
+}
+
+// runCompletion prints the completion script for the shell named in args
+func runCompletion(args []string, stdout io.Writer) int {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "usage: %s completion <%s>\n", programName,
+			strings.Join(completionShellNames(), "|"))
+		return exitUsage
+	}
+	write, ok := completionWriter(args[0])
+	if !ok {
+		fmt.Fprintf(os.Stderr, "no completion script for shell %q (supported: %s)\n",
+			args[0], strings.Join(completionShellNames(), ", "))
+		return exitUsage
+	}
+	write(stdout)
+	return exitOK
+}
+
+// writeBashCompletion prints a bash completion script. Source it from
+// ~/.bashrc, or install it in the bash-completion directory.
+func writeBashCompletion(w io.Writer) {
+	var words, fileFlags, argFlags []string
+	for _, f := range registeredFlags() {
+		words = append(words, f.word)
+		switch {
+		case f.file:
+			fileFlags = append(fileFlags, f.word, "-"+f.name)
+		case f.takesArg:
+			argFlags = append(argFlags, f.word, "-"+f.name)
+		}
+	}
+
+	fmt.Fprintf(w, "# bash completion for %s\n", programName)
+	fmt.Fprintf(w, "_mcp_bash() {\n")
+	fmt.Fprintf(w, "\tlocal cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]}\n")
+	fmt.Fprintf(w, "\tCOMPREPLY=()\n")
+	if len(fileFlags) > 0 || len(argFlags) > 0 {
+		fmt.Fprintf(w, "\tcase $prev in\n")
+		if len(fileFlags) > 0 {
+			fmt.Fprintf(w, "\t%s)\n", strings.Join(fileFlags, "|"))
+			fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -f -- \"$cur\"))\n\t\treturn\n\t\t;;\n")
+		}
+		if len(argFlags) > 0 {
+			// A value nothing is known about: offer nothing
+			fmt.Fprintf(w, "\t%s)\n\t\treturn\n\t\t;;\n", strings.Join(argFlags, "|"))
+		}
+		fmt.Fprintf(w, "\tesac\n")
+	}
+	fmt.Fprintf(w, "\tif ((COMP_CWORD > 1)); then\n\t\tcase ${COMP_WORDS[1]} in\n")
+	for _, cmd := range subcommands() {
+		fmt.Fprintf(w, "\t\t%s)\n", cmd.name)
+		if len(cmd.completions) > 0 {
+			fmt.Fprintf(w, "\t\t\t((COMP_CWORD == 2)) && COMPREPLY=($(compgen -W %s -- \"$cur\"))\n",
+				singleQuote(strings.Join(cmd.completions, " ")))
+		}
+		fmt.Fprintf(w, "\t\t\treturn\n\t\t\t;;\n")
+	}
+	fmt.Fprintf(w, "\t\tesac\n\tfi\n")
+	fmt.Fprintf(w, "\tif ((COMP_CWORD == 1)) && [[ $cur != -* ]]; then\n")
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W %s -- \"$cur\"))\n\t\treturn\n\tfi\n",
+		singleQuote(strings.Join(subcommandNames(), " ")))
+	fmt.Fprintf(w, "\tCOMPREPLY=($(compgen -W %s -- \"$cur\"))\n", singleQuote(strings.Join(words, " ")))
+	fmt.Fprintf(w, "}\n")
+	fmt.Fprintf(w, "complete -F _mcp_bash %s\n", programName)
+}
+
+// writeZshCompletion prints a zsh completion script. Save it as _mcp-bash
+// in a directory on $fpath.
+func writeZshCompletion(w io.Writer) {
+	fmt.Fprintf(w, "#compdef %s\n\n", programName)
+	fmt.Fprintf(w, "_mcp_bash() {\n")
+	fmt.Fprintf(w, "\tif ((CURRENT > 2)); then\n\t\tcase ${words[2]} in\n")
+	for _, cmd := range subcommands() {
+		fmt.Fprintf(w, "\t\t%s)\n", cmd.name)
+		if len(cmd.completions) > 0 {
+			fmt.Fprintf(w, "\t\t\t((CURRENT == 3)) && compadd -- %s\n", strings.Join(cmd.completions, " "))
+		}
+		fmt.Fprintf(w, "\t\t\treturn\n\t\t\t;;\n")
+	}
+	fmt.Fprintf(w, "\t\tesac\n\tfi\n")
+
+	fmt.Fprintf(w, "\t_arguments \\\n")
+	for _, f := range registeredFlags() {
+		spec := f.word + "[" + zshEscape(f.usage) + "]"
+		switch {
+		case f.file:
+			spec += ":file:_files"
+		case f.takesArg:
+			spec += ":value: "
+		}
+		fmt.Fprintf(w, "\t\t%s \\\n", singleQuote(spec))
+	}
+	var commands []string
+	for _, cmd := range subcommands() {
+		commands = append(commands, cmd.name+`\:"`+zshEscape(cmd.summary)+`"`)
+	}
+	fmt.Fprintf(w, "\t\t%s\n", singleQuote("1:command:(("+strings.Join(commands, " ")+"))"))
+	fmt.Fprintf(w, "}\n\n")
+	fmt.Fprintf(w, "_mcp_bash \"$@\"\n")
+}
+
+// writeFishCompletion prints a fish completion script. Save it as
+// mcp-bash.fish in ~/.config/fish/completions.
+func writeFishCompletion(w io.Writer) {
+	fmt.Fprintf(w, "# fish completion for %s\n", programName)
+	fmt.Fprintf(w, "complete -c %s -f\n", programName)
+	for _, cmd := range subcommands() {
+		fmt.Fprintf(w, "complete -c %s -n __fish_use_subcommand -a %s -d %s\n",
+			programName, cmd.name, singleQuote(cmd.summary))
+		if len(cmd.completions) > 0 {
+			fmt.Fprintf(w, "complete -c %s -n %s -a %s\n", programName,
+				singleQuote("__fish_seen_subcommand_from "+cmd.name),
+				singleQuote(strings.Join(cmd.completions, " ")))
+		}
+	}
+	for _, f := range registeredFlags() {
+		option := "-l " + f.name
+		if len(f.name) == 1 {
+			option = "-s " + f.name
+		}
+		switch {
+		case f.file:
+			option += " -r -F"
+		case f.takesArg:
+			option += " -r"
+		}
+		fmt.Fprintf(w, "complete -c %s %s -d %s\n", programName, option, singleQuote(f.usage))
+	}
+}
+
+// subcommandNames lists the subcommands' names
+func subcommandNames() []string {
+	var names []string
+	for _, cmd := range subcommands() {
+		names = append(names, cmd.name)
+	}
+	return names
+}
+
+// singleQuote quotes s for bash, zsh and fish alike
+func singleQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// zshEscape escapes the characters _arguments gives a meaning inside a
+// description
+func zshEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`, ":", `\:`).Replace(s)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/config"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/mcp"
+)
+
+// confirmTokenArg is the argument a confirming call carries its token in
+const confirmTokenArg = "confirm_token"
+
+// confirmations makes destructive tools two-phase: a call without a token
+// returns a preview of what it would do and a token, and only the same call
+// repeated with that token goes ahead. Tokens are single-use, expire after
+// ttl, and are bound to a hash of the tool and its other arguments, so the
+// confirmed call can't differ from the previewed one.
+type confirmations struct {
+	tools map[string]bool
+	ttl   time.Duration
+
+	mutex   sync.Mutex
+	pending map[string]pendingConfirmation // by token
+}
+
+// pendingConfirmation is an issued token, and the call it confirms
+type pendingConfirmation struct {
+	tool    string
+	hash    string
+	expires time.Time
+}
+
+// confirmPreview describes what a call would do, for the first phase
+type confirmPreview struct {
+	Text       string
+	Structured map[string]interface{}
+}
+
+// newConfirmations creates the token store, or returns nil if no tool needs
+// confirmation. Tool names were validated when the config was loaded.
+func newConfirmations(cfg *config.Config) *confirmations {
+	if cfg.Confirmation == nil || len(cfg.Confirmation.Tools) == 0 {
+		return nil
+	}
+	c := &confirmations{
+		tools:   make(map[string]bool),
+		ttl:     cfg.Confirmation.GetTTL(),
+		pending: make(map[string]pendingConfirmation),
+	}
+	for _, tool := range cfg.Confirmation.Tools {
+		c.tools[tool] = true
+	}
+	return c
+}
+
+// check runs the confirmation step for a call to a tool that mutates
+// something. It returns nil when the call may go ahead: the tool doesn't
+// need confirmation, the call carries a valid token, or preview finds
+// nothing to confirm (a nil preview). Otherwise it returns the response to
+// give instead: the preview and a new token, or the reason a token was
+// refused. preview is only called for a call without a token.
+func (c *confirmations) check(request mcp.CallToolRequest,
+	preview func() (*confirmPreview, error)) *mcp.CallToolResponse {
+	if c == nil || !c.tools[request.Name] {
+		return nil
+	}
+	token, hash, err := confirmationArgs(request.Name, request.Arguments)
+	if err != nil {
+		response := createErrorResponse(err.Error())
+		return &response
+	}
+
+	if token != "" {
+		if err := c.redeem(token, request.Name, hash); err != nil {
+			response := createErrorResponse(fmt.Sprintf("%v. Call again without %s for a new preview.", err,
+				confirmTokenArg))
+			return &response
+		}
+		fmt.Fprintf(os.Stderr, "Confirmed %s call\n", request.Name)
+		return nil
+	}
+
+	p, err := preview()
+	if err != nil {
+		response := createErrorResponse(err.Error())
+		return &response
+	}
+	if p == nil {
+		return nil
+	}
+	token, expires, err := c.issue(request.Name, hash)
+	if err != nil {
+		response := createErrorResponse(err.Error())
+		return &response
+	}
+	fmt.Fprintf(os.Stderr, "Previewed %s call; awaiting confirmation\n", request.Name)
+
+	text := fmt.Sprintf("Confirmation required; nothing has been changed yet.\n\n%s\n\nTo go ahead, repeat the call "+
+		"with the same arguments plus %s %q within %v.", p.Text, confirmTokenArg, token, c.ttl)
+	return &mcp.CallToolResponse{
+		Content: []mcp.ContentItem{
+			{Type: "text", Text: text},
+		},
+		StructuredContent: map[string]interface{}{
+			"confirmationRequired": true,
+			confirmTokenArg:        token,
+			"expiresAt":            expires,
+			"preview":              p.Structured,
+		},
+	}
+}
+
+// issue creates a token for the call with the given argument hash
+func (c *confirmations) issue(tool, hash string) (string, time.Time, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to create confirmation token: %w", err)
+	}
+	token := hex.EncodeToString(random)
+	expires := time.Now().Add(c.ttl)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	now := time.Now()
+	for t, p := range c.pending {
+		if now.After(p.expires) {
+			delete(c.pending, t)
+		}
+	}
+	c.pending[token] = pendingConfirmation{tool: tool, hash: hash, expires: expires}
+	return token, expires, nil
+}
+
+// redeem uses up a token, checking it was issued for this call. A token is
+// spent by any attempt to use it, so a refused one can't be retried.
+func (c *confirmations) redeem(token, tool, hash string) error {
+	c.mutex.Lock()
+	p, ok := c.pending[token]
+	delete(c.pending, token)
+	c.mutex.Unlock()
+
+	switch {
+	case !ok:
+		return fmt.Errorf("unknown or already used confirmation token")
+	case time.Now().After(p.expires):
+		return fmt.Errorf("confirmation token expired at %s", p.expires.Format(time.RFC3339))
+	case p.tool != tool || p.hash != hash:
+		return fmt.Errorf("confirmation token was issued for a different call; the arguments changed since the " +
+			"preview")
+	}
+	return nil
+}
+
+// confirmationArgs returns a call's confirmation token, if any, and the hash
+// of the tool and its other arguments, canonicalized so that key order and
+// whitespace don't matter
+func confirmationArgs(tool string, args json.RawMessage) (string, string, error) {
+	fields := map[string]json.RawMessage{}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &fields); err != nil {
+			return "", "", fmt.Errorf("invalid arguments for %s tool: %w", tool, err)
+		}
+	}
+	var token string
+	if raw, ok := fields[confirmTokenArg]; ok {
+		if err := json.Unmarshal(raw, &token); err != nil {
+			return "", "", fmt.Errorf("%s must be a string", confirmTokenArg)
+		}
+		delete(fields, confirmTokenArg)
+	}
+
+	rest, err := json.Marshal(fields)
+	if err != nil {
+		return "", "", err
+	}
+	canonical, err := mcp.Canonicalize(rest)
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256(append([]byte(tool+"\x00"), canonical...))
+	return token, hex.EncodeToString(sum[:]), nil
+}
+
+// confirmationPhase names the phase of a two-phase call for the audit log:
+// "preview" for a call answered with a token, "confirm" for one that carried
+// a token, or "" for any other call
+func confirmationPhase(request mcp.CallToolRequest, response mcp.CallToolResponse) string {
+	if _, ok := response.StructuredContent[confirmTokenArg]; ok {
+		return "preview"
+	}
+	if token, _, err := confirmationArgs(request.Name, request.Arguments); err == nil && token != "" {
+		return "confirm"
+	}
+	return ""
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/config"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/mcp"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/mcptest"
+)
+
+// confirmCall is a call to the confirmable write_file tool
+func confirmCall(args string) mcp.CallToolRequest {
+	return mcp.CallToolRequest{Name: "write_file", Arguments: json.RawMessage(args)}
+}
+
+// previewSomething is a preview finding something to confirm
+func previewSomething() (*confirmPreview, error) {
+	return &confirmPreview{Text: "would change things"}, nil
+}
+
+// issueToken runs the first phase of call and returns the token it issues
+func issueToken(t *testing.T, c *confirmations, args string) string {
+	t.Helper()
+	response := c.check(confirmCall(args), previewSomething)
+	if response == nil || response.IsError {
+		t.Fatalf("first phase = %+v, want a preview", response)
+	}
+	token, _ := response.StructuredContent[confirmTokenArg].(string)
+	if token == "" || !strings.Contains(response.Content[0].Text, token) {
+		t.Fatalf("no token in %+v", response)
+	}
+	return token
+}
+
+// withToken adds token to args
+func withToken(args, token string) string {
+	return strings.TrimSuffix(args, "}") + `,"confirm_token":"` + token + `"}`
+}
+
+func TestConfirmationTokens(t *testing.T) {
+	c := newConfirmations(&config.Config{Confirmation: &config.ConfirmationConfig{Tools: []string{"write_file"}}})
+	args := `{"path":"/tmp/x","content":"new"}`
+
+	// Tools not listed, and calls with nothing to confirm, go straight ahead
+	if response := c.check(mcp.CallToolRequest{Name: "file_edit", Arguments: json.RawMessage(args)},
+		previewSomething); response != nil {
+		t.Errorf("unlisted tool needed confirmation")
+	}
+	if response := c.check(confirmCall(args), func() (*confirmPreview, error) { return nil, nil }); response != nil {
+		t.Errorf("a call with no preview needed confirmation")
+	}
+
+	// The token confirms the same call once, whatever the key order
+	token := issueToken(t, c, args)
+	reordered := `{ "content": "new", "path": "/tmp/x" }`
+	if response := c.check(confirmCall(withToken(reordered, token)), previewSomething); response != nil {
+		t.Fatalf("valid token refused: %s", response.Content[0].Text)
+	}
+	if response := c.check(confirmCall(withToken(args, token)), previewSomething); response == nil ||
+		!strings.Contains(response.Content[0].Text, "already used") {
+		t.Errorf("a token was redeemed twice")
+	}
+
+	// A token can't confirm a different call, and is spent by trying
+	token = issueToken(t, c, args)
+	changed := `{"path":"/etc/passwd","content":"new"}`
+	if response := c.check(confirmCall(withToken(changed, token)), previewSomething); response == nil ||
+		!strings.Contains(response.Content[0].Text, "different call") {
+		t.Errorf("a token confirmed a different call")
+	}
+	if response := c.check(confirmCall(withToken(args, token)), previewSomething); response == nil {
+		t.Errorf("a refused token was accepted on retry")
+	}
+
+	// Nor once it has expired
+	c.ttl = -time.Second
+	token = issueToken(t, c, args)
+	if response := c.check(confirmCall(withToken(args, token)), previewSomething); response == nil ||
+		!strings.Contains(response.Content[0].Text, "expired") {
+		t.Errorf("an expired token was accepted")
+	}
+
+	var none *confirmations
+	if response := none.check(confirmCall(args), previewSomething); response != nil {
+		t.Errorf("no confirmations config still asked for confirmation")
+	}
+}
+
+func TestWriteFileConfirmation(t *testing.T) {
+	h := newTestServerWithConfig(t, &config.Config{CommandTimeout: 30, Enabled: true,
+		Confirmation: &config.ConfirmationConfig{Tools: []string{"write_file"}}})
+	h.Initialize(t)
+
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	args := map[string]interface{}{"path": path, "content": "first\n"}
+	response := h.CallTool(t, "write_file", args)
+	if response.IsError || response.StructuredContent["confirmationRequired"] != nil {
+		t.Fatalf("creating a file asked for confirmation: %s", mcptest.Text(response))
+	}
+
+	args["content"], args["mode"] = "second\n", "overwrite"
+	response = h.CallTool(t, "write_file", args)
+	if response.StructuredContent["confirmationRequired"] != true || !strings.Contains(mcptest.Text(response), "+second") {
+		t.Fatalf("overwriting gave %q, want a diff and a token", mcptest.Text(response))
+	}
+	if data, _ := os.ReadFile(path); string(data) != "first\n" {
+		t.Errorf("content = %q, want the file untouched until confirmed", data)
+	}
+
+	args[confirmTokenArg] = response.StructuredContent[confirmTokenArg]
+	if response := h.CallTool(t, "write_file", args); response.IsError {
+		t.Fatalf("confirmed write failed: %s", mcptest.Text(response))
+	}
+	if data, _ := os.ReadFile(path); string(data) != "second\n" {
+		t.Errorf("content = %q, want the confirmed write", data)
+	}
+}
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/bash"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/config"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/mcp"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/policy"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/secrets"
+)
+
+// customTool is a tool declared in the config's customTools
+type customTool struct {
+	config   config.CustomToolConfig
+	template *bash.CommandTemplate
+	patterns map[string]*regexp.Regexp // parameter name -> pattern, anchored
+}
+
+// customTools holds the registered custom tools by name. A reload replaces
+// the map, with customToolsMux held while the tool registry changes too.
+var (
+	customToolsMux sync.RWMutex
+	customTools    = map[string]*customTool{}
+)
+
+// findCustomTool looks up a registered custom tool
+func findCustomTool(name string) (*customTool, bool) {
+	customToolsMux.RLock()
+	defer customToolsMux.RUnlock()
+	tool, ok := customTools[name]
+	return tool, ok
+}
+
+// customToolCount returns how many custom tools are registered
+func customToolCount() int {
+	customToolsMux.RLock()
+	defer customToolsMux.RUnlock()
+	return len(customTools)
+}
+
+// registerCustomTools adds the configured custom tools to the tool registry,
+// after the built-in tools. They run in the bash session, so they are left
+// out when the shell tools are unavailable.
+func registerCustomTools(cfg *config.Config) error {
+	if len(cfg.CustomTools) == 0 {
+		return nil
+	}
+	if !bash.BashTools.Has("bash") {
+		fmt.Fprintf(os.Stderr, "Warning: custom tools need the shell; none are served\n")
+		return nil
+	}
+
+	staged, tools, problems := stageCustomTools(cfg.CustomTools, nil)
+	if len(problems) > 0 {
+		return problems[0]
+	}
+	return installCustomTools(staged, tools)
+}
+
+// stageCustomTools builds the declared tools into a candidate registry,
+// checking that each one's template and parameters agree, that its name
+// isn't a built-in tool's and, given syntax, that its command parses. It
+// returns every problem found, not just the first.
+func stageCustomTools(declared []config.CustomToolConfig,
+	syntax func(command string) (*bash.SyntaxResult, error)) (*mcp.Registry[bash.BashTool], map[string]*customTool,
+	[]error) {
+	staged := mcp.NewRegistry[bash.BashTool]()
+	tools := make(map[string]*customTool, len(declared))
+	var problems []error
+	for _, declared := range declared {
+		if _, custom := findCustomTool(declared.Name); bash.BashTools.Has(declared.Name) && !custom {
+			problems = append(problems, fmt.Errorf("customTools %s: a built-in tool has that name", declared.Name))
+			continue
+		}
+		tool, err := newCustomTool(declared)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("customTools %s: %w", declared.Name, err))
+			continue
+		}
+		if syntax != nil {
+			// Values are assigned to variables, so they can't change how
+			// the command parses; empty ones will do
+			result, err := syntax(tool.template.Render(nil))
+			if err == nil && !result.OK() {
+				err = fmt.Errorf("command does not parse: %s", result.Text())
+			}
+			if err != nil {
+				problems = append(problems, fmt.Errorf("customTools %s: %w", declared.Name, err))
+				continue
+			}
+		}
+
+		title := declared.Title
+		if title == "" {
+			title = declared.Name
+		}
+		err = staged.Add(declared.Name, bash.BashTool{
+			Name:        declared.Name,
+			Description: declared.Description,
+			InputSchema: tool.schema(),
+			Annotations: &mcp.ToolAnnotations{
+				Title:           title,
+				ReadOnlyHint:    declared.ReadOnly,
+				DestructiveHint: !declared.ReadOnly,
+				OpenWorldHint:   true,
+			},
+		})
+		if err != nil {
+			problems = append(problems, fmt.Errorf("customTools: tool %v", err))
+			continue
+		}
+		tools[declared.Name] = tool
+	}
+	return staged, tools, problems
+}
+
+// installCustomTools replaces the registered custom tools with staged ones
+// in a single step, so a concurrent tools/list or tools/call sees either the
+// old set or the new
+func installCustomTools(staged *mcp.Registry[bash.BashTool], tools map[string]*customTool) error {
+	customToolsMux.Lock()
+	defer customToolsMux.Unlock()
+	old := make([]string, 0, len(customTools))
+	for name := range customTools {
+		old = append(old, name)
+	}
+	if err := bash.BashTools.Replace(old, staged); err != nil {
+		return fmt.Errorf("customTools: tool %v", err)
+	}
+	customTools = tools
+	for _, name := range staged.Names() {
+		fmt.Fprintf(os.Stderr, "Custom tool %s registered\n", name)
+	}
+	return nil
+}
+
+// newCustomTool parses a custom tool's template and checks that it and the
+// declared parameters agree
+func newCustomTool(declared config.CustomToolConfig) (*customTool, error) {
+	var numeric []string
+	for name, param := range declared.Parameters {
+		if param.Type == "integer" || param.Type == "number" {
+			numeric = append(numeric, name)
+		}
+	}
+	template, err := bash.ParseCommandTemplate(declared.Command, numeric)
+	if err != nil {
+		return nil, err
+	}
+	tool := &customTool{config: declared, template: template, patterns: make(map[string]*regexp.Regexp)}
+
+	used := template.Placeholders()
+	for _, name := range used {
+		if _, ok := declared.Parameters[name]; !ok {
+			return nil, fmt.Errorf("command uses {{%s}}, which is not a declared parameter", name)
+		}
+	}
+	for name, param := range declared.Parameters {
+		if !slices.Contains(used, name) {
+			fmt.Fprintf(os.Stderr, "Warning: customTools %s: parameter %s is not used in the command\n",
+				declared.Name, name)
+		}
+		if param.Pattern != "" {
+			tool.patterns[name] = regexp.MustCompile("^(?:" + param.Pattern + ")$")
+		}
+	}
+	for name, param := range declared.Parameters {
+		if param.Default != nil {
+			if _, err := tool.value(name, param.Default); err != nil {
+				return nil, fmt.Errorf("invalid default: %w", err)
+			}
+		}
+	}
+	return tool, nil
+}
+
+// schema returns the tool's input schema
+func (t *customTool) schema() map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := []string{}
+	for name, param := range t.config.Parameters {
+		property := map[string]interface{}{"type": param.Type}
+		if param.Description != "" {
+			property["description"] = param.Description
+		}
+		if len(param.Enum) > 0 {
+			property["enum"] = param.Enum
+		}
+		if param.Pattern != "" {
+			property["pattern"] = t.patterns[name].String()
+		}
+		if param.Default != nil {
+			property["default"] = param.Default
+		}
+		properties[name] = property
+		if param.Required {
+			required = append(required, name)
+		}
+	}
+	sort.Strings(required)
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+// arguments validates a call's arguments against the declared parameters
+// and returns the value of each, as text for the command template
+func (t *customTool) arguments(args json.RawMessage) (map[string]string, error) {
+	var given map[string]json.RawMessage
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &given); err != nil {
+			return nil, fmt.Errorf("invalid arguments for %s tool: %w", t.config.Name, err)
+		}
+	}
+	for name := range given {
+		if _, ok := t.config.Parameters[name]; !ok {
+			return nil, fmt.Errorf("unknown parameter %q for %s tool", name, t.config.Name)
+		}
+	}
+
+	values := make(map[string]string, len(t.config.Parameters))
+	for name, param := range t.config.Parameters {
+		raw, ok := given[name]
+		if !ok || string(raw) == "null" {
+			if param.Required {
+				return nil, fmt.Errorf("%s parameter is required", name)
+			}
+			if raw = param.Default; raw == nil {
+				values[name] = ""
+				continue
+			}
+		}
+		value, err := t.value(name, raw)
+		if err != nil {
+			return nil, err
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+// value checks one argument against its parameter's type and limits and
+// returns it as text: a string as given, a number in canonical form
+func (t *customTool) value(name string, raw json.RawMessage) (string, error) {
+	param := t.config.Parameters[name]
+	switch param.Type {
+	case "integer", "number":
+		var number json.Number
+		canonical, err := mcp.Canonicalize(raw)
+		if err != nil || json.Unmarshal(raw, &number) != nil || strings.HasPrefix(string(raw), `"`) {
+			return "", fmt.Errorf("%s must be a number", name)
+		}
+		if param.Type == "integer" && strings.ContainsAny(string(canonical), ".e") {
+			return "", fmt.Errorf("%s must be an integer", name)
+		}
+		return string(canonical), nil
+
+	case "boolean":
+		var b bool
+		if err := json.Unmarshal(raw, &b); err != nil {
+			return "", fmt.Errorf("%s must be a boolean", name)
+		}
+		return fmt.Sprint(b), nil
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return "", fmt.Errorf("%s must be a string", name)
+	}
+	if strings.ContainsRune(s, 0) {
+		return "", fmt.Errorf("%s must not contain NUL characters", name)
+	}
+	if len(param.Enum) > 0 && !slices.Contains(param.Enum, s) {
+		return "", fmt.Errorf("%s must be one of %s", name, strings.Join(param.Enum, ", "))
+	}
+	if pattern := t.patterns[name]; pattern != nil && !pattern.MatchString(s) {
+		return "", fmt.Errorf("%s does not match the pattern %s", name, pattern)
+	}
+	return s, nil
+}
+
+// runCustomTool runs a custom tool's command in the bash session, subject to
+// the policy engine and admission control like any bash command
+func runCustomTool(ctx context.Context, tool *customTool, request mcp.CallToolRequest, bashManager *bash.BashManager,
+	server *mcp.Server, cfg *config.Config, disk *bash.DiskMonitor, admission *bash.Admission, hook *policy.Hook,
+	store *secrets.Store, latency *latencyTracker, activity *activityBoard) mcp.CallToolResponse {
+	values, err := tool.arguments(request.Arguments)
+	if err != nil {
+		return createErrorResponse(err.Error())
+	}
+	command := tool.template.Render(values)
+
+	// The policy engine sees the command that will run; a rewrite can't be
+	// applied to a curated command, so it counts as a denial
+	decision := checkPolicy(hook, cfg, server, bashManager, request.Name, command, "", request.Meta, false)
+	if !decision.Allow {
+		return createErrorResponse(fmt.Sprintf("Command denied by policy: %s", decision.Reason))
+	}
+	if rewriteFromDecision(decision, command) != nil {
+		return createErrorResponse("Command denied by policy: rewriting custom tool commands is not supported")
+	}
+	if err := bashManager.AllowedRoots().CheckCommand(command); err != nil {
+		return createErrorResponse(fmt.Sprintf("Command not run: %v", err))
+	}
+
+	release, refused := admit(ctx, admission, command, nil, store)
+	if refused != nil {
+		return *refused
+	}
+	defer release()
+
+	diskWarning, _ := checkDisk(disk, false, bashManager.WorkingDirectory())
+
+	fmt.Fprintf(os.Stderr, "Running custom tool %s\n", request.Name) // argument values are not logged
+	started := time.Now()
+	activity.begin(request.Name)
+	progress := newProgressReporter(server, cfg, request.Meta, store)
+	result, err := bashManager.ExecuteCommandContext(ctx, command, 0, progress.output(), progress.queued())
+	activity.end()
+	latency.record(request.Name, time.Since(started), len(result.Output), bashManager.SessionID(), backendSession)
+	if !errors.Is(err, bash.ErrSessionBusy) {
+		bashManager.RecordHistory(request.Name, command, true, time.Since(started), result, err)
+	}
+
+	if errors.Is(err, bash.ErrCommandCancelled) {
+		return createErrorResponse("Command cancelled by the client")
+	}
+	if errors.Is(err, bash.ErrSessionBusy) {
+		return createErrorResponse(fmt.Sprintf("Command not run: %v. Try again once they have finished.", err))
+	}
+	if errors.Is(err, bash.ErrCommandTimedOut) {
+		response := createCommandResponse(cleanOutput(result, cfg.StripANSI), cfg, false)
+		response.IsError = true
+		prependWarning(&response, fmt.Sprintf("Command killed: %v. Output captured before then follows.", err))
+		annotateTimeout(&response, bashManager.DescribeTimeout(0), result)
+		return response
+	}
+	if err != nil {
+		return createErrorResponse(fmt.Sprintf("Command execution failed: %v", err))
+	}
+	result.Failure = bashManager.AnalyzeResult(command, result)
+
+	response := createCommandResponse(cleanOutput(result, cfg.StripANSI), cfg, false)
+	annotateTimeout(&response, bashManager.DescribeTimeout(0), result)
+	prependWarning(&response, diskWarning)
+	return response
+}
+
+// customToolReload is the outcome of the last reload, for server_stats
+type customToolReload struct {
+	Time     time.Time `json:"time"`
+	OK       bool      `json:"ok"`
+	Tools    []string  `json:"tools"`
+	Problems []string  `json:"problems,omitempty"`
+}
+
+var (
+	lastReloadMux sync.Mutex
+	lastReload    *customToolReload
+)
+
+// lastCustomToolReload returns the outcome of the last reload, nil if there
+// hasn't been one
+func lastCustomToolReload() *customToolReload {
+	lastReloadMux.Lock()
+	defer lastReloadMux.Unlock()
+	return lastReload
+}
+
+// reloadCustomTools re-reads the custom tools from the config file, on
+// SIGHUP. The new set is built and checked in full before anything changes:
+// if any tool fails, every problem is logged and the old set stays in
+// place. Otherwise the set is swapped at once and clients are told the tool
+// list changed.
+func reloadCustomTools(server *mcp.Server, bashManager *bash.BashManager, cfg *config.Config,
+	opts config.LoadOptions) *customToolReload {
+	status := &customToolReload{Time: time.Now()}
+	defer func() {
+		lastReloadMux.Lock()
+		lastReload = status
+		lastReloadMux.Unlock()
+	}()
+
+	fmt.Fprintf(os.Stderr, "Reloading custom tools from %s\n", cfg.Path)
+	declared, problems := config.LoadCustomTools(cfg.Path, opts)
+	if len(declared) > 0 && !bash.BashTools.Has("bash") {
+		problems = append(problems, fmt.Errorf("custom tools need the shell"))
+	}
+	var staged *mcp.Registry[bash.BashTool]
+	var tools map[string]*customTool
+	if len(problems) == 0 {
+		staged, tools, problems = stageCustomTools(declared, bashManager.CheckSyntax)
+	}
+	if len(problems) == 0 {
+		if err := installCustomTools(staged, tools); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	if len(problems) > 0 {
+		for _, problem := range problems {
+			status.Problems = append(status.Problems, problem.Error())
+			fmt.Fprintf(os.Stderr, "Custom tool reload: %v\n", problem)
+		}
+		fmt.Fprintf(os.Stderr, "Custom tool reload failed; keeping the current tools\n")
+		for _, tool := range bash.BashTools.Names() {
+			if _, ok := findCustomTool(tool); ok {
+				status.Tools = append(status.Tools, tool)
+			}
+		}
+		return status
+	}
+
+	status.OK, status.Tools = true, staged.Names()
+	fmt.Fprintf(os.Stderr, "Custom tools reloaded: %d served\n", len(status.Tools))
+	if server.Initialized() {
+		if err := server.SendNotification("notifications/tools/list_changed", nil); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to send tools/list_changed: %v\n", err)
+		}
+	}
+	go refreshFeatureMap(server, bashManager, cfg)
+	return status
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/bash"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/config"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/mcp"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/mcptest"
+)
+
+func TestCustomToolArithmeticPlaceholders(t *testing.T) {
+	declared := config.CustomToolConfig{
+		Name:       "double",
+		Command:    "echo $(( {{n}} * 2 ))",
+		Parameters: map[string]config.CustomToolParameter{"n": {Type: "string"}},
+	}
+	if _, err := newCustomTool(declared); err == nil || !strings.Contains(err.Error(), "arithmetic") {
+		t.Errorf("string parameter in $((...)): err = %v, want it rejected", err)
+	}
+
+	declared.Parameters = map[string]config.CustomToolParameter{"n": {Type: "integer"}}
+	tool, err := newCustomTool(declared)
+	if err != nil {
+		t.Fatalf("integer parameter in $((...)) rejected: %v", err)
+	}
+	if _, err := tool.arguments([]byte(`{"n": "a[$(id)]"}`)); err == nil {
+		t.Errorf("a string argument for an integer parameter was accepted")
+	}
+	values, err := tool.arguments([]byte(`{"n": 21}`))
+	if err != nil || values["n"] != "21" {
+		t.Errorf("arguments = %v, %v; want n=21", values, err)
+	}
+}
+
+// writeCustomTools writes a config file declaring tools and returns a
+// config pointing at it. The custom tools registered by then are restored
+// when the test ends.
+func writeCustomTools(t *testing.T, tools string) *config.Config {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"commandTimeout": 30, "customTools": `+tools+`}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := installCustomTools(mcp.NewRegistry[bash.BashTool](), map[string]*customTool{}); err != nil {
+			t.Errorf("failed to drop the custom tools: %v", err)
+		}
+	})
+	declared, problems := config.LoadCustomTools(path, config.LoadOptions{AllowInsecure: true})
+	if len(problems) > 0 {
+		t.Fatal(problems)
+	}
+	return &config.Config{CommandTimeout: 30, Enabled: true, Path: path, CustomTools: declared}
+}
+
+// reloadWith rewrites the config file to declare tools and reloads them
+func reloadWith(t *testing.T, h *mcptest.Harness, cfg *config.Config, tools string) *customToolReload {
+	t.Helper()
+	if err := os.WriteFile(cfg.Path, []byte(`{"customTools": `+tools+`}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	bashManager := bash.NewBashManager(bash.Options{Timeout: cfg.GetTimeout()})
+	t.Cleanup(bashManager.Close)
+	return reloadCustomTools(h.Server, bashManager, cfg, config.LoadOptions{AllowInsecure: true})
+}
+
+// hasTool reports whether tools/list lists name
+func hasTool(t *testing.T, h *mcptest.Harness, name string) bool {
+	t.Helper()
+	for _, tool := range h.ListTools(t) {
+		if tool.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestReloadCustomTools(t *testing.T) {
+	cfg := writeCustomTools(t, `[{"name": "greet", "description": "Greets", "command": "echo hello {{who}}",
+		"parameters": {"who": {}}}]`)
+	if err := registerCustomTools(cfg); err != nil {
+		t.Fatal(err)
+	}
+	h := newTestServerWithConfig(t, cfg)
+	result := h.Initialize(t)
+	if !strings.Contains(string(result.Capabilities), `"listChanged":true`) {
+		t.Errorf("capabilities = %s, want tools.listChanged", result.Capabilities)
+	}
+
+	status := reloadWith(t, h, cfg, `[{"name": "shout", "description": "Shouts", "command": "echo {{words}} | tr a-z A-Z",
+		"parameters": {"words": {}}}]`)
+	if !status.OK || len(status.Tools) != 1 || status.Tools[0] != "shout" {
+		t.Fatalf("reload = %+v", status)
+	}
+	if hasTool(t, h, "greet") || !hasTool(t, h, "shout") {
+		t.Errorf("tools/list doesn't have the reloaded set")
+	}
+	response := h.CallTool(t, "shout", map[string]interface{}{"words": "hi"})
+	if !strings.Contains(mcptest.Text(response), "HI") {
+		t.Errorf("shout = %q", mcptest.Text(response))
+	}
+	if lastCustomToolReload() != status {
+		t.Errorf("the reload was not recorded for server_stats")
+	}
+}
+
+func TestReloadCustomToolsKeepsOldSetOnFailure(t *testing.T) {
+	cfg := writeCustomTools(t, `[{"name": "greet", "description": "Greets", "command": "echo hello {{who}}",
+		"parameters": {"who": {}}}]`)
+	if err := registerCustomTools(cfg); err != nil {
+		t.Fatal(err)
+	}
+	h := newTestServerWithConfig(t, cfg)
+	h.Initialize(t)
+
+	status := reloadWith(t, h, cfg, `[
+		{"name": "fine", "description": "Fine", "command": "echo fine"},
+		{"name": "unparsed", "description": "Doesn't parse", "command": "if true; then echo"},
+		{"name": "undeclared", "description": "Undeclared value", "command": "echo {{missing}}",
+		 "parameters": {"other": {}}},
+		{"name": "bash", "description": "Shadows a built-in", "command": "echo no"}
+	]`)
+	if status.OK {
+		t.Fatalf("a reload with broken tools succeeded: %+v", status)
+	}
+	problems := strings.Join(status.Problems, "\n")
+	for _, name := range []string{"unparsed", "undeclared", "bash"} {
+		if !strings.Contains(problems, "customTools "+name) {
+			t.Errorf("problems %q don't mention %s", problems, name)
+		}
+	}
+	if strings.Contains(problems, "fine") {
+		t.Errorf("problems %q blame a valid tool", problems)
+	}
+
+	if !hasTool(t, h, "greet") || hasTool(t, h, "fine") {
+		t.Errorf("a failed reload changed the tool list")
+	}
+	if len(status.Tools) != 1 || status.Tools[0] != "greet" {
+		t.Errorf("status tools = %v, want the ones still served", status.Tools)
+	}
+	if response := h.CallTool(t, "bash", map[string]interface{}{"command": "echo built-in"}); response.IsError {
+		t.Errorf("the built-in bash tool was replaced: %s", mcptest.Text(response))
+	}
+}
+
+func TestReloadCustomToolsUnderLoad(t *testing.T) {
+	cfg := writeCustomTools(t, `[{"name": "greet", "description": "Greets", "command": "echo hello"}]`)
+	if err := registerCustomTools(cfg); err != nil {
+		t.Fatal(err)
+	}
+	h := newTestServerWithConfig(t, cfg)
+	h.Initialize(t)
+
+	// Calls racing the reloads get either version of greet, never neither
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				raw := h.Call(t, "tools/call", map[string]interface{}{"name": "greet", "arguments": map[string]interface{}{}})
+				var response mcp.CallToolResponse
+				json.Unmarshal(raw, &response)
+				if text := mcptest.Text(response); !strings.Contains(text, "hello") {
+					t.Errorf("greet during a reload = %q", text)
+				}
+				h.ListTools(t)
+			}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		command := []string{"echo hello", "echo hello again"}[i%2]
+		status := reloadWith(t, h, cfg, `[{"name": "greet", "description": "Greets", "command": "`+command+`"}]`)
+		if !status.OK {
+			t.Errorf("reload %d: %+v", i, status)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"time"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/bash"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/config"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/mcp"
+)
+
+// newDiskMonitor creates the disk space monitor, or nil if it is disabled
+func newDiskMonitor(cfg *config.Config) *bash.DiskMonitor {
+	if !cfg.IsDiskCheckEnabled() {
+		return nil
+	}
+	opts := bash.DiskSpaceOptions{}
+	if dc := cfg.DiskCheck; dc != nil {
+		opts.WarnPercent = dc.WarnPercent
+		opts.WarnBytes = uint64(dc.WarnMB) * 1024 * 1024
+		opts.FloorBytes = uint64(dc.FloorMB) * 1024 * 1024
+		opts.WatchRoots = dc.WatchRoots
+		opts.CacheTTL = time.Duration(dc.CacheSeconds) * time.Second
+	}
+	return bash.NewDiskMonitor(opts)
+}
+
+// checkDisk runs the disk space check for the given paths. It returns a
+// warning to attach to the response ("" if none) and, for write operations,
+// an error if any path is below the hard floor.
+func checkDisk(disk *bash.DiskMonitor, write bool, paths ...string) (string, error) {
+	if disk == nil {
+		return "", nil
+	}
+	report := disk.Check(paths...)
+	if write {
+		if err := disk.FloorError(report); err != nil {
+			return "", err
+		}
+	}
+	return report.Warning(), nil
+}
+
+// prependWarning adds warning as the first content item, if non-empty
+func prependWarning(response *mcp.CallToolResponse, warning string) {
+	if warning == "" {
+		return
+	}
+	response.Content = append([]mcp.ContentItem{{Type: "text", Text: warning}}, response.Content...)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/bash"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/config"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/mcp"
+)
+
+// featureMapCapability is the capabilities.experimental key the feature map is
+// advertised under. featureMapVersion is bumped when the shape changes
+// incompatibly so clients can branch safely.
+const (
+	featureMapCapability = "bashServer/features"
+	featureMapVersion    = 1
+
+	// featureMapNotification carries the complete feature map when it
+	// changes after initialize
+	featureMapNotification = "notifications/bashServer/features"
+
+	// toolIDMetaKey is the tools/list _meta key carrying each tool's stable ID
+	toolIDMetaKey = "bashServer/id"
+)
+
+// toolFeatures maps features to the tools that provide them. A feature is only
+// advertised when every one of its tools is registered in bash.BashTools.
+var toolFeatures = map[string][]string{
+	"fileTools":      {"file_edit"},
+	"readFile":       {"read_file"},
+	"writeFile":      {"write_file"},
+	"scriptBuffers":  {"bash_script_buffer"},
+	"scriptTool":     {"bash_script"},
+	"outputBudget":   {"session_budget"},
+	"sessionList":    {"bash_sessions"},
+	"commandHistory": {"bash_history"},
+	"serverStats":    {"server_stats"},
+	"exec":           {"exec"},
+	"outputPaging":   {"bash_output"},
+	"interrupt":      {"interrupt_session"},
+	"fetchArtifact":  {"fetch_artifact"},
+	"eventPolling":   {"events_poll"},
+	"fileLocks":      {"acquire_lock", "release_lock"},
+	"backgroundJobs": {"bash_job_status", "bash_job_output", "bash_job_kill"},
+}
+
+// argumentFeatures maps features to the bash tool arguments that provide them.
+// A feature is only advertised when its argument is in bash.BashToolSchema
+// and the bash tool is registered.
+var argumentFeatures = map[string]string{
+	"bypassSession":    "bypassSession",
+	"sessionRestart":   "restart",
+	"perCallTimeout":   "timeout",
+	"workingDirectory": "working_directory",
+	"perCallEnv":       "env",
+	"noNetwork":        "noNetwork",
+	"stdin":            "stdin",
+	"secrets":          "use_secret",
+	"binaryOutput":     "encoding",
+	"stripAnsi":        "strip_ansi",
+	"pty":              "pty",
+	"quietOutput":      "quiet",
+	"commandWeight":    "weight",
+	"pipelineProfile":  "profilePipeline",
+	"syntaxCheck":      "validate_only",
+	"collectArtifacts": "collectArtifacts",
+}
+
+// buildFeatureMap describes what this deployment supports, derived from the
+// registered tools, the bash tool schema, registered handlers, and config, so
+// it can't claim features that aren't wired.
+func buildFeatureMap(server *mcp.Server, bashManager *bash.BashManager, cfg *config.Config) map[string]interface{} {
+	features := make(map[string]bool)
+
+	for feature, tools := range toolFeatures {
+		available := true
+		for _, name := range tools {
+			if !bash.BashTools.Has(name) {
+				available = false
+			}
+		}
+		features[feature] = available
+	}
+
+	properties, _ := bash.BashToolSchema["properties"].(map[string]interface{})
+	for feature, arg := range argumentFeatures {
+		_, hasArg := properties[arg]
+		features[feature] = hasArg && bash.BashTools.Has("bash")
+	}
+
+	features["cancellation"] = server.HasNotificationHandler("notifications/cancelled")
+	features["idleTimeout"] = cfg.TimeoutMode == bash.TimeoutModeIdle
+	features["diskSpaceCheck"] = cfg.IsDiskCheckEnabled()
+	features["idleSessionClose"] = cfg.SessionIdleTimeout > 0
+	features["policyHook"] = cfg.PolicyHook != nil
+	features["sandbox"] = cfg.IsSandboxEnabled()
+	features["allowedRoots"] = bashManager.AllowedRoots() != nil
+	features["networkDisabled"] = cfg.IsNetworkAccessDisabled() || cfg.IsSandboxEnabled()
+	features["admissionControl"] = cfg.Admission != nil
+	features["writeQuota"] = cfg.WriteQuota != nil
+	features["customTools"] = customToolCount() > 0
+	features["confirmation"] = cfg.Confirmation != nil && len(cfg.Confirmation.Tools) > 0
+	features["commandWeight"] = features["commandWeight"] && cfg.Admission != nil
+	features["resourceLimits"] = cfg.Limits != nil && *cfg.Limits != (config.LimitsConfig{})
+	features["progress"] = !cfg.IsNetworkEnabled()
+	features["secrets"] = features["secrets"] && cfg.Secrets != nil
+	features["outputBudget"] = features["outputBudget"] && cfg.OutputBudgetBytes > 0
+	features["outputPaging"] = features["outputPaging"] && cfg.StoredOutputBytes >= 0
+	features["outputResources"] = cfg.OutputResources && server.GetHandler("resources/read") != nil
+	features["orderedResponses"] = cfg.OrderedResponses && !cfg.IsNetworkEnabled()
+	features["compression"] = cfg.IsNetworkEnabled() && cfg.Network.Compression != ""
+	features["pty"] = features["pty"] && bash.PTYSupported
+	features["windowsPaths"] = bashManager.WindowsPaths() != nil
+	features["backgroundJobs"] = features["backgroundJobs"] && bash.BashTools.Has("bash")
+	features["failureContext"] = bash.BashTools.Has("bash") || bash.BashTools.Has("exec")
+
+	// Host probes still running at startup are reported as pending and
+	// their features as unavailable until refreshFeatureMap runs
+	hostCapabilities, pending := bashManager.HostCapabilities()
+	features["noNetwork"] = features["noNetwork"] && hostCapabilities["networkIsolation"]
+
+	featureMap := map[string]interface{}{
+		"version": featureMapVersion,
+		"platform": map[string]string{
+			"os":   runtime.GOOS,
+			"arch": runtime.GOARCH,
+		},
+		"hostCapabilities": hostCapabilities,
+		"transport":        transportName(cfg),
+		"features":         features,
+	}
+	if len(pending) > 0 {
+		featureMap["pendingProbes"] = pending
+	}
+	return featureMap
+}
+
+// refreshFeatureMap rebuilds the feature map once the host probes finish,
+// for clients that initialize later, and sends it to a client that has
+// already initialized with the partial map.
+func refreshFeatureMap(server *mcp.Server, bashManager *bash.BashManager, cfg *config.Config) {
+	<-bashManager.ProbesDone()
+	featureMap := buildFeatureMap(server, bashManager, cfg)
+	server.SetExperimentalCapability(featureMapCapability, featureMap)
+	if server.Initialized() {
+		if err := server.SendNotification(featureMapNotification, featureMap); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not send the updated feature map: %v\n", err)
+		}
+	}
+}
+
+// transportName returns the name of the transport selected by config
+func transportName(cfg *config.Config) string {
+	if cfg.IsNetworkEnabled() {
+		return "network"
+	}
+	return "stdio"
+}
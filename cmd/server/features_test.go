@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"runtime"
+	"testing"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/bash"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/config"
+)
+
+func TestFeatureMapMatchesDeployment(t *testing.T) {
+	h := newTestServer(t)
+	bashManager := bash.NewBashManager(bash.Options{})
+	t.Cleanup(bashManager.Close)
+
+	cfg := &config.Config{OutputBudgetBytes: 1000}
+	featureMap := buildFeatureMap(h.Server, bashManager, cfg)
+	if featureMap["version"] != featureMapVersion || featureMap["transport"] != "stdio" {
+		t.Errorf("version %v, transport %v", featureMap["version"], featureMap["transport"])
+	}
+	if platform := featureMap["platform"].(map[string]string); platform["os"] != runtime.GOOS {
+		t.Errorf("platform = %v", platform)
+	}
+
+	features := featureMap["features"].(map[string]bool)
+	for feature, want := range map[string]bool{
+		"readFile":     true,
+		"fileTools":    true,
+		"cancellation": true,
+		"outputBudget": true,
+		"policyHook":   false,
+		"secrets":      false,
+		"customTools":  false,
+		"windowsPaths": false,
+	} {
+		if features[feature] != want {
+			t.Errorf("%s = %v, want %v", feature, features[feature], want)
+		}
+	}
+
+	// Config-dependent features follow the config
+	cfg.OutputBudgetBytes = 0
+	features = buildFeatureMap(h.Server, bashManager, cfg)["features"].(map[string]bool)
+	if features["outputBudget"] {
+		t.Errorf("outputBudget advertised with no budget configured")
+	}
+}
+
+func TestFeatureMapAdvertisedInInitialize(t *testing.T) {
+	h := newTestServer(t)
+	bashManager := bash.NewBashManager(bash.Options{})
+	t.Cleanup(bashManager.Close)
+
+	h.Server.SetExperimentalCapability(featureMapCapability,
+		buildFeatureMap(h.Server, bashManager, &config.Config{}))
+	result := h.Initialize(t)
+
+	var capabilities struct {
+		Experimental map[string]struct {
+			Version  int             `json:"version"`
+			Features map[string]bool `json:"features"`
+		} `json:"experimental"`
+	}
+	if err := json.Unmarshal(result.Capabilities, &capabilities); err != nil {
+		t.Fatal(err)
+	}
+	advertised, ok := capabilities.Experimental[featureMapCapability]
+	if !ok || advertised.Version != featureMapVersion || !advertised.Features["readFile"] {
+		t.Errorf("capabilities %s don't carry the feature map", result.Capabilities)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/bash"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/mcptest"
+)
+
+func TestFileEditRelativeToSessionDirectory(t *testing.T) {
+	if _, err := bash.FindShell(bash.DefaultShell); err != nil {
+		t.Skip(err)
+	}
+	h := newTestServer(t)
+	h.Initialize(t)
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("draft\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	h.CallTool(t, "bash", map[string]interface{}{"command": "cd " + dir})
+
+	response := h.CallTool(t, "file_edit", map[string]interface{}{
+		"path":        "notes.txt",
+		"operation":   "replace",
+		"search":      "draft",
+		"replacement": "final",
+	})
+	if response.IsError {
+		t.Fatalf("file_edit failed: %s", mcptest.Text(response))
+	}
+	if !strings.Contains(mcptest.Text(response), "+final") {
+		t.Errorf("response %q has no diff", mcptest.Text(response))
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "notes.txt"))
+	if err != nil || string(data) != "final\n" {
+		t.Errorf("content = %q, %v; want the session directory's file edited", data, err)
+	}
+}
+
+func TestFileEditRefusalReported(t *testing.T) {
+	h := newTestServer(t)
+	h.Initialize(t)
+
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("a a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	response := h.CallTool(t, "file_edit", map[string]interface{}{
+		"path":        path,
+		"operation":   "replace",
+		"search":      "a",
+		"replacement": "b",
+	})
+	if !response.IsError || !strings.Contains(mcptest.Text(response), "no changes made") {
+		t.Errorf("response = %q, want the match count refusal", mcptest.Text(response))
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/bash"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/mcp"
+)
+
+// rewriteJailPaths shows real paths under a path jail in their jailed form in
+// every text content item and the reported working directory. Progress notifications are sent as output arrives
+// and keep real paths. A nil jail leaves the response alone.
+func rewriteJailPaths(response *mcp.CallToolResponse, jail *bash.PathJail) {
+	if jail == nil {
+		return
+	}
+	for i := range response.Content {
+		response.Content[i].Text = jail.Rewrite(response.Content[i].Text)
+	}
+	if dir, ok := response.Meta["workingDirectory"].(string); ok {
+		response.Meta["workingDirectory"] = jail.Rewrite(dir)
+	}
+	if failure, ok := response.StructuredContent["failureContext"].(*bash.FailureContext); ok {
+		for i := range failure.StderrTail {
+			failure.StderrTail[i] = jail.Rewrite(failure.StderrTail[i])
+		}
+	}
+}
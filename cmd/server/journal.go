@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/config"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/journald"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/mcp"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/truncate"
+)
+
+// journal logs to the systemd journal when logTarget is journald and the
+// journal is reachable; otherwise it is nil and the log goes to stderr
+var journal *slog.Logger
+
+// maxLogLine is the longest stderr line forwarded to the journal; the rest
+// of a longer line is dropped
+const maxLogLine = 1024 * 1024
+
+// startJournal sends the server's log to journald if configured. The log is
+// written to stderr throughout the server, so stderr is replaced with a pipe
+// and each line becomes a journal entry, with a priority taken from how the
+// line starts. Anything that can't be sent goes to the original stderr.
+func startJournal(cfg *config.Config) {
+	if cfg.LogTarget != "journald" {
+		return
+	}
+	writer, err := journald.Dial(journald.DefaultSocket)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Logging to stderr: %v\n", err)
+		return
+	}
+	reader, pipe, err := os.Pipe()
+	if err != nil {
+		writer.Close()
+		fmt.Fprintf(os.Stderr, "Logging to stderr: failed to create log pipe: %v\n", err)
+		return
+	}
+
+	stderr := os.Stderr
+	journal = slog.New(journald.NewHandler(writer, programName, slog.LevelDebug, stderr))
+	os.Stderr = pipe
+	fmt.Fprintf(stderr, "Logging to journald\n")
+
+	// Reading never stops, so a write to stderr can never block
+	go func() {
+		lines := bufio.NewReader(reader)
+		for {
+			line, err := lines.ReadString('\n')
+			if line = strings.TrimSuffix(line, "\n"); line != "" {
+				line = truncate.Head(line, maxLogLine)
+				journal.Log(context.Background(), logLineLevel(line), line)
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+}
+
+// logLineLevel guesses a log line's level from how the server words it
+func logLineLevel(line string) slog.Level {
+	switch {
+	case strings.HasPrefix(line, "Error"), strings.HasPrefix(line, "Failed"), strings.HasPrefix(line, "Invalid"),
+		strings.HasPrefix(line, "panic"):
+		return slog.LevelError
+	case strings.HasPrefix(line, "Warning"):
+		return slog.LevelWarn
+	case strings.HasPrefix(line, "Received"), strings.HasPrefix(line, "Sending"),
+		strings.HasPrefix(line, "Response"), strings.HasPrefix(line, "Handler"):
+		return slog.LevelDebug
+	}
+	return slog.LevelInfo
+}
+
+// journalToolCall records a finished tool call in the journal with fields to
+// filter on: METHOD, TOOL, SESSION, REQUEST_ID, DURATION_MS and IS_ERROR
+func journalToolCall(ctx context.Context, request mcp.CallToolRequest, response mcp.CallToolResponse,
+	duration time.Duration, session int) {
+	if journal == nil {
+		return
+	}
+	level := slog.LevelInfo
+	if response.IsError {
+		level = slog.LevelWarn
+	}
+	attrs := []slog.Attr{
+		slog.String("method", "tools/call"),
+		slog.String("tool", request.Name),
+		slog.Int64("durationMs", duration.Milliseconds()),
+		slog.Bool("isError", response.IsError),
+	}
+	if session != 0 {
+		attrs = append(attrs, slog.Int("session", session))
+	}
+	if id, ok := mcp.RequestIDFromContext(ctx); ok {
+		attrs = append(attrs, slog.String("requestId", id.String()))
+	}
+	journal.LogAttrs(ctx, level, "Tool call "+request.Name, attrs...)
+}
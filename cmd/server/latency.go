@@ -0,0 +1,178 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/config"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/perms"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/secrets"
+)
+
+const (
+	// latencyWindow is how many recent command durations the percentile
+	// summaries are computed over
+	latencyWindow = 1024
+
+	// slowPreviewLength caps the command text kept in the slow log
+	slowPreviewLength = 80
+)
+
+// Backends a command can run on, as recorded in the slow log
+const (
+	backendSession = "session"
+	backendOneShot = "oneshot"
+	backendScript  = "script"
+	backendExec    = "exec"
+)
+
+// latencyTracker keeps a ring of recent command durations for server_stats
+// and writes commands slower than the threshold to the slow log.
+type latencyTracker struct {
+	mutex     sync.Mutex
+	durations []time.Duration // ring buffer, oldest overwritten first
+	next      int
+	total     int64
+	slow      int64
+
+	threshold time.Duration // 0 disables the slow log
+	slowLog   io.Writer
+	store     *secrets.Store
+	now       func() time.Time
+}
+
+// slowCommandEntry is one line of the slow log. CommandHash is stable across
+// hosts, so the same command aggregates fleet-wide without the full text.
+type slowCommandEntry struct {
+	Time        string `json:"time"`
+	CommandHash string `json:"commandHash"`
+	Preview     string `json:"preview"`
+	DurationMs  int64  `json:"durationMs"`
+	OutputBytes int    `json:"outputBytes"`
+	Session     int    `json:"session,omitempty"`
+	Backend     string `json:"backend"`
+}
+
+// latencySummary reports percentiles over the recent-duration window
+type latencySummary struct {
+	Window int     `json:"window"` // durations the percentiles are computed over
+	Total  int64   `json:"total"`  // commands recorded since start
+	Slow   int64   `json:"slow"`   // of those, over the slow threshold
+	P50Ms  float64 `json:"p50Ms"`
+	P95Ms  float64 `json:"p95Ms"`
+	P99Ms  float64 `json:"p99Ms"`
+	MaxMs  float64 `json:"maxMs"`
+}
+
+// newLatencyTracker creates the tracker and opens the slow log, if enabled
+func newLatencyTracker(cfg *config.Config, store *secrets.Store) (*latencyTracker, error) {
+	tracker := &latencyTracker{
+		threshold: cfg.GetSlowCommandThreshold(),
+		slowLog:   os.Stderr,
+		store:     store,
+		now:       time.Now,
+	}
+	if tracker.threshold > 0 && cfg.SlowCommandLog != "" {
+		file, err := perms.OpenFile(cfg.SlowCommandLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open slow command log: %w", err)
+		}
+		tracker.slowLog = file
+	}
+	return tracker, nil
+}
+
+// record notes one command's duration and logs it if it was slow
+func (lt *latencyTracker) record(command string, duration time.Duration, outputBytes int, session int, backend string) {
+	lt.mutex.Lock()
+	defer lt.mutex.Unlock()
+
+	if len(lt.durations) < latencyWindow {
+		lt.durations = append(lt.durations, duration)
+	} else {
+		lt.durations[lt.next] = duration
+		lt.next = (lt.next + 1) % latencyWindow
+	}
+	lt.total++
+
+	if lt.threshold == 0 || duration <= lt.threshold {
+		return
+	}
+	lt.slow++
+
+	line, err := json.Marshal(slowCommandEntry{
+		Time:        lt.now().UTC().Format(time.RFC3339),
+		CommandHash: commandHash(command),
+		Preview:     commandPreview(lt.store.Redact(command)),
+		DurationMs:  duration.Milliseconds(),
+		OutputBytes: outputBytes,
+		Session:     session,
+		Backend:     backend,
+	})
+	if err != nil {
+		return
+	}
+	if lt.slowLog == os.Stderr {
+		fmt.Fprintf(os.Stderr, "Slow command: %s\n", line)
+		return
+	}
+	if _, err := lt.slowLog.Write(append(line, '\n')); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write slow command log: %v\n", err)
+	}
+}
+
+// summary computes percentiles over the current window
+func (lt *latencyTracker) summary() latencySummary {
+	lt.mutex.Lock()
+	sorted := append([]time.Duration(nil), lt.durations...)
+	summary := latencySummary{Window: len(sorted), Total: lt.total, Slow: lt.slow}
+	lt.mutex.Unlock()
+
+	if len(sorted) == 0 {
+		return summary
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	summary.P50Ms = milliseconds(percentile(sorted, 50))
+	summary.P95Ms = milliseconds(percentile(sorted, 95))
+	summary.P99Ms = milliseconds(percentile(sorted, 99))
+	summary.MaxMs = milliseconds(sorted[len(sorted)-1])
+	return summary
+}
+
+// percentile returns the nearest-rank percentile p of sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// milliseconds converts a duration to fractional milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// commandHash identifies a command by content without revealing it
+func commandHash(command string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(command)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// commandPreview flattens a command onto one line and truncates it
+func commandPreview(command string) string {
+	preview := strings.Join(strings.Fields(command), " ")
+	if runes := []rune(preview); len(runes) > slowPreviewLength {
+		preview = string(runes[:slowPreviewLength]) + "..."
+	}
+	return preview
+}
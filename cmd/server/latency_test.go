@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/config"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/secrets"
+)
+
+func TestLatencySummaryPercentiles(t *testing.T) {
+	tracker, err := newLatencyTracker(&config.Config{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 100; i++ {
+		tracker.record("true", time.Duration(i)*time.Millisecond, 0, 1, backendSession)
+	}
+
+	summary := tracker.summary()
+	if summary.Window != 100 || summary.Total != 100 || summary.Slow != 0 {
+		t.Errorf("summary = %+v", summary)
+	}
+	if summary.P50Ms != 50 || summary.P95Ms != 95 || summary.P99Ms != 99 || summary.MaxMs != 100 {
+		t.Errorf("percentiles = %v/%v/%v max %v, want 50/95/99 max 100",
+			summary.P50Ms, summary.P95Ms, summary.P99Ms, summary.MaxMs)
+	}
+
+	// The window keeps only the most recent durations
+	for i := 0; i < latencyWindow; i++ {
+		tracker.record("true", time.Millisecond, 0, 1, backendSession)
+	}
+	if summary := tracker.summary(); summary.Window != latencyWindow || summary.MaxMs != 1 {
+		t.Errorf("after the window filled: %+v", summary)
+	}
+}
+
+func TestSlowCommandLog(t *testing.T) {
+	dir := t.TempDir()
+	secretsPath := filepath.Join(dir, "secrets.json")
+	if err := os.WriteFile(secretsPath, []byte(`{"api": "sk-0123456789"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	store, err := secrets.Load(secrets.Options{File: secretsPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logPath := filepath.Join(dir, "slow.log")
+	tracker, err := newLatencyTracker(&config.Config{SlowCommandThresholdMs: 100, SlowCommandLog: logPath}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker.now = func() time.Time { return time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	tracker.record("echo fast", 50*time.Millisecond, 10, 1, backendSession)
+	long := "curl -H 'Authorization: sk-0123456789'\n  " + strings.Repeat("x", 200)
+	tracker.record(long, 250*time.Millisecond, 42, 3, backendExec)
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("slow log has %d lines, want only the slow command", len(lines))
+	}
+	var entry slowCommandEntry
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Time != "2026-01-02T03:04:05Z" || entry.DurationMs != 250 || entry.OutputBytes != 42 ||
+		entry.Session != 3 || entry.Backend != backendExec || entry.CommandHash != commandHash(long) {
+		t.Errorf("entry = %+v", entry)
+	}
+	if strings.Contains(entry.Preview, "sk-0123456789") || !strings.Contains(entry.Preview, "[secret:api]") {
+		t.Errorf("preview %q not redacted", entry.Preview)
+	}
+	if strings.Contains(entry.Preview, "\n") || len([]rune(entry.Preview)) != slowPreviewLength+3 {
+		t.Errorf("preview %q not flattened and truncated", entry.Preview)
+	}
+	if summary := tracker.summary(); summary.Slow != 1 || summary.Total != 2 {
+		t.Errorf("summary = %+v, want 1 of 2 slow", summary)
+	}
+}
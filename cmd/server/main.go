@@ -1,16 +1,35 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/LaurieRhodes/mcp-bash-go/pkg/bash"
 	"github.com/LaurieRhodes/mcp-bash-go/pkg/config"
 	"github.com/LaurieRhodes/mcp-bash-go/pkg/env"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/events"
 	"github.com/LaurieRhodes/mcp-bash-go/pkg/mcp"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/perms"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/policy"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/replay"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/secrets"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/update"
+)
+
+// Build information, set at release time via -ldflags (see release.yml)
+var (
+	Version   = "dev"
+	BuildTime = "unknown"
+	GitCommit = "unknown"
 )
 
 func init() {
@@ -21,19 +40,200 @@ func init() {
 }
 
 func main() {
+	if code, handled := runSubcommand(os.Args[1:]); handled {
+		os.Exit(code)
+	}
+
+	opts, err := parseFlags(os.Args[1:])
+	if err != nil {
+		os.Exit(handleFlagError(err))
+	}
+	if opts.version {
+		fmt.Printf("%s %s (commit %s, built %s)\n", programName, Version, GitCommit, BuildTime)
+		return
+	}
+	if opts.migrateConfig {
+		os.Exit(runMigrateConfig())
+	}
+	if opts.verifyAudit != "" {
+		os.Exit(runVerifyAudit(opts.verifyAudit))
+	}
+
 	// Set up signal handling for graceful shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
 	// Load configuration
-	cfg, err := config.LoadConfig()
+	cfg, err := config.LoadConfig(config.LoadOptions{AllowInsecure: opts.allowInsecure})
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error loading configuration: %v\n", err)
 		os.Exit(1)
 	}
+	if opts.verifyWatermark != "" {
+		os.Exit(runVerifyWatermark(opts.verifyWatermark, cfg))
+	}
+
+	// Files the server creates for itself are private unless configured
+	perms.SetGroupReadable(cfg.GroupReadableFiles)
+
+	// The server's log goes to the systemd journal, if configured
+	startJournal(cfg)
+
+	// Without the shell, optionally serve only tools that don't need one.
+	// A shell named in the config must exist unless execFallback is set.
+	if _, err := bash.FindShell(cfg.Shell); err != nil {
+		if cfg.ExecFallback {
+			bash.RemoveShellTools()
+			fmt.Fprintf(os.Stderr, "%v: serving the exec tool in place of the shell tools\n", err)
+		} else if cfg.Shell != bash.DefaultShell {
+			fmt.Fprintf(os.Stderr, "Invalid shell configuration: %v\n", err)
+			os.Exit(1)
+		} else {
+			fmt.Fprintf(os.Stderr, "Warning: %v; shell tools will fail (set execFallback to use exec instead)\n", err)
+		}
+	}
+
+	// Curated commands from the config join the built-in tools
+	if err := registerCustomTools(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid custom tool configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Every tool must be fully declared before anything is advertised
+	if err := bash.ValidateTools(); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid tool registry: %v\n", err)
+		os.Exit(1)
+	}
+
+	// External policy engine, if configured
+	policyHook, err := newPolicyHook(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid policy hook configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Secrets are loaded before any session starts so sessions never
+	// inherit them from the environment
+	secretStore, err := newSecretStore(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load secrets: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Command latency statistics and the slow-command log
+	latency, err := newLatencyTracker(cfg, secretStore)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	// Audit log of every tool call, if configured
+	audit, err := newAuditLog(cfg, secretStore)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	defer audit.Close()
+
+	// Activity shared with other servers on the host
+	activity := newActivityBoard(cfg, secretStore)
+	defer activity.Close()
+
+	// Record or replay mode, if requested on the command line
+	recorder, player, err := openReplay(opts.replay)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	defer recorder.Close()
+	if recorder != nil {
+		fmt.Fprintf(os.Stderr, "Recording tool calls to %s\n", opts.replay.record)
+	}
+	if player != nil {
+		fmt.Fprintf(os.Stderr, "Replaying %d recorded tool calls from %s; no commands will run\n",
+			player.Len(), opts.replay.replay)
+	}
+
+	// Path translation for project sandboxes, if configured
+	var jail *bash.PathJail
+	if cfg.PathJail != "" {
+		if jail, err = bash.NewPathJail(cfg.PathJail); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid path jail configuration: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Path jail: %s is presented as /\n", jail.Root())
+	}
+
+	// Directories tools are confined to, if configured
+	var roots *bash.AllowedRoots
+	if len(cfg.AllowedRoots) > 0 {
+		if roots, err = bash.NewAllowedRoots(cfg.AllowedRoots); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid allowedRoots configuration: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Allowed roots: %v\n", roots.Roots())
+	}
+
+	// The user sessions run as, if not the server's own
+	var runAs *bash.RunAs
+	if cfg.RunAsUser != "" {
+		if runAs, err = bash.ResolveRunAs(cfg.RunAsUser, cfg.RunAsGroup); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid runAsUser configuration: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Sessions run as %s (uid %d, gid %d)\n", runAs.Username, runAs.UID, runAs.GID)
+	}
 
 	// Create the bash manager
-	bashManager := bash.NewBashManager(cfg.GetTimeout())
+	bashManager := bash.NewBashManager(bash.Options{
+		Timeout:     cfg.GetTimeout(),
+		TimeoutMode: cfg.TimeoutMode,
+		MaxTotal:    cfg.GetMaxTotal(),
+
+		BypassTimeout: cfg.GetBypassTimeout(),
+		MaxTimeout:    cfg.GetMaxTimeout(),
+
+		MaxOutputBytes: cfg.MaxOutputBytes,
+		MaxLineBytes:   cfg.MaxLineBytes,
+		TruncationMode: cfg.TruncationMode,
+
+		StoredOutputBytes: cfg.StoredOutputBytes,
+		StoredOutputTTL:   cfg.GetStoredOutputTTL(),
+
+		OutputResources:     cfg.OutputResources,
+		OutputResourceBytes: cfg.OutputResourceMaxBytes,
+
+		NoColor: cfg.StripANSI,
+		PTYRows: cfg.PTYRows,
+		PTYCols: cfg.PTYCols,
+
+		Shell:     cfg.Shell,
+		ShellArgs: cfg.ShellArgs,
+		Jail:      jail,
+		Roots:     roots,
+
+		LoginShell: cfg.LoginShell,
+		RCFile:     cfg.RCFile,
+
+		StartupCommands:        cfg.StartupCommands,
+		StartupCommandsLenient: cfg.StartupCommandsLenient,
+
+		SessionIdleTimeout: cfg.GetSessionIdleTimeout(),
+		HistorySize:        cfg.HistorySize,
+		PathWarnLength:     cfg.PathWarnLength,
+		DedupPath:          cfg.DedupPath,
+		KillOrphans:        cfg.KillOrphansOnClose,
+		MaxQueued:          cfg.MaxQueuedCommands,
+		MaxJobs:            cfg.MaxBackgroundJobs,
+		JobStateFile:       cfg.JobStateFile,
+		WriteQuota:         newWriteQuota(cfg),
+		Nested:             nestedOptions(cfg),
+		Limits:             resourceLimits(cfg),
+		RunAs:              runAs,
+		Sandbox:            sandboxOptions(cfg),
+
+		Events: events.NewBus(cfg.EventBufferSize),
+	})
 	defer bashManager.Close()
 
 	// Set up graceful shutdown
@@ -41,6 +241,8 @@ func main() {
 		<-sigChan
 		fmt.Fprintln(os.Stderr, "Shutting down...")
 		bashManager.Close()
+		audit.Close()
+		activity.Close()
 		os.Exit(0)
 	}()
 
@@ -48,7 +250,7 @@ func main() {
 	server := mcp.NewServer(
 		mcp.ServerInfo{
 			Name:    "bash-mcp-server",
-			Version: "1.0.0",
+			Version: Version,
 		},
 		mcp.ServerConfig{
 			Capabilities: mcp.ServerCapabilities{
@@ -57,11 +259,28 @@ func main() {
 					"call": true,
 				},
 			},
+			RequireInitializedNotification: cfg.RequireInitializedNotification,
 		},
 	)
 
 	// Set up handlers
-	setupServerHandlers(server, bashManager)
+	setupServerHandlers(server, bashManager, cfg, policyHook, secretStore, latency, audit, activity, recorder, player)
+
+	// Advertise deployment features, derived from what was just registered
+	featureMap := buildFeatureMap(server, bashManager, cfg)
+	server.SetExperimentalCapability(featureMapCapability, featureMap)
+	if _, pending := featureMap["pendingProbes"]; pending {
+		go refreshFeatureMap(server, bashManager, cfg)
+	}
+
+	// SIGHUP reloads the custom tools; nothing else changes until restart
+	reloadChan := make(chan os.Signal, 1)
+	signal.Notify(reloadChan, syscall.SIGHUP)
+	go func() {
+		for range reloadChan {
+			reloadCustomTools(server, bashManager, cfg, config.LoadOptions{AllowInsecure: opts.allowInsecure})
+		}
+	}()
 
 	// Choose transport based on configuration
 	var transport mcp.Transport
@@ -80,6 +299,7 @@ func main() {
 			fmt.Fprintf(os.Stderr, "Error creating network config: %v\n", err)
 			os.Exit(1)
 		}
+		netConfig.Compression = cfg.Network.Compression
 		
 		transport, err = mcp.NewNetworkTransport(netConfig)
 		if err != nil {
@@ -89,12 +309,31 @@ func main() {
 	} else {
 		// Stdio mode (default)
 		fmt.Fprintf(os.Stderr, "Starting in STDIO mode\n")
-		transport = mcp.NewStdioTransport()
+		stdioTransport := mcp.NewStdioTransport()
+		if cfg.OrderedResponses {
+			fmt.Fprintf(os.Stderr, "Ordered responses enabled (max wait %v)\n", cfg.GetOrderedResponseMaxWait())
+			stdioTransport.EnableOrderedResponses(cfg.GetOrderedResponseMaxWait())
+		}
+		transport = stdioTransport
 	}
 
 	// Start the server with the chosen transport
-	fmt.Fprintf(os.Stderr, "Bash MCP Server v1.0.0 starting\n")
+	fmt.Fprintf(os.Stderr, "Bash MCP Server %s starting\n", Version)
 	fmt.Fprintf(os.Stderr, "Command timeout: %v\n", cfg.GetTimeout())
+	if hint := cfg.GetClientRequestTimeout(); hint > 0 && bashManager.MaxCommandDuration() > hint {
+		fmt.Fprintf(os.Stderr, "Warning: command timeout %v exceeds client request timeout hint %v\n", bashManager.MaxCommandDuration(), hint)
+	}
+
+	// Opt-in check for newer releases; reports only, never installs
+	if cfg.IsUpdateCheckEnabled() {
+		checker, err := update.NewChecker(cfg.UpdateCheck.URL,
+			time.Duration(cfg.UpdateCheck.IntervalHours)*time.Hour, Version)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Update check disabled: %v\n", err)
+		} else {
+			checker.Start(make(chan struct{}))
+		}
+	}
 
 	err = server.Connect(transport)
 	if err != nil {
@@ -107,23 +346,39 @@ func main() {
 }
 
 // setupServerHandlers sets up the request handlers for the server
-func setupServerHandlers(server *mcp.Server, bashManager *bash.BashManager) {
+func setupServerHandlers(server *mcp.Server, bashManager *bash.BashManager, cfg *config.Config, hook *policy.Hook,
+	store *secrets.Store, latency *latencyTracker, audit *auditLog, activity *activityBoard, recorder *replay.Recorder,
+	player *replay.Player) {
+	budget := newOutputBudget(cfg.OutputBudgetBytes)
+	watermark := newWatermarker(cfg)
+	disk := newDiskMonitor(cfg)
+	admission := newAdmission(cfg)
+	confirm := newConfirmations(cfg)
+
 	// Handler for tools/list
 	server.SetRequestHandler("tools/list", func(params json.RawMessage) (json.RawMessage, error) {
-		tools := make([]mcp.Tool, 0, len(bash.BashTools))
+		tools := make([]mcp.Tool, 0, bash.BashTools.Len())
 
-		for _, toolDef := range bash.BashTools {
+		// Registration order, so the listing is byte-identical across runs
+		bash.BashTools.Each(func(name string, toolDef bash.BashTool) {
 			inputSchema, err := json.Marshal(toolDef.InputSchema)
 			if err != nil {
-				continue
+				return
+			}
+
+			description := toolDef.Description
+			if toolDef.Name == "bash" {
+				description = bash.BashToolDescription(bashManager.MaxCommandDuration(), bashManager.MaxTimeout())
 			}
 
 			tools = append(tools, mcp.Tool{
 				Name:        toolDef.Name,
-				Description: toolDef.Description,
+				Description: description,
 				InputSchema: inputSchema,
+				Annotations: toolDef.Annotations,
+				Meta:        map[string]interface{}{toolIDMetaKey: mcp.StableID(name)},
 			})
-		}
+		})
 
 		response := mcp.ListToolsResponse{
 			Tools: tools,
@@ -139,81 +394,1402 @@ func setupServerHandlers(server *mcp.Server, bashManager *bash.BashManager) {
 	})
 
 	// Handler for tools/call
-	server.SetRequestHandler("tools/call", func(params json.RawMessage) (json.RawMessage, error) {
+	// Cancellable, so notifications/cancelled can stop the request's command
+	server.SetContextRequestHandler("tools/call", func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
 		var request mcp.CallToolRequest
 		if err := json.Unmarshal(params, &request); err != nil {
 			return nil, fmt.Errorf("invalid call parameters: %w", err)
 		}
 
+		// In replay mode the recording answers; nothing runs, and the
+		// recorded response was already redacted and budgeted
+		if player != nil {
+			response, err := player.Play(request.Name, request.Arguments)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				response = createErrorResponse(err.Error())
+			}
+			return json.Marshal(response)
+		}
+
 		// Process the tool call with server instance for progress notifications
-		return handleToolCall(request, params, bashManager, server)
+		started := time.Now()
+		response := handleToolCall(ctx, request, params, bashManager, server, cfg, budget, disk, admission, confirm,
+			hook, store, latency, activity)
+
+		// Paths under a path jail are shown in their jailed form
+		rewriteJailPaths(&response, bashManager.Jail())
+
+		// No secret value leaves the server, whichever tool produced it
+		redactResponse(&response, store)
+
+		// Charge inline content against the session output budget. The
+		// budget tool itself is exempt so it stays usable once exhausted.
+		cut := false
+		if request.Name != "session_budget" {
+			cut = budget.apply(&response)
+		}
+
+		// Last of all the text is marked with the call it came from, so
+		// nothing above can split the markers
+		mark, err := watermark.apply(&response, cut)
+		if err != nil {
+			response = createErrorResponse(fmt.Sprintf("failed to watermark output: %v", err))
+		}
+
+		// Every call is audited, with the output hashed as it was returned
+		audit.record(request, response, time.Since(started), bashManager.SessionID(), server.ClientInfo(), mark)
+		journalToolCall(ctx, request, response, time.Since(started), bashManager.SessionID())
+
+		// Recorded as the client saw it
+		if err := recorder.Record(request.Name, request.Arguments, response); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to record tool call: %v\n", err)
+		}
+
+		return json.Marshal(response)
 	})
 
 	// Handler for call_tool (backward compatibility)
-	server.SetRequestHandler("call_tool", func(params json.RawMessage) (json.RawMessage, error) {
-		handler := server.GetHandler("tools/call")
-		return handler(params)
+	server.SetContextRequestHandler("call_tool", func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+		handler := server.GetContextHandler("tools/call")
+		return handler(ctx, params)
 	})
 
-	// Notification handler for cancellation — kills the running command immediately
-	// so the session unblocks and queued requests can proceed.
+	// Notification handler for cancellation. The server cancels the named
+	// request's context, which interrupts its command (or drops it from the
+	// queue); without a request id, whatever is running is cancelled.
 	server.SetNotificationHandler("notifications/cancelled", func(params json.RawMessage) {
 		var cancelParams struct {
 			RequestId interface{} `json:"requestId"`
 			Reason    string      `json:"reason"`
 		}
-		if err := json.Unmarshal(params, &cancelParams); err == nil {
+		if err := json.Unmarshal(params, &cancelParams); err == nil && cancelParams.RequestId != nil {
 			fmt.Fprintf(os.Stderr, "Cancellation received for request %v: %s\n", cancelParams.RequestId, cancelParams.Reason)
-		} else {
-			fmt.Fprintf(os.Stderr, "Cancellation received (could not parse params)\n")
+			return
 		}
+		fmt.Fprintf(os.Stderr, "Cancellation received without a request id; cancelling the running command\n")
 		bashManager.CancelRunning()
 	})
+
+	// Output stored on disk, and collected artifacts, are served as the
+	// resources results link to
+	server.SetResourceProvider(serverResources{bashManager: bashManager, store: store})
+
+	// Custom tools can be reloaded on SIGHUP, changing the tool list
+	if bash.BashTools.Has("bash") {
+		server.AdvertiseToolsListChanged()
+	}
 }
 
 // handleToolCall handles a tool call request
-func handleToolCall(request mcp.CallToolRequest, rawParams json.RawMessage, bashManager *bash.BashManager, server *mcp.Server) (json.RawMessage, error) {
+func handleToolCall(ctx context.Context, request mcp.CallToolRequest, rawParams json.RawMessage, bashManager *bash.BashManager, server *mcp.Server, cfg *config.Config, budget *outputBudget, disk *bash.DiskMonitor, admission *bash.Admission, confirm *confirmations, hook *policy.Hook, store *secrets.Store, latency *latencyTracker, activity *activityBoard) mcp.CallToolResponse {
 	var response mcp.CallToolResponse
 
+	// Tools removed at startup (execFallback) are unknown
+	if !bash.BashTools.Has(request.Name) {
+		return createErrorResponse(fmt.Sprintf("Unknown tool: %s", request.Name))
+	}
+	if tool, ok := findCustomTool(request.Name); ok {
+		return runCustomTool(ctx, tool, request, bashManager, server, cfg, disk, admission, hook, store, latency, activity)
+	}
+
 	switch request.Name {
 	case "bash":
 		// Parse bash-specific arguments
-		command, restart, err := bash.ParseBashArgs(request.Arguments)
+		args, err := bash.ParseBashArgs(request.Arguments)
 		if err != nil {
 			return createErrorResponse(err.Error())
 		}
+		// A syntax check runs nothing, so nothing else applies
+		if args.ValidateOnly {
+			result, err := bashManager.CheckSyntax(args.Command)
+			if err != nil {
+				return createErrorResponse(err.Error())
+			}
+			return syntaxResponse(result)
+		}
+		if args.WorkingDirectory, _, err = bashManager.WindowsPaths().ToLinux(args.WorkingDirectory); err != nil {
+			return createErrorResponse(fmt.Sprintf("working_directory: %v", err))
+		}
+		// Consult the policy engine before anything runs, restart included
+		decision := checkPolicy(hook, cfg, server, bashManager, "bash", args.Command,
+			args.WorkingDirectory, request.Meta, args.BypassSession)
+		if !decision.Allow {
+			return createErrorResponse(fmt.Sprintf("Command denied by policy: %s", decision.Reason))
+		}
+		rewrite := rewriteFromDecision(decision, args.Command)
+		if rewrite != nil {
+			args.Command = rewrite.Command
+		}
+		command := args.Command
+		if err := bashManager.AllowedRoots().CheckCommand(command); err != nil {
+			return createErrorResponse(fmt.Sprintf("Command not run: %v", err))
+		}
 
-		// Restart session if requested
-		if restart {
+		// Restart first so a relative working_directory resolves against the
+		// fresh session
+		if args.Restart {
 			if err := bashManager.RestartSession(); err != nil {
 				return createErrorResponse(fmt.Sprintf("Failed to restart session: %v", err))
 			}
 			fmt.Fprintf(os.Stderr, "Bash session restarted\n")
 		}
 
-		// Execute the command (simple, no progress notifications)
-		fmt.Fprintf(os.Stderr, "Executing command: %s\n", command)
-		output, err := bashManager.ExecuteCommand(command)
+		// Profiling rewrites the command itself, so it goes inside every
+		// other wrapper. A pipeline it can't take apart still runs.
+		var profile *bash.PipelineProfile
+		var profileWarning string
+		if args.ProfilePipeline {
+			var profiled string
+			profiled, profile, err = bashManager.WithPipelineProfile(command)
+			if err != nil {
+				profileWarning = fmt.Sprintf("Warning: pipeline not profiled (%v); the command ran normally", err)
+			} else {
+				command = profiled
+				defer profile.Close()
+			}
+		}
+
+		// Write-heavy commands run under the write quota, in a directory of
+		// their own where that is supported. Only session commands can be
+		// stopped by it.
+		var quota *bash.QuotaWatch
+		if !args.BypassSession && !args.Background {
+			command, quota, err = bashManager.WithWriteQuota(command)
+			if err != nil {
+				return createErrorResponse(err.Error())
+			}
+			defer quota.Finish()
+		}
+
+		// Run in the requested directory without moving the session
+		if args.WorkingDirectory != "" {
+			command, err = bashManager.InDirectory(command, args.WorkingDirectory)
+			if err != nil {
+				return createErrorResponse(err.Error())
+			}
+		}
+
+		// strip_ansi overrides the configured default. Sessions only get
+		// the no-color variables when it is configured, so a call opting
+		// in sets them for itself.
+		stripANSI := cfg.StripANSI
+		if args.StripANSI != nil {
+			stripANSI = *args.StripANSI
+		}
+		if stripANSI && !cfg.StripANSI {
+			args.Env = bash.WithNoColor(args.Env)
+		}
+
+		// Per-call environment, scoped to a subshell. Secrets join it here
+		// and nowhere else, so their values are never logged.
+		env, err := withSecrets(args.Env, args.UseSecret, store)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		command = bash.WithEnv(command, env)
+
+		// No placeholder for empty output when asked, or when stdout is
+		// returned as binary content instead of text
+		quiet := args.Quiet || args.Encoding == bash.EncodingBase64
+
+		// Standard input comes from a temp file kept until the command ends
+		if args.Stdin != nil {
+			var cleanup func()
+			command, cleanup, err = bashManager.WithStdin(command, *args.Stdin)
+			if err != nil {
+				return createErrorResponse(err.Error())
+			}
+			defer cleanup()
+		}
+
+		// Network isolation wraps everything but the stdout capture
+		if args.NoNetwork {
+			command, err = bashManager.WithoutNetwork(command)
+			if err != nil {
+				return createErrorResponse(err.Error())
+			}
+		}
+
+		// Binary-safe stdout goes to a temp file, read back byte for byte
+		var binaryStdout *bash.BinaryCapture
+		if args.Encoding == bash.EncodingBase64 {
+			command, binaryStdout, err = bashManager.WithBinaryStdout(command)
+			if err != nil {
+				return createErrorResponse(err.Error())
+			}
+			defer binaryStdout.Close()
+		}
+
+		// A pseudo-terminal takes over stdin, stdout and stderr; an
+		// explicit stdin still wins, being redirected inside it
+		var terminal *bash.PTYCapture
+		if args.PTY {
+			command, terminal, err = bashManager.WithPTY(command)
+			if err != nil {
+				return createErrorResponse(err.Error())
+			}
+			defer terminal.Close()
+		}
+
+		// Heavy commands wait for room in the admission budget, wherever
+		// they run. Units are held until the call returns, so a command
+		// that is killed or whose session dies gives them back too.
+		release, refused := admit(ctx, admission, args.Command, args.Weight, store)
+		if refused != nil {
+			return *refused
+		}
+
+		// Per-call timeout override, bounded by the configured cap, and a
+		// warning when the command could outlive the client's patience
+		timeout, clamped := bashManager.ClampTimeout(time.Duration(args.Timeout) * time.Second)
+		timeoutInfo := bashManager.DescribeTimeout(time.Duration(args.Timeout) * time.Second)
+		timeoutWarning := clientTimeoutWarning(bashManager.CommandDuration(timeout), server, cfg)
+
+		// With autoDetachLongCommands, such a command runs as a background
+		// job instead, unless its stdin, terminal or binary stdout are tied
+		// to this call
+		detach := cfg.AutoDetachLongCommands && timeoutWarning != "" && !args.Background && !args.BypassSession &&
+			args.Stdin == nil && terminal == nil && binaryStdout == nil && len(args.CollectArtifacts) == 0
+
+		// A background job keeps its units until it exits, not just until
+		// this call returns
+		if args.Background || detach {
+			fmt.Fprintf(os.Stderr, "Starting background job: %s\n", args.Command)
+			job, err := bashManager.StartJob(command, store.Redact(args.Command), release)
+			if err != nil {
+				release()
+				return createErrorResponse(fmt.Sprintf("Command not run: %v", err))
+			}
+			text := fmt.Sprintf("Started background job %d (PID %d). Check on it with "+
+				"bash_job_status, read its output with bash_job_output.", job.ID, job.PID)
+			content := jobContent(job)
+			if detach {
+				text = fmt.Sprintf("This command may run for up to %v, longer than the client is likely to wait (%v), "+
+					"so it was started as a background job instead of in the session (autoDetachLongCommands). "+
+					"It runs in a shell of its own, so session variables and functions aren't visible to it. ",
+					bashManager.CommandDuration(timeout), clientRequestTimeout(server, cfg)) + text
+				content["autoDetached"] = true
+			}
+			response = mcp.CallToolResponse{
+				Content:           []mcp.ContentItem{{Type: "text", Text: text}},
+				StructuredContent: content,
+			}
+			annotateRewrite(&response, rewrite)
+			return response
+		}
+		defer release()
+
+		// Escape hatch: run outside the session without waiting for it
+		if args.BypassSession {
+			fmt.Fprintf(os.Stderr, "Executing bypass command: %s\n", args.Command)
+			started := time.Now()
+			result, err := bashManager.ExecuteOneShot(command)
+			if terminal != nil && err == nil {
+				result = terminal.Finish(result)
+			}
+			latency.record(args.Command, time.Since(started), len(result.Output), 0, backendOneShot)
+			bashManager.RecordHistory("bash", args.Command, false, time.Since(started), result, err)
+			if err != nil {
+				return createErrorResponse(fmt.Sprintf("Bypass command failed: %v", err))
+			}
+			result.Failure = bashManager.AnalyzeResult(args.Command, result)
+			note := fmt.Sprintf("[bypassSession: ran in a one-shot bash process outside the persistent session "+
+				"(timeout %v); session state was not used or changed]", bashManager.BypassTimeout())
+			response = createCommandResponse(cleanOutput(result, stripANSI), cfg, quiet)
+			attachBinaryStdout(&response, binaryStdout, store)
+			attachPipelineTiming(&response, profile, store)
+			prependWarning(&response, profileWarning)
+			prependWarning(&response, note)
+			annotateRewrite(&response, rewrite)
+			return response
+		}
+
+		// Shell commands aren't classified as reads or writes, so low disk
+		// space only produces a warning here, never a refusal
+		diskWarning, _ := checkDisk(disk, false, bashManager.WorkingDirectory())
+
+		// Execute the command, streaming output if the client asked for progress
+		fmt.Fprintf(os.Stderr, "Executing command: %s\n", args.Command) // env values are not logged
+		started := time.Now()
+		activity.begin(args.Command)
+		progress := newProgressReporter(server, cfg, request.Meta, store)
+		// Warn up front when the command could outlive the client's patience,
+		// in progress while it runs and in the result
+		progress.warn(timeoutWarning)
+		result, err := bashManager.ExecuteCommandContext(quota.Context(ctx), command, timeout,
+			progress.output(), progress.queued())
+		activity.end()
+		if terminal != nil && (err == nil || errors.Is(err, bash.ErrCommandTimedOut)) {
+			result = terminal.Finish(result)
+		}
+		latency.record(args.Command, time.Since(started), len(result.Output), bashManager.SessionID(), backendSession)
+		if !errors.Is(err, bash.ErrSessionBusy) {
+			bashManager.RecordHistory("bash", args.Command, true, time.Since(started), result, err)
+		}
 
+		if errors.Is(err, bash.ErrCommandCancelled) {
+			return createErrorResponse("Command cancelled by the client")
+		}
+		if errors.Is(err, bash.ErrSessionBusy) {
+			return createErrorResponse(fmt.Sprintf("Command not run: %v. Try again once they have finished.", err))
+		}
+		if errors.Is(err, bash.ErrCommandTimedOut) || errors.Is(err, bash.ErrWriteQuotaExceeded) {
+			// Still worth returning what the command printed before it was killed
+			response = createCommandResponse(cleanOutput(result, stripANSI), cfg, quiet)
+			attachBinaryStdout(&response, binaryStdout, store)
+			attachPipelineTiming(&response, profile, store)
+			annotateWriteQuota(&response, quota.Finish())
+			prependWarning(&response, profileWarning)
+			response.IsError = true
+			prependWarning(&response, fmt.Sprintf("Command killed: %v. Output captured before then follows.", err))
+			prependWarning(&response, timeoutWarning)
+			annotateTimeout(&response, timeoutInfo, result)
+			annotateRewrite(&response, rewrite)
+			return response
+		}
 		if err != nil {
 			return createErrorResponse(fmt.Sprintf("Command execution failed: %v", err))
 		}
+		result.Failure = bashManager.AnalyzeResult(args.Command, result)
+
+		response = createCommandResponse(cleanOutput(result, stripANSI), cfg, quiet)
+		attachBinaryStdout(&response, binaryStdout, store)
+		attachPipelineTiming(&response, profile, store)
+		annotateWriteQuota(&response, quota.Finish())
+		annotateTimeout(&response, timeoutInfo, result)
+		attachArtifacts(&response, args.CollectArtifacts, args.WorkingDirectory, bashManager, hook, cfg, server,
+			request.Meta)
+		prependWarning(&response, profileWarning)
+
+		prependWarning(&response, timeoutWarning)
+		if clamped {
+			prependWarning(&response, fmt.Sprintf("Note: requested timeout of %ds exceeds the maximum; %v was used",
+				args.Timeout, timeout))
+		}
+		prependWarning(&response, diskWarning)
+		prependWarning(&response, activity.loadWarningText())
+		annotateRewrite(&response, rewrite)
+
+	case "exec":
+		args, err := bash.ParseExecArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		if args.Cwd, _, err = bashManager.WindowsPaths().ToLinux(args.Cwd); err != nil {
+			return createErrorResponse(fmt.Sprintf("cwd: %v", err))
+		}
+		command := args.String()
+
+		// argv can't be reinterpreted by a shell, so the policy engine only
+		// allows or denies; rewrites aren't applied
+		decision := checkPolicy(hook, cfg, server, bashManager, "exec", command, args.Cwd, request.Meta, false)
+		if !decision.Allow {
+			return createErrorResponse(fmt.Sprintf("Command denied by policy: %s", decision.Reason))
+		}
+		if rewriteFromDecision(decision, command) != nil {
+			return createErrorResponse("Command denied by policy: rewriting exec commands is not supported")
+		}
+		for _, arg := range args.Argv[1:] {
+			if err := bashManager.AllowedRoots().CheckCommand(arg); err != nil {
+				return createErrorResponse(fmt.Sprintf("Command not run: %v", err))
+			}
+		}
+
+		release, refused := admit(ctx, admission, command, args.Weight, store)
+		if refused != nil {
+			return *refused
+		}
+		defer release()
+
+		fmt.Fprintf(os.Stderr, "Executing program: %s\n", command)
+		started := time.Now()
+		result, err := bashManager.Exec(ctx, args)
+		latency.record(command, time.Since(started), len(result.Output), 0, backendExec)
+		bashManager.RecordHistory("exec", command, false, time.Since(started), result, err)
+
+		if errors.Is(err, bash.ErrCommandCancelled) {
+			return createErrorResponse("Command cancelled by the client")
+		}
+		if errors.Is(err, bash.ErrCommandTimedOut) {
+			response = createCommandResponse(cleanOutput(result, cfg.StripANSI), cfg, false)
+			response.IsError = true
+			prependWarning(&response, fmt.Sprintf("Command killed: %v. Output captured before then follows.", err))
+			return response
+		}
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		result.Failure = bashManager.AnalyzeResult(command, result)
+		response = createCommandResponse(cleanOutput(result, cfg.StripANSI), cfg, false)
+
+	case "bash_script_buffer":
+		action, name, content, err := bash.ParseScriptBufferArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		var text string
+		switch action {
+		case "append":
+			total, err := bashManager.AppendScript(name, content)
+			if err != nil {
+				return createErrorResponse(err.Error())
+			}
+			text = fmt.Sprintf("Appended %d bytes to script buffer '%s' (total %d bytes)", len(content), name, total)
+		case "run":
+			// Running writes the script to the temp dir first
+			diskWarning, err := checkDisk(disk, true, bashManager.WorkingDirectory())
+			if err != nil {
+				return createErrorResponse(err.Error())
+			}
+			// Scripts go through the policy engine too; a rewrite can't be
+			// applied to a buffered script, so it counts as a denial
+			var script string
+			var started time.Time
+			result, err := bashManager.RunScriptIf(name, func(buffered string) error {
+				script = buffered
+				decision := checkPolicy(hook, cfg, server, bashManager, "bash_script_buffer", script,
+					"", request.Meta, false)
+				if !decision.Allow {
+					return fmt.Errorf("denied by policy: %s", decision.Reason)
+				}
+				if rewriteFromDecision(decision, script) != nil {
+					return fmt.Errorf("denied by policy: rewriting buffered scripts is not supported")
+				}
+				if err := bashManager.AllowedRoots().CheckCommand(script); err != nil {
+					return err
+				}
+				started = time.Now()
+				return nil
+			})
+			if !started.IsZero() {
+				latency.record(script, time.Since(started), len(result.Output), bashManager.SessionID(), backendScript)
+				if !errors.Is(err, bash.ErrSessionBusy) {
+					bashManager.RecordHistory("bash_script_buffer", script, true, time.Since(started), result, err)
+				}
+			}
+			if err != nil {
+				return createErrorResponse(fmt.Sprintf("Script execution failed: %v", err))
+			}
+			response = createCommandResponse(cleanOutput(result, cfg.StripANSI), cfg, false)
+			prependWarning(&response, diskWarning)
+			return response
+		case "abort":
+			discarded := bashManager.AbortScript(name)
+			text = fmt.Sprintf("Discarded script buffer '%s' (%d bytes)", name, discarded)
+		case "list":
+			sizes := bashManager.ScriptBufferSizes()
+			names := make([]string, 0, len(sizes))
+			for buffer := range sizes {
+				names = append(names, buffer)
+			}
+			sort.Strings(names)
+			lines := []string{fmt.Sprintf("%d pending script buffer(s)", len(names))}
+			for _, buffer := range names {
+				lines = append(lines, fmt.Sprintf("%s: %d bytes", buffer, sizes[buffer]))
+			}
+			return mcp.CallToolResponse{
+				Content:           []mcp.ContentItem{{Type: "text", Text: strings.Join(lines, "\n")}},
+				StructuredContent: map[string]interface{}{"buffers": sizes},
+			}
+		}
 
 		response = mcp.CallToolResponse{
 			Content: []mcp.ContentItem{
-				{Type: "text", Text: output},
+				{Type: "text", Text: text},
 			},
 		}
 
-	default:
-		return createErrorResponse(fmt.Sprintf("Unknown tool: %s", request.Name))
-	}
+	case "bash_script":
+		args, err := bash.ParseScriptArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		if args.ValidateOnly {
+			result, err := bashManager.CheckScriptSyntax(args)
+			if err != nil {
+				return createErrorResponse(err.Error())
+			}
+			return syntaxResponse(result)
+		}
+		// The script is written to the temp dir first
+		diskWarning, err := checkDisk(disk, true, bashManager.WorkingDirectory())
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		// A rewrite can't be applied to a script, so it counts as a denial
+		decision := checkPolicy(hook, cfg, server, bashManager, "bash_script", args.Script, "", request.Meta, false)
+		if !decision.Allow {
+			return createErrorResponse(fmt.Sprintf("Script denied by policy: %s", decision.Reason))
+		}
+		if rewriteFromDecision(decision, args.Script) != nil {
+			return createErrorResponse("Script denied by policy: rewriting scripts is not supported")
+		}
+		if err := bashManager.AllowedRoots().CheckCommand(args.Script); err != nil {
+			return createErrorResponse(fmt.Sprintf("Script not run: %v", err))
+		}
+
+		release, refused := admit(ctx, admission, args.Script, nil, store)
+		if refused != nil {
+			return *refused
+		}
+		defer release()
+
+		command, cleanup, err := bashManager.WithScript(args)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		defer cleanup()
+
+		started := time.Now()
+		activity.begin(args.Script)
+		progress := newProgressReporter(server, cfg, request.Meta, store)
+		result, err := bashManager.ExecuteCommandContext(ctx, command, 0, progress.output(), progress.queued())
+		activity.end()
+		latency.record(args.Script, time.Since(started), len(result.Output), bashManager.SessionID(), backendScript)
+		if !errors.Is(err, bash.ErrSessionBusy) {
+			bashManager.RecordHistory("bash_script", args.Script, true, time.Since(started), result, err)
+		}
+
+		if errors.Is(err, bash.ErrCommandCancelled) {
+			return createErrorResponse("Script cancelled by the client")
+		}
+		if errors.Is(err, bash.ErrSessionBusy) {
+			return createErrorResponse(fmt.Sprintf("Script not run: %v. Try again once they have finished.", err))
+		}
+		if errors.Is(err, bash.ErrCommandTimedOut) {
+			response = createCommandResponse(cleanOutput(result, cfg.StripANSI), cfg, false)
+			response.IsError = true
+			prependWarning(&response, fmt.Sprintf("Script killed: %v. Output captured before then follows.", err))
+			annotateTimeout(&response, bashManager.DescribeTimeout(0), result)
+			return response
+		}
+		if err != nil {
+			return createErrorResponse(fmt.Sprintf("Script execution failed: %v", err))
+		}
+		result.Failure = bashManager.AnalyzeResult(args.Script, result)
+
+		response = createCommandResponse(cleanOutput(result, cfg.StripANSI), cfg, false)
+		annotateTimeout(&response, bashManager.DescribeTimeout(0), result)
+		prependWarning(&response, diskWarning)
+
+	case "bash_output":
+		id, offset, limit, err := bash.ParseOutputArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		page, err := bashManager.ReadOutput(id, offset, limit)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
 
-	return json.Marshal(response)
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: page.Text},
+			},
+			StructuredContent: map[string]interface{}{
+				"outputId":    page.OutputID,
+				"offset":      page.Offset,
+				"bytes":       page.Bytes,
+				"storedBytes": page.StoredBytes,
+				"totalBytes":  page.TotalBytes,
+				"nextOffset":  page.NextOffset,
+				"incomplete":  page.Incomplete,
+			},
+		}
+
+	case "session_budget":
+		return handleSessionBudget(request.Arguments, budget, cfg)
+
+	case "server_stats":
+		text, err := json.MarshalIndent(map[string]interface{}{
+			"commandLatency":         latency.summary(),
+			"slowCommandThresholdMs": cfg.SlowCommandThresholdMs,
+			"configFile":             cfg.Path,
+			"configSearchPaths":      cfg.SearchPaths,
+			"admission":              admissionStatus(admission),
+			"customToolsReload":      lastCustomToolReload(),
+		}, "", "  ")
+		if err != nil {
+			return createErrorResponse(fmt.Sprintf("failed to encode server stats: %v", err))
+		}
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: string(text)},
+			},
+		}
+
+	case "events_poll":
+		ack, limit, err := bash.ParseEventsPollArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		page := bashManager.Events().Poll(ack, limit)
+		text, err := json.MarshalIndent(page, "", "  ")
+		if err != nil {
+			return createErrorResponse(fmt.Sprintf("failed to encode events: %v", err))
+		}
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: string(text)},
+			},
+			StructuredContent: map[string]interface{}{
+				"events":  page.Events,
+				"acked":   page.Acked,
+				"lastSeq": page.LastSeq,
+				"more":    page.More,
+			},
+		}
+
+	case "bash_sessions":
+		order, err := bash.ParseSessionsArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		text, err := json.MarshalIndent(map[string]interface{}{
+			"sessions":      bashManager.Sessions(),
+			"locks":         bashManager.Locks(order),
+			"otherSessions": activity.others(),
+			"orphans":       bashManager.Orphans(),
+		}, "", "  ")
+		if err != nil {
+			return createErrorResponse(fmt.Sprintf("failed to encode sessions: %v", err))
+		}
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: string(text)},
+			},
+		}
+
+	case "bash_history":
+		filter, err := bash.ParseHistoryArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		text, err := json.MarshalIndent(map[string]interface{}{
+			"commands": bashManager.History(filter),
+			"capacity": bashManager.HistorySize(),
+		}, "", "  ")
+		if err != nil {
+			return createErrorResponse(fmt.Sprintf("failed to encode history: %v", err))
+		}
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: string(text)},
+			},
+		}
+
+	case "acquire_lock", "release_lock":
+		args, err := bash.ParseLockArgs(request.Name, request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		if jail := bashManager.Jail(); jail != nil {
+			if args.Path, err = jail.Resolve(args.Path); err != nil {
+				return createErrorResponse(err.Error())
+			}
+		} else if !filepath.IsAbs(args.Path) {
+			args.Path = filepath.Join(bashManager.WorkingDirectory(), args.Path)
+		}
+		if args.Path, err = bashManager.AllowedRoots().Check(args.Path); err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		if request.Name == "release_lock" {
+			if err := bashManager.ReleaseLock(args.Path); err != nil {
+				return createErrorResponse(err.Error())
+			}
+			return mcp.CallToolResponse{
+				Content: []mcp.ContentItem{
+					{Type: "text", Text: fmt.Sprintf("Released lock %s", args.Path)},
+				},
+			}
+		}
+
+		lock, err := bashManager.AcquireLock(ctx, args.Path, args.Purpose, args.Wait(), args.Force,
+			cfg.GetLockForceAfter())
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: fmt.Sprintf("Acquired lock %s", lock.Path)},
+			},
+			StructuredContent: map[string]interface{}{
+				"path":       lock.Path,
+				"owner":      lock.Owner,
+				"pid":        lock.PID,
+				"session":    lock.Session,
+				"acquiredAt": lock.AcquiredAt,
+				"purpose":    lock.Purpose,
+			},
+		}
+
+	case "interrupt_session":
+		id, sig, wait, err := bash.ParseInterruptArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		result, err := bashManager.InterruptSession(id, sig, wait)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		text := fmt.Sprintf("Sent %s to %d process(es) in session %d", result.Signal, result.Signalled, result.Session)
+		switch {
+		case !result.Waited:
+			text += "; its bash call returns once the command finishes"
+		case result.Completed:
+			text += "; the command has finished"
+		default:
+			text += fmt.Sprintf("; the command was still running after %v", bash.InterruptWaitLimit)
+		}
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: text},
+			},
+			StructuredContent: map[string]interface{}{
+				"session":   result.Session,
+				"signal":    result.Signal,
+				"signalled": result.Signalled,
+				"waited":    result.Waited,
+				"completed": result.Completed,
+			},
+		}
+
+	case "bash_job_status":
+		id, _, _, err := bash.ParseJobArgs(request.Name, request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		if id == 0 {
+			jobs := bashManager.Jobs()
+			text, err := json.MarshalIndent(jobs, "", "  ")
+			if err != nil {
+				return createErrorResponse(fmt.Sprintf("failed to encode jobs: %v", err))
+			}
+			response = mcp.CallToolResponse{
+				Content: []mcp.ContentItem{
+					{Type: "text", Text: string(text)},
+				},
+				StructuredContent: map[string]interface{}{"jobs": jobs},
+			}
+			break
+		}
+		job, err := bashManager.JobStatus(id)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: jobSummary(job)},
+			},
+			StructuredContent: jobContent(job),
+		}
+
+	case "bash_job_output":
+		id, offset, limit, err := bash.ParseJobArgs(request.Name, request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		page, err := bashManager.JobOutput(id, offset, limit)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: page.Text},
+			},
+			StructuredContent: map[string]interface{}{
+				"job":        page.Job,
+				"offset":     page.Offset,
+				"bytes":      page.Bytes,
+				"totalBytes": page.TotalBytes,
+				"nextOffset": page.NextOffset,
+				"running":    page.Running,
+			},
+		}
+
+	case "bash_job_kill":
+		id, _, _, err := bash.ParseJobArgs(request.Name, request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		fmt.Fprintf(os.Stderr, "Killing background job %d\n", id)
+		job, err := bashManager.KillJob(id)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: jobSummary(job)},
+			},
+			StructuredContent: jobContent(job),
+		}
+
+	case "read_file":
+		args, err := bash.ParseReadFileArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		windowsPaths := bashManager.WindowsPaths()
+		var fromWindows bool
+		if args.Path, fromWindows, err = windowsPaths.ToLinux(args.Path); err != nil {
+			return createErrorResponse(err.Error())
+		}
+		if jail := bashManager.Jail(); jail != nil {
+			if args.Path, err = jail.Resolve(args.Path); err != nil {
+				return createErrorResponse(err.Error())
+			}
+		} else if !filepath.IsAbs(args.Path) {
+			// Relative to where the session is, as cat would see it
+			args.Path = filepath.Join(bashManager.WorkingDirectory(), args.Path)
+		}
+		if args.Path, err = bashManager.AllowedRoots().Check(args.Path); err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		// Reading a file isn't a command, but the policy engine still
+		// decides whether it may happen
+		decision := checkPolicy(hook, cfg, server, bashManager, "read_file", args.Path, "", request.Meta, false)
+		if !decision.Allow {
+			return createErrorResponse(fmt.Sprintf("Read denied by policy: %s", decision.Reason))
+		}
+
+		result, err := bash.ReadFile(args, cfg.ReadFileMaxBytes)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		if fromWindows {
+			result.Path = windowsPaths.ToWindows(result.Path)
+		}
+
+		structured := map[string]interface{}{
+			"path":     result.Path,
+			"size":     result.Size,
+			"encoding": args.Encoding,
+		}
+		text := result.Text
+		if args.Encoding == bash.EncodingText {
+			structured["firstLine"] = result.FirstLine
+			structured["lastLine"] = result.LastLine
+			structured["totalLines"] = result.TotalLines
+			structured["nextOffset"] = result.NextOffset
+			if result.NextOffset != nil {
+				text += fmt.Sprintf("[Stopped at the size limit after line %d of %d; continue with offset %d]\n",
+					result.LastLine, result.TotalLines, *result.NextOffset)
+			} else if text == "" {
+				text = fmt.Sprintf("(%s is empty)", result.Path)
+			}
+		}
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: text},
+			},
+			StructuredContent: structured,
+		}
+
+	case "write_file":
+		args, err := bash.ParseWriteFileArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		windowsPaths := bashManager.WindowsPaths()
+		var fromWindows bool
+		if args.Path, fromWindows, err = windowsPaths.ToLinux(args.Path); err != nil {
+			return createErrorResponse(err.Error())
+		}
+		if jail := bashManager.Jail(); jail != nil {
+			if args.Path, err = jail.Resolve(args.Path); err != nil {
+				return createErrorResponse(err.Error())
+			}
+		} else if !filepath.IsAbs(args.Path) {
+			args.Path = filepath.Join(bashManager.WorkingDirectory(), args.Path)
+		}
+		if args.Path, err = bashManager.AllowedRoots().Check(args.Path); err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		decision := checkPolicy(hook, cfg, server, bashManager, "write_file", args.Path, "", request.Meta, false)
+		if !decision.Allow {
+			return createErrorResponse(fmt.Sprintf("Write denied by policy: %s", decision.Reason))
+		}
+
+		diskWarning, err := checkDisk(disk, true, bash.ExistingDir(args.Path))
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		// With confirmation on, overwriting an existing file first shows
+		// the diff
+		if preview := confirm.check(request, func() (*confirmPreview, error) {
+			if args.Mode != bash.WriteOverwrite {
+				return nil, nil
+			}
+			diff, exists, err := bash.PreviewOverwrite(args.Path, args.Content)
+			if err != nil || !exists {
+				return nil, err
+			}
+			path := args.Path
+			if fromWindows {
+				path = windowsPaths.ToWindows(path)
+			}
+			text := fmt.Sprintf("Would overwrite %s with %d bytes", path, len(args.Content))
+			if diff != "" {
+				text += "\n\n" + diff
+			} else {
+				text += "; content unchanged"
+			}
+			return &confirmPreview{Text: text, Structured: map[string]interface{}{
+				"path":  path,
+				"bytes": len(args.Content),
+				"diff":  diff,
+			}}, nil
+		}); preview != nil {
+			return *preview
+		}
+
+		fmt.Fprintf(os.Stderr, "Writing file: %s (%s, %d bytes)\n", args.Path, args.Mode, len(args.Content))
+		result, err := bashManager.WriteFile(args)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		if fromWindows {
+			result.Path = windowsPaths.ToWindows(result.Path)
+		}
+
+		verb := map[string]string{
+			bash.WriteCreate:    "Created",
+			bash.WriteOverwrite: "Wrote",
+			bash.WriteAppend:    "Appended",
+		}[args.Mode]
+		text := fmt.Sprintf("%s %s (%d bytes)", verb, result.Path, result.Bytes)
+		if result.Created && args.Mode != bash.WriteCreate {
+			text += "; the file was created"
+		}
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: text},
+			},
+			StructuredContent: map[string]interface{}{
+				"path":         result.Path,
+				"mode":         args.Mode,
+				"bytesWritten": result.Bytes,
+				"created":      result.Created,
+			},
+		}
+		prependWarning(&response, diskWarning)
+
+	case "file_edit":
+		args, err := bash.ParseFileEditArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		// A Windows path is named the same way in the result
+		windowsPaths := bashManager.WindowsPaths()
+		var fromWindows bool
+		if args.Path, fromWindows, err = windowsPaths.ToLinux(args.Path); err != nil {
+			return createErrorResponse(err.Error())
+		}
+		if jail := bashManager.Jail(); jail != nil {
+			if args.Path, err = jail.Resolve(args.Path); err != nil {
+				return createErrorResponse(err.Error())
+			}
+		} else if !filepath.IsAbs(args.Path) {
+			args.Path = filepath.Join(bashManager.WorkingDirectory(), args.Path)
+		}
+		if args.Path, err = bashManager.AllowedRoots().Check(args.Path); err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		decision := checkPolicy(hook, cfg, server, bashManager, "file_edit", args.Path, "", request.Meta, false)
+		if !decision.Allow {
+			return createErrorResponse(fmt.Sprintf("Edit denied by policy: %s", decision.Reason))
+		}
+
+		diskWarning, err := checkDisk(disk, true, bash.ExistingDir(args.Path))
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		// With confirmation on, the first call only shows the diff
+		if preview := confirm.check(request, func() (*confirmPreview, error) {
+			result, err := bash.PreviewEdit(args)
+			if err != nil {
+				return nil, err
+			}
+			if fromWindows {
+				result.Path = windowsPaths.ToWindows(result.Path)
+			}
+			text := fmt.Sprintf("Would edit %s (%d change(s))", result.Path, result.Changes)
+			if result.Diff != "" {
+				text += "\n\n" + result.Diff
+			}
+			return &confirmPreview{Text: text, Structured: map[string]interface{}{
+				"path":    result.Path,
+				"changes": result.Changes,
+				"diff":    result.Diff,
+			}}, nil
+		}); preview != nil {
+			return *preview
+		}
+
+		fmt.Fprintf(os.Stderr, "Editing file: %s (%s)\n", args.Path, args.Operation)
+		result, err := bash.EditFile(args)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		if fromWindows {
+			result.Path = windowsPaths.ToWindows(result.Path)
+		}
+		text := fmt.Sprintf("Edited %s (%d change(s))", result.Path, result.Changes)
+		if result.Diff != "" {
+			text += "\n\n" + result.Diff
+		} else {
+			text += "; file content unchanged"
+		}
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: text},
+			},
+		}
+		prependWarning(&response, diskWarning)
+
+	case "fetch_artifact":
+		args, err := bash.ParseFetchArgs(request.Arguments)
+		if err != nil {
+			return createFetchErrorResponse(&bash.FetchError{Kind: bash.FetchErrInvalid, Err: err})
+		}
+		windowsPaths := bashManager.WindowsPaths()
+		var fromWindows bool
+		if args.Destination, fromWindows, err = windowsPaths.ToLinux(args.Destination); err != nil {
+			return createFetchErrorResponse(&bash.FetchError{Kind: bash.FetchErrInvalid, Err: err})
+		}
+		if jail := bashManager.Jail(); jail != nil {
+			if args.Destination, err = jail.Resolve(args.Destination); err != nil {
+				return createFetchErrorResponse(&bash.FetchError{Kind: bash.FetchErrInvalid, Err: err})
+			}
+		} else if !filepath.IsAbs(args.Destination) {
+			// Like working_directory, relative to where the session is
+			args.Destination = filepath.Join(bashManager.WorkingDirectory(), args.Destination)
+		}
+		if args.Destination, err = bashManager.AllowedRoots().Check(args.Destination); err != nil {
+			return createFetchErrorResponse(&bash.FetchError{Kind: bash.FetchErrInvalid, Err: err})
+		}
+
+		// A download isn't a command, but the policy engine still decides
+		// whether it may happen
+		decision := checkPolicy(hook, cfg, server, bashManager, "fetch_artifact", args.URL, args.Destination,
+			request.Meta, false)
+		if !decision.Allow {
+			return createErrorResponse(fmt.Sprintf("Download denied by policy: %s", decision.Reason))
+		}
+
+		diskWarning, err := checkDisk(disk, true, bash.ExistingDir(filepath.Join(args.Destination, ".")))
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		// With confirmation on, a call that would overwrite existing paths
+		// first lists them
+		if preview := confirm.check(request, func() (*confirmPreview, error) {
+			targets, err := args.ExistingTargets()
+			if err != nil || len(targets) == 0 {
+				return nil, err
+			}
+			destination := args.Destination
+			if fromWindows {
+				destination = windowsPaths.ToWindows(destination)
+			}
+			text := fmt.Sprintf("Fetching %s to %s would overwrite %d existing path(s):", args.URL, destination,
+				len(targets))
+			for i := range targets {
+				if fromWindows {
+					targets[i] = windowsPaths.ToWindows(targets[i])
+				}
+				text += "\n" + targets[i]
+			}
+			return &confirmPreview{Text: text, Structured: map[string]interface{}{
+				"url":         args.URL,
+				"destination": destination,
+				"overwrites":  targets,
+			}}, nil
+		}); preview != nil {
+			return *preview
+		}
+
+		timeout := bash.DefaultFetchTimeout
+		if args.Timeout > 0 {
+			timeout = time.Duration(args.Timeout) * time.Second
+		}
+		timeout = min(timeout, bashManager.MaxTimeout())
+		fetchCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		fmt.Fprintf(os.Stderr, "Fetching artifact: %s -> %s\n", args.URL, args.Destination)
+		fetcher := &bash.Fetcher{AllowHTTP: cfg.FetchAllowHTTP}
+		result, err := fetcher.Fetch(fetchCtx, args)
+		if err != nil {
+			var fetchErr *bash.FetchError
+			if errors.As(err, &fetchErr) {
+				return createFetchErrorResponse(fetchErr)
+			}
+			return createErrorResponse(err.Error())
+		}
+
+		if fromWindows {
+			result.Path = windowsPaths.ToWindows(result.Path)
+		}
+		text := fmt.Sprintf("Fetched %s (%d bytes, %s:%s) to %s", result.FinalURL, result.Size,
+			result.Algorithm, result.Digest, result.Path)
+		if result.Format != "" {
+			text = fmt.Sprintf("Fetched %s (%d bytes, %s:%s) and extracted %d file(s) from the %s archive into %s",
+				result.FinalURL, result.Size, result.Algorithm, result.Digest, result.ExtractedFiles, result.Format,
+				result.Path)
+		}
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: text},
+			},
+			StructuredContent: map[string]interface{}{
+				"url":            result.URL,
+				"finalUrl":       result.FinalURL,
+				"size":           result.Size,
+				"algorithm":      result.Algorithm,
+				"digest":         result.Digest,
+				"path":           result.Path,
+				"format":         result.Format,
+				"extractedFiles": result.ExtractedFiles,
+			},
+		}
+		prependWarning(&response, diskWarning)
+
+	default:
+		return createErrorResponse(fmt.Sprintf("Unknown tool: %s", request.Name))
+	}
+
+	return response
+}
+
+// clientTimeoutWarning returns a warning when a command's timeout exceeds how
+// long the client is likely to wait, or "" if there is no known mismatch.
+// The client's own advertised timeout takes precedence over the config hint.
+func clientTimeoutWarning(timeout time.Duration, server *mcp.Server, cfg *config.Config) string {
+	clientTimeout := clientRequestTimeout(server, cfg)
+	if clientTimeout == 0 || timeout <= clientTimeout {
+		return ""
+	}
+	return fmt.Sprintf("Warning: commands may run for up to %v, but the client is likely to abandon requests after %v. "+
+		"Results arriving after that will not be seen; run long commands with background: true "+
+		"and poll their output with bash_job_output instead.", timeout, clientTimeout)
+}
+
+// annotateTimeout records in structuredContent the time limit a command ran
+// under and, if it was stopped for exceeding it, which limit that was
+func annotateTimeout(response *mcp.CallToolResponse, info bash.TimeoutInfo, result bash.CommandResult) {
+	info.Exceeded = result.TimedOut
+	if response.StructuredContent == nil {
+		response.StructuredContent = make(map[string]interface{})
+	}
+	response.StructuredContent["timeout"] = info
+}
+
+// clientRequestTimeout returns how long the client is likely to wait for a
+// tool call, or 0 if unknown: the client's own advertised timeout, else the
+// config hint
+func clientRequestTimeout(server *mcp.Server, cfg *config.Config) time.Duration {
+	if clientTimeout := server.ClientRequestTimeout(); clientTimeout > 0 {
+		return clientTimeout
+	}
+	return cfg.GetClientRequestTimeout()
+}
+
+// createCommandResponse creates the response for a command that ran to
+// completion. The exit code goes in structuredContent, which is authoritative;
+// the text keeps its "[Exit code: N]" line for clients that only read text.
+// A command that succeeds silently gets the configured placeholder text
+// unless quiet is set.
+func createCommandResponse(result bash.CommandResult, cfg *config.Config, quiet bool) mcp.CallToolResponse {
+	structured := map[string]interface{}{
+		"exitCode": result.ExitCode,
+	}
+	if len(result.BackgroundJobs) > 0 {
+		structured["backgroundJobs"] = result.BackgroundJobs
+	}
+	if len(result.StoredOutputs) > 0 {
+		structured["storedOutputs"] = result.StoredOutputs
+	}
+	if result.Failure != nil {
+		structured["failureContext"] = result.Failure
+	}
+	if result.Output == "" && result.ExitCode == 0 && result.Interrupted == "" && !quiet {
+		result.Output = cfg.GetEmptyOutputText()
+	}
+	response := mcp.CallToolResponse{
+		Content: []mcp.ContentItem{
+			{Type: "text", Text: result.Output},
+		},
+		StructuredContent: structured,
+		IsError:           cfg.NonZeroExitIsError && result.ExitCode != 0,
+	}
+	if result.Duration > 0 {
+		response.Meta = map[string]interface{}{"durationMs": result.Duration.Milliseconds()}
+	}
+	if result.WorkingDirectory != "" {
+		if response.Meta == nil {
+			response.Meta = map[string]interface{}{}
+		}
+		response.Meta["workingDirectory"] = result.WorkingDirectory
+	}
+	for i := len(result.Warnings) - 1; i >= 0; i-- {
+		prependWarning(&response, result.Warnings[i])
+	}
+	if result.Interrupted != "" {
+		structured["interrupted"] = result.Interrupted
+		prependWarning(&response, fmt.Sprintf("[Interrupted: %s sent by interrupt_session; output up to then follows]",
+			result.Interrupted))
+	}
+	addResourceLinks(&response, result.StoredOutputs)
+	return response
+}
+
+// cleanOutput strips ANSI escape sequences from a result's output when strip
+// is set
+func cleanOutput(result bash.CommandResult, strip bool) bash.CommandResult {
+	if strip {
+		result.Output = bash.StripANSI(result.Output)
+		if result.Failure != nil {
+			for i := range result.Failure.StderrTail {
+				result.Failure.StderrTail[i] = bash.StripANSI(result.Failure.StderrTail[i])
+			}
+		}
+	}
+	return result
+}
+
+// nestedOptions converts the nested MCP config into bash manager options
+func nestedOptions(cfg *config.Config) bash.NestedOptions {
+	if cfg.NestedMcp == nil {
+		return bash.NestedOptions{}
+	}
+	return bash.NestedOptions{
+		Disabled: cfg.NestedMcp.Disabled,
+		Sockets:  cfg.NestedMcp.Sockets,
+	}
+}
+
+// sandboxOptions converts the sandbox config into bash manager options
+func sandboxOptions(cfg *config.Config) bash.Sandbox {
+	sandbox := bash.Sandbox{
+		NoNetwork:     cfg.IsNetworkAccessDisabled(),
+		AllowLoopback: cfg.AllowLoopback,
+	}
+	if cfg.IsSandboxEnabled() {
+		sandbox.Enabled = true
+		sandbox.ReadOnly = cfg.Sandbox.ReadOnlyPaths
+		if cfg.Sandbox.ConfineWrites {
+			sandbox.Writable = cfg.AllowedRoots
+		}
+	}
+	return sandbox
+}
+
+// resourceLimits converts the limits config into session resource limits
+func resourceLimits(cfg *config.Config) bash.ResourceLimits {
+	if cfg.Limits == nil {
+		return bash.ResourceLimits{}
+	}
+	return bash.ResourceLimits{
+		CPUSeconds:   cfg.Limits.CPUSeconds,
+		MemoryBytes:  cfg.Limits.MemoryBytes,
+		MaxFileSize:  cfg.Limits.MaxFileSize,
+		MaxOpenFiles: cfg.Limits.MaxOpenFiles,
+		MaxProcesses: cfg.Limits.MaxProcesses,
+	}
+}
+
+// createFetchErrorResponse creates the response for a failed fetch_artifact
+// call, with the kind of failure in structuredContent
+func createFetchErrorResponse(err *bash.FetchError) mcp.CallToolResponse {
+	response := createErrorResponse(err.Error())
+	response.StructuredContent = map[string]interface{}{
+		"error":   err.Kind,
+		"message": err.Error(),
+	}
+	return response
+}
+
+// jobSummary describes a background job in a sentence
+func jobSummary(job bash.JobInfo) string {
+	if job.Running {
+		return fmt.Sprintf("Job %d (PID %d) is running; %d bytes of output, %d read", job.ID, job.PID,
+			job.OutputBytes, job.ReadOffset)
+	}
+	return fmt.Sprintf("Job %d (PID %d) has finished (%s); %d bytes of output, %d read", job.ID, job.PID,
+		job.ExitStatus, job.OutputBytes, job.ReadOffset)
+}
+
+// jobContent is a background job's structured content
+func jobContent(job bash.JobInfo) map[string]interface{} {
+	content := map[string]interface{}{
+		"job":         job.ID,
+		"pid":         job.PID,
+		"command":     job.Command,
+		"startedAt":   job.StartedAt,
+		"running":     job.Running,
+		"outputFile":  job.OutputFile,
+		"outputBytes": job.OutputBytes,
+		"readOffset":  job.ReadOffset,
+	}
+	if !job.Running {
+		if job.ExitCode != nil {
+			content["exitCode"] = *job.ExitCode
+		}
+		content["exitStatus"] = job.ExitStatus
+		content["endedAt"] = *job.EndedAt
+	}
+	if job.Adopted {
+		content["adopted"] = true
+	}
+	if job.Lost {
+		content["lost"] = true
+	}
+	return content
+}
+
+// syntaxResponse reports a syntax check. A script that doesn't parse is an
+// error result, with each problem in structuredContent.
+func syntaxResponse(result *bash.SyntaxResult) mcp.CallToolResponse {
+	problems := result.Errors
+	if problems == nil {
+		problems = []bash.SyntaxError{}
+	}
+	return mcp.CallToolResponse{
+		Content: []mcp.ContentItem{
+			{Type: "text", Text: result.Text()},
+		},
+		StructuredContent: map[string]interface{}{
+			"syntaxOK": result.OK(),
+			"shell":    result.Shell,
+			"errors":   problems,
+		},
+		IsError: !result.OK(),
+	}
 }
 
 // createErrorResponse creates an error response for a tool call
-func createErrorResponse(message string) (json.RawMessage, error) {
+func createErrorResponse(message string) mcp.CallToolResponse {
 	response := mcp.CallToolResponse{
 		Content: []mcp.ContentItem{
 			{Type: "text", Text: fmt.Sprintf("Error: %s", message)},
@@ -221,5 +1797,5 @@ func createErrorResponse(message string) (json.RawMessage, error) {
 		IsError: true,
 	}
 
-	return json.Marshal(response)
+	return response
 }
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/bash"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/mcp"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/secrets"
+)
+
+// attachPipelineTiming adds a profiled pipeline's stage timings to the
+// response as structuredContent.pipelineTiming
+func attachPipelineTiming(response *mcp.CallToolResponse, profile *bash.PipelineProfile, store *secrets.Store) {
+	if profile == nil {
+		return
+	}
+	timings, err := profile.Timings()
+	if err != nil {
+		prependWarning(response, fmt.Sprintf("Warning: %v", err))
+		return
+	}
+	for i := range timings {
+		timings[i].Command = store.Redact(timings[i].Command)
+	}
+
+	if response.StructuredContent == nil {
+		response.StructuredContent = map[string]interface{}{}
+	}
+	response.StructuredContent["pipelineTiming"] = timings
+	if missing := profile.Stages() - len(timings); missing > 0 {
+		prependWarning(response, fmt.Sprintf("Note: %d of %d pipeline stages reported no timing; they were "+
+			"killed before finishing", missing, profile.Stages()))
+	}
+}
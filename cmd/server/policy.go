@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/bash"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/config"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/events"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/mcp"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/policy"
+)
+
+// newPolicyHook creates the external policy hook, or nil if none is configured
+func newPolicyHook(cfg *config.Config) (*policy.Hook, error) {
+	if cfg.PolicyHook == nil {
+		return nil, nil
+	}
+	return policy.New(policy.Options{
+		URL:       cfg.PolicyHook.URL,
+		Command:   cfg.PolicyHook.Command,
+		Timeout:   time.Duration(cfg.PolicyHook.TimeoutMs) * time.Millisecond,
+		OnFailure: cfg.PolicyHook.OnFailure,
+	})
+}
+
+// policyRewrite records a command changed by an allowing policy decision
+type policyRewrite struct {
+	Original string `json:"originalCommand"`
+	Command  string `json:"command"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// checkPolicy asks the policy hook about a command. With no hook configured
+// every command is allowed unchanged.
+func checkPolicy(hook *policy.Hook, cfg *config.Config, server *mcp.Server, bashManager *bash.BashManager,
+	tool, command, cwd string, meta json.RawMessage, bypass bool) policy.Decision {
+	if hook == nil {
+		return policy.Decision{Allow: true}
+	}
+	if cwd == "" {
+		cwd = bashManager.WorkingDirectory()
+	}
+	client := server.ClientInfo()
+
+	decision := hook.Evaluate(policy.Request{
+		Tool:      tool,
+		Command:   command,
+		Session:   bashManager.SessionID(),
+		Cwd:       cwd,
+		Labels:    cfg.PolicyHook.Labels,
+		Meta:      meta,
+		Caller:    policy.Caller{ClientName: client.Name, ClientVersion: client.Version},
+		Transport: transportName(cfg),
+		Bypass:    bypass,
+	})
+	if !decision.Allow {
+		fmt.Fprintf(os.Stderr, "Policy denied %s command: %s\n", tool, decision.Reason)
+		bashManager.Events().Publish(events.PolicyDenied, fmt.Sprintf("Policy denied %s command: %s", tool, decision.Reason),
+			map[string]interface{}{"tool": tool, "command": command, "reason": decision.Reason})
+	}
+	return decision
+}
+
+// rewriteFromDecision returns the rewrite an allowing decision asks for, or
+// nil if the command is unchanged.
+func rewriteFromDecision(decision policy.Decision, command string) *policyRewrite {
+	if decision.Mutations == nil || decision.Mutations.Command == nil || *decision.Mutations.Command == command {
+		return nil
+	}
+	rewrite := &policyRewrite{Original: command, Command: *decision.Mutations.Command, Reason: decision.Reason}
+	fmt.Fprintf(os.Stderr, "Policy rewrote command %q to %q (%s)\n", rewrite.Original, rewrite.Command, rewrite.Reason)
+	return rewrite
+}
+
+// annotateRewrite records a policy rewrite in the response text and metadata
+func annotateRewrite(response *mcp.CallToolResponse, rewrite *policyRewrite) {
+	if rewrite == nil {
+		return
+	}
+	note := fmt.Sprintf("[policy: command was rewritten before running: %s]", rewrite.Command)
+	if rewrite.Reason != "" {
+		note = fmt.Sprintf("[policy: command was rewritten before running (%s): %s]", rewrite.Reason, rewrite.Command)
+	}
+	prependWarning(response, note)
+	if response.StructuredContent == nil {
+		response.StructuredContent = map[string]interface{}{}
+	}
+	response.StructuredContent["policyRewrite"] = rewrite
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/bash"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/config"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/mcptest"
+)
+
+// testPolicy is a policy engine that denies commands mentioning "forbidden"
+// and rewrites "rewrite-me" to echo
+const testPolicy = `input=$(cat)
+case $input in
+*forbidden*) echo '{"allow":false,"reason":"forbidden word"}' ;;
+*rewrite-me*) echo '{"allow":true,"reason":"tidied","mutations":{"command":"echo rewritten"}}' ;;
+*) echo '{"allow":true}' ;;
+esac`
+
+// newPolicyTestServer serves the tools with testPolicy as the policy hook
+func newPolicyTestServer(t *testing.T) *mcptest.Harness {
+	t.Helper()
+	if _, err := bash.FindShell(bash.DefaultShell); err != nil {
+		t.Skip(err)
+	}
+	cfg := &config.Config{CommandTimeout: 30, Enabled: true,
+		PolicyHook: &config.PolicyHookConfig{Command: []string{"sh", "-c", testPolicy}}}
+	hook, err := newPolicyHook(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := newTestServerWith(t, cfg, testDeps{hook: hook})
+	h.Initialize(t)
+	return h
+}
+
+func TestPolicyHookDeniesCommand(t *testing.T) {
+	h := newPolicyTestServer(t)
+
+	marker := filepath.Join(t.TempDir(), "ran")
+	response := h.CallTool(t, "bash", map[string]interface{}{"command": "touch " + marker + " # forbidden"})
+	if !response.IsError || !strings.Contains(mcptest.Text(response), "denied by policy: forbidden word") {
+		t.Errorf("response = %q, want a policy denial", mcptest.Text(response))
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Errorf("the denied command ran")
+	}
+
+	response = h.CallTool(t, "exec", map[string]interface{}{"argv": []string{"touch", marker, "forbidden"}})
+	if !response.IsError {
+		t.Errorf("exec ran a command the policy denies: %s", mcptest.Text(response))
+	}
+}
+
+func TestPolicyHookRewritesCommand(t *testing.T) {
+	h := newPolicyTestServer(t)
+
+	response := h.CallTool(t, "bash", map[string]interface{}{"command": "echo rewrite-me"})
+	if response.IsError {
+		t.Fatal(mcptest.Text(response))
+	}
+	text := mcptest.Text(response)
+	if !strings.Contains(text, "rewritten") || !strings.Contains(text, "[policy: command was rewritten") {
+		t.Errorf("response = %q, want the rewritten command's output and a note", text)
+	}
+	rewrite, _ := response.StructuredContent["policyRewrite"].(map[string]interface{})
+	if rewrite["originalCommand"] != "echo rewrite-me" || rewrite["reason"] != "tidied" {
+		t.Errorf("policyRewrite = %v", response.StructuredContent["policyRewrite"])
+	}
+
+	if response := h.CallTool(t, "bash", map[string]interface{}{"command": "echo fine"}); mcptest.Text(response) != "fine" {
+		t.Errorf("allowed command output = %q", mcptest.Text(response))
+	}
+}
+
+func TestPolicyHookCoversFileTools(t *testing.T) {
+	h := newPolicyTestServer(t)
+
+	dir := filepath.Join(t.TempDir(), "forbidden")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(path, []byte("original\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := map[string]map[string]interface{}{
+		"read_file":  {"path": path},
+		"write_file": {"path": path, "content": "replaced\n"},
+		"file_edit":  {"path": path, "operation": "replace", "search": "original", "replacement": "edited"},
+	}
+	for tool, args := range calls {
+		response := h.CallTool(t, tool, args)
+		if !response.IsError || !strings.Contains(mcptest.Text(response), "denied by policy: forbidden word") {
+			t.Errorf("%s: response = %q, want a policy denial", tool, mcptest.Text(response))
+		}
+	}
+	if data, _ := os.ReadFile(path); string(data) != "original\n" {
+		t.Errorf("content = %q, want the file untouched", data)
+	}
+
+	allowed := filepath.Join(t.TempDir(), "notes.txt")
+	response := h.CallTool(t, "write_file", map[string]interface{}{"path": allowed, "content": "fine\n"})
+	if response.IsError {
+		t.Errorf("write_file to an allowed path: %s", mcptest.Text(response))
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/bash"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/config"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/mcp"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/secrets"
+)
+
+// progressParams is the body of a notifications/progress message. Progress
+// counts the output bytes streamed so far plus the queue updates sent, so it
+// increases with every notification; Message is the output produced since
+// the previous notification, or the command's place in the session queue.
+type progressParams struct {
+	ProgressToken json.RawMessage `json:"progressToken"`
+	Progress      int             `json:"progress"`
+	Message       string          `json:"message"`
+}
+
+// progressReporter sends one tool call's notifications/progress
+type progressReporter struct {
+	server *mcp.Server
+	token  json.RawMessage
+	store  *secrets.Store
+
+	mutex    sync.Mutex
+	progress int
+	failed   bool
+}
+
+// newProgressReporter returns a reporter for the call, or nil when the
+// request has no progressToken in _meta or the transport can't carry
+// notifications (network mode).
+func newProgressReporter(server *mcp.Server, cfg *config.Config, meta json.RawMessage, store *secrets.Store) *progressReporter {
+	if len(meta) == 0 || cfg.IsNetworkEnabled() {
+		return nil
+	}
+	var fields struct {
+		ProgressToken json.RawMessage `json:"progressToken"`
+	}
+	if err := json.Unmarshal(meta, &fields); err != nil || len(fields.ProgressToken) == 0 ||
+		string(fields.ProgressToken) == "null" {
+		return nil
+	}
+	return &progressReporter{server: server, token: fields.ProgressToken, store: store}
+}
+
+// output returns a ProgressFunc that streams command output, or nil for a
+// nil reporter
+func (p *progressReporter) output() bash.ProgressFunc {
+	if p == nil {
+		return nil
+	}
+	return func(chunk string) {
+		p.send(len(chunk), p.store.Redact(chunk))
+	}
+}
+
+// queued returns a QueueFunc that reports the command's place in the
+// session queue, or nil for a nil reporter
+func (p *progressReporter) queued() bash.QueueFunc {
+	if p == nil {
+		return nil
+	}
+	return func(position int) {
+		p.send(1, fmt.Sprintf("Waiting for the session: another command is running; "+
+			"this one is number %d in the queue", position))
+	}
+}
+
+// warn sends warning as a notification of its own, so a client watching
+// progress sees it before the command has produced anything. Nothing is sent
+// for an empty warning or a nil reporter.
+func (p *progressReporter) warn(warning string) {
+	if p == nil || warning == "" {
+		return
+	}
+	p.send(1, warning)
+}
+
+// send advances progress by step and sends message. After a failed send
+// nothing more is sent; the final response still has the output.
+func (p *progressReporter) send(step int, message string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.failed {
+		return
+	}
+	p.progress += step
+	err := p.server.SendNotification("notifications/progress", progressParams{
+		ProgressToken: p.token,
+		Progress:      p.progress,
+		Message:       message,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Progress notifications disabled for this call: %v\n", err)
+		p.failed = true
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/bash"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/config"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/mcp"
+)
+
+// newWriteQuota creates the write quota, or nil if none is configured.
+// Patterns were validated when the config was loaded.
+func newWriteQuota(cfg *config.Config) *bash.WriteQuota {
+	if cfg.WriteQuota == nil {
+		return nil
+	}
+	opts := bash.WriteQuotaOptions{
+		MaxBytes:   int64(cfg.WriteQuota.MaxMB) * 1024 * 1024,
+		Directory:  cfg.WriteQuota.Directory,
+		WatchRoots: cfg.WriteQuota.WatchRoots,
+		Poll:       time.Duration(cfg.WriteQuota.PollIntervalMs) * time.Millisecond,
+	}
+	for _, pattern := range cfg.WriteQuota.Commands {
+		opts.Commands = append(opts.Commands, regexp.MustCompile(pattern))
+	}
+	return bash.NewWriteQuota(opts)
+}
+
+// annotateWriteQuota reports a write-heavy command's usage as
+// structuredContent.writeQuota, with a warning if it went over
+func annotateWriteQuota(response *mcp.CallToolResponse, report *bash.QuotaReport) {
+	if report == nil {
+		return
+	}
+	if response.StructuredContent == nil {
+		response.StructuredContent = map[string]interface{}{}
+	}
+	response.StructuredContent["writeQuota"] = report
+	if !report.Exceeded {
+		return
+	}
+	response.IsError = true
+	warning := fmt.Sprintf("Warning: the command wrote %d bytes, more than its write quota of %d", report.UsedBytes,
+		report.LimitBytes)
+	if report.Directory != "" {
+		warning += "; its quota directory, and everything written there, was removed"
+	}
+	prependWarning(response, warning)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/replay"
+)
+
+// replayFlags are the command-line options selecting record or replay mode
+type replayFlags struct {
+	record  string
+	replay  string
+	lenient bool
+}
+
+// register adds the record/replay command-line options to set
+func (flags *replayFlags) register(set *flag.FlagSet) {
+	set.StringVar(&flags.record, "record", "", "record every tools/call and its response to `file`")
+	set.StringVar(&flags.replay, "replay", "", "answer tools/call from the recording in `file` without running anything")
+	set.BoolVar(&flags.lenient, "replay-lenient", false,
+		"in replay mode, answer a call whose arguments drifted with the closest unused recorded call for its tool")
+}
+
+// validate rejects record/replay options that can't be combined
+func (flags replayFlags) validate() error {
+	if flags.record != "" && flags.replay != "" {
+		return fmt.Errorf("-record and -replay can't be used together")
+	}
+	if flags.lenient && flags.replay == "" {
+		return fmt.Errorf("-replay-lenient requires -replay")
+	}
+	return nil
+}
+
+// openReplay creates the recorder or loads the player the flags ask for.
+// Both are nil in normal operation.
+func openReplay(flags replayFlags) (*replay.Recorder, *replay.Player, error) {
+	switch {
+	case flags.record != "":
+		recorder, err := replay.NewRecorder(flags.record)
+		return recorder, nil, err
+	case flags.replay != "":
+		player, err := replay.LoadPlayer(flags.replay, flags.lenient)
+		return nil, player, err
+	}
+	return nil, nil, nil
+}
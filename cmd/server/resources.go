@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/bash"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/config"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/mcp"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/policy"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/secrets"
+)
+
+// serverResources serves as MCP resources the full output of truncated
+// commands, stored on disk with outputResources set, and the files
+// registered with collectArtifacts. Text that is read is jailed and redacted
+// like a tool response.
+type serverResources struct {
+	bashManager *bash.BashManager
+	store       *secrets.Store
+}
+
+// ListResources lists the stored outputs, then the artifacts, oldest first
+func (r serverResources) ListResources() []mcp.Resource {
+	var resources []mcp.Resource
+	for _, output := range r.bashManager.OutputResources() {
+		resources = append(resources, outputResource(output.OutputID, output.Stream, output.StoredBytes,
+			output.TotalBytes))
+	}
+	for _, artifact := range r.bashManager.Artifacts() {
+		resources = append(resources, r.artifactResource(artifact))
+	}
+	return resources
+}
+
+// ReadResource returns all of a stored output or artifact
+func (r serverResources) ReadResource(uri string) (mcp.ResourceContents, error) {
+	if strings.HasPrefix(uri, bash.ArtifactURIScheme) {
+		return r.readArtifact(uri)
+	}
+	data, err := r.bashManager.ReadOutputResource(uri)
+	if errors.Is(err, bash.ErrUnknownOutput) {
+		return mcp.ResourceContents{}, fmt.Errorf("%w: %v", mcp.ErrResourceNotFound, err)
+	}
+	if err != nil {
+		return mcp.ResourceContents{}, err
+	}
+	text := strings.ToValidUTF8(string(data), "�")
+	text = r.store.Redact(r.bashManager.Jail().Rewrite(text))
+	return mcp.ResourceContents{URI: uri, MimeType: "text/plain", Text: text}, nil
+}
+
+// outputResource describes a stored output as a resource
+func outputResource(id, stream string, stored, total int) mcp.Resource {
+	description := fmt.Sprintf("Full %s of a truncated command, %d bytes", stream, total)
+	if stored < total {
+		description = fmt.Sprintf("The first %d of the %d bytes of %s a truncated command wrote", stored, total,
+			stream)
+	}
+	return mcp.Resource{
+		URI:         bash.OutputURI(id),
+		Name:        stream + "-" + id,
+		Description: description,
+		MimeType:    "text/plain",
+		Size:        int64(stored),
+	}
+}
+
+// addResourceLinks links a response to the resources its truncated output
+// was stored as
+func addResourceLinks(response *mcp.CallToolResponse, stored []bash.OutputRef) {
+	for _, ref := range stored {
+		if ref.URI != "" {
+			response.Content = append(response.Content,
+				mcp.ResourceLink(outputResource(ref.OutputID, ref.Stream, ref.StoredBytes, ref.TotalBytes)))
+		}
+	}
+}
+
+// readArtifact returns an artifact's current content: as text if it is
+// text, jailed and redacted, or otherwise as a base64 blob
+func (r serverResources) readArtifact(uri string) (mcp.ResourceContents, error) {
+	artifact, data, err := r.bashManager.ReadArtifact(uri)
+	if errors.Is(err, bash.ErrUnknownArtifact) {
+		return mcp.ResourceContents{}, fmt.Errorf("%w: %v", mcp.ErrResourceNotFound, err)
+	}
+	if err != nil {
+		return mcp.ResourceContents{}, err
+	}
+	contents := mcp.ResourceContents{URI: uri, MimeType: artifact.MimeType}
+	if isTextMimeType(artifact.MimeType) && utf8.Valid(data) {
+		contents.Text = r.store.Redact(r.bashManager.Jail().Rewrite(string(data)))
+	} else {
+		contents.Blob = base64.StdEncoding.EncodeToString(data)
+	}
+	return contents, nil
+}
+
+// artifactResource describes an artifact as a resource
+func (r serverResources) artifactResource(artifact bash.Artifact) mcp.Resource {
+	return mcp.Resource{
+		URI:         artifact.URI,
+		Name:        r.bashManager.Jail().Rewrite(artifact.Name),
+		Description: "Artifact collected from " + r.bashManager.Jail().Rewrite(artifact.Path),
+		MimeType:    artifact.MimeType,
+		Size:        artifact.Size,
+	}
+}
+
+// isTextMimeType reports whether content of a MIME type is read as text
+func isTextMimeType(mimeType string) bool {
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	return strings.HasPrefix(mimeType, "text/") || strings.HasSuffix(mimeType, "+json") ||
+		strings.HasSuffix(mimeType, "+xml") || mimeType == "application/json" || mimeType == "application/xml" ||
+		mimeType == "application/javascript"
+}
+
+// attachArtifacts collects the files a call's collectArtifacts patterns
+// match, after its command has run in dir, and links them from the
+// response. Each file is put to the policy hook like a read_file.
+func attachArtifacts(response *mcp.CallToolResponse, patterns []string, dir string, bashManager *bash.BashManager,
+	hook *policy.Hook, cfg *config.Config, server *mcp.Server, meta json.RawMessage) {
+	if len(patterns) == 0 {
+		return
+	}
+	artifacts, warnings := bashManager.CollectArtifacts(dir, patterns, func(path string) error {
+		decision := checkPolicy(hook, cfg, server, bashManager, "read_file", path, "", meta, false)
+		if !decision.Allow {
+			return fmt.Errorf("denied by policy: %s", decision.Reason)
+		}
+		return nil
+	})
+
+	resources := serverResources{bashManager: bashManager}
+	structured := make([]map[string]interface{}, 0, len(artifacts))
+	for _, artifact := range artifacts {
+		resource := resources.artifactResource(artifact)
+		response.Content = append(response.Content, mcp.ResourceLink(resource))
+		structured = append(structured, map[string]interface{}{
+			"uri":      resource.URI,
+			"name":     resource.Name,
+			"path":     bashManager.Jail().Rewrite(artifact.Path),
+			"size":     artifact.Size,
+			"mimeType": artifact.MimeType,
+		})
+	}
+	if response.StructuredContent == nil {
+		response.StructuredContent = map[string]interface{}{}
+	}
+	response.StructuredContent["artifacts"] = structured
+	if len(warnings) > 0 {
+		prependWarning(response, bashManager.Jail().Rewrite(strings.Join(warnings, "\n")))
+	}
+}
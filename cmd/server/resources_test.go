@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/bash"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/mcp"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/mcptest"
+)
+
+func TestCollectArtifactsLinksResources(t *testing.T) {
+	if _, err := bash.FindShell(bash.DefaultShell); err != nil {
+		t.Skip(err)
+	}
+	h := newTestServer(t)
+	h.Initialize(t)
+
+	dir := t.TempDir()
+	response := h.CallTool(t, "bash", map[string]interface{}{
+		"command":           "mkdir -p dist && echo report > coverage.txt && printf '\\0\\1' > dist/app.tar.gz",
+		"working_directory": dir,
+		"collectArtifacts":  []string{"coverage.txt", "dist/*.tar.gz", "junit.xml"},
+	})
+	if response.IsError {
+		t.Fatal(mcptest.Text(response))
+	}
+	if !strings.Contains(mcptest.Text(response), `"junit.xml" matched no files`) {
+		t.Errorf("response %q doesn't warn about junit.xml", mcptest.Text(response))
+	}
+
+	links := map[string]mcp.ContentItem{}
+	for _, item := range response.Content {
+		if item.Type == "resource_link" {
+			links[item.Name] = item
+		}
+	}
+	if len(links) != 2 || links["coverage.txt"].Size != 7 || links["dist/app.tar.gz"].MimeType == "" {
+		t.Fatalf("links = %+v", links)
+	}
+	if artifacts, _ := response.StructuredContent["artifacts"].([]interface{}); len(artifacts) != 2 {
+		t.Errorf("structuredContent.artifacts = %v", response.StructuredContent["artifacts"])
+	}
+
+	read := func(uri string) mcp.ResourceContents {
+		var result struct {
+			Contents []mcp.ResourceContents `json:"contents"`
+		}
+		if err := json.Unmarshal(h.Call(t, "resources/read", map[string]string{"uri": uri}), &result); err != nil ||
+			len(result.Contents) != 1 {
+			t.Fatalf("resources/read %s: %v", uri, err)
+		}
+		return result.Contents[0]
+	}
+	if contents := read(links["coverage.txt"].URI); contents.Text != "report\n" || contents.Blob != "" {
+		t.Errorf("coverage.txt = %+v", contents)
+	}
+	if contents := read(links["dist/app.tar.gz"].URI); contents.Blob != base64.StdEncoding.EncodeToString([]byte{0, 1}) {
+		t.Errorf("app.tar.gz = %+v, want a blob", contents)
+	}
+
+	var list struct {
+		Resources []mcp.Resource `json:"resources"`
+	}
+	if err := json.Unmarshal(h.Call(t, "resources/list", nil), &list); err != nil || len(list.Resources) != 2 {
+		t.Errorf("resources/list = %+v, %v", list.Resources, err)
+	}
+
+	// A file changed since it was collected is read as it is now
+	if err := os.WriteFile(filepath.Join(dir, "coverage.txt"), []byte("updated"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if contents := read(links["coverage.txt"].URI); contents.Text != "updated" {
+		t.Errorf("coverage.txt = %q after the update", contents.Text)
+	}
+}
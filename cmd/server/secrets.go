@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/bash"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/config"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/mcp"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/secrets"
+)
+
+// newSecretStore loads the configured secrets, or returns nil if none are
+// configured
+func newSecretStore(cfg *config.Config) (*secrets.Store, error) {
+	if cfg.Secrets == nil {
+		return nil, nil
+	}
+	store, err := secrets.Load(secrets.Options{
+		File: cfg.Secrets.File,
+		Env:  cfg.Secrets.Env,
+	})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(os.Stderr, "Loaded %d secret(s): %v\n", store.Len(), store.Names())
+	return store, nil
+}
+
+// withSecrets merges the secrets named by use_secret into a command's
+// per-call environment
+func withSecrets(env map[string]string, use map[string]string, store *secrets.Store) (map[string]string, error) {
+	if len(use) == 0 {
+		return env, nil
+	}
+	secretEnv, err := store.Env(use)
+	if err != nil {
+		return nil, err
+	}
+	merged := make(map[string]string, len(env)+len(secretEnv))
+	for name, value := range env {
+		merged[name] = value
+	}
+	for name, value := range secretEnv {
+		merged[name] = value
+	}
+	return merged, nil
+}
+
+// redactResponse removes secret values from every content item
+func redactResponse(response *mcp.CallToolResponse, store *secrets.Store) {
+	if store.Len() == 0 {
+		return
+	}
+	for i := range response.Content {
+		response.Content[i].Text = store.Redact(response.Content[i].Text)
+	}
+	// The failure context repeats the end of stderr
+	if failure, ok := response.StructuredContent["failureContext"].(*bash.FailureContext); ok {
+		for i := range failure.StderrTail {
+			failure.StderrTail[i] = store.Redact(failure.StderrTail[i])
+		}
+	}
+}
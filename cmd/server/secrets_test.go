@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/bash"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/config"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/mcptest"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/secrets"
+)
+
+// testSecret is the value of the "api" secret in newSecretsTestServer
+const testSecret = "sk-test-0123456789"
+
+// newSecretsTestServer serves the tools with an "api" secret configured
+func newSecretsTestServer(t *testing.T) *mcptest.Harness {
+	t.Helper()
+	if _, err := bash.FindShell(bash.DefaultShell); err != nil {
+		t.Skip(err)
+	}
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	if err := os.WriteFile(path, []byte(`{"api": "`+testSecret+`"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{CommandTimeout: 30, Enabled: true, Secrets: &config.SecretsConfig{File: path}}
+	store, err := secrets.Load(secrets.Options{File: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := newTestServerWith(t, cfg, testDeps{store: store})
+	h.Initialize(t)
+	return h
+}
+
+func TestSecretInjectedAndRedacted(t *testing.T) {
+	h := newSecretsTestServer(t)
+
+	response := h.CallTool(t, "bash", map[string]interface{}{
+		"command":    `echo "key=$API_KEY length=${#API_KEY}"`,
+		"use_secret": map[string]string{"api": "API_KEY"},
+	})
+	text := mcptest.Text(response)
+	if want := "key=[secret:api] "; !strings.HasPrefix(text, want) {
+		t.Errorf("output = %q, want the value redacted", text)
+	}
+	if !strings.Contains(text, "length=18") {
+		t.Errorf("output = %q, want the secret to have reached the command", text)
+	}
+
+	// Only the call that asked for it sees it
+	response = h.CallTool(t, "bash", map[string]interface{}{"command": `echo "[${API_KEY-unset}]"`})
+	if text := mcptest.Text(response); text != "[unset]" {
+		t.Errorf("output = %q, want the secret scoped to its call", text)
+	}
+}
+
+func TestSecretRedactedFromFailureContext(t *testing.T) {
+	h := newSecretsTestServer(t)
+
+	response := h.CallTool(t, "bash", map[string]interface{}{
+		"command":    `echo "bad token $API_KEY" >&2; exit 1`,
+		"use_secret": map[string]string{"api": "API_KEY"},
+	})
+	if strings.Contains(mcptest.Text(response), testSecret) {
+		t.Errorf("text reveals the secret: %q", mcptest.Text(response))
+	}
+	failure, _ := response.StructuredContent["failureContext"].(map[string]interface{})
+	tail := toString(failure["stderrTail"])
+	if !strings.Contains(tail, "bad token [secret:api]") {
+		t.Errorf("failure context stderr = %q, want the secret redacted", tail)
+	}
+}
+
+func TestUnknownSecretRefused(t *testing.T) {
+	h := newSecretsTestServer(t)
+
+	marker := filepath.Join(t.TempDir(), "ran")
+	response := h.CallTool(t, "bash", map[string]interface{}{
+		"command":    "touch " + marker,
+		"use_secret": map[string]string{"nope": "X"},
+	})
+	if !response.IsError || !strings.Contains(mcptest.Text(response), "available: api") {
+		t.Errorf("response = %q, want the unknown secret refused", mcptest.Text(response))
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Errorf("the command ran without its secret")
+	}
+}
+
+// toString flattens a decoded JSON value for substring checks
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i := range v {
+			parts[i] = toString(v[i])
+		}
+		return strings.Join(parts, "\n")
+	}
+	return ""
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/bash"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/config"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/events"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/mcp"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/mcptest"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/policy"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/secrets"
+)
+
+// newTestServer serves the real tool handlers over the in-memory harness,
+// with a default config and a bash manager that is closed when the test ends
+func newTestServer(t *testing.T) *mcptest.Harness {
+	t.Helper()
+	return newTestServerWithConfig(t, &config.Config{CommandTimeout: 30, Enabled: true})
+}
+
+// newTestServerWithConfig is newTestServer with the given config
+func newTestServerWithConfig(t *testing.T, cfg *config.Config) *mcptest.Harness {
+	t.Helper()
+	return newTestServerWith(t, cfg, testDeps{})
+}
+
+// testDeps are the optional parts of a test server: the policy hook and
+// secret store setupServerHandlers takes, and bash options beyond those
+// derived from the config
+type testDeps struct {
+	hook  *policy.Hook
+	store *secrets.Store
+	opts  bash.Options
+}
+
+// newTestServerWith is newTestServerWithConfig with deps wired in
+func newTestServerWith(t *testing.T, cfg *config.Config, deps testDeps) *mcptest.Harness {
+	t.Helper()
+
+	opts := deps.opts
+	opts.Timeout = cfg.GetTimeout()
+	opts.TimeoutMode = cfg.TimeoutMode
+	opts.MaxTotal = cfg.GetMaxTotal()
+	opts.MaxTimeout = cfg.GetMaxTimeout()
+	opts.Events = events.NewBus(cfg.EventBufferSize)
+	bashManager := bash.NewBashManager(opts)
+	t.Cleanup(bashManager.Close)
+
+	latency, err := newLatencyTracker(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	activity := newActivityBoard(cfg, nil)
+	t.Cleanup(activity.Close)
+
+	return mcptest.New(t, func(server *mcp.Server) {
+		setupServerHandlers(server, bashManager, cfg, deps.hook, deps.store, latency, nil, activity, nil, nil)
+	})
+}
+
+func TestInitializeAndListTools(t *testing.T) {
+	h := newTestServer(t)
+
+	result := h.Initialize(t)
+	if result.ProtocolVersion == "" {
+		t.Errorf("initialize returned no protocol version")
+	}
+	var capabilities map[string]json.RawMessage
+	if err := json.Unmarshal(result.Capabilities, &capabilities); err != nil {
+		t.Fatalf("invalid capabilities: %v", err)
+	}
+	if _, ok := capabilities["tools"]; !ok {
+		t.Errorf("capabilities %s don't advertise tools", result.Capabilities)
+	}
+
+	tools := h.ListTools(t)
+	if len(tools) != bash.BashTools.Len() {
+		t.Errorf("tools/list returned %d tools, want %d", len(tools), bash.BashTools.Len())
+	}
+	names := make(map[string]bool)
+	for _, tool := range tools {
+		names[tool.Name] = true
+	}
+	for _, name := range []string{"bash", "exec", "read_file"} {
+		if !names[name] {
+			t.Errorf("tools/list is missing %s", name)
+		}
+	}
+}
+
+func TestBashSessionEndToEnd(t *testing.T) {
+	if _, err := bash.FindShell(bash.DefaultShell); err != nil {
+		t.Skip(err)
+	}
+	h := newTestServer(t)
+	h.Initialize(t)
+
+	// State set by one call is seen by the next
+	dir := t.TempDir()
+	response := h.CallTool(t, "bash", map[string]interface{}{
+		"command": "cd " + dir + " && export GREETING=hello && echo started",
+	})
+	if response.IsError || !strings.Contains(mcptest.Text(response), "started") {
+		t.Fatalf("first command failed: %s", mcptest.Text(response))
+	}
+
+	response = h.CallTool(t, "bash", map[string]interface{}{"command": "echo $GREETING from $PWD; (exit 3)"})
+	if want := "hello from " + dir; !strings.Contains(mcptest.Text(response), want) {
+		t.Errorf("output %q doesn't contain %q", mcptest.Text(response), want)
+	}
+	if code, _ := response.StructuredContent["exitCode"].(float64); code != 3 {
+		t.Errorf("exitCode = %v, want 3", response.StructuredContent["exitCode"])
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/bash"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/config"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/mcptest"
+)
+
+const clientTimeoutText = "the client is likely to abandon requests"
+
+func TestClientTimeoutWarning(t *testing.T) {
+	if _, err := bash.FindShell(bash.DefaultShell); err != nil {
+		t.Skip(err)
+	}
+	h := newTestServerWithConfig(t, &config.Config{CommandTimeout: 2, ClientRequestTimeoutSeconds: 1, Enabled: true})
+	h.Initialize(t)
+
+	response := h.CallTool(t, "bash", map[string]interface{}{"command": "echo hi"})
+	if response.IsError || !strings.HasPrefix(response.Content[0].Text, "Warning:") ||
+		!strings.Contains(response.Content[0].Text, clientTimeoutText) {
+		t.Errorf("response = %q, want the client timeout warning first", mcptest.Text(response))
+	}
+
+	// A command killed by its timeout still says why it ran so long
+	response = h.CallTool(t, "bash", map[string]interface{}{"command": "sleep 10"})
+	if !response.IsError || !strings.Contains(mcptest.Text(response), clientTimeoutText) {
+		t.Errorf("timed-out response = %q, want the client timeout warning", mcptest.Text(response))
+	}
+
+	// A timeout within the client's limit needs no warning
+	response = h.CallTool(t, "bash", map[string]interface{}{"command": "echo hi", "timeout": 1})
+	if strings.Contains(mcptest.Text(response), clientTimeoutText) {
+		t.Errorf("response = %q, want no warning for a 1s timeout", mcptest.Text(response))
+	}
+}
+
+func TestAutoDetachLongCommands(t *testing.T) {
+	if _, err := bash.FindShell(bash.DefaultShell); err != nil {
+		t.Skip(err)
+	}
+	h := newTestServerWithConfig(t, &config.Config{CommandTimeout: 30, ClientRequestTimeoutSeconds: 1,
+		AutoDetachLongCommands: true, Enabled: true})
+	h.Initialize(t)
+
+	response := h.CallTool(t, "bash", map[string]interface{}{"command": "echo detached"})
+	if response.IsError || response.StructuredContent["autoDetached"] != true {
+		t.Fatalf("response = %q %v, want the command detached", mcptest.Text(response), response.StructuredContent)
+	}
+	if _, ok := response.StructuredContent["job"].(float64); !ok {
+		t.Errorf("structuredContent = %v, want a job ID", response.StructuredContent)
+	}
+	if !strings.Contains(mcptest.Text(response), "autoDetachLongCommands") {
+		t.Errorf("response = %q, want it to say why the command was detached", mcptest.Text(response))
+	}
+
+	// Opting out for one call: a timeout the client will wait for runs in
+	// the session
+	response = h.CallTool(t, "bash", map[string]interface{}{"command": "echo in session", "timeout": 1})
+	if _, detached := response.StructuredContent["autoDetached"]; detached ||
+		!strings.Contains(mcptest.Text(response), "in session") {
+		t.Errorf("response = %q %v, want the command run in the session", mcptest.Text(response),
+			response.StructuredContent)
+	}
+}
+
+func TestAutoDetachOffByDefault(t *testing.T) {
+	if _, err := bash.FindShell(bash.DefaultShell); err != nil {
+		t.Skip(err)
+	}
+	h := newTestServerWithConfig(t, &config.Config{CommandTimeout: 30, ClientRequestTimeoutSeconds: 1, Enabled: true})
+	h.Initialize(t)
+
+	response := h.CallTool(t, "bash", map[string]interface{}{"command": "echo in session"})
+	if _, detached := response.StructuredContent["autoDetached"]; detached ||
+		!strings.Contains(mcptest.Text(response), "in session") ||
+		!strings.Contains(mcptest.Text(response), clientTimeoutText) {
+		t.Errorf("response = %q %v, want the command run in the session with a warning", mcptest.Text(response),
+			response.StructuredContent)
+	}
+}
+
+func TestTimeoutInStructuredContent(t *testing.T) {
+	if _, err := bash.FindShell(bash.DefaultShell); err != nil {
+		t.Skip(err)
+	}
+	h := newTestServerWithConfig(t, &config.Config{CommandTimeout: 30, MaxTimeout: 60, Enabled: true})
+	h.Initialize(t)
+
+	tests := []struct {
+		args    map[string]interface{}
+		seconds float64
+		source  string
+	}{
+		{map[string]interface{}{"command": "true"}, 30, "default"},
+		{map[string]interface{}{"command": "true", "timeout": 45}, 45, "request"},
+		{map[string]interface{}{"command": "true", "timeout": 600}, 60, "cap"},
+	}
+	for _, tt := range tests {
+		response := h.CallTool(t, "bash", tt.args)
+		timeout, _ := response.StructuredContent["timeout"].(map[string]interface{})
+		if timeout["seconds"] != tt.seconds || timeout["source"] != tt.source || timeout["mode"] != "total" {
+			t.Errorf("%v: timeout = %v, want %vs from the %s", tt.args, timeout, tt.seconds, tt.source)
+		}
+	}
+
+	response := h.CallTool(t, "bash", map[string]interface{}{"command": "sleep 10", "timeout": 1})
+	timeout, _ := response.StructuredContent["timeout"].(map[string]interface{})
+	if !response.IsError || timeout["exceeded"] != "total" || timeout["seconds"] != float64(1) {
+		t.Errorf("timed-out command: timeout = %v, want the 1s total limit exceeded", timeout)
+	}
+}
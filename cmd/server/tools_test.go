@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/bash"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/config"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/mcp"
+)
+
+func TestToolsDeclareAnnotations(t *testing.T) {
+	if err := bash.ValidateTools(); err != nil {
+		t.Fatal(err)
+	}
+
+	h := newTestServer(t)
+	h.Initialize(t)
+	for _, tool := range h.ListTools(t) {
+		if tool.Annotations == nil || tool.Annotations.Title == "" {
+			t.Errorf("%s is listed without annotations", tool.Name)
+		}
+		if tool.Name == "read_file" && !tool.Annotations.ReadOnlyHint {
+			t.Errorf("read_file isn't marked read-only")
+		}
+		if tool.Name == "bash" && !tool.Annotations.DestructiveHint {
+			t.Errorf("bash isn't marked destructive")
+		}
+	}
+}
+
+func TestBashDescriptionReportsConfiguredTimeout(t *testing.T) {
+	h := newTestServerWithConfig(t, &config.Config{CommandTimeout: 45, Enabled: true})
+	h.Initialize(t)
+
+	for _, tool := range h.ListTools(t) {
+		if tool.Name != "bash" {
+			continue
+		}
+		if !strings.Contains(tool.Description, "after 45s by default") {
+			t.Errorf("description %q doesn't report the 45s timeout", tool.Description)
+		}
+		if strings.Contains(tool.Description, "120 seconds") {
+			t.Errorf("description still claims the old 120 second timeout")
+		}
+		return
+	}
+	t.Fatal("bash tool not listed")
+}
+
+func TestToolsListedInStableOrderWithIDs(t *testing.T) {
+	h := newTestServer(t)
+	h.Initialize(t)
+
+	first, second := h.ListTools(t), h.ListTools(t)
+	names := bash.BashTools.Names()
+	if len(first) != len(names) {
+		t.Fatalf("listed %d tools, want %d", len(first), len(names))
+	}
+	for i, tool := range first {
+		if tool.Name != names[i] || second[i].Name != names[i] {
+			t.Errorf("tool %d is %s then %s, want %s", i, tool.Name, second[i].Name, names[i])
+		}
+		if tool.Meta[toolIDMetaKey] != mcp.StableID(tool.Name) {
+			t.Errorf("%s has ID %v, want %s", tool.Name, tool.Meta[toolIDMetaKey], mcp.StableID(tool.Name))
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/config"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/mcp"
+)
+
+// auditWatermark is what the audit log records of a watermarked response:
+// the call's ID, whether its output was cut, and the hash of each text item
+// the markers enclose
+type auditWatermark struct {
+	ID         string   `json:"id"`
+	Partial    bool     `json:"partial,omitempty"`
+	TextHashes []string `json:"textHashes"`
+}
+
+// watermarker wraps the text items of tool responses in markers carrying a
+// new ID per call. It runs after truncation and the output budget, so the
+// markers are always paired; output that was cut is marked partial.
+// Structured content is left as it is.
+type watermarker struct {
+	tag string
+}
+
+// newWatermarker returns a watermarker, or nil if watermarking is off
+func newWatermarker(cfg *config.Config) *watermarker {
+	if tag := cfg.GetWatermarkTag(); tag != "" {
+		return &watermarker{tag: tag}
+	}
+	return nil
+}
+
+// apply wraps response's text and returns the watermark for the audit log.
+// A nil *watermarker does nothing.
+func (w *watermarker) apply(response *mcp.CallToolResponse, partial bool) (*auditWatermark, error) {
+	if w == nil {
+		return nil, nil
+	}
+	id, err := newWatermarkID()
+	if err != nil {
+		return nil, err
+	}
+	// Output stored for bash_output was cut from the response
+	if _, stored := response.StructuredContent["storedOutputs"]; stored {
+		partial = true
+	}
+
+	watermark := &auditWatermark{ID: id, Partial: partial, TextHashes: []string{}}
+	begin, end := w.markers(id, partial)
+	for i, item := range response.Content {
+		if item.Type != "text" {
+			continue
+		}
+		watermark.TextHashes = append(watermark.TextHashes, watermarkHash(item.Text))
+		response.Content[i].Text = begin + "\n" + item.Text + "\n" + end
+	}
+	return watermark, nil
+}
+
+// markers returns the markers put around the text of call id
+func (w *watermarker) markers(id string, partial bool) (string, string) {
+	end := "[/" + w.tag + " " + id + "]"
+	if partial {
+		end = "[/" + w.tag + " " + id + " partial]"
+	}
+	return "[" + w.tag + " " + id + "]", end
+}
+
+// newWatermarkID returns a random (version 4) UUID
+func newWatermarkID() (string, error) {
+	var raw [16]byte
+	if _, err := rand.Read(raw[:]); err != nil {
+		return "", err
+	}
+	raw[6] = raw[6]&0x0f | 0x40
+	raw[8] = raw[8]&0x3f | 0x80
+	text := hex.EncodeToString(raw[:])
+	return text[:8] + "-" + text[8:12] + "-" + text[12:16] + "-" + text[16:20] + "-" + text[20:], nil
+}
+
+// watermarkHash hashes the text one pair of markers encloses
+func watermarkHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Watermark verification outcomes
+const (
+	watermarkVerified = "verified"
+	watermarkAltered  = "altered"
+	watermarkUnknown  = "unknown"
+	watermarkUnpaired = "unpaired"
+)
+
+// watermarkBlock is one marked stretch of a document and what checking it
+// against the audit log found
+type watermarkBlock struct {
+	Line    int
+	ID      string
+	Partial bool
+	Status  string
+}
+
+// verifyWatermarks finds the marked text in doc and checks each block
+// against the watermarks in the audit log: the ID must be recorded, with
+// the same partial flag and the enclosed text's hash among its items.
+// Markers without a partner are reported as unpaired.
+func verifyWatermarks(doc, tag string, recorded map[string]auditWatermark) []watermarkBlock {
+	quoted := regexp.QuoteMeta(tag)
+	marker := regexp.MustCompile(`\[(/?)` + quoted + ` ([0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12})` +
+		`( partial)?\]`)
+
+	var blocks []watermarkBlock
+	matches := marker.FindAllStringSubmatchIndex(doc, -1)
+	lineOf := func(offset int) int { return strings.Count(doc[:offset], "\n") + 1 }
+	for i := 0; i < len(matches); i++ {
+		match := matches[i]
+		closing := match[3] > match[2]
+		id := doc[match[4]:match[5]]
+		if closing {
+			blocks = append(blocks, watermarkBlock{Line: lineOf(match[0]), ID: id, Status: watermarkUnpaired})
+			continue
+		}
+		var end []int
+		if i+1 < len(matches) {
+			next := matches[i+1]
+			if next[3] > next[2] && doc[next[4]:next[5]] == id {
+				end = next
+			}
+		}
+		if end == nil {
+			blocks = append(blocks, watermarkBlock{Line: lineOf(match[0]), ID: id, Status: watermarkUnpaired})
+			continue
+		}
+		i++
+
+		block := watermarkBlock{Line: lineOf(match[0]), ID: id, Partial: end[7] > end[6]}
+		text := doc[match[1]:end[0]]
+		text = strings.TrimSuffix(strings.TrimPrefix(text, "\n"), "\n")
+		watermark, ok := recorded[id]
+		switch {
+		case !ok:
+			block.Status = watermarkUnknown
+		case watermark.Partial != block.Partial || !slices.Contains(watermark.TextHashes, watermarkHash(text)):
+			block.Status = watermarkAltered
+		default:
+			block.Status = watermarkVerified
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+// readAuditWatermarks collects the watermarks recorded in audit log files
+func readAuditWatermarks(files []string) (map[string]auditWatermark, error) {
+	recorded := make(map[string]auditWatermark)
+	for _, path := range files {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		reader := bufio.NewReader(file)
+		for {
+			line, err := reader.ReadBytes('\n')
+			var entry struct {
+				Watermark *auditWatermark `json:"watermark"`
+			}
+			if json.Unmarshal(line, &entry) == nil && entry.Watermark != nil {
+				recorded[entry.Watermark.ID] = *entry.Watermark
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				file.Close()
+				return nil, err
+			}
+		}
+		file.Close()
+	}
+	return recorded, nil
+}
+
+// runVerifyWatermark checks the watermarks in the document at path against
+// the configured audit log for -verify-watermark, and returns the exit code
+func runVerifyWatermark(path string, cfg *config.Config) int {
+	tag := cfg.GetWatermarkTag()
+	if tag == "" || cfg.AuditLog == "" {
+		fmt.Fprintf(os.Stderr, "-verify-watermark needs watermark and auditLog configured\n")
+		return exitFailure
+	}
+	doc, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read %s: %v\n", path, err)
+		return exitFailure
+	}
+	files := []string{cfg.AuditLog}
+	if _, err := os.Stat(cfg.AuditLog + ".1"); err == nil {
+		files = []string{cfg.AuditLog + ".1", cfg.AuditLog}
+	}
+	recorded, err := readAuditWatermarks(files)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read audit log: %v\n", err)
+		return exitFailure
+	}
+
+	blocks := verifyWatermarks(string(doc), tag, recorded)
+	if len(blocks) == 0 {
+		fmt.Printf("%s has no %s watermarks\n", path, tag)
+		return exitOK
+	}
+	failed := 0
+	for _, block := range blocks {
+		partial := ""
+		if block.Partial {
+			partial = " (partial output)"
+		}
+		fmt.Printf("%s:%d: %s %s%s\n", path, block.Line, block.ID, block.Status, partial)
+		if block.Status != watermarkVerified {
+			failed++
+		}
+	}
+	if failed > 0 {
+		fmt.Printf("%d of %d watermarked blocks failed to verify\n", failed, len(blocks))
+		return exitFailure
+	}
+	fmt.Printf("All %d watermarked blocks verified\n", len(blocks))
+	return exitOK
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/config"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/mcp"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/mcptest"
+)
+
+// watermarkPairs checks every text item of response is enclosed in one
+// pair of markers for the same call, and returns the call's ID
+func watermarkPairs(t *testing.T, response mcp.CallToolResponse, tag string, partial bool) string {
+	t.Helper()
+	var id string
+	for _, item := range response.Content {
+		if item.Type != "text" {
+			continue
+		}
+		first, rest, _ := strings.Cut(item.Text, "\n")
+		if !strings.HasPrefix(first, "["+tag+" ") {
+			t.Fatalf("text %q doesn't start with a marker", item.Text)
+		}
+		itemID := strings.TrimSuffix(strings.TrimPrefix(first, "["+tag+" "), "]")
+		if id != "" && itemID != id {
+			t.Errorf("items of one call have IDs %s and %s", id, itemID)
+		}
+		id = itemID
+		end := "[/" + tag + " " + id + "]"
+		if partial {
+			end = "[/" + tag + " " + id + " partial]"
+		}
+		if !strings.HasSuffix(rest, "\n"+end) {
+			t.Errorf("text %q doesn't end with %s", item.Text, end)
+		}
+	}
+	return id
+}
+
+func TestWatermarkApply(t *testing.T) {
+	w := newWatermarker(&config.Config{Watermark: &config.WatermarkConfig{}})
+	response := mcp.CallToolResponse{
+		Content: []mcp.ContentItem{
+			{Type: "text", Text: "warning"},
+			{Type: "text", Text: "output\n"},
+			mcp.ResourceLink(mcp.Resource{URI: "bash-output://x", Name: "x"}),
+		},
+		StructuredContent: map[string]interface{}{"exitCode": 0},
+	}
+	mark, err := w.apply(&response, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := watermarkPairs(t, response, "bash-output", false)
+	if mark.ID != id || mark.Partial || len(mark.TextHashes) != 2 {
+		t.Errorf("watermark = %+v, want ID %s and a hash per text item", mark, id)
+	}
+	if response.Content[2].Text != "" {
+		t.Errorf("a resource link was marked")
+	}
+	if data, _ := json.Marshal(response.StructuredContent); strings.Contains(string(data), id) {
+		t.Errorf("structured content was marked: %s", data)
+	}
+
+	// Output stored for bash_output was cut, so the markers say so
+	response = mcp.CallToolResponse{
+		Content:           []mcp.ContentItem{{Type: "text", Text: "head of the output"}},
+		StructuredContent: map[string]interface{}{"storedOutputs": []string{"x"}},
+	}
+	if mark, _ := w.apply(&response, false); !mark.Partial {
+		t.Errorf("truncated output wasn't marked partial")
+	}
+	watermarkPairs(t, response, "bash-output", true)
+
+	var none *watermarker
+	response = mcp.CallToolResponse{Content: []mcp.ContentItem{{Type: "text", Text: "plain"}}}
+	if mark, _ := none.apply(&response, false); mark != nil || response.Content[0].Text != "plain" {
+		t.Errorf("watermarking off still marked the text")
+	}
+}
+
+func TestWatermarkSurvivesOutputBudget(t *testing.T) {
+	cfg := &config.Config{CommandTimeout: 30, Enabled: true, OutputBudgetBytes: 200,
+		Watermark: &config.WatermarkConfig{Tag: "shell"}}
+	h := newTestServerWithConfig(t, cfg)
+	h.Initialize(t)
+
+	response := h.CallTool(t, "bash", map[string]interface{}{"command": "seq 1 1000"})
+	if !strings.Contains(mcptest.Text(response), "output budget") {
+		t.Fatalf("the budget didn't cut the output: %q", mcptest.Text(response))
+	}
+	watermarkPairs(t, response, "shell", true)
+}
+
+func TestVerifyWatermarks(t *testing.T) {
+	w := &watermarker{tag: "bash-output"}
+	recorded := map[string]auditWatermark{}
+	var doc strings.Builder
+	doc.WriteString("Notes written by hand.\n\n")
+	var ids []string
+	for _, text := range []string{"first output", "second output"} {
+		response := mcp.CallToolResponse{Content: []mcp.ContentItem{{Type: "text", Text: text}}}
+		mark, err := w.apply(&response, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorded[mark.ID] = *mark
+		ids = append(ids, mark.ID)
+		doc.WriteString(response.Content[0].Text + "\n\nMore notes.\n")
+	}
+
+	// A synthetic audit log, as the server writes it
+	auditPath := filepath.Join(t.TempDir(), "audit.log")
+	var log strings.Builder
+	for _, id := range ids {
+		mark := recorded[id]
+		line, _ := json.Marshal(auditEntry{Tool: "bash", Watermark: &mark})
+		log.Write(append(line, '\n'))
+	}
+	log.WriteString(`{"tool":"bash","isError":false}` + "\n")
+	if err := os.WriteFile(auditPath, []byte(log.String()), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fromLog, err := readAuditWatermarks([]string{auditPath})
+	if err != nil || len(fromLog) != 2 {
+		t.Fatalf("read %d watermarks, %v; want 2", len(fromLog), err)
+	}
+
+	statuses := func(doc string) string {
+		var got []string
+		for _, block := range verifyWatermarks(doc, "bash-output", fromLog) {
+			got = append(got, block.Status)
+		}
+		return strings.Join(got, ",")
+	}
+	original := doc.String()
+	tests := map[string]struct {
+		doc  string
+		want string
+	}{
+		"intact": {original, "verified,verified"},
+		"edited": {strings.Replace(original, "second output", "second 0utput", 1), "verified,altered"},
+		"marked partial": {strings.Replace(original, "[/bash-output "+ids[0]+"]",
+			"[/bash-output "+ids[0]+" partial]", 1), "altered,verified"},
+		"unknown call": {strings.ReplaceAll(original, ids[1], "00000000-0000-4000-8000-000000000000"),
+			"verified,unknown"},
+		"end removed": {strings.Replace(original, "[/bash-output "+ids[0]+"]", "", 1), "unpaired,verified"},
+		"begin removed": {strings.Replace(original, "[bash-output "+ids[1]+"]", "", 1),
+			"verified,unpaired"},
+	}
+	for name, test := range tests {
+		if got := statuses(test.doc); got != test.want {
+			t.Errorf("%s: statuses = %s, want %s", name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package bash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrBudgetExhausted is wrapped by the BudgetError for a command refused
+// because the admission budget had no room for it
+var ErrBudgetExhausted = errors.New("resource budget exhausted")
+
+// HeavyPattern marks commands matching Pattern as heavy: each reserves Units
+// from the admission budget while it runs. Label names them to other
+// commands kept waiting.
+type HeavyPattern struct {
+	Pattern *regexp.Regexp
+	Units   int
+	Label   string
+}
+
+// AdmissionOptions configures an Admission
+type AdmissionOptions struct {
+	Units   int           // the budget shared by all commands
+	MaxWait time.Duration // how long a command waits for units (0 = refuse at once)
+	Heavy   []HeavyPattern
+}
+
+// Admission limits how many heavy commands run at once, so that several
+// memory-hungry builds started in parallel (a session command alongside
+// bypassSession and exec calls) can't exhaust the host between them. Each
+// heavy command reserves units from a fixed budget before it runs and
+// returns them when it finishes, however it finishes. Commands that find
+// the budget short wait their turn, in arrival order, for up to MaxWait.
+type Admission struct {
+	mutex    sync.Mutex
+	capacity int
+	inUse    int
+	maxWait  time.Duration
+	heavy    []HeavyPattern
+	holders  map[*reservation]struct{}
+	waiting  []*reservation
+}
+
+// reservation is one command's claim on the budget
+type reservation struct {
+	units   int
+	label   string
+	since   time.Time
+	granted chan struct{} // closed once the units are reserved
+}
+
+// BudgetError reports a command refused for lack of budget: the units it
+// needed, those in use when it gave up, and the commands holding them
+type BudgetError struct {
+	Units    int
+	InUse    int
+	Capacity int
+	Holders  []string
+	Waited   time.Duration
+}
+
+func (e *BudgetError) Error() string {
+	holders := "other commands"
+	if len(e.Holders) > 0 {
+		holders = "[" + strings.Join(e.Holders, ", ") + "]"
+	}
+	return fmt.Sprintf("%v: needs %s, %d of %d in use by %s", ErrBudgetExhausted, unitCount(e.Units), e.InUse,
+		e.Capacity, holders)
+}
+
+// unitCount formats n as "1 unit" or "n units"
+func unitCount(n int) string {
+	if n == 1 {
+		return "1 unit"
+	}
+	return fmt.Sprintf("%d units", n)
+}
+
+func (e *BudgetError) Unwrap() error {
+	return ErrBudgetExhausted
+}
+
+// AdmissionHolder describes a command holding units, for server_stats
+type AdmissionHolder struct {
+	Label string    `json:"label"`
+	Units int       `json:"units"`
+	Since time.Time `json:"since"`
+}
+
+// AdmissionStatus is a snapshot of the budget
+type AdmissionStatus struct {
+	Units   int               `json:"units"`
+	InUse   int               `json:"inUse"`
+	Waiting int               `json:"waiting"`
+	Holders []AdmissionHolder `json:"holders"`
+}
+
+// NewAdmission creates an admission controller with the given budget
+func NewAdmission(opts AdmissionOptions) *Admission {
+	return &Admission{
+		capacity: opts.Units,
+		maxWait:  opts.MaxWait,
+		heavy:    opts.Heavy,
+		holders:  make(map[*reservation]struct{}),
+	}
+}
+
+// Weigh returns the units command needs and, when a pattern decided, that
+// pattern's label. An explicit weight wins over the patterns, and leaves the
+// label to the caller; otherwise the first matching pattern decides. A
+// command that matches none needs no units.
+func (a *Admission) Weigh(command string, weight *int) (int, string) {
+	if weight != nil {
+		return *weight, ""
+	}
+	for _, heavy := range a.heavy {
+		if heavy.Pattern.MatchString(command) {
+			return heavy.Units, heavy.Label
+		}
+	}
+	return 0, ""
+}
+
+// Reserve waits until units are free and reserves them under label,
+// returning the function that gives them back. The release function may be
+// called more than once; only the first call counts. Reserving 0 units
+// always succeeds at once. Fails with a *BudgetError if the units aren't
+// free within MaxWait, or with ErrCommandCancelled if ctx ends first.
+func (a *Admission) Reserve(ctx context.Context, units int, label string) (func(), error) {
+	if units <= 0 {
+		return func() {}, nil
+	}
+	if units > a.capacity {
+		return nil, fmt.Errorf("command needs %s, more than the whole budget of %d", unitCount(units), a.capacity)
+	}
+
+	r := &reservation{units: units, label: label, granted: make(chan struct{})}
+	a.mutex.Lock()
+	a.waiting = append(a.waiting, r)
+	a.dispatch()
+	a.mutex.Unlock()
+
+	started := time.Now()
+	select {
+	case <-r.granted:
+	default:
+		timer := time.NewTimer(a.maxWait)
+		defer timer.Stop()
+		var err error
+		select {
+		case <-r.granted:
+		case <-timer.C:
+			err = ErrBudgetExhausted
+		case <-ctx.Done():
+			err = ErrCommandCancelled
+		}
+		if err != nil && !a.withdraw(r) {
+			// Granted as the wait ended; hand the units back
+			a.release(r)
+		}
+		if err == ErrBudgetExhausted {
+			return nil, a.exhausted(units, time.Since(started))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var once sync.Once
+	return func() { once.Do(func() { a.release(r) }) }, nil
+}
+
+// dispatch grants waiting reservations, first come first served, while the
+// one at the head fits. A large reservation is never overtaken by smaller
+// ones behind it, so it can't be starved. Caller must hold mutex.
+func (a *Admission) dispatch() {
+	for len(a.waiting) > 0 {
+		next := a.waiting[0]
+		if a.inUse+next.units > a.capacity {
+			return
+		}
+		a.waiting = a.waiting[1:]
+		a.inUse += next.units
+		next.since = time.Now()
+		a.holders[next] = struct{}{}
+		close(next.granted)
+	}
+}
+
+// withdraw takes a reservation that is still waiting out of the queue,
+// reporting false if it was granted first
+func (a *Admission) withdraw(r *reservation) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for i, waiting := range a.waiting {
+		if waiting == r {
+			a.waiting = append(a.waiting[:i], a.waiting[i+1:]...)
+			// Those behind it may fit now
+			a.dispatch()
+			return true
+		}
+	}
+	return false
+}
+
+// release returns a granted reservation's units and admits whoever they let
+// in
+func (a *Admission) release(r *reservation) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if _, ok := a.holders[r]; !ok {
+		return
+	}
+	delete(a.holders, r)
+	a.inUse -= r.units
+	a.dispatch()
+}
+
+// exhausted describes the budget for a command that gave up waiting
+func (a *Admission) exhausted(units int, waited time.Duration) *BudgetError {
+	status := a.Status()
+	err := &BudgetError{Units: units, InUse: status.InUse, Capacity: status.Units, Waited: waited}
+	for _, holder := range status.Holders {
+		err.Holders = append(err.Holders, fmt.Sprintf("%s (%d)", holder.Label, holder.Units))
+	}
+	return err
+}
+
+// Status returns the budget, the commands holding units, oldest first, and
+// how many are waiting
+func (a *Admission) Status() AdmissionStatus {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	status := AdmissionStatus{
+		Units:   a.capacity,
+		InUse:   a.inUse,
+		Waiting: len(a.waiting),
+		Holders: []AdmissionHolder{},
+	}
+	for r := range a.holders {
+		status.Holders = append(status.Holders, AdmissionHolder{Label: r.label, Units: r.units, Since: r.since})
+	}
+	sort.Slice(status.Holders, func(i, j int) bool {
+		return status.Holders[i].Since.Before(status.Holders[j].Since)
+	})
+	return status
+}
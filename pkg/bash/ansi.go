@@ -0,0 +1,132 @@
+package bash
+
+import "strings"
+
+const esc = 0x1b
+
+// StripANSI removes ANSI escape sequences (CSI, OSC and the two- and
+// three-byte ESC forms) from command output and collapses lines redrawn with
+// carriage returns or backspaces, such as progress bars, to what a terminal
+// would finally show. An erase-line sequence (ESC [ K) is applied rather than
+// dropped, since redraws often rely on it.
+func StripANSI(s string) string {
+	if !strings.ContainsAny(s, "\x1b\r\b") {
+		return s
+	}
+
+	var out strings.Builder
+	out.Grow(len(s))
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if i > 0 {
+			out.WriteByte('\n')
+		}
+		out.WriteString(renderLine(line))
+	}
+	return out.String()
+}
+
+// renderLine plays one line of output as a terminal would
+func renderLine(line string) string {
+	if !strings.ContainsAny(line, "\x1b\r\b") {
+		return line
+	}
+
+	runes := []rune(line)
+	var screen []rune
+	cursor := 0
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; r {
+		case '\r':
+			cursor = 0
+		case '\b':
+			if cursor > 0 {
+				cursor--
+			}
+		case esc:
+			var final rune
+			var params string
+			i, final, params = skipEscape(runes, i)
+			if final == 'K' {
+				switch params {
+				case "", "0":
+					screen = screen[:min(cursor, len(screen))]
+				case "2":
+					screen = screen[:0]
+				}
+			}
+		default:
+			if cursor < len(screen) {
+				screen[cursor] = r
+			} else {
+				for len(screen) < cursor {
+					screen = append(screen, ' ')
+				}
+				screen = append(screen, r)
+			}
+			cursor++
+		}
+	}
+	return string(screen)
+}
+
+// skipEscape skips the escape sequence starting at runes[i] and returns the
+// index of its last rune. For a CSI sequence it also returns the final
+// character and parameters.
+func skipEscape(runes []rune, i int) (int, rune, string) {
+	if i+1 >= len(runes) {
+		return i, 0, ""
+	}
+	switch runes[i+1] {
+	case '[': // CSI: parameters and intermediates, then a final byte
+		for j := i + 2; j < len(runes); j++ {
+			if runes[j] >= 0x40 && runes[j] <= 0x7e {
+				return j, runes[j], string(runes[i+2 : j])
+			}
+		}
+		return len(runes) - 1, 0, ""
+	case ']': // OSC: ends with BEL or ESC \
+		for j := i + 2; j < len(runes); j++ {
+			if runes[j] == 0x07 {
+				return j, 0, ""
+			}
+			if runes[j] == esc && j+1 < len(runes) && runes[j+1] == '\\' {
+				return j + 1, 0, ""
+			}
+		}
+		return len(runes) - 1, 0, ""
+	}
+	// ESC, optional intermediates (e.g. "(" selecting a character set),
+	// then a final byte
+	j := i + 1
+	for j < len(runes)-1 && runes[j] >= 0x20 && runes[j] <= 0x2f {
+		j++
+	}
+	return j, 0, ""
+}
+
+// noColorEnv holds the variables that ask tools not to emit colors
+var noColorEnv = map[string]string{"TERM": "dumb", "NO_COLOR": "1"}
+
+// WithNoColor returns env plus the variables that ask tools not to emit
+// colors, for a command run with strip_ansi in a session without them.
+// Variables already in env are left alone.
+func WithNoColor(env map[string]string) map[string]string {
+	merged := make(map[string]string, len(env)+len(noColorEnv))
+	for name, value := range noColorEnv {
+		merged[name] = value
+	}
+	for name, value := range env {
+		merged[name] = value
+	}
+	return merged
+}
+
+// appendNoColor appends the no-color variables to a process environment.
+// Later entries win, so they override TERM inherited from the server.
+func appendNoColor(env []string) []string {
+	for name, value := range noColorEnv {
+		env = append(env, name+"="+value)
+	}
+	return env
+}
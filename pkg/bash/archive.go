@@ -0,0 +1,331 @@
+package bash
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Archive formats ExtractArchive understands
+const (
+	ArchiveTar      = "tar"
+	ArchiveTarGzip  = "tar.gz"
+	ArchiveTarBzip2 = "tar.bz2"
+	ArchiveZip      = "zip"
+)
+
+// errArchiveTooLarge is returned when extraction would exceed its size limit
+var errArchiveTooLarge = errors.New("archive expands beyond the size limit")
+
+// DetectArchive names the format of the archive at path from its first
+// bytes, or returns "" if it isn't one ExtractArchive understands
+func DetectArchive(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	head = head[:n]
+
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return ArchiveZip, nil
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return ArchiveTarGzip, nil
+	case bytes.HasPrefix(head, []byte("BZh")):
+		return ArchiveTarBzip2, nil
+	case len(head) >= 262 && string(head[257:262]) == "ustar":
+		return ArchiveTar, nil
+	}
+	return "", nil
+}
+
+// ExtractArchive unpacks the archive at path, of the given format, into dir,
+// which must exist, and returns the number of files written. Entries that
+// would land outside dir, hard links, and device files are refused; so are
+// symlinks pointing outside dir. Permission bits are kept, setuid and the
+// like dropped. Extraction stops once more than limit bytes (if positive) have
+// been written, so a small archive can't fill the disk.
+func ExtractArchive(path, format, dir string, limit int64) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	// Containment checks compare real paths
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		return 0, err
+	}
+	x := &extractor{dir: dir, remaining: limit, limited: limit > 0}
+	switch format {
+	case ArchiveZip:
+		info, statErr := file.Stat()
+		if statErr != nil {
+			return 0, statErr
+		}
+		err = x.zip(file, info.Size())
+	case ArchiveTarGzip:
+		gz, gzErr := gzip.NewReader(bufio.NewReader(file))
+		if gzErr != nil {
+			return 0, fmt.Errorf("invalid gzip data: %w", gzErr)
+		}
+		defer gz.Close()
+		err = x.tar(gz)
+	case ArchiveTarBzip2:
+		err = x.tar(bzip2.NewReader(bufio.NewReader(file)))
+	case ArchiveTar:
+		err = x.tar(bufio.NewReader(file))
+	default:
+		return 0, fmt.Errorf("unsupported archive format %q", format)
+	}
+	if err == nil {
+		err = x.links()
+	}
+	return x.files, err
+}
+
+// extractor writes archive entries under dir
+type extractor struct {
+	dir       string
+	remaining int64
+	limited   bool
+	files     int
+	symlinks  []archiveLink // created once every other entry is written
+}
+
+// archiveLink is a symlink entry waiting to be created
+type archiveLink struct {
+	name   string // as named in the archive
+	path   string
+	target string
+}
+
+// tar extracts a tar stream
+func (x *extractor) tar(r io.Reader) error {
+	reader := tar.NewReader(r)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid tar data: %w", err)
+		}
+
+		mode := os.FileMode(header.Mode).Perm()
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = x.mkdir(header.Name)
+		case tar.TypeReg, tar.TypeRegA:
+			err = x.writeFile(header.Name, mode, reader)
+		case tar.TypeSymlink:
+			err = x.symlink(header.Name, header.Linkname)
+		case tar.TypeXGlobalHeader:
+			// Metadata only
+		default:
+			err = fmt.Errorf("refusing archive entry %s: unsupported type %q", header.Name, header.Typeflag)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// zip extracts a zip file
+func (x *extractor) zip(r io.ReaderAt, size int64) error {
+	reader, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("invalid zip data: %w", err)
+	}
+	for _, entry := range reader.File {
+		mode := entry.Mode()
+		switch {
+		case mode.IsDir():
+			err = x.mkdir(entry.Name)
+		case mode&os.ModeSymlink != 0:
+			err = x.zipSymlink(entry)
+		case mode.IsRegular():
+			err = x.zipFile(entry)
+		default:
+			err = fmt.Errorf("refusing archive entry %s: unsupported file type", entry.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// zipFile extracts a regular file from a zip
+func (x *extractor) zipFile(entry *zip.File) error {
+	content, err := entry.Open()
+	if err != nil {
+		return fmt.Errorf("archive entry %s: %w", entry.Name, err)
+	}
+	defer content.Close()
+	return x.writeFile(entry.Name, entry.Mode().Perm(), content)
+}
+
+// zipSymlink extracts a symlink from a zip, whose content is the target
+func (x *extractor) zipSymlink(entry *zip.File) error {
+	content, err := entry.Open()
+	if err != nil {
+		return fmt.Errorf("archive entry %s: %w", entry.Name, err)
+	}
+	defer content.Close()
+	target, err := io.ReadAll(io.LimitReader(content, 4096))
+	if err != nil {
+		return fmt.Errorf("archive entry %s: %w", entry.Name, err)
+	}
+	return x.symlink(entry.Name, string(target))
+}
+
+// target returns where an entry named name is written, refusing names that
+// leave the directory
+func (x *extractor) target(name string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("refusing archive entry %s: it leaves the destination", name)
+	}
+	path := filepath.Join(x.dir, clean)
+
+	// Symlinks extracted earlier must not lead outside either
+	existing := filepath.Dir(path)
+	for {
+		resolved, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			if !x.contains(resolved) {
+				return "", fmt.Errorf("refusing archive entry %s: it leaves the destination through a symlink", name)
+			}
+			return path, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		existing = filepath.Dir(existing)
+	}
+}
+
+// contains reports whether path is the directory or under it
+func (x *extractor) contains(path string) bool {
+	return path == x.dir || strings.HasPrefix(path, x.dir+string(filepath.Separator))
+}
+
+// mkdir creates a directory entry
+func (x *extractor) mkdir(name string) error {
+	path, err := x.target(name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(path, 0755)
+}
+
+// writeFile writes a regular file entry, charging it against the limit
+func (x *extractor) writeFile(name string, mode os.FileMode, content io.Reader) error {
+	path, err := x.target(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// A symlink left by an earlier entry must not redirect the write
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("refusing archive entry %s: it would write through a symlink", name)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode|0200)
+	if err != nil {
+		return err
+	}
+	if x.limited {
+		content = io.LimitReader(content, x.remaining+1)
+	}
+	written, err := io.Copy(file, content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("archive entry %s: %w", name, err)
+	}
+	if x.limited {
+		if written > x.remaining {
+			return errArchiveTooLarge
+		}
+		x.remaining -= written
+	}
+	x.files++
+	return nil
+}
+
+// symlink records a symlink entry whose target stays inside the directory.
+// Links are only created once every other entry is written, so no entry can
+// be written through one.
+func (x *extractor) symlink(name, linkname string) error {
+	path, err := x.target(name)
+	if err != nil {
+		return err
+	}
+	resolved := filepath.Join(filepath.Dir(path), filepath.FromSlash(linkname))
+	if filepath.IsAbs(linkname) || !x.contains(resolved) {
+		return fmt.Errorf("refusing archive entry %s: its link target %s leaves the destination", name, linkname)
+	}
+	x.symlinks = append(x.symlinks, archiveLink{name: name, path: path, target: linkname})
+	return nil
+}
+
+// links creates the recorded symlinks, then checks where each really leads.
+// One link can change where another goes (a link to "." makes a later
+// "link/../x" climb out), which checking each target's text can't see, so
+// if any leads outside the directory they are all removed.
+func (x *extractor) links() error {
+	for i, link := range x.symlinks {
+		err := os.MkdirAll(filepath.Dir(link.path), 0755)
+		if err == nil {
+			err = os.Symlink(link.target, link.path)
+		}
+		if err != nil {
+			x.removeLinks(x.symlinks[:i])
+			return fmt.Errorf("archive entry %s: %w", link.name, err)
+		}
+	}
+
+	inside := &AllowedRoots{roots: []string{x.dir}}
+	for _, link := range x.symlinks {
+		// Resolved the way the kernel would, from the link's real directory
+		parent, err := filepath.EvalSymlinks(filepath.Dir(link.path))
+		if err == nil {
+			_, err = inside.Check(parent + string(filepath.Separator) + filepath.FromSlash(link.target))
+		}
+		if err != nil {
+			x.removeLinks(x.symlinks)
+			return fmt.Errorf("refusing archive entry %s: its link target %s leaves the destination",
+				link.name, link.target)
+		}
+	}
+	return nil
+}
+
+// removeLinks deletes symlinks created from the archive
+func (x *extractor) removeLinks(links []archiveLink) {
+	for _, link := range links {
+		os.Remove(link.path)
+	}
+}
@@ -0,0 +1,200 @@
+package bash
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// tarEntry is one entry of a test archive
+type tarEntry struct {
+	name     string
+	typeflag byte
+	mode     int64
+	content  string
+	linkname string
+}
+
+// writeTar writes entries as a tar (gzipped if compress is set) and returns
+// the archive's path
+func writeTar(t *testing.T, compress bool, entries ...tarEntry) string {
+	t.Helper()
+	var buf bytes.Buffer
+	var gz *gzip.Writer
+	w := tar.NewWriter(&buf)
+	if compress {
+		gz = gzip.NewWriter(&buf)
+		w = tar.NewWriter(gz)
+	}
+	for _, entry := range entries {
+		mode := entry.mode
+		if mode == 0 {
+			mode = 0644
+		}
+		header := &tar.Header{Name: entry.name, Typeflag: entry.typeflag, Mode: mode,
+			Size: int64(len(entry.content)), Linkname: entry.linkname, Format: tar.FormatPAX}
+		if entry.typeflag != tar.TypeReg {
+			header.Size = 0
+		}
+		if err := w.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if entry.typeflag == tar.TypeReg {
+			w.Write([]byte(entry.content))
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if gz != nil {
+		gz.Close()
+	}
+	path := filepath.Join(t.TempDir(), "archive")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// extractTo extracts archive into a new directory, returning the directory
+func extractTo(t *testing.T, archive, format string, limit int64) (string, int, error) {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "out")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files, err := ExtractArchive(archive, format, dir, limit)
+	return dir, files, err
+}
+
+func TestExtractTar(t *testing.T) {
+	archive := writeTar(t, true,
+		tarEntry{name: "pkg/", typeflag: tar.TypeDir, mode: 0755},
+		tarEntry{name: "pkg/bin/tool", typeflag: tar.TypeReg, mode: 04755, content: "#!/bin/sh\n"},
+		tarEntry{name: "pkg/README", typeflag: tar.TypeReg, content: "hello"},
+		tarEntry{name: "pkg/docs", typeflag: tar.TypeSymlink, linkname: "README"},
+		tarEntry{name: "pkg/bin/readme", typeflag: tar.TypeSymlink, linkname: "../README"},
+	)
+	if format, err := DetectArchive(archive); err != nil || format != ArchiveTarGzip {
+		t.Fatalf("DetectArchive = %q, %v", format, err)
+	}
+
+	dir, files, err := extractTo(t, archive, ArchiveTarGzip, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files != 2 {
+		t.Errorf("files = %d, want 2", files)
+	}
+	info, err := os.Stat(filepath.Join(dir, "pkg/bin/tool"))
+	if err != nil || info.Mode() != 0755 {
+		t.Errorf("tool mode = %v, %v; want 0755 with setuid dropped", info.Mode(), err)
+	}
+	for _, link := range []string{"pkg/docs", "pkg/bin/readme"} {
+		if data, err := os.ReadFile(filepath.Join(dir, link)); err != nil || string(data) != "hello" {
+			t.Errorf("%s = %q, %v; want the README through the link", link, data, err)
+		}
+	}
+}
+
+func TestExtractRefusesEscapes(t *testing.T) {
+	tests := map[string][]tarEntry{
+		"parent path":   {{name: "../evil", typeflag: tar.TypeReg, content: "x"}},
+		"absolute path": {{name: "/tmp/evil", typeflag: tar.TypeReg, content: "x"}},
+		"hard link":     {{name: "passwd", typeflag: tar.TypeLink, linkname: "/etc/passwd"}},
+		"device":        {{name: "null", typeflag: tar.TypeChar}},
+		"absolute link": {{name: "etc", typeflag: tar.TypeSymlink, linkname: "/etc"}},
+		"link upwards":  {{name: "up", typeflag: tar.TypeSymlink, linkname: "../outside"}},
+		"link via a link to .": {
+			{name: "d", typeflag: tar.TypeSymlink, linkname: "."},
+			{name: "d/escape", typeflag: tar.TypeSymlink, linkname: "../outside"},
+		},
+		"link via a link in its target": {
+			{name: "sub/", typeflag: tar.TypeDir, mode: 0755},
+			{name: "sub/self", typeflag: tar.TypeSymlink, linkname: "."},
+			{name: "sub/escape", typeflag: tar.TypeSymlink, linkname: "self/../../../outside"},
+		},
+		"write through a link": {
+			{name: "sub/", typeflag: tar.TypeDir, mode: 0755},
+			{name: "alias", typeflag: tar.TypeSymlink, linkname: "sub"},
+			{name: "alias/file", typeflag: tar.TypeReg, content: "x"},
+		},
+	}
+	for name, entries := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir, _, err := extractTo(t, writeTar(t, false, entries...), ArchiveTar, 0)
+			if err == nil {
+				t.Fatal("archive extracted")
+			}
+			// Nothing left behind leads out
+			filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+				if err != nil || info.Mode()&os.ModeSymlink == 0 {
+					return nil
+				}
+				if real, err := filepath.EvalSymlinks(path); err == nil && !strings.HasPrefix(real, dir) {
+					t.Errorf("%s leads out to %s", path, real)
+				}
+				return nil
+			})
+			if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "evil")); err == nil {
+				t.Errorf("file written outside the destination")
+			}
+		})
+	}
+}
+
+func TestExtractSizeLimit(t *testing.T) {
+	archive := writeTar(t, true,
+		tarEntry{name: "a", typeflag: tar.TypeReg, content: strings.Repeat("a", 600)},
+		tarEntry{name: "b", typeflag: tar.TypeReg, content: strings.Repeat("b", 600)},
+	)
+	if _, _, err := extractTo(t, archive, ArchiveTarGzip, 1000); !errors.Is(err, errArchiveTooLarge) {
+		t.Errorf("err = %v, want the size limit", err)
+	}
+	if _, files, err := extractTo(t, archive, ArchiveTarGzip, 1200); err != nil || files != 2 {
+		t.Errorf("within the limit: %d files, %v", files, err)
+	}
+}
+
+func TestExtractZip(t *testing.T) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	file, _ := w.Create("dir/file.txt")
+	file.Write([]byte("zipped"))
+	header := &zip.FileHeader{Name: "dir/link"}
+	header.SetMode(os.ModeSymlink | 0777)
+	link, _ := w.CreateHeader(header)
+	link.Write([]byte("file.txt"))
+	w.Close()
+
+	archive := filepath.Join(t.TempDir(), "archive.zip")
+	if err := os.WriteFile(archive, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if format, _ := DetectArchive(archive); format != ArchiveZip {
+		t.Fatalf("DetectArchive = %q", format)
+	}
+	dir, files, err := extractTo(t, archive, ArchiveZip, 0)
+	if err != nil || files != 1 {
+		t.Fatalf("extracted %d files, %v", files, err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "dir/link")); err != nil || string(data) != "zipped" {
+		t.Errorf("link = %q, %v", data, err)
+	}
+}
+
+func TestDetectArchiveUnknown(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plain.txt")
+	if err := os.WriteFile(path, []byte("just text"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if format, err := DetectArchive(path); err != nil || format != "" {
+		t.Errorf("DetectArchive = %q, %v; want no format", format, err)
+	}
+}
@@ -0,0 +1,274 @@
+package bash
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxArtifacts is how many files one collectArtifacts call registers
+	MaxArtifacts = 50
+
+	// MaxArtifactBytes is the total size of the files one collectArtifacts
+	// call registers
+	MaxArtifactBytes = 64 * 1024 * 1024 // 64MB
+
+	// ArtifactURIScheme is the scheme of the URIs collected artifacts are
+	// served under as MCP resources
+	ArtifactURIScheme = "bash-artifact://"
+)
+
+// ErrUnknownArtifact is returned for an artifact URI that isn't registered
+var ErrUnknownArtifact = errors.New("unknown artifact")
+
+// Artifact is a file collected after a command and served as an MCP
+// resource
+type Artifact struct {
+	URI      string `json:"uri"`
+	Name     string `json:"name"` // the path relative to where it was collected
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+
+	created time.Time
+}
+
+// artifactStore holds the files registered with collectArtifacts. Like
+// stored output, entries expire after ttl and are dropped when the session
+// restarts. The files themselves are read when the resource is, not copied.
+type artifactStore struct {
+	mutex   sync.Mutex
+	entries map[string]Artifact // by URI
+	ttl     time.Duration
+}
+
+// add registers an artifact. Caller must hold mutex.
+func (s *artifactStore) add(artifact Artifact) {
+	if s.entries == nil {
+		s.entries = make(map[string]Artifact)
+	}
+	s.entries[artifact.URI] = artifact
+}
+
+// expire drops entries older than the TTL. Caller must hold mutex.
+func (s *artifactStore) expire() {
+	for uri, artifact := range s.entries {
+		if time.Since(artifact.created) > s.ttl {
+			delete(s.entries, uri)
+		}
+	}
+}
+
+// clear drops every registered artifact
+func (s *artifactStore) clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.entries = nil
+}
+
+// CollectArtifacts registers the files matching patterns as resources.
+// Patterns are globs relative to dir, a working_directory argument ("" for
+// the session's current directory); in a path jail absolute ones start at
+// its root. allow, if set, may refuse a file by its real path. Files leaving
+// the jail or the allowed roots, directories and other non-regular files are
+// skipped, as is everything past MaxArtifacts files or MaxArtifactBytes in
+// all. Patterns matching nothing, and files skipped, are reported as
+// warnings.
+func (bm *BashManager) CollectArtifacts(dir string, patterns []string,
+	allow func(path string) error) ([]Artifact, []string) {
+	if dir == "" {
+		dir = bm.WorkingDirectory()
+	}
+	dir, err := bm.resolveDirectory(dir)
+	if err != nil {
+		return nil, []string{fmt.Sprintf("collectArtifacts: nothing collected: %v", err)}
+	}
+
+	var artifacts []Artifact
+	var warnings []string
+	var total int64
+	seen := make(map[string]bool)
+
+	for _, pattern := range patterns {
+		glob := pattern
+		if !filepath.IsAbs(glob) {
+			glob = filepath.Join(dir, glob)
+		} else if bm.jail != nil {
+			glob = filepath.Join(bm.jail.root, glob)
+		}
+		matches, err := filepath.Glob(glob)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("collectArtifacts: invalid pattern %q", pattern))
+			continue
+		}
+		if len(matches) == 0 {
+			warnings = append(warnings, fmt.Sprintf("collectArtifacts: %q matched no files", pattern))
+			continue
+		}
+
+		for _, match := range matches {
+			path, err := bm.artifactPath(match)
+			if err == nil && allow != nil {
+				err = allow(path)
+			}
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("collectArtifacts: skipped %s: %v", match, err))
+				continue
+			}
+			info, err := os.Stat(path)
+			if err != nil || !info.Mode().IsRegular() {
+				// Directories matched by a broad pattern aren't worth a warning
+				continue
+			}
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+
+			if len(artifacts) == MaxArtifacts {
+				warnings = append(warnings, fmt.Sprintf("collectArtifacts: skipped %s: only %d files are collected "+
+					"per call", match, MaxArtifacts))
+				continue
+			}
+			if total+info.Size() > MaxArtifactBytes {
+				warnings = append(warnings, fmt.Sprintf("collectArtifacts: skipped %s (%d bytes): the files "+
+					"collected per call are limited to %d bytes in all", match, info.Size(), MaxArtifactBytes))
+				continue
+			}
+			total += info.Size()
+
+			name, err := filepath.Rel(dir, match)
+			if err != nil || strings.HasPrefix(name, "..") {
+				name = match
+			}
+			artifact, err := newArtifact(path, name, info.Size())
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("collectArtifacts: skipped %s: %v", match, err))
+				continue
+			}
+			artifacts = append(artifacts, artifact)
+		}
+	}
+
+	bm.artifacts.mutex.Lock()
+	defer bm.artifacts.mutex.Unlock()
+	bm.artifacts.expire()
+	for _, artifact := range artifacts {
+		bm.artifacts.add(artifact)
+	}
+	return artifacts, warnings
+}
+
+// artifactPath returns the real path of a file matched for collection,
+// refusing one outside the path jail or the allowed roots
+func (bm *BashManager) artifactPath(match string) (string, error) {
+	path := match
+	if bm.jail != nil {
+		var err error
+		if path, err = bm.jail.Resolve(path); err != nil {
+			return "", err
+		}
+	}
+	if bm.roots == nil {
+		return filepath.EvalSymlinks(path)
+	}
+	return bm.roots.Check(path)
+}
+
+// newArtifact describes a file as an artifact with a new URI
+func newArtifact(path, name string, size int64) (Artifact, error) {
+	var raw [8]byte
+	if _, err := rand.Read(raw[:]); err != nil {
+		return Artifact{}, err
+	}
+	mimeType, err := detectMimeType(path)
+	if err != nil {
+		return Artifact{}, err
+	}
+	return Artifact{
+		URI:      ArtifactURIScheme + hex.EncodeToString(raw[:]) + "/" + filepath.Base(path),
+		Name:     name,
+		Path:     path,
+		Size:     size,
+		MimeType: mimeType,
+		created:  time.Now(),
+	}, nil
+}
+
+// detectMimeType returns a file's MIME type from its extension or, failing
+// that, its first bytes
+func detectMimeType(path string) (string, error) {
+	if mimeType := mime.TypeByExtension(filepath.Ext(path)); mimeType != "" {
+		return mimeType, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return http.DetectContentType(head[:n]), nil
+}
+
+// Artifacts lists the registered artifacts, oldest first
+func (bm *BashManager) Artifacts() []Artifact {
+	bm.artifacts.mutex.Lock()
+	defer bm.artifacts.mutex.Unlock()
+	bm.artifacts.expire()
+	artifacts := make([]Artifact, 0, len(bm.artifacts.entries))
+	for _, artifact := range bm.artifacts.entries {
+		artifacts = append(artifacts, artifact)
+	}
+	sort.Slice(artifacts, func(i, j int) bool {
+		return artifacts[i].created.Before(artifacts[j].created)
+	})
+	return artifacts
+}
+
+// ReadArtifact returns a registered artifact and the file's current
+// content, or an error wrapping ErrUnknownArtifact if there is none at uri
+func (bm *BashManager) ReadArtifact(uri string) (Artifact, []byte, error) {
+	bm.artifacts.mutex.Lock()
+	bm.artifacts.expire()
+	artifact, ok := bm.artifacts.entries[uri]
+	bm.artifacts.mutex.Unlock()
+	if !ok {
+		return Artifact{}, nil, fmt.Errorf("%w %s (artifacts expire after %v and are dropped when the session "+
+			"restarts)", ErrUnknownArtifact, uri, bm.artifacts.ttl)
+	}
+
+	// The path was checked when collected, but may since lead elsewhere
+	path, err := bm.artifactPath(artifact.Path)
+	if err != nil {
+		return Artifact{}, nil, fmt.Errorf("failed to read artifact: %w", err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return Artifact{}, nil, fmt.Errorf("failed to read artifact: %w", err)
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, MaxArtifactBytes+1))
+	if err != nil {
+		return Artifact{}, nil, fmt.Errorf("failed to read artifact: %w", err)
+	}
+	if len(data) > MaxArtifactBytes {
+		return Artifact{}, nil, fmt.Errorf("artifact %s has grown past %d bytes since it was collected",
+			artifact.Path, MaxArtifactBytes)
+	}
+	return artifact, data, nil
+}
@@ -0,0 +1,98 @@
+package bash
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCollectArtifacts(t *testing.T) {
+	roots, root, outside := rootsFixture(t)
+	bm := newTestManager(t, Options{Roots: roots})
+	for name, content := range map[string]string{
+		"sub/report.html":  "<html></html>",
+		"sub/junit.xml":    "<testsuite/>",
+		"sub/dist/app.bin": "\x00\x01binary",
+		"sub/notes.txt":    "notes",
+	} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	run(t, bm, "cd "+root+"/sub")
+
+	refused := ""
+	artifacts, warnings := bm.CollectArtifacts("", []string{"*.html", "*.xml", "dist/*", "*.html", "*.zip",
+		"../escape/*", "*.txt"}, func(path string) error {
+		if strings.HasSuffix(path, "notes.txt") {
+			refused = path
+			return fmt.Errorf("not this one")
+		}
+		return nil
+	})
+
+	got := map[string]string{}
+	for _, artifact := range artifacts {
+		got[artifact.Name] = artifact.MimeType
+		if !strings.HasPrefix(artifact.URI, ArtifactURIScheme) {
+			t.Errorf("URI %s", artifact.URI)
+		}
+	}
+	want := map[string]string{
+		"report.html":  "text/html; charset=utf-8",
+		"junit.xml":    "text/xml; charset=utf-8",
+		"dist/app.bin": "application/octet-stream",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("collected %v, want %v", got, want)
+	}
+	if refused != root+"/sub/notes.txt" {
+		t.Errorf("allow was asked about %q", refused)
+	}
+	joined := strings.Join(warnings, "\n")
+	for _, warning := range []string{`"*.zip" matched no files`, "escape/secret.txt", "notes.txt: not this one"} {
+		if !strings.Contains(joined, warning) {
+			t.Errorf("warnings %q lack %q", joined, warning)
+		}
+	}
+
+	_, data, err := bm.ReadArtifact(artifacts[0].URI)
+	if err != nil || string(data) != "<html></html>" {
+		t.Errorf("ReadArtifact = %q, %v", data, err)
+	}
+	if len(bm.Artifacts()) != 3 {
+		t.Errorf("%d artifacts listed, want 3", len(bm.Artifacts()))
+	}
+
+	// Artifacts belong to the session
+	if err := bm.RestartSession(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := bm.ReadArtifact(artifacts[0].URI); err == nil {
+		t.Errorf("artifact still readable after a restart")
+	}
+}
+
+func TestCollectArtifactsLimits(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i <= MaxArtifacts; i++ {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%02d.log", i)), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bm := newTestManager(t, Options{})
+
+	artifacts, warnings := bm.CollectArtifacts(dir, []string{"*.log"}, nil)
+	if len(artifacts) != MaxArtifacts || len(warnings) != 1 || !strings.Contains(warnings[0], "only 50 files") {
+		t.Errorf("collected %d files, warnings %q; want %d and one warning", len(artifacts), warnings, MaxArtifacts)
+	}
+}
@@ -3,45 +3,288 @@ package bash
 import (
 	"bufio"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/events"
 )
 
 const (
-	// MaxScannerBufferSize is the maximum size for the bufio.Scanner buffer.
-	// Default bufio.Scanner limit is 64KB which can be exceeded by commands
-	// producing long output lines (e.g., raw JSON from APIs).
+	// MaxScannerBufferSize is the default maximum output line length, the
+	// bufio.Scanner buffer size. Default bufio.Scanner limit is 64KB which can
+	// be exceeded by commands producing long output lines (e.g., raw JSON from
+	// APIs).
 	MaxScannerBufferSize = 1024 * 1024 // 1MB
 
-	// MaxOutputSize is the maximum size of captured command output.
+	// MaxOutputSize is the default maximum size of captured command output.
 	// Prevents unbounded memory growth from commands producing huge output.
 	MaxOutputSize = 512 * 1024 // 512KB
+
+	// DefaultMaxTotalTimeout is the hard ceiling on a command's run time in
+	// idle timeout mode when no explicit ceiling is configured.
+	DefaultMaxTotalTimeout = 3600 * time.Second
+
+	// DefaultMaxTimeout is the largest per-call timeout a client may request
+	// when no cap is configured (or the default timeout, if that is larger).
+	DefaultMaxTimeout = 3600 * time.Second
 )
 
+// drainTimeout is how long closing a session waits for its stderr to reach
+// EOF before closing the pipe under the drainer
+const drainTimeout = 2 * time.Second
+
+// exitGrace is how long a command whose pipes failed waits to learn whether
+// bash exited
+const exitGrace = 500 * time.Millisecond
+
+// Timeout modes
+const (
+	// TimeoutModeTotal kills a command once it has run for the timeout in total.
+	TimeoutModeTotal = "total"
+	// TimeoutModeIdle kills a command once it has produced no output for the
+	// timeout, subject to a hard ceiling on total run time.
+	TimeoutModeIdle = "idle"
+)
+
+// Options configures a BashManager
+type Options struct {
+	// Timeout is the per-command timeout. In idle mode it is the maximum
+	// time allowed between two pieces of output.
+	Timeout time.Duration
+
+	// TimeoutMode is TimeoutModeTotal (default) or TimeoutModeIdle.
+	TimeoutMode string
+
+	// MaxTotal is the hard ceiling on run time in idle mode.
+	MaxTotal time.Duration
+
+	// BypassTimeout is the timeout for bypassSession one-shot commands.
+	BypassTimeout time.Duration
+
+	// MaxTimeout caps the per-call timeout a client may request.
+	MaxTimeout time.Duration
+
+	// Nested configures the environment exported for nested MCP execution.
+	Nested NestedOptions
+
+	// SessionIdleTimeout closes a session that has run no command for this
+	// long; the next command starts a fresh one. 0 never closes idle sessions.
+	SessionIdleTimeout time.Duration
+
+	// MaxQueued is how many commands may wait for the session while one
+	// runs; more are turned away with ErrSessionBusy. 0 lets any number wait.
+	MaxQueued int
+
+	// MaxJobs is how many background jobs may run at once (default
+	// DefaultMaxJobs).
+	MaxJobs int
+
+	// JobStateFile, if set, is where background jobs are recorded, so that
+	// a manager started later over the same file takes back the jobs still
+	// running (see loadJobs)
+	JobStateFile string
+
+	// WriteQuota, if set, stops write-heavy commands that write too much
+	WriteQuota *WriteQuota
+
+	// MaxOutputBytes caps the captured output of a command (default
+	// MaxOutputSize). MaxLineBytes is the longest output line that can be
+	// read (default MaxScannerBufferSize).
+	MaxOutputBytes int
+	MaxLineBytes   int
+
+	// TruncationMode says which part of over-long output is kept:
+	// TruncateHead (default), TruncateTail or TruncateBoth.
+	TruncationMode string
+
+	// StoredOutputBytes is how much of a truncated command's output is kept
+	// for bash_output (default DefaultStoredOutputSize; negative keeps
+	// none). StoredOutputTTL is how long it is kept (default
+	// DefaultStoredOutputTTL).
+	StoredOutputBytes int
+	StoredOutputTTL   time.Duration
+
+	// OutputResources keeps stored output in private temp files rather
+	// than in memory, up to OutputResourceBytes in all (default
+	// DefaultOutputResourceBytes), and serves it as MCP resources too
+	OutputResources     bool
+	OutputResourceBytes int64
+
+	// NoColor sets TERM=dumb and NO_COLOR=1 for bash processes, asking
+	// tools not to emit ANSI colors
+	NoColor bool
+
+	// PTYRows and PTYCols are the window size of commands run with pty
+	// (default DefaultPTYRows by DefaultPTYCols)
+	PTYRows int
+	PTYCols int
+
+	// Shell is the shell sessions and one-shot commands run (default
+	// DefaultShell), started with ShellArgs. It must run a script named
+	// as its last argument (a pipe it reads commands from; stdin off Unix)
+	// and, for one-shot commands, -c.
+	Shell     string
+	ShellArgs []string
+
+	// Jail, if set, starts commands in its root with HOME and TMPDIR
+	// inside it, and maps working_directory and exec cwd paths into it
+	Jail *PathJail
+
+	// Roots, if set, confines the file tools, working_directory and exec
+	// cwd to its directories, and starts commands in the first
+	Roots *AllowedRoots
+
+	// LoginShell starts sessions with -l so they read the user's login
+	// profile. RCFile is sourced in each new session. What either prints
+	// is discarded.
+	LoginShell bool
+	RCFile     string
+
+	// StartupCommands run in each new session after the profile and
+	// rcFile. One exiting non-zero fails session creation, unless
+	// StartupCommandsLenient is set, when it is only reported.
+	StartupCommands        []string
+	StartupCommandsLenient bool
+
+	// Sandbox, if enabled, isolates sessions in their own namespaces
+	Sandbox Sandbox
+
+	// RunAs, if set, is the user and group sessions, one-shot commands and
+	// exec programs run as
+	RunAs *RunAs
+
+	// Limits are resource limits applied to each session's shell
+	Limits ResourceLimits
+
+	// Events, if set, receives session lifecycle, warning and job events
+	// for events_poll
+	Events *events.Bus
+
+	// PathWarnLength is the length of a session's $PATH past which commands
+	// are warned (default DefaultPathWarnLength; negative never warns).
+	// DedupPath removes duplicate entries from it then, between commands.
+	PathWarnLength int
+	DedupPath      bool
+
+	// HistorySize is how many commands bash_history keeps (default
+	// DefaultHistorySize)
+	HistorySize int
+
+	// KillOrphans kills the processes a closing session leaves running,
+	// such as daemons that left its process tree, rather than only
+	// reporting them
+	KillOrphans bool
+}
+
 // BashSession represents a persistent bash session
 type BashSession struct {
-	cmd          *exec.Cmd
+	cmd *exec.Cmd
+	// stdin is where commands are written: the pipe the shell runs as
+	// script, or its stdin where there is no script (see commandChannel)
 	stdin        io.WriteCloser
 	stdout       io.ReadCloser
 	stderr       io.ReadCloser
 	mutex        sync.Mutex
 	sessionMutex sync.RWMutex
 	running      bool
-	workingDir   string
 	timeout      time.Duration
 
+	// maxOutput and maxLine are the output size and line length limits;
+	// truncation is the truncation mode
+	maxOutput  int
+	maxLine    int
+	truncation string
+
+	// outputs stores truncated output, up to keepOutput bytes per stream
+	outputs    *outputStore
+	keepOutput int
+
 	// stderrBuf holds accumulated stderr output between commands.
 	// A single persistent goroutine drains stderr into this buffer,
 	// avoiding the goroutine-per-execute leak.
-	stderrBuf   strings.Builder
+	stderrBuf   *cappedBuffer
 	stderrMutex sync.Mutex
 	stderrDone  chan struct{} // closed when stderr drainer goroutine exits
+
+	// exited is closed by monitor once bash has exited, for whatever reason;
+	// exitStatus then says how ("exit status 1", "signal: killed")
+	exited     chan struct{}
+	exitStatus string
+
+	// lastActivity is the UnixNano time output was last seen on stdout or
+	// stderr. Used by idle timeout mode.
+	lastActivity atomic.Int64
+
+	// id, startedAt and lastCommand describe the session for bash_sessions.
+	// lastCommand is the UnixNano time the last command started (0 if none);
+	// lastUsed drives idle session reaping;
+	// busy is set while a command runs. stopped mirrors !running so it can
+	// be read without taking mutex.
+	id          int
+	startedAt   time.Time
+	lastCommand atomic.Int64
+	lastUsed    atomic.Int64 // UnixNano time the last command finished
+	busy        atomic.Bool
+	stopped     atomic.Bool
+
+	// workingDir is $PWD as the last command finished, reported with its
+	// completion marker
+	workingDir atomic.Pointer[string]
+
+	// closeEvent runs sessionClosed exactly once
+	closeEvent sync.Once
+
+	// reaped waits for the process and the stderr drainer exactly once
+	reaped sync.Once
+
+	// interrupted is the signal interrupt_session sent the running command,
+	// or 0. Reset as each command starts.
+	interrupted atomic.Int32
+
+	// warnings are reported with the session's first command, e.g. nested
+	// MCP sockets that were skipped at creation. Guarded by the manager's
+	// sessionMutex.
+	warnings []string
+
+	// pathWarned is the $PATH length last warned about, so a warning is
+	// only repeated once it has grown further. Guarded by the manager's
+	// sessionMutex.
+	pathWarned int
+
+	// version is the session's $BASH_VERSION, captured at creation.
+	// hasVersion is false if the probe failed or the shell isn't bash.
+	version    BashVersion
+	hasVersion bool
+
+	// marker is the session's sessionMarkerVar value. Processes it leaves
+	// running when it closes are passed to onOrphans, and killed first if
+	// killOrphans is set; accounted makes sure they are looked for once.
+	marker      string
+	killOrphans bool
+	onOrphans   func(*BashSession, []Orphan)
+	accounted   atomic.Bool
+
+	// script is the path the shell reads its commands from, which it
+	// names its own error messages after, or "" if it reads stdin.
+	// shellName replaces it in them.
+	script    string
+	shellName string
+
+	// jobControl is set once jobControlSetup has run in the session.
+	// background holds the shell's children as the running command
+	// started: background jobs of earlier commands, which stopping it
+	// leaves alone.
+	jobControl bool
+	background atomic.Pointer[map[int]bool]
 }
 
 // BashManager manages bash sessions
@@ -49,43 +292,369 @@ type BashManager struct {
 	session        *BashSession
 	sessionMutex   sync.Mutex
 	defaultTimeout time.Duration
+	timeoutMode    string
+	maxTotal       time.Duration
+	bypassTimeout  time.Duration
+	maxTimeout     time.Duration
 	cancelMutex    sync.Mutex
 	cancelFunc     context.CancelFunc // cancel function for the currently running command
+
+	// queue admits session commands in arrival order
+	queue commandQueue
+
+	// scriptBuffers holds named scripts assembled chunk by chunk via
+	// bash_script_buffer. Cleared when the session is restarted.
+	scriptBuffers map[string]*strings.Builder
+	scriptMutex   sync.Mutex
+
+	// current mirrors session so it can be inspected while a command holds
+	// sessionMutex. sessionCount numbers sessions as they are created.
+	current      atomic.Pointer[BashSession]
+	sessionCount int
+
+	// idleTimeout, when non-zero, is how long a session may sit unused
+	// before the reaper closes it. stopReaper ends the reaper goroutine.
+	idleTimeout time.Duration
+	stopReaper  chan struct{}
+	closeOnce   sync.Once
+
+	nested  NestedOptions
+	noColor bool
+
+	// ptyRows and ptyCols are the window size of pty commands
+	ptyRows int
+	ptyCols int
+
+	// shell and shellArgs start sessions and one-shot commands; sessions
+	// are login shells with loginShell set, and source rcFile
+	shell      string
+	shellArgs  []string
+	loginShell bool
+	rcFile     string
+
+	// startupCommands run in each new session; see Options
+	startupCommands []string
+	startupLenient  bool
+
+	// history remembers succeeded commands for failure contexts; ran is
+	// every command run, for bash_history
+	history commandHistory
+	ran     historyRing
+
+	events *events.Bus
+
+	limits ResourceLimits
+
+	runAs   *RunAs
+	sandbox Sandbox
+
+	// locks are the flock(2) locks taken with acquire_lock
+	locks lockTable
+
+	// jobs are the commands started with background
+	jobs jobTable
+
+	writeQuota *WriteQuota
+
+	jail  *PathJail
+	roots *AllowedRoots
+
+	// windowsPaths translates clients' Windows paths under WSL; nil elsewhere
+	windowsPaths *WindowsPaths
+
+	// netIsolation probes whether noNetwork commands are supported
+	netIsolation *hostProbe
+
+	// maxOutput and maxLine are the output size and line length limits
+	// given to every session and one-shot command, and truncation the
+	// truncation mode
+	maxOutput  int
+	maxLine    int
+	truncation string
+
+	// outputs holds the full output of truncated commands for bash_output,
+	// up to keepOutput bytes per stream. nil when storage is disabled.
+	outputs    *outputStore
+	keepOutput int
+
+	// artifacts are the files registered with collectArtifacts
+	artifacts artifactStore
+
+	// pathWarnLength and dedupPath are Options.PathWarnLength and
+	// Options.DedupPath
+	pathWarnLength int
+	dedupPath      bool
+
+	// killOrphans is Options.KillOrphans. orphanReports are the latest
+	// sessions that left processes running, and orphanWarnings those not
+	// yet reported with a command.
+	killOrphans    bool
+	orphanMutex    sync.Mutex
+	orphanReports  []OrphanReport
+	orphanWarnings []string
 }
 
 // NewBashManager creates a new bash manager
-func NewBashManager(timeout time.Duration) *BashManager {
-	if timeout == 0 {
-		timeout = 600 * time.Second // Default 10 minute timeout
+func NewBashManager(opts Options) *BashManager {
+	if opts.Timeout == 0 {
+		opts.Timeout = 600 * time.Second // Default 10 minute timeout
+	}
+	if opts.TimeoutMode == "" {
+		opts.TimeoutMode = TimeoutModeTotal
+	}
+	if opts.TimeoutMode == TimeoutModeIdle && opts.MaxTotal == 0 {
+		opts.MaxTotal = DefaultMaxTotalTimeout
+	}
+	if opts.BypassTimeout == 0 {
+		opts.BypassTimeout = DefaultBypassTimeout
+	}
+	if opts.MaxTimeout == 0 {
+		opts.MaxTimeout = DefaultMaxTimeout
+	}
+	if opts.MaxTimeout < opts.Timeout {
+		opts.MaxTimeout = opts.Timeout
+	}
+	if opts.MaxOutputBytes == 0 {
+		opts.MaxOutputBytes = MaxOutputSize
+	}
+	if opts.MaxLineBytes == 0 {
+		opts.MaxLineBytes = MaxScannerBufferSize
+	}
+	if opts.TruncationMode == "" {
+		opts.TruncationMode = TruncateHead
+	}
+	if opts.StoredOutputBytes == 0 {
+		opts.StoredOutputBytes = DefaultStoredOutputSize
+	}
+	if opts.MaxJobs == 0 {
+		opts.MaxJobs = DefaultMaxJobs
+	}
+	if opts.StoredOutputTTL == 0 {
+		opts.StoredOutputTTL = DefaultStoredOutputTTL
+	}
+	if opts.OutputResourceBytes == 0 {
+		opts.OutputResourceBytes = DefaultOutputResourceBytes
+	}
+	if opts.Shell == "" {
+		opts.Shell = DefaultShell
+	}
+	if opts.PTYRows == 0 {
+		opts.PTYRows = DefaultPTYRows
+	}
+	if opts.PTYCols == 0 {
+		opts.PTYCols = DefaultPTYCols
+	}
+	if opts.HistorySize == 0 {
+		opts.HistorySize = DefaultHistorySize
+	}
+	if opts.PathWarnLength == 0 {
+		opts.PathWarnLength = DefaultPathWarnLength
+	}
+
+	bm := &BashManager{
+		defaultTimeout:  opts.Timeout,
+		timeoutMode:     opts.TimeoutMode,
+		maxTotal:        opts.MaxTotal,
+		bypassTimeout:   opts.BypassTimeout,
+		maxTimeout:      opts.MaxTimeout,
+		idleTimeout:     opts.SessionIdleTimeout,
+		nested:          opts.Nested,
+		noColor:         opts.NoColor,
+		ptyRows:         opts.PTYRows,
+		ptyCols:         opts.PTYCols,
+		shell:           opts.Shell,
+		shellArgs:       opts.ShellArgs,
+		jail:            opts.Jail,
+		roots:           opts.Roots,
+		windowsPaths:    detectWindowsPaths(),
+		loginShell:      opts.LoginShell,
+		rcFile:          opts.RCFile,
+		startupCommands: opts.StartupCommands,
+		startupLenient:  opts.StartupCommandsLenient,
+		events:          opts.Events,
+		limits:          opts.Limits,
+		runAs:           opts.RunAs,
+		sandbox:         opts.Sandbox,
+		maxOutput:       opts.MaxOutputBytes,
+		maxLine:         opts.MaxLineBytes,
+		truncation:      opts.TruncationMode,
+		queue:           commandQueue{max: opts.MaxQueued},
+		jobs:            jobTable{max: opts.MaxJobs, stateFile: opts.JobStateFile},
+		writeQuota:      opts.WriteQuota,
+		killOrphans:     opts.KillOrphans,
+		pathWarnLength:  opts.PathWarnLength,
+		dedupPath:       opts.DedupPath,
+		ran:             historyRing{size: opts.HistorySize},
+		stopReaper:      make(chan struct{}),
+		artifacts:       artifactStore{ttl: opts.StoredOutputTTL},
+	}
+	if opts.StoredOutputBytes > 0 {
+		if opts.OutputResources {
+			bm.outputs = newDiskOutputStore(opts.StoredOutputTTL, opts.OutputResourceBytes)
+			go bm.expireOutputs()
+		} else {
+			bm.outputs = newOutputStore(opts.StoredOutputTTL)
+		}
+		bm.keepOutput = opts.StoredOutputBytes
+	}
+	if bm.idleTimeout > 0 {
+		go bm.reapIdleSessions()
+	}
+	if opts.JobStateFile != "" {
+		bm.loadJobs()
+	}
+	bm.netIsolation = startProbe(func() error {
+		err := detectNetworkIsolation(bm.shell)
+		logNetworkIsolation(err)
+		return err
+	})
+	return bm
+}
+
+// MaxCommandDuration returns the longest a single command may run
+func (bm *BashManager) MaxCommandDuration() time.Duration {
+	if bm.timeoutMode == TimeoutModeIdle {
+		return bm.maxTotal
+	}
+	return bm.defaultTimeout
+}
+
+// MaxTimeout returns the cap on per-call timeouts
+func (bm *BashManager) MaxTimeout() time.Duration {
+	return bm.maxTimeout
+}
+
+// ClampTimeout bounds a client-requested timeout by the configured cap,
+// reporting whether it had to be reduced. Zero means use the default.
+func (bm *BashManager) ClampTimeout(requested time.Duration) (time.Duration, bool) {
+	if requested > bm.maxTimeout {
+		return bm.maxTimeout, true
+	}
+	return requested, false
+}
+
+// TimeoutInfo describes the time limit a command ran under, for responses
+type TimeoutInfo struct {
+	Seconds float64 `json:"seconds"`
+	// Source is "default", "request", or "cap" for a request cut to the
+	// maximum
+	Source string `json:"source"`
+	// Mode is TimeoutModeTotal or TimeoutModeIdle. In idle mode Seconds is
+	// the idle limit, and MaxTotalSeconds the ceiling on total run time.
+	Mode            string  `json:"mode"`
+	MaxTotalSeconds float64 `json:"maxTotalSeconds,omitempty"`
+	// Exceeded is the limit the command was stopped for exceeding, "total"
+	// or "idle", or "" if it wasn't
+	Exceeded string `json:"exceeded,omitempty"`
+}
+
+// DescribeTimeout returns the limit a command runs under given the timeout a
+// client requested (0 for none), as ExecuteCommandContext applies it after
+// ClampTimeout
+func (bm *BashManager) DescribeTimeout(requested time.Duration) TimeoutInfo {
+	timeout, clamped := bm.ClampTimeout(requested)
+	info := TimeoutInfo{Source: "request", Mode: bm.timeoutMode}
+	switch {
+	case clamped:
+		info.Source = "cap"
+	case timeout == 0:
+		timeout = bm.defaultTimeout
+		info.Source = "default"
+	}
+	info.Seconds = timeout.Seconds()
+	if bm.timeoutMode == TimeoutModeIdle {
+		info.MaxTotalSeconds = bm.maxTotal.Seconds()
 	}
+	return info
+}
 
-	return &BashManager{
-		defaultTimeout: timeout,
+// CommandDuration returns the longest a command run with the given per-call
+// timeout (0 for the default) may run.
+func (bm *BashManager) CommandDuration(timeout time.Duration) time.Duration {
+	if timeout == 0 || bm.timeoutMode == TimeoutModeIdle {
+		return bm.MaxCommandDuration()
 	}
+	return timeout
+}
+
+// ExecuteCommand executes a bash command in the session with the default timeout
+func (bm *BashManager) ExecuteCommand(command string) (CommandResult, error) {
+	return bm.ExecuteCommandWithTimeout(command, 0)
+}
+
+// ExecuteCommandWithTimeout executes a bash command in the session. A non-zero
+// timeout replaces the default for this command (in idle mode, the idle
+// limit); callers should bound it with ClampTimeout first.
+func (bm *BashManager) ExecuteCommandWithTimeout(command string, timeout time.Duration) (CommandResult, error) {
+	return bm.ExecuteCommandContext(context.Background(), command, timeout, nil, nil)
 }
 
-// ExecuteCommand executes a bash command in the session
-func (bm *BashManager) ExecuteCommand(command string) (string, error) {
+// ExecuteCommandContext is ExecuteCommandWithTimeout for a command that can
+// be cancelled through ctx, and that passes output to progress, at most every
+// ProgressInterval, while it runs. The result still holds the full output.
+// While another command runs it waits in the session's queue, telling
+// queued its position; if the queue is full it fails at once with an error
+// wrapping ErrSessionBusy. progress and queued may be nil.
+//
+// On cancellation or timeout only the command is stopped where possible, so
+// the session keeps its state (see stopForeground). Cancellation returns
+// ErrCommandCancelled; a timeout returns an error wrapping ErrCommandTimedOut
+// together with the output captured before the kill.
+func (bm *BashManager) ExecuteCommandContext(ctx context.Context, command string, timeout time.Duration,
+	progress ProgressFunc, queued QueueFunc) (CommandResult, error) {
+	if timeout == 0 {
+		timeout = bm.defaultTimeout
+	}
+
+	if err := bm.queue.enter(ctx, queued); err != nil {
+		return CommandResult{}, err
+	}
+	defer bm.queue.leave()
+
 	bm.sessionMutex.Lock()
 	defer bm.sessionMutex.Unlock()
 
+	// Cancelled while queued behind another command
+	if ctx.Err() != nil {
+		return CommandResult{}, ErrCommandCancelled
+	}
+
 	// Create session if it doesn't exist or is dead
-	if bm.session == nil || !bm.session.running {
+	if bm.session == nil || bm.session.stopped.Load() {
 		// FIX: Clean up the old session before creating a new one.
 		// Previously, createSession() silently overwrote bm.session,
 		// leaving the old bash process running as an orphan.
-		if bm.session != nil {
+		var lost error
+		if old := bm.session; old != nil {
 			fmt.Fprintf(os.Stderr, "Cleaning up dead session before creating new one (PID: %d)\n",
-				bm.session.getPID())
-			bm.session.close()
+				old.getPID())
+			old.mutex.Lock()
+			if old.running {
+				// Exited between commands rather than being stopped by us
+				lost = old.exitError()
+			}
+			old.mutex.Unlock()
+			old.close()
+			bm.sessionClosed(old, "exited")
 		}
 		if err := bm.createSession(); err != nil {
-			return "", fmt.Errorf("failed to create bash session: %w", err)
+			return CommandResult{}, fmt.Errorf("failed to create bash session: %w", err)
+		}
+		if lost != nil {
+			bm.session.warnings = append(bm.session.warnings,
+				fmt.Sprintf("Warning: the previous %v; this command ran in a new session, "+
+					"so its variables, functions and working directory were lost", lost))
 		}
 	}
 
-	// Create a cancellable context for this command
-	ctx, cancel := context.WithTimeout(context.Background(), bm.defaultTimeout)
+	// Create a cancellable context for this command. In idle mode the
+	// context carries the hard ceiling and execute() enforces the idle limit.
+	limits := executeLimits{total: timeout}
+	if bm.timeoutMode == TimeoutModeIdle {
+		limits = executeLimits{total: bm.maxTotal, idle: timeout}
+	}
+	limits.progress = progress
+	ctx, cancel := context.WithTimeout(ctx, limits.total)
 	defer cancel()
 
 	// Store cancel function so CancelRunning() can abort this command
@@ -99,12 +668,30 @@ func (bm *BashManager) ExecuteCommand(command string) (string, error) {
 		bm.cancelMutex.Unlock()
 	}()
 
-	return bm.session.execute(command, ctx)
+	warnings := append(bm.takeOrphanWarnings(), bm.session.warnings...)
+	bm.session.warnings = nil
+
+	session := bm.session
+	result, err := session.execute(command, ctx, limits)
+	if err == nil {
+		fmt.Fprintf(os.Stderr, "Command finished in %v (exit code %d, cwd %s)\n",
+			result.Duration.Round(time.Millisecond), result.ExitCode, result.WorkingDirectory)
+	}
+	result.Warnings = append(warnings, result.Warnings...)
+	if err == nil {
+		result.Warnings = append(result.Warnings, bm.checkPath(session, result.PathLength)...)
+	}
+	bm.publishResult(session, result)
+	if session.stopped.Load() {
+		bm.sessionClosed(session, closeReason(err))
+	}
+	return result, err
 }
 
-// CancelRunning cancels the currently executing command (if any) and kills the
-// bash session. This is called when the MCP client sends notifications/cancelled.
-// It unblocks ExecuteCommand so queued requests can proceed immediately.
+// CancelRunning cancels the currently executing command (if any), whichever
+// request it belongs to. notifications/cancelled normally cancels a specific
+// request through its context instead; this is the fallback when the
+// notification doesn't say which request.
 func (bm *BashManager) CancelRunning() {
 	bm.cancelMutex.Lock()
 	cf := bm.cancelFunc
@@ -124,39 +711,62 @@ func (bm *BashManager) RestartSession() error {
 	// Close existing session
 	if bm.session != nil {
 		bm.session.close()
+		bm.sessionClosed(bm.session, "restart")
 	}
 
+	// Pending script buffers, stored output and artifacts belong to the old
+	// session
+	bm.clearScriptBuffers()
+	bm.outputs.clear()
+	bm.artifacts.clear()
+
 	// Create new session
 	return bm.createSession()
 }
 
 // createSession creates a new bash session
 func (bm *BashManager) createSession() error {
+	bm.sessionCount++
 	session := &BashSession{
+		id:         bm.sessionCount,
 		timeout:    bm.defaultTimeout,
+		maxOutput:  bm.maxOutput,
+		maxLine:    bm.maxLine,
+		truncation: bm.truncation,
+		outputs:    bm.outputs,
+		keepOutput: bm.keepOutput,
+		stderrBuf:  bm.newOutputBuffer(),
 		running:    true,
 		stderrDone: make(chan struct{}),
+		exited:     make(chan struct{}),
+	}
+	session.marker = newSessionMarker(session.id)
+	session.killOrphans = bm.killOrphans
+	session.onOrphans = bm.reportOrphans
+
+	// Create the shell command
+	session.cmd = bm.shellCommand(bm.sessionArgs()...)
+
+	var skipped []string
+	session.cmd.Env, skipped = bm.sessionEnv()
+	session.cmd.Env = append(session.cmd.Env, sessionMarkerVar+"="+session.marker)
+	session.cmd.Dir = bm.commandDir()
+	bm.runAs.setCredential(session.cmd)
+	bm.sandbox.setNamespaces(session.cmd)
+	if len(skipped) > 0 && bm.nested.Sockets != nil {
+		session.warnings = append(session.warnings, nestedSocketWarning(skipped))
 	}
 
-	// Create the bash command
-	session.cmd = exec.Command("bash")
-
-	// NESTED MCP SUPPORT: Set environment variables for child processes
-	// This allows mcp-cli to detect nested execution and use Unix sockets
-	socketDir := "/tmp/mcp-sockets"
-	os.MkdirAll(socketDir, 0700) // Create socket directory with restrictive permissions
-
-	session.cmd.Env = append(os.Environ(),
-		"MCP_NESTED=1",                                // Signal nested MCP execution
-		"MCP_SOCKET_DIR="+socketDir,                    // Unix socket directory
-		"MCP_SKILLS_SOCKET="+socketDir+"/skills.sock",  // Skills server socket path
-	)
-
-	// Get stdin/stdout/stderr pipes
-	var err error
-	session.stdin, err = session.cmd.StdinPipe()
+	// Get the command channel and stdout/stderr pipes
+	channel, readEnd, script, err := commandChannel(session.cmd)
 	if err != nil {
-		return fmt.Errorf("failed to create stdin pipe: %w", err)
+		return fmt.Errorf("failed to create command pipe: %w", err)
+	}
+	session.stdin = channel
+	if script != "" {
+		session.cmd.Args = append(session.cmd.Args, script)
+		session.script = script
+		session.shellName = filepath.Base(bm.shell)
 	}
 
 	session.stdout, err = session.cmd.StdoutPipe()
@@ -170,10 +780,17 @@ func (bm *BashManager) createSession() error {
 	}
 
 	// Start the bash process
-	if err := session.cmd.Start(); err != nil {
+	err = session.cmd.Start()
+	if readEnd != nil {
+		readEnd.Close()
+	}
+	if err != nil {
+		channel.Close()
 		return fmt.Errorf("failed to start bash: %w", err)
 	}
 
+	session.startedAt = time.Now()
+	session.lastUsed.Store(session.startedAt.UnixNano())
 	fmt.Fprintf(os.Stderr, "Created new bash session (PID: %d)\n", session.cmd.Process.Pid)
 
 	// FIX: Start a single persistent stderr drainer goroutine per session.
@@ -181,42 +798,124 @@ func (bm *BashManager) createSession() error {
 	// to read from the same stderr pipe and never terminated, leaking goroutines
 	// and causing data races.
 	go session.drainStderr()
+	go session.monitor()
+
+	// The shell has its own descriptor for the script; commands shouldn't
+	// inherit fd 3 and be able to read the ones that follow them
+	if script != "" {
+		if err := session.runSetup("close the command pipe", "exec 3<&-"); err != nil {
+			session.close()
+			return err
+		}
+	}
+
+	// Capture the bash version for bash_sessions, the old-bash warning and
+	// the features that depend on it
+	if shellIsBash(bm.shell) {
+		session.probeVersion()
+		session.lastCommand.Store(0) // the probe is not a client command
+	}
+
+	// bash 5 can name $0 after the shell again, rather than the script
+	if script != "" && session.hasVersion && session.version.Capabilities().Argv0 {
+		if err := session.runSetup("set $0", "BASH_ARGV0="+shellQuote(session.shellName)); err != nil {
+			session.close()
+			return err
+		}
+	}
+
+	// Job control lets a timed-out command be interrupted without ending
+	// the session (see stopForeground)
+	if shellIsBash(bm.shell) {
+		if err := session.runSetup("turn on job control", jobControlSetup); err != nil {
+			session.close()
+			return err
+		}
+		session.jobControl = true
+	}
+
+	// The sandbox and limits come first so they bind the profile and
+	// rcFile too
+	if err := session.applySandbox(bm.sandbox); err != nil {
+		session.close()
+		return err
+	}
+	if err := session.applyLimits(bm.limits); err != nil {
+		session.close()
+		return err
+	}
+
+	// The profile and rcFile run before anything else, and what they
+	// print is drained so the first response is clean
+	if err := session.runStartup(bm.loginShell, bm.rcFile); err != nil {
+		session.close()
+		return err
+	}
+	if err := session.runStartupCommands(bm.startupCommands, bm.startupLenient); err != nil {
+		session.close()
+		return err
+	}
 
 	bm.session = session
+	bm.current.Store(session)
+	bm.publishStarted(session)
 	return nil
 }
 
 // drainStderr continuously reads stderr from the bash process into a buffer.
 // This single goroutine replaces the per-execute goroutine that was leaking.
+// It owns the read side of the pipe: nothing else closes it before the
+// drainer has seen EOF, or reap has given up waiting for it.
 func (bs *BashSession) drainStderr() {
 	defer close(bs.stderrDone)
 
 	scanner := bufio.NewScanner(bs.stderr)
-	scanner.Buffer(make([]byte, 0, 64*1024), MaxScannerBufferSize)
+	scanner.Buffer(make([]byte, 0, min(64*1024, bs.maxLine)), bs.maxLine)
 
 	for scanner.Scan() {
-		line := scanner.Text()
+		line := bs.shellMessage(scanner.Text())
+		bs.lastActivity.Store(time.Now().UnixNano())
 		bs.stderrMutex.Lock()
-		// Cap stderr buffer to prevent unbounded growth
-		if bs.stderrBuf.Len() < MaxOutputSize {
-			bs.stderrBuf.WriteString(line)
-			bs.stderrBuf.WriteString("\n")
-		}
+		// The buffer is capped to prevent unbounded growth
+		bs.stderrBuf.WriteString(line)
+		bs.stderrBuf.WriteString("\n")
 		bs.stderrMutex.Unlock()
 	}
 
-	if err := scanner.Err(); err != nil {
+	if err := scanner.Err(); err != nil && !errors.Is(err, os.ErrClosed) {
 		fmt.Fprintf(os.Stderr, "Stderr drainer error: %v\n", err)
 	}
 }
 
-// consumeStderr returns and clears the accumulated stderr output.
-func (bs *BashSession) consumeStderr() string {
+// shellMessage gives a line that is one of the shell's own error messages,
+// e.g. "/dev/fd/3: line 2: foo: command not found", the shell's name in place
+// of the script path, as it would have had reading commands on stdin
+func (bs *BashSession) shellMessage(line string) string {
+	if bs.script == "" {
+		return line
+	}
+	if rest, ok := strings.CutPrefix(line, bs.script+": "); ok {
+		return bs.shellName + ": " + rest
+	}
+	return line
+}
+
+// consumeStderr returns and clears the accumulated stderr output, storing it
+// for bash_output if it was truncated. The output reference is nil otherwise.
+func (bs *BashSession) consumeStderr() (string, []OutputRef) {
 	bs.stderrMutex.Lock()
 	defer bs.stderrMutex.Unlock()
+	stored := addOutputRef(nil, "stderr", bs.stderrBuf, bs.outputs)
 	s := bs.stderrBuf.String()
-	bs.stderrBuf.Reset()
-	return s
+	bs.stderrBuf.reset()
+	return s, stored
+}
+
+// discardStderr clears the accumulated stderr output
+func (bs *BashSession) discardStderr() {
+	bs.stderrMutex.Lock()
+	defer bs.stderrMutex.Unlock()
+	bs.stderrBuf.reset()
 }
 
 // getPID returns the process ID of the bash session, or 0 if not available.
@@ -227,70 +926,281 @@ func (bs *BashSession) getPID() int {
 	return 0
 }
 
+// WorkingDirectory returns the current directory of the bash session, or ""
+// if it is unknown. It is read live from /proc where available, and is
+// otherwise the directory the last command finished in.
+func (bm *BashManager) WorkingDirectory() string {
+	session := bm.current.Load()
+	if session == nil {
+		return ""
+	}
+	if dir := session.procWorkingDirectory(); dir != "" {
+		return dir
+	}
+	return session.trackedWorkingDirectory()
+}
+
+// InDirectory wraps command so it runs in a subshell inside dir, leaving the
+// session's own working directory untouched. A relative dir is resolved
+// against the session's current directory. The directory must exist.
+func (bm *BashManager) InDirectory(command, dir string) (string, error) {
+	dir, err := bm.resolveDirectory(dir)
+	if err != nil {
+		return "", err
+	}
+	// The newline before ")" keeps a trailing comment in command from
+	// swallowing it
+	return fmt.Sprintf("(cd %s || exit\n%s\n)", shellQuote(dir), command), nil
+}
+
+// resolveDirectory returns the real path of a working_directory argument,
+// which must be an existing directory: taken from the jail's root when
+// jailed, from the session's current directory when relative, and inside
+// the allowed roots
+func (bm *BashManager) resolveDirectory(dir string) (string, error) {
+	if bm.jail != nil && filepath.IsAbs(dir) {
+		var err error
+		if dir, err = bm.jail.Resolve(dir); err != nil {
+			return "", fmt.Errorf("working_directory: %w", err)
+		}
+	}
+	if !filepath.IsAbs(dir) {
+		base := bm.WorkingDirectory()
+		if base == "" {
+			return "", fmt.Errorf("working_directory %q must be absolute (the session's current directory is unknown)", dir)
+		}
+		dir = filepath.Join(base, dir)
+	}
+	dir, err := bm.roots.Check(dir)
+	if err != nil {
+		return "", fmt.Errorf("working_directory: %w", err)
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("working_directory %s does not exist", dir)
+		}
+		return "", fmt.Errorf("working_directory %s: %w", dir, err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("working_directory %s is not a directory", dir)
+	}
+	return dir, nil
+}
+
+// trackedWorkingDirectory returns the session's cwd as its last command
+// finished, or "" before the first
+func (bs *BashSession) trackedWorkingDirectory() string {
+	if dir := bs.workingDir.Load(); dir != nil {
+		return *dir
+	}
+	return ""
+}
+
+// procWorkingDirectory reads the session's cwd from /proc, or "" if unavailable.
+func (bs *BashSession) procWorkingDirectory() string {
+	pid := bs.getPID()
+	if pid == 0 {
+		return ""
+	}
+	dir, err := os.Readlink(fmt.Sprintf("/proc/%d/cwd", pid))
+	if err != nil {
+		return ""
+	}
+	return dir
+}
+
+// CommandResult is the outcome of a command that ran to completion. Output
+// still carries an "[Exit code: N]" line for text-only clients, but ExitCode
+// is authoritative.
+type CommandResult struct {
+	Output   string
+	ExitCode int
+
+	// BackgroundJobs holds job-control notifications (e.g. "[1]+ Done ...")
+	// seen while the command ran, removed from Output.
+	BackgroundJobs []string
+
+	// Warnings are notes about the session itself to show alongside Output
+	Warnings []string
+
+	// StoredOutputs lists the truncated streams whose full output was kept
+	// for bash_output
+	StoredOutputs []OutputRef
+
+	// Interrupted names the signal interrupt_session sent the command, if
+	// any
+	Interrupted string
+
+	// Stderr is what the command wrote to stderr, which Output also holds
+	Stderr string
+
+	// TimedOut is the limit the command was stopped for exceeding, "total"
+	// or "idle", or ""
+	TimedOut string
+
+	// Duration is how long the command ran: from being sent to the session
+	// until its completion marker arrived, or until it was stopped
+	Duration time.Duration
+
+	// WorkingDirectory is the session's directory once the command
+	// finished, or "" if it didn't report one. PathLength is the length of
+	// its $PATH then, or 0.
+	WorkingDirectory string
+	PathLength       int
+
+	// Failure, set by the caller through AnalyzeResult, says why a
+	// command failed
+	Failure *FailureContext
+}
+
+// executeLimits holds the time limits for a single command. total is enforced
+// by the context deadline; idle, when non-zero, is the longest the command may
+// go without producing output. progress, when set, receives output as it
+// arrives.
+type executeLimits struct {
+	total    time.Duration
+	idle     time.Duration
+	progress ProgressFunc
+}
+
 // execute runs a command in the bash session.
-// The context controls timeout and cancellation — when cancelled, the session
-// is killed immediately so queued commands can proceed.
-func (bs *BashSession) execute(command string, ctx context.Context) (string, error) {
+// The context controls timeout and cancellation — when it ends, the command
+// is stopped with stopForeground, which keeps the session where it can and
+// kills it only where it can't, so queued commands can proceed.
+func (bs *BashSession) execute(command string, ctx context.Context, limits executeLimits) (CommandResult, error) {
 	bs.mutex.Lock()
 	defer bs.mutex.Unlock()
 
+	if err := bs.exitError(); err != nil {
+		bs.markStopped()
+		return CommandResult{}, err
+	}
 	if !bs.running {
-		return "", fmt.Errorf("bash session is not running")
+		return CommandResult{}, fmt.Errorf("bash session is not running")
 	}
 
+	bs.lastCommand.Store(time.Now().UnixNano())
+	bs.busy.Store(true)
+	defer func() {
+		bs.lastUsed.Store(time.Now().UnixNano())
+		bs.busy.Store(false)
+	}()
+
 	// Clear any accumulated stderr from previous commands
-	bs.consumeStderr()
+	bs.discardStderr()
+	bs.interrupted.Store(0)
 
 	// Create a unique marker for command completion
-	marker := fmt.Sprintf("__BASH_CMD_DONE_%d__", time.Now().UnixNano())
+	marker, err := newMarker()
+	if err != nil {
+		return CommandResult{}, err
+	}
+
+	// Construct command with marker and error capture. eval makes the
+	// command one that bash abandons whole when stopForeground interrupts
+	// it, while still parsing and running it a command at a time.
+	fullCommand := fmt.Sprintf("eval %s\n%s\n", shellQuote(command), markerCommand(marker))
 
-	// Construct command with marker and error capture
-	fullCommand := fmt.Sprintf("%s\necho '%s'$?\n", command, marker)
+	// What is running now was started by earlier commands
+	if jobs, err := childProcesses(bs.getPID()); err == nil {
+		bs.background.Store(&jobs)
+	} else {
+		bs.background.Store(nil)
+	}
 
 	// Write command to bash
+	started := time.Now()
 	if _, err := bs.stdin.Write([]byte(fullCommand)); err != nil {
-		bs.running = false
-		return "", fmt.Errorf("failed to write command: %w", err)
+		bs.markStopped()
+		if exitErr := bs.awaitExit(); exitErr != nil {
+			return CommandResult{}, exitErr
+		}
+		return CommandResult{}, fmt.Errorf("failed to write command: %w", err)
 	}
 
+	// Output seen from now on counts as activity for the idle limit
+	bs.lastActivity.Store(time.Now().UnixNano())
+
 	// Read stdout until we see the completion marker
-	outputChan := make(chan string, 1)
+	outputChan := make(chan CommandResult, 1)
 	errorChan := make(chan error, 1)
+	var partial string // what was read, if stdout closes early
+	var progress *progressBuffer
+	if limits.progress != nil {
+		progress = &progressBuffer{}
+	}
 
 	go func() {
-		var output strings.Builder
-		truncated := false
+		output := newCappedBuffer(bs.maxOutput, bs.truncation).retain(bs.keepOutput)
+		var jobs []string
+		blank := 0 // empty lines held back until a non-empty line follows
+		// Progress streams output up to the size limit, whatever the
+		// truncation mode, then says it stopped
+		streamed, streamStopped := 0, false
+		stream := func(text string) {
+			if streamed < bs.maxOutput {
+				progress.write(text)
+				streamed += len(text)
+			} else if !streamStopped {
+				streamStopped = true
+				progress.write(fmt.Sprintf("\n... [output truncated at %d bytes] ...\n", bs.maxOutput))
+			}
+		}
+
 		scanner := bufio.NewScanner(bs.stdout)
 		// FIX: Increase scanner buffer to handle long output lines.
 		// Default 64KB limit caused "token too long" errors with large
 		// JSON output from commands like curl piped through python3.
-		scanner.Buffer(make([]byte, 0, 64*1024), MaxScannerBufferSize)
+		scanner.Buffer(make([]byte, 0, min(64*1024, bs.maxLine)), bs.maxLine)
 
 		for scanner.Scan() {
 			line := scanner.Text()
-
-			// Check if this is our completion marker
-			if strings.HasPrefix(line, marker) {
-				// Extract exit code
-				exitCode := strings.TrimPrefix(line, marker)
-				if exitCode != "0" {
-					output.WriteString(fmt.Sprintf("\n[Exit code: %s]", exitCode))
+			bs.lastActivity.Store(time.Now().UnixNano())
+
+			// Check for our completion marker, which is printed on a line
+			// of its own. Blank lines held back before it include the one
+			// that puts it there and are dropped.
+			exitCode, pathLength, cwd, found := parseMarkerLine(line, marker)
+			if found {
+				stored := addOutputRef(nil, "stdout", output, bs.outputs)
+				text := output.String()
+				if exitCode != 0 {
+					text += fmt.Sprintf("\n[Exit code: %d]", exitCode)
+				}
+				if cwd != "" {
+					bs.workingDir.Store(&cwd)
 				}
-				outputChan <- output.String()
+				outputChan <- CommandResult{Output: text, ExitCode: exitCode, BackgroundJobs: jobs, StoredOutputs: stored,
+					Duration: time.Since(started), WorkingDirectory: cwd, PathLength: pathLength}
 				return
 			}
 
-			// FIX: Cap output size to prevent unbounded memory growth
-			if !truncated && output.Len() < MaxOutputSize {
-				output.WriteString(line)
-				output.WriteString("\n")
-			} else if !truncated {
-				truncated = true
-				output.WriteString(fmt.Sprintf("\n... [output truncated at %d bytes] ...\n", MaxOutputSize))
+			// Job-control notifications are reported separately
+			if isJobNotice(line) {
+				jobs = append(jobs, strings.TrimSpace(line))
+				continue
+			}
+
+			if line == "" {
+				blank++
+				continue
 			}
+			line = strings.Repeat("\n", blank) + bs.shellMessage(line)
+			blank = 0
+
+			// FIX: Cap output size to prevent unbounded memory growth
+			// (output is a cappedBuffer)
+			output.WriteString(line + "\n")
+			stream(line + "\n")
 		}
 
+		partial = strings.TrimRight(output.String(), "\n")
 		if err := scanner.Err(); err != nil {
+			if errors.Is(err, bufio.ErrTooLong) {
+				err = fmt.Errorf("output line longer than %d bytes: %w", bs.maxLine, err)
+			}
 			errorChan <- err
 			return
 		}
@@ -298,75 +1208,163 @@ func (bs *BashSession) execute(command string, ctx context.Context) (string, err
 		errorChan <- fmt.Errorf("stdout closed before command completion marker was received")
 	}()
 
-	// Wait for completion, timeout, or cancellation
-	select {
-	case <-ctx.Done():
-		// Kill the session immediately so the scanner goroutine unblocks
-		// and queued commands can start a fresh session without waiting.
-		fmt.Fprintf(os.Stderr, "Command cancelled/timed out, killing session (PID: %d)\n", bs.getPID())
-		bs.running = false
-		// Kill bash process to unblock the stdout scanner goroutine
-		if bs.cmd != nil && bs.cmd.Process != nil {
-			bs.cmd.Process.Kill()
-		}
-		if ctx.Err() == context.DeadlineExceeded {
-			return "", fmt.Errorf("command timed out")
+	// In idle mode, poll for inactivity alongside the other outcomes
+	var idleCheck <-chan time.Time
+	if limits.idle > 0 {
+		interval := limits.idle / 10
+		if interval > time.Second {
+			interval = time.Second
 		}
-		return "", fmt.Errorf("command cancelled")
-	case err := <-errorChan:
-		bs.running = false
-		return "", fmt.Errorf("error reading output: %w", err)
-	case output := <-outputChan:
-		// Trim trailing newline
-		output = strings.TrimRight(output, "\n")
-
-		// Give stderr a brief moment to flush, then collect it
-		time.Sleep(50 * time.Millisecond)
-		stderrOutput := bs.consumeStderr()
-		if stderrOutput != "" {
-			output = output + "\n\nSTDERR:\n" + stderrOutput
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		idleCheck = ticker.C
+	}
+
+	// Stream output in throttled chunks when asked to
+	var progressTick <-chan time.Time
+	if limits.progress != nil {
+		ticker := time.NewTicker(ProgressInterval)
+		defer ticker.Stop()
+		progressTick = ticker.C
+	}
+
+	// Wait for completion, timeout, or cancellation
+	for {
+		select {
+		case <-progressTick:
+			progress.flush(limits.progress)
+		case <-idleCheck:
+			idleFor := time.Since(time.Unix(0, bs.lastActivity.Load()))
+			if idleFor < limits.idle {
+				continue
+			}
+			result, survived := bs.stopForeground(outputChan, errorChan, &partial)
+			result.Duration = ranFor(result, started)
+			result.TimedOut = "idle"
+			return result, stoppedError(fmt.Errorf("%w: no output for %v (idle limit)", ErrCommandTimedOut, limits.idle), survived)
+		case <-ctx.Done():
+			// Stopped by the write quota: interrupted as a cancellation
+			// would be, but with its output so far
+			if cause := context.Cause(ctx); errors.Is(cause, ErrWriteQuotaExceeded) {
+				result, survived := bs.stopForeground(outputChan, errorChan, &partial)
+				result.Duration = ranFor(result, started)
+				return result, stoppedError(cause, survived)
+			}
+			if ctx.Err() == context.Canceled {
+				bs.stopForeground(outputChan, errorChan, &partial)
+				return CommandResult{}, ErrCommandCancelled
+			}
+			result, survived := bs.stopForeground(outputChan, errorChan, &partial)
+			result.Duration = ranFor(result, started)
+			result.TimedOut = "total"
+			if limits.idle > 0 {
+				return result, stoppedError(fmt.Errorf("%w: exceeded total limit of %v", ErrCommandTimedOut, limits.total), survived)
+			}
+			return result, stoppedError(fmt.Errorf("%w after %v", ErrCommandTimedOut, limits.total), survived)
+		case err := <-errorChan:
+			bs.markStopped()
+			if exitErr := bs.awaitExit(); exitErr != nil {
+				return CommandResult{}, fmt.Errorf("%w before the command finished", exitErr)
+			}
+			return CommandResult{}, fmt.Errorf("error reading output: %w", err)
+		case result := <-outputChan:
+			progress.flush(limits.progress)
+			return bs.finishResult(result), nil
 		}
+	}
+}
 
-		return output, nil
+// ranFor returns how long a stopped command ran: until its marker, if it
+// finished as it was stopped, otherwise until now
+func ranFor(result CommandResult, started time.Time) time.Duration {
+	if result.Duration > 0 {
+		return result.Duration
 	}
+	return time.Since(started)
+}
+
+// finishResult completes a result read up to the marker: trims the trailing
+// newline, appends the command's stderr, replaces invalid UTF-8, and notes an
+// interrupt. Caller
+// must hold bs.mutex.
+func (bs *BashSession) finishResult(result CommandResult) CommandResult {
+	output := strings.TrimRight(result.Output, "\n")
+
+	// Give stderr a brief moment to flush, then collect it
+	time.Sleep(50 * time.Millisecond)
+	stderrText, stored := bs.consumeStderr()
+	result.StoredOutputs = append(result.StoredOutputs, stored...)
+	stderrOutput, notices := splitJobNotices(stderrText)
+	result.BackgroundJobs = append(result.BackgroundJobs, notices...)
+	if stderrOutput != "" {
+		output = output + "\n\nSTDERR:\n" + stderrOutput
+	}
+
+	result.Stderr = stderrOutput
+	result.Output = strings.ToValidUTF8(output, "\uFFFD")
+	if sig := bs.interrupted.Swap(0); sig != 0 {
+		result.Interrupted = signalName(syscall.Signal(sig))
+	}
+	return result
+}
+
+// markStopped records that the session is no longer usable. Caller must hold
+// bs.mutex.
+func (bs *BashSession) markStopped() {
+	bs.running = false
+	bs.stopped.Store(true)
+}
+
+// killForTimeout kills the session after a timeout or cancellation so the
+// scanner goroutine unblocks and queued commands can start a fresh session
+// without waiting. The session is then closed in the background, once the
+// caller releases mutex: a process that left the session can hold stdout
+// open, and only reaping bash closes the pipe under the scanner so it exits
+// rather than waiting on that process. Caller must hold bs.mutex.
+func (bs *BashSession) killForTimeout() {
+	fmt.Fprintf(os.Stderr, "Command cancelled/timed out, killing session (PID: %d)\n", bs.getPID())
+	bs.markStopped()
+	// Kill bash process to unblock the stdout scanner goroutine
+	if bs.cmd != nil && bs.cmd.Process != nil {
+		bs.cmd.Process.Kill()
+	}
+	go bs.close()
 }
 
 // close closes the bash session and kills the process.
 // Safe to call multiple times and on sessions where running is already false.
 func (bs *BashSession) close() {
 	bs.mutex.Lock()
-	defer bs.mutex.Unlock()
-
 	wasRunning := bs.running
-	bs.running = false
-
+	bs.markStopped()
 	pid := bs.getPID()
 
-	// Close pipes — this will also unblock the stderr drainer goroutine
-	if bs.stdin != nil {
-		bs.stdin.Close()
-	}
-	if bs.stdout != nil {
-		bs.stdout.Close()
-	}
-	if bs.stderr != nil {
-		bs.stderr.Close()
-	}
-
-	// Kill the process
+	// Kill everything the session started, then bash, and close stdin.
+	// Descendants go first, as once bash has gone they are no longer found
+	// under it. The stdout and stderr pipes are left to their readers,
+	// which see EOF once the last process holding them has died. What the
+	// session started is noted first, to find what survives.
+	var tracked []sessionProcess
+	account := false
 	if bs.cmd != nil && bs.cmd.Process != nil {
+		if account = !bs.accounted.Swap(true); account {
+			tracked = sessionProcesses(pid, bs.marker)
+		}
+		killDescendants(pid)
 		bs.cmd.Process.Kill()
-		bs.cmd.Wait()
 	}
+	if bs.stdin != nil {
+		bs.stdin.Close()
+	}
+	bs.mutex.Unlock()
 
-	// Wait for the stderr drainer to finish (with a timeout to avoid hanging)
-	if bs.stderrDone != nil {
-		select {
-		case <-bs.stderrDone:
-		case <-time.After(2 * time.Second):
-			fmt.Fprintf(os.Stderr, "Warning: stderr drainer did not exit within timeout\n")
-		}
+	// Not holding mutex: a command started meanwhile fails at once on the
+	// stopped session rather than waiting for this. Orphans are dealt with
+	// first, as a daemon holding stderr open would hold up reap.
+	if account {
+		bs.accountOrphans(tracked)
 	}
+	bs.reap()
 
 	if wasRunning {
 		fmt.Fprintf(os.Stderr, "Closed bash session (PID: %d)\n", pid)
@@ -375,73 +1373,78 @@ func (bs *BashSession) close() {
 	}
 }
 
-// Close closes the bash manager and all sessions
-func (bm *BashManager) Close() {
-	bm.sessionMutex.Lock()
-	defer bm.sessionMutex.Unlock()
-
-	if bm.session != nil {
-		bm.session.close()
-		bm.session = nil
-	}
+// reap waits for bash to exit and the stderr drainer to reach EOF, then
+// closes the pipes. The close must come after the drainer's last read; a
+// process that escaped the kill (a daemon that left the session) can hold
+// stderr open, so after drainTimeout it is closed regardless. Only the first
+// call waits.
+func (bs *BashSession) reap() {
+	bs.reaped.Do(func() {
+		if bs.cmd == nil || bs.cmd.Process == nil {
+			return
+		}
+		<-bs.exited
+		select {
+		case <-bs.stderrDone:
+		case <-time.After(drainTimeout):
+			fmt.Fprintf(os.Stderr, "Warning: stderr of bash session (PID: %d) still open after %v; "+
+				"closing it\n", bs.getPID(), drainTimeout)
+		}
+		bs.stdout.Close()
+		bs.stderr.Close()
+	})
 }
 
-// Tool schemas
-
-// BashToolSchema defines the schema for bash_tool input
-var BashToolSchema = map[string]interface{}{
-	"type": "object",
-	"properties": map[string]interface{}{
-		"command": map[string]interface{}{
-			"type":        "string",
-			"description": "The bash command to execute",
-		},
-		"restart": map[string]interface{}{
-			"type":        "boolean",
-			"description": "Set to true to restart the bash session before executing the command",
-		},
-	},
-	"required": []string{"command"},
+// monitor waits for bash to exit and records how. The session is marked
+// stopped at once, so the next command starts a fresh session instead of
+// failing to write to this one. It replaces cmd.Wait, which would close the
+// pipes under their readers; reap closes them instead.
+func (bs *BashSession) monitor() {
+	state, err := bs.cmd.Process.Wait()
+	if err != nil {
+		bs.exitStatus = err.Error()
+	} else {
+		bs.exitStatus = state.String()
+	}
+	bs.stopped.Store(true)
+	close(bs.exited)
 }
 
-// BashTool defines the bash tool
-type BashTool struct {
-	Name        string
-	Description string
-	InputSchema map[string]interface{}
+// exitError returns an error saying how bash exited, or nil if it is still
+// running
+func (bs *BashSession) exitError() error {
+	select {
+	case <-bs.exited:
+		return fmt.Errorf("bash session exited (%s)", bs.exitStatus)
+	default:
+		return nil
+	}
 }
 
-// BashTools is the tool definition
-var BashTools = map[string]BashTool{
-	"bash": {
-		Name: "bash",
-		Description: "Execute bash commands in a persistent session. Commands are executed in a stateful bash environment " +
-			"where environment variables, working directory changes, and other session state persist between calls. " +
-			"Long-running commands will timeout after 120 seconds by default. " +
-			"Use 'restart: true' to start a fresh session if needed. " +
-			"Supports: pipelines, environment variables, cd commands, command chaining with && or ||, " +
-			"background processes, file I/O redirection, and most bash built-ins. " +
-			"Avoid: interactive commands (vim, less, top), commands requiring user input, sudo without NOPASSWD.",
-		InputSchema: BashToolSchema,
-	},
+// awaitExit is exitError for a session whose pipes have just failed, giving
+// monitor a moment to see the exit that probably caused it
+func (bs *BashSession) awaitExit() error {
+	select {
+	case <-bs.exited:
+	case <-time.After(exitGrace):
+	}
+	return bs.exitError()
 }
 
-// Argument parsing
-
-// ParseBashArgs parses arguments for bash tool
-func ParseBashArgs(args json.RawMessage) (command string, restart bool, err error) {
-	var params struct {
-		Command string `json:"command"`
-		Restart bool   `json:"restart"`
-	}
+// Close closes the bash manager and all sessions
+func (bm *BashManager) Close() {
+	bm.closeOnce.Do(func() { close(bm.stopReaper) })
 
-	if err := json.Unmarshal(args, &params); err != nil {
-		return "", false, fmt.Errorf("invalid arguments for bash tool: %w", err)
-	}
+	bm.sessionMutex.Lock()
+	defer bm.sessionMutex.Unlock()
 
-	if params.Command == "" {
-		return "", false, fmt.Errorf("command parameter is required")
+	if bm.session != nil {
+		bm.session.close()
+		bm.sessionClosed(bm.session, "shutdown")
+		bm.session = nil
+		bm.current.Store(nil)
 	}
-
-	return params.Command, params.Restart, nil
+	bm.releaseLocks(0)
+	bm.closeJobs()
+	bm.outputs.clear()
 }
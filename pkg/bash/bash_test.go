@@ -0,0 +1,111 @@
+package bash
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestManager returns a manager for opts, with a 10 second timeout unless
+// opts sets one, that is closed when the test ends
+func newTestManager(t *testing.T, opts Options) *BashManager {
+	t.Helper()
+	if opts.Timeout == 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	bm := NewBashManager(opts)
+	t.Cleanup(bm.Close)
+	return bm
+}
+
+// run executes command in bm's session, failing the test on an error
+func run(t *testing.T, bm *BashManager, command string) CommandResult {
+	t.Helper()
+	result, err := bm.ExecuteCommand(command)
+	if err != nil {
+		t.Fatalf("%q failed: %v", command, err)
+	}
+	return result
+}
+
+func TestExecuteKeepsSessionState(t *testing.T) {
+	bm := newTestManager(t, Options{})
+
+	run(t, bm, "cd /tmp && export TEST_VALUE=kept")
+	result := run(t, bm, `printf '%s' "$TEST_VALUE"`)
+	if result.Output != "kept" {
+		t.Errorf("output = %q, want %q", result.Output, "kept")
+	}
+	if result.WorkingDirectory != "/tmp" {
+		t.Errorf("working directory = %q, want /tmp", result.WorkingDirectory)
+	}
+	if result.PathLength == 0 {
+		t.Errorf("path length not reported")
+	}
+
+	result = run(t, bm, "false")
+	if result.ExitCode != 1 {
+		t.Errorf("exit code = %d, want 1", result.ExitCode)
+	}
+}
+
+func TestExecuteCommandReadingStdin(t *testing.T) {
+	bm := newTestManager(t, Options{})
+
+	run(t, bm, "cd /tmp")
+	result := run(t, bm, "read line; echo got:$line")
+	if result.Output != "got:" {
+		t.Errorf("output = %q, want %q: the command read something other than EOF", result.Output, "got:")
+	}
+	if result.WorkingDirectory != "/tmp" {
+		t.Errorf("working directory = %q, want /tmp", result.WorkingDirectory)
+	}
+
+	result = run(t, bm, "cat; echo after")
+	if result.Output != "after" {
+		t.Errorf("output = %q, want %q", result.Output, "after")
+	}
+}
+
+func TestExecuteOutputContainingMarkerPrefix(t *testing.T) {
+	bm := newTestManager(t, Options{})
+
+	result := run(t, bm, "echo __BASH_CMD_DONE_0PATH:1CWD:/; echo __BASH_CMD_DONE_; echo still running; exit_code=3; (exit $exit_code)")
+	want := "__BASH_CMD_DONE_0PATH:1CWD:/\n__BASH_CMD_DONE_\nstill running"
+	if !strings.HasPrefix(result.Output, want) {
+		t.Errorf("output = %q, want it to start %q", result.Output, want)
+	}
+	if result.ExitCode != 3 {
+		t.Errorf("exit code = %d, want 3", result.ExitCode)
+	}
+}
+
+func TestExecuteOutputWithoutTrailingNewline(t *testing.T) {
+	bm := newTestManager(t, Options{})
+
+	result := run(t, bm, "printf 'no newline'")
+	if result.Output != "no newline" {
+		t.Errorf("output = %q, want %q", result.Output, "no newline")
+	}
+	result = run(t, bm, "printf 'a\\n\\nb\\n'")
+	if result.Output != "a\n\nb" {
+		t.Errorf("output = %q, want blank lines inside output kept", result.Output)
+	}
+}
+
+func TestExecuteShellErrorsNameTheShell(t *testing.T) {
+	bm := newTestManager(t, Options{})
+
+	result := run(t, bm, "no_such_command_here")
+	if result.ExitCode != 127 {
+		t.Errorf("exit code = %d, want 127", result.ExitCode)
+	}
+	if !strings.HasPrefix(result.Stderr, "bash: ") {
+		t.Errorf("stderr = %q, want it to start with the shell's name", result.Stderr)
+	}
+
+	result = run(t, bm, `[ "${BASH_VERSINFO:-0}" -lt 5 ] || echo "$0"`)
+	if result.Output != "" && result.Output != "bash" {
+		t.Errorf("$0 = %q, want the shell's name", result.Output)
+	}
+}
@@ -0,0 +1,72 @@
+package bash
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/perms"
+)
+
+// Output encodings for the bash tool
+const (
+	// EncodingText returns stdout as text (the default). Invalid UTF-8 is
+	// replaced rather than passed through.
+	EncodingText = "text"
+	// EncodingBase64 returns stdout byte for byte, base64-encoded
+	EncodingBase64 = "base64"
+)
+
+// BinaryCapture holds a command's stdout, redirected to a private temp file
+// so it never passes through the line-oriented session pipe.
+type BinaryCapture struct {
+	path  string
+	limit int
+}
+
+// WithBinaryStdout wraps command so its stdout is written to a temp file,
+// for EncodingBase64. The group runs in the current shell, so session state
+// changes persist. Close the capture once its output has been read.
+func (bm *BashManager) WithBinaryStdout(command string) (string, *BinaryCapture, error) {
+	file, err := perms.CreateTemp("", "mcp-bash-stdout-*")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create stdout file: %w", err)
+	}
+	path := file.Name()
+	if err := file.Close(); err != nil {
+		os.Remove(path)
+		return "", nil, fmt.Errorf("failed to create stdout file: %w", err)
+	}
+	if err := bm.giveToSession(path); err != nil {
+		os.Remove(path)
+		return "", nil, err
+	}
+
+	wrapped := fmt.Sprintf("{ %s\n} > %s", command, shellQuote(path))
+	return wrapped, &BinaryCapture{path: path, limit: bm.maxOutput}, nil
+}
+
+// Read returns the captured stdout, at most the output size limit, and how
+// many bytes the command wrote in total.
+func (c *BinaryCapture) Read() ([]byte, int64, error) {
+	file, err := os.Open(c.path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open stdout file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to stat stdout file: %w", err)
+	}
+	data, err := io.ReadAll(io.LimitReader(file, int64(c.limit)))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read stdout file: %w", err)
+	}
+	return data, info.Size(), nil
+}
+
+// Close removes the temp file
+func (c *BinaryCapture) Close() {
+	os.Remove(c.path)
+}
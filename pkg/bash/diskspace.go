@@ -0,0 +1,182 @@
+package bash
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default disk space thresholds
+const (
+	DefaultDiskWarnPercent = 5.0
+	DefaultDiskWarnBytes   = 512 * 1024 * 1024 // 512MB
+	DefaultDiskCacheTTL    = 5 * time.Second
+)
+
+// DiskUsage is the free and total space of the filesystem holding a path
+type DiskUsage struct {
+	Free  uint64 // bytes available to unprivileged users
+	Total uint64
+}
+
+// DiskSpaceOptions configures a DiskMonitor
+type DiskSpaceOptions struct {
+	// A warning is attached when free space falls below either threshold
+	WarnPercent float64
+	WarnBytes   uint64
+
+	// FloorBytes, when non-zero, is the hard floor below which write
+	// operations are refused.
+	FloorBytes uint64
+
+	// WatchRoots are checked in addition to the session cwd and temp dir
+	WatchRoots []string
+
+	// CacheTTL is how long a statfs result is reused
+	CacheTTL time.Duration
+}
+
+// DiskMonitor checks free space on the filesystems a command is likely to
+// write to. Results are cached so checking before every command is cheap.
+type DiskMonitor struct {
+	opts DiskSpaceOptions
+
+	// statfs and now are swappable so the thresholds can be exercised
+	// without filling a real disk.
+	statfs func(path string) (DiskUsage, error)
+	now    func() time.Time
+
+	mutex sync.Mutex
+	cache map[string]cachedUsage
+}
+
+type cachedUsage struct {
+	usage DiskUsage
+	err   error
+	at    time.Time
+}
+
+// DiskReport is the outcome of a disk space check
+type DiskReport struct {
+	Warnings   []string // one line per path below the warning threshold
+	BelowFloor []string // paths below the hard floor
+}
+
+// NewDiskMonitor creates a disk monitor, filling in default thresholds
+func NewDiskMonitor(opts DiskSpaceOptions) *DiskMonitor {
+	if opts.WarnPercent == 0 {
+		opts.WarnPercent = DefaultDiskWarnPercent
+	}
+	if opts.WarnBytes == 0 {
+		opts.WarnBytes = DefaultDiskWarnBytes
+	}
+	if opts.CacheTTL == 0 {
+		opts.CacheTTL = DefaultDiskCacheTTL
+	}
+	return &DiskMonitor{
+		opts:   opts,
+		statfs: statfs,
+		now:    time.Now,
+		cache:  make(map[string]cachedUsage),
+	}
+}
+
+// Check inspects the given paths plus the temp dir and watch roots. Paths
+// that don't exist or can't be inspected are skipped; this is advisory only.
+func (m *DiskMonitor) Check(paths ...string) DiskReport {
+	var report DiskReport
+	seen := make(map[string]bool)
+
+	all := append(append(append([]string{}, paths...), os.TempDir()), m.opts.WatchRoots...)
+	for _, path := range all {
+		if path == "" || seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		usage, err := m.usage(path)
+		if err != nil || usage.Total == 0 {
+			continue
+		}
+
+		percent := float64(usage.Free) / float64(usage.Total) * 100
+		if usage.Free < m.opts.WarnBytes || percent < m.opts.WarnPercent {
+			report.Warnings = append(report.Warnings,
+				fmt.Sprintf("%s has %s free (%.0f%%)", path, formatBytes(usage.Free), percent))
+		}
+		if m.opts.FloorBytes > 0 && usage.Free < m.opts.FloorBytes {
+			report.BelowFloor = append(report.BelowFloor, path)
+		}
+	}
+	return report
+}
+
+// Warning formats the report's warnings as a single message, or "" if none
+func (r DiskReport) Warning() string {
+	if len(r.Warnings) == 0 {
+		return ""
+	}
+	return "Warning: low disk space: " + strings.Join(r.Warnings, "; ")
+}
+
+// FloorError returns an error describing why a write was refused, or nil
+func (m *DiskMonitor) FloorError(r DiskReport) error {
+	if len(r.BelowFloor) == 0 {
+		return nil
+	}
+	return fmt.Errorf("refusing to write: %s below the configured floor of %s free",
+		strings.Join(r.BelowFloor, ", "), formatBytes(m.opts.FloorBytes))
+}
+
+// usage returns the cached statfs result for path, refreshing it when stale
+func (m *DiskMonitor) usage(path string) (DiskUsage, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := m.now()
+	if c, ok := m.cache[path]; ok && now.Sub(c.at) < m.opts.CacheTTL {
+		return c.usage, c.err
+	}
+	usage, err := m.statfs(path)
+	m.cache[path] = cachedUsage{usage: usage, err: err, at: now}
+	return usage, err
+}
+
+// ExistingDir returns the nearest existing directory containing path, so a
+// file that is about to be created can still be checked.
+func ExistingDir(path string) string {
+	dir := filepath.Dir(path)
+	for {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// formatBytes renders a byte count with a binary unit, e.g. "120MB"
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	value, suffix := float64(n), ""
+	for _, s := range []string{"KB", "MB", "GB", "TB"} {
+		value /= unit
+		suffix = s
+		if value < unit {
+			break
+		}
+	}
+	if value < 10 {
+		return fmt.Sprintf("%.1f%s", value, suffix)
+	}
+	return fmt.Sprintf("%.0f%s", value, suffix)
+}
@@ -0,0 +1,90 @@
+package bash
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeDisk returns a monitor whose filesystems report the given free space
+// out of 100GB; paths not listed have plenty. calls counts statfs calls.
+func fakeDisk(opts DiskSpaceOptions, free map[string]uint64, calls *int) *DiskMonitor {
+	const total = 100 << 30
+	m := NewDiskMonitor(opts)
+	m.statfs = func(path string) (DiskUsage, error) {
+		*calls++
+		if bytes, ok := free[path]; ok {
+			return DiskUsage{Free: bytes, Total: total}, nil
+		}
+		return DiskUsage{Free: total / 2, Total: total}, nil
+	}
+	return m
+}
+
+func TestDiskMonitorWarnsAndEnforcesFloor(t *testing.T) {
+	var calls int
+	m := fakeDisk(DiskSpaceOptions{FloorBytes: 100 << 20}, map[string]uint64{
+		"/low":   300 << 20,
+		"/empty": 10 << 20,
+	}, &calls)
+
+	report := m.Check("/fine")
+	if report.Warning() != "" || m.FloorError(report) != nil {
+		t.Errorf("warning %q for a filesystem with plenty free", report.Warning())
+	}
+
+	report = m.Check("/low")
+	if !strings.Contains(report.Warning(), "/low has 300MB free") {
+		t.Errorf("warning = %q", report.Warning())
+	}
+	if m.FloorError(report) != nil {
+		t.Errorf("floor error above the floor")
+	}
+
+	report = m.Check("/empty")
+	if err := m.FloorError(report); err == nil || !strings.Contains(err.Error(), "/empty") {
+		t.Errorf("floor error = %v, want /empty refused", err)
+	}
+}
+
+func TestDiskMonitorWatchRootsAndCache(t *testing.T) {
+	var calls int
+	now := time.Unix(0, 0)
+	m := fakeDisk(DiskSpaceOptions{WatchRoots: []string{"/data"}, CacheTTL: time.Minute},
+		map[string]uint64{"/data": 1 << 20}, &calls)
+	m.now = func() time.Time { return now }
+
+	if report := m.Check("/work"); !strings.Contains(report.Warning(), "/data") {
+		t.Errorf("watch root not checked: %q", report.Warning())
+	}
+	before := calls
+	m.Check("/work")
+	if calls != before {
+		t.Errorf("statfs called %d more times within the cache TTL", calls-before)
+	}
+	now = now.Add(2 * time.Minute)
+	m.Check("/work")
+	if calls == before {
+		t.Errorf("stale results not refreshed")
+	}
+}
+
+func TestExistingDir(t *testing.T) {
+	dir := t.TempDir()
+	if got := ExistingDir(dir + "/missing/deeper/file.txt"); got != dir {
+		t.Errorf("ExistingDir = %q, want %q", got, dir)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for n, want := range map[uint64]string{
+		512:       "512B",
+		1536:      "1.5KB",
+		300 << 20: "300MB",
+		5 << 40:   "5.0TB",
+	} {
+		if got := formatBytes(n); got != want {
+			t.Errorf("formatBytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package bash
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/events"
+)
+
+// Events returns the bus server events are published to, or nil
+func (bm *BashManager) Events() *events.Bus {
+	return bm.events
+}
+
+// publishStarted records that session has started
+func (bm *BashManager) publishStarted(session *BashSession) {
+	bm.events.Publish(events.SessionStarted, fmt.Sprintf("Bash session %d started", session.id),
+		map[string]interface{}{"session": session.id, "pid": session.getPID()})
+}
+
+// sessionClosed handles session ending, once however many times it is
+// noticed: the locks taken in it are released and the close is published
+// with the reason
+func (bm *BashManager) sessionClosed(session *BashSession, reason string) {
+	session.closeEvent.Do(func() {
+		bm.releaseLocks(session.id)
+		bm.events.Publish(events.SessionClosed, fmt.Sprintf("Bash session %d closed (%s)", session.id, reason),
+			map[string]interface{}{"session": session.id, "reason": reason})
+	})
+}
+
+// closeReason says why a command's session stopped, from its error
+func closeReason(err error) string {
+	switch {
+	case errors.Is(err, ErrCommandTimedOut):
+		return "timeout"
+	case errors.Is(err, ErrCommandCancelled):
+		return "cancelled"
+	}
+	return "exited"
+}
+
+// publishResult publishes the session warnings and finished background jobs
+// a command's result carries
+func (bm *BashManager) publishResult(session *BashSession, result CommandResult) {
+	if bm.events == nil {
+		return
+	}
+	for _, warning := range result.Warnings {
+		bm.events.Publish(events.Warning, warning, map[string]interface{}{"session": session.id})
+	}
+	for _, notice := range result.BackgroundJobs {
+		if jobFinished(notice) {
+			bm.events.Publish(events.JobCompleted, notice, map[string]interface{}{"session": session.id})
+		}
+	}
+}
+
+// EventsPollToolSchema defines the schema for events_poll input
+var EventsPollToolSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"ack": map[string]interface{}{
+			"type": "integer",
+			"description": "Sequence number of the last event already handled (the previous poll's lastSeq). " +
+				"Events up to it are discarded; omit or pass 0 on the first poll",
+		},
+		"limit": map[string]interface{}{
+			"type":        "integer",
+			"description": "Maximum events to return (default: all buffered events)",
+		},
+	},
+}
+
+// ParseEventsPollArgs parses arguments for the events_poll tool
+func ParseEventsPollArgs(args json.RawMessage) (ack uint64, limit int, err error) {
+	var params struct {
+		Ack   int64 `json:"ack"`
+		Limit int   `json:"limit"`
+	}
+
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &params); err != nil {
+			return 0, 0, fmt.Errorf("invalid arguments for events_poll tool: %w", err)
+		}
+	}
+
+	if params.Ack < 0 {
+		return 0, 0, fmt.Errorf("ack must not be negative")
+	}
+	if params.Limit < 0 {
+		return 0, 0, fmt.Errorf("limit must not be negative")
+	}
+
+	return uint64(params.Ack), params.Limit, nil
+}
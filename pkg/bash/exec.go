@@ -0,0 +1,194 @@
+package bash
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ExecToolSchema defines the schema for exec input
+var ExecToolSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"argv": map[string]interface{}{
+			"type":        "array",
+			"items":       map[string]interface{}{"type": "string"},
+			"minItems":    1,
+			"description": "Program and arguments, e.g. [\"ls\", \"-la\", \"/tmp\"]. No shell is involved, so nothing is expanded or split",
+		},
+		"cwd": map[string]interface{}{
+			"type":        "string",
+			"description": "Directory to run in (default: the server's working directory)",
+		},
+		"env": map[string]interface{}{
+			"type":                 "object",
+			"description":          "Environment variables to add for this process",
+			"additionalProperties": map[string]interface{}{"type": "string"},
+		},
+		"stdin": map[string]interface{}{
+			"type":        "string",
+			"description": "Data to pass to the process on standard input (default: none)",
+		},
+		"timeout": map[string]interface{}{
+			"type":        "integer",
+			"minimum":     1,
+			"description": "Timeout in seconds (default: the command timeout, capped by the server maximum)",
+		},
+		"weight": map[string]interface{}{
+			"type":    "integer",
+			"minimum": 0,
+			"description": "How heavy the program is (e.g. a large build or install), in units of the server's " +
+				"admission budget. Heavy programs wait for units before running, so parallel ones can't exhaust " +
+				"the host. Overrides the server's own classification; 0 marks the program light. Ignored unless " +
+				"the server has an admission budget",
+		},
+	},
+	"required": []string{"argv"},
+}
+
+// ExecArgs holds the parsed arguments for the exec tool
+type ExecArgs struct {
+	Argv    []string          `json:"argv"`
+	Cwd     string            `json:"cwd"`
+	Env     map[string]string `json:"env"`
+	Stdin   *string           `json:"stdin"`
+	Timeout int               `json:"timeout"` // seconds; 0 means the default
+	Weight  *int              `json:"weight"`  // nil means classified by the server
+}
+
+// ParseExecArgs parses arguments for the exec tool
+func ParseExecArgs(args json.RawMessage) (ExecArgs, error) {
+	var params ExecArgs
+
+	if err := json.Unmarshal(args, &params); err != nil {
+		return params, fmt.Errorf("invalid arguments for exec tool: %w", err)
+	}
+
+	if len(params.Argv) == 0 || params.Argv[0] == "" {
+		return params, fmt.Errorf("argv parameter is required and must name a program")
+	}
+
+	if params.Timeout < 0 {
+		return params, fmt.Errorf("timeout must not be negative")
+	}
+
+	if params.Weight != nil && *params.Weight < 0 {
+		return params, fmt.Errorf("weight must not be negative")
+	}
+
+	for name := range params.Env {
+		if !envNamePattern.MatchString(name) {
+			return params, fmt.Errorf("invalid environment variable name %q", name)
+		}
+	}
+
+	if params.Stdin != nil && len(*params.Stdin) > MaxStdinSize {
+		return params, fmt.Errorf("stdin is %d bytes; the maximum is %d", len(*params.Stdin), MaxStdinSize)
+	}
+
+	return params, nil
+}
+
+// String renders argv as a shell-quoted line, for logs and policy checks
+func (a ExecArgs) String() string {
+	quoted := make([]string, len(a.Argv))
+	for i, arg := range a.Argv {
+		quoted[i] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// Exec runs a program directly, without a shell, so it works on hosts with
+// no bash at all. Output is capped and formatted like session results. It
+// is killed, with its children, on timeout or when ctx is cancelled.
+func (bm *BashManager) Exec(ctx context.Context, args ExecArgs) (CommandResult, error) {
+	timeout, _ := bm.ClampTimeout(time.Duration(args.Timeout) * time.Second)
+	if timeout == 0 {
+		timeout = bm.defaultTimeout
+	}
+
+	path, err := exec.LookPath(args.Argv[0])
+	if err != nil {
+		return CommandResult{}, fmt.Errorf("executable not found: %s", args.Argv[0])
+	}
+
+	cmd := bm.sandboxed(exec.Command(path, args.Argv[1:]...))
+	cmd.Dir = args.Cwd
+	cmd.Env = os.Environ()
+	if bm.jail != nil {
+		if cmd.Dir, err = bm.jail.Resolve(args.Cwd); err != nil {
+			return CommandResult{}, fmt.Errorf("cwd: %w", err)
+		}
+		cmd.Env = append(cmd.Env, bm.jail.env()...)
+	}
+	if bm.roots != nil {
+		if !filepath.IsAbs(cmd.Dir) {
+			cmd.Dir = filepath.Join(bm.commandDir(), cmd.Dir)
+		}
+		if cmd.Dir, err = bm.roots.Check(cmd.Dir); err != nil {
+			return CommandResult{}, fmt.Errorf("cwd: %w", err)
+		}
+	}
+	if bm.noColor {
+		cmd.Env = appendNoColor(cmd.Env)
+	}
+	if bm.runAs != nil {
+		cmd.Env = bm.runAs.env(cmd.Env)
+	}
+	names := make([]string, 0, len(args.Env))
+	for name := range args.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cmd.Env = append(cmd.Env, name+"="+args.Env[name])
+	}
+	if args.Stdin != nil {
+		cmd.Stdin = strings.NewReader(*args.Stdin)
+	}
+	bm.runAs.setCredential(cmd)
+	setProcessGroup(cmd)
+
+	stdout := bm.newOutputBuffer()
+	stderr := bm.newOutputBuffer()
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	started := time.Now()
+	if err := cmd.Start(); err != nil {
+		return CommandResult{}, fmt.Errorf("failed to start %s: %w", args.Argv[0], err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case waitErr := <-done:
+		result, err := processResult(stdout, stderr, waitErr, bm.outputs)
+		result.Duration = time.Since(started)
+		if err == nil {
+			fmt.Fprintf(os.Stderr, "Program finished in %v (exit code %d)\n", result.Duration.Round(time.Millisecond),
+				result.ExitCode)
+		}
+		return result, err
+	case <-ctx.Done():
+		killProcessGroup(cmd)
+		<-done
+		return CommandResult{}, ErrCommandCancelled
+	case <-timer.C:
+		killProcessGroup(cmd)
+		<-done
+		result, _ := processResult(stdout, stderr, nil, bm.outputs)
+		result.Duration = time.Since(started)
+		return result, fmt.Errorf("%w after %v", ErrCommandTimedOut, timeout)
+	}
+}
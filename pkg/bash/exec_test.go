@@ -0,0 +1,81 @@
+package bash
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecRunsArgvWithoutShell(t *testing.T) {
+	bm := newTestManager(t, Options{})
+
+	stdin := "from stdin"
+	result, err := bm.Exec(context.Background(), ExecArgs{
+		Argv:  []string{"sh", "-c", `printf '%s|%s|%s|' "$1" "$EXEC_VAR" "$PWD"; cat`, "sh", "$HOME 'quoted' *"},
+		Cwd:   "/tmp",
+		Env:   map[string]string{"EXEC_VAR": "set"},
+		Stdin: &stdin,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "$HOME 'quoted' *|set|/tmp|from stdin"; result.Output != want {
+		t.Errorf("output = %q, want %q", result.Output, want)
+	}
+
+	result, err = bm.Exec(context.Background(), ExecArgs{Argv: []string{"sh", "-c", "echo oops >&2; exit 3"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ExitCode != 3 || result.Stderr != "oops\n" {
+		t.Errorf("exit %d, stderr %q; want 3 and oops", result.ExitCode, result.Stderr)
+	}
+}
+
+func TestExecErrors(t *testing.T) {
+	bm := newTestManager(t, Options{})
+
+	if _, err := bm.Exec(context.Background(), ExecArgs{Argv: []string{"no-such-program-here"}}); err == nil ||
+		!strings.Contains(err.Error(), "executable not found") {
+		t.Errorf("err = %v, want executable not found", err)
+	}
+
+	started := time.Now()
+	_, err := bm.Exec(context.Background(), ExecArgs{Argv: []string{"sleep", "30"}, Timeout: 1})
+	if !errors.Is(err, ErrCommandTimedOut) {
+		t.Errorf("err = %v, want a timeout", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := bm.Exec(ctx, ExecArgs{Argv: []string{"sleep", "30"}}); !errors.Is(err, ErrCommandCancelled) {
+		t.Errorf("err = %v, want cancelled", err)
+	}
+	if elapsed := time.Since(started); elapsed > 10*time.Second {
+		t.Errorf("stopping the programs took %v", elapsed)
+	}
+}
+
+func TestParseExecArgs(t *testing.T) {
+	for _, args := range []string{
+		`{}`,
+		`{"argv":[""]}`,
+		`{"argv":["ls"],"timeout":-1}`,
+		`{"argv":["ls"],"env":{"BAD NAME":"x"}}`,
+	} {
+		if _, err := ParseExecArgs(json.RawMessage(args)); err == nil {
+			t.Errorf("%s accepted", args)
+		}
+	}
+
+	args, err := ParseExecArgs(json.RawMessage(`{"argv":["echo","a b","it's"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := args.String(); got != `'echo' 'a b' 'it'\''s'` {
+		t.Errorf("String() = %s", got)
+	}
+}
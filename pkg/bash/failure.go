@@ -0,0 +1,149 @@
+package bash
+
+import (
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// Failure classes reported in FailureContext.Class
+const (
+	FailureNotFound   = "not_found"    // the command doesn't exist (exit 127)
+	FailurePermission = "permission"   // not executable, or access denied (exit 126)
+	FailureSyntax     = "syntax"       // the shell couldn't parse the command
+	FailureSignal     = "signal"       // killed by a signal
+	FailureNoSuchFile = "no_such_file" // a file or directory it needed is missing
+	FailureError      = "error"        // any other non-zero exit
+)
+
+const (
+	// failureStderrLines is how many trailing stderr lines a failure
+	// context carries
+	failureStderrLines = 5
+
+	// maxCommandHistory bounds how many succeeded commands are remembered
+	maxCommandHistory = 256
+)
+
+// FailureContext describes why a command failed, for clients that retry
+// automatically. It rides along in the result; nothing depends on it.
+type FailureContext struct {
+	Class string `json:"class"`
+	// Signal names the signal that stopped the command, for FailureSignal
+	Signal string `json:"signal,omitempty"`
+	// StderrTail is the last few lines the command wrote to stderr
+	StderrTail []string `json:"stderrTail,omitempty"`
+	// PreviouslySucceeded: the same command succeeded earlier under this
+	// server. RestartedSince: that was in an earlier session, so session
+	// state it relied on may be gone.
+	PreviouslySucceeded bool `json:"previouslySucceeded"`
+	RestartedSince      bool `json:"restartedSince,omitempty"`
+}
+
+// commandHistory remembers which session each command last succeeded in
+type commandHistory struct {
+	mutex     sync.Mutex
+	succeeded map[string]int
+	order     []string
+}
+
+// record notes that command succeeded in session, forgetting the oldest
+// entry once the history is full
+func (h *commandHistory) record(command string, session int) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.succeeded == nil {
+		h.succeeded = make(map[string]int)
+	}
+	if _, seen := h.succeeded[command]; !seen {
+		if len(h.order) == maxCommandHistory {
+			delete(h.succeeded, h.order[0])
+			h.order = h.order[1:]
+		}
+		h.order = append(h.order, command)
+	}
+	h.succeeded[command] = session
+}
+
+// lastSuccess returns the session command last succeeded in
+func (h *commandHistory) lastSuccess(command string) (int, bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	session, ok := h.succeeded[command]
+	return session, ok
+}
+
+// AnalyzeResult returns the failure context of a finished command, or nil if
+// it succeeded, in which case it is remembered so a later failure of the same
+// command can say so. command is what the client asked to run.
+func (bm *BashManager) AnalyzeResult(command string, result CommandResult) *FailureContext {
+	session := bm.SessionID()
+	if result.ExitCode == 0 && result.Interrupted == "" {
+		bm.history.record(command, session)
+		return nil
+	}
+
+	failure := ClassifyFailure(result)
+	if last, ok := bm.history.lastSuccess(command); ok {
+		failure.PreviouslySucceeded = true
+		failure.RestartedSince = last != session
+	}
+	return failure
+}
+
+// ClassifyFailure works out the failure class of a command that exited
+// non-zero or was interrupted, from its exit code and stderr. Bash reports a
+// command killed by signal N as exit code 128+N; Go reports -1 for a process
+// it ran directly.
+func ClassifyFailure(result CommandResult) *FailureContext {
+	failure := &FailureContext{StderrTail: stderrTail(result.Stderr, failureStderrLines)}
+	stderr := result.Stderr
+	code := result.ExitCode
+
+	switch {
+	case result.Interrupted != "":
+		failure.Class = FailureSignal
+		failure.Signal = result.Interrupted
+	case code > 128 && code <= 128+64:
+		failure.Class = FailureSignal
+		failure.Signal = signalName(syscall.Signal(code - 128))
+	case code < 0:
+		failure.Class = FailureSignal
+	case containsAny(stderr, "syntax error", "unexpected EOF while looking for", "unexpected end of file"):
+		failure.Class = FailureSyntax
+	case code == 127 || containsAny(stderr, "command not found"):
+		failure.Class = FailureNotFound
+	case code == 126 || containsAny(stderr, "Permission denied", "Operation not permitted"):
+		failure.Class = FailurePermission
+	case containsAny(stderr, "No such file or directory"):
+		failure.Class = FailureNoSuchFile
+	default:
+		failure.Class = FailureError
+	}
+	return failure
+}
+
+// stderrTail returns the last n non-empty lines of stderr
+func stderrTail(stderr string, n int) []string {
+	lines := strings.Split(strings.TrimRight(stderr, "\n"), "\n")
+	var tail []string
+	for i := len(lines) - 1; i >= 0 && len(tail) < n; i-- {
+		if line := strings.TrimSpace(lines[i]); line != "" {
+			tail = append(tail, line)
+		}
+	}
+	for i, j := 0, len(tail)-1; i < j; i, j = i+1, j-1 {
+		tail[i], tail[j] = tail[j], tail[i]
+	}
+	return tail
+}
+
+// containsAny reports whether s contains any of substrings
+func containsAny(s string, substrings ...string) bool {
+	for _, sub := range substrings {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,481 @@
+package bash
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/collate"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/perms"
+)
+
+const (
+	// DefaultFetchMaxBytes is the largest download fetch_artifact accepts
+	// when the call doesn't set max_bytes
+	DefaultFetchMaxBytes = 512 * 1024 * 1024
+
+	// DefaultFetchTimeout bounds a download when the call doesn't set one
+	DefaultFetchTimeout = 5 * time.Minute
+
+	// fetchExtractRatio bounds what an archive may expand to, as a multiple
+	// of the download size cap
+	fetchExtractRatio = 10
+
+	// fetchMaxRedirects is how many redirects a download may follow
+	fetchMaxRedirects = 10
+)
+
+// Kinds of fetch_artifact failure, reported in the result's structured
+// content so clients can tell them apart
+const (
+	FetchErrInvalid  = "invalid_request"
+	FetchErrNetwork  = "network_error"
+	FetchErrTLS      = "tls_error"
+	FetchErrTimeout  = "timeout"
+	FetchErrHTTP     = "http_status"
+	FetchErrTooLarge = "too_large"
+	FetchErrMismatch = "checksum_mismatch"
+	FetchErrExtract  = "extract_failed"
+	FetchErrWrite    = "write_failed"
+)
+
+// FetchError is a failed fetch_artifact call. Kind is one of the FetchErr
+// constants.
+type FetchError struct {
+	Kind string
+	Err  error
+}
+
+func (e *FetchError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// fetchError builds a FetchError from a message
+func fetchError(kind, format string, args ...interface{}) *FetchError {
+	return &FetchError{Kind: kind, Err: fmt.Errorf(format, args...)}
+}
+
+// FetchArgs holds the parsed arguments for the fetch_artifact tool
+type FetchArgs struct {
+	URL         string `json:"url"`
+	Checksum    string `json:"checksum"`
+	Destination string `json:"destination"`
+	Filename    string `json:"filename"`
+	Extract     bool   `json:"extract"`
+	Overwrite   bool   `json:"overwrite"`
+	MaxBytes    int64  `json:"max_bytes"`
+	Timeout     int    `json:"timeout"` // seconds; 0 means the default
+
+	// algorithm and digest are Checksum split at its prefix
+	algorithm string
+	digest    string
+}
+
+// FetchResult describes a verified download
+type FetchResult struct {
+	URL       string `json:"url"`
+	FinalURL  string `json:"finalUrl"`
+	Size      int64  `json:"size"`
+	Algorithm string `json:"algorithm"`
+	Digest    string `json:"digest"`
+	// Path is the saved file, or the directory an archive was extracted to
+	Path string `json:"path"`
+	// Format and ExtractedFiles are set when the download was extracted
+	Format         string `json:"format,omitempty"`
+	ExtractedFiles int    `json:"extractedFiles,omitempty"`
+}
+
+// fetchHashes are the checksum algorithms fetch_artifact accepts. MD5 and
+// SHA-1 are left out: they don't protect against a tampered artifact.
+var fetchHashes = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// FetchToolSchema defines the schema for fetch_artifact input
+var FetchToolSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"url": map[string]interface{}{
+			"type":        "string",
+			"description": "URL to download (https)",
+		},
+		"checksum": map[string]interface{}{
+			"type": "string",
+			"description": "Expected digest with its algorithm, e.g. sha256:9f86d0... (sha256, sha384 or sha512). " +
+				"Nothing is kept if the download doesn't match",
+		},
+		"destination": map[string]interface{}{
+			"type": "string",
+			"description": "Directory to save or extract into. Relative paths are resolved against the session's " +
+				"current directory. Created if missing",
+		},
+		"filename": map[string]interface{}{
+			"type":        "string",
+			"description": "Name to save the file as (default: the last element of the URL path). Ignored with extract",
+		},
+		"extract": map[string]interface{}{
+			"type":        "boolean",
+			"description": "Unpack the verified download (tar, tar.gz, tar.bz2 or zip) into destination instead of saving it",
+		},
+		"overwrite": map[string]interface{}{
+			"type":        "boolean",
+			"description": "Replace existing files in destination. Without it the call fails rather than overwrite",
+		},
+		"max_bytes": map[string]interface{}{
+			"type":        "integer",
+			"description": fmt.Sprintf("Largest download accepted, in bytes (default %d)", DefaultFetchMaxBytes),
+		},
+		"timeout": map[string]interface{}{
+			"type": "integer",
+			"description": fmt.Sprintf("Timeout for the download in seconds (default %d). Capped by the server's maxTimeout",
+				int(DefaultFetchTimeout.Seconds())),
+		},
+		"confirm_token": map[string]interface{}{
+			"type": "string",
+			"description": "Token from the preview of this exact call, where the server requires confirmation " +
+				"before the change is made",
+		},
+	},
+	"required": []string{"url", "checksum", "destination"},
+}
+
+// ParseFetchArgs parses arguments for the fetch_artifact tool
+func ParseFetchArgs(args json.RawMessage) (FetchArgs, error) {
+	var params FetchArgs
+	if err := json.Unmarshal(args, &params); err != nil {
+		return params, fmt.Errorf("invalid arguments for fetch_artifact tool: %w", err)
+	}
+
+	if params.URL == "" {
+		return params, fmt.Errorf("url parameter is required")
+	}
+	if params.Destination == "" {
+		return params, fmt.Errorf("destination parameter is required")
+	}
+	if params.MaxBytes < 0 {
+		return params, fmt.Errorf("max_bytes must not be negative")
+	}
+	if params.Timeout < 0 {
+		return params, fmt.Errorf("timeout must not be negative")
+	}
+	if params.Filename != "" && (params.Filename != filepath.Base(params.Filename) || params.Filename == "..") {
+		return params, fmt.Errorf("filename must be a plain file name")
+	}
+
+	algorithm, digest, ok := strings.Cut(params.Checksum, ":")
+	if !ok {
+		return params, fmt.Errorf("checksum must be prefixed with its algorithm, e.g. sha256:<hex>")
+	}
+	params.algorithm = strings.ToLower(algorithm)
+	newHash, known := fetchHashes[params.algorithm]
+	if !known {
+		return params, fmt.Errorf("unsupported checksum algorithm %q (expected sha256, sha384 or sha512)", algorithm)
+	}
+	params.digest = strings.ToLower(digest)
+	if decoded, err := hex.DecodeString(params.digest); err != nil || len(decoded) != newHash().Size() {
+		return params, fmt.Errorf("checksum is not a valid %s hex digest", params.algorithm)
+	}
+
+	return params, nil
+}
+
+// Fetcher downloads and verifies artifacts for fetch_artifact
+type Fetcher struct {
+	// AllowHTTP permits plain http URLs and redirects
+	AllowHTTP bool
+	// Client is the HTTP client used; nil means one honoring the proxy
+	// environment variables
+	Client *http.Client
+}
+
+// Fetch downloads args.URL, streaming it through the checksum into a
+// temporary file in the destination, and keeps it (or what it extracts to)
+// only once the digest matches. Errors are *FetchError.
+func (f *Fetcher) Fetch(ctx context.Context, args FetchArgs) (*FetchResult, error) {
+	parsed, err := url.Parse(args.URL)
+	if err != nil || parsed.Host == "" {
+		return nil, fetchError(FetchErrInvalid, "invalid url %q", args.URL)
+	}
+	if err := f.checkScheme(parsed); err != nil {
+		return nil, err
+	}
+	maxBytes := args.MaxBytes
+	if maxBytes == 0 {
+		maxBytes = DefaultFetchMaxBytes
+	}
+
+	if err := os.MkdirAll(args.Destination, 0755); err != nil {
+		return nil, &FetchError{Kind: FetchErrWrite, Err: err}
+	}
+	target := ""
+	if !args.Extract {
+		if target, err = args.saveTarget(parsed); err != nil {
+			return nil, err
+		}
+		if err := checkOverwrite(target, args.Overwrite); err != nil {
+			return nil, err
+		}
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, parsed.String(), nil)
+	if err != nil {
+		return nil, fetchError(FetchErrInvalid, "invalid url %q: %v", args.URL, err)
+	}
+	response, err := f.client().Do(request)
+	if err != nil {
+		return nil, classifyFetchError(ctx, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fetchError(FetchErrHTTP, "download failed: %s", response.Status)
+	}
+	if response.ContentLength > maxBytes {
+		return nil, fetchError(FetchErrTooLarge, "download is %d bytes, more than the %d byte limit",
+			response.ContentLength, maxBytes)
+	}
+
+	temp, err := perms.CreateTemp(args.Destination, ".fetch-*")
+	if err != nil {
+		return nil, &FetchError{Kind: FetchErrWrite, Err: err}
+	}
+	defer os.Remove(temp.Name())
+
+	checksum := fetchHashes[args.algorithm]()
+	size, err := io.Copy(io.MultiWriter(temp, checksum), io.LimitReader(response.Body, maxBytes+1))
+	if closeErr := temp.Close(); err == nil && closeErr != nil {
+		return nil, &FetchError{Kind: FetchErrWrite, Err: closeErr}
+	}
+	if err != nil {
+		return nil, classifyFetchError(ctx, err)
+	}
+	if size > maxBytes {
+		return nil, fetchError(FetchErrTooLarge, "download exceeds the %d byte limit", maxBytes)
+	}
+
+	digest := hex.EncodeToString(checksum.Sum(nil))
+	if digest != args.digest {
+		return nil, fetchError(FetchErrMismatch, "checksum mismatch: expected %s:%s, got %s:%s; the download was discarded",
+			args.algorithm, args.digest, args.algorithm, digest)
+	}
+
+	result := &FetchResult{
+		URL:       args.URL,
+		FinalURL:  response.Request.URL.String(),
+		Size:      size,
+		Algorithm: args.algorithm,
+		Digest:    digest,
+	}
+
+	if !args.Extract {
+		if err := os.Chmod(temp.Name(), 0644); err != nil {
+			return nil, &FetchError{Kind: FetchErrWrite, Err: err}
+		}
+		if err := os.Rename(temp.Name(), target); err != nil {
+			return nil, &FetchError{Kind: FetchErrWrite, Err: err}
+		}
+		result.Path = target
+		return result, nil
+	}
+
+	format, files, err := extractInto(temp.Name(), args.Destination, maxBytes*fetchExtractRatio, args.Overwrite)
+	if err != nil {
+		return nil, err
+	}
+	result.Path = args.Destination
+	result.Format = format
+	result.ExtractedFiles = files
+	return result, nil
+}
+
+// checkScheme refuses URLs other than https, and http unless allowed
+func (f *Fetcher) checkScheme(u *url.URL) error {
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		if f.AllowHTTP {
+			return nil
+		}
+		return fetchError(FetchErrInvalid, "refusing plain http url %s: only https is allowed", u.Redacted())
+	}
+	return fetchError(FetchErrInvalid, "unsupported url scheme %q", u.Scheme)
+}
+
+// client returns the HTTP client, which refuses redirects to disallowed
+// schemes
+func (f *Fetcher) client() *http.Client {
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment}}
+	if f.Client != nil {
+		copied := *f.Client
+		client = &copied
+	}
+	client.CheckRedirect = func(request *http.Request, via []*http.Request) error {
+		if len(via) >= fetchMaxRedirects {
+			return fetchError(FetchErrHTTP, "stopped after %d redirects", fetchMaxRedirects)
+		}
+		return f.checkScheme(request.URL)
+	}
+	return client
+}
+
+// saveTarget returns the path a download that isn't extracted is saved to
+func (args FetchArgs) saveTarget(parsed *url.URL) (string, error) {
+	name := args.Filename
+	if name == "" {
+		name = path.Base(parsed.Path)
+	}
+	if name == "" || name == "." || name == "/" || name == ".." {
+		return "", fetchError(FetchErrInvalid, "url %s names no file; set filename", args.URL)
+	}
+	return filepath.Join(args.Destination, name), nil
+}
+
+// ExistingTargets lists the existing paths an overwriting fetch could
+// replace: the file a download is saved as, or, for an archive, whatever is
+// already in the destination, since which entries it holds isn't known until
+// it has been downloaded. It returns nothing without overwrite set.
+func (args FetchArgs) ExistingTargets() ([]string, error) {
+	if !args.Overwrite {
+		return nil, nil
+	}
+	if !args.Extract {
+		parsed, err := url.Parse(args.URL)
+		if err != nil || parsed.Host == "" {
+			return nil, fetchError(FetchErrInvalid, "invalid url %q", args.URL)
+		}
+		target, err := args.saveTarget(parsed)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Lstat(target); err != nil {
+			return nil, nil
+		}
+		return []string{target}, nil
+	}
+
+	entries, err := os.ReadDir(args.Destination)
+	if err != nil {
+		return nil, nil
+	}
+	targets := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		targets = append(targets, filepath.Join(args.Destination, entry.Name()))
+	}
+	collate.Strings(targets, collate.Natural)
+	return targets, nil
+}
+
+// extractInto unpacks the verified download into dir. Entries are extracted
+// to a staging directory first and moved into place only once all of them
+// have been written, so a failure leaves dir as it was.
+func extractInto(archive, dir string, limit int64, overwrite bool) (string, int, error) {
+	format, err := DetectArchive(archive)
+	if err != nil {
+		return "", 0, &FetchError{Kind: FetchErrExtract, Err: err}
+	}
+	if format == "" {
+		return "", 0, fetchError(FetchErrExtract, "the download is not a tar, tar.gz, tar.bz2 or zip archive")
+	}
+
+	staging, err := perms.MkdirTemp(dir, ".fetch-extract-*")
+	if err != nil {
+		return "", 0, &FetchError{Kind: FetchErrWrite, Err: err}
+	}
+	defer os.RemoveAll(staging)
+
+	files, err := ExtractArchive(archive, format, staging, limit)
+	if errors.Is(err, errArchiveTooLarge) {
+		return "", 0, fetchError(FetchErrTooLarge, "archive expands beyond %d bytes", limit)
+	}
+	if err != nil {
+		return "", 0, &FetchError{Kind: FetchErrExtract, Err: err}
+	}
+
+	entries, err := os.ReadDir(staging)
+	if err != nil {
+		return "", 0, &FetchError{Kind: FetchErrExtract, Err: err}
+	}
+	for _, entry := range entries {
+		if err := checkOverwrite(filepath.Join(dir, entry.Name()), overwrite); err != nil {
+			return "", 0, err
+		}
+	}
+	for _, entry := range entries {
+		target := filepath.Join(dir, entry.Name())
+		if overwrite {
+			if err := os.RemoveAll(target); err != nil {
+				return "", 0, &FetchError{Kind: FetchErrWrite, Err: err}
+			}
+		}
+		if err := os.Rename(filepath.Join(staging, entry.Name()), target); err != nil {
+			return "", 0, &FetchError{Kind: FetchErrWrite, Err: err}
+		}
+	}
+	return format, files, nil
+}
+
+// checkOverwrite refuses to replace an existing path unless overwrite is set
+func checkOverwrite(target string, overwrite bool) error {
+	if _, err := os.Lstat(target); err == nil && !overwrite {
+		return fetchError(FetchErrWrite, "%s already exists; set overwrite to replace it", target)
+	}
+	return nil
+}
+
+// classifyFetchError sorts a transfer error into TLS, timeout and other
+// network failures
+func classifyFetchError(ctx context.Context, err error) error {
+	var fetchErr *FetchError
+	if errors.As(err, &fetchErr) {
+		// Refused by CheckRedirect
+		return fetchErr
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &FetchError{Kind: FetchErrTimeout, Err: fmt.Errorf("download timed out: %w", err)}
+	}
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return &FetchError{Kind: FetchErrNetwork, Err: fmt.Errorf("download cancelled: %w", err)}
+	}
+
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		hostname         x509.HostnameError
+		invalid          x509.CertificateInvalidError
+		verification     *tls.CertificateVerificationError
+		recordHeader     tls.RecordHeaderError
+		alert            tls.AlertError
+	)
+	if errors.As(err, &unknownAuthority) || errors.As(err, &hostname) || errors.As(err, &invalid) ||
+		errors.As(err, &verification) || errors.As(err, &recordHeader) || errors.As(err, &alert) {
+		return &FetchError{Kind: FetchErrTLS, Err: err}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return &FetchError{Kind: FetchErrTimeout, Err: err}
+	}
+	return &FetchError{Kind: FetchErrNetwork, Err: err}
+}
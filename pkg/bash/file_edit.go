@@ -0,0 +1,343 @@
+package bash
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// FileEditArgs holds the parsed arguments for the file_edit tool
+type FileEditArgs struct {
+	Path          string `json:"path"`
+	Operation     string `json:"operation"`
+	Search        string `json:"search"`
+	Replacement   string `json:"replacement"`
+	Text          string `json:"text"`
+	Regex         bool   `json:"regex"`
+	ExpectedCount *int   `json:"expected_count"`
+	StartLine     int    `json:"start_line"`
+	EndLine       int    `json:"end_line"`
+}
+
+// FileEditResult describes a successful edit
+type FileEditResult struct {
+	Path    string
+	Changes int    // number of replacements, insertions, or deleted lines
+	Diff    string // unified diff of the change
+}
+
+// EditFile applies a single edit operation to a file atomically. The whole
+// edit is refused, leaving the file untouched, if the number of matches
+// differs from the expected count.
+func EditFile(args FileEditArgs) (*FileEditResult, error) {
+	plan, err := planEdit(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if plan.after != plan.before {
+		if err := writeFileAtomic(plan.path, []byte(plan.after), plan.info); err != nil {
+			return nil, err
+		}
+	}
+
+	return plan.result(args.Path), nil
+}
+
+// PreviewEdit returns what EditFile would do, without changing the file
+func PreviewEdit(args FileEditArgs) (*FileEditResult, error) {
+	plan, err := planEdit(args)
+	if err != nil {
+		return nil, err
+	}
+	return plan.result(args.Path), nil
+}
+
+// editPlan is a file's content before and after an edit. path is the file
+// itself, with any symlinks resolved, so the edit replaces the target rather
+// than the link.
+type editPlan struct {
+	path    string
+	info    os.FileInfo
+	before  string
+	after   string
+	changes int
+}
+
+// result describes the planned edit
+func (p *editPlan) result(path string) *FileEditResult {
+	return &FileEditResult{
+		Path:    path,
+		Changes: p.changes,
+		Diff:    unifiedDiff(path, p.before, p.after),
+	}
+}
+
+// planEdit reads the file and works out its content after the edit, refusing
+// it if the number of matches differs from the expected count
+func planEdit(args FileEditArgs) (*editPlan, error) {
+	path, err := filepath.EvalSymlinks(args.Path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot edit %s: %w", args.Path, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot edit %s: %w", args.Path, err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("cannot edit %s: not a regular file", args.Path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", args.Path, err)
+	}
+	before := string(data)
+
+	expected := 1
+	if args.ExpectedCount != nil {
+		expected = *args.ExpectedCount
+	}
+
+	var after string
+	var changes int
+
+	switch args.Operation {
+	case "replace":
+		changes = strings.Count(before, args.Search)
+		if changes != expected {
+			return nil, matchCountError(expected, changes, "occurrence(s) of the search string")
+		}
+		after = strings.ReplaceAll(before, args.Search, args.Replacement)
+
+	case "replace_regex":
+		re, err := regexp.Compile(args.Search)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex: %w", err)
+		}
+		changes = len(re.FindAllStringIndex(before, -1))
+		if changes != expected {
+			return nil, matchCountError(expected, changes, "regex match(es)")
+		}
+		after = re.ReplaceAllString(before, args.Replacement)
+
+	case "insert_after", "insert_before":
+		after, changes, err = insertAtMatchingLines(before, args)
+		if err != nil {
+			return nil, err
+		}
+		if changes != expected {
+			return nil, matchCountError(expected, changes, "matching line(s)")
+		}
+
+	case "delete_lines":
+		after, changes, err = deleteLineRange(before, args.StartLine, args.EndLine)
+		if err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown operation: %s", args.Operation)
+	}
+
+	return &editPlan{path: path, info: info, before: before, after: after, changes: changes}, nil
+}
+
+// matchCountError reports a mismatch between expected and actual match counts.
+func matchCountError(expected, actual int, what string) error {
+	return fmt.Errorf("expected %d %s but found %d; no changes made", expected, what, actual)
+}
+
+// insertAtMatchingLines inserts args.Text before or after every line that
+// matches args.Search. Inserted lines use the file's existing line ending.
+func insertAtMatchingLines(content string, args FileEditArgs) (string, int, error) {
+	match := func(line string) bool { return strings.Contains(line, args.Search) }
+	if args.Regex {
+		re, err := regexp.Compile(args.Search)
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid regex: %w", err)
+		}
+		match = re.MatchString
+	}
+
+	eol := detectLineEnding(content)
+	insert := normalizeLineEndings(strings.TrimRight(args.Text, "\r\n"), eol) + eol
+
+	var out strings.Builder
+	count := 0
+	for _, line := range splitLinesKeepEOL(content) {
+		if !match(strings.TrimRight(line, "\r\n")) {
+			out.WriteString(line)
+			continue
+		}
+		count++
+		if args.Operation == "insert_before" {
+			out.WriteString(insert)
+			out.WriteString(line)
+			continue
+		}
+		out.WriteString(line)
+		if !strings.HasSuffix(line, "\n") {
+			// Last line without a terminator: end it before appending
+			out.WriteString(eol)
+			out.WriteString(strings.TrimSuffix(insert, eol))
+			continue
+		}
+		out.WriteString(insert)
+	}
+	return out.String(), count, nil
+}
+
+// deleteLineRange removes lines start..end (1-based, inclusive).
+func deleteLineRange(content string, start, end int) (string, int, error) {
+	lines := splitLinesKeepEOL(content)
+	if end == 0 {
+		end = start
+	}
+	if start < 1 || end < start || end > len(lines) {
+		return "", 0, fmt.Errorf("invalid line range %d-%d (file has %d lines); no changes made", start, end, len(lines))
+	}
+
+	kept := append(append([]string{}, lines[:start-1]...), lines[end:]...)
+	return strings.Join(kept, ""), end - start + 1, nil
+}
+
+// detectLineEnding returns "\r\n" if the content uses CRLF line endings, else "\n".
+func detectLineEnding(content string) string {
+	if strings.Contains(content, "\r\n") {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// normalizeLineEndings converts the line endings in text to eol.
+func normalizeLineEndings(text, eol string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if eol == "\n" {
+		return text
+	}
+	return strings.ReplaceAll(text, "\n", eol)
+}
+
+// writeFileAtomic replaces path with data by writing a temp file in the same
+// directory and renaming it over the original, preserving the original's mode
+// and (where permitted) ownership.
+func writeFileAtomic(path string, data []byte, original os.FileInfo) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // no-op after a successful rename
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+
+	if original != nil {
+		if err := os.Chmod(tmpPath, original.Mode().Perm()); err != nil {
+			return fmt.Errorf("failed to set file mode: %w", err)
+		}
+		preserveOwnership(tmpPath, original)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
+
+// FileEditToolSchema defines the schema for file_edit input
+var FileEditToolSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type":        "string",
+			"description": "Path of the file to edit",
+		},
+		"operation": map[string]interface{}{
+			"type":        "string",
+			"enum":        []string{"replace", "replace_regex", "insert_after", "insert_before", "delete_lines"},
+			"description": "The edit to apply",
+		},
+		"search": map[string]interface{}{
+			"type": "string",
+			"description": "replace: exact text to find. replace_regex: regular expression. " +
+				"insert_after/insert_before: text a line must contain (or a regex if regex is true)",
+		},
+		"replacement": map[string]interface{}{
+			"type":        "string",
+			"description": "Replacement text. For replace_regex, $1 or ${name} refer to capture groups",
+		},
+		"text": map[string]interface{}{
+			"type":        "string",
+			"description": "Lines to insert (insert_after/insert_before)",
+		},
+		"regex": map[string]interface{}{
+			"type":        "boolean",
+			"description": "Treat search as a regular expression when matching lines for insert_after/insert_before",
+		},
+		"expected_count": map[string]interface{}{
+			"type":        "integer",
+			"description": "Number of matches expected (default 1). The edit is refused if the actual count differs",
+		},
+		"start_line": map[string]interface{}{
+			"type":        "integer",
+			"description": "First line to delete, 1-based (delete_lines)",
+		},
+		"end_line": map[string]interface{}{
+			"type":        "integer",
+			"description": "Last line to delete, inclusive (delete_lines, defaults to start_line)",
+		},
+		"confirm_token": map[string]interface{}{
+			"type": "string",
+			"description": "Token from the preview of this exact call, where the server requires confirmation " +
+				"before the change is made",
+		},
+	},
+	"required": []string{"path", "operation"},
+}
+
+// ParseFileEditArgs parses arguments for the file_edit tool
+func ParseFileEditArgs(args json.RawMessage) (FileEditArgs, error) {
+	var params FileEditArgs
+	if err := json.Unmarshal(args, &params); err != nil {
+		return params, fmt.Errorf("invalid arguments for file_edit tool: %w", err)
+	}
+
+	if params.Path == "" {
+		return params, fmt.Errorf("path parameter is required")
+	}
+
+	switch params.Operation {
+	case "replace", "replace_regex", "insert_after", "insert_before":
+		if params.Search == "" {
+			return params, fmt.Errorf("search parameter is required for %s", params.Operation)
+		}
+	case "delete_lines":
+		if params.StartLine == 0 {
+			return params, fmt.Errorf("start_line parameter is required for delete_lines")
+		}
+	case "":
+		return params, fmt.Errorf("operation parameter is required")
+	default:
+		return params, fmt.Errorf("unknown operation: %s", params.Operation)
+	}
+
+	if params.ExpectedCount != nil && *params.ExpectedCount < 0 {
+		return params, fmt.Errorf("expected_count must not be negative")
+	}
+
+	return params, nil
+}
@@ -0,0 +1,194 @@
+package bash
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// editFixture writes content to a new file and returns its path
+func editFixture(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(path, []byte(content), 0640); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// readFixture returns the content of path
+func readFixture(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func count(n int) *int { return &n }
+
+func TestEditFileOperations(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		args    FileEditArgs
+		want    string
+		changes int
+	}{
+		{
+			name:    "replace",
+			content: "alpha beta\ngamma\n",
+			args:    FileEditArgs{Operation: "replace", Search: "beta", Replacement: "delta"},
+			want:    "alpha delta\ngamma\n",
+			changes: 1,
+		},
+		{
+			name:    "replace every expected occurrence",
+			content: "x x x\n",
+			args:    FileEditArgs{Operation: "replace", Search: "x", Replacement: "y", ExpectedCount: count(3)},
+			want:    "y y y\n",
+			changes: 3,
+		},
+		{
+			name:    "replace_regex with groups",
+			content: "version=1.2\n",
+			args:    FileEditArgs{Operation: "replace_regex", Search: `version=(\d+)\.(\d+)`, Replacement: "version=$1.${2}1"},
+			want:    "version=1.21\n",
+			changes: 1,
+		},
+		{
+			name:    "insert_after",
+			content: "one\ntwo\n",
+			args:    FileEditArgs{Operation: "insert_after", Search: "one", Text: "one and a half"},
+			want:    "one\none and a half\ntwo\n",
+			changes: 1,
+		},
+		{
+			name:    "insert_before keeps CRLF",
+			content: "one\r\ntwo\r\n",
+			args:    FileEditArgs{Operation: "insert_before", Search: "two", Text: "between\n"},
+			want:    "one\r\nbetween\r\ntwo\r\n",
+			changes: 1,
+		},
+		{
+			name:    "insert_after an unterminated last line",
+			content: "one\ntwo",
+			args:    FileEditArgs{Operation: "insert_after", Search: "^two$", Regex: true, Text: "three"},
+			want:    "one\ntwo\nthree",
+			changes: 1,
+		},
+		{
+			name:    "delete_lines",
+			content: "1\n2\n3\n4\n",
+			args:    FileEditArgs{Operation: "delete_lines", StartLine: 2, EndLine: 3},
+			want:    "1\n4\n",
+			changes: 2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := editFixture(t, test.content)
+			test.args.Path = path
+			result, err := EditFile(test.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := readFixture(t, path); got != test.want {
+				t.Errorf("content = %q, want %q", got, test.want)
+			}
+			if result.Changes != test.changes {
+				t.Errorf("changes = %d, want %d", result.Changes, test.changes)
+			}
+		})
+	}
+}
+
+func TestEditFileRefusesUnexpectedMatchCount(t *testing.T) {
+	tests := []FileEditArgs{
+		{Operation: "replace", Search: "x", Replacement: "y"},
+		{Operation: "replace", Search: "missing", Replacement: "y"},
+		{Operation: "replace_regex", Search: "x+", Replacement: "y", ExpectedCount: count(1)},
+		{Operation: "insert_after", Search: "x", Text: "y"},
+		{Operation: "delete_lines", StartLine: 5},
+	}
+	for _, args := range tests {
+		path := editFixture(t, "x\nx x\n")
+		args.Path = path
+		if _, err := EditFile(args); err == nil {
+			t.Errorf("%s %q: edit accepted", args.Operation, args.Search)
+		}
+		if got := readFixture(t, path); got != "x\nx x\n" {
+			t.Errorf("%s %q: file changed to %q", args.Operation, args.Search, got)
+		}
+	}
+}
+
+func TestEditFileKeepsModeAndSymlink(t *testing.T) {
+	path := editFixture(t, "old\n")
+	if err := os.Chmod(path, 0604); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(filepath.Dir(path), "link.txt")
+	if err := os.Symlink(path, link); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := EditFile(FileEditArgs{Path: link, Operation: "replace", Search: "old", Replacement: "new"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readFixture(t, path); got != "new\n" {
+		t.Errorf("target content = %q, want the edit applied through the link", got)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("link replaced by a regular file")
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0604 {
+		t.Errorf("mode not preserved: %v", info.Mode())
+	}
+	if !strings.Contains(result.Diff, "-old") || !strings.Contains(result.Diff, "+new") {
+		t.Errorf("diff = %q", result.Diff)
+	}
+}
+
+func TestPreviewEditLeavesFileUnchanged(t *testing.T) {
+	path := editFixture(t, "old\n")
+	result, err := PreviewEdit(FileEditArgs{Path: path, Operation: "replace", Search: "old", Replacement: "new"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readFixture(t, path); got != "old\n" {
+		t.Errorf("preview changed the file to %q", got)
+	}
+	if !strings.Contains(result.Diff, "+new") {
+		t.Errorf("diff = %q", result.Diff)
+	}
+}
+
+func TestParseFileEditArgs(t *testing.T) {
+	invalid := []string{
+		`{"operation":"replace","search":"x"}`,
+		`{"path":"f"}`,
+		`{"path":"f","operation":"rename"}`,
+		`{"path":"f","operation":"replace"}`,
+		`{"path":"f","operation":"delete_lines"}`,
+		`{"path":"f","operation":"replace","search":"x","expected_count":-1}`,
+	}
+	for _, args := range invalid {
+		if _, err := ParseFileEditArgs(json.RawMessage(args)); err == nil {
+			t.Errorf("%s accepted", args)
+		}
+	}
+
+	args, err := ParseFileEditArgs(json.RawMessage(`{"path":"f","operation":"replace","search":"x","expected_count":0}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args.ExpectedCount == nil || *args.ExpectedCount != 0 {
+		t.Errorf("expected_count 0 not kept")
+	}
+}
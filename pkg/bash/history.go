@@ -0,0 +1,129 @@
+package bash
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultHistorySize is how many commands bash_history keeps when no size is
+// configured
+const DefaultHistorySize = 200
+
+// HistoryEntry is one command in the bash_history log
+type HistoryEntry struct {
+	Time        time.Time `json:"time"` // when it finished
+	Tool        string    `json:"tool"`
+	Session     int       `json:"session,omitempty"` // 0 if it ran outside the session
+	Command     string    `json:"command"`
+	ExitCode    *int      `json:"exitCode"` // nil if it never finished
+	DurationMs  int64     `json:"durationMs"`
+	OutputBytes int       `json:"outputBytes"`
+	Error       string    `json:"error,omitempty"` // why it never finished, e.g. a timeout
+}
+
+// historyRing keeps the most recent commands run, oldest overwritten first.
+// It belongs to the manager, so it outlives the sessions it lists.
+type historyRing struct {
+	mutex   sync.Mutex
+	entries []HistoryEntry
+	next    int // where the next entry goes once entries is full
+	size    int
+}
+
+// add records an entry, forgetting the oldest once the ring is full
+func (h *historyRing) add(entry HistoryEntry) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if len(h.entries) < h.size {
+		h.entries = append(h.entries, entry)
+		return
+	}
+	h.entries[h.next] = entry
+	h.next = (h.next + 1) % h.size
+}
+
+// list returns the entries whose command contains filter, oldest first
+func (h *historyRing) list(filter string) []HistoryEntry {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	entries := []HistoryEntry{}
+	for i := range h.entries {
+		entry := h.entries[(h.next+i)%len(h.entries)]
+		if strings.Contains(entry.Command, filter) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// RecordHistory adds a command that was run to bash_history. inSession says
+// it ran in the bash session, whose id is recorded with it; err is the
+// error it failed with, if it didn't finish.
+func (bm *BashManager) RecordHistory(tool, command string, inSession bool, duration time.Duration,
+	result CommandResult, err error) {
+	entry := HistoryEntry{
+		Time:        time.Now(),
+		Tool:        tool,
+		Command:     command,
+		DurationMs:  duration.Milliseconds(),
+		OutputBytes: len(result.Output),
+	}
+	if inSession {
+		// The session the command ran in, even if it has since been killed
+		if session := bm.current.Load(); session != nil {
+			entry.Session = session.id
+		}
+	}
+	switch {
+	case errors.Is(err, ErrCommandTimedOut):
+		entry.Error = "timed out"
+	case errors.Is(err, ErrCommandCancelled):
+		entry.Error = "cancelled"
+	case err != nil:
+		entry.Error = err.Error()
+	default:
+		code := result.ExitCode
+		entry.ExitCode = &code
+	}
+	bm.ran.add(entry)
+}
+
+// History returns the commands run most recently, oldest first, keeping
+// only those containing filter if it is not ""
+func (bm *BashManager) History(filter string) []HistoryEntry {
+	return bm.ran.list(filter)
+}
+
+// HistorySize returns how many commands bash_history keeps
+func (bm *BashManager) HistorySize() int {
+	return bm.ran.size
+}
+
+// HistoryToolSchema defines the schema for bash_history input
+var HistoryToolSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"filter": map[string]interface{}{
+			"type":        "string",
+			"description": "Only list commands containing this text (case-sensitive)",
+		},
+	},
+}
+
+// ParseHistoryArgs parses arguments for the bash_history tool, returning the
+// filter
+func ParseHistoryArgs(args json.RawMessage) (string, error) {
+	var params struct {
+		Filter string `json:"filter"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &params); err != nil {
+			return "", fmt.Errorf("invalid arguments for bash_history tool: %w", err)
+		}
+	}
+	return params.Filter, nil
+}
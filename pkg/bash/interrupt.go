@@ -0,0 +1,107 @@
+package bash
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrCommandCancelled is returned for a command cancelled by the client
+	ErrCommandCancelled = errors.New("command cancelled")
+
+	// ErrCommandTimedOut is wrapped by the error for a command killed for
+	// exceeding a time limit. The CommandResult returned with it holds the
+	// output captured before the kill.
+	ErrCommandTimedOut = errors.New("command timed out")
+)
+
+// interruptGrace is how long an interrupted command has to finish after
+// SIGINT before the session is killed
+const interruptGrace = 2 * time.Second
+
+// killGrace is how long a killed session has to close its stdout
+const killGrace = time.Second
+
+// jobControlSetup turns on job control in bash sessions, so each pipeline of
+// a command runs in a process group of its own, and traps SIGINT. bash then
+// treats a pipeline killed by SIGINT as Ctrl-C: it abandons the rest of the
+// command rather than exiting.
+const jobControlSetup = "set -m; trap : INT"
+
+// commandProcs are the processes of the command a session is running
+type commandProcs struct {
+	// groups are the process groups job control gave its pipelines, with
+	// their members
+	groups map[int][]int
+	// shared are its processes left in the shell's own process group, such
+	// as command substitutions, which can't be interrupted apart from it
+	shared []int
+}
+
+// foreground finds the processes of the command the session is running,
+// leaving out background jobs started by earlier commands
+func (bs *BashSession) foreground() (commandProcs, error) {
+	var background map[int]bool
+	if jobs := bs.background.Load(); jobs != nil {
+		background = *jobs
+	}
+	return commandProcesses(bs.getPID(), background)
+}
+
+// stopForeground ends the running command without losing the session if it
+// can: its pipelines are sent SIGINT, and bash abandons the rest of the
+// command once they end. The session is killed instead if the command can't
+// be interrupted apart from bash (a shell loop with nothing running, a
+// command substitution, or a shell without job control), or if it still
+// hasn't finished after interruptGrace (a program that ignores SIGINT).
+//
+// It returns the command's output so far and whether the session survived.
+// partial is the reader's output, valid once errorChan has delivered.
+// Caller must hold bs.mutex.
+func (bs *BashSession) stopForeground(outputChan <-chan CommandResult, errorChan <-chan error,
+	partial *string) (CommandResult, bool) {
+	procs, err := bs.foreground()
+	switch {
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Cannot stop command alone (%v); killing session\n", err)
+	case !bs.jobControl:
+		fmt.Fprintf(os.Stderr, "Cannot stop command alone in a shell without job control; killing session\n")
+	case len(procs.shared) > 0:
+		fmt.Fprintf(os.Stderr, "Cannot stop command alone: %d process(es) in the shell's process group; "+
+			"killing session\n", len(procs.shared))
+	case len(procs.groups) == 0:
+		fmt.Fprintf(os.Stderr, "Cannot stop command alone: it is running in the shell itself; killing session\n")
+	default:
+		signalled := procs.signal(syscall.SIGINT)
+		fmt.Fprintf(os.Stderr, "Stopping command: sent SIGINT to %d process(es)\n", signalled)
+		select {
+		case result := <-outputChan:
+			return bs.finishResult(result), true
+		case <-errorChan:
+			bs.markStopped()
+			return CommandResult{Output: *partial}, false
+		case <-time.After(interruptGrace):
+		}
+	}
+
+	bs.killForTimeout()
+	select {
+	case <-errorChan:
+		return CommandResult{Output: *partial}, false
+	case <-time.After(killGrace):
+		// A surviving child still holds stdout open
+		return CommandResult{}, false
+	}
+}
+
+// stoppedError describes a command stopped for exceeding a limit, noting
+// when the session had to be killed with it
+func stoppedError(reason error, survived bool) error {
+	if survived {
+		return reason
+	}
+	return fmt.Errorf("%w; the bash session had to be killed, so its state was lost", reason)
+}
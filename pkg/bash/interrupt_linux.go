@@ -0,0 +1,103 @@
+//go:build linux
+
+package bash
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// childProcesses returns the children of pid, read from /proc
+func childProcesses(pid int) (map[int]bool, error) {
+	id := strconv.Itoa(pid)
+	list, err := os.ReadFile("/proc/" + id + "/task/" + id + "/children")
+	if err != nil {
+		return nil, err
+	}
+	children := make(map[int]bool)
+	for _, field := range strings.Fields(string(list)) {
+		if child, err := strconv.Atoi(field); err == nil {
+			children[child] = true
+		}
+	}
+	return children, nil
+}
+
+// commandProcesses finds the processes of the command a session's shell (pid)
+// is running: its descendants, less the children in background and theirs.
+func commandProcesses(pid int, background map[int]bool) (commandProcs, error) {
+	shell, err := readProcStat(pid)
+	if err != nil {
+		return commandProcs{}, err
+	}
+	processes := livingProcesses()
+	children := make(map[int][]int)
+	for child, stat := range processes {
+		children[stat.parent] = append(children[stat.parent], child)
+	}
+
+	procs := commandProcs{groups: make(map[int][]int)}
+	var queue []int
+	for _, child := range children[pid] {
+		if !background[child] {
+			queue = append(queue, child)
+		}
+	}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		queue = append(queue, children[p]...)
+		if group := processes[p].group; group == shell.group {
+			procs.shared = append(procs.shared, p)
+		} else {
+			procs.groups[group] = append(procs.groups[group], p)
+		}
+	}
+	return procs, nil
+}
+
+// signal sends sig to each of the command's process groups and to each of
+// its processes in the shell's group, returning how many processes were
+// signalled
+func (procs commandProcs) signal(sig syscall.Signal) int {
+	signalled := 0
+	for group, members := range procs.groups {
+		if syscall.Kill(-group, sig) == nil {
+			signalled += len(members)
+		}
+	}
+	for _, p := range procs.shared {
+		if syscall.Kill(p, sig) == nil {
+			signalled++
+		}
+	}
+	return signalled
+}
+
+// killDescendants sends SIGKILL to every descendant of pid, background jobs
+// included, for a session that is closing
+func killDescendants(pid int) (int, error) {
+	processes := livingProcesses()
+	if processes == nil {
+		return 0, errors.New("cannot read /proc")
+	}
+	children := make(map[int][]int)
+	for child, stat := range processes {
+		children[stat.parent] = append(children[stat.parent], child)
+	}
+
+	signalled := 0
+	queue := append([]int(nil), children[pid]...)
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		queue = append(queue, children[p]...)
+		if syscall.Kill(p, syscall.SIGKILL) == nil {
+			signalled++
+		}
+	}
+	return signalled, nil
+}
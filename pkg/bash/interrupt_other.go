@@ -0,0 +1,30 @@
+//go:build !linux
+
+package bash
+
+import (
+	"errors"
+	"syscall"
+)
+
+// childProcesses is unsupported without /proc
+func childProcesses(pid int) (map[int]bool, error) {
+	return nil, errors.New("cannot find child processes on this platform")
+}
+
+// commandProcesses is unsupported without /proc; stopping a command falls
+// back to killing the session.
+func commandProcesses(pid int, background map[int]bool) (commandProcs, error) {
+	return commandProcs{}, errors.New("cannot find child processes on this platform")
+}
+
+// signal signals nothing, as commandProcesses finds nothing here
+func (procs commandProcs) signal(sig syscall.Signal) int {
+	return 0
+}
+
+// killDescendants is unsupported without /proc; closing a session kills
+// only bash.
+func killDescendants(pid int) (int, error) {
+	return 0, errors.New("cannot find child processes on this platform")
+}
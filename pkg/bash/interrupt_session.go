@@ -0,0 +1,158 @@
+package bash
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// InterruptWaitLimit is how long interrupt_session waits for the command to
+// finish when asked to
+const InterruptWaitLimit = 10 * time.Second
+
+// interruptSignals are the signals interrupt_session may send
+var interruptSignals = map[string]syscall.Signal{
+	"SIGINT":  syscall.SIGINT,
+	"SIGTERM": syscall.SIGTERM,
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGKILL": syscall.SIGKILL,
+}
+
+// signalName returns the interruptSignals name of sig
+func signalName(sig syscall.Signal) string {
+	for name, s := range interruptSignals {
+		if s == sig {
+			return name
+		}
+	}
+	return fmt.Sprintf("signal %d", int(sig))
+}
+
+// InterruptResult describes what interrupt_session did
+type InterruptResult struct {
+	Session   int
+	Signal    string
+	Signalled int // processes signalled
+	Waited    bool
+	Completed bool // only meaningful when Waited
+}
+
+// InterruptSession sends sig to the foreground processes of the command
+// running in a session, as Ctrl-C would at a terminal. id 0 means the current
+// session. What follows is up to the command: in bash, SIGINT that ends a
+// pipeline abandons the rest of it, as at a terminal, while a program that
+// handles the signal carries on. The command's own tools/call completes as
+// usual with the output so far, marked as interrupted. With wait set, it
+// waits up to InterruptWaitLimit for the command to finish.
+//
+// The processes are those stopForeground would interrupt: the process
+// groups job control gave the command's pipelines, and any of its processes
+// left in the shell's own group. Background jobs started by earlier
+// commands are left alone.
+func (bm *BashManager) InterruptSession(id int, sig syscall.Signal, wait bool) (InterruptResult, error) {
+	session := bm.current.Load()
+	if session == nil || session.stopped.Load() || (id != 0 && session.id != id) {
+		if id == 0 {
+			return InterruptResult{}, fmt.Errorf("no bash session is running")
+		}
+		return InterruptResult{}, fmt.Errorf("no session with id %d (see bash_sessions)", id)
+	}
+	result := InterruptResult{Session: session.id, Signal: signalName(sig), Waited: wait}
+	if !session.busy.Load() {
+		return result, fmt.Errorf("session %d is idle; there is no command to interrupt", session.id)
+	}
+
+	// Marked before signalling so the result can't be read unmarked
+	session.interrupted.Store(int32(sig))
+	procs, err := session.foreground()
+	if err != nil {
+		session.interrupted.Store(0)
+		return result, fmt.Errorf("cannot signal the command: %w", err)
+	}
+	signalled := procs.signal(sig)
+	if signalled == 0 {
+		session.interrupted.Store(0)
+		return result, fmt.Errorf("the command in session %d has no processes to signal (it is running in bash "+
+			"itself, e.g. a shell loop); cancel the request instead", session.id)
+	}
+	result.Signalled = signalled
+	fmt.Fprintf(os.Stderr, "Interrupted session %d: sent %s to %d process(es)\n", session.id, result.Signal, signalled)
+
+	if wait {
+		deadline := time.Now().Add(InterruptWaitLimit)
+		for session.busy.Load() && time.Now().Before(deadline) {
+			time.Sleep(50 * time.Millisecond)
+		}
+		result.Completed = !session.busy.Load()
+	}
+	return result, nil
+}
+
+// InterruptToolSchema defines the schema for interrupt_session input
+var InterruptToolSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"session": map[string]interface{}{
+			"type":        "integer",
+			"description": "Session id from bash_sessions (default: the current session)",
+		},
+		"signal": map[string]interface{}{
+			"type":        "string",
+			"enum":        interruptSignalNames(),
+			"description": "Signal to send (default SIGINT)",
+		},
+		"wait": map[string]interface{}{
+			"type": "boolean",
+			"description": fmt.Sprintf("Wait up to %v for the command to finish and report whether it did",
+				InterruptWaitLimit),
+		},
+	},
+}
+
+// interruptSignalNames lists the signals interrupt_session accepts, sorted
+func interruptSignalNames() []string {
+	names := make([]string, 0, len(interruptSignals))
+	for name := range interruptSignals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseInterruptArgs parses arguments for the interrupt_session tool
+func ParseInterruptArgs(args json.RawMessage) (id int, sig syscall.Signal, wait bool, err error) {
+	var params struct {
+		Session int    `json:"session"`
+		Signal  string `json:"signal"`
+		Wait    bool   `json:"wait"`
+	}
+
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &params); err != nil {
+			return 0, 0, false, fmt.Errorf("invalid arguments for interrupt_session tool: %w", err)
+		}
+	}
+
+	if params.Session < 0 {
+		return 0, 0, false, fmt.Errorf("session must not be negative")
+	}
+
+	name := strings.ToUpper(params.Signal)
+	if name == "" {
+		name = "SIGINT"
+	} else if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	sig, ok := interruptSignals[name]
+	if !ok {
+		return 0, 0, false, fmt.Errorf("unsupported signal %q (expected one of %s)", params.Signal,
+			strings.Join(interruptSignalNames(), ", "))
+	}
+
+	return params.Session, sig, params.Wait, nil
+}
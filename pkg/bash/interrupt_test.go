@@ -0,0 +1,113 @@
+//go:build linux
+
+package bash
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// runTimingOut runs command with a one second timeout, which it must exceed,
+// and returns its output and whether the session survived
+func runTimingOut(t *testing.T, bm *BashManager, command string) (CommandResult, bool) {
+	t.Helper()
+	result, err := bm.ExecuteCommandWithTimeout(command, time.Second)
+	if !errors.Is(err, ErrCommandTimedOut) {
+		t.Fatalf("%q: err = %v, want a timeout", command, err)
+	}
+	return result, !strings.Contains(err.Error(), "had to be killed")
+}
+
+func TestTimeoutStopsWholeCommand(t *testing.T) {
+	bm := newTestManager(t, Options{})
+	run(t, bm, "cd /tmp && export KEPT=yes")
+
+	for _, command := range []string{
+		"f(){ sleep 10; echo inf; }; f; echo afterf",
+		"sleep 10\necho line2",
+		"for i in 1 2 3; do sleep 10; echo i$i; done\necho after",
+	} {
+		result, survived := runTimingOut(t, bm, command)
+		if !survived {
+			t.Fatalf("%q: session was killed", command)
+		}
+		if strings.TrimSpace(result.Output) != "[Exit code: 130]" {
+			t.Errorf("%q: output = %q, want only the interrupted exit code", command, result.Output)
+		}
+	}
+
+	result := run(t, bm, `echo "$KEPT $PWD"`)
+	if result.Output != "yes /tmp" {
+		t.Errorf("session state after timeouts = %q, want %q", result.Output, "yes /tmp")
+	}
+}
+
+func TestTimeoutLeavesEarlierBackgroundJobs(t *testing.T) {
+	bm := newTestManager(t, Options{})
+
+	run(t, bm, "sleep 30 & job=$!")
+	if _, survived := runTimingOut(t, bm, "sleep 10"); !survived {
+		t.Fatal("session was killed")
+	}
+	result := run(t, bm, `kill -0 "$job" && echo running; kill "$job"`)
+	if !strings.HasPrefix(result.Output, "running") {
+		t.Errorf("output = %q: the earlier background job was stopped too", result.Output)
+	}
+}
+
+func TestTimeoutKillsSessionItCannotInterrupt(t *testing.T) {
+	bm := newTestManager(t, Options{})
+
+	for _, command := range []string{
+		"x=$(sleep 10; echo y); echo after $x",
+		"while :; do :; done",
+	} {
+		if _, survived := runTimingOut(t, bm, command); survived {
+			t.Errorf("%q: session survived; the rest of the command could have run", command)
+		}
+	}
+}
+
+func TestCommandSyntaxUntouched(t *testing.T) {
+	bm := newTestManager(t, Options{})
+
+	result := run(t, bm, "shopt -s expand_aliases\nalias hi='echo hello'\nhi")
+	if result.Output != "hello" {
+		t.Errorf("alias defined on an earlier line: output = %q, want %q", result.Output, "hello")
+	}
+
+	result = run(t, bm, "break; echo after")
+	if !strings.HasPrefix(result.Output, "after") || !strings.Contains(result.Stderr, "only meaningful in a") {
+		t.Errorf("top-level break: output = %q, want bash's usual error and the rest run", result.Output)
+	}
+
+	result = run(t, bm, "trap 'echo got usr1' USR1; kill -USR1 $$")
+	if result.Output != "got usr1" {
+		t.Errorf("USR1 trap: output = %q, want %q", result.Output, "got usr1")
+	}
+}
+
+func TestInterruptSession(t *testing.T) {
+	bm := newTestManager(t, Options{})
+
+	done := make(chan CommandResult, 1)
+	go func() {
+		result, _ := bm.ExecuteCommand("sleep 10; echo rest")
+		done <- result
+	}()
+	time.Sleep(300 * time.Millisecond)
+
+	interrupt, err := bm.InterruptSession(0, interruptSignals["SIGINT"], true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if interrupt.Signalled != 1 || !interrupt.Completed {
+		t.Errorf("interrupt = %+v, want one process signalled and the command completed", interrupt)
+	}
+	result := <-done
+	if strings.Contains(result.Output, "rest") || result.Interrupted != "SIGINT" {
+		t.Errorf("result = %+v, want the rest abandoned and the interrupt noted", result)
+	}
+}
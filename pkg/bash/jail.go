@@ -0,0 +1,140 @@
+package bash
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/perms"
+)
+
+// PathJail presents a directory to the client as if it were "/". Commands
+// start in it, with HOME and TMPDIR in subdirectories of it; paths given to
+// the file tools, working_directory and exec's cwd are taken relative to it;
+// and absolute paths under it are rewritten in responses to their jailed
+// form (/home/me/project/src becomes /src).
+//
+// It is a translation layer, not a security boundary: the shell sees real
+// paths, so commands can still reach anything the server's user can, and
+// should refer to files by relative path.
+type PathJail struct {
+	root    string
+	pattern *regexp.Regexp
+}
+
+// NewPathJail jails paths to dir, which must be an existing directory. The
+// jail's HOME and TMPDIR directories are created if missing.
+func NewPathJail(dir string) (*PathJail, error) {
+	root, err := filepath.Abs(dir)
+	if err == nil {
+		root, err = filepath.EvalSymlinks(root)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("pathJail %s: %w", dir, err)
+	}
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("pathJail %s is not a directory", dir)
+	}
+	if root == string(filepath.Separator) {
+		return nil, fmt.Errorf("pathJail must not be the root directory")
+	}
+
+	jail := &PathJail{
+		root: root,
+		// The root, when followed by a separator or by something that
+		// can't continue a file name
+		pattern: regexp.MustCompile(regexp.QuoteMeta(root) + `(/|$|[^\w.\-+@])`),
+	}
+	for _, env := range jail.env() {
+		if err := perms.MkdirAll(env[strings.IndexByte(env, '=')+1:]); err != nil {
+			return nil, fmt.Errorf("pathJail: %w", err)
+		}
+	}
+	return jail, nil
+}
+
+// Root returns the real directory the jail presents as "/"
+func (j *PathJail) Root() string {
+	return j.root
+}
+
+// env returns the variables that keep HOME and TMPDIR inside the jail
+func (j *PathJail) env() []string {
+	return []string{
+		"HOME=" + filepath.Join(j.root, ".home"),
+		"TMPDIR=" + filepath.Join(j.root, ".tmp"),
+	}
+}
+
+// Resolve maps a jailed path to its real path. Absolute paths are taken
+// from the jail's root (a real path already under it is accepted as is) and
+// relative ones from the root too. It refuses a path that leaves the jail
+// through a symlink.
+func (j *PathJail) Resolve(path string) (string, error) {
+	target := path
+	if !j.contains(path) {
+		// Cleaning as an absolute path first stops ".." climbing out
+		target = filepath.Join(j.root, filepath.Clean(string(filepath.Separator)+path))
+	}
+
+	// Only the part that exists can be a symlink
+	existing := target
+	for {
+		resolved, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			if !j.contains(resolved) {
+				return "", fmt.Errorf("path %s leaves the path jail", path)
+			}
+			break
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("path %s: %w", path, err)
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			break
+		}
+		existing = parent
+	}
+	return target, nil
+}
+
+// contains reports whether path is the root or under it
+func (j *PathJail) contains(path string) bool {
+	return path == j.root || strings.HasPrefix(path, j.root+string(filepath.Separator))
+}
+
+// Rewrite replaces absolute paths under the jail in text with their jailed
+// form. A nil jail leaves text alone.
+func (j *PathJail) Rewrite(text string) string {
+	if j == nil || !strings.Contains(text, j.root) {
+		return text
+	}
+	return j.pattern.ReplaceAllStringFunc(text, func(match string) string {
+		next := match[len(j.root):]
+		if next == "/" || next == "" {
+			return "/"
+		}
+		return "/" + next
+	})
+}
+
+// Jail returns the manager's path jail, or nil
+func (bm *BashManager) Jail() *PathJail {
+	return bm.jail
+}
+
+// commandDir is where sessions and one-shot commands start: the jail's root,
+// the first allowed root, or "" for the server's own directory
+func (bm *BashManager) commandDir() string {
+	switch {
+	case bm.jail != nil:
+		return bm.jail.root
+	case bm.roots != nil:
+		return bm.roots.roots[0]
+	}
+	return ""
+}
@@ -0,0 +1,91 @@
+package bash
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// jailFixture creates a jail with a symlink leading out of it
+func jailFixture(t *testing.T) (jail *PathJail, root string) {
+	t.Helper()
+	base, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	root = filepath.Join(base, "project")
+	outside := filepath.Join(base, "outside")
+	for _, dir := range []string{filepath.Join(root, "src"), outside} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	jail, err = NewPathJail(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jail, root
+}
+
+func TestPathJailResolve(t *testing.T) {
+	jail, root := jailFixture(t)
+
+	for path, want := range map[string]string{
+		"/":                  root,
+		"/src/main.go":       root + "/src/main.go",
+		"src/main.go":        root + "/src/main.go",
+		"/../../etc/passwd":  root + "/etc/passwd",
+		root + "/src":        root + "/src",
+		"/src/new/deep/file": root + "/src/new/deep/file",
+	} {
+		if got, err := jail.Resolve(path); err != nil || got != want {
+			t.Errorf("Resolve(%q) = %q, %v; want %q", path, got, err, want)
+		}
+	}
+
+	for _, path := range []string{"/escape", "/escape/file", "escape/new/file"} {
+		if got, err := jail.Resolve(path); err == nil {
+			t.Errorf("Resolve(%q) = %q, want it refused", path, got)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, ".home")); err != nil {
+		t.Errorf("jail HOME not created: %v", err)
+	}
+}
+
+func TestPathJailRewrite(t *testing.T) {
+	jail, root := jailFixture(t)
+
+	for text, want := range map[string]string{
+		root:                            "/",
+		root + "/src/main.go:12: error": "/src/main.go:12: error",
+		"cd " + root + " && ls":         "cd / && ls",
+		"'" + root + "'":                "'/'",
+		root + "-other/file":            root + "-other/file",
+		root + "2/file":                 root + "2/file",
+		"nothing to see":                "nothing to see",
+	} {
+		if got := jail.Rewrite(text); got != want {
+			t.Errorf("Rewrite(%q) = %q, want %q", text, got, want)
+		}
+	}
+
+	var none *PathJail
+	if got := none.Rewrite(root); got != root {
+		t.Errorf("nil jail rewrote %q", got)
+	}
+}
+
+func TestSessionStartsInJail(t *testing.T) {
+	jail, root := jailFixture(t)
+	bm := newTestManager(t, Options{Jail: jail})
+
+	result := run(t, bm, `echo "$PWD|$HOME|$TMPDIR"`)
+	if want := root + "|" + root + "/.home|" + root + "/.tmp"; result.Output != want {
+		t.Errorf("output = %q, want %q", result.Output, want)
+	}
+}
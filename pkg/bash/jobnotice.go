@@ -0,0 +1,107 @@
+package bash
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// jobNoticePattern matches the job-control notifications bash prints when
+// monitor mode is on, e.g. "[1]+  Done                    sleep 0.1" or
+// "[2] 12345". These can land next to the completion marker and are not part
+// of the command's own output.
+var jobNoticePattern = regexp.MustCompile(
+	`^\[\d+\][+-]?\s+(\d+|(Done|Running|Stopped|Terminated|Killed|Hangup|Interrupt|Aborted|Exit \d+)(\(\d+\))?(\s.*)?)$`)
+
+// isJobNotice reports whether line is a bash job-control notification.
+func isJobNotice(line string) bool {
+	return jobNoticePattern.MatchString(strings.TrimRight(line, "\r"))
+}
+
+// jobFinished reports whether a job notice says the job has ended
+func jobFinished(notice string) bool {
+	match := jobNoticePattern.FindStringSubmatch(notice)
+	return match != nil && match[2] != "" && match[2] != "Running" && match[2] != "Stopped"
+}
+
+// splitJobNotices separates job-control notifications from other lines of text.
+func splitJobNotices(text string) (string, []string) {
+	if !strings.Contains(text, "[") {
+		return text, nil
+	}
+	var kept []string
+	var notices []string
+	for _, line := range strings.Split(text, "\n") {
+		if isJobNotice(line) {
+			notices = append(notices, strings.TrimSpace(line))
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return strings.Join(kept, "\n"), notices
+}
+
+// newMarker returns a completion marker for one command. It is random, so
+// output can't end a command early by printing a marker it guessed.
+func newMarker() (string, error) {
+	var raw [16]byte
+	if _, err := rand.Read(raw[:]); err != nil {
+		return "", fmt.Errorf("failed to generate completion marker: %w", err)
+	}
+	return "__BASH_CMD_DONE_" + hex.EncodeToString(raw[:]) + "__", nil
+}
+
+// markerCommand returns the command that follows each command to report it
+// finished: it prints marker, the exit code, the length of $PATH and the
+// working directory ("<marker><code>PATH:<length>CWD:<dir>") on a line of
+// its own. The marker is printed in two halves, so it never appears whole in
+// what the shell reads, for a command that reads that to echo back.
+func markerCommand(marker string) string {
+	half := len(marker) / 2
+	return fmt.Sprintf(`command printf '\n%%s%%s%%sPATH:%%sCWD:%%s\n' '%s' '%s' "$?" "${#PATH}" "$PWD"`,
+		marker[:half], marker[half:])
+}
+
+// parseMarkerLine parses a line printed by markerCommand, returning the exit
+// code, length of $PATH and working directory in it. found is false unless
+// the whole line has that form: output that merely contains the marker, or
+// has it followed by anything else, is not the marker.
+func parseMarkerLine(line, marker string) (exitCode, pathLength int, cwd string, found bool) {
+	rest, ok := strings.CutPrefix(line, marker)
+	if !ok {
+		return 0, 0, "", false
+	}
+	code, rest, ok := strings.Cut(rest, "PATH:")
+	if !ok || !isDigits(code) {
+		return 0, 0, "", false
+	}
+	length, cwd, ok := strings.Cut(rest, "CWD:")
+	if !ok || !isDigits(length) {
+		return 0, 0, "", false
+	}
+	exitCode, err := strconv.Atoi(code)
+	if err != nil {
+		return 0, 0, "", false
+	}
+	pathLength, err = strconv.Atoi(length)
+	if err != nil {
+		return 0, 0, "", false
+	}
+	return exitCode, pathLength, cwd, true
+}
+
+// isDigits reports whether s is one or more decimal digits
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,56 @@
+package bash
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMarkerLine(t *testing.T) {
+	const marker = "__BASH_CMD_DONE_0123456789abcdef__"
+	tests := []struct {
+		line       string
+		found      bool
+		exitCode   int
+		pathLength int
+		cwd        string
+	}{
+		{marker + "0PATH:42CWD:/tmp", true, 0, 42, "/tmp"},
+		{marker + "127PATH:0CWD:/a dir/CWD:b", true, 127, 0, "/a dir/CWD:b"},
+		{marker + "1PATH:5CWD:", true, 1, 5, ""},
+		{"got:" + marker + "0PATH:42CWD:/tmp", false, 0, 0, ""},
+		{marker, false, 0, 0, ""},
+		{marker + "xPATH:42CWD:/tmp", false, 0, 0, ""},
+		{marker + "PATH:42CWD:/tmp", false, 0, 0, ""},
+		{marker + "-1PATH:42CWD:/tmp", false, 0, 0, ""},
+		{marker + "0PATH:CWD:/tmp", false, 0, 0, ""},
+		{marker + "0PATH:42", false, 0, 0, ""},
+		{"__BASH_CMD_DONE_0PATH:42CWD:/tmp", false, 0, 0, ""},
+	}
+	for _, tt := range tests {
+		exitCode, pathLength, cwd, found := parseMarkerLine(tt.line, marker)
+		if found != tt.found || exitCode != tt.exitCode || pathLength != tt.pathLength || cwd != tt.cwd {
+			t.Errorf("parseMarkerLine(%q) = %d, %d, %q, %v; want %d, %d, %q, %v", tt.line,
+				exitCode, pathLength, cwd, found, tt.exitCode, tt.pathLength, tt.cwd, tt.found)
+		}
+	}
+}
+
+func TestMarkerCommandHidesMarker(t *testing.T) {
+	marker, err := newMarker()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if command := markerCommand(marker); strings.Contains(command, marker) {
+		t.Errorf("markerCommand(%q) = %q contains the marker", marker, command)
+	}
+}
+
+func TestSplitJobNotices(t *testing.T) {
+	text, notices := splitJobNotices("one\n[1]+  Done                    sleep 0.1\ntwo\n[2] 12345")
+	if text != "one\ntwo" {
+		t.Errorf("text = %q, want %q", text, "one\ntwo")
+	}
+	if len(notices) != 2 || !jobFinished(notices[0]) || jobFinished(notices[1]) {
+		t.Errorf("notices = %q, want a finished job then a started one", notices)
+	}
+}
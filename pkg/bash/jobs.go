@@ -0,0 +1,556 @@
+package bash
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/events"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/perms"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/truncate"
+)
+
+// DefaultMaxJobs is how many background jobs may run at once unless
+// configured otherwise
+const DefaultMaxJobs = 16
+
+// maxFinishedJobs is how many finished background jobs are remembered. Past
+// that the one that finished first is forgotten and its output file removed.
+const maxFinishedJobs = 32
+
+// jobStopGrace is how long a background job has to exit after SIGTERM
+// before it is killed
+const jobStopGrace = 5 * time.Second
+
+// JobInfo describes a background job for the job tools
+type JobInfo struct {
+	ID          int        `json:"id"`
+	PID         int        `json:"pid"`
+	Command     string     `json:"command"`
+	Session     int        `json:"session,omitempty"` // the session that started it
+	StartedAt   time.Time  `json:"startedAt"`
+	Running     bool       `json:"running"`
+	ExitCode    *int       `json:"exitCode,omitempty"`   // -1 if killed by a signal; unset if unknown
+	ExitStatus  string     `json:"exitStatus,omitempty"` // e.g. "exit status 1", "signal: killed"
+	EndedAt     *time.Time `json:"endedAt,omitempty"`
+	OutputFile  string     `json:"outputFile"`
+	OutputBytes int64      `json:"outputBytes"`
+	ReadOffset  int64      `json:"readOffset"` // where the next bash_job_output read starts
+
+	// Adopted is set for a job an earlier server started and this one took
+	// back; Lost for one that was gone when this server started, whose
+	// output is what it had written by then
+	Adopted bool `json:"adopted,omitempty"`
+	Lost    bool `json:"lost,omitempty"`
+}
+
+// JobOutputPage is a slice of a background job's output
+type JobOutputPage struct {
+	Job        int
+	Offset     int64
+	Text       string
+	Bytes      int
+	TotalBytes int64 // written so far
+	NextOffset int64
+	Running    bool
+}
+
+// job is a command running detached from the session, in its own session
+// and process group, with stdout and stderr going to a file. An adopted job
+// was started by an earlier server: cmd only holds its process, to signal.
+type job struct {
+	id        int
+	pid       int
+	command   string
+	session   int
+	startedAt time.Time
+	cmd       *exec.Cmd
+	logPath   string
+	onExit    func()
+
+	// processStart tells the job's process from a later one given its PID
+	// (see processStart); 0 if unknown
+	processStart uint64
+	adopted      bool
+
+	// done is closed once the job has exited; exitCode, exitStatus,
+	// endedAt, exitUnknown and lost are set before
+	done        chan struct{}
+	exitCode    int
+	exitStatus  string
+	endedAt     time.Time
+	exitUnknown bool
+	lost        bool
+
+	readMutex  sync.Mutex
+	readOffset int64
+}
+
+// jobTable holds the manager's background jobs. Output files are kept in
+// dir, created with the first job, until the manager closes. With a state
+// file, the jobs are recorded there and dir is kept for the next manager.
+type jobTable struct {
+	mutex     sync.Mutex
+	dir       string
+	max       int
+	next      int
+	jobs      map[int]*job
+	closed    bool
+	stateFile string
+
+	// saveMutex keeps state file writes in order
+	saveMutex sync.Mutex
+}
+
+// StartJob runs command in the background and returns at once. It starts in
+// the session's current directory, with the environment new sessions get, in
+// a shell of its own: variables and functions defined in the session aren't
+// visible. onExit, if set, is called once the job exits. The job's
+// description is shown as its command.
+func (bm *BashManager) StartJob(command, description string, onExit func()) (JobInfo, error) {
+	info, err := bm.startJob(command, description, onExit)
+	if err == nil {
+		bm.saveJobs()
+	}
+	return info, err
+}
+
+// startJob starts a job for StartJob
+func (bm *BashManager) startJob(command, description string, onExit func()) (JobInfo, error) {
+	t := &bm.jobs
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.closed {
+		return JobInfo{}, fmt.Errorf("the server is shutting down")
+	}
+	running := 0
+	for _, j := range t.jobs {
+		if j.running() {
+			running++
+		}
+	}
+	if running >= t.max {
+		return JobInfo{}, fmt.Errorf("%d background jobs are already running, the most allowed; wait for one to "+
+			"finish or stop one with bash_job_kill", running)
+	}
+	if t.dir == "" {
+		dir, err := t.makeDir()
+		if err != nil {
+			return JobInfo{}, fmt.Errorf("failed to create the job output directory: %w", err)
+		}
+		t.dir = dir
+	}
+	if t.jobs == nil {
+		t.jobs = make(map[int]*job)
+	}
+
+	t.next++
+	j := &job{
+		id:      t.next,
+		command: description,
+		session: bm.SessionID(),
+		logPath: filepath.Join(t.dir, fmt.Sprintf("job-%d.log", t.next)),
+		onExit:  onExit,
+		done:    make(chan struct{}),
+	}
+	log, err := perms.OpenFile(j.logPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if err != nil {
+		return JobInfo{}, fmt.Errorf("failed to create the job output file: %w", err)
+	}
+	// The file is the job's, not ours: the server only reads it by name
+	defer log.Close()
+
+	j.cmd = bm.sandboxed(bm.shellCommand("-c", command))
+	j.cmd.Env, _ = bm.sessionEnv()
+	j.cmd.Dir = bm.WorkingDirectory()
+	if j.cmd.Dir == "" {
+		j.cmd.Dir = bm.commandDir()
+	}
+	j.cmd.Stdout = log
+	j.cmd.Stderr = log
+	bm.runAs.setCredential(j.cmd)
+	setSession(j.cmd)
+
+	if err := j.cmd.Start(); err != nil {
+		os.Remove(j.logPath)
+		return JobInfo{}, fmt.Errorf("failed to start background job: %w", err)
+	}
+	j.startedAt = time.Now()
+	j.pid = j.cmd.Process.Pid
+	j.processStart, _ = processStart(j.pid)
+	t.jobs[j.id] = j
+	fmt.Fprintf(os.Stderr, "Started background job %d (PID: %d)\n", j.id, j.pid)
+
+	go bm.reapJob(j)
+	return j.info(), nil
+}
+
+// reapJob waits for a job to exit, records how, and reports it
+func (bm *BashManager) reapJob(j *job) {
+	err := j.cmd.Wait()
+	j.endedAt = time.Now()
+	if state := j.cmd.ProcessState; state != nil {
+		j.exitCode = state.ExitCode()
+		j.exitStatus = state.String()
+	} else {
+		j.exitCode = -1
+		j.exitStatus = err.Error()
+	}
+	bm.finishJob(j)
+}
+
+// finishJob marks a job done once how it exited is recorded, and reports
+// it
+func (bm *BashManager) finishJob(j *job) {
+	close(j.done)
+	bm.jobs.mutex.Lock()
+	bm.jobs.prune()
+	bm.jobs.mutex.Unlock()
+	bm.saveJobs()
+	if j.onExit != nil {
+		j.onExit()
+	}
+
+	fmt.Fprintf(os.Stderr, "Background job %d (PID: %d) finished: %s\n", j.id, j.pid, j.exitStatus)
+	data := map[string]interface{}{"job": j.id, "pid": j.pid}
+	if !j.exitUnknown {
+		data["exitCode"] = j.exitCode
+	}
+	bm.events.Publish(events.JobCompleted, fmt.Sprintf("Background job %d finished (%s)", j.id, j.exitStatus), data)
+}
+
+// prune forgets the finished jobs beyond maxFinishedJobs that finished
+// first and removes their output files. The caller holds t.mutex.
+func (t *jobTable) prune() {
+	var finished []*job
+	for _, j := range t.jobs {
+		if !j.running() {
+			finished = append(finished, j)
+		}
+	}
+	if len(finished) <= maxFinishedJobs {
+		return
+	}
+	sort.Slice(finished, func(a, b int) bool { return finished[a].endedAt.Before(finished[b].endedAt) })
+	for _, j := range finished[:len(finished)-maxFinishedJobs] {
+		delete(t.jobs, j.id)
+		os.Remove(j.logPath)
+	}
+}
+
+// running reports whether the job is still running
+func (j *job) running() bool {
+	select {
+	case <-j.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// info describes the job
+func (j *job) info() JobInfo {
+	info := JobInfo{
+		ID:         j.id,
+		PID:        j.pid,
+		Command:    j.command,
+		Session:    j.session,
+		StartedAt:  j.startedAt,
+		Running:    j.running(),
+		OutputFile: j.logPath,
+		Adopted:    j.adopted,
+	}
+	if !info.Running {
+		exitCode, endedAt := j.exitCode, j.endedAt
+		info.ExitStatus, info.EndedAt, info.Lost = j.exitStatus, &endedAt, j.lost
+		if !j.exitUnknown {
+			info.ExitCode = &exitCode
+		}
+	}
+	if stat, err := os.Stat(j.logPath); err == nil {
+		info.OutputBytes = stat.Size()
+	}
+	j.readMutex.Lock()
+	info.ReadOffset = j.readOffset
+	j.readMutex.Unlock()
+	return info
+}
+
+// job returns the background job with the given id
+func (bm *BashManager) job(id int) (*job, error) {
+	bm.jobs.mutex.Lock()
+	defer bm.jobs.mutex.Unlock()
+	j, ok := bm.jobs.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown background job %d (only the last %d finished jobs are kept)", id,
+			maxFinishedJobs)
+	}
+	return j, nil
+}
+
+// Jobs describes every running background job and the most recently
+// finished ones, oldest first
+func (bm *BashManager) Jobs() []JobInfo {
+	bm.jobs.mutex.Lock()
+	jobs := make([]*job, 0, len(bm.jobs.jobs))
+	for _, j := range bm.jobs.jobs {
+		jobs = append(jobs, j)
+	}
+	bm.jobs.mutex.Unlock()
+
+	sort.Slice(jobs, func(a, b int) bool { return jobs[a].id < jobs[b].id })
+	infos := make([]JobInfo, len(jobs))
+	for i, j := range jobs {
+		infos[i] = j.info()
+	}
+	return infos
+}
+
+// JobStatus describes one background job
+func (bm *BashManager) JobStatus(id int) (JobInfo, error) {
+	j, err := bm.job(id)
+	if err != nil {
+		return JobInfo{}, err
+	}
+	return j.info(), nil
+}
+
+// JobOutput returns up to limit bytes of a job's output from offset, or, if
+// offset is nil, from where the previous read stopped. Pages end on a
+// character boundary, and while the job runs a character it is part way
+// through writing is left for the next read. limit <= 0 or above the output
+// size limit reads up to that limit.
+func (bm *BashManager) JobOutput(id int, offset *int64, limit int) (JobOutputPage, error) {
+	j, err := bm.job(id)
+	if err != nil {
+		return JobOutputPage{}, err
+	}
+	if limit <= 0 || limit > bm.maxOutput {
+		limit = bm.maxOutput
+	}
+	// Whether it was running is taken before reading, so output written
+	// just before it exited is never mistaken for a partial write
+	running := j.running()
+
+	j.readMutex.Lock()
+	defer j.readMutex.Unlock()
+	start := j.readOffset
+	if offset != nil {
+		start = *offset
+	}
+
+	file, err := os.Open(j.logPath)
+	if err != nil {
+		return JobOutputPage{}, fmt.Errorf("failed to read job output: %w", err)
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return JobOutputPage{}, fmt.Errorf("failed to read job output: %w", err)
+	}
+	total := stat.Size()
+	if start < 0 || start > total {
+		return JobOutputPage{}, fmt.Errorf("offset %d is outside the job's output (0-%d)", start, total)
+	}
+
+	// Read a few bytes before start so it can be moved back to the start of
+	// a character
+	from := max(start-utf8.UTFMax+1, 0)
+	data := make([]byte, min(total-from, start-from+int64(limit)))
+	if _, err := file.ReadAt(data, from); err != nil && err != io.EOF {
+		return JobOutputPage{}, fmt.Errorf("failed to read job output: %w", err)
+	}
+	skip := int(start - from)
+	for skip > 0 && skip < len(data) && !utf8.RuneStart(data[skip]) {
+		skip--
+	}
+	page := data[skip:]
+	if len(page) > limit {
+		page = truncate.Head(page, limit)
+	} else if running {
+		page = completeRunes(page)
+	}
+
+	start = from + int64(skip)
+	j.readOffset = start + int64(len(page))
+	return JobOutputPage{
+		Job:        j.id,
+		Offset:     start,
+		Text:       string(page),
+		Bytes:      len(page),
+		TotalBytes: total,
+		NextOffset: j.readOffset,
+		Running:    running,
+	}, nil
+}
+
+// completeRunes drops a character cut short at the end of data
+func completeRunes(data []byte) []byte {
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				return data[:i]
+			}
+			break
+		}
+	}
+	return data
+}
+
+// KillJob stops a background job and everything it started: SIGTERM to its
+// process group, then SIGKILL if it hasn't exited within jobStopGrace.
+func (bm *BashManager) KillJob(id int) (JobInfo, error) {
+	j, err := bm.job(id)
+	if err != nil {
+		return JobInfo{}, err
+	}
+	if !j.running() {
+		return JobInfo{}, fmt.Errorf("background job %d has already finished (%s)", id, j.exitStatus)
+	}
+	j.stop()
+	return j.info(), nil
+}
+
+// stop signals the job's process group, escalating to SIGKILL, and waits
+// for it to exit
+func (j *job) stop() {
+	j.signal(terminateProcessGroup)
+	select {
+	case <-j.done:
+		return
+	case <-time.After(jobStopGrace):
+	}
+	fmt.Fprintf(os.Stderr, "Background job %d ignored SIGTERM for %v; killing it\n", j.id, jobStopGrace)
+	j.signal(killProcessGroup)
+	<-j.done
+}
+
+// signal signals the job's process group with send. An adopted job isn't
+// the server's child, so its PID could have passed to another process once
+// it exited: that is checked first.
+func (j *job) signal(send func(*exec.Cmd) error) {
+	if j.adopted && !j.alive() {
+		return
+	}
+	send(j.cmd)
+}
+
+// closeJobs stops every running job and removes their output files. No job
+// can be started afterwards. With a state file the jobs are left running
+// and their files kept, for the next manager to take back.
+func (bm *BashManager) closeJobs() {
+	t := &bm.jobs
+	if t.stateFile != "" {
+		bm.saveJobs()
+		t.mutex.Lock()
+		t.closed = true
+		t.mutex.Unlock()
+		return
+	}
+	t.mutex.Lock()
+	t.closed = true
+	jobs := make([]*job, 0, len(t.jobs))
+	for _, j := range t.jobs {
+		jobs = append(jobs, j)
+	}
+	t.mutex.Unlock()
+
+	var wg sync.WaitGroup
+	for _, j := range jobs {
+		if j.running() {
+			wg.Add(1)
+			go func(j *job) {
+				defer wg.Done()
+				j.stop()
+			}(j)
+		}
+	}
+	wg.Wait()
+	if t.dir != "" {
+		os.RemoveAll(t.dir)
+	}
+}
+
+// Job tool schemas
+
+// jobIDProperty is the job argument shared by the job tools
+var jobIDProperty = map[string]interface{}{
+	"type":        "integer",
+	"description": "Job id returned when the background job was started",
+}
+
+// JobStatusToolSchema defines the schema for bash_job_status input
+var JobStatusToolSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"job": map[string]interface{}{
+			"type":        "integer",
+			"description": "Job id returned when the background job was started (default: list every job)",
+		},
+	},
+}
+
+// JobOutputToolSchema defines the schema for bash_job_output input
+var JobOutputToolSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"job": jobIDProperty,
+		"offset": map[string]interface{}{
+			"type":        "integer",
+			"description": "Byte offset to read from (default: where the previous read stopped)",
+		},
+		"limit": map[string]interface{}{
+			"type":        "integer",
+			"description": "Maximum bytes to return (default and maximum: the server's output size limit)",
+		},
+	},
+	"required": []string{"job"},
+}
+
+// JobKillToolSchema defines the schema for bash_job_kill input
+var JobKillToolSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"job": jobIDProperty,
+	},
+	"required": []string{"job"},
+}
+
+// ParseJobArgs parses arguments for the bash_job_status, bash_job_output and
+// bash_job_kill tools. id is 0 if no job was named, which only
+// bash_job_status allows.
+func ParseJobArgs(tool string, args json.RawMessage) (id int, offset *int64, limit int, err error) {
+	var params struct {
+		Job    int    `json:"job"`
+		Offset *int64 `json:"offset"`
+		Limit  int    `json:"limit"`
+	}
+
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &params); err != nil {
+			return 0, nil, 0, fmt.Errorf("invalid arguments for %s tool: %w", tool, err)
+		}
+	}
+
+	if params.Job == 0 && tool != "bash_job_status" {
+		return 0, nil, 0, fmt.Errorf("job parameter is required")
+	}
+	if params.Job < 0 {
+		return 0, nil, 0, fmt.Errorf("job must be positive")
+	}
+	if params.Offset != nil && *params.Offset < 0 {
+		return 0, nil, 0, fmt.Errorf("offset must not be negative")
+	}
+	if params.Limit < 0 {
+		return 0, nil, 0, fmt.Errorf("limit must not be negative")
+	}
+
+	return params.Job, params.Offset, params.Limit, nil
+}
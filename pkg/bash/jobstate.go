@@ -0,0 +1,210 @@
+package bash
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"time"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/perms"
+)
+
+// jobWatchInterval is how often an adopted job is checked for having
+// exited: it isn't the server's child, so there is nothing to wait on
+var jobWatchInterval = time.Second
+
+// Exit statuses of jobs whose exit the server didn't see
+const (
+	jobStatusLost   = "lost: it was no longer running when the server restarted; exit status unknown"
+	jobStatusExited = "exited after the server restarted; exit status unknown"
+)
+
+// jobState is the state file's contents
+type jobState struct {
+	Next int         `json:"next"`
+	Jobs []jobRecord `json:"jobs"`
+}
+
+// jobRecord is one job in the state file. EndedAt is set once it has
+// finished, with ExitCode unless its exit wasn't seen.
+type jobRecord struct {
+	ID           int        `json:"id"`
+	PID          int        `json:"pid"`
+	ProcessStart uint64     `json:"processStart,omitempty"`
+	Command      string     `json:"command"`
+	Session      int        `json:"session,omitempty"`
+	StartedAt    time.Time  `json:"startedAt"`
+	OutputFile   string     `json:"outputFile"`
+	ReadOffset   int64      `json:"readOffset"`
+	EndedAt      *time.Time `json:"endedAt,omitempty"`
+	ExitCode     *int       `json:"exitCode,omitempty"`
+	ExitStatus   string     `json:"exitStatus,omitempty"`
+	Lost         bool       `json:"lost,omitempty"`
+}
+
+// makeDir creates the directory for job output files: beside the state
+// file if there is one, so it outlives the manager, or a temporary one
+func (t *jobTable) makeDir() (string, error) {
+	if t.stateFile == "" {
+		return perms.MkdirTemp("", "mcp-bash-jobs-")
+	}
+	dir := t.stateFile + ".output"
+	return dir, perms.MkdirAll(dir)
+}
+
+// record describes the job for the state file
+func (j *job) record() jobRecord {
+	info := j.info()
+	return jobRecord{
+		ID:           j.id,
+		PID:          j.pid,
+		ProcessStart: j.processStart,
+		Command:      j.command,
+		Session:      j.session,
+		StartedAt:    j.startedAt,
+		OutputFile:   j.logPath,
+		ReadOffset:   info.ReadOffset,
+		EndedAt:      info.EndedAt,
+		ExitCode:     info.ExitCode,
+		ExitStatus:   info.ExitStatus,
+		Lost:         info.Lost,
+	}
+}
+
+// saveJobs writes the jobs to the state file, if there is one, as a job
+// starts or finishes. Failures are logged: they only cost a later server
+// the jobs it would have taken back.
+func (bm *BashManager) saveJobs() {
+	t := &bm.jobs
+	if t.stateFile == "" {
+		return
+	}
+	t.saveMutex.Lock()
+	defer t.saveMutex.Unlock()
+
+	t.mutex.Lock()
+	if t.closed {
+		// The jobs are the next manager's now
+		t.mutex.Unlock()
+		return
+	}
+	state := jobState{Next: t.next, Jobs: make([]jobRecord, 0, len(t.jobs))}
+	for _, j := range t.jobs {
+		state.Jobs = append(state.Jobs, j.record())
+	}
+	t.mutex.Unlock()
+	sort.Slice(state.Jobs, func(a, b int) bool { return state.Jobs[a].ID < state.Jobs[b].ID })
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to save background jobs: %v\n", err)
+		return
+	}
+	tmp := t.stateFile + ".tmp"
+	if err := perms.WriteFile(tmp, data); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to save background jobs: %v\n", err)
+		return
+	}
+	if err := os.Rename(tmp, t.stateFile); err != nil {
+		os.Remove(tmp)
+		fmt.Fprintf(os.Stderr, "Failed to save background jobs: %v\n", err)
+	}
+}
+
+// loadJobs reads the jobs an earlier manager recorded in the state file.
+// A job still running is taken back if its PID belongs to the process the
+// state file recorded, not a later one given the same PID; the rest are
+// marked lost, their output kept as far as it got. Finished jobs are
+// remembered as they were. New jobs are numbered on from the recorded ones.
+func (bm *BashManager) loadJobs() {
+	t := &bm.jobs
+	data, err := os.ReadFile(t.stateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	var state jobState
+	if err == nil {
+		err = json.Unmarshal(data, &state)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ignoring background job state %s: %v\n", t.stateFile, err)
+		return
+	}
+
+	now := time.Now()
+	var adopted []*job
+	t.mutex.Lock()
+	t.jobs = make(map[int]*job, len(state.Jobs))
+	t.next = state.Next
+	for _, record := range state.Jobs {
+		j := &job{
+			id:           record.ID,
+			pid:          record.PID,
+			command:      record.Command,
+			session:      record.Session,
+			startedAt:    record.StartedAt,
+			logPath:      record.OutputFile,
+			processStart: record.ProcessStart,
+			readOffset:   record.ReadOffset,
+			done:         make(chan struct{}),
+		}
+		t.next = max(t.next, j.id)
+
+		switch {
+		case record.EndedAt != nil:
+			j.endedAt, j.exitStatus, j.lost = *record.EndedAt, record.ExitStatus, record.Lost
+			j.exitUnknown = record.ExitCode == nil
+			if record.ExitCode != nil {
+				j.exitCode = *record.ExitCode
+			}
+			close(j.done)
+		case j.alive():
+			process, _ := os.FindProcess(j.pid)
+			j.cmd = &exec.Cmd{Process: process}
+			j.adopted = true
+			adopted = append(adopted, j)
+			fmt.Fprintf(os.Stderr, "Took back background job %d (PID: %d)\n", j.id, j.pid)
+		default:
+			j.endedAt, j.exitStatus, j.exitUnknown, j.lost = now, jobStatusLost, true, true
+			close(j.done)
+			fmt.Fprintf(os.Stderr, "Background job %d (PID: %d) was lost while the server was down\n", j.id, j.pid)
+		}
+		t.jobs[j.id] = j
+	}
+	t.prune()
+	t.mutex.Unlock()
+
+	for _, j := range adopted {
+		go bm.watchJob(j)
+	}
+	bm.saveJobs()
+}
+
+// alive reports whether the job's process is still running: its PID must
+// belong to the process that started at the recorded time. Where start
+// times can't be read, no job can be told apart from a later process.
+func (j *job) alive() bool {
+	if j.processStart == 0 {
+		return false
+	}
+	start, err := processStart(j.pid)
+	return err == nil && start == j.processStart
+}
+
+// watchJob polls an adopted job until its process has gone, then reports
+// it finished. How it exited went to its parent, which isn't this server.
+func (bm *BashManager) watchJob(j *job) {
+	ticker := time.NewTicker(jobWatchInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !j.alive() {
+			break
+		}
+	}
+	j.endedAt = time.Now()
+	j.exitCode, j.exitStatus, j.exitUnknown = -1, jobStatusExited, true
+	bm.finishJob(j)
+}
@@ -0,0 +1,179 @@
+//go:build linux
+
+package bash
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// watchJobsQuickly makes adopted jobs be checked often for the test
+func watchJobsQuickly(t *testing.T) {
+	interval := jobWatchInterval
+	jobWatchInterval = 20 * time.Millisecond
+	t.Cleanup(func() { jobWatchInterval = interval })
+}
+
+// waitForJob waits for a background job to finish and returns it
+func waitForJob(t *testing.T, bm *BashManager, id int) JobInfo {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		info, err := bm.JobStatus(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.Running {
+			return info
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %d still running", id)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// jobOutput reads all of a background job's output
+func jobOutput(t *testing.T, bm *BashManager, id int) string {
+	t.Helper()
+	var from int64
+	page, err := bm.JobOutput(id, &from, 0)
+	if err != nil {
+		t.Fatalf("job %d output: %v", id, err)
+	}
+	return page.Text
+}
+
+func TestJobsTakenBackAfterRestart(t *testing.T) {
+	watchJobsQuickly(t)
+	state := filepath.Join(t.TempDir(), "jobs.json")
+
+	first := NewBashManager(Options{Timeout: 10 * time.Second, JobStateFile: state})
+	long, err := first.StartJob("echo started; exec sleep 30", "long", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { syscall.Kill(-long.PID, syscall.SIGKILL) })
+	quick, err := first.StartJob("echo quick; exit 3", "quick", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForJob(t, first, quick.ID)
+	for !strings.Contains(jobOutput(t, first, long.ID), "started") {
+		time.Sleep(20 * time.Millisecond)
+	}
+	first.Close()
+
+	second := newTestManager(t, Options{JobStateFile: state})
+	info, err := second.JobStatus(long.ID)
+	if err != nil || !info.Running || !info.Adopted || info.PID != long.PID {
+		t.Fatalf("long job after the restart = %+v, %v; want it taken back", info, err)
+	}
+	if output := jobOutput(t, second, long.ID); output != "started\n" {
+		t.Errorf("long job output = %q, want %q", output, "started\n")
+	}
+	info, err = second.JobStatus(quick.ID)
+	if err != nil || info.Running || info.ExitCode == nil || *info.ExitCode != 3 {
+		t.Errorf("quick job after the restart = %+v, %v; want it finished with exit code 3", info, err)
+	}
+
+	next, err := second.StartJob("true", "next", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.ID != quick.ID+1 {
+		t.Errorf("new job id = %d, want %d", next.ID, quick.ID+1)
+	}
+
+	info, err = second.KillJob(long.ID)
+	if err != nil || info.Running || info.ExitCode != nil || info.ExitStatus != jobStatusExited {
+		t.Errorf("killed adopted job = %+v, %v; want it finished with its exit status unknown", info, err)
+	}
+}
+
+func TestJobStateAdoptsOnlyLiveJobs(t *testing.T) {
+	watchJobsQuickly(t)
+	dir := t.TempDir()
+	state := filepath.Join(dir, "jobs.json")
+
+	// A live job, and a finished process whose PID may since have passed on
+	live := exec.Command("sleep", "30")
+	setProcessGroup(live)
+	if err := live.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		live.Process.Kill()
+		live.Wait()
+	})
+	dead := exec.Command("true")
+	if err := dead.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// Until it is waited for, even if it has exited
+	deadStat, err := readProcStat(dead.Process.Pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead.Wait()
+	liveStart, err := processStart(live.Process.Pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record := func(id, pid int, start uint64) jobRecord {
+		output := filepath.Join(dir, fmt.Sprintf("job-%d.log", id))
+		if err := os.WriteFile(output, []byte("last words\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return jobRecord{ID: id, PID: pid, ProcessStart: start, Command: "fake", Session: 1,
+			StartedAt: time.Now(), OutputFile: output}
+	}
+	data, err := json.Marshal(jobState{Next: 3, Jobs: []jobRecord{
+		record(1, live.Process.Pid, liveStart),
+		record(2, dead.Process.Pid, deadStat.start),
+		// The live PID, recorded for a process that started at another time
+		record(3, live.Process.Pid, liveStart+1),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(state, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	bm := newTestManager(t, Options{JobStateFile: state})
+	if info, _ := bm.JobStatus(1); !info.Running || !info.Adopted || info.Session != 1 {
+		t.Errorf("live job = %+v, want it taken back", info)
+	}
+	for _, id := range []int{2, 3} {
+		info, err := bm.JobStatus(id)
+		if err != nil || info.Running || !info.Lost || info.ExitCode != nil || info.ExitStatus != jobStatusLost {
+			t.Errorf("job %d = %+v, %v; want it lost", id, info, err)
+		}
+		if output := jobOutput(t, bm, id); output != "last words\n" {
+			t.Errorf("job %d output = %q, want its last known output", id, output)
+		}
+	}
+
+	// The state file now records the lost jobs as finished
+	var saved jobState
+	data, _ = os.ReadFile(state)
+	if err := json.Unmarshal(data, &saved); err != nil || len(saved.Jobs) != 3 || saved.Jobs[1].EndedAt == nil ||
+		!saved.Jobs[1].Lost || saved.Jobs[0].EndedAt != nil {
+		t.Errorf("saved state = %s, %v", data, err)
+	}
+
+	live.Process.Kill()
+	live.Wait()
+	if info := waitForJob(t, bm, 1); info.ExitCode != nil || info.ExitStatus != jobStatusExited {
+		t.Errorf("live job after exiting = %+v, want its exit status unknown", info)
+	}
+}
@@ -0,0 +1,79 @@
+package bash
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ResourceLimits are rlimits applied to the session shell, and so inherited
+// by every command it runs. Zero leaves a limit as it is.
+//
+// They are set with the shell's ulimit builtin as the session starts, as both
+// soft and hard limits, so commands can lower them but not raise them. Each
+// is per process, except MaxProcesses, which counts every process of the
+// user. On macOS MemoryBytes is accepted but not enforced by the kernel.
+type ResourceLimits struct {
+	CPUSeconds   int64 // ulimit -t
+	MemoryBytes  int64 // ulimit -v (address space)
+	MaxFileSize  int64 // ulimit -f, in bytes
+	MaxOpenFiles int64 // ulimit -n
+	MaxProcesses int64 // ulimit -u
+}
+
+// ulimitCommand returns the shell command that applies the limits, or "" if
+// none are set. A command that writes past MaxFileSize fails with EFBIG
+// rather than being killed by SIGXFSZ, which would take the session with it
+// for builtins like echo.
+func (l ResourceLimits) ulimitCommand() string {
+	var commands []string
+	add := func(option string, value int64) {
+		if value > 0 {
+			commands = append(commands, fmt.Sprintf("ulimit %s %d", option, value))
+		}
+	}
+	add("-t", l.CPUSeconds)
+	add("-v", ceilDiv(l.MemoryBytes, 1024)) // in KB
+	add("-n", l.MaxOpenFiles)
+	add("-u", l.MaxProcesses)
+	if l.MaxFileSize > 0 {
+		// bash counts in 1024-byte blocks, or 512 in POSIX mode
+		commands = append(commands, "trap '' XFSZ",
+			fmt.Sprintf("if shopt -qo posix; then ulimit -f %d; else ulimit -f %d; fi",
+				ceilDiv(l.MaxFileSize, 512), ceilDiv(l.MaxFileSize, 1024)))
+	}
+	return strings.Join(commands, " && ")
+}
+
+// ceilDiv divides n by d, rounding up
+func ceilDiv(n, d int64) int64 {
+	return (n + d - 1) / d
+}
+
+// applyLimits sets the resource limits in the session before anything else
+// runs in it. A limit the shell refuses, e.g. one above the server's own hard
+// limit, fails session creation rather than leaving it unlimited.
+func (bs *BashSession) applyLimits(limits ResourceLimits) error {
+	command := limits.ulimitCommand()
+	if command == "" {
+		return nil
+	}
+	return bs.runSetup("apply resource limits", command)
+}
+
+// runSetup runs a command that prepares a new session, failing with what it
+// printed if it exits non-zero
+func (bs *BashSession) runSetup(what, command string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), startupTimeout)
+	defer cancel()
+	result, err := bs.execute(command, ctx, executeLimits{total: startupTimeout})
+	bs.lastCommand.Store(0) // not a client command
+	if err != nil {
+		return fmt.Errorf("failed to %s: %w", what, err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("failed to %s (exit code %d): %s", what, result.ExitCode,
+			strings.TrimSpace(result.Output))
+	}
+	return nil
+}
@@ -0,0 +1,295 @@
+package bash
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/collate"
+)
+
+const (
+	// DefaultLockWait is how long acquire_lock waits for a held lock
+	DefaultLockWait = 30 * time.Second
+
+	// lockPollInterval is how often a held lock is retried
+	lockPollInterval = 100 * time.Millisecond
+)
+
+// ErrLockHeld is returned when a lock is still held elsewhere once the wait
+// runs out
+var ErrLockHeld = errors.New("lock is held by another process")
+
+// LockLease is the metadata written into a lock file while it is held, so
+// whoever finds it locked can see by whom, since when, and why
+type LockLease struct {
+	Owner      string    `json:"owner"`
+	PID        int       `json:"pid"`
+	Session    int       `json:"session,omitempty"`
+	AcquiredAt time.Time `json:"acquiredAt"`
+	Purpose    string    `json:"purpose,omitempty"`
+}
+
+// LockInfo describes a lock held by this server, for bash_sessions
+type LockInfo struct {
+	Path string `json:"path"`
+	LockLease
+}
+
+// heldLock is a lock file this server holds an flock(2) on
+type heldLock struct {
+	file  *os.File
+	lease LockLease
+}
+
+// lockTable holds the server's locks by path
+type lockTable struct {
+	mutex sync.Mutex
+	locks map[string]*heldLock
+}
+
+// AcquireLock takes an exclusive flock(2) on path, creating the file if
+// needed, so external processes using flock on the same file are excluded.
+// A held lock is retried until wait runs out. The lease is written into the
+// file. The lock belongs to the current session and is released when it
+// closes.
+//
+// With force, a lock whose lease is older than forceAfter is stolen: the
+// file is replaced, so anyone locking the path from then on locks the new
+// file, while the stale holder keeps its lock on the old one. forceAfter 0
+// disables stealing.
+func (bm *BashManager) AcquireLock(ctx context.Context, path, purpose string, wait time.Duration,
+	force bool, forceAfter time.Duration) (LockInfo, error) {
+	if force && forceAfter <= 0 {
+		return LockInfo{}, fmt.Errorf("force is disabled; set lockForceAfter in the config to allow stealing stale locks")
+	}
+
+	bm.locks.mutex.Lock()
+	_, held := bm.locks.locks[path]
+	bm.locks.mutex.Unlock()
+	if held {
+		return LockInfo{}, fmt.Errorf("lock %s is already held by this server", path)
+	}
+
+	deadline := time.Now().Add(wait)
+	for {
+		file, err := tryLock(path)
+		if err == nil {
+			return bm.holdLock(path, file, purpose)
+		}
+		if !errors.Is(err, ErrLockHeld) {
+			return LockInfo{}, err
+		}
+
+		if force {
+			if lease, ok := readLease(path); ok && time.Since(lease.AcquiredAt) > forceAfter {
+				fmt.Fprintf(os.Stderr, "Stealing lock %s held by %s (pid %d) since %v\n", path, lease.Owner,
+					lease.PID, lease.AcquiredAt)
+				if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+					return LockInfo{}, fmt.Errorf("failed to steal lock %s: %w", path, err)
+				}
+				continue
+			}
+		}
+
+		if !time.Now().Before(deadline) {
+			if lease, ok := readLease(path); ok {
+				return LockInfo{}, fmt.Errorf("%w: %s held by %s (pid %d) since %s", ErrLockHeld, path,
+					lease.Owner, lease.PID, lease.AcquiredAt.Format(time.RFC3339))
+			}
+			return LockInfo{}, fmt.Errorf("%w: %s", ErrLockHeld, path)
+		}
+		select {
+		case <-ctx.Done():
+			return LockInfo{}, ErrCommandCancelled
+		case <-time.After(min(lockPollInterval, time.Until(deadline))):
+		}
+	}
+}
+
+// holdLock writes the lease into a freshly locked file and records it
+func (bm *BashManager) holdLock(path string, file *os.File, purpose string) (LockInfo, error) {
+	owner, _ := os.Hostname()
+	lease := LockLease{
+		Owner:      fmt.Sprintf("mcp-bash-go@%s", owner),
+		PID:        os.Getpid(),
+		Session:    bm.SessionID(),
+		AcquiredAt: time.Now().UTC(),
+		Purpose:    purpose,
+	}
+	data, _ := json.Marshal(lease)
+	if err := file.Truncate(0); err == nil {
+		_, err = file.WriteAt(append(data, '\n'), 0)
+	}
+
+	bm.locks.mutex.Lock()
+	defer bm.locks.mutex.Unlock()
+	if bm.locks.locks == nil {
+		bm.locks.locks = make(map[string]*heldLock)
+	}
+	bm.locks.locks[path] = &heldLock{file: file, lease: lease}
+	return LockInfo{Path: path, LockLease: lease}, nil
+}
+
+// ReleaseLock releases a lock this server holds. The lease is cleared from
+// the file, which is left in place for other processes to lock.
+func (bm *BashManager) ReleaseLock(path string) error {
+	bm.locks.mutex.Lock()
+	lock, ok := bm.locks.locks[path]
+	delete(bm.locks.locks, path)
+	bm.locks.mutex.Unlock()
+	if !ok {
+		return fmt.Errorf("lock %s is not held by this server", path)
+	}
+	lock.release()
+	return nil
+}
+
+// releaseLocks releases the locks belonging to session, or every lock for
+// session 0. Locks taken while no session was open belong to the next one.
+func (bm *BashManager) releaseLocks(session int) {
+	bm.locks.mutex.Lock()
+	var released []*heldLock
+	for path, lock := range bm.locks.locks {
+		if session == 0 || lock.lease.Session <= session {
+			released = append(released, lock)
+			delete(bm.locks.locks, path)
+			fmt.Fprintf(os.Stderr, "Released lock %s with its session\n", path)
+		}
+	}
+	bm.locks.mutex.Unlock()
+
+	for _, lock := range released {
+		lock.release()
+	}
+}
+
+// release clears the lease and drops the flock
+func (l *heldLock) release() {
+	l.file.Truncate(0)
+	unlockFile(l.file)
+	l.file.Close()
+}
+
+// Locks lists the locks this server holds, sorted by path in the given order
+func (bm *BashManager) Locks(order collate.Mode) []LockInfo {
+	bm.locks.mutex.Lock()
+	defer bm.locks.mutex.Unlock()
+	locks := make([]LockInfo, 0, len(bm.locks.locks))
+	for path, lock := range bm.locks.locks {
+		locks = append(locks, LockInfo{Path: path, LockLease: lock.lease})
+	}
+	collate.SortFunc(locks, func(lock LockInfo) string { return lock.Path }, order)
+	return locks
+}
+
+// tryLock opens path and takes an exclusive lock without waiting. If the
+// file is replaced between opening and locking (a lock was stolen), it
+// starts over on the new file.
+func tryLock(path string) (*os.File, error) {
+	for {
+		// Not private: other users' processes may lock the same path
+		file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open lock file: %w", err)
+		}
+		if err := lockFile(file); err != nil {
+			file.Close()
+			return nil, err
+		}
+		opened, err1 := file.Stat()
+		current, err2 := os.Stat(path)
+		if err1 == nil && err2 == nil && os.SameFile(opened, current) {
+			return file, nil
+		}
+		unlockFile(file)
+		file.Close()
+	}
+}
+
+// readLease reads the lease from a lock file, if it has one
+func readLease(path string) (LockLease, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return LockLease{}, false
+	}
+	var lease LockLease
+	if json.Unmarshal(data, &lease) != nil || lease.AcquiredAt.IsZero() {
+		return LockLease{}, false
+	}
+	return lease, true
+}
+
+// LockToolSchema defines the schema for acquire_lock input
+var LockToolSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type":        "string",
+			"description": "Lock file to flock (created if missing). Relative paths are resolved against the session's current directory",
+		},
+		"timeout": map[string]interface{}{
+			"type":        "integer",
+			"minimum":     0,
+			"description": fmt.Sprintf("Seconds to wait for a held lock (default %d; 0 tries once)", int(DefaultLockWait.Seconds())),
+		},
+		"purpose": map[string]interface{}{
+			"type":        "string",
+			"description": "Why the lock is taken, recorded in the lock file for other processes to see",
+		},
+		"force": map[string]interface{}{
+			"type":        "boolean",
+			"description": "Steal the lock if its lease is older than the server's lockForceAfter (only if configured)",
+		},
+	},
+	"required": []string{"path"},
+}
+
+// ReleaseLockToolSchema defines the schema for release_lock input
+var ReleaseLockToolSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type":        "string",
+			"description": "Lock file passed to acquire_lock",
+		},
+	},
+	"required": []string{"path"},
+}
+
+// LockArgs holds the parsed arguments for acquire_lock and release_lock
+type LockArgs struct {
+	Path    string `json:"path"`
+	Timeout *int   `json:"timeout"` // seconds; nil means DefaultLockWait
+	Purpose string `json:"purpose"`
+	Force   bool   `json:"force"`
+}
+
+// Wait returns how long to wait for a held lock
+func (a LockArgs) Wait() time.Duration {
+	if a.Timeout == nil {
+		return DefaultLockWait
+	}
+	return time.Duration(*a.Timeout) * time.Second
+}
+
+// ParseLockArgs parses arguments for the acquire_lock and release_lock tools
+func ParseLockArgs(tool string, args json.RawMessage) (LockArgs, error) {
+	var params LockArgs
+
+	if err := json.Unmarshal(args, &params); err != nil {
+		return params, fmt.Errorf("invalid arguments for %s tool: %w", tool, err)
+	}
+	if params.Path == "" {
+		return params, fmt.Errorf("path parameter is required")
+	}
+	if params.Timeout != nil && *params.Timeout < 0 {
+		return params, fmt.Errorf("timeout must not be negative")
+	}
+
+	return params, nil
+}
@@ -0,0 +1,16 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package bash
+
+import (
+	"errors"
+	"os"
+)
+
+// lockFile fails where flock(2) is unavailable
+func lockFile(file *os.File) error {
+	return errors.New("file locking is not supported on this platform")
+}
+
+// unlockFile is a no-op where nothing can be locked
+func unlockFile(file *os.File) {}
@@ -0,0 +1,130 @@
+package bash
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/perms"
+)
+
+// DefaultSocketDir is where nested MCP servers are expected to listen
+const DefaultSocketDir = "/tmp/mcp-sockets"
+
+// socketProbeTimeout bounds each nested MCP socket connect probe
+const socketProbeTimeout = 500 * time.Millisecond
+
+// NestedOptions configures nested MCP support: the environment that lets
+// tools run inside the session (e.g. mcp-cli) find MCP servers over Unix
+// sockets.
+type NestedOptions struct {
+	// Disabled turns off all nested MCP environment variables
+	Disabled bool
+
+	// Sockets maps a name to a socket path; each reachable socket is
+	// exported as MCP_<NAME>_SOCKET. nil means the built-in skills socket,
+	// which is skipped silently when absent.
+	Sockets map[string]string
+}
+
+// defaultNestedSockets is used when no sockets are configured
+var defaultNestedSockets = map[string]string{
+	"skills": DefaultSocketDir + "/skills.sock",
+}
+
+// sessionEnv returns the environment for bash processes started by the
+// server. Nested MCP sockets are probed first and only those that accept a
+// connection are exported; the rest are returned as skipped descriptions.
+func (bm *BashManager) sessionEnv() ([]string, []string) {
+	env := os.Environ()
+	if bm.noColor {
+		env = appendNoColor(env)
+	}
+	if bm.jail != nil {
+		env = append(env, bm.jail.env()...)
+	}
+	if bm.runAs != nil {
+		env = bm.runAs.env(env)
+	}
+	if bm.nested.Disabled {
+		return env, nil
+	}
+
+	// NESTED MCP SUPPORT: Set environment variables for child processes
+	// This allows mcp-cli to detect nested execution and use Unix sockets
+	perms.MkdirAll(DefaultSocketDir) // Create socket directory with restrictive permissions
+	env = append(env,
+		"MCP_NESTED=1",                     // Signal nested MCP execution
+		"MCP_SOCKET_DIR="+DefaultSocketDir, // Unix socket directory
+	)
+
+	sockets := bm.nested.Sockets
+	if sockets == nil {
+		sockets = defaultNestedSockets
+	}
+
+	names := make([]string, 0, len(sockets))
+	for name := range sockets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Probe in parallel so a hung socket costs one timeout, not one each
+	errs := make([]error, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, path string) {
+			defer wg.Done()
+			errs[i] = probeSocket(path)
+		}(i, sockets[name])
+	}
+	wg.Wait()
+
+	var skipped []string
+	for i, name := range names {
+		path := sockets[name]
+		if errs[i] != nil {
+			fmt.Fprintf(os.Stderr, "Nested MCP socket %s not exported: %v\n", name, errs[i])
+			skipped = append(skipped, fmt.Sprintf("%s (%s)", name, path))
+			continue
+		}
+		env = append(env, socketEnvName(name)+"="+path)
+	}
+	return env, skipped
+}
+
+// probeSocket checks that something is accepting connections on a Unix socket
+func probeSocket(path string) error {
+	conn, err := net.DialTimeout("unix", path, socketProbeTimeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// socketEnvName returns the variable a socket is exported as, e.g.
+// "skills" -> MCP_SKILLS_SOCKET.
+func socketEnvName(name string) string {
+	upper := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+	return "MCP_" + upper + "_SOCKET"
+}
+
+// nestedSocketWarning describes configured sockets that were not exported
+func nestedSocketWarning(skipped []string) string {
+	return "Warning: nested MCP sockets not reachable, so not exported to the session: " +
+		strings.Join(skipped, ", ")
+}
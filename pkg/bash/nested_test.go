@@ -0,0 +1,55 @@
+package bash
+
+import (
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNestedSocketsProbedBeforeExport(t *testing.T) {
+	dir := t.TempDir()
+	live := filepath.Join(dir, "live.sock")
+	listener, err := net.Listen("unix", live)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer listener.Close()
+
+	bm := newTestManager(t, Options{Nested: NestedOptions{Sockets: map[string]string{
+		"live-one": live,
+		"gone":     filepath.Join(dir, "gone.sock"),
+	}}})
+
+	result := run(t, bm, `echo "$MCP_LIVE_ONE_SOCKET|${MCP_GONE_SOCKET-unset}"`)
+	if want := live + "|unset"; result.Output != want {
+		t.Errorf("output = %q, want %q", result.Output, want)
+	}
+	warning := strings.Join(result.Warnings, "\n")
+	if !strings.Contains(warning, "gone (") || strings.Contains(warning, "live-one") {
+		t.Errorf("warnings = %q, want only the unreachable socket named", warning)
+	}
+
+	// Reported once, with the session's first command
+	if result := run(t, bm, "true"); len(result.Warnings) != 0 {
+		t.Errorf("warnings repeated: %q", result.Warnings)
+	}
+}
+
+func TestNestedDisabled(t *testing.T) {
+	bm := newTestManager(t, Options{Nested: NestedOptions{Disabled: true}})
+	if result := run(t, bm, `echo "${MCP_NESTED-unset}"`); result.Output != "unset" {
+		t.Errorf("MCP_NESTED = %q with nested support disabled", result.Output)
+	}
+}
+
+func TestSocketEnvName(t *testing.T) {
+	for name, want := range map[string]string{
+		"skills":    "MCP_SKILLS_SOCKET",
+		"my-tool.2": "MCP_MY_TOOL_2_SOCKET",
+	} {
+		if got := socketEnvName(name); got != want {
+			t.Errorf("socketEnvName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package bash
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// unshareNetArgs returns the unshare arguments that run command under shell
+// in new user and network namespaces. The namespace has only a loopback
+// interface, which is down, so nothing is reachable.
+func unshareNetArgs(shell, command string) []string {
+	return []string{"--user", "--map-root-user", "--net", "--", shell, "-c", command}
+}
+
+// NetworkIsolation reports whether noNetwork commands are supported on this
+// host and, if not, why. Detected once, in the background, when the manager
+// is created; this waits for detection to finish.
+func (bm *BashManager) NetworkIsolation() (bool, string) {
+	if err := bm.netIsolation.wait(); err != nil {
+		return false, err.Error()
+	}
+	return true, ""
+}
+
+// WithoutNetwork wraps command so it runs with no network access. It fails,
+// rather than running the command connected, when isolation is unavailable.
+// Only exported variables reach the isolated shell.
+func (bm *BashManager) WithoutNetwork(command string) (string, error) {
+	if err := bm.netIsolation.wait(); err != nil {
+		return "", fmt.Errorf("noNetwork is not available on this host: %v", err)
+	}
+	quoted := make([]string, 0, 8)
+	for _, arg := range unshareNetArgs(bm.shell, command) {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	return "unshare " + strings.Join(quoted, " "), nil
+}
+
+// logNetworkIsolation reports the detection result
+func logNetworkIsolation(err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Network isolation (noNetwork) unavailable: %v\n", err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Network isolation (noNetwork) available\n")
+}
@@ -0,0 +1,29 @@
+//go:build linux
+
+package bash
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// detectNetworkIsolation checks that commands can be run under shell in a
+// fresh network namespace via an unprivileged user namespace.
+func detectNetworkIsolation(shell string) error {
+	path, err := exec.LookPath("unshare")
+	if err != nil {
+		return fmt.Errorf("unshare is not installed")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, path, unshareNetArgs(shell, "true")...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("unprivileged user/network namespaces are unavailable: %s",
+			strings.TrimSpace(string(out)+" "+err.Error()))
+	}
+	return nil
+}
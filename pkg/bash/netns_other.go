@@ -0,0 +1,10 @@
+//go:build !linux
+
+package bash
+
+import "errors"
+
+// detectNetworkIsolation reports that network namespaces are Linux-only.
+func detectNetworkIsolation(shell string) error {
+	return errors.New("network isolation requires Linux network namespaces")
+}
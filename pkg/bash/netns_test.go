@@ -0,0 +1,49 @@
+package bash
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestWithoutNetworkCutsConnections(t *testing.T) {
+	bm := newTestManager(t, Options{})
+	if ok, reason := bm.NetworkIsolation(); !ok {
+		t.Skip(reason)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	connect := fmt.Sprintf("(echo > /dev/tcp/127.0.0.1/%d) 2>/dev/null && echo connected || echo refused",
+		listener.Addr().(*net.TCPAddr).Port)
+	if result := run(t, bm, connect); result.Output != "connected" {
+		t.Fatalf("connecting from the session: %q", result.Output)
+	}
+
+	run(t, bm, "export ISOLATED_VALUE=kept")
+	isolated, err := bm.WithoutNetwork(connect + `; echo "$ISOLATED_VALUE"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := run(t, bm, isolated)
+	if !strings.HasPrefix(result.Output, "refused") {
+		t.Errorf("output = %q, want the connection refused", result.Output)
+	}
+	if !strings.HasSuffix(result.Output, "kept") {
+		t.Errorf("output = %q, want exported variables to reach the isolated shell", result.Output)
+	}
+}
@@ -0,0 +1,99 @@
+package bash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DefaultBypassTimeout is the timeout for bypassSession commands when no cap
+// is configured. Bypass commands are meant for quick diagnostics only.
+const DefaultBypassTimeout = 30 * time.Second
+
+// ExecuteOneShot runs a command in an independent `bash -c` process, outside
+// the persistent session. It does not take the session lock, so it works even
+// while a long command occupies the session. No session state (cwd, variables)
+// is used or changed. The command and its children are killed after timeout.
+func (bm *BashManager) ExecuteOneShot(command string) (CommandResult, error) {
+	timeout := bm.bypassTimeout
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := bm.sandboxed(bm.shellCommand("-c", command))
+	var skipped []string
+	cmd.Env, skipped = bm.sessionEnv()
+	cmd.Dir = bm.commandDir()
+	bm.runAs.setCredential(cmd)
+	setProcessGroup(cmd)
+
+	stdout := bm.newOutputBuffer()
+	stderr := bm.newOutputBuffer()
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	started := time.Now()
+	if err := cmd.Start(); err != nil {
+		return CommandResult{}, fmt.Errorf("failed to start bash: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Started one-shot bash process (PID: %d)\n", cmd.Process.Pid)
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	var waitErr error
+	select {
+	case waitErr = <-done:
+	case <-ctx.Done():
+		killProcessGroup(cmd)
+		<-done
+		return CommandResult{}, fmt.Errorf("one-shot command timed out after %v", timeout)
+	}
+
+	result, err := processResult(stdout, stderr, waitErr, bm.outputs)
+	if err != nil {
+		return CommandResult{}, fmt.Errorf("one-shot command failed: %w", err)
+	}
+	result.Duration = time.Since(started)
+	fmt.Fprintf(os.Stderr, "One-shot command finished in %v (exit code %d)\n", result.Duration.Round(time.Millisecond),
+		result.ExitCode)
+	if len(skipped) > 0 && bm.nested.Sockets != nil {
+		result.Warnings = []string{nestedSocketWarning(skipped)}
+	}
+	return result, nil
+}
+
+// processResult formats the output of a finished child process the way
+// session results are formatted: stdout, an exit code line when non-zero,
+// then stderr, with invalid UTF-8 replaced.
+func processResult(stdout, stderr *cappedBuffer, waitErr error, store *outputStore) (CommandResult, error) {
+	var stored []OutputRef
+	stored = addOutputRef(stored, "stdout", stdout, store)
+	stored = addOutputRef(stored, "stderr", stderr, store)
+
+	output := strings.TrimRight(stdout.String(), "\n")
+
+	exitCode := 0
+	var exitErr *exec.ExitError
+	if errors.As(waitErr, &exitErr) {
+		exitCode = exitErr.ExitCode()
+		output += fmt.Sprintf("\n[Exit code: %d]", exitCode)
+	} else if waitErr != nil {
+		return CommandResult{}, waitErr
+	}
+
+	stderrOutput := stderr.String()
+	if stderrOutput != "" {
+		output = output + "\n\nSTDERR:\n" + stderrOutput
+	}
+	output = strings.ToValidUTF8(output, "\uFFFD")
+	return CommandResult{Output: output, ExitCode: exitCode, StoredOutputs: stored, Stderr: stderrOutput}, nil
+}
+
+// BypassTimeout returns the timeout applied to bypassSession commands
+func (bm *BashManager) BypassTimeout() time.Duration {
+	return bm.bypassTimeout
+}
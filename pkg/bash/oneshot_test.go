@@ -0,0 +1,57 @@
+package bash
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecuteOneShotLeavesSessionAlone(t *testing.T) {
+	bm := newTestManager(t, Options{})
+
+	run(t, bm, "cd /tmp && export SESSION_ONLY=yes")
+	result, err := bm.ExecuteOneShot(`echo "[$SESSION_ONLY]"; cd /; exit 4`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(result.Output, "[]") || result.ExitCode != 4 {
+		t.Errorf("result = %q, exit %d; want no session variables and exit 4", result.Output, result.ExitCode)
+	}
+	if result := run(t, bm, "pwd"); result.Output != "/tmp" {
+		t.Errorf("session directory = %q, want /tmp", result.Output)
+	}
+}
+
+func TestExecuteOneShotWhileSessionBusy(t *testing.T) {
+	bm := newTestManager(t, Options{})
+	run(t, bm, "true")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		bm.ExecuteCommand("sleep 2")
+	}()
+	time.Sleep(200 * time.Millisecond)
+
+	started := time.Now()
+	result, err := bm.ExecuteOneShot("echo alive")
+	if err != nil || result.Output != "alive" {
+		t.Errorf("one-shot = %q, %v; want alive", result.Output, err)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("one-shot waited %v for the busy session", elapsed)
+	}
+	<-done
+}
+
+func TestExecuteOneShotTimeout(t *testing.T) {
+	bm := newTestManager(t, Options{BypassTimeout: 200 * time.Millisecond})
+
+	started := time.Now()
+	if _, err := bm.ExecuteOneShot("sleep 30"); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("err = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("timed out command took %v to stop", elapsed)
+	}
+}
@@ -0,0 +1,134 @@
+package bash
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/events"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/truncate"
+)
+
+// sessionMarkerVar is exported to each session's shell with a value unique
+// to the session. The processes it starts inherit it, so they can still be
+// found once they have left the session's process tree, as daemons do.
+const sessionMarkerVar = "MCP_BASH_SESSION"
+
+// maxOrphanReports is how many closed sessions' orphans bash_sessions lists
+const maxOrphanReports = 20
+
+// orphanGrace is how long processes killed with their session get to die
+// before those still running count as orphans
+const orphanGrace = 100 * time.Millisecond
+
+// maxOrphanCommand caps the command line reported for an orphan
+const maxOrphanCommand = 200
+
+// Orphan is a process a closed session left running
+type Orphan struct {
+	PID     int    `json:"pid"`
+	Command string `json:"command"`
+	Killed  bool   `json:"killed"` // by killOrphansOnClose
+}
+
+// OrphanReport lists the processes a session left running when it closed
+type OrphanReport struct {
+	Session  int       `json:"session"`
+	PID      int       `json:"pid"` // the session's shell
+	ClosedAt time.Time `json:"closedAt"`
+	Orphans  []Orphan  `json:"orphans"`
+}
+
+// sessionProcess is a process found for a session. The start time tells it
+// apart from a later process given the same PID.
+type sessionProcess struct {
+	pid   int
+	start uint64 // clock ticks after boot
+}
+
+// newSessionMarker returns a value for sessionMarkerVar no other session,
+// in this server or another, has
+func newSessionMarker(id int) string {
+	return fmt.Sprintf("%d-%d-%d", os.Getpid(), id, time.Now().UnixNano())
+}
+
+// accountOrphans finds the processes still running once bash has exited:
+// those tracked before the kill that survived it, and any others carrying
+// the session's marker. They are killed if killOrphans is set, and passed to
+// onOrphans.
+func (bs *BashSession) accountOrphans(tracked []sessionProcess) {
+	<-bs.exited
+	survivors := survivingProcesses(tracked, bs.marker)
+	if len(survivors) > 0 {
+		// Some may only be dying from the kill
+		time.Sleep(orphanGrace)
+		survivors = survivingProcesses(survivors, "")
+	}
+	if len(survivors) == 0 || bs.onOrphans == nil {
+		return
+	}
+
+	orphans := make([]Orphan, 0, len(survivors))
+	for _, process := range survivors {
+		orphan := Orphan{PID: process.pid, Command: truncate.Head(processCommand(process.pid), maxOrphanCommand)}
+		if bs.killOrphans {
+			orphan.Killed = killSessionProcess(process) == nil
+		}
+		orphans = append(orphans, orphan)
+	}
+	bs.onOrphans(bs, orphans)
+}
+
+// reportOrphans logs the processes a closed session left running and
+// publishes them. They are kept for bash_sessions and reported with the next
+// command as a warning.
+func (bm *BashManager) reportOrphans(session *BashSession, orphans []Orphan) {
+	described := make([]string, len(orphans))
+	killed := 0
+	for i, orphan := range orphans {
+		described[i] = fmt.Sprintf("%d (%s)", orphan.PID, orphan.Command)
+		if orphan.Killed {
+			killed++
+		}
+	}
+	message := fmt.Sprintf("bash session %d left %d process(es) running when it closed: %s", session.id,
+		len(orphans), strings.Join(described, ", "))
+	if killed > 0 {
+		message += fmt.Sprintf("; %d killed", killed)
+	}
+	fmt.Fprintf(os.Stderr, "Warning: %s\n", message)
+	bm.events.Publish(events.SessionOrphans, message,
+		map[string]interface{}{"session": session.id, "orphans": orphans})
+
+	bm.orphanMutex.Lock()
+	defer bm.orphanMutex.Unlock()
+	bm.orphanReports = append(bm.orphanReports, OrphanReport{
+		Session:  session.id,
+		PID:      session.getPID(),
+		ClosedAt: time.Now(),
+		Orphans:  orphans,
+	})
+	if len(bm.orphanReports) > maxOrphanReports {
+		bm.orphanReports = bm.orphanReports[len(bm.orphanReports)-maxOrphanReports:]
+	}
+	bm.orphanWarnings = append(bm.orphanWarnings, "Warning: "+message)
+}
+
+// takeOrphanWarnings returns the orphan warnings not yet reported, and
+// forgets them
+func (bm *BashManager) takeOrphanWarnings() []string {
+	bm.orphanMutex.Lock()
+	defer bm.orphanMutex.Unlock()
+	warnings := bm.orphanWarnings
+	bm.orphanWarnings = nil
+	return warnings
+}
+
+// Orphans returns the most recent closed sessions that left processes
+// running, oldest first
+func (bm *BashManager) Orphans() []OrphanReport {
+	bm.orphanMutex.Lock()
+	defer bm.orphanMutex.Unlock()
+	return append([]OrphanReport{}, bm.orphanReports...)
+}
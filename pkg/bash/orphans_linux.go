@@ -0,0 +1,180 @@
+//go:build linux
+
+package bash
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// procStat is what orphan accounting reads from /proc/<pid>/stat
+type procStat struct {
+	parent int
+	group  int
+	state  byte
+	start  uint64 // clock ticks after boot
+}
+
+// readProcStat reads a process's parent, process group, state and start time
+func readProcStat(pid int) (procStat, error) {
+	stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return procStat{}, err
+	}
+	// The command name is parenthesised and may itself contain spaces or
+	// parentheses, so the fields start after the last ')': state is the
+	// first of them, the parent the second, the process group the third
+	// and the start time the 20th
+	fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+	if len(fields) < 20 {
+		return procStat{}, fmt.Errorf("short /proc/%d/stat", pid)
+	}
+	parent, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return procStat{}, err
+	}
+	group, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return procStat{}, err
+	}
+	start, err := strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return procStat{}, err
+	}
+	return procStat{parent: parent, group: group, state: fields[0][0], start: start}, nil
+}
+
+// living reports whether a process has not yet exited: zombies and dead
+// processes are only waiting to be reaped
+func (s procStat) living() bool {
+	return s.state != 'Z' && s.state != 'X'
+}
+
+// processStart returns when a living process started, in clock ticks after
+// boot, which tells it from a later process given the same PID
+func processStart(pid int) (uint64, error) {
+	stat, err := readProcStat(pid)
+	if err != nil {
+		return 0, err
+	}
+	if !stat.living() {
+		return 0, fmt.Errorf("process %d has exited", pid)
+	}
+	return stat.start, nil
+}
+
+// hasMarker reports whether a process's environment holds the session
+// marker. Processes that can't be read, such as other users', don't.
+func hasMarker(pid int, marker string) bool {
+	environ, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/environ")
+	if err != nil {
+		return false
+	}
+	want := []byte(sessionMarkerVar + "=" + marker)
+	for _, entry := range bytes.Split(environ, []byte{0}) {
+		if bytes.Equal(entry, want) {
+			return true
+		}
+	}
+	return false
+}
+
+// livingProcesses returns the stat of every living process but this one
+func livingProcesses() map[int]procStat {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+	processes := make(map[int]procStat)
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+		if stat, err := readProcStat(pid); err == nil && stat.living() {
+			processes[pid] = stat
+		}
+	}
+	return processes
+}
+
+// sessionProcesses returns the descendants of a session's shell and every
+// other process carrying its marker, from one walk of /proc
+func sessionProcesses(pid int, marker string) []sessionProcess {
+	processes := livingProcesses()
+	children := make(map[int][]int)
+	for child, stat := range processes {
+		children[stat.parent] = append(children[stat.parent], child)
+	}
+
+	found := make(map[int]bool)
+	var tracked []sessionProcess
+	queue := append([]int(nil), children[pid]...)
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		if !found[p] {
+			found[p] = true
+			tracked = append(tracked, sessionProcess{pid: p, start: processes[p].start})
+			queue = append(queue, children[p]...)
+		}
+	}
+	for p, stat := range processes {
+		if !found[p] && p != pid && hasMarker(p, marker) {
+			tracked = append(tracked, sessionProcess{pid: p, start: stat.start})
+		}
+	}
+	return tracked
+}
+
+// survivingProcesses returns those of tracked still running, each the same
+// process as when tracked, and any other process carrying marker unless it
+// is ""
+func survivingProcesses(tracked []sessionProcess, marker string) []sessionProcess {
+	processes := livingProcesses()
+	found := make(map[int]bool)
+	var survivors []sessionProcess
+	for _, process := range tracked {
+		if stat, ok := processes[process.pid]; ok && stat.start == process.start {
+			found[process.pid] = true
+			survivors = append(survivors, process)
+		}
+	}
+	if marker == "" {
+		return survivors
+	}
+	for p, stat := range processes {
+		if !found[p] && hasMarker(p, marker) {
+			survivors = append(survivors, sessionProcess{pid: p, start: stat.start})
+		}
+	}
+	return survivors
+}
+
+// processCommand returns a process's command line, or its name if it has
+// none (a kernel thread, or a zombie)
+func processCommand(pid int) string {
+	cmdline, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/cmdline")
+	if err == nil && len(cmdline) > 0 {
+		return strings.TrimSpace(string(bytes.ReplaceAll(cmdline, []byte{0}, []byte{' '})))
+	}
+	comm, _ := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/comm")
+	return strings.TrimSpace(string(comm))
+}
+
+// killSessionProcess sends a process SIGKILL, unless its PID now belongs to
+// another process
+func killSessionProcess(process sessionProcess) error {
+	stat, err := readProcStat(process.pid)
+	if err != nil {
+		return err
+	}
+	if stat.start != process.start {
+		return fmt.Errorf("process %d has exited", process.pid)
+	}
+	return syscall.Kill(process.pid, syscall.SIGKILL)
+}
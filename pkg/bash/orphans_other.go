@@ -0,0 +1,31 @@
+//go:build !linux
+
+package bash
+
+import "errors"
+
+// sessionProcesses finds nothing without /proc; orphans go unreported
+func sessionProcesses(pid int, marker string) []sessionProcess {
+	return nil
+}
+
+// survivingProcesses finds nothing without /proc
+func survivingProcesses(tracked []sessionProcess, marker string) []sessionProcess {
+	return nil
+}
+
+// processCommand is unknown without /proc
+func processCommand(pid int) string {
+	return ""
+}
+
+// killSessionProcess is unsupported without /proc
+func killSessionProcess(process sessionProcess) error {
+	return errors.New("cannot find processes on this platform")
+}
+
+// processStart is unknown without /proc, so background jobs can't be taken
+// back after a restart
+func processStart(pid int) (uint64, error) {
+	return 0, errors.New("cannot find processes on this platform")
+}
@@ -0,0 +1,447 @@
+package bash
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/perms"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/truncate"
+)
+
+const (
+	// DefaultStoredOutputSize is how much of a truncated command's output is
+	// kept for bash_output when no size is configured.
+	DefaultStoredOutputSize = 10 * 1024 * 1024 // 10MB
+
+	// DefaultStoredOutputTTL is how long stored output is kept when no TTL
+	// is configured.
+	DefaultStoredOutputTTL = 10 * time.Minute
+
+	// MaxStoredOutputs caps how many outputs are stored at once in memory;
+	// the oldest is dropped to make room. Outputs stored on disk are capped
+	// by their total size instead.
+	MaxStoredOutputs = 16
+
+	// DefaultOutputResourceBytes is how much stored output is kept on disk
+	// in all, when output resources are enabled with no limit configured
+	DefaultOutputResourceBytes = 256 * 1024 * 1024 // 256MB
+
+	// OutputURIScheme is the scheme of the URIs stored output is served
+	// under as MCP resources
+	OutputURIScheme = "bash-output://"
+
+	// outputExpiryInterval is how often expired output is removed from disk
+	outputExpiryInterval = time.Minute
+)
+
+// ErrUnknownOutput is returned for an output ID or URI that isn't stored
+var ErrUnknownOutput = errors.New("unknown output")
+
+// storedOutput is the full output of one truncated command, held in memory
+// or, for a store on disk, in a temp file
+type storedOutput struct {
+	data    []byte
+	path    string // the file holding it, for a store on disk
+	size    int    // bytes stored
+	stream  string // "stdout" or "stderr"
+	total   int    // bytes the command wrote; more than size if the store cap was hit
+	created time.Time
+}
+
+// load returns the stored output
+func (e *storedOutput) load() ([]byte, error) {
+	if e.path == "" {
+		return e.data, nil
+	}
+	data, err := os.ReadFile(e.path)
+	if errors.Is(err, os.ErrNotExist) {
+		// Expired or evicted since it was looked up
+		return nil, ErrUnknownOutput
+	}
+	return data, err
+}
+
+// outputStore keeps the full output of truncated commands so bash_output can
+// page through it. Entries expire after ttl and are dropped when the session
+// restarts. A nil store keeps nothing.
+//
+// A store on disk keeps each output in a private temp file rather than in
+// memory, up to maxDisk bytes in all, and the outputs are also served as MCP
+// resources at OutputURIScheme URIs.
+type outputStore struct {
+	mutex   sync.Mutex
+	entries map[string]*storedOutput
+	ttl     time.Duration
+
+	onDisk   bool
+	maxDisk  int64
+	diskUsed int64
+}
+
+func newOutputStore(ttl time.Duration) *outputStore {
+	return &outputStore{entries: make(map[string]*storedOutput), ttl: ttl}
+}
+
+// newDiskOutputStore returns a store keeping outputs in temp files, up to
+// maxBytes in all
+func newDiskOutputStore(ttl time.Duration, maxBytes int64) *outputStore {
+	s := newOutputStore(ttl)
+	s.onDisk = true
+	s.maxDisk = maxBytes
+	return s
+}
+
+// put stores data, the start of what stream wrote, and returns its output
+// ID, or "" if it couldn't be stored
+func (s *outputStore) put(data []byte, total int, stream string) string {
+	if s == nil {
+		return ""
+	}
+	var raw [8]byte
+	if _, err := rand.Read(raw[:]); err != nil {
+		return ""
+	}
+	id := hex.EncodeToString(raw[:])
+	entry := &storedOutput{size: len(data), stream: stream, total: total, created: time.Now()}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.expire()
+	if !s.onDisk {
+		for len(s.entries) >= MaxStoredOutputs {
+			s.dropOldest()
+		}
+		entry.data = data
+		s.entries[id] = entry
+		return id
+	}
+
+	if int64(len(data)) > s.maxDisk {
+		log.Printf("Not storing %d bytes of output: more than the %d bytes allowed on disk", len(data), s.maxDisk)
+		return ""
+	}
+	for len(s.entries) > 0 && s.diskUsed+int64(len(data)) > s.maxDisk {
+		s.dropOldest()
+	}
+	path, err := writeOutputFile(data)
+	if err != nil {
+		log.Printf("Failed to store output on disk: %v", err)
+		return ""
+	}
+	entry.path = path
+	s.diskUsed += int64(len(data))
+	s.entries[id] = entry
+	return id
+}
+
+// writeOutputFile writes output to a new private temp file, returning its
+// path
+func writeOutputFile(data []byte) (string, error) {
+	file, err := perms.CreateTemp("", "mcp-bash-output-*")
+	if err != nil {
+		return "", err
+	}
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// get looks up an unexpired entry
+func (s *outputStore) get(id string) (*storedOutput, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.expire()
+	entry, ok := s.entries[id]
+	return entry, ok
+}
+
+// remove drops an entry and its file. Caller must hold mutex.
+func (s *outputStore) remove(id string) {
+	entry, ok := s.entries[id]
+	if !ok {
+		return
+	}
+	delete(s.entries, id)
+	if entry.path != "" {
+		if err := os.Remove(entry.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Failed to remove stored output %s: %v", entry.path, err)
+		}
+		s.diskUsed -= int64(entry.size)
+	}
+}
+
+// expire drops entries older than the TTL. Caller must hold mutex.
+func (s *outputStore) expire() {
+	for id, entry := range s.entries {
+		if time.Since(entry.created) > s.ttl {
+			s.remove(id)
+		}
+	}
+}
+
+// dropOldest drops the oldest entry. Caller must hold mutex.
+func (s *outputStore) dropOldest() {
+	var oldestID string
+	var oldest time.Time
+	for id, entry := range s.entries {
+		if oldestID == "" || entry.created.Before(oldest) {
+			oldestID, oldest = id, entry.created
+		}
+	}
+	s.remove(oldestID)
+}
+
+// clear drops every stored output
+func (s *outputStore) clear() {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for id := range s.entries {
+		s.remove(id)
+	}
+}
+
+// expireOutputs removes expired output from disk every
+// outputExpiryInterval, rather than only when the store is next used, until
+// the manager is closed
+func (bm *BashManager) expireOutputs() {
+	ticker := time.NewTicker(outputExpiryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-bm.stopReaper:
+			return
+		case <-ticker.C:
+			bm.outputs.mutex.Lock()
+			bm.outputs.expire()
+			bm.outputs.mutex.Unlock()
+		}
+	}
+}
+
+// OutputRef points a truncated result at its stored output
+type OutputRef struct {
+	Stream     string `json:"stream"` // "stdout" or "stderr"
+	OutputID   string `json:"outputId"`
+	TotalBytes int    `json:"totalBytes"`
+	// StoredBytes is how much of it was kept, and URI the resource it can be
+	// read from, for output stored on disk
+	StoredBytes int    `json:"storedBytes,omitempty"`
+	URI         string `json:"uri,omitempty"`
+}
+
+// addOutputRef stores buf's output in store if it was truncated and appends
+// a reference to it
+func addOutputRef(refs []OutputRef, stream string, buf *cappedBuffer, store *outputStore) []OutputRef {
+	if id := buf.store(store, stream); id != "" {
+		ref := OutputRef{Stream: stream, OutputID: id, TotalBytes: buf.total}
+		if store.onDisk {
+			ref.StoredBytes = min(buf.total, buf.keep)
+			ref.URI = OutputURI(id)
+		}
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+// OutputURI returns the resource URI of a stored output
+func OutputURI(id string) string {
+	return OutputURIScheme + id
+}
+
+// newOutputBuffer returns a buffer for one output stream of a command, with
+// the manager's size limit, truncation mode and storage
+func (bm *BashManager) newOutputBuffer() *cappedBuffer {
+	return newCappedBuffer(bm.maxOutput, bm.truncation).retain(bm.keepOutput)
+}
+
+// OutputPage is a slice of stored output returned by bash_output
+type OutputPage struct {
+	OutputID    string
+	Offset      int
+	Text        string
+	Bytes       int
+	StoredBytes int
+	TotalBytes  int  // as written by the command
+	NextOffset  *int // nil once the end is reached
+	Incomplete  bool // the store cap was hit, so the end is missing
+}
+
+// ReadOutput returns up to limit bytes of a stored output from offset. Both
+// ends of the slice are moved back to character boundaries. limit <= 0
+// or above the output size limit means a page of that limit.
+func (bm *BashManager) ReadOutput(id string, offset, limit int) (OutputPage, error) {
+	if bm.outputs == nil {
+		return OutputPage{}, fmt.Errorf("output storage is disabled")
+	}
+	entry, ok := bm.outputs.get(id)
+	var data []byte
+	var err error
+	if ok {
+		data, err = entry.load()
+	}
+	if !ok || errors.Is(err, ErrUnknownOutput) {
+		return OutputPage{}, fmt.Errorf("unknown output_id %q (stored output expires after %v and is "+
+			"dropped when the session restarts)", id, bm.outputs.ttl)
+	}
+	if err != nil {
+		return OutputPage{}, fmt.Errorf("failed to read stored output: %w", err)
+	}
+
+	if offset < 0 || offset > len(data) {
+		return OutputPage{}, fmt.Errorf("offset %d is outside the stored output (0-%d)", offset, len(data))
+	}
+	if limit <= 0 || limit > bm.maxOutput {
+		limit = bm.maxOutput
+	}
+
+	// Move both ends back to the start of a character
+	for offset > 0 && offset < len(data) && !utf8.RuneStart(data[offset]) {
+		offset--
+	}
+	end := offset + len(truncate.Head(data[offset:], limit))
+	if end == offset {
+		// A character with more combining marks than fit in a page is split
+		// between them rather than never returned
+		end = min(offset+limit, len(data))
+		for end > offset && end < len(data) && !utf8.RuneStart(data[end]) {
+			end--
+		}
+	}
+
+	page := OutputPage{
+		OutputID:    id,
+		Offset:      offset,
+		Text:        string(data[offset:end]),
+		Bytes:       end - offset,
+		StoredBytes: len(data),
+		TotalBytes:  entry.total,
+		Incomplete:  entry.total > len(data),
+	}
+	if end < len(data) {
+		page.NextOffset = &end
+	}
+	return page, nil
+}
+
+// OutputResource is a stored output served as an MCP resource
+type OutputResource struct {
+	OutputID    string
+	URI         string
+	Stream      string // "stdout" or "stderr"
+	StoredBytes int
+	TotalBytes  int // as written by the command
+	Created     time.Time
+}
+
+// OutputResources lists the outputs stored on disk, oldest first, or none
+// if output isn't stored on disk
+func (bm *BashManager) OutputResources() []OutputResource {
+	if bm.outputs == nil || !bm.outputs.onDisk {
+		return nil
+	}
+	bm.outputs.mutex.Lock()
+	defer bm.outputs.mutex.Unlock()
+	bm.outputs.expire()
+	resources := make([]OutputResource, 0, len(bm.outputs.entries))
+	for id, entry := range bm.outputs.entries {
+		resources = append(resources, OutputResource{
+			OutputID:    id,
+			URI:         OutputURI(id),
+			Stream:      entry.stream,
+			StoredBytes: entry.size,
+			TotalBytes:  entry.total,
+			Created:     entry.created,
+		})
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].Created.Before(resources[j].Created)
+	})
+	return resources
+}
+
+// ReadOutputResource returns the whole of an output stored on disk by its
+// URI, or an error wrapping ErrUnknownOutput if there is none
+func (bm *BashManager) ReadOutputResource(uri string) ([]byte, error) {
+	id, ok := strings.CutPrefix(uri, OutputURIScheme)
+	if !ok || bm.outputs == nil || !bm.outputs.onDisk {
+		return nil, fmt.Errorf("%w %s", ErrUnknownOutput, uri)
+	}
+	entry, ok := bm.outputs.get(id)
+	var data []byte
+	var err error
+	if ok {
+		data, err = entry.load()
+	}
+	if !ok || errors.Is(err, ErrUnknownOutput) {
+		return nil, fmt.Errorf("%w %s (stored output expires after %v and is dropped when the session "+
+			"restarts)", ErrUnknownOutput, uri, bm.outputs.ttl)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stored output: %w", err)
+	}
+	return data, nil
+}
+
+// OutputToolSchema defines the schema for bash_output input
+var OutputToolSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"output_id": map[string]interface{}{
+			"type":        "string",
+			"description": "ID from a truncated command result",
+		},
+		"offset": map[string]interface{}{
+			"type":        "integer",
+			"description": "Byte offset to start from (default 0)",
+		},
+		"limit": map[string]interface{}{
+			"type":        "integer",
+			"description": "Maximum bytes to return (default and maximum: the server's output size limit)",
+		},
+	},
+	"required": []string{"output_id"},
+}
+
+// ParseOutputArgs parses arguments for the bash_output tool
+func ParseOutputArgs(args json.RawMessage) (id string, offset, limit int, err error) {
+	var params struct {
+		OutputID string `json:"output_id"`
+		Offset   int    `json:"offset"`
+		Limit    int    `json:"limit"`
+	}
+
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", 0, 0, fmt.Errorf("invalid arguments for bash_output tool: %w", err)
+	}
+
+	if params.OutputID == "" {
+		return "", 0, 0, fmt.Errorf("output_id parameter is required")
+	}
+	if params.Offset < 0 {
+		return "", 0, 0, fmt.Errorf("offset must not be negative")
+	}
+	if params.Limit < 0 {
+		return "", 0, 0, fmt.Errorf("limit must not be negative")
+	}
+
+	return params.OutputID, params.Offset, params.Limit, nil
+}
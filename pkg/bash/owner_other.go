@@ -0,0 +1,8 @@
+//go:build !unix
+
+package bash
+
+import "os"
+
+// preserveOwnership is a no-op on platforms without Unix file ownership.
+func preserveOwnership(path string, original os.FileInfo) {}
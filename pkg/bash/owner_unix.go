@@ -0,0 +1,16 @@
+//go:build unix
+
+package bash
+
+import (
+	"os"
+	"syscall"
+)
+
+// preserveOwnership copies the uid/gid of original onto path. Failures are
+// ignored: unprivileged users can only keep ownership they already have.
+func preserveOwnership(path string, original os.FileInfo) {
+	if stat, ok := original.Sys().(*syscall.Stat_t); ok {
+		os.Chown(path, int(stat.Uid), int(stat.Gid))
+	}
+}
@@ -0,0 +1,104 @@
+package bash
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultPathWarnLength is the $PATH length past which commands are warned
+// about it, when no limit is configured
+const DefaultPathWarnLength = 4096
+
+// pathDedupTimeout bounds each command of a PATH deduplication
+const pathDedupTimeout = 5 * time.Second
+
+// checkPath warns when a command has left the session's $PATH longer than
+// the limit, typically from export PATH=$PATH:... run again and again, and
+// again each time it grows further. With dedupPath set, repeated entries are
+// removed from it first, in the session while no command runs, and a note
+// says so. Caller must hold sessionMutex, between commands.
+func (bm *BashManager) checkPath(session *BashSession, length int) []string {
+	if bm.pathWarnLength <= 0 || length <= bm.pathWarnLength {
+		return nil
+	}
+
+	var notes []string
+	if bm.dedupPath {
+		after, err := session.dedupPath()
+		switch {
+		case err != nil:
+			notes = append(notes, fmt.Sprintf("Warning: failed to remove duplicate PATH entries: %v", err))
+		case after < length:
+			notes = append(notes, fmt.Sprintf("Note: PATH had grown to %d characters, so its duplicate entries "+
+				"were removed (dedupPath), keeping the first of each; it is now %d characters", length, after))
+			length = after
+		}
+		if length <= bm.pathWarnLength {
+			return notes
+		}
+	}
+
+	if length <= session.pathWarned {
+		return notes
+	}
+	session.pathWarned = length
+	warning := fmt.Sprintf("Warning: PATH is %d characters long, over the limit of %d. Appending to it on every "+
+		"command (export PATH=$PATH:...) grows it without bound, and tools fail once the environment gets too "+
+		"large.", length, bm.pathWarnLength)
+	if !bm.dedupPath {
+		warning += " Set dedupPath to have duplicate entries removed."
+	}
+	return append(notes, warning)
+}
+
+// dedupPath removes repeated entries from the session's $PATH, keeping the
+// first of each, and returns its length after. It runs its own commands in
+// the session, so caller must hold sessionMutex, between commands.
+func (bs *BashSession) dedupPath() (int, error) {
+	// Not client commands: don't let them count as use
+	lastCommand, lastUsed := bs.lastCommand.Load(), bs.lastUsed.Load()
+	defer func() {
+		bs.lastCommand.Store(lastCommand)
+		bs.lastUsed.Store(lastUsed)
+	}()
+
+	run := func(command string) (CommandResult, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), pathDedupTimeout)
+		defer cancel()
+		result, err := bs.execute(command, ctx, executeLimits{total: pathDedupTimeout})
+		if err == nil && (result.ExitCode != 0 || result.Stderr != "") {
+			err = fmt.Errorf("%s failed: %s", command, strings.TrimSpace(result.Output))
+		}
+		return result, err
+	}
+
+	result, err := run(`printf '%s\n' "$PATH"`)
+	if err != nil {
+		return 0, err
+	}
+	path := result.Output
+	unique := dedupPathList(path)
+	if unique == path {
+		return len(path), nil
+	}
+	if _, err := run("PATH=" + shellQuote(unique)); err != nil {
+		return 0, err
+	}
+	return len(unique), nil
+}
+
+// dedupPathList removes repeated entries from a colon-separated list,
+// keeping the first of each in place
+func dedupPathList(path string) string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, entry := range strings.Split(path, ":") {
+		if !seen[entry] {
+			seen[entry] = true
+			unique = append(unique, entry)
+		}
+	}
+	return strings.Join(unique, ":")
+}
@@ -0,0 +1,273 @@
+package bash
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/perms"
+)
+
+// pipelineTimingFD is the descriptor a profiled stage's own stderr is moved
+// to while its timing report goes to the timing file. Commands using it
+// themselves aren't profiled.
+const pipelineTimingFD = "9"
+
+// reservedWords can't start a stage: they begin compound commands, or are
+// keywords whose meaning would change inside the timing wrapper
+var reservedWords = map[string]bool{
+	"!": true, "[[": true, "{": true, "}": true, "case": true, "coproc": true, "do": true, "done": true,
+	"elif": true, "else": true, "esac": true, "fi": true, "for": true, "function": true, "if": true,
+	"in": true, "select": true, "then": true, "time": true, "until": true, "while": true,
+}
+
+// StageTiming is how long one stage of a profiled pipeline took. User and
+// system time include the processes the stage started.
+type StageTiming struct {
+	Stage   int    `json:"stage"` // 1-based position in the pipeline
+	Command string `json:"command"`
+	RealMs  int64  `json:"realMs"`
+	UserMs  int64  `json:"userMs"`
+	SysMs   int64  `json:"sysMs"`
+}
+
+// PipelineProfile collects the stage timings of a pipeline wrapped by
+// WithPipelineProfile
+type PipelineProfile struct {
+	path   string
+	stages []string
+}
+
+// WithPipelineProfile rewrites a simple pipeline so each stage reports its
+// real, user and system time, using bash's time keyword and TIMEFORMAT, to a
+// private temp file. Each stage runs in a subshell, as stages of a pipeline
+// normally do, and its output and exit status are unchanged. Commands the
+// conservative grammar of splitPipeline can't take apart safely are refused
+// with the reason; run them unprofiled. Close the profile once its timings
+// have been read.
+func (bm *BashManager) WithPipelineProfile(command string) (string, *PipelineProfile, error) {
+	stages, err := splitPipeline(command)
+	if err != nil {
+		return "", nil, err
+	}
+
+	file, err := perms.CreateTemp("", "mcp-bash-timing-*")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create timing file: %w", err)
+	}
+	path := file.Name()
+	if err := file.Close(); err != nil {
+		os.Remove(path)
+		return "", nil, fmt.Errorf("failed to create timing file: %w", err)
+	}
+	if err := bm.giveToSession(path); err != nil {
+		os.Remove(path)
+		return "", nil, err
+	}
+
+	// time reports to the stderr of the shell running it, which is the
+	// timing file; the stage's own stderr goes back where it was
+	wrapped := make([]string, len(stages))
+	for i, stage := range stages {
+		wrapped[i] = fmt.Sprintf("( TIMEFORMAT='stage %d %%3R %%3U %%3S'; time { %s\n} 2>&%s %s>&- ) %s>&2 2>>%s",
+			i+1, stage, pipelineTimingFD, pipelineTimingFD, pipelineTimingFD, shellQuote(path))
+	}
+	return strings.Join(wrapped, " | "), &PipelineProfile{path: path, stages: stages}, nil
+}
+
+// Stages returns the number of stages in the pipeline
+func (p *PipelineProfile) Stages() int {
+	return len(p.stages)
+}
+
+// Timings returns the timings of the stages that reported, in pipeline
+// order. A stage killed before it finished doesn't report.
+func (p *PipelineProfile) Timings() ([]StageTiming, error) {
+	file, err := os.Open(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open timing file: %w", err)
+	}
+	defer file.Close()
+
+	timings := make([]*StageTiming, len(p.stages))
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 5 || fields[0] != "stage" {
+			continue
+		}
+		stage, err := strconv.Atoi(fields[1])
+		if err != nil || stage < 1 || stage > len(p.stages) {
+			continue
+		}
+		timing := &StageTiming{Stage: stage, Command: p.stages[stage-1]}
+		durations := []*int64{&timing.RealMs, &timing.UserMs, &timing.SysMs}
+		for i, field := range fields[2:] {
+			// The decimal separator follows the session's locale
+			seconds, err := strconv.ParseFloat(strings.Replace(field, ",", ".", 1), 64)
+			if err != nil {
+				return nil, fmt.Errorf("unexpected timing line %q", scanner.Text())
+			}
+			*durations[i] = int64(seconds*1000 + 0.5)
+		}
+		timings[stage-1] = timing
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read timing file: %w", err)
+	}
+
+	reported := []StageTiming{}
+	for _, timing := range timings {
+		if timing != nil {
+			reported = append(reported, *timing)
+		}
+	}
+	return reported, nil
+}
+
+// Close removes the timing file
+func (p *PipelineProfile) Close() {
+	os.Remove(p.path)
+}
+
+// splitPipeline splits a simple pipeline into its stages, or explains why it
+// won't. The grammar is deliberately small: commands with words, quotes,
+// variable expansions and plain redirections, joined by |. Anything that
+// could hide a second command or change how stages are grouped (lists,
+// &&, ||, |&, background jobs, subshells, groups, command or process
+// substitution, here-documents, comments, compound commands, line breaks) is
+// refused rather than parsed, since a wrong split would change what runs.
+func splitPipeline(command string) ([]string, error) {
+	var stages []string
+	var stage strings.Builder
+	// wordStart is whether the next character begins a word
+	wordStart := true
+
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		next := byte(0)
+		if i+1 < len(command) {
+			next = command[i+1]
+		}
+
+		switch c {
+		case '\\':
+			if next == 0 || next == '\n' {
+				return nil, fmt.Errorf("line continuations are not supported")
+			}
+			stage.WriteByte(c)
+			stage.WriteByte(next)
+			i++
+		case '\'':
+			end := strings.IndexByte(command[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated single quote")
+			}
+			stage.WriteString(command[i : i+end+2])
+			i += end + 1
+		case '"':
+			end, err := doubleQuoteEnd(command, i)
+			if err != nil {
+				return nil, err
+			}
+			stage.WriteString(command[i : end+1])
+			i = end
+		case '$':
+			switch next {
+			case '(':
+				return nil, fmt.Errorf("command substitution and arithmetic $(( )) are not supported")
+			case '\'':
+				return nil, fmt.Errorf("$'...' quoting is not supported")
+			case '{':
+				end := strings.IndexByte(command[i:], '}')
+				if end < 0 {
+					return nil, fmt.Errorf("unterminated ${")
+				}
+				if strings.ContainsAny(command[i+2:i+end], "$`'\"(\\") {
+					return nil, fmt.Errorf("nested expansions in ${...} are not supported")
+				}
+				stage.WriteString(command[i : i+end+1])
+				i += end
+			default:
+				stage.WriteByte(c)
+			}
+		case '|':
+			if next == '|' {
+				return nil, fmt.Errorf("|| lists are not supported")
+			}
+			if next == '&' {
+				return nil, fmt.Errorf("|& is not supported")
+			}
+			stages = append(stages, stage.String())
+			stage.Reset()
+		case '&':
+			// Only as part of a redirection: >&, <&, &> and &>>
+			prev := byte(0)
+			if i > 0 {
+				prev = command[i-1]
+			}
+			if prev != '>' && prev != '<' && next != '>' {
+				return nil, fmt.Errorf("&& lists and background jobs are not supported")
+			}
+			stage.WriteByte(c)
+		case '<', '>':
+			if next == '(' {
+				return nil, fmt.Errorf("process substitution is not supported")
+			}
+			if c == '<' && next == '<' {
+				return nil, fmt.Errorf("here-documents and here-strings are not supported")
+			}
+			stage.WriteByte(c)
+		case ';', '(', ')', '{', '}', '`', '\n':
+			return nil, fmt.Errorf("%q is not supported; only simple commands joined by | can be profiled", c)
+		case '#':
+			if wordStart {
+				return nil, fmt.Errorf("comments are not supported")
+			}
+			stage.WriteByte(c)
+		default:
+			stage.WriteByte(c)
+		}
+		wordStart = c == ' ' || c == '\t' || c == '|'
+	}
+	stages = append(stages, stage.String())
+
+	for i, s := range stages {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return nil, fmt.Errorf("stage %d is empty", i+1)
+		}
+		if first := strings.Fields(s)[0]; reservedWords[first] {
+			return nil, fmt.Errorf("stage %d starts with %q; compound commands are not supported", i+1, first)
+		}
+		if strings.Contains(s, pipelineTimingFD+">") || strings.Contains(s, pipelineTimingFD+"<") ||
+			strings.Contains(s, "&"+pipelineTimingFD) {
+			return nil, fmt.Errorf("stage %d may use file descriptor %s, which profiling needs", i+1,
+				pipelineTimingFD)
+		}
+		stages[i] = s
+	}
+	return stages, nil
+}
+
+// doubleQuoteEnd returns the index of the quote closing the double-quoted
+// string starting at command[start], refusing substitutions inside it
+func doubleQuoteEnd(command string, start int) (int, error) {
+	for i := start + 1; i < len(command); i++ {
+		switch command[i] {
+		case '\\':
+			i++
+		case '`':
+			return 0, fmt.Errorf("command substitution is not supported")
+		case '$':
+			if i+1 < len(command) && command[i+1] == '(' {
+				return 0, fmt.Errorf("command substitution and arithmetic $(( )) are not supported")
+			}
+		case '"':
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unterminated double quote")
+}
@@ -0,0 +1,54 @@
+package bash
+
+// hostProbe runs a slow host check once in the background, so creating the
+// manager (and with it the initialize handshake) doesn't wait for it.
+// Callers that need the answer wait for it; others can ask whether it is
+// known yet.
+type hostProbe struct {
+	done chan struct{}
+	err  error
+}
+
+// startProbe runs check in the background
+func startProbe(check func() error) *hostProbe {
+	p := &hostProbe{done: make(chan struct{})}
+	go func() {
+		p.err = check()
+		close(p.done)
+	}()
+	return p
+}
+
+// wait blocks until the probe has finished and returns its result
+func (p *hostProbe) wait() error {
+	<-p.done
+	return p.err
+}
+
+// result returns the probe's result without blocking; known is false while
+// it is still running
+func (p *hostProbe) result() (known bool, err error) {
+	select {
+	case <-p.done:
+		return true, p.err
+	default:
+		return false, nil
+	}
+}
+
+// HostCapabilities reports the host capabilities found so far without
+// waiting, and the names of those still being probed.
+func (bm *BashManager) HostCapabilities() (capabilities map[string]bool, pending []string) {
+	capabilities = make(map[string]bool)
+	if known, err := bm.netIsolation.result(); known {
+		capabilities["networkIsolation"] = err == nil
+	} else {
+		pending = append(pending, "networkIsolation")
+	}
+	return capabilities, pending
+}
+
+// ProbesDone is closed once every host capability probe has finished
+func (bm *BashManager) ProbesDone() <-chan struct{} {
+	return bm.netIsolation.done
+}
@@ -0,0 +1,40 @@
+//go:build !unix
+
+package bash
+
+import (
+	"io"
+	"os/exec"
+)
+
+// setProcessGroup is a no-op on platforms without Unix process groups.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// setSession is a no-op on platforms without Unix sessions.
+func setSession(cmd *exec.Cmd) {}
+
+// terminateProcessGroup kills only the process itself on platforms without
+// Unix process groups or signals.
+func terminateProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return cmd.Process.Kill()
+}
+
+// killProcessGroup kills only the process itself on platforms without
+// Unix process groups.
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return cmd.Process.Kill()
+}
+
+// commandChannel returns cmd's stdin for the session to read its commands
+// from on platforms that can't pass it another file descriptor. There is no
+// script to run and nothing to close after start.
+func commandChannel(cmd *exec.Cmd) (io.WriteCloser, io.Closer, string, error) {
+	w, err := cmd.StdinPipe()
+	return w, nil, "", err
+}
@@ -0,0 +1,70 @@
+//go:build unix
+
+package bash
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// commandScript is the script path that makes a session read the pipe
+// commandChannel passes it
+const commandScript = "/dev/fd/3"
+
+// setProcessGroup starts cmd in its own process group so that the process
+// and everything it spawns can be signalled together.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// setSession starts cmd in a new session, detached from the server's
+// controlling terminal, and so in a process group of its own.
+func setSession(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setsid = true
+}
+
+// terminateProcessGroup sends SIGTERM to cmd's whole process group.
+func terminateProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+}
+
+// killProcessGroup sends SIGKILL to cmd's whole process group.
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// commandChannel connects a pipe to cmd as fd 3 for the session to read its
+// commands from (run as commandScript), leaving its stdin at /dev/null so a
+// command that reads stdin gets EOF rather than the commands queued after it.
+// It returns the pipe's write end, and the read end to close once cmd has
+// started. Call it after the credential is set: the read end is given to
+// that user, or the shell couldn't open it.
+func commandChannel(cmd *exec.Cmd) (io.WriteCloser, io.Closer, string, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if attr := cmd.SysProcAttr; attr != nil && attr.Credential != nil {
+		if err := r.Chown(int(attr.Credential.Uid), int(attr.Credential.Gid)); err != nil {
+			r.Close()
+			w.Close()
+			return nil, nil, "", err
+		}
+	}
+	cmd.ExtraFiles = append(cmd.ExtraFiles, r)
+	return w, r, commandScript, nil
+}
@@ -0,0 +1,47 @@
+package bash
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProgressInterval is how often accumulated output is passed to a
+// ProgressFunc while a command runs.
+const ProgressInterval = time.Second
+
+// ProgressFunc receives the output a command produced since the previous call
+type ProgressFunc func(chunk string)
+
+// progressBuffer collects output lines from the stdout reader until the
+// execute loop flushes them to the ProgressFunc. A nil buffer discards
+// everything, so callers needn't check whether progress was requested.
+type progressBuffer struct {
+	mutex   sync.Mutex
+	pending strings.Builder
+}
+
+// write appends text to the pending chunk
+func (pb *progressBuffer) write(text string) {
+	if pb == nil {
+		return
+	}
+	pb.mutex.Lock()
+	defer pb.mutex.Unlock()
+	pb.pending.WriteString(text)
+}
+
+// flush hands any pending text to fn
+func (pb *progressBuffer) flush(fn ProgressFunc) {
+	if pb == nil {
+		return
+	}
+	pb.mutex.Lock()
+	chunk := pb.pending.String()
+	pb.pending.Reset()
+	pb.mutex.Unlock()
+
+	if chunk != "" {
+		fn(chunk)
+	}
+}
@@ -0,0 +1,110 @@
+package bash
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultPTYRows and DefaultPTYCols are the window size of a pty
+	// command when none is configured
+	DefaultPTYRows = 24
+	DefaultPTYCols = 80
+
+	// ptyDrainGrace bounds how long output still queued in the terminal is
+	// read after the command finishes. A background process holding the
+	// terminal open would otherwise stall the result.
+	ptyDrainGrace = 500 * time.Millisecond
+)
+
+// PTYCapture holds the output of a command run on a pseudo-terminal: its
+// stdin, stdout and stderr, merged as a terminal would show them.
+type PTYCapture struct {
+	master *os.File
+	// slave is kept open by the server until Finish, so reading the
+	// master doesn't fail before the command has opened the terminal
+	slave  *os.File
+	output *cappedBuffer
+	store  *outputStore
+	done   chan struct{}
+	once   sync.Once
+}
+
+// WithPTY wraps command so it runs with a new pseudo-terminal as its stdin,
+// stdout and stderr, for tools that behave differently (or refuse to run)
+// without one. The group runs in the current shell, so session state changes
+// persist, and the completion marker still arrives on the session pipe. The
+// terminal doesn't become the command's controlling terminal, so programs
+// that open /dev/tty themselves still can't prompt. Close the capture when
+// done with it; Finish reads its output.
+func (bm *BashManager) WithPTY(command string) (string, *PTYCapture, error) {
+	master, slave, err := openPTY(bm.ptyRows, bm.ptyCols)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create pseudo-terminal: %w", err)
+	}
+	if err := bm.giveToSession(slave.Name()); err != nil {
+		master.Close()
+		slave.Close()
+		return "", nil, err
+	}
+
+	capture := &PTYCapture{
+		master: master,
+		slave:  slave,
+		output: bm.newOutputBuffer(),
+		store:  bm.outputs,
+		done:   make(chan struct{}),
+	}
+	go capture.copy()
+
+	tty := shellQuote(slave.Name())
+	wrapped := fmt.Sprintf("{ %s\n} < %s > %s 2>&1", command, tty, tty)
+	return wrapped, capture, nil
+}
+
+// copy reads the terminal until it is closed
+func (c *PTYCapture) copy() {
+	defer close(c.done)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := c.master.Read(buf)
+		c.output.Write(buf[:n])
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Finish collects the terminal output once the command has finished and puts
+// it in front of the result's output, which then only holds the exit code
+// line. The terminal's CRLF line endings become LF; other control characters
+// (and the terminal's echo of anything read) are kept.
+func (c *PTYCapture) Finish(result CommandResult) CommandResult {
+	c.slave.Close()
+	c.master.SetReadDeadline(time.Now().Add(ptyDrainGrace))
+	<-c.done
+	c.Close()
+
+	result.StoredOutputs = addOutputRef(result.StoredOutputs, "stdout", c.output, c.store)
+	text := strings.ReplaceAll(c.output.String(), "\r\n", "\n")
+	text = strings.TrimRight(strings.ToValidUTF8(text, "\uFFFD"), "\n")
+	if text == "" {
+		result.Output = strings.TrimLeft(result.Output, "\n")
+	} else if result.Output != "" && !strings.HasPrefix(result.Output, "\n") {
+		result.Output = text + "\n" + result.Output
+	} else {
+		result.Output = text + result.Output
+	}
+	return result
+}
+
+// Close releases the terminal
+func (c *PTYCapture) Close() {
+	c.once.Do(func() {
+		c.slave.Close()
+		c.master.Close()
+	})
+}
@@ -0,0 +1,64 @@
+//go:build linux
+
+package bash
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// PTYSupported reports whether commands can run on a pseudo-terminal here
+const PTYSupported = true
+
+// winsize is struct winsize from <sys/ioctl.h>
+type winsize struct {
+	rows, cols, xpixel, ypixel uint16
+}
+
+// openPTY opens a new pseudo-terminal pair with the given window size
+func openPTY(rows, cols int) (master, slave *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var number uint32
+	size := winsize{rows: uint16(rows), cols: uint16(cols)}
+	conn, err := master.SyscallConn()
+	if err == nil {
+		ctlErr := conn.Control(func(fd uintptr) {
+			unlock := int32(0)
+			if err = ioctl(fd, syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+				return
+			}
+			if err = ioctl(fd, syscall.TIOCGPTN, unsafe.Pointer(&number)); err != nil {
+				return
+			}
+			err = ioctl(fd, syscall.TIOCSWINSZ, unsafe.Pointer(&size))
+		})
+		if err == nil {
+			err = ctlErr
+		}
+	}
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+
+	slave, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", number), os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	return master, slave, nil
+}
+
+// ioctl performs an ioctl whose argument is a pointer
+func ioctl(fd, request uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package bash
+
+import (
+	"errors"
+	"os"
+)
+
+// PTYSupported reports whether commands can run on a pseudo-terminal here
+const PTYSupported = false
+
+// openPTY is unsupported off Linux
+func openPTY(rows, cols int) (master, slave *os.File, err error) {
+	return nil, nil, errors.New("pty mode is not supported on this platform")
+}
@@ -0,0 +1,142 @@
+package bash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrSessionBusy is wrapped by the error for a command turned away because
+// the session's queue is full
+var ErrSessionBusy = errors.New("session busy")
+
+// QueueFunc is told a waiting command's place in the queue: 1 when it is
+// next. It is called when the command joins the queue and each time it
+// moves up, never once the command has started.
+type QueueFunc func(position int)
+
+// commandQueue admits session commands one at a time, in arrival order.
+// Commands arriving while another runs wait their turn, unless max are
+// already waiting, when they are turned away. max 0 never turns any away.
+type commandQueue struct {
+	mutex   sync.Mutex
+	max     int
+	busy    bool
+	waiting []*queuedCommand
+}
+
+// queuedCommand is a command waiting in the queue
+type queuedCommand struct {
+	moved chan struct{} // signalled when the command moves up or its turn comes
+	turn  bool
+}
+
+// enter waits for the caller's turn to run a command, reporting its position
+// to queued (which may be nil) while it waits. Every successful enter must
+// be followed by leave. Fails with ErrCommandCancelled if ctx is done first.
+func (q *commandQueue) enter(ctx context.Context, queued QueueFunc) error {
+	q.mutex.Lock()
+	if !q.busy {
+		q.busy = true
+		q.mutex.Unlock()
+		return nil
+	}
+	if q.max > 0 && len(q.waiting) >= q.max {
+		waiting := len(q.waiting)
+		q.mutex.Unlock()
+		if waiting == 1 {
+			return fmt.Errorf("%w, 1 command queued", ErrSessionBusy)
+		}
+		return fmt.Errorf("%w, %d commands queued", ErrSessionBusy, waiting)
+	}
+	command := &queuedCommand{moved: make(chan struct{}, 1)}
+	q.waiting = append(q.waiting, command)
+	position := len(q.waiting)
+	q.mutex.Unlock()
+
+	for {
+		if queued != nil {
+			queued(position)
+		}
+		select {
+		case <-command.moved:
+		case <-ctx.Done():
+			q.mutex.Lock()
+			turn := command.turn
+			if !turn {
+				q.remove(command)
+			}
+			q.mutex.Unlock()
+			if turn {
+				// The turn came as the context ended; pass it on
+				q.leave()
+			}
+			return ErrCommandCancelled
+		}
+
+		q.mutex.Lock()
+		if command.turn {
+			q.mutex.Unlock()
+			return nil
+		}
+		position = q.position(command)
+		q.mutex.Unlock()
+	}
+}
+
+// leave ends the running command's turn, giving it to the next in line
+func (q *commandQueue) leave() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if len(q.waiting) == 0 {
+		q.busy = false
+		return
+	}
+	next := q.waiting[0]
+	q.waiting = q.waiting[1:]
+	next.turn = true
+	wake(next.moved)
+	for _, command := range q.waiting {
+		wake(command.moved)
+	}
+}
+
+// remove takes a cancelled command out of the queue, moving those behind it
+// up. Caller must hold mutex.
+func (q *commandQueue) remove(command *queuedCommand) {
+	i := q.position(command) - 1
+	if i < 0 {
+		return
+	}
+	q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+	for _, behind := range q.waiting[i:] {
+		wake(behind.moved)
+	}
+}
+
+// position returns the command's 1-based place in the queue, or 0 if it
+// isn't waiting. Caller must hold mutex.
+func (q *commandQueue) position(command *queuedCommand) int {
+	for i, waiting := range q.waiting {
+		if waiting == command {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// length returns how many commands are waiting for the session
+func (q *commandQueue) length() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.waiting)
+}
+
+// wake wakes the command waiting on ch, if it isn't awake already
+func wake(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
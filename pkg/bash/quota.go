@@ -0,0 +1,233 @@
+package bash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/perms"
+)
+
+// ErrWriteQuotaExceeded is wrapped by the error for a command stopped for
+// writing more than the write quota allows. The CommandResult returned with
+// it holds the output captured before the stop.
+var ErrWriteQuotaExceeded = errors.New("write quota exceeded")
+
+// DefaultQuotaPoll is how often a write-heavy command's usage is measured
+// unless configured otherwise
+const DefaultQuotaPoll = 500 * time.Millisecond
+
+// WriteQuotaOptions configures a WriteQuota
+type WriteQuotaOptions struct {
+	MaxBytes   int64
+	Commands   []*regexp.Regexp // write-heavy commands
+	Directory  string           // parent of the per-command directories (default: <temp dir>/mcp-bash-quota)
+	WatchRoots []string         // watched where there are no per-command directories (default: the cwd)
+	Poll       time.Duration    // default DefaultQuotaPoll
+}
+
+// WriteQuota is a safety net for commands that write without bound, such as
+// a generated loop appending to a file. Commands classified as write-heavy
+// are measured while they run and stopped, as a cancellation would stop
+// them, once they have written more than MaxBytes.
+//
+// Where quotaDirectories is set (Linux) each such command runs in a fresh
+// directory of its own, which is also its TMPDIR, and the directory's size
+// is what counts; it is removed if the quota is exceeded, and kept for the
+// files the command left there otherwise. Elsewhere the command runs where it
+// was and the growth of the watch roots is measured instead, which also
+// counts whatever else writes there.
+type WriteQuota struct {
+	opts WriteQuotaOptions
+}
+
+// NewWriteQuota creates a write quota
+func NewWriteQuota(opts WriteQuotaOptions) *WriteQuota {
+	if opts.Directory == "" {
+		opts.Directory = filepath.Join(os.TempDir(), "mcp-bash-quota")
+	}
+	if opts.Poll <= 0 {
+		opts.Poll = DefaultQuotaPoll
+	}
+	return &WriteQuota{opts: opts}
+}
+
+// Applies reports whether command is write-heavy. A nil quota applies to
+// nothing.
+func (q *WriteQuota) Applies(command string) bool {
+	if q == nil {
+		return false
+	}
+	for _, pattern := range q.opts.Commands {
+		if pattern.MatchString(command) {
+			return true
+		}
+	}
+	return false
+}
+
+// QuotaReport describes what a write-heavy command wrote
+type QuotaReport struct {
+	Directory  string   `json:"directory,omitempty"`  // the command's own directory
+	WatchRoots []string `json:"watchRoots,omitempty"` // or the roots whose growth was measured
+	UsedBytes  int64    `json:"usedBytes"`
+	LimitBytes int64    `json:"limitBytes"`
+	Exceeded   bool     `json:"exceeded"`
+}
+
+// QuotaWatch measures one write-heavy command
+type QuotaWatch struct {
+	quota    *WriteQuota
+	dir      string
+	roots    []string
+	baseline int64
+
+	// stop ends the measuring goroutine, if started, which closes done
+	stop    chan struct{}
+	done    chan struct{}
+	started bool
+
+	mutex    sync.Mutex
+	used     int64
+	exceeded bool
+
+	finish sync.Once
+	report QuotaReport
+}
+
+// WithWriteQuota prepares a write-heavy command to run under the write
+// quota, returning command unchanged and a nil watch for any other. With
+// per-command directories the command is wrapped in a subshell that moves
+// into its directory, so changes it makes to the session's state don't
+// persist. Run the command with the watch's Context, then Finish the watch.
+func (bm *BashManager) WithWriteQuota(command string) (string, *QuotaWatch, error) {
+	q := bm.writeQuota
+	if !q.Applies(command) {
+		return command, nil, nil
+	}
+	w := &QuotaWatch{quota: q, stop: make(chan struct{}), done: make(chan struct{})}
+
+	if !quotaDirectories {
+		w.roots = q.opts.WatchRoots
+		if len(w.roots) == 0 {
+			w.roots = []string{bm.WorkingDirectory()}
+		}
+		w.baseline = diskUsage(w.roots...)
+		return command, w, nil
+	}
+
+	if err := perms.MkdirAll(q.opts.Directory); err != nil {
+		return "", nil, fmt.Errorf("failed to create write quota directory: %w", err)
+	}
+	dir, err := perms.MkdirTemp(q.opts.Directory, "cmd-")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create write quota directory: %w", err)
+	}
+	if err := bm.giveToSession(dir); err != nil {
+		os.Remove(dir)
+		return "", nil, err
+	}
+	w.dir = dir
+	quoted := shellQuote(dir)
+	return fmt.Sprintf("( export TMPDIR=%s; cd %s || exit\n%s\n)", quoted, quoted, command), w, nil
+}
+
+// Context returns a context for running the command that is cancelled, with
+// an ErrWriteQuotaExceeded cause, once the command has written more than the
+// quota, and starts measuring. A nil watch returns ctx.
+func (w *QuotaWatch) Context(ctx context.Context) context.Context {
+	if w == nil {
+		return ctx
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	w.started = true
+	go func() {
+		defer close(w.done)
+		ticker := time.NewTicker(w.quota.opts.Poll)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+			}
+			if used, exceeded := w.measure(); exceeded {
+				fmt.Fprintf(os.Stderr, "Write quota exceeded: %s written, limit %s; stopping the command\n",
+					formatBytes(uint64(used)), formatBytes(uint64(w.quota.opts.MaxBytes)))
+				cancel(fmt.Errorf("%w: the command wrote %s, more than the %s allowed", ErrWriteQuotaExceeded,
+					formatBytes(uint64(used)), formatBytes(uint64(w.quota.opts.MaxBytes))))
+				return
+			}
+		}
+	}()
+	return ctx
+}
+
+// measure updates the bytes written so far and reports whether they exceed
+// the quota
+func (w *QuotaWatch) measure() (int64, bool) {
+	var used int64
+	if w.dir != "" {
+		used = diskUsage(w.dir)
+	} else {
+		used = max(diskUsage(w.roots...)-w.baseline, 0)
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.used = max(w.used, used)
+	if w.used > w.quota.opts.MaxBytes {
+		w.exceeded = true
+	}
+	return w.used, w.exceeded
+}
+
+// Finish stops measuring and reports what the command wrote. A command's
+// directory is removed if it exceeded the quota, or is empty. Later calls
+// return the same report; a nil watch returns nil.
+func (w *QuotaWatch) Finish() *QuotaReport {
+	if w == nil {
+		return nil
+	}
+	w.finish.Do(func() {
+		close(w.stop)
+		if w.started {
+			<-w.done
+		}
+		used, exceeded := w.measure()
+		w.report = QuotaReport{
+			Directory:  w.dir,
+			WatchRoots: w.roots,
+			UsedBytes:  used,
+			LimitBytes: w.quota.opts.MaxBytes,
+			Exceeded:   exceeded,
+		}
+		if w.dir != "" && (exceeded || used == 0) {
+			os.RemoveAll(w.dir)
+		}
+	})
+	return &w.report
+}
+
+// diskUsage returns the total size of the regular files under paths,
+// skipping what can't be read
+func diskUsage(paths ...string) int64 {
+	var total int64
+	for _, path := range paths {
+		filepath.WalkDir(path, func(_ string, entry fs.DirEntry, err error) error {
+			if err != nil || !entry.Type().IsRegular() {
+				return nil
+			}
+			if info, err := entry.Info(); err == nil {
+				total += info.Size()
+			}
+			return nil
+		})
+	}
+	return total
+}
@@ -0,0 +1,7 @@
+//go:build linux
+
+package bash
+
+// quotaDirectories is whether write-heavy commands get a directory of their
+// own to be measured in
+const quotaDirectories = true
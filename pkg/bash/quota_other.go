@@ -0,0 +1,7 @@
+//go:build !linux
+
+package bash
+
+// quotaDirectories is off here: write-heavy commands run where they are and
+// the watch roots are measured instead
+const quotaDirectories = false
@@ -0,0 +1,214 @@
+package bash
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// DefaultReadFileMaxBytes is the largest file read_file returns whole, and
+// the most text it returns for a range
+const DefaultReadFileMaxBytes = 256 * 1024
+
+// binarySniffBytes is how much of a file is checked for NUL bytes before it
+// is read as text
+const binarySniffBytes = 8000
+
+// ReadFileArgs holds the parsed arguments for the read_file tool
+type ReadFileArgs struct {
+	Path     string `json:"path"`
+	Offset   int    `json:"offset"`   // first line, 1-based (0 = the first)
+	Limit    int    `json:"limit"`    // number of lines (0 = to the end)
+	Encoding string `json:"encoding"` // EncodingText (default) or EncodingBase64
+}
+
+// HasRange reports whether the call asked for a range of lines
+func (args ReadFileArgs) HasRange() bool {
+	return args.Offset > 0 || args.Limit > 0
+}
+
+// ReadFileResult is what read_file returns
+type ReadFileResult struct {
+	Path       string
+	Size       int64
+	Text       string // numbered lines, or the base64 of the whole file
+	FirstLine  int    // first line returned, or 0 if none were
+	LastLine   int
+	TotalLines int  // lines in the file; only counted for text
+	NextOffset *int // where to continue, or nil if the range was read to its end
+}
+
+// ReadFile reads a file directly, without the shell. Text comes back with a
+// line number before each line, as cat -n prints them, invalid UTF-8
+// replaced, and CRLF line endings shown as LF. A file over maxBytes is
+// refused unless a range of lines is asked for, and a range returns at most
+// maxBytes of text, with NextOffset saying where to continue. Files that
+// look binary are refused as text; read them with EncodingBase64.
+func ReadFile(args ReadFileArgs, maxBytes int64) (*ReadFileResult, error) {
+	if maxBytes <= 0 {
+		maxBytes = DefaultReadFileMaxBytes
+	}
+	info, err := os.Stat(args.Path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s: %w", args.Path, err)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("cannot read %s: it is a directory", args.Path)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("cannot read %s: not a regular file", args.Path)
+	}
+	if info.Size() > maxBytes && !args.HasRange() {
+		return nil, fmt.Errorf("%s is %s, more than the %s read_file returns at once; read a range of lines with "+
+			"offset and limit", args.Path, formatBytes(uint64(info.Size())), formatBytes(uint64(maxBytes)))
+	}
+
+	file, err := os.Open(args.Path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s: %w", args.Path, err)
+	}
+	defer file.Close()
+
+	result := &ReadFileResult{Path: args.Path, Size: info.Size()}
+	if args.Encoding == EncodingBase64 {
+		data, err := io.ReadAll(io.LimitReader(file, maxBytes))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", args.Path, err)
+		}
+		result.Text = base64.StdEncoding.EncodeToString(data)
+		return result, nil
+	}
+
+	reader := bufio.NewReader(file)
+	if head, _ := reader.Peek(binarySniffBytes); bytes.IndexByte(head, 0) >= 0 {
+		return nil, fmt.Errorf("%s looks like a binary file; read it with encoding %q", args.Path, EncodingBase64)
+	}
+
+	first := max(args.Offset, 1)
+	var text strings.Builder
+	for line := 1; ; line++ {
+		content, err := readFileLine(reader, maxBytes)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", args.Path, err)
+		}
+		result.TotalLines = line
+
+		inRange := line >= first && (args.Limit == 0 || line < first+args.Limit)
+		if !inRange || result.NextOffset != nil {
+			continue
+		}
+		numbered := fmt.Sprintf("%6d\t%s\n", line, strings.ToValidUTF8(content, "�"))
+		if result.FirstLine > 0 && int64(text.Len()+len(numbered)) > maxBytes {
+			next := line
+			result.NextOffset = &next
+			continue
+		}
+		text.WriteString(numbered)
+		if result.FirstLine == 0 {
+			result.FirstLine = line
+		}
+		result.LastLine = line
+	}
+
+	if first > result.TotalLines && result.TotalLines > 0 {
+		return nil, fmt.Errorf("offset %d is past the end of %s, which has %d line(s)", first, args.Path,
+			result.TotalLines)
+	}
+	result.Text = text.String()
+	return result, nil
+}
+
+// readFileLine reads the next line without its line ending, or io.EOF once
+// there are no more. A final line without a newline still counts. At most
+// keep bytes of the line are returned, so one huge line can't exhaust memory.
+func readFileLine(reader *bufio.Reader, keep int64) (string, error) {
+	var line []byte
+	var total int
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		total += len(chunk)
+		if room := keep - int64(len(line)); room > 0 {
+			line = append(line, chunk[:min(int64(len(chunk)), room)]...)
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", err
+		}
+		if err != nil && total == 0 {
+			return "", io.EOF
+		}
+		break
+	}
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	return string(bytes.TrimSuffix(line, []byte("\r"))), nil
+}
+
+// ReadFileToolSchema defines the schema for read_file input
+var ReadFileToolSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type":        "string",
+			"description": "The file to read. Relative paths are resolved against the session's working directory",
+		},
+		"offset": map[string]interface{}{
+			"type":        "integer",
+			"description": "First line to return, 1-based (default 1)",
+		},
+		"limit": map[string]interface{}{
+			"type":        "integer",
+			"description": "Number of lines to return (default: to the end of the file)",
+		},
+		"encoding": map[string]interface{}{
+			"type": "string",
+			"enum": []string{EncodingText, EncodingBase64},
+			"description": "text (default) returns numbered lines. base64 returns the whole file byte for byte, " +
+				"for binary files",
+		},
+	},
+	"required": []string{"path"},
+}
+
+// ParseReadFileArgs parses arguments for the read_file tool
+func ParseReadFileArgs(args json.RawMessage) (ReadFileArgs, error) {
+	var params ReadFileArgs
+
+	if err := json.Unmarshal(args, &params); err != nil {
+		return params, fmt.Errorf("invalid arguments for read_file tool: %w", err)
+	}
+
+	if params.Path == "" {
+		return params, fmt.Errorf("path parameter is required")
+	}
+	if params.Offset < 0 {
+		return params, fmt.Errorf("offset must not be negative")
+	}
+	if params.Limit < 0 {
+		return params, fmt.Errorf("limit must not be negative")
+	}
+	switch params.Encoding {
+	case "":
+		params.Encoding = EncodingText
+	case EncodingText:
+	case EncodingBase64:
+		if params.HasRange() {
+			return params, fmt.Errorf("offset and limit select lines of text; base64 returns the whole file")
+		}
+	default:
+		return params, fmt.Errorf("unknown encoding %q (expected %s or %s)", params.Encoding, EncodingText,
+			EncodingBase64)
+	}
+
+	return params, nil
+}
@@ -0,0 +1,59 @@
+package bash
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// reapIdleSessions periodically closes the session once it has been unused
+// for longer than bm.idleTimeout. A session running a command is never idle.
+func (bm *BashManager) reapIdleSessions() {
+	interval := bm.idleTimeout / 4
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-bm.stopReaper:
+			return
+		case <-ticker.C:
+			bm.reapIfIdle()
+		}
+	}
+}
+
+// reapIfIdle closes the current session if it is idle past the limit. It
+// skips the check rather than wait when a command holds the session.
+func (bm *BashManager) reapIfIdle() {
+	if !bm.sessionMutex.TryLock() {
+		return
+	}
+	defer bm.sessionMutex.Unlock()
+
+	session := bm.session
+	if session == nil || session.busy.Load() {
+		return
+	}
+	idleFor := time.Since(time.Unix(0, session.lastUsed.Load()))
+	if idleFor < bm.idleTimeout {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "Closing bash session idle for %v (PID: %d)\n",
+		idleFor.Round(time.Second), session.getPID())
+	session.close()
+	bm.sessionClosed(session, "idle")
+	bm.session = nil
+	bm.current.Store(nil)
+
+	// Pending script buffers and stored output belong to the closed session
+	bm.clearScriptBuffers()
+	bm.outputs.clear()
+}
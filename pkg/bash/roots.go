@@ -0,0 +1,144 @@
+package bash
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// AllowedRoots confines what tools work on to a set of directories. Paths
+// given to the file tools, working_directory and exec's cwd must resolve,
+// symlinks and ".." included, to somewhere under a root, and sessions start
+// in the first root.
+//
+// Commands are checked too, but only on a best-effort basis: an absolute
+// path outside the roots written in a command is refused, which bash can
+// easily get around (cd .., variables, $(...)). Combine with the sandbox's
+// confineWrites for a boundary the shell can't cross.
+type AllowedRoots struct {
+	roots []string // real paths, without symlinks
+}
+
+// commandPathPattern finds absolute paths in a command: a / at the start of
+// a word, or after = or : as in --out=/x and PATH=/a:/b
+var commandPathPattern = regexp.MustCompile(`(?:^|[\s=:'"(<>|;&])(/[^\s'"()<>|;&` + "`" + `]*)`)
+
+// commandPathExempt are paths outside the roots that commands may name
+var commandPathExempt = regexp.MustCompile(`^/dev/(null|zero|stdin|stdout|stderr|tty|u?random|fd/\d+)$`)
+
+// NewAllowedRoots confines tools to dirs, which must be existing
+// directories given as absolute paths
+func NewAllowedRoots(dirs []string) (*AllowedRoots, error) {
+	if len(dirs) == 0 {
+		return nil, fmt.Errorf("allowedRoots lists no directories")
+	}
+	roots := &AllowedRoots{}
+	for _, dir := range dirs {
+		if !filepath.IsAbs(dir) {
+			return nil, fmt.Errorf("allowedRoots entry %q must be an absolute path", dir)
+		}
+		root, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			return nil, fmt.Errorf("allowedRoots entry %s: %w", dir, err)
+		}
+		if info, err := os.Stat(root); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("allowedRoots entry %s is not a directory", dir)
+		}
+		if root == string(filepath.Separator) {
+			return nil, fmt.Errorf("allowedRoots must not include the root directory")
+		}
+		roots.roots = append(roots.roots, root)
+	}
+	return roots, nil
+}
+
+// Roots returns the roots as real paths, the first being where sessions
+// start
+func (r *AllowedRoots) Roots() []string {
+	return append([]string(nil), r.roots...)
+}
+
+// contains reports whether a real path is a root or under one
+func (r *AllowedRoots) contains(path string) bool {
+	for _, root := range r.roots {
+		if path == root || strings.HasPrefix(path, root+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check resolves an absolute path to the real path it names and refuses it
+// unless that is under a root. Symlinks are followed the way the kernel
+// follows them, each before any ".." after it, so neither can lead out. The
+// part of the path that doesn't exist yet has no symlinks to follow; a
+// dangling symlink is refused, since writing through it would create its
+// target wherever that is. Tools should use the returned path. A nil
+// AllowedRoots allows every path, unchanged.
+func (r *AllowedRoots) Check(path string) (string, error) {
+	if r == nil {
+		return path, nil
+	}
+	if !filepath.IsAbs(path) {
+		return "", fmt.Errorf("path %q must be absolute (the session's current directory is unknown)", path)
+	}
+
+	// Not cleaned: "link/.." must go where the kernel would take it
+	parts := strings.Split(strings.TrimPrefix(path, string(filepath.Separator)), string(filepath.Separator))
+	prefix := func(n int) string {
+		return string(filepath.Separator) + strings.Join(parts[:n], string(filepath.Separator))
+	}
+	for n := len(parts); n >= 0; n-- {
+		resolved, err := filepath.EvalSymlinks(prefix(n))
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				return "", fmt.Errorf("path %s: %w", path, err)
+			}
+			continue
+		}
+		if n < len(parts) {
+			if _, err := os.Lstat(prefix(n + 1)); err == nil {
+				return "", fmt.Errorf("path %s goes through a symlink whose target does not exist", path)
+			}
+		}
+		real := filepath.Join(append([]string{resolved}, parts[n:]...)...)
+		if !r.contains(real) {
+			return "", fmt.Errorf("path %s is outside the allowed roots (%s)", path, strings.Join(r.roots, ", "))
+		}
+		return real, nil
+	}
+	return "", fmt.Errorf("path %s: no part of it exists", path)
+}
+
+// CheckCommand refuses a command that names an absolute path outside the
+// roots, other than a few devices such as /dev/null. A script's #! line is
+// exempt. Best effort only: see AllowedRoots. A nil AllowedRoots allows
+// every command.
+func (r *AllowedRoots) CheckCommand(command string) error {
+	if r == nil {
+		return nil
+	}
+	if strings.HasPrefix(command, "#!") {
+		_, command, _ = strings.Cut(command, "\n")
+	}
+	for _, match := range commandPathPattern.FindAllStringSubmatch(command, -1) {
+		path := match[1]
+		// //host/... is a URL's tail (https://...), not a path
+		if strings.HasPrefix(path, "//") || commandPathExempt.MatchString(path) {
+			continue
+		}
+		if !r.contains(filepath.Clean(path)) {
+			return fmt.Errorf("command names %s, which is outside the allowed roots (%s)", path,
+				strings.Join(r.roots, ", "))
+		}
+	}
+	return nil
+}
+
+// AllowedRoots returns the roots tools are confined to, or nil
+func (bm *BashManager) AllowedRoots() *AllowedRoots {
+	return bm.roots
+}
@@ -0,0 +1,131 @@
+package bash
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// rootsFixture creates root and outside directories, with symlinks inside
+// root leading out of it, and returns roots confined to root
+func rootsFixture(t *testing.T) (roots *AllowedRoots, root, outside string) {
+	t.Helper()
+	base, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	root = filepath.Join(base, "root")
+	outside = filepath.Join(base, "outside")
+	for _, dir := range []string{filepath.Join(root, "sub"), outside} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{
+		"escape":   outside,
+		"inside":   filepath.Join(root, "sub"),
+		"dangling": filepath.Join(outside, "missing"),
+	} {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	roots, err = NewAllowedRoots([]string{root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return roots, root, outside
+}
+
+func TestAllowedRootsCheck(t *testing.T) {
+	roots, root, outside := rootsFixture(t)
+
+	allowed := map[string]string{
+		root:                                root,
+		root + "/sub/new/file.txt":          root + "/sub/new/file.txt",
+		root + "/inside/file.txt":           root + "/sub/file.txt",
+		root + "/sub/../sub/file.txt":       root + "/sub/file.txt",
+		root + "/inside/../inside/file.txt": root + "/sub/file.txt",
+	}
+	for path, want := range allowed {
+		got, err := roots.Check(path)
+		if err != nil || got != want {
+			t.Errorf("Check(%s) = %q, %v; want %q", path, got, err, want)
+		}
+	}
+
+	refused := []string{
+		outside + "/file.txt",
+		root + "/../outside/file.txt",
+		root + "/escape/file.txt",
+		root + "/escape",
+		root + "/dangling",
+		root + "/inside/../../outside",
+		root + "-sibling/file.txt",
+		"relative/file.txt",
+	}
+	for _, path := range refused {
+		if got, err := roots.Check(path); err == nil {
+			t.Errorf("Check(%s) = %q, want it refused", path, got)
+		}
+	}
+}
+
+func TestAllowedRootsCheckCommand(t *testing.T) {
+	roots, root, outside := rootsFixture(t)
+
+	for _, command := range []string{
+		"ls " + root + "/sub",
+		"cat < /dev/null > " + root + "/out",
+		"curl -o " + root + "/x https://example.com/file",
+		"#!/bin/sh\necho hi",
+		"echo relative/path",
+	} {
+		if err := roots.CheckCommand(command); err != nil {
+			t.Errorf("CheckCommand(%q) = %v", command, err)
+		}
+	}
+
+	for _, command := range []string{
+		"cat " + outside + "/secret",
+		"tool --out=" + outside,
+		"PATH=" + root + ":/usr/bin",
+		"(cd /etc)",
+		"ls " + root + "/../outside",
+	} {
+		if err := roots.CheckCommand(command); err == nil {
+			t.Errorf("CheckCommand(%q) allowed", command)
+		}
+	}
+
+	var none *AllowedRoots
+	if err := none.CheckCommand("cat /etc/passwd"); err != nil {
+		t.Errorf("nil roots refused a command: %v", err)
+	}
+	if path, err := none.Check("relative"); err != nil || path != "relative" {
+		t.Errorf("nil roots changed a path: %q, %v", path, err)
+	}
+}
+
+func TestNewAllowedRootsValidates(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, dirs := range [][]string{nil, {"relative"}, {"/"}, {file}, {file + "-missing"}} {
+		if _, err := NewAllowedRoots(dirs); err == nil {
+			t.Errorf("NewAllowedRoots(%q) accepted", strings.Join(dirs, ","))
+		}
+	}
+}
+
+func TestSessionConfinedToAllowedRoots(t *testing.T) {
+	roots, root, _ := rootsFixture(t)
+	bm := newTestManager(t, Options{Roots: roots})
+
+	if result := run(t, bm, "pwd"); result.Output != root {
+		t.Errorf("session started in %q, want the first root %q", result.Output, root)
+	}
+}
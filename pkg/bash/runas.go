@@ -0,0 +1,123 @@
+package bash
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// RunAs is the user and group session shells run as, in place of the
+// server's own, resolved from runAsUser and runAsGroup
+type RunAs struct {
+	UID      uint32
+	GID      uint32
+	Groups   []uint32 // supplementary groups; empty when the group was overridden
+	Username string
+	Home     string
+}
+
+// ResolveRunAs looks up the user (a name or numeric uid) and optional group
+// (a name or numeric gid; the user's primary group by default) session
+// shells should run as. The server must be able to switch to them: as root,
+// or already running as that user.
+func ResolveRunAs(userName, groupName string) (*RunAs, error) {
+	if !runAsSupported {
+		return nil, fmt.Errorf("runAsUser is not supported on this platform")
+	}
+
+	account, err := lookupUser(userName)
+	if err != nil {
+		return nil, err
+	}
+	uid, err := parseID(account.Uid)
+	if err != nil {
+		return nil, fmt.Errorf("user %q has a non-numeric uid %q", userName, account.Uid)
+	}
+	gid, err := parseID(account.Gid)
+	if err != nil {
+		return nil, fmt.Errorf("user %q has a non-numeric gid %q", userName, account.Gid)
+	}
+
+	runAs := &RunAs{UID: uid, GID: gid, Username: account.Username, Home: account.HomeDir}
+	if groupName != "" {
+		if runAs.GID, err = lookupGroup(groupName); err != nil {
+			return nil, err
+		}
+	} else if ids, err := account.GroupIds(); err == nil {
+		for _, id := range ids {
+			if group, err := parseID(id); err == nil {
+				runAs.Groups = append(runAs.Groups, group)
+			}
+		}
+	}
+
+	if euid := os.Geteuid(); euid != 0 && (uint32(euid) != runAs.UID || uint32(os.Getegid()) != runAs.GID) {
+		return nil, fmt.Errorf("cannot run sessions as %s (uid %d, gid %d): the server runs as uid %d and "+
+			"only root can switch users", runAs.Username, runAs.UID, runAs.GID, euid)
+	}
+	return runAs, nil
+}
+
+// lookupUser finds a user by name, or by uid if the name is numeric
+func lookupUser(name string) (*user.User, error) {
+	account, err := user.Lookup(name)
+	if err == nil {
+		return account, nil
+	}
+	if _, idErr := parseID(name); idErr == nil {
+		if account, idErr := user.LookupId(name); idErr == nil {
+			return account, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown runAsUser %q: %w", name, err)
+}
+
+// lookupGroup finds a group's gid by name, or takes a numeric gid as is
+func lookupGroup(name string) (uint32, error) {
+	if group, err := user.LookupGroup(name); err == nil {
+		return parseID(group.Gid)
+	}
+	if gid, err := parseID(name); err == nil {
+		return gid, nil
+	}
+	return 0, fmt.Errorf("unknown runAsGroup %q", name)
+}
+
+// parseID parses a numeric uid or gid
+func parseID(id string) (uint32, error) {
+	n, err := strconv.ParseUint(id, 10, 32)
+	return uint32(n), err
+}
+
+// env replaces the identity variables in env with the run-as user's
+func (r *RunAs) env(env []string) []string {
+	replaced := map[string]string{"HOME": r.Home, "USER": r.Username, "LOGNAME": r.Username}
+	out := make([]string, 0, len(env)+len(replaced))
+	for _, entry := range env {
+		name, _, _ := strings.Cut(entry, "=")
+		if _, ok := replaced[name]; !ok {
+			out = append(out, entry)
+		}
+	}
+	for _, name := range []string{"HOME", "USER", "LOGNAME"} {
+		if replaced[name] != "" {
+			out = append(out, name+"="+replaced[name])
+		}
+	}
+	return out
+}
+
+// giveToSession hands a file the server created for a command (its stdin,
+// captured stdout, script or terminal) to the run-as user, so the session
+// can use it. Nothing changes when sessions run as the server's user.
+func (bm *BashManager) giveToSession(path string) error {
+	if bm.runAs == nil {
+		return nil
+	}
+	if err := os.Chown(path, int(bm.runAs.UID), int(bm.runAs.GID)); err != nil {
+		return fmt.Errorf("failed to give %s to user %s: %w", path, bm.runAs.Username, err)
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package bash
+
+import "os/exec"
+
+// runAsSupported reports whether session shells can run as another user here
+const runAsSupported = false
+
+// setCredential is a no-op where ResolveRunAs always fails.
+func (r *RunAs) setCredential(cmd *exec.Cmd) {}
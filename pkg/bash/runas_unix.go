@@ -0,0 +1,29 @@
+//go:build unix
+
+package bash
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// runAsSupported reports whether session shells can run as another user here
+const runAsSupported = true
+
+// setCredential makes cmd run as the run-as user, if one is set. Only root
+// may set supplementary groups; anyone else is already that user.
+func (r *RunAs) setCredential(cmd *exec.Cmd) {
+	if r == nil {
+		return
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = &syscall.Credential{
+		Uid:         r.UID,
+		Gid:         r.GID,
+		Groups:      r.Groups,
+		NoSetGroups: os.Geteuid() != 0,
+	}
+}
@@ -0,0 +1,101 @@
+package bash
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Sandbox runs sessions, one-shot commands and exec programs in their own
+// mount, PID and network namespaces (Linux only): they see only their own
+// processes and have no network. ReadOnly lists host directories that are
+// bind-mounted read-only over themselves. Writable, if set, makes the root
+// filesystem read-only except for those directories; other mounts such as
+// /tmp, /dev and /proc keep their own modes.
+//
+// NoNetwork without Enabled gives them only a network namespace of their
+// own, cutting them off from the network but nothing else. Either way
+// AllowLoopback brings up the namespace's loopback interface, so they can
+// still reach servers they start themselves on 127.0.0.1.
+//
+// An unprivileged server adds a user namespace mapping its user to root, so
+// the shell can set up its mounts and interfaces.
+type Sandbox struct {
+	Enabled  bool
+	ReadOnly []string
+	Writable []string
+
+	NoNetwork     bool
+	AllowLoopback bool
+}
+
+// active reports whether commands run in namespaces of their own
+func (s Sandbox) active() bool {
+	return s.Enabled || s.NoNetwork
+}
+
+// setupScript returns the commands that finish the sandbox from inside it,
+// before anything else runs: mounts are made private so nothing leaks back
+// to the host, /proc is remounted for the new PID namespace, the read-only
+// paths are bound, writes are confined to the writable paths, and loopback
+// is brought up if allowed. "" if there is
+// nothing to do.
+func (s Sandbox) setupScript() string {
+	var commands []string
+	if s.Enabled {
+		commands = append(commands, "mount --make-rprivate /", "mount -t proc proc /proc")
+		for _, path := range s.ReadOnly {
+			quoted := shellQuote(path)
+			commands = append(commands,
+				fmt.Sprintf("mount --bind %s %s", quoted, quoted),
+				fmt.Sprintf("mount -o remount,bind,ro %s %s", quoted, quoted))
+		}
+		// Each writable directory becomes a mount of its own first, so
+		// making / read-only leaves it alone
+		if len(s.Writable) > 0 {
+			for _, path := range s.Writable {
+				quoted := shellQuote(path)
+				commands = append(commands, fmt.Sprintf("mount --bind %s %s", quoted, quoted))
+			}
+			commands = append(commands, "mount -o remount,bind,ro /")
+		}
+	}
+	if s.AllowLoopback {
+		commands = append(commands, "ip link set lo up")
+	}
+	return strings.Join(commands, " && ")
+}
+
+// sandboxed returns a command that runs cmd's program in a new sandbox, set
+// up first, for one-shot commands and exec programs. Without a sandbox cmd
+// is returned as it is. Call before setting anything else on cmd.
+func (bm *BashManager) sandboxed(cmd *exec.Cmd) *exec.Cmd {
+	if !bm.sandbox.active() {
+		return cmd
+	}
+	quoted := []string{shellQuote(cmd.Path)}
+	for _, arg := range cmd.Args[1:] {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	script := "exec " + strings.Join(quoted, " ")
+	if setup := bm.sandbox.setupScript(); setup != "" {
+		script = "{ " + setup + "; } >/dev/null 2>&1 || " +
+			"{ echo 'sandbox setup failed' >&2; exit 126; }\n" + script
+	}
+	cmd = exec.Command(bm.shell, "-c", script)
+	bm.sandbox.setNamespaces(cmd)
+	return cmd
+}
+
+// applySandbox finishes the session's sandbox before anything else runs in
+// it. A failure fails session creation rather than leaving it exposed.
+func (bs *BashSession) applySandbox(sandbox Sandbox) error {
+	script := sandbox.setupScript()
+	if script == "" {
+		return nil
+	}
+	if !sandbox.Enabled {
+		return bs.runSetup("set up the network namespace", script)
+	}
+	return bs.runSetup("set up the sandbox", script)
+}
@@ -0,0 +1,30 @@
+//go:build linux
+
+package bash
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setNamespaces starts cmd in a new network namespace, and new mount and PID
+// namespaces for a full sandbox, adding a user namespace that maps the
+// server's user to root when it isn't root
+func (s Sandbox) setNamespaces(cmd *exec.Cmd) {
+	if !s.active() {
+		return
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Cloneflags = syscall.CLONE_NEWNET
+	if s.Enabled {
+		cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWNS | syscall.CLONE_NEWPID
+	}
+	if os.Geteuid() != 0 {
+		cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWUSER
+		cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}}
+		cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}}
+	}
+}
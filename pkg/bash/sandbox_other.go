@@ -0,0 +1,9 @@
+//go:build !linux
+
+package bash
+
+import "os/exec"
+
+// setNamespaces is a no-op: the config rejects sandbox and networkAccess
+// false outside Linux.
+func (s Sandbox) setNamespaces(cmd *exec.Cmd) {}
@@ -0,0 +1,153 @@
+package bash
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/perms"
+)
+
+// ScriptArgs holds the parsed arguments for the bash_script tool
+type ScriptArgs struct {
+	Script      string   `json:"script"`
+	Args        []string `json:"args"`
+	Interpreter string   `json:"interpreter"` // "" means the shebang line, or else the configured shell
+	// ValidateOnly checks that the script parses instead of running it
+	ValidateOnly bool `json:"validate_only"`
+}
+
+// WithScript writes script to a private temp file (mode 0700) and returns
+// the command that runs it in the session with args as $1..$n, and the
+// function that removes the file once the command has finished. The script
+// runs under interpreter if one is given; otherwise under the interpreter
+// named by its #! line, or the configured shell if it has none. A #! line
+// is honoured by running its interpreter explicitly, so a temp directory
+// mounted noexec doesn't matter.
+func (bm *BashManager) WithScript(args ScriptArgs) (string, func(), error) {
+	interpreter := bm.scriptInterpreter(args)
+
+	file, err := perms.CreateTemp("", "mcp-bash-script-*")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create script file: %w", err)
+	}
+	path := file.Name()
+	cleanup := func() { os.Remove(path) }
+
+	if _, err := file.WriteString(args.Script); err != nil {
+		file.Close()
+		cleanup()
+		return "", nil, fmt.Errorf("failed to write script file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to write script file: %w", err)
+	}
+	if err := os.Chmod(path, 0700); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to set script file permissions: %w", err)
+	}
+	if err := bm.giveToSession(path); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+
+	words := make([]string, 0, len(interpreter)+1+len(args.Args))
+	for _, word := range interpreter {
+		words = append(words, shellQuote(word))
+	}
+	words = append(words, shellQuote(path))
+	for _, arg := range args.Args {
+		words = append(words, shellQuote(arg))
+	}
+	fmt.Fprintf(os.Stderr, "Running script (%d bytes) from %s with %s\n", len(args.Script), path,
+		strings.Join(interpreter, " "))
+	return strings.Join(words, " "), cleanup, nil
+}
+
+// scriptInterpreter returns the command line a script runs under: the
+// interpreter argument, else its #! line, else the configured shell
+func (bm *BashManager) scriptInterpreter(args ScriptArgs) []string {
+	interpreter := strings.Fields(args.Interpreter)
+	if len(interpreter) == 0 {
+		interpreter = shebang(args.Script)
+	}
+	if len(interpreter) == 0 {
+		interpreter = []string{bm.shell}
+	}
+	return interpreter
+}
+
+// shebang returns the interpreter and optional argument named by script's #!
+// line, or nil if it has none. As on Linux, everything after the
+// interpreter is a single argument.
+func shebang(script string) []string {
+	line, ok := strings.CutPrefix(script, "#!")
+	if !ok {
+		return nil
+	}
+	line, _, _ = strings.Cut(line, "\n")
+	line = strings.TrimSpace(strings.TrimSuffix(line, "\r"))
+	if line == "" {
+		return nil
+	}
+	end := strings.IndexAny(line, " \t")
+	if end < 0 {
+		return []string{line}
+	}
+	return []string{line[:end], strings.TrimSpace(line[end:])}
+}
+
+// ScriptToolSchema defines the schema for bash_script input
+var ScriptToolSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"script": map[string]interface{}{
+			"type":        "string",
+			"description": "The script to run, as multi-line text with no extra escaping",
+		},
+		"args": map[string]interface{}{
+			"type":        "array",
+			"items":       map[string]interface{}{"type": "string"},
+			"description": "Arguments passed to the script as $1..$n, exactly as given",
+		},
+		"interpreter": map[string]interface{}{
+			"type": "string",
+			"description": "Program to run the script with, e.g. python3 (default: the script's #! line, or " +
+				"the server's shell)",
+		},
+		"validate_only": map[string]interface{}{
+			"type": "boolean",
+			"description": "Only check that the script parses (-n, for shell scripts), without running it or " +
+				"touching the session. Returns \"syntax OK\" or the parser's errors with line numbers",
+		},
+	},
+	"required": []string{"script"},
+}
+
+// ParseScriptArgs parses arguments for the bash_script tool
+func ParseScriptArgs(args json.RawMessage) (ScriptArgs, error) {
+	var params ScriptArgs
+
+	if err := json.Unmarshal(args, &params); err != nil {
+		return params, fmt.Errorf("invalid arguments for bash_script tool: %w", err)
+	}
+
+	if strings.TrimSpace(params.Script) == "" {
+		return params, fmt.Errorf("script parameter is required")
+	}
+	if len(params.Script) > MaxScriptBufferSize {
+		return params, fmt.Errorf("script is %d bytes; the maximum is %d", len(params.Script), MaxScriptBufferSize)
+	}
+	if strings.ContainsAny(params.Interpreter, "\n\x00") {
+		return params, fmt.Errorf("interpreter must be a single line")
+	}
+	for i, arg := range params.Args {
+		if strings.ContainsRune(arg, 0) {
+			return params, fmt.Errorf("argument %d contains a NUL byte", i+1)
+		}
+	}
+
+	return params, nil
+}
@@ -0,0 +1,192 @@
+package bash
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	// MaxScriptBufferSize is the maximum accumulated size of a single named
+	// script buffer. Chunks that would push a buffer past this are rejected.
+	MaxScriptBufferSize = 16 * 1024 * 1024 // 16MB
+
+	// MaxScriptBufferTotal is the maximum accumulated size of all script
+	// buffers together, however many names they are spread across.
+	MaxScriptBufferTotal = 64 * 1024 * 1024 // 64MB
+
+	// DefaultScriptBufferName is used when a bash_script_buffer call omits a name.
+	DefaultScriptBufferName = "default"
+)
+
+// AppendScript appends a chunk of script text to the named buffer, creating the
+// buffer if needed. Returns the total buffered size after the append.
+func (bm *BashManager) AppendScript(name, content string) (int, error) {
+	bm.scriptMutex.Lock()
+	defer bm.scriptMutex.Unlock()
+
+	if bm.scriptBuffers == nil {
+		bm.scriptBuffers = make(map[string]*strings.Builder)
+	}
+
+	// The buffer is only created once the chunk fits, so a rejected first
+	// chunk leaves nothing behind
+	current := 0
+	buf, ok := bm.scriptBuffers[name]
+	if ok {
+		current = buf.Len()
+	}
+	if current+len(content) > MaxScriptBufferSize {
+		return current, fmt.Errorf("script buffer '%s' would exceed %d bytes (currently %d, chunk %d)",
+			name, MaxScriptBufferSize, current, len(content))
+	}
+	total := 0
+	for _, other := range bm.scriptBuffers {
+		total += other.Len()
+	}
+	if total+len(content) > MaxScriptBufferTotal {
+		return current, fmt.Errorf("script buffers would exceed %d bytes in all (currently %d, chunk %d); "+
+			"run or abort some first", MaxScriptBufferTotal, total, len(content))
+	}
+
+	if !ok {
+		buf = &strings.Builder{}
+		bm.scriptBuffers[name] = buf
+	}
+	buf.WriteString(content)
+	return buf.Len(), nil
+}
+
+// RunScript executes the named buffer as a script in the bash session and
+// clears it. The buffer is written to a private temp file and run as a
+// separate process, like a bash_script script (under its #! line, or else
+// the configured shell), so its size is not limited by the command pipe or
+// message size.
+func (bm *BashManager) RunScript(name string) (CommandResult, error) {
+	return bm.RunScriptIf(name, nil)
+}
+
+// RunScriptIf is RunScript with an approval step: approve, if non-nil, sees
+// the exact script that will run and can refuse it by returning an error.
+// A refused buffer is kept, so it can be run once allowed or aborted;
+// otherwise the buffer is cleared once approved, whether or not it runs.
+func (bm *BashManager) RunScriptIf(name string, approve func(script string) error) (CommandResult, error) {
+	bm.scriptMutex.Lock()
+	buf, ok := bm.scriptBuffers[name]
+	var script string
+	if ok {
+		script = buf.String()
+	}
+	bm.scriptMutex.Unlock()
+
+	if script == "" {
+		return CommandResult{}, fmt.Errorf("script buffer '%s' is empty", name)
+	}
+
+	if approve != nil {
+		if err := approve(script); err != nil {
+			return CommandResult{}, err
+		}
+	}
+
+	bm.scriptMutex.Lock()
+	if bm.scriptBuffers[name] == buf {
+		delete(bm.scriptBuffers, name)
+	}
+	bm.scriptMutex.Unlock()
+
+	command, cleanup, err := bm.WithScript(ScriptArgs{Script: script})
+	if err != nil {
+		return CommandResult{}, err
+	}
+	defer cleanup()
+
+	fmt.Fprintf(os.Stderr, "Running script buffer '%s' (%d bytes)\n", name, len(script))
+	return bm.ExecuteCommand(command)
+}
+
+// AbortScript discards the named buffer. Returns the number of bytes discarded.
+func (bm *BashManager) AbortScript(name string) int {
+	bm.scriptMutex.Lock()
+	defer bm.scriptMutex.Unlock()
+
+	buf, ok := bm.scriptBuffers[name]
+	if !ok {
+		return 0
+	}
+	delete(bm.scriptBuffers, name)
+	return buf.Len()
+}
+
+// ScriptBufferSizes returns the current size of every pending script buffer.
+func (bm *BashManager) ScriptBufferSizes() map[string]int {
+	bm.scriptMutex.Lock()
+	defer bm.scriptMutex.Unlock()
+
+	sizes := make(map[string]int, len(bm.scriptBuffers))
+	for name, buf := range bm.scriptBuffers {
+		sizes[name] = buf.Len()
+	}
+	return sizes
+}
+
+// clearScriptBuffers drops all pending script buffers (used on session restart).
+func (bm *BashManager) clearScriptBuffers() {
+	bm.scriptMutex.Lock()
+	defer bm.scriptMutex.Unlock()
+	bm.scriptBuffers = nil
+}
+
+// ScriptBufferToolSchema defines the schema for bash_script_buffer input
+var ScriptBufferToolSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"action": map[string]interface{}{
+			"type": "string",
+			"enum": []string{"append", "run", "abort", "list"},
+			"description": "append adds content to the buffer, run executes and clears it, abort discards it, " +
+				"list shows every pending buffer and its size",
+		},
+		"name": map[string]interface{}{
+			"type":        "string",
+			"description": "Name of the script buffer (default: \"default\")",
+		},
+		"content": map[string]interface{}{
+			"type":        "string",
+			"description": "Script text to append (required for append)",
+		},
+	},
+	"required": []string{"action"},
+}
+
+// ParseScriptBufferArgs parses arguments for the bash_script_buffer tool
+func ParseScriptBufferArgs(args json.RawMessage) (action, name, content string, err error) {
+	var params struct {
+		Action  string `json:"action"`
+		Name    string `json:"name"`
+		Content string `json:"content"`
+	}
+
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", "", "", fmt.Errorf("invalid arguments for bash_script_buffer tool: %w", err)
+	}
+
+	switch params.Action {
+	case "append":
+		if params.Content == "" {
+			return "", "", "", fmt.Errorf("content parameter is required for append")
+		}
+	case "run", "abort", "list":
+	case "":
+		return "", "", "", fmt.Errorf("action parameter is required")
+	default:
+		return "", "", "", fmt.Errorf("unknown action: %s (expected append, run, abort, or list)", params.Action)
+	}
+
+	if params.Name == "" {
+		params.Name = DefaultScriptBufferName
+	}
+
+	return params.Action, params.Name, params.Content, nil
+}
@@ -0,0 +1,83 @@
+package bash
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAppendScriptAccumulatesAndLists(t *testing.T) {
+	bm := newTestManager(t, Options{})
+
+	if size, err := bm.AppendScript("a", "echo one\n"); err != nil || size != 9 {
+		t.Fatalf("append = %d, %v; want 9, nil", size, err)
+	}
+	if size, err := bm.AppendScript("a", "echo two\n"); err != nil || size != 18 {
+		t.Fatalf("append = %d, %v; want 18, nil", size, err)
+	}
+	if _, err := bm.AppendScript("b", "true"); err != nil {
+		t.Fatal(err)
+	}
+
+	sizes := bm.ScriptBufferSizes()
+	if len(sizes) != 2 || sizes["a"] != 18 || sizes["b"] != 4 {
+		t.Errorf("sizes = %v, want a:18 b:4", sizes)
+	}
+
+	if n := bm.AbortScript("b"); n != 4 {
+		t.Errorf("abort discarded %d bytes, want 4", n)
+	}
+	if n := bm.AbortScript("b"); n != 0 {
+		t.Errorf("second abort discarded %d bytes, want 0", n)
+	}
+	if _, ok := bm.ScriptBufferSizes()["b"]; ok {
+		t.Errorf("aborted buffer still listed")
+	}
+}
+
+func TestAppendScriptOversizedFirstChunkLeavesNoBuffer(t *testing.T) {
+	bm := newTestManager(t, Options{})
+
+	chunk := strings.Repeat("x", MaxScriptBufferSize+1)
+	if _, err := bm.AppendScript("big", chunk); err == nil {
+		t.Fatal("oversized chunk accepted")
+	}
+	if sizes := bm.ScriptBufferSizes(); len(sizes) != 0 {
+		t.Errorf("sizes = %v, want no buffers after a rejected first chunk", sizes)
+	}
+
+	// A rejected chunk for an existing buffer leaves it as it was
+	if _, err := bm.AppendScript("big", "echo hi\n"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bm.AppendScript("big", chunk); err == nil {
+		t.Fatal("oversized chunk accepted")
+	}
+	if size := bm.ScriptBufferSizes()["big"]; size != 8 {
+		t.Errorf("size = %d, want 8", size)
+	}
+}
+
+func TestAppendScriptTotalCap(t *testing.T) {
+	bm := newTestManager(t, Options{})
+
+	full := strings.Repeat("x", MaxScriptBufferSize)
+	names := []string{"a", "b", "c", "d"}
+	for _, name := range names[:MaxScriptBufferTotal/MaxScriptBufferSize] {
+		if _, err := bm.AppendScript(name, full); err != nil {
+			t.Fatalf("append %s: %v", name, err)
+		}
+	}
+
+	_, err := bm.AppendScript("e", "x")
+	if err == nil || !strings.Contains(err.Error(), "in all") {
+		t.Fatalf("err = %v, want the total cap error", err)
+	}
+	if _, ok := bm.ScriptBufferSizes()["e"]; ok {
+		t.Errorf("buffer rejected by the total cap still listed")
+	}
+
+	bm.AbortScript("a")
+	if _, err := bm.AppendScript("e", "x"); err != nil {
+		t.Errorf("append after abort: %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package bash
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/collate"
+)
+
+// cwdProbeTimeout bounds the pwd fallback used where /proc is unavailable.
+const cwdProbeTimeout = 2 * time.Second
+
+// SessionInfo describes a live bash session for the bash_sessions tool
+type SessionInfo struct {
+	ID               int        `json:"id"`
+	PID              int        `json:"pid"`
+	StartedAt        time.Time  `json:"startedAt"`
+	UptimeSeconds    int64      `json:"uptimeSeconds"`
+	LastCommandAt    *time.Time `json:"lastCommandAt,omitempty"`
+	Busy             bool       `json:"busy"`
+	Queued           int        `json:"queued"` // commands waiting for it
+	WorkingDirectory string     `json:"workingDirectory,omitempty"`
+	BashVersion      string     `json:"bashVersion,omitempty"` // "" if the shell isn't bash
+
+	// BashCapabilities are the version-dependent features the session's
+	// bash has, if it is bash
+	BashCapabilities *BashCapabilities `json:"bashCapabilities,omitempty"`
+}
+
+// Sessions lists the live sessions. It never waits for a running command:
+// the working directory comes from /proc, or else from the last command's
+// completion marker, falling back to a quick pwd probe only when the session
+// is idle.
+func (bm *BashManager) Sessions() []SessionInfo {
+	sessions := []SessionInfo{}
+
+	session := bm.current.Load()
+	if session == nil || session.stopped.Load() {
+		return sessions
+	}
+
+	info := SessionInfo{
+		ID:               session.id,
+		PID:              session.getPID(),
+		StartedAt:        session.startedAt,
+		UptimeSeconds:    int64(time.Since(session.startedAt).Seconds()),
+		Busy:             session.busy.Load(),
+		Queued:           bm.queue.length(),
+		WorkingDirectory: session.procWorkingDirectory(),
+	}
+	if session.hasVersion {
+		info.BashVersion = session.version.Raw
+		capabilities := session.version.Capabilities()
+		info.BashCapabilities = &capabilities
+	}
+	if last := session.lastCommand.Load(); last != 0 {
+		t := time.Unix(0, last)
+		info.LastCommandAt = &t
+	}
+	if info.WorkingDirectory == "" {
+		info.WorkingDirectory = session.trackedWorkingDirectory()
+	}
+	if info.WorkingDirectory == "" && !info.Busy {
+		info.WorkingDirectory = bm.probeWorkingDirectory(session)
+	}
+
+	return append(sessions, info)
+}
+
+// probeWorkingDirectory asks an idle session for $PWD. Returns "" if the
+// session is busy or the probe fails.
+func (bm *BashManager) probeWorkingDirectory(session *BashSession) string {
+	if !bm.sessionMutex.TryLock() {
+		return ""
+	}
+	defer bm.sessionMutex.Unlock()
+	if bm.session != session {
+		return ""
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cwdProbeTimeout)
+	defer cancel()
+	// The probe is not a client command: don't let it count as use
+	lastCommand, lastUsed := session.lastCommand.Load(), session.lastUsed.Load()
+	result, err := session.execute(`echo "$PWD"`, ctx, executeLimits{total: cwdProbeTimeout})
+	session.lastCommand.Store(lastCommand)
+	session.lastUsed.Store(lastUsed)
+	if err != nil || result.ExitCode != 0 {
+		return ""
+	}
+	return strings.TrimSpace(result.Output)
+}
+
+// SessionsToolSchema defines the schema for bash_sessions input
+var SessionsToolSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"sort": map[string]interface{}{
+			"type": "string",
+			"enum": collate.Modes,
+			"description": "Order of the locks list by path: natural (default; case-insensitive, with numbers " +
+				"compared by value so file2 comes before file10), text (case-insensitive), or ordinal (bytes)",
+		},
+	},
+}
+
+// ParseSessionsArgs parses arguments for the bash_sessions tool, returning
+// the order to list locks in
+func ParseSessionsArgs(args json.RawMessage) (collate.Mode, error) {
+	var params struct {
+		Sort string `json:"sort"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &params); err != nil {
+			return "", fmt.Errorf("invalid arguments for bash_sessions tool: %w", err)
+		}
+	}
+	return collate.ParseMode(params.Sort)
+}
+
+// SessionID returns the id of the current session, or 0 if there is none
+func (bm *BashManager) SessionID() int {
+	if session := bm.current.Load(); session != nil && !session.stopped.Load() {
+		return session.id
+	}
+	return 0
+}
@@ -0,0 +1,35 @@
+package bash
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultShell is the shell sessions run when none is configured
+const DefaultShell = "bash"
+
+// FindShell resolves a configured shell to an executable path. A name
+// without a slash is looked up on PATH. The error says where it looked.
+func FindShell(shell string) (string, error) {
+	path, err := exec.LookPath(shell)
+	if err == nil {
+		return path, nil
+	}
+	if strings.ContainsRune(shell, filepath.Separator) {
+		return "", fmt.Errorf("shell %s not found or not executable: %v", shell, err)
+	}
+	dirs := filepath.SplitList(os.Getenv("PATH"))
+	if len(dirs) == 0 {
+		return "", fmt.Errorf("shell %q not found: PATH is empty", shell)
+	}
+	return "", fmt.Errorf("shell %q not found on PATH (searched %s)", shell, strings.Join(dirs, ", "))
+}
+
+// shellCommand returns a command that runs the shell with its configured
+// arguments followed by args
+func (bm *BashManager) shellCommand(args ...string) *exec.Cmd {
+	return exec.Command(bm.shell, append(append([]string(nil), bm.shellArgs...), args...)...)
+}
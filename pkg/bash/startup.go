@@ -0,0 +1,94 @@
+package bash
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// startupTimeout bounds a session's profile and rcFile. Login profiles that
+// initialise version managers (pyenv, nvm) can take a few seconds.
+const startupTimeout = 30 * time.Second
+
+// sessionArgs returns the arguments a new session's shell is started with
+// after the configured shell arguments
+func (bm *BashManager) sessionArgs() []string {
+	if bm.loginShell {
+		return []string{"-l"}
+	}
+	return nil
+}
+
+// runStartup sources the rcFile, if any, and drains whatever the profile and
+// rcFile print, so it doesn't end up in the first command's response. Runs
+// only for login shells or with an rcFile. A non-zero rcFile status is
+// reported with the session's first command.
+func (bs *BashSession) runStartup(loginShell bool, rcFile string) error {
+	if !loginShell && rcFile == "" {
+		return nil
+	}
+
+	command := ":"
+	if rcFile != "" {
+		command = ". " + shellQuote(rcFile)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), startupTimeout)
+	defer cancel()
+	result, err := bs.execute(command, ctx, executeLimits{total: startupTimeout})
+	bs.lastCommand.Store(0) // startup is not a client command
+	if err != nil {
+		return fmt.Errorf("shell startup failed: %w", err)
+	}
+	if result.Output != "" {
+		fmt.Fprintf(os.Stderr, "Discarded %d bytes of shell startup output\n", len(result.Output))
+	}
+	if rcFile != "" && result.ExitCode != 0 {
+		bs.warnings = append(bs.warnings, fmt.Sprintf("Warning: rcFile %s exited with status %d when the session "+
+			"started; some of it may not have taken effect", rcFile, result.ExitCode))
+	}
+	return nil
+}
+
+// runStartupCommands runs each configured startup command in the session,
+// after the profile and rcFile, logging the command and its output. A command
+// exiting non-zero fails session creation with its output, or with lenient
+// set only adds a warning to the session's first command.
+func (bs *BashSession) runStartupCommands(commands []string, lenient bool) error {
+	for i, command := range commands {
+		fmt.Fprintf(os.Stderr, "Startup command %d: %s\n", i+1, command)
+		ctx, cancel := context.WithTimeout(context.Background(), startupTimeout)
+		result, err := bs.execute(command, ctx, executeLimits{total: startupTimeout})
+		cancel()
+		bs.lastCommand.Store(0) // startup is not a client command
+		if err != nil {
+			return fmt.Errorf("startup command %q failed: %w", command, err)
+		}
+		output := withoutExitLine(result)
+		if output != "" {
+			fmt.Fprintf(os.Stderr, "Startup command %d output:\n%s\n", i+1, output)
+		}
+		if result.ExitCode == 0 {
+			continue
+		}
+		if !lenient {
+			if output == "" {
+				return fmt.Errorf("startup command %q exited with status %d", command, result.ExitCode)
+			}
+			return fmt.Errorf("startup command %q exited with status %d:\n%s", command, result.ExitCode, output)
+		}
+		bs.warnings = append(bs.warnings, fmt.Sprintf("Warning: startup command %q exited with status %d "+
+			"when the session started", command, result.ExitCode))
+	}
+	return nil
+}
+
+// withoutExitLine returns a result's output without the "[Exit code: N]" line
+// the session adds for a non-zero status
+func withoutExitLine(result CommandResult) string {
+	line := fmt.Sprintf("\n[Exit code: %d]", result.ExitCode)
+	output := strings.Replace("\n"+result.Output, "\n"+line, "", 1)
+	return strings.TrimSpace(strings.Replace(output, line, "", 1))
+}
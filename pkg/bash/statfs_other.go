@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd)
+
+package bash
+
+import "errors"
+
+// statfs is unsupported on this platform; disk space checks are skipped.
+func statfs(path string) (DiskUsage, error) {
+	return DiskUsage{}, errors.New("disk space check not supported on this platform")
+}
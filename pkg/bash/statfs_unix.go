@@ -0,0 +1,18 @@
+//go:build linux || darwin || freebsd
+
+package bash
+
+import "syscall"
+
+// statfs reports free and total space for the filesystem containing path.
+func statfs(path string) (DiskUsage, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return DiskUsage{}, err
+	}
+	bsize := uint64(st.Bsize)
+	return DiskUsage{
+		Free:  uint64(st.Bavail) * bsize,
+		Total: uint64(st.Blocks) * bsize,
+	}, nil
+}
@@ -0,0 +1,44 @@
+package bash
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/perms"
+)
+
+// MaxStdinSize is the largest stdin payload accepted by the bash tool.
+const MaxStdinSize = 16 * 1024 * 1024 // 16MB
+
+// WithStdin wraps command so its standard input is exactly stdin. The
+// payload is written to a private temp file and redirected in, so no
+// delimiter or quoting can collide with it and it arrives byte for byte
+// (no trailing newline is added). The wrapper is a brace group, so session
+// state changes made by command still persist.
+//
+// The returned cleanup removes the temp file and must be called once the
+// command has finished.
+func (bm *BashManager) WithStdin(command, stdin string) (string, func(), error) {
+	file, err := perms.CreateTemp("", "mcp-bash-stdin-*")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create stdin file: %w", err)
+	}
+	path := file.Name()
+	cleanup := func() { os.Remove(path) }
+
+	if _, err := file.WriteString(stdin); err != nil {
+		file.Close()
+		cleanup()
+		return "", nil, fmt.Errorf("failed to write stdin file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to write stdin file: %w", err)
+	}
+	if err := bm.giveToSession(path); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+
+	return fmt.Sprintf("{ %s\n} < %s", command, shellQuote(path)), cleanup, nil
+}
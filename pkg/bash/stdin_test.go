@@ -0,0 +1,59 @@
+package bash
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWithStdinByteForByte(t *testing.T) {
+	bm := newTestManager(t, Options{})
+
+	payload := "line one\n'quoted' $(not run) EOF\nno trailing newline"
+	command, cleanup, err := bm.WithStdin("wc -c; cd /tmp", payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := run(t, bm, command)
+	cleanup()
+	if want := strconv.Itoa(len(payload)); strings.TrimSpace(result.Output) != want {
+		t.Errorf("command read %q bytes, want %s", result.Output, want)
+	}
+
+	// The wrapper keeps session state changes
+	if result := run(t, bm, "pwd"); result.Output != "/tmp" {
+		t.Errorf("pwd = %q, want /tmp", result.Output)
+	}
+}
+
+func TestWithStdinContent(t *testing.T) {
+	bm := newTestManager(t, Options{})
+
+	payload := "a\tb\n$HOME\n"
+	command, cleanup, err := bm.WithStdin("cat", payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := run(t, bm, command); result.Output != strings.TrimRight(payload, "\n") {
+		t.Errorf("output = %q, want %q", result.Output, payload)
+	}
+
+	path := command[strings.LastIndex(command, "< '")+3 : len(command)-1]
+	cleanup()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("stdin file %s left behind: %v", path, err)
+	}
+}
+
+func TestParseBashArgsStdinLimit(t *testing.T) {
+	args, _ := json.Marshal(map[string]interface{}{"command": "cat", "stdin": strings.Repeat("x", MaxStdinSize+1)})
+	if _, err := ParseBashArgs(args); err == nil {
+		t.Errorf("oversized stdin accepted")
+	}
+	args, _ = json.Marshal(map[string]interface{}{"command": "cat", "stdin": "", "background": true})
+	if _, err := ParseBashArgs(args); err == nil {
+		t.Errorf("stdin accepted for a background job")
+	}
+}
@@ -0,0 +1,165 @@
+package bash
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/perms"
+)
+
+// syntaxCheckTimeout bounds a syntax check; parsing never takes long, but a
+// script could be huge
+const syntaxCheckTimeout = 10 * time.Second
+
+// syntaxShells are the interpreters whose syntax can be checked with -n
+var syntaxShells = []string{"bash", "sh", "dash", "zsh", "ksh", "mksh"}
+
+// syntaxErrorLine matches one line of a shell's -n output, after the script
+// path: "line 3: syntax error near unexpected token `fi'"
+var syntaxErrorLine = regexp.MustCompile(`^(?:line )?(\d+): (.*)$`)
+
+// SyntaxError is one problem a shell's parser reported
+type SyntaxError struct {
+	Line    int    `json:"line,omitempty"` // 0 if the shell didn't say
+	Message string `json:"message"`
+	Source  string `json:"source,omitempty"` // the offending source line, if the shell echoed it
+}
+
+// SyntaxResult is the outcome of a syntax check
+type SyntaxResult struct {
+	Shell  string        // the interpreter that parsed the script
+	Errors []SyntaxError // empty if the script parses
+}
+
+// OK reports whether the script parsed
+func (r *SyntaxResult) OK() bool {
+	return len(r.Errors) == 0
+}
+
+// Text describes the result for a client: "syntax OK", or each error with
+// its line number
+func (r *SyntaxResult) Text() string {
+	if r.OK() {
+		return "syntax OK"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Syntax error (%s -n):", r.Shell)
+	for _, e := range r.Errors {
+		if e.Line > 0 {
+			fmt.Fprintf(&b, "\nline %d: %s", e.Line, e.Message)
+		} else {
+			fmt.Fprintf(&b, "\n%s", e.Message)
+		}
+		if e.Source != "" {
+			fmt.Fprintf(&b, "\n    %s", e.Source)
+		}
+	}
+	return b.String()
+}
+
+// CheckSyntax parses a command with the configured shell's -n option
+// without running any of it
+func (bm *BashManager) CheckSyntax(command string) (*SyntaxResult, error) {
+	return checkSyntax(command, bm.shell)
+}
+
+// CheckScriptSyntax parses a bash_script script with the -n option of the
+// interpreter it would run under, which must be a shell
+func (bm *BashManager) CheckScriptSyntax(args ScriptArgs) (*SyntaxResult, error) {
+	interpreter := bm.scriptInterpreter(args)
+	// #!/usr/bin/env bash names the shell as env's argument
+	if filepath.Base(interpreter[0]) == "env" && len(interpreter) > 1 {
+		if fields := strings.Fields(interpreter[1]); len(fields) > 0 && !strings.HasPrefix(fields[0], "-") {
+			return checkSyntax(args.Script, fields[0])
+		}
+	}
+	return checkSyntax(args.Script, interpreter[0])
+}
+
+// checkSyntax runs shell -n on script in a process of its own, so the
+// session is neither used nor changed. The script is written to a temp file
+// first, so multi-line scripts with here-documents and functions are parsed
+// exactly as they would run.
+func checkSyntax(script, shell string) (*SyntaxResult, error) {
+	name := filepath.Base(shell)
+	if !slices.Contains(syntaxShells, name) {
+		return nil, fmt.Errorf("only shell scripts can be validated; this one runs under %s", shell)
+	}
+
+	file, err := perms.CreateTemp("", "mcp-bash-syntax-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create script file: %w", err)
+	}
+	path := file.Name()
+	defer os.Remove(path)
+	if _, err := file.WriteString(script); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write script file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write script file: %w", err)
+	}
+
+	// extglob changes what parses, and scripts often turn it on as they
+	// run, which -n never does
+	args := []string{"-n"}
+	if name == "bash" {
+		args = append(args, "-O", "extglob")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), syntaxCheckTimeout)
+	defer cancel()
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, shell, append(args, path)...)
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("syntax check timed out after %v", syntaxCheckTimeout)
+	}
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return nil, fmt.Errorf("failed to run %s -n: %w", shell, err)
+	}
+
+	result := &SyntaxResult{Shell: name}
+	for _, line := range strings.Split(strings.TrimSpace(stderr.String()), "\n") {
+		// Messages start with the script's path, which means nothing to
+		// the client
+		if rest, ok := strings.CutPrefix(line, path+": "); ok {
+			line = rest
+		} else if rest, ok := strings.CutPrefix(line, path+":"); ok {
+			line = rest
+		}
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		entry := SyntaxError{Message: line}
+		if match := syntaxErrorLine.FindStringSubmatch(line); match != nil {
+			entry.Line, _ = strconv.Atoi(match[1])
+			entry.Message = match[2]
+		}
+		// bash follows "syntax error near unexpected token" with the
+		// line it was on, quoted: "line 3: `if then'". That is context
+		// for the error before it, not another error.
+		if n := len(result.Errors); n > 0 && result.Errors[n-1].Line == entry.Line &&
+			result.Errors[n-1].Source == "" && len(entry.Message) > 1 &&
+			strings.HasPrefix(entry.Message, "`") && strings.HasSuffix(entry.Message, "'") {
+			result.Errors[n-1].Source = entry.Message[1 : len(entry.Message)-1]
+			continue
+		}
+		result.Errors = append(result.Errors, entry)
+	}
+	if err != nil && len(result.Errors) == 0 {
+		result.Errors = []SyntaxError{{Message: fmt.Sprintf("%s -n exited with code %d", name, exitErr.ExitCode())}}
+	}
+	return result, nil
+}
@@ -0,0 +1,305 @@
+package bash
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// placeholderPattern matches a {{name}} placeholder in a command template
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// templateVarPrefix starts the names of the shell variables that carry
+// template values, keeping them apart from the template's own variables
+const templateVarPrefix = "__mcp_param_"
+
+// CommandTemplate is a command with {{name}} placeholders for values
+// supplied when it runs
+type CommandTemplate struct {
+	parts  []string // literal text, with a placeholder name between each pair
+	quoted []bool   // for each placeholder, whether it is inside double quotes or a here-document
+}
+
+// ParseCommandTemplate parses a command template. A placeholder may be a
+// word of its own, part of one, or inside double quotes or a here-document;
+// inside single quotes it would never be replaced, so that is an error. In
+// an arithmetic context bash evaluates a value as an expression, running any
+// command substitution in an array subscript, so only the placeholders named
+// in numeric, whose values are checked to be numbers, may stand there.
+func ParseCommandTemplate(command string, numeric []string) (*CommandTemplate, error) {
+	if strings.TrimSpace(command) == "" {
+		return nil, fmt.Errorf("command template is empty")
+	}
+
+	template := &CommandTemplate{}
+	last := 0
+	state := quoteStates(command)
+	arithmetic := arithmeticStates(command, state)
+	for _, match := range placeholderPattern.FindAllStringSubmatchIndex(command, -1) {
+		start, end := match[0], match[1]
+		name := command[match[2]:match[3]]
+		if state[start] == '\'' {
+			return nil, fmt.Errorf("placeholder {{%s}} is inside single quotes or a quoted "+
+				"here-document, where it can't be replaced", name)
+		}
+		if arithmetic[start] && !slices.Contains(numeric, name) {
+			return nil, fmt.Errorf("placeholder {{%s}} is in an arithmetic context ($((...)), ((...)), let, "+
+				"a [[ ]] comparison or a subscript), where its value would be evaluated as an expression; "+
+				"only integer and number parameters may be used there", name)
+		}
+		template.parts = append(template.parts, command[last:start], name)
+		template.quoted = append(template.quoted, state[start] == '"')
+		last = end
+	}
+	template.parts = append(template.parts, command[last:])
+	if rest := strings.Join(template.parts, ""); strings.Contains(rest, "{{") {
+		return nil, fmt.Errorf("command template has a malformed placeholder")
+	}
+	return template, nil
+}
+
+// quoteStates returns, for each byte of command, the quote it is inside:
+// ', ", or 0 for none. The body of a here-document counts as inside double
+// quotes, since it is expanded the same way, or as inside single quotes if
+// its delimiter is quoted.
+func quoteStates(command string) []byte {
+	states := make([]byte, len(command))
+	var quote byte
+	var heredocs []heredoc
+	for i := 0; i < len(command); i++ {
+		states[i] = quote
+		c := command[i]
+		switch {
+		case c == '\\' && quote != '\'':
+			if i+1 < len(command) {
+				states[i+1] = quote
+			}
+			i++
+		case quote == 0 && (c == '\'' || c == '"'):
+			quote = c
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && strings.HasPrefix(command[i:], "<<") && !strings.HasPrefix(command[i:], "<<<"):
+			doc, end := parseHeredoc(command, i)
+			heredocs = append(heredocs, doc)
+			i = end - 1
+		case quote == 0 && c == '\n' && len(heredocs) > 0:
+			// Bodies follow the line their operators are on, in order
+			end := i
+			for _, doc := range heredocs {
+				end = skipHeredocBody(command, end+1, doc, states)
+			}
+			heredocs = nil
+			i = end - 1
+		}
+	}
+	return states
+}
+
+// arithmeticComparison matches the [[ ]] operators whose operands bash
+// evaluates as arithmetic expressions
+var arithmeticComparison = regexp.MustCompile(`\s-(eq|ne|lt|le|gt|ge)\s`)
+
+// arithmeticStates returns, for each byte of command, whether it is inside
+// an arithmetic context: $((...)) or $[...] anywhere they are expanded, the
+// subscript or offset of a ${name[...]} or ${name:...} expansion, and, outside
+// quotes, an ((...)) command or for loop, the arguments of let, and a [[ ]]
+// test that compares numbers. quotes are command's quoteStates. It errs on
+// the side of finding one: a word "let" is taken for the builtin anywhere.
+func arithmeticStates(command string, quotes []byte) []bool {
+	states := make([]bool, len(command))
+	mark := func(start, end int) {
+		for j := start; j < end; j++ {
+			states[j] = true
+		}
+	}
+	for i := 0; i < len(command); i++ {
+		if quotes[i] == '\'' {
+			continue
+		}
+		rest := command[i:]
+		switch {
+		case strings.HasPrefix(rest, "$(("):
+			mark(i, matching(command, i+1, '(', ')'))
+		case strings.HasPrefix(rest, "$["):
+			mark(i, matching(command, i+1, '[', ']'))
+		case strings.HasPrefix(rest, "${"):
+			end := matching(command, i+1, '{', '}')
+			j := i + 2
+			for j < end && (isNameByte(command[j]) || command[j] == '#') {
+				j++
+			}
+			if j < end && command[j] == '[' {
+				subscript := matching(command, j, '[', ']')
+				mark(j, subscript)
+				j = subscript
+			}
+			if j+1 < end && command[j] == ':' && strings.IndexByte("-=+?", command[j+1]) < 0 {
+				mark(j, end)
+			}
+		case quotes[i] != 0 || (i > 0 && !wordBoundary(command[i-1])):
+			// Only a new word, outside quotes, can start the rest
+		case strings.HasPrefix(rest, "(("):
+			mark(i, matching(command, i, '(', ')'))
+		case strings.HasPrefix(rest, "let ") || strings.HasPrefix(rest, "let\t"):
+			end := i
+			for end < len(command) && (quotes[end] != 0 || strings.IndexByte(";&|\n)", command[end]) < 0) {
+				end++
+			}
+			mark(i, end)
+		case strings.HasPrefix(rest, "[["):
+			end := i + len(rest)
+			if close := strings.Index(rest, "]]"); close >= 0 {
+				end = i + close
+			}
+			if arithmeticComparison.MatchString(command[i:end]) {
+				mark(i, end)
+			}
+		}
+	}
+	return states
+}
+
+// matching returns the offset just past the close that balances the open
+// at command[start], or len(command) if there is none
+func matching(command string, start int, open, close byte) int {
+	depth := 0
+	for j := start; j < len(command); j++ {
+		switch command[j] {
+		case open:
+			depth++
+		case close:
+			if depth--; depth == 0 {
+				return j + 1
+			}
+		}
+	}
+	return len(command)
+}
+
+// wordBoundary reports whether a word can start after c
+func wordBoundary(c byte) bool {
+	return strings.IndexByte(" \t\n;&|(!{", c) >= 0
+}
+
+// isNameByte reports whether c can be part of a shell variable name
+func isNameByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// heredoc is a here-document operator's delimiter
+type heredoc struct {
+	delimiter string
+	quoted    bool // the body is not expanded
+	stripTabs bool // <<-
+}
+
+// parseHeredoc reads the operator at command[start:] and its delimiter word,
+// returning the offset after them
+func parseHeredoc(command string, start int) (heredoc, int) {
+	i := start + 2
+	var doc heredoc
+	if i < len(command) && command[i] == '-' {
+		doc.stripTabs = true
+		i++
+	}
+	for i < len(command) && (command[i] == ' ' || command[i] == '\t') {
+		i++
+	}
+	var word strings.Builder
+	for ; i < len(command) && strings.IndexByte(" \t\n;&|<>()", command[i]) < 0; i++ {
+		switch c := command[i]; c {
+		case '\'', '"':
+			doc.quoted = true
+			for i++; i < len(command) && command[i] != c; i++ {
+				word.WriteByte(command[i])
+			}
+		case '\\':
+			doc.quoted = true
+			if i+1 < len(command) {
+				i++
+				word.WriteByte(command[i])
+			}
+		default:
+			word.WriteByte(c)
+		}
+	}
+	doc.delimiter = word.String()
+	return doc, i
+}
+
+// skipHeredocBody marks the body of a here-document starting at offset
+// start, up to its delimiter line, and returns the offset of the newline
+// ending that line
+func skipHeredocBody(command string, start int, doc heredoc, states []byte) int {
+	state := byte('"')
+	if doc.quoted {
+		state = '\''
+	}
+	i := start
+	for i < len(command) {
+		end := strings.IndexByte(command[i:], '\n')
+		if end < 0 {
+			end = len(command)
+		} else {
+			end += i
+		}
+		line := command[i:end]
+		if doc.stripTabs {
+			line = strings.TrimLeft(line, "\t")
+		}
+		if line == doc.delimiter {
+			return end
+		}
+		for j := i; j < end; j++ {
+			states[j] = state
+		}
+		i = end + 1
+	}
+	return len(command)
+}
+
+// Placeholders returns the names of the template's placeholders, sorted,
+// without repeats
+func (t *CommandTemplate) Placeholders() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for i := 1; i < len(t.parts); i += 2 {
+		if !seen[t.parts[i]] {
+			seen[t.parts[i]] = true
+			names = append(names, t.parts[i])
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Render returns the command to run for the given values, in a subshell so
+// the session is left as it was. Values never become part of the command's
+// text: each is assigned, single-quoted, to a shell variable, and its
+// placeholder replaced by a quoted expansion of that variable, which bash
+// never parses again. So no value can end its quoting, wherever its
+// placeholder stands. A placeholder without a value expands to "".
+func (t *CommandTemplate) Render(values map[string]string) string {
+	var b strings.Builder
+	b.WriteString("(")
+	for _, name := range t.Placeholders() {
+		fmt.Fprintf(&b, "%s%s=%s\n", templateVarPrefix, name, shellQuote(values[name]))
+	}
+	for i, part := range t.parts {
+		if i%2 == 0 {
+			b.WriteString(part)
+			continue
+		}
+		// Already inside double quotes, the expansion needs none of its own
+		if t.quoted[i/2] {
+			fmt.Fprintf(&b, "${%s%s}", templateVarPrefix, part)
+		} else {
+			fmt.Fprintf(&b, `"${%s%s}"`, templateVarPrefix, part)
+		}
+	}
+	b.WriteString("\n)")
+	return b.String()
+}
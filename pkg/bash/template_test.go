@@ -0,0 +1,92 @@
+package bash
+
+import (
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseCommandTemplate(t *testing.T) {
+	tests := []struct {
+		command string
+		numeric []string
+		want    []string // placeholders, or nil for an error
+	}{
+		{"echo {{a}} {{b}} {{a}}", nil, []string{"a", "b"}},
+		{`grep -r "{{ pattern }}" .`, nil, []string{"pattern"}},
+		{"cat <<EOF\n{{body}}\nEOF", nil, []string{"body"}},
+		{"echo '{{a}}'", nil, nil},
+		{"cat <<'EOF'\n{{body}}\nEOF", nil, nil},
+		{"echo {{a}", nil, nil},
+		{"   ", nil, nil},
+
+		// Arithmetic contexts take only numeric placeholders
+		{"echo $(( {{n}} + 1 ))", nil, nil},
+		{"echo $(( {{n}} + 1 ))", []string{"n"}, []string{"n"}},
+		{`echo "$(( {{n}} * 2 ))"`, nil, nil},
+		{"echo $[{{n}}+1]", nil, nil},
+		{"(( {{n}} > 3 )) && echo big", nil, nil},
+		{"for ((i = 0; i < {{n}}; i++)); do :; done", nil, nil},
+		{"let x={{n}}+1", nil, nil},
+		{"true && let x={{n}}", nil, nil},
+		{"[[ {{n}} -gt 3 ]]", nil, nil},
+		{"[[ {{n}} -gt 3 ]]", []string{"n"}, []string{"n"}},
+		{"echo ${arr[{{i}}]}", nil, nil},
+		{"echo ${s:{{offset}}:2}", nil, nil},
+		{"echo ${a[0]:-{{fallback}}}", nil, []string{"fallback"}},
+		{"echo ${name:-{{fallback}}}", nil, []string{"fallback"}},
+		{`[[ {{s}} == x* ]] && echo match`, nil, []string{"s"}},
+		{`echo "let {{s}}" outlet {{t}}`, nil, []string{"s", "t"}},
+		{`echo '$(( {{n}} ))'`, nil, nil},
+	}
+	for _, tt := range tests {
+		template, err := ParseCommandTemplate(tt.command, tt.numeric)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("ParseCommandTemplate(%q) succeeded, want an error", tt.command)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseCommandTemplate(%q) failed: %v", tt.command, err)
+			continue
+		}
+		if got := template.Placeholders(); !slices.Equal(got, tt.want) {
+			t.Errorf("ParseCommandTemplate(%q) placeholders = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestRenderKeepsValuesQuoted(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not installed")
+	}
+	hostile := `a'b"c $(echo injected) ` + "`echo injected`" + ` ; echo injected \`
+	tests := []struct {
+		command string
+		values  map[string]string
+		want    string
+	}{
+		{"printf '%s\\n' {{v}}", map[string]string{"v": hostile}, hostile},
+		{`printf '%s\n' "x{{v}}y"`, map[string]string{"v": hostile}, "x" + hostile + "y"},
+		{"cat <<EOF\n{{v}}\nEOF", map[string]string{"v": hostile}, hostile},
+		{"printf '%s\\n' {{missing}}", nil, ""},
+		{"echo $(( {{n}} * 2 ))", map[string]string{"n": "21"}, "42"},
+		{"x=outer; (x=inner); printf '%s\\n' {{v}} $x", map[string]string{"v": "v"}, "v\nouter"},
+	}
+	for _, tt := range tests {
+		template, err := ParseCommandTemplate(tt.command, []string{"n"})
+		if err != nil {
+			t.Fatalf("ParseCommandTemplate(%q) failed: %v", tt.command, err)
+		}
+		out, err := exec.Command("bash", "-c", template.Render(tt.values)).CombinedOutput()
+		if err != nil {
+			t.Errorf("%q failed: %v\n%s", tt.command, err, out)
+			continue
+		}
+		if got := strings.TrimSuffix(string(out), "\n"); got != tt.want {
+			t.Errorf("%q rendered with %q printed %q, want %q", tt.command, tt.values, got, tt.want)
+		}
+	}
+}
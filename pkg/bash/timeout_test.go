@@ -0,0 +1,57 @@
+package bash
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDescribeTimeout(t *testing.T) {
+	total := NewBashManager(Options{Timeout: 30 * time.Second, MaxTimeout: 60 * time.Second})
+	idle := NewBashManager(Options{Timeout: 30 * time.Second, MaxTimeout: 60 * time.Second,
+		TimeoutMode: TimeoutModeIdle, MaxTotal: time.Hour})
+	t.Cleanup(total.Close)
+	t.Cleanup(idle.Close)
+
+	tests := []struct {
+		bm        *BashManager
+		requested time.Duration
+		want      TimeoutInfo
+	}{
+		{total, 0, TimeoutInfo{Seconds: 30, Source: "default", Mode: TimeoutModeTotal}},
+		{total, 45 * time.Second, TimeoutInfo{Seconds: 45, Source: "request", Mode: TimeoutModeTotal}},
+		{total, 5 * time.Second, TimeoutInfo{Seconds: 5, Source: "request", Mode: TimeoutModeTotal}},
+		{total, 90 * time.Second, TimeoutInfo{Seconds: 60, Source: "cap", Mode: TimeoutModeTotal}},
+		{idle, 0, TimeoutInfo{Seconds: 30, Source: "default", Mode: TimeoutModeIdle, MaxTotalSeconds: 3600}},
+		{idle, 90 * time.Second, TimeoutInfo{Seconds: 60, Source: "cap", Mode: TimeoutModeIdle, MaxTotalSeconds: 3600}},
+	}
+	for _, tt := range tests {
+		if got := tt.bm.DescribeTimeout(tt.requested); got != tt.want {
+			t.Errorf("DescribeTimeout(%v) in %s mode = %+v, want %+v", tt.requested, tt.bm.timeoutMode, got, tt.want)
+		}
+	}
+}
+
+func TestTimedOutNamesTheLimit(t *testing.T) {
+	tests := []struct {
+		opts    Options
+		command string
+		want    string
+	}{
+		{Options{Timeout: time.Second}, "sleep 10", "total"},
+		{Options{Timeout: time.Second, TimeoutMode: TimeoutModeIdle, MaxTotal: 10 * time.Second}, "sleep 10", "idle"},
+		{Options{Timeout: time.Second, TimeoutMode: TimeoutModeIdle, MaxTotal: 2 * time.Second},
+			"while :; do echo tick; sleep 0.2; done", "total"},
+		{Options{Timeout: 5 * time.Second}, "true", ""},
+	}
+	for _, tt := range tests {
+		bm := newTestManager(t, tt.opts)
+		result, err := bm.ExecuteCommand(tt.command)
+		if (tt.want != "") != errors.Is(err, ErrCommandTimedOut) {
+			t.Errorf("%q in %s mode: err = %v", tt.command, bm.timeoutMode, err)
+		}
+		if result.TimedOut != tt.want {
+			t.Errorf("%q in %s mode: TimedOut = %q, want %q", tt.command, bm.timeoutMode, result.TimedOut, tt.want)
+		}
+	}
+}
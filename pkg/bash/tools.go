@@ -0,0 +1,613 @@
+package bash
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/mcp"
+)
+
+// Tool schemas
+
+// BashToolSchema defines the schema for bash_tool input
+var BashToolSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"command": map[string]interface{}{
+			"type":        "string",
+			"description": "The bash command to execute",
+		},
+		"restart": map[string]interface{}{
+			"type":        "boolean",
+			"description": "Set to true to restart the bash session before executing the command",
+		},
+		"working_directory": map[string]interface{}{
+			"type": "string",
+			"description": "Run the command in this directory, in a subshell, without changing the session's " +
+				"working directory. Relative paths are resolved against the session's current directory",
+		},
+		"env": map[string]interface{}{
+			"type": "object",
+			"description": "Environment variables for this command only (name to value). The command runs in a " +
+				"subshell, so the variables are not left behind in the session",
+			"additionalProperties": map[string]interface{}{"type": "string"},
+		},
+		"stdin": map[string]interface{}{
+			"type": "string",
+			"description": "Data to pass to the command on standard input, exactly as given (e.g. for \"python3 -\" " +
+				"or \"psql -f -\"). Without it, commands run in the session read an empty stdin",
+		},
+		"use_secret": map[string]interface{}{
+			"type": "object",
+			"description": "Secrets held by the server to expose to this command, as secret name -> environment " +
+				"variable name. Values are never shown: they are redacted from all output",
+			"additionalProperties": map[string]interface{}{"type": "string"},
+		},
+		"encoding": map[string]interface{}{
+			"type": "string",
+			"enum": []string{EncodingText, EncodingBase64},
+			"description": "How stdout is returned: text (default) or base64, byte for byte, for binary output " +
+				"such as images or archives. Base64 output is returned as an image or embedded resource with a " +
+				"detected MIME type",
+		},
+		"strip_ansi": map[string]interface{}{
+			"type": "boolean",
+			"description": "Remove ANSI color and cursor sequences from the output and collapse redrawn progress " +
+				"lines to their final state. Defaults to the server's setting",
+		},
+		"quiet": map[string]interface{}{
+			"type": "boolean",
+			"description": "Return an empty result when the command succeeds with no output, instead of the " +
+				"server's placeholder text",
+		},
+		"pty": map[string]interface{}{
+			"type": "boolean",
+			"description": "Run the command on a pseudo-terminal, for tools that behave differently or refuse to " +
+				"run when not attached to a terminal. stdout and stderr are merged, and the output may contain " +
+				"terminal control characters, so leave this off unless needed",
+		},
+		"noNetwork": map[string]interface{}{
+			"type": "boolean",
+			"description": "Run the command with no network access (Linux network namespace). Fails if the host " +
+				"can't isolate commands. Only exported variables are visible and session state changes don't persist",
+		},
+		"timeout": map[string]interface{}{
+			"type":        "integer",
+			"description": "Timeout for this command in seconds, overriding the default. Capped by the server's maxTimeout",
+		},
+		"weight": map[string]interface{}{
+			"type":    "integer",
+			"minimum": 0,
+			"description": "How heavy the command is (e.g. a large build or install), in units of the server's " +
+				"admission budget. Heavy commands wait for units before running, so parallel ones can't exhaust " +
+				"the host. Overrides the server's own classification; 0 marks the command light. Ignored unless " +
+				"the server has an admission budget",
+		},
+		"bypassSession": map[string]interface{}{
+			"type": "boolean",
+			"description": "Run the command in a separate one-shot bash process instead of the persistent session, " +
+				"with a short timeout. Use for quick diagnostics (ps, kill) when the session is busy or stuck. " +
+				"No session state is used or changed",
+		},
+		"background": map[string]interface{}{
+			"type": "boolean",
+			"description": "Start the command as a background job and return its job id and PID at once, for " +
+				"long builds or servers. It runs in its own shell, in the session's working directory but without " +
+				"variables or functions defined in the session, and has no timeout. Poll it with bash_job_status " +
+				"and bash_job_output, stop it with bash_job_kill",
+		},
+		"validate_only": map[string]interface{}{
+			"type": "boolean",
+			"description": "Only check that the command parses (bash -n), without running it or touching the " +
+				"session. Returns \"syntax OK\" or the parser's errors with line numbers. Other arguments are ignored",
+		},
+		"profilePipeline": map[string]interface{}{
+			"type": "boolean",
+			"description": "Time each stage of a simple pipeline (commands joined by |) and return their real, " +
+				"user and system times as structuredContent.pipelineTiming, to find the slow stage. Commands " +
+				"with lists, groups, substitutions or compound statements run unprofiled, with a warning",
+		},
+		"collectArtifacts": map[string]interface{}{
+			"type":  "array",
+			"items": map[string]interface{}{"type": "string"},
+			"description": "Glob patterns (e.g. \"dist/*.tar.gz\", \"coverage.html\") evaluated after the command " +
+				"completes, relative to the working directory. Matching files are returned as resource_link " +
+				"items to read with resources/read instead of being printed; patterns matching nothing are " +
+				"reported. At most 50 files and 64MB per call; links expire with stored output",
+		},
+	},
+	"required": []string{"command"},
+}
+
+// ServerStatsToolSchema defines the schema for server_stats input (no arguments)
+var ServerStatsToolSchema = map[string]interface{}{
+	"type":       "object",
+	"properties": map[string]interface{}{},
+}
+
+// SessionBudgetToolSchema defines the schema for session_budget input
+var SessionBudgetToolSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"reset": map[string]interface{}{
+			"type":        "boolean",
+			"description": "Reset the budget (requires reset_token)",
+		},
+		"reset_token": map[string]interface{}{
+			"type":        "string",
+			"description": "Operator-supplied token authorizing a reset",
+		},
+	},
+}
+
+// BashTool defines a tool exposed by the server. Annotations are mandatory:
+// ValidateTools rejects any tool registered without them.
+type BashTool struct {
+	Name        string
+	Description string
+	InputSchema map[string]interface{}
+	Annotations *mcp.ToolAnnotations
+}
+
+// BashToolDescription returns the bash tool description for the given
+// default command duration and per-call cap, so the advertised limits match
+// the config.
+func BashToolDescription(timeout, maxTimeout time.Duration) string {
+	return "Execute bash commands in a persistent session. Commands are executed in a stateful bash environment " +
+		"where environment variables, working directory changes, and other session state persist between calls. " +
+		fmt.Sprintf("Commands are stopped after %v by default; set 'timeout' (seconds) to change this for one call, "+
+			"up to a maximum of %v. ", timeout, maxTimeout) +
+		"Use 'restart: true' to start a fresh session if needed. " +
+		"Supports: pipelines, environment variables, cd commands, command chaining with && or ||, " +
+		"background processes, file I/O redirection, and most bash built-ins. " +
+		"Avoid: interactive commands (vim, less, top), commands requiring user input, sudo without NOPASSWD. " +
+		"A command that times out is interrupted as Ctrl-C would be and the session keeps its state. The session " +
+		"runs with job control and traps SIGINT for this (removing the trap makes the next timeout end the " +
+		"session); a shell-only loop, a slow $(...) or a program ignoring SIGINT is stopped by restarting the session."
+}
+
+// ValidateTools checks that every registered tool is well formed
+func ValidateTools() error {
+	if toolRegistryErr != nil {
+		return toolRegistryErr
+	}
+	var err error
+	BashTools.Each(func(name string, tool BashTool) {
+		if err == nil && tool.Annotations == nil {
+			err = fmt.Errorf("tool %q does not declare annotations", name)
+		}
+	})
+	return err
+}
+
+// BashTools holds the tool definitions in the order tools/list reports them
+var BashTools, toolRegistryErr = newToolRegistry([]BashTool{
+	{
+		Name:        "bash",
+		Description: BashToolDescription(600*time.Second, DefaultMaxTimeout),
+		InputSchema: BashToolSchema,
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Bash",
+			DestructiveHint: true,
+			OpenWorldHint:   true,
+		},
+	},
+	{
+		Name: "exec",
+		Description: "Run a program directly with an argument array, without a shell: nothing is expanded, " +
+			"split, or interpreted, so arguments with spaces or quotes need no escaping. Optional cwd, env, " +
+			"stdin, and timeout. Each call is an independent process; no session state is kept.",
+		InputSchema: ExecToolSchema,
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Execute program",
+			DestructiveHint: true,
+			OpenWorldHint:   true,
+		},
+	},
+	{
+		Name: "bash_script_buffer",
+		Description: "Assemble a large script across multiple calls and run it in the bash session. " +
+			"Use action 'append' to add content to a named buffer (repeat as needed), 'run' to execute the " +
+			"accumulated script and clear the buffer, 'abort' to discard it, or 'list' to see pending buffers " +
+			"and their sizes. Like bash_script, the script runs under its #! line, otherwise the configured " +
+			"shell, as a separate process in the session's working directory, so cd and variables inside it " +
+			"don't persist. " +
+			fmt.Sprintf("Each buffer is capped at %d bytes, all of them together at %d, and they are cleared "+
+				"when the session restarts.", MaxScriptBufferSize, MaxScriptBufferTotal),
+		InputSchema: ScriptBufferToolSchema,
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Bash script buffer",
+			DestructiveHint: true,
+			OpenWorldHint:   true,
+		},
+	},
+	{
+		Name: "bash_script",
+		Description: "Run a multi-line script in the bash session without escaping it into a command string. " +
+			"args are passed as $1..$n exactly as given. The script runs under interpreter if set, otherwise " +
+			"under its #! line, otherwise bash; it runs as a separate process in the session's working " +
+			"directory, so cd and variables inside it don't persist.",
+		InputSchema: ScriptToolSchema,
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Bash script",
+			DestructiveHint: true,
+			OpenWorldHint:   true,
+		},
+	},
+	{
+		Name: "bash_output",
+		Description: "Read the full output of a command whose result was truncated, one page at a time. " +
+			"Truncated results name an output_id; pass it with a byte offset (and optionally a limit) and " +
+			"continue from nextOffset until it is null. Stored output expires after a while and is dropped " +
+			"when the session restarts.",
+		InputSchema: OutputToolSchema,
+		Annotations: &mcp.ToolAnnotations{
+			Title:          "Read stored output",
+			ReadOnlyHint:   true,
+			IdempotentHint: true,
+		},
+	},
+	{
+		Name: "read_file",
+		Description: "Read a file directly, without the shell, as numbered lines (like cat -n). Use offset and " +
+			"limit to read a range of lines; files over the server's size limit can only be read in ranges, " +
+			"and a range that would return too much stops early with a nextOffset to continue from. Binary " +
+			"files are refused as text; read them with encoding base64.",
+		InputSchema: ReadFileToolSchema,
+		Annotations: &mcp.ToolAnnotations{
+			Title:          "Read file",
+			ReadOnlyHint:   true,
+			IdempotentHint: true,
+		},
+	},
+	{
+		Name: "write_file",
+		Description: "Write text to a file directly, without the shell, so backticks, $ and quotes in it are " +
+			"never interpreted (unlike cat <<EOF). mode create (default) fails if the file exists, overwrite " +
+			"replaces it atomically, and append adds to its end; create_dirs creates missing parent " +
+			"directories. Returns the number of bytes written. Use file_edit for targeted changes.",
+		InputSchema: WriteFileToolSchema,
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Write file",
+			DestructiveHint: true,
+		},
+	},
+	{
+		Name: "file_edit",
+		Description: "Make a targeted edit to a file without rewriting it. Operations: replace (exact text), " +
+			"replace_regex (with $1 capture templates), insert_after / insert_before a matching line, and " +
+			"delete_lines (inclusive range). The edit is refused if the number of matches differs from " +
+			"expected_count (default 1). Writes are atomic, file mode and CRLF line endings are preserved, " +
+			"and a unified diff of the change is returned.",
+		InputSchema: FileEditToolSchema,
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Edit file",
+			DestructiveHint: true,
+		},
+	},
+	{
+		Name: "fetch_artifact",
+		Description: "Download a file over https, verify it against an expected checksum (e.g. sha256:<hex>), " +
+			"and save it to a directory or extract it there (tar, tar.gz, tar.bz2, zip) in one step. The " +
+			"download is streamed through the hash and nothing is kept unless it matches. Returns the final " +
+			"URL after redirects, size, digest, and the number of files extracted. Use this instead of " +
+			"curl | tar so verification can't be skipped.",
+		InputSchema: FetchToolSchema,
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Fetch artifact",
+			DestructiveHint: true,
+			IdempotentHint:  true,
+			OpenWorldHint:   true,
+		},
+	},
+	{
+		Name: "acquire_lock",
+		Description: "Take an exclusive flock(2) lock on a file, the same lock external tools (flock, deploy " +
+			"scripts) respect, without tying up the bash session. Waits up to timeout seconds for a held " +
+			"lock; the error names who holds it and since when. Owner, time and purpose are written into " +
+			"the lock file. Locks are released with release_lock or when the session closes.",
+		InputSchema: LockToolSchema,
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Acquire lock",
+			DestructiveHint: true,
+		},
+	},
+	{
+		Name:        "release_lock",
+		Description: "Release a lock taken with acquire_lock.",
+		InputSchema: ReleaseLockToolSchema,
+		Annotations: &mcp.ToolAnnotations{
+			Title:          "Release lock",
+			IdempotentHint: true,
+		},
+	},
+	{
+		Name: "bash_sessions",
+		Description: "List the live bash sessions held by the server as JSON: id, pid, start time, uptime, " +
+			"when the last command started, whether a command is running, and the current working directory, " +
+			"plus the locks held through acquire_lock. " +
+			"otherSessions lists sessions of other servers on the host that share their activity: label, " +
+			"whether a command is running and since when, and the command if its owner shares it.",
+		InputSchema: SessionsToolSchema,
+		Annotations: &mcp.ToolAnnotations{
+			Title:          "Bash sessions",
+			ReadOnlyHint:   true,
+			IdempotentHint: true,
+		},
+	},
+	{
+		Name: "bash_history",
+		Description: "List the commands run recently as JSON, oldest first: when each finished, the tool and " +
+			"session it ran in, the command, its exit code (null if it was killed or cancelled), how long it " +
+			"took and how much output it produced. The history survives session restarts. Pass filter to " +
+			"list only commands containing some text.",
+		InputSchema: HistoryToolSchema,
+		Annotations: &mcp.ToolAnnotations{
+			Title:        "Command history",
+			ReadOnlyHint: true,
+		},
+	},
+	{
+		Name: "interrupt_session",
+		Description: "Send a signal (default SIGINT, as Ctrl-C would) to the command running in a bash session, " +
+			"e.g. to stop a deliberately open-ended command like tail -f and collect what it printed. The " +
+			"session survives and the command's own bash call completes with its output so far, marked as " +
+			"interrupted. Set wait to wait briefly for it to finish.",
+		InputSchema: InterruptToolSchema,
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Interrupt session",
+			DestructiveHint: true,
+		},
+	},
+	{
+		Name: "bash_job_status",
+		Description: "Report whether a background job (started with bash's background argument) is still " +
+			"running or has exited, with its exit code, and how much output it has written. Without a job " +
+			"id, lists the running jobs and the 32 most recently finished.",
+		InputSchema: JobStatusToolSchema,
+		Annotations: &mcp.ToolAnnotations{
+			Title:          "Background job status",
+			ReadOnlyHint:   true,
+			IdempotentHint: true,
+		},
+	},
+	{
+		Name: "bash_job_output",
+		Description: "Read a background job's output (stdout and stderr together). Each call returns what was " +
+			"written since the previous one; pass offset to read from elsewhere. nextOffset says where the " +
+			"next read starts.",
+		InputSchema: JobOutputToolSchema,
+		Annotations: &mcp.ToolAnnotations{
+			Title:        "Background job output",
+			ReadOnlyHint: true,
+		},
+	},
+	{
+		Name: "bash_job_kill",
+		Description: "Stop a background job and every process it started: SIGTERM, then SIGKILL if it is " +
+			"still running after a few seconds. Its output stays readable.",
+		InputSchema: JobKillToolSchema,
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Kill background job",
+			DestructiveHint: true,
+		},
+	},
+	{
+		Name: "events_poll",
+		Description: "Poll for server events instead of receiving notifications: session starts and closes, " +
+			"warnings, finished background jobs, and policy denials, oldest first. Pass the previous poll's " +
+			"lastSeq as ack to acknowledge what was handled. Events are buffered up to a limit; if older ones " +
+			"were dropped unacknowledged, an overflow event says how many.",
+		InputSchema: EventsPollToolSchema,
+		Annotations: &mcp.ToolAnnotations{
+			Title: "Poll server events",
+		},
+	},
+	{
+		Name: "server_stats",
+		Description: "Report server statistics as JSON: command latency percentiles (p50/p95/p99/max, in " +
+			"milliseconds) over recent commands, and how many commands exceeded the slow-command threshold.",
+		InputSchema: ServerStatsToolSchema,
+		Annotations: &mcp.ToolAnnotations{
+			Title:        "Server statistics",
+			ReadOnlyHint: true,
+		},
+	},
+	{
+		Name: "session_budget",
+		Description: "Report how much of the session's output budget remains. When the budget is exhausted, " +
+			"tool output is cut aggressively; an operator can reset it by supplying the configured reset token.",
+		InputSchema: SessionBudgetToolSchema,
+		Annotations: &mcp.ToolAnnotations{
+			Title:          "Session output budget",
+			IdempotentHint: true,
+		},
+	},
+})
+
+// shellTools are the tools that need bash
+var shellTools = []string{"bash", "bash_script_buffer", "bash_script", "bash_sessions", "interrupt_session", "bash_job_status",
+	"bash_job_output", "bash_job_kill"}
+
+// RemoveShellTools unregisters every tool that needs bash, for hosts without
+// a shell, leaving exec and the tools implemented in Go. Call before serving.
+func RemoveShellTools() {
+	for _, name := range shellTools {
+		BashTools.Remove(name)
+	}
+}
+
+// newToolRegistry registers tools by name, in order
+func newToolRegistry(tools []BashTool) (*mcp.Registry[BashTool], error) {
+	registry := mcp.NewRegistry[BashTool]()
+	for _, tool := range tools {
+		if err := registry.Add(tool.Name, tool); err != nil {
+			return registry, fmt.Errorf("tool %v", err)
+		}
+	}
+	return registry, nil
+}
+
+// Argument parsing
+
+// ParseSessionBudgetArgs parses arguments for the session_budget tool
+func ParseSessionBudgetArgs(args json.RawMessage) (reset bool, token string, err error) {
+	var params struct {
+		Reset      bool   `json:"reset"`
+		ResetToken string `json:"reset_token"`
+	}
+
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &params); err != nil {
+			return false, "", fmt.Errorf("invalid arguments for session_budget tool: %w", err)
+		}
+	}
+
+	return params.Reset, params.ResetToken, nil
+}
+
+// BashArgs holds the parsed arguments for the bash tool
+type BashArgs struct {
+	Command       string `json:"command"`
+	Restart       bool   `json:"restart"`
+	BypassSession bool   `json:"bypassSession"`
+	Timeout       int    `json:"timeout"` // seconds; 0 means the default
+
+	WorkingDirectory string            `json:"working_directory"`
+	Env              map[string]string `json:"env"`
+	NoNetwork        bool              `json:"noNetwork"`
+	Encoding         string            `json:"encoding"`   // EncodingText (default) or EncodingBase64
+	StripANSI        *bool             `json:"strip_ansi"` // nil means the configured default
+	PTY              bool              `json:"pty"`
+	Quiet            bool              `json:"quiet"`
+	Stdin            *string           `json:"stdin"`
+	UseSecret        map[string]string `json:"use_secret"` // secret name -> variable name
+	Weight           *int              `json:"weight"`     // nil means classified by the server
+	Background       bool              `json:"background"`
+	ValidateOnly     bool              `json:"validate_only"`
+	ProfilePipeline  bool              `json:"profilePipeline"`
+	CollectArtifacts []string          `json:"collectArtifacts"`
+}
+
+// envNamePattern matches valid environment variable names
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ParseBashArgs parses arguments for bash tool
+func ParseBashArgs(args json.RawMessage) (BashArgs, error) {
+	var params BashArgs
+
+	if err := json.Unmarshal(args, &params); err != nil {
+		return params, fmt.Errorf("invalid arguments for bash tool: %w", err)
+	}
+
+	if params.Command == "" {
+		return params, fmt.Errorf("command parameter is required")
+	}
+
+	if params.BypassSession && params.Restart {
+		return params, fmt.Errorf("restart cannot be combined with bypassSession")
+	}
+
+	if params.Timeout < 0 {
+		return params, fmt.Errorf("timeout must not be negative")
+	}
+
+	if params.Weight != nil && *params.Weight < 0 {
+		return params, fmt.Errorf("weight must not be negative")
+	}
+
+	for name := range params.Env {
+		if !envNamePattern.MatchString(name) {
+			return params, fmt.Errorf("invalid environment variable name %q", name)
+		}
+	}
+
+	for secret, name := range params.UseSecret {
+		if !envNamePattern.MatchString(name) {
+			return params, fmt.Errorf("invalid environment variable name %q for secret %q", name, secret)
+		}
+		if _, clash := params.Env[name]; clash {
+			return params, fmt.Errorf("environment variable %q is set by both env and use_secret", name)
+		}
+	}
+
+	if params.Stdin != nil && len(*params.Stdin) > MaxStdinSize {
+		return params, fmt.Errorf("stdin is %d bytes; the maximum is %d", len(*params.Stdin), MaxStdinSize)
+	}
+
+	switch params.Encoding {
+	case "":
+		params.Encoding = EncodingText
+	case EncodingText, EncodingBase64:
+	default:
+		return params, fmt.Errorf("unknown encoding %q (expected %q or %q)", params.Encoding, EncodingText, EncodingBase64)
+	}
+
+	if params.PTY && params.Encoding == EncodingBase64 {
+		return params, fmt.Errorf("pty cannot be combined with encoding %q", EncodingBase64)
+	}
+
+	if params.BypassSession && params.Timeout > 0 {
+		return params, fmt.Errorf("timeout cannot be combined with bypassSession")
+	}
+
+	if params.Background {
+		switch {
+		case params.BypassSession, params.Restart:
+			return params, fmt.Errorf("background cannot be combined with bypassSession or restart")
+		case params.Timeout > 0:
+			return params, fmt.Errorf("background jobs have no timeout; stop them with bash_job_kill")
+		case params.Stdin != nil, params.PTY:
+			return params, fmt.Errorf("background cannot be combined with stdin or pty")
+		case params.NoNetwork, params.Encoding == EncodingBase64:
+			return params, fmt.Errorf("background cannot be combined with noNetwork or encoding %q", EncodingBase64)
+		case params.ProfilePipeline:
+			return params, fmt.Errorf("background cannot be combined with profilePipeline")
+		case len(params.CollectArtifacts) > 0:
+			return params, fmt.Errorf("background cannot be combined with collectArtifacts; collect them once " +
+				"the job has finished")
+		}
+	}
+
+	if params.BypassSession && len(params.CollectArtifacts) > 0 {
+		return params, fmt.Errorf("collectArtifacts cannot be combined with bypassSession")
+	}
+	for _, pattern := range params.CollectArtifacts {
+		if pattern == "" {
+			return params, fmt.Errorf("collectArtifacts patterns must not be empty")
+		}
+	}
+
+	return params, nil
+}
+
+// WithEnv wraps command so it runs in a subshell with the given variables
+// exported. Values are single-quoted, so they are never expanded or executed.
+// Names must already be validated (ParseBashArgs does this).
+func WithEnv(command string, env map[string]string) string {
+	if len(env) == 0 {
+		return command
+	}
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("(export")
+	for _, name := range names {
+		fmt.Fprintf(&b, " %s=%s", name, shellQuote(env[name]))
+	}
+	fmt.Fprintf(&b, "\n%s\n)", command)
+	return b.String()
+}
+
+// shellQuote quotes a string for safe use as a single bash word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,47 @@
+package bash
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestWithEnvScopedToCommand(t *testing.T) {
+	bm := newTestManager(t, Options{})
+
+	env := map[string]string{
+		"GREETING": "it's $(echo not expanded) `here`",
+		"EMPTY":    "",
+	}
+	result := run(t, bm, WithEnv(`printf '%s|%s' "$GREETING" "${EMPTY-unset}"`, env))
+	if want := "it's $(echo not expanded) `here`|"; result.Output != want {
+		t.Errorf("output = %q, want %q", result.Output, want)
+	}
+
+	if result := run(t, bm, `echo "${GREETING-unset}"`); result.Output != "unset" {
+		t.Errorf("GREETING = %q after the call, want it unset", result.Output)
+	}
+
+	// The directory still follows the session, since the command runs in a
+	// subshell of it
+	run(t, bm, "cd /tmp")
+	if result := run(t, bm, WithEnv("pwd", env)); result.Output != "/tmp" {
+		t.Errorf("pwd = %q, want /tmp", result.Output)
+	}
+}
+
+func TestParseBashArgsEnv(t *testing.T) {
+	for _, args := range []string{
+		`{"command":"true","env":{"1BAD":"x"}}`,
+		`{"command":"true","env":{"A-B":"x"}}`,
+		`{"command":"true","env":{"TOKEN":"x"},"use_secret":{"api":"TOKEN"}}`,
+	} {
+		if _, err := ParseBashArgs(json.RawMessage(args)); err == nil {
+			t.Errorf("%s accepted", args)
+		}
+	}
+
+	args, err := ParseBashArgs(json.RawMessage(`{"command":"true","env":{"_OK_1":"x"}}`))
+	if err != nil || args.Env["_OK_1"] != "x" {
+		t.Errorf("args = %+v, %v", args, err)
+	}
+}
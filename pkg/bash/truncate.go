@@ -0,0 +1,170 @@
+package bash
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/truncate"
+)
+
+// Truncation modes: which part of output over the size limit is kept
+const (
+	// TruncateHead keeps the beginning of the output (the default)
+	TruncateHead = "head"
+	// TruncateTail keeps the end, where compilers and test runners put
+	// their failure summary
+	TruncateTail = "tail"
+	// TruncateBoth keeps the first and last halves of the limit
+	TruncateBoth = "both"
+)
+
+// boundaryMargin is how many bytes are kept past each end of the limit, so
+// a character, or a run of combining marks, that straddles the cut can be
+// left out whole rather than split
+const boundaryMargin = 32
+
+// cappedBuffer is an io.Writer that keeps at most limit bytes of what is
+// written to it, chosen by the truncation mode, and counts what it dropped.
+// The tail is held in a slice that is compacted whenever it reaches twice
+// its share of the limit, so memory stays bounded however much is written.
+//
+// If keep is set, the first keep bytes are also retained in full so that
+// output which turns out to be truncated can be stored for bash_output.
+type cappedBuffer struct {
+	limit int
+	mode  string
+	head  bytes.Buffer
+	after []byte // the first bytes past the head, to find a clean cut
+	tail  []byte
+	total int // bytes written
+
+	keep      int
+	full      []byte
+	outputID  string // set by store
+	outputURI string // set by store, for a store on disk
+}
+
+func newCappedBuffer(limit int, mode string) *cappedBuffer {
+	return &cappedBuffer{limit: limit, mode: mode}
+}
+
+// retain makes the buffer keep the first keep bytes in full for store
+func (c *cappedBuffer) retain(keep int) *cappedBuffer {
+	c.keep = keep
+	return c
+}
+
+// headLimit is the share of the limit kept from the start of the output
+func (c *cappedBuffer) headLimit() int {
+	switch c.mode {
+	case TruncateTail:
+		return 0
+	case TruncateBoth:
+		return c.limit / 2
+	}
+	return c.limit
+}
+
+func (c *cappedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	c.total += n
+	if room := c.keep - len(c.full); room > 0 {
+		c.full = append(c.full, p[:min(room, len(p))]...)
+	}
+
+	if room := c.headLimit() - c.head.Len(); room > 0 {
+		keep := min(room, len(p))
+		c.head.Write(p[:keep])
+		p = p[keep:]
+	}
+	if c.head.Len() > 0 && len(c.after) < boundaryMargin {
+		c.after = append(c.after, p[:min(boundaryMargin-len(c.after), len(p))]...)
+	}
+	if tailLimit := c.limit - c.headLimit(); tailLimit > 0 && len(p) > 0 {
+		c.tail = append(c.tail, p...)
+		if keep := tailLimit + boundaryMargin; len(c.tail) >= 2*keep {
+			c.tail = append(c.tail[:0], c.tail[len(c.tail)-keep:]...)
+		}
+	}
+	return n, nil
+}
+
+// WriteString writes s, for use in place of a strings.Builder
+func (c *cappedBuffer) WriteString(s string) {
+	c.Write([]byte(s))
+}
+
+// reset discards everything written so far
+func (c *cappedBuffer) reset() {
+	c.head.Reset()
+	c.after = c.after[:0]
+	c.tail = c.tail[:0]
+	c.total = 0
+	c.full = nil
+	c.outputID = ""
+	c.outputURI = ""
+}
+
+// truncated reports whether anything was dropped
+func (c *cappedBuffer) truncated() bool {
+	return c.total > c.limit
+}
+
+// store saves the retained output of stream in s if it was truncated, so
+// String can say where to find it. Returns the output ID, or "" if nothing
+// was stored.
+func (c *cappedBuffer) store(s *outputStore, stream string) string {
+	if !c.truncated() || c.keep == 0 || c.outputID != "" {
+		return c.outputID
+	}
+	c.outputID = s.put(c.full, c.total, stream)
+	if c.outputID != "" && s.onDisk {
+		c.outputURI = OutputURI(c.outputID)
+	}
+	c.full = nil
+	return c.outputID
+}
+
+// retrieval is the truncation notice's pointer to the stored output
+func (c *cappedBuffer) retrieval() string {
+	if c.outputID == "" {
+		return ""
+	}
+	where := fmt.Sprintf("can be read with bash_output, output_id %q", c.outputID)
+	if c.outputURI != "" {
+		where = fmt.Sprintf("are stored as resource %s and %s", c.outputURI, where)
+	}
+	if c.total > c.keep {
+		return fmt.Sprintf("; the first %d bytes %s", c.keep, where)
+	}
+	return fmt.Sprintf("; all %d bytes %s", c.total, where)
+}
+
+// String returns the kept output with a notice saying what was dropped
+func (c *cappedBuffer) String() string {
+	if !c.truncated() {
+		return c.head.String() + string(c.tail)
+	}
+	// Both ends were cut by byte count; move the cuts to character
+	// boundaries
+	head := c.head.Bytes()
+	if len(c.after) > 0 {
+		head = truncate.Head(append(head[:len(head):len(head)], c.after...), len(head))
+	}
+	if c.mode != TruncateTail && c.mode != TruncateBoth {
+		return string(head) + fmt.Sprintf("\n... [output truncated at %d bytes%s] ...\n", c.limit, c.retrieval())
+	}
+
+	tail := truncate.Tail(c.tail, c.limit-c.headLimit())
+	// Start the kept tail on a line boundary rather than mid-line
+	if i := bytes.IndexByte(tail, '\n'); i >= 0 && i < len(tail)-1 {
+		tail = tail[i+1:]
+	}
+	omitted := c.total - len(head) - len(tail)
+
+	if c.mode == TruncateTail {
+		return fmt.Sprintf("... [%d bytes omitted; showing the last %d%s] ...\n",
+			omitted, len(tail), c.retrieval()) + string(tail)
+	}
+	return string(head) + fmt.Sprintf("\n... [%d bytes omitted%s] ...\n", omitted, c.retrieval()) + string(tail)
+}
@@ -0,0 +1,177 @@
+package bash
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Minimum bash version the marker protocol and session features are tested
+// against. Older shells still run, with a one-time warning.
+const (
+	MinSupportedBashMajor = 4
+	MinSupportedBashMinor = 2
+)
+
+// versionProbeTimeout bounds the $BASH_VERSION probe at session creation.
+const versionProbeTimeout = 5 * time.Second
+
+// BashVersion is a parsed $BASH_VERSION, e.g. "5.2.15(1)-release".
+type BashVersion struct {
+	Raw   string
+	Major int
+	Minor int
+}
+
+// BashCapabilities records which version-dependent bash features a session
+// has. The completion marker and timeout handling need nothing newer than
+// bash 3.2 (${#PATH} is POSIX); what depends on a newer bash checks here.
+type BashCapabilities struct {
+	AssocArrays       bool `json:"assocArrays"`       // declare -A (4.0)
+	LastPipe          bool `json:"lastPipe"`          // shopt -s lastpipe (4.2)
+	PrintfTime        bool `json:"printfTime"`        // printf '%(fmt)T' (4.2)
+	WaitN             bool `json:"waitN"`             // wait -n (4.3)
+	Nameref           bool `json:"nameref"`           // declare -n (4.3)
+	InheritErrexit    bool `json:"inheritErrexit"`    // shopt -s inherit_errexit (4.4)
+	QuoteTransform    bool `json:"quoteTransform"`    // ${var@Q} (4.4)
+	EmptyArrayNounset bool `json:"emptyArrayNounset"` // "${arr[@]}" on empty arrays under set -u (4.4)
+	EpochRealtime     bool `json:"epochRealtime"`     // $EPOCHREALTIME (5.0)
+	Argv0             bool `json:"argv0"`             // BASH_ARGV0 sets $0 (5.0)
+}
+
+// Capabilities returns the feature table for this bash version.
+func (v BashVersion) Capabilities() BashCapabilities {
+	return BashCapabilities{
+		AssocArrays:       v.AtLeast(4, 0),
+		LastPipe:          v.AtLeast(4, 2),
+		PrintfTime:        v.AtLeast(4, 2),
+		WaitN:             v.AtLeast(4, 3),
+		Nameref:           v.AtLeast(4, 3),
+		InheritErrexit:    v.AtLeast(4, 4),
+		QuoteTransform:    v.AtLeast(4, 4),
+		EmptyArrayNounset: v.AtLeast(4, 4),
+		EpochRealtime:     v.AtLeast(5, 0),
+		Argv0:             v.AtLeast(5, 0),
+	}
+}
+
+// Missing names the features commands might use that c lacks, for telling
+// clients of an old bash what to avoid
+func (c BashCapabilities) Missing() []string {
+	var missing []string
+	for _, feature := range []struct {
+		have bool
+		name string
+	}{
+		{c.AssocArrays, "associative arrays (declare -A)"},
+		{c.LastPipe, "shopt -s lastpipe"},
+		{c.PrintfTime, "printf '%(fmt)T'"},
+		{c.WaitN, "wait -n"},
+		{c.Nameref, "namerefs (declare -n)"},
+		{c.InheritErrexit, "shopt -s inherit_errexit"},
+		{c.QuoteTransform, "${var@Q}"},
+		{c.EmptyArrayNounset, `"${arr[@]}" of an empty array under set -u`},
+		{c.EpochRealtime, "$EPOCHREALTIME"},
+	} {
+		if !feature.have {
+			missing = append(missing, feature.name)
+		}
+	}
+	return missing
+}
+
+// ParseBashVersion parses a $BASH_VERSION string, or the first line of
+// bash --version ("GNU bash, version 5.2.15(1)-release (x86_64-pc-linux-gnu)").
+// Returns ok=false when the string is empty or unrecognisable (e.g. the
+// shell is not bash).
+func ParseBashVersion(raw string) (BashVersion, bool) {
+	raw = strings.TrimSpace(raw)
+	if line, _, _ := strings.Cut(raw, "\n"); strings.Contains(line, "version ") {
+		_, raw, _ = strings.Cut(line, "version ")
+		raw, _, _ = strings.Cut(raw, " ")
+	}
+	v := BashVersion{Raw: raw}
+	parts := strings.SplitN(raw, ".", 3)
+	if len(parts) < 2 {
+		return v, false
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return v, false
+	}
+	minorDigits := parts[1]
+	for i, r := range minorDigits {
+		if r < '0' || r > '9' {
+			minorDigits = minorDigits[:i]
+			break
+		}
+	}
+	minor, err := strconv.Atoi(minorDigits)
+	if err != nil {
+		return v, false
+	}
+	v.Major, v.Minor = major, minor
+	return v, true
+}
+
+// AtLeast reports whether v is at least major.minor.
+func (v BashVersion) AtLeast(major, minor int) bool {
+	return v.Major > major || (v.Major == major && v.Minor >= minor)
+}
+
+// Supported reports whether v meets the minimum supported version.
+func (v BashVersion) Supported() bool {
+	return v.AtLeast(MinSupportedBashMajor, MinSupportedBashMinor)
+}
+
+// oldBashWarning ensures the unsupported-version warning is logged once per process.
+var oldBashWarning sync.Once
+
+// shellIsBash reports whether a configured shell is bash, judged by its
+// name. Other shells have no $BASH_VERSION to probe.
+func shellIsBash(shell string) bool {
+	return strings.HasPrefix(filepath.Base(shell), "bash")
+}
+
+// probeVersion captures $BASH_VERSION from a freshly started session.
+func (bs *BashSession) probeVersion() {
+	ctx, cancel := context.WithTimeout(context.Background(), versionProbeTimeout)
+	defer cancel()
+
+	result, err := bs.execute(`echo "$BASH_VERSION"`, ctx, executeLimits{total: versionProbeTimeout})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Bash version probe failed: %v\n", err)
+		return
+	}
+
+	if strings.TrimSpace(result.Output) == "" {
+		fmt.Fprintf(os.Stderr, "Shell does not set $BASH_VERSION; assuming it is not bash\n")
+		return
+	}
+	version, ok := ParseBashVersion(result.Output)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Could not determine bash version from %q\n", result.Output)
+		return
+	}
+
+	bs.version = version
+	bs.hasVersion = true
+	fmt.Fprintf(os.Stderr, "Bash version: %s\n", version.Raw)
+
+	if !version.Supported() {
+		oldBashWarning.Do(func() {
+			fmt.Fprintf(os.Stderr, "Warning: bash %s is older than the supported minimum %d.%d; "+
+				"some features may be unavailable or behave differently\n",
+				version.Raw, MinSupportedBashMajor, MinSupportedBashMinor)
+		})
+	}
+	if missing := version.Capabilities().Missing(); len(missing) > 0 {
+		bs.warnings = append(bs.warnings, fmt.Sprintf("Note: this session runs bash %s, which lacks %s",
+			version.Raw, strings.Join(missing, ", ")))
+	}
+}
@@ -0,0 +1,99 @@
+package bash
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestBashVersionCapabilities(t *testing.T) {
+	tests := []struct {
+		output       string // bash --version, or $BASH_VERSION
+		major, minor int
+		supported    bool
+		capabilities BashCapabilities
+	}{
+		{
+			output: "GNU bash, version 3.2.57(1)-release (arm64-apple-darwin23)\n" +
+				"Copyright (C) 2007 Free Software Foundation, Inc.",
+			major: 3, minor: 2,
+		},
+		{
+			output: "GNU bash, version 4.2.46(2)-release (x86_64-redhat-linux-gnu)\n" +
+				"Copyright (C) 2011 Free Software Foundation, Inc.\n" +
+				"License GPLv3+: GNU GPL version 3 or later <http://gnu.org/licenses/gpl.html>",
+			major: 4, minor: 2, supported: true,
+			capabilities: BashCapabilities{AssocArrays: true, LastPipe: true, PrintfTime: true},
+		},
+		{
+			output: "4.4.20(1)-release",
+			major:  4, minor: 4, supported: true,
+			capabilities: BashCapabilities{AssocArrays: true, LastPipe: true, PrintfTime: true, WaitN: true,
+				Nameref: true, InheritErrexit: true, QuoteTransform: true, EmptyArrayNounset: true},
+		},
+		{
+			output: "GNU bash, version 5.2.15(1)-release (x86_64-pc-linux-gnu)\n" +
+				"Copyright (C) 2022 Free Software Foundation, Inc.",
+			major: 5, minor: 2, supported: true,
+			capabilities: BashCapabilities{AssocArrays: true, LastPipe: true, PrintfTime: true, WaitN: true,
+				Nameref: true, InheritErrexit: true, QuoteTransform: true, EmptyArrayNounset: true,
+				EpochRealtime: true, Argv0: true},
+		},
+	}
+	for _, tt := range tests {
+		version, ok := ParseBashVersion(tt.output)
+		if !ok || version.Major != tt.major || version.Minor != tt.minor {
+			t.Errorf("ParseBashVersion(%q) = %+v, %v; want %d.%d", tt.output, version, ok, tt.major, tt.minor)
+			continue
+		}
+		if version.Supported() != tt.supported {
+			t.Errorf("%s: Supported() = %v, want %v", version.Raw, version.Supported(), tt.supported)
+		}
+		if got := version.Capabilities(); got != tt.capabilities {
+			t.Errorf("%s: Capabilities() = %+v, want %+v", version.Raw, got, tt.capabilities)
+		}
+	}
+
+	for _, raw := range []string{"", "zsh 5.9", "GNU bash, version x.y"} {
+		if version, ok := ParseBashVersion(raw); ok {
+			t.Errorf("ParseBashVersion(%q) = %+v, want it unrecognised", raw, version)
+		}
+	}
+}
+
+func TestBashCapabilitiesMissing(t *testing.T) {
+	old, _ := ParseBashVersion("3.2.57(1)-release")
+	missing := strings.Join(old.Capabilities().Missing(), ", ")
+	for _, want := range []string{"declare -A", "wait -n"} {
+		if !strings.Contains(missing, want) {
+			t.Errorf("bash 3.2 missing %q, want it to include %q", missing, want)
+		}
+	}
+	current, _ := ParseBashVersion("5.2.15(1)-release")
+	if missing := current.Capabilities().Missing(); len(missing) != 0 {
+		t.Errorf("bash 5.2 missing %q, want nothing", missing)
+	}
+}
+
+func TestSessionReportsBashVersion(t *testing.T) {
+	path, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not installed")
+	}
+	out, err := exec.Command(path, "--version").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	installed, ok := ParseBashVersion(string(out))
+	if !ok {
+		t.Fatalf("can't parse bash --version output %q", out)
+	}
+
+	bm := newTestManager(t, Options{})
+	run(t, bm, "true")
+	sessions := bm.Sessions()
+	if len(sessions) != 1 || sessions[0].BashVersion != installed.Raw || sessions[0].BashCapabilities == nil ||
+		*sessions[0].BashCapabilities != installed.Capabilities() {
+		t.Errorf("sessions = %+v, want bash %s and its capabilities", sessions, installed.Raw)
+	}
+}
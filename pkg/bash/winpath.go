@@ -0,0 +1,149 @@
+package bash
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+// defaultAutomountRoot is where WSL mounts Windows drives unless wsl.conf
+// says otherwise
+const defaultAutomountRoot = "/mnt/"
+
+// WindowsPaths translates the Windows paths a client on the Windows side of
+// WSL sends (C:\Users\me\file.txt) to the Linux paths they are mounted at
+// (/mnt/c/Users/me/file.txt), and back for results. It is only created when
+// the server runs under WSL; a nil *WindowsPaths leaves every path alone.
+//
+// Only absolute drive paths are translated. UNC paths (\\server\share) and
+// drive-relative ones (C:file.txt) have no single Linux equivalent, and a
+// path mixing \ and / is ambiguous, so those are refused rather than
+// guessed at. Anything else, including a Linux path containing a
+// backslash, passes through unchanged.
+type WindowsPaths struct {
+	root    string // automount root, with a trailing slash
+	wslpath string // the wslpath tool, or "" to translate in Go
+}
+
+// detectWindowsPaths returns the translator if the server runs under WSL,
+// or nil
+func detectWindowsPaths() *WindowsPaths {
+	if !runningUnderWSL() {
+		return nil
+	}
+	w := &WindowsPaths{root: automountRoot()}
+	if tool, err := exec.LookPath("wslpath"); err == nil {
+		w.wslpath = tool
+	}
+	fmt.Fprintf(os.Stderr, "Running under WSL: Windows paths are translated under %s\n", w.root)
+	return w
+}
+
+// runningUnderWSL reports whether this is a WSL kernel
+func runningUnderWSL() bool {
+	if _, err := os.Stat("/proc/sys/fs/binfmt_misc/WSLInterop"); err == nil {
+		return true
+	}
+	version, err := os.ReadFile("/proc/version")
+	return err == nil && strings.Contains(strings.ToLower(string(version)), "microsoft")
+}
+
+// automountRoot returns the [automount] root set in /etc/wsl.conf, or the
+// default
+func automountRoot() string {
+	file, err := os.Open("/etc/wsl.conf")
+	if err != nil {
+		return defaultAutomountRoot
+	}
+	defer file.Close()
+
+	section := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.ToLower(strings.TrimSpace(line[1 : len(line)-1]))
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || section != "automount" || strings.TrimSpace(strings.ToLower(key)) != "root" {
+			continue
+		}
+		root := strings.Trim(strings.TrimSpace(value), `"`)
+		if strings.HasPrefix(root, "/") {
+			return strings.TrimSuffix(root, "/") + "/"
+		}
+	}
+	return defaultAutomountRoot
+}
+
+// WindowsPaths returns the Windows path translator, or nil when the server
+// isn't running under WSL
+func (bm *BashManager) WindowsPaths() *WindowsPaths {
+	return bm.windowsPaths
+}
+
+// ToLinux returns the Linux path for a Windows path, and whether p was one.
+// Paths that aren't Windows paths are returned unchanged.
+func (w *WindowsPaths) ToLinux(p string) (string, bool, error) {
+	if w == nil {
+		return p, false, nil
+	}
+	if strings.HasPrefix(p, `\\`) {
+		return "", false, fmt.Errorf("UNC path %s is not supported; use a drive path such as C:\\... or a "+
+			"Linux path", p)
+	}
+	if !hasDriveLetter(p) {
+		return p, false, nil
+	}
+	if len(p) == 2 || (p[2] != '\\' && p[2] != '/') {
+		return "", false, fmt.Errorf("drive-relative path %s is not supported; use an absolute path such as "+
+			"%s\\...", p, p[:2])
+	}
+	if strings.Contains(p, `\`) && strings.Contains(p, "/") {
+		return "", false, fmt.Errorf("path %s mixes \\ and / separators; use one or the other", p)
+	}
+
+	if w.wslpath != "" {
+		if out, err := exec.Command(w.wslpath, "-u", p).Output(); err == nil {
+			if linux := strings.TrimRight(string(out), "\n"); strings.HasPrefix(linux, "/") {
+				return linux, true, nil
+			}
+		}
+	}
+	return w.driveToLinux(p), true, nil
+}
+
+// driveToLinux translates an absolute drive path without wslpath:
+// C:\Users\me becomes <root>c/Users/me
+func (w *WindowsPaths) driveToLinux(p string) string {
+	drive := strings.ToLower(p[:1])
+	rest := strings.ReplaceAll(p[2:], `\`, "/")
+	return path.Clean(w.root + drive + "/" + rest)
+}
+
+// ToWindows returns the Windows path for a Linux path on a mounted drive,
+// the reverse of ToLinux. Other paths are returned unchanged.
+func (w *WindowsPaths) ToWindows(p string) string {
+	if w == nil {
+		return p
+	}
+	rest, ok := strings.CutPrefix(p, w.root)
+	if !ok || len(rest) == 0 || !isASCIILetter(rest[0]) || (len(rest) > 1 && rest[1] != '/') {
+		return p
+	}
+	return strings.ToUpper(rest[:1]) + `:\` + strings.ReplaceAll(strings.TrimPrefix(rest[1:], "/"), "/", `\`)
+}
+
+// hasDriveLetter reports whether p starts with a drive letter and colon
+func hasDriveLetter(p string) bool {
+	return len(p) >= 2 && isASCIILetter(p[0]) && p[1] == ':'
+}
+
+// isASCIILetter reports whether c is A-Z or a-z
+func isASCIILetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
@@ -0,0 +1,219 @@
+package bash
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Modes for the write_file tool
+const (
+	WriteCreate    = "create"    // fail if the file exists
+	WriteOverwrite = "overwrite" // replace the file atomically, or create it
+	WriteAppend    = "append"    // add to the end of the file, or create it
+)
+
+// newFileMode is the mode of files write_file creates
+const newFileMode = 0644
+
+// WriteFileArgs holds the parsed arguments for the write_file tool
+type WriteFileArgs struct {
+	Path       string `json:"path"`
+	Content    string `json:"content"`
+	Mode       string `json:"mode"`
+	CreateDirs bool   `json:"create_dirs"`
+}
+
+// WriteFileResult describes a successful write
+type WriteFileResult struct {
+	Path    string
+	Bytes   int
+	Created bool // the file didn't exist before
+}
+
+// WriteFile writes content to a file directly, without the shell, so no
+// character in it is ever interpreted. Overwrite writes a temp file beside
+// the target and renames it into place, keeping an existing file's mode and
+// owner; a symlink is followed and its target replaced. Files and
+// directories the write creates belong to the session's user, so commands in
+// the session can use them.
+func (bm *BashManager) WriteFile(args WriteFileArgs) (*WriteFileResult, error) {
+	path := args.Path
+	info, err := os.Stat(path)
+	exists := err == nil
+	switch {
+	case err != nil && !errors.Is(err, os.ErrNotExist):
+		return nil, fmt.Errorf("cannot write %s: %w", path, err)
+	case exists && !info.Mode().IsRegular():
+		return nil, fmt.Errorf("cannot write %s: not a regular file", path)
+	case exists && args.Mode == WriteCreate:
+		return nil, fmt.Errorf("%s already exists; use mode overwrite or append to change it", path)
+	}
+
+	if !exists {
+		if err := bm.makeParentDirs(path, args.CreateDirs); err != nil {
+			return nil, err
+		}
+	}
+
+	data := []byte(args.Content)
+	switch args.Mode {
+	case WriteOverwrite:
+		if exists {
+			if path, err = filepath.EvalSymlinks(path); err != nil {
+				return nil, fmt.Errorf("cannot write %s: %w", args.Path, err)
+			}
+			if err := writeFileAtomic(path, data, info); err != nil {
+				return nil, err
+			}
+			break
+		}
+		if err := writeFileAtomic(path, data, nil); err != nil {
+			return nil, err
+		}
+		if err := os.Chmod(path, newFileMode); err != nil {
+			return nil, fmt.Errorf("failed to set file mode: %w", err)
+		}
+
+	case WriteCreate, WriteAppend:
+		flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		if args.Mode == WriteCreate {
+			// O_EXCL closes the gap since the check above
+			flags = os.O_WRONLY | os.O_CREATE | os.O_EXCL
+		}
+		file, err := os.OpenFile(path, flags, newFileMode)
+		if err != nil {
+			return nil, fmt.Errorf("cannot write %s: %w", path, err)
+		}
+		_, err = file.Write(data)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			if !exists {
+				os.Remove(path)
+			}
+			return nil, fmt.Errorf("failed to write %s: %w", path, err)
+		}
+	}
+
+	if !exists {
+		if err := bm.giveToSession(path); err != nil {
+			return nil, err
+		}
+	}
+	return &WriteFileResult{Path: args.Path, Bytes: len(data), Created: !exists}, nil
+}
+
+// makeParentDirs checks that the directory path goes in exists, creating it
+// and any missing parents (mode 0755) if create is set
+func (bm *BashManager) makeParentDirs(path string, create bool) error {
+	dir := filepath.Dir(path)
+	info, err := os.Stat(dir)
+	if err == nil {
+		if !info.IsDir() {
+			return fmt.Errorf("cannot write %s: %s is not a directory", path, dir)
+		}
+		return nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("cannot write %s: %w", path, err)
+	}
+	if !create {
+		return fmt.Errorf("cannot write %s: directory %s does not exist; set create_dirs to create it", path, dir)
+	}
+
+	// Note the directories that are missing, to hand them to the session
+	var missing []string
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil || filepath.Dir(d) == d {
+			break
+		}
+		missing = append(missing, d)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+	for _, d := range missing {
+		if err := bm.giveToSession(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PreviewOverwrite returns the unified diff overwriting the file at path
+// with content would make, and whether there is a file there to overwrite
+func PreviewOverwrite(path, content string) (string, bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("cannot read %s: %w", path, err)
+	}
+	return unifiedDiff(path, string(data), content), true, nil
+}
+
+// WriteFileToolSchema defines the schema for write_file input
+var WriteFileToolSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type":        "string",
+			"description": "The file to write. Relative paths are resolved against the session's working directory",
+		},
+		"content": map[string]interface{}{
+			"type":        "string",
+			"description": "The text to write, exactly as given; nothing in it is expanded",
+		},
+		"mode": map[string]interface{}{
+			"type": "string",
+			"enum": []string{WriteCreate, WriteOverwrite, WriteAppend},
+			"description": "create (default) fails if the file exists; overwrite replaces it atomically; " +
+				"append adds to its end. overwrite and append create a missing file",
+		},
+		"create_dirs": map[string]interface{}{
+			"type":        "boolean",
+			"description": "Create missing parent directories (default false)",
+		},
+		"confirm_token": map[string]interface{}{
+			"type": "string",
+			"description": "Token from the preview of this exact call, where the server requires confirmation " +
+				"before the change is made",
+		},
+	},
+	"required": []string{"path", "content"},
+}
+
+// ParseWriteFileArgs parses arguments for the write_file tool
+func ParseWriteFileArgs(args json.RawMessage) (WriteFileArgs, error) {
+	var params WriteFileArgs
+	params.Mode = WriteCreate
+
+	if err := json.Unmarshal(args, &params); err != nil {
+		return params, fmt.Errorf("invalid arguments for write_file tool: %w", err)
+	}
+
+	if params.Path == "" {
+		return params, fmt.Errorf("path parameter is required")
+	}
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(args, &fields) == nil {
+		if _, ok := fields["content"]; !ok {
+			return params, fmt.Errorf("content parameter is required")
+		}
+	}
+	switch params.Mode {
+	case WriteCreate, WriteOverwrite, WriteAppend:
+	case "":
+		params.Mode = WriteCreate
+	default:
+		return params, fmt.Errorf("unknown mode %q (expected %s, %s or %s)", params.Mode, WriteCreate,
+			WriteOverwrite, WriteAppend)
+	}
+
+	return params, nil
+}
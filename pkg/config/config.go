@@ -6,7 +6,13 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
 	"time"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/perms"
 )
 
 // NetworkConfig holds network-specific configuration.
@@ -19,6 +25,184 @@ type NetworkConfig struct {
 	Port           int      `json:"port"`
 	AllowedIPs     []string `json:"allowedIPs"`
 	AllowedSubnets []string `json:"allowedSubnets"`
+
+	// Compression ("gzip") is offered to clients that request it at
+	// initialize; others keep plain newline-delimited JSON
+	Compression string `json:"compression,omitempty"`
+}
+
+// UpdateCheckConfig controls the opt-in check for newer releases.
+// The server only reports what it finds; it never installs anything.
+type UpdateCheckConfig struct {
+	Enabled       bool   `json:"enabled"`
+	URL           string `json:"url"`
+	IntervalHours int    `json:"intervalHours"`
+}
+
+// DiskCheckConfig tunes the low disk space check run before each command.
+// The check is on by default; set disabled to turn it off.
+type DiskCheckConfig struct {
+	Disabled     bool     `json:"disabled,omitempty"`
+	WarnPercent  float64  `json:"warnPercent,omitempty"`  // warn below this % free (default 5)
+	WarnMB       int      `json:"warnMB,omitempty"`       // warn below this many MB free (default 512)
+	FloorMB      int      `json:"floorMB,omitempty"`      // refuse writes below this many MB free (0 = never)
+	WatchRoots   []string `json:"watchRoots,omitempty"`   // extra paths to check
+	CacheSeconds int      `json:"cacheSeconds,omitempty"` // reuse results for this long (default 5)
+}
+
+// NestedMcpConfig controls the environment exported for nested MCP
+// execution. Each socket in Sockets (name -> path) is probed when a session
+// starts and exported as MCP_<NAME>_SOCKET only if it accepts connections.
+// Without a sockets map the built-in skills socket is used.
+type NestedMcpConfig struct {
+	Disabled bool              `json:"disabled,omitempty"`
+	Sockets  map[string]string `json:"sockets,omitempty"`
+}
+
+// PolicyHookConfig points at an external policy engine consulted before each
+// command. Set either url (the request is POSTed as JSON) or command (the
+// request is piped to the program's stdin). The reply must be
+// {"allow": bool, "reason": "...", "mutations": {"command": "..."}}.
+type PolicyHookConfig struct {
+	URL       string            `json:"url,omitempty"`
+	Command   []string          `json:"command,omitempty"`
+	TimeoutMs int               `json:"timeoutMs,omitempty"` // default 2000
+	OnFailure string            `json:"onFailure,omitempty"` // "deny" (default) or "allow"
+	Labels    map[string]string `json:"labels,omitempty"`    // passed through to the engine
+}
+
+// LimitsConfig sets resource limits on the bash session, inherited by every
+// command it runs. Zero or unset leaves a limit alone. Each limit is per
+// process, so cpuSeconds also counts the session shell's own CPU time;
+// maxProcesses counts all of the user's processes. On macOS memoryBytes is
+// not enforced.
+type LimitsConfig struct {
+	CPUSeconds   int64 `json:"cpuSeconds,omitempty"`
+	MemoryBytes  int64 `json:"memoryBytes,omitempty"`
+	MaxFileSize  int64 `json:"maxFileSize,omitempty"` // bytes
+	MaxOpenFiles int64 `json:"maxOpenFiles,omitempty"`
+	MaxProcesses int64 `json:"maxProcesses,omitempty"`
+}
+
+// ActivityConfig shares what the session is doing with other servers run by
+// the same user on the host, so agents sharing it can tell why things are
+// slow. The label and whether a command is running are shared; the command
+// itself only with shareCommand. LoadWarning is the load average above which
+// responses note other sessions' running commands (default: the CPU count).
+type ActivityConfig struct {
+	Label        string  `json:"label,omitempty"`
+	ShareCommand bool    `json:"shareCommand,omitempty"`
+	LoadWarning  float64 `json:"loadWarning,omitempty"`
+}
+
+// SandboxConfig isolates sessions, bypassSession commands and exec programs
+// in their own mount, PID and network namespaces. Linux only. readOnlyPaths
+// are host directories made read-only inside the sandbox. confineWrites
+// makes the root filesystem read-only except for allowedRoots, so commands
+// can't write outside them however they name paths.
+type SandboxConfig struct {
+	Enabled       bool     `json:"enabled,omitempty"`
+	ReadOnlyPaths []string `json:"readOnlyPaths,omitempty"`
+	ConfineWrites bool     `json:"confineWrites,omitempty"`
+}
+
+// SecretsConfig says where the server loads secrets that commands can use by
+// name (the bash tool's use_secret argument) without seeing their values.
+type SecretsConfig struct {
+	File string   `json:"file,omitempty"` // JSON object of name -> value; must be mode 0600
+	Env  []string `json:"env,omitempty"`  // server environment variables, loaded under their own names
+}
+
+// AdmissionConfig limits how many heavy commands run at once. Heavy commands
+// reserve units from a budget of units while they run: those matching a
+// heavyCommands pattern, or given a weight argument. A command that finds the
+// budget short waits up to maxWaitSeconds for units, then is refused.
+type AdmissionConfig struct {
+	Units          int            `json:"units"`
+	MaxWaitSeconds int            `json:"maxWaitSeconds,omitempty"` // 0 = refuse at once
+	HeavyCommands  []HeavyCommand `json:"heavyCommands,omitempty"`
+}
+
+// WriteQuotaConfig caps how much a write-heavy command (one matching a
+// commands pattern) may write. On Linux such a command runs in a directory
+// of its own under directory, which is also its TMPDIR, and is interrupted
+// once the directory holds more than maxMB. Elsewhere the command runs where
+// it was, and is interrupted once watchRoots (default: its working
+// directory) have grown by more than maxMB. Sizes are polled every
+// pollIntervalMs (default 500).
+type WriteQuotaConfig struct {
+	MaxMB          int      `json:"maxMB"`
+	Commands       []string `json:"commands"`
+	Directory      string   `json:"directory,omitempty"`
+	WatchRoots     []string `json:"watchRoots,omitempty"`
+	PollIntervalMs int      `json:"pollIntervalMs,omitempty"`
+}
+
+// ConfirmationConfig makes the listed tools two-phase: a call returns a
+// preview and a token, and only repeating it with the token within
+// ttlSeconds (default 120) changes anything. See ConfirmableTools.
+type ConfirmationConfig struct {
+	Tools      []string `json:"tools"`
+	TTLSeconds int      `json:"ttlSeconds,omitempty"`
+}
+
+// WatermarkConfig wraps the text of every tool response in markers naming
+// the call, "[tag id]" before and "[/tag id]" after, so text copied out of
+// a response can be traced back through the audit log. Tag defaults to
+// bash-output.
+type WatermarkConfig struct {
+	Tag string `json:"tag,omitempty"`
+}
+
+// watermarkTag is what a watermark tag may be made of
+var watermarkTag = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// ConfirmableTools are the tools that support confirmation. write_file and
+// fetch_artifact ask for it only when they would overwrite existing paths.
+var ConfirmableTools = []string{"write_file", "file_edit", "fetch_artifact"}
+
+// CustomToolConfig publishes a curated command as a tool of its own. Command
+// is a bash command with {{name}} placeholders, filled in from the call's
+// arguments when it runs in the session; Parameters declares those
+// arguments. Only integer and number parameters may be used in arithmetic
+// contexts such as $((...)). The tool is read-only to clients if ReadOnly is
+// set.
+type CustomToolConfig struct {
+	Name        string                         `json:"name"`
+	Title       string                         `json:"title,omitempty"`
+	Description string                         `json:"description"`
+	Command     string                         `json:"command"`
+	Parameters  map[string]CustomToolParameter `json:"parameters,omitempty"`
+	ReadOnly    bool                           `json:"readOnly,omitempty"`
+}
+
+// CustomToolParameter declares one argument of a custom tool, as a subset of
+// JSON schema. Type is string (default), integer, number or boolean. A string
+// can be limited to Enum values or to those Pattern (a regular expression)
+// matches in full. An argument that isn't Required and isn't given takes
+// Default, or is empty.
+type CustomToolParameter struct {
+	Type        string          `json:"type,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Enum        []string        `json:"enum,omitempty"`
+	Pattern     string          `json:"pattern,omitempty"`
+	Required    bool            `json:"required,omitempty"`
+	Default     json.RawMessage `json:"default,omitempty"`
+}
+
+// CustomToolParameterTypes are the types a custom tool parameter can have
+var CustomToolParameterTypes = []string{"string", "integer", "number", "boolean"}
+
+// customToolName matches valid custom tool and parameter names
+var customToolName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,63}$`)
+
+// HeavyCommand is a regular expression matched against commands, and the
+// units a matching command reserves (default 1). The first match wins.
+// Label names the commands to those kept waiting (default: the pattern).
+type HeavyCommand struct {
+	Pattern string `json:"pattern"`
+	Units   int    `json:"units,omitempty"`
+	Label   string `json:"label,omitempty"`
 }
 
 // Config holds the application configuration
@@ -26,8 +210,300 @@ type Config struct {
 	CommandTimeout int            `json:"commandTimeout"` // in seconds
 	Enabled        bool           `json:"enabled"`
 	Network        *NetworkConfig `json:"network,omitempty"`
+
+	// Path is the file the config was loaded from and SearchPaths the
+	// candidates checked for it, in order. Neither is read from the file.
+	Path        string   `json:"-"`
+	SearchPaths []string `json:"-"`
+
+	// OrderedResponses makes stdio mode write responses in request arrival
+	// order. OrderedResponseMaxWait (seconds) bounds how long a finished
+	// response is held back waiting for an earlier, slower request.
+	OrderedResponses       bool `json:"orderedResponses,omitempty"`
+	OrderedResponseMaxWait int  `json:"orderedResponseMaxWait,omitempty"`
+
+	// ClientRequestTimeoutSeconds is a hint for how long the MCP client waits
+	// for a tool call before giving up. Used when the client doesn't advertise
+	// its own timeout during initialize; 0 means unknown.
+	ClientRequestTimeoutSeconds int `json:"clientRequestTimeoutSeconds,omitempty"`
+
+	// AutoDetachLongCommands starts a bash command whose timeout exceeds the
+	// client's request timeout as a background job, returning its job ID,
+	// rather than running it in the session for a result nobody may read
+	AutoDetachLongCommands bool `json:"autoDetachLongCommands,omitempty"`
+
+	// TimeoutMode selects how commandTimeout is applied: "total" (default)
+	// limits overall run time, "idle" limits time without any output.
+	// MaxTotalSeconds caps overall run time in idle mode.
+	TimeoutMode     string `json:"timeoutMode,omitempty"`
+	MaxTotalSeconds int    `json:"maxTotalSeconds,omitempty"`
+
+	// OutputBudgetBytes caps the total inline output returned across all tool
+	// calls in a session; 0 disables the budget. Once exhausted, responses are
+	// cut aggressively. OutputBudgetResetToken, if set, lets an operator reset
+	// the budget through the session_budget tool.
+	OutputBudgetBytes      int64  `json:"outputBudgetBytes,omitempty"`
+	OutputBudgetResetToken string `json:"outputBudgetResetToken,omitempty"`
+
+	// NonZeroExitIsError marks tool results as errors (isError) when the
+	// command exits non-zero. The exit code is always reported in
+	// structuredContent either way.
+	NonZeroExitIsError bool `json:"nonZeroExitIsError,omitempty"`
+
+	// EmptyOutputText is returned in place of an empty text result when a
+	// command succeeds with no output (default "(command completed
+	// successfully with no output)"; "" keeps the result empty). The bash
+	// tool's quiet argument turns it off per call.
+	EmptyOutputText *string `json:"emptyOutputText,omitempty"`
+
+	// MaxTimeout caps the per-call timeout a client may request through the
+	// bash tool's timeout argument, in seconds (default 3600, and never less
+	// than commandTimeout).
+	MaxTimeout int `json:"maxTimeout,omitempty"`
+
+	// SessionIdleTimeout closes the bash session after this many seconds
+	// without a command; the next command starts a fresh session. 0 (the
+	// default) never closes idle sessions.
+	SessionIdleTimeout int `json:"sessionIdleTimeout,omitempty"`
+
+	// PathWarnLength is the length of the session's PATH past which
+	// commands are warned that it keeps growing, typically from
+	// export PATH=$PATH:... run over and over. 0 (the default) warns past
+	// 4096 characters; negative never warns. DedupPath then removes
+	// duplicate entries from PATH, between commands, keeping the first of
+	// each, and says so in the response.
+	PathWarnLength int  `json:"pathWarnLength,omitempty"`
+	DedupPath      bool `json:"dedupPath,omitempty"`
+
+	// HistorySize is how many commands bash_history keeps, across session
+	// restarts. 0 (the default) keeps 200.
+	HistorySize int `json:"historySize,omitempty"`
+
+	// KillOrphansOnClose kills the processes a bash session leaves running
+	// when it closes, such as daemons that detached from it. They are
+	// reported either way (Linux only).
+	KillOrphansOnClose bool `json:"killOrphansOnClose,omitempty"`
+
+	// MaxQueuedCommands is how many bash commands may wait while another
+	// runs in the session; more are refused with a "session busy" error
+	// rather than left waiting. 0 (the default) lets any number wait.
+	MaxQueuedCommands int `json:"maxQueuedCommands,omitempty"`
+
+	// MaxBackgroundJobs is how many commands started with background may
+	// run at once; more are refused until one finishes. 0 (the default)
+	// allows 16.
+	MaxBackgroundJobs int `json:"maxBackgroundJobs,omitempty"`
+
+	// JobStateFile, if set, records background jobs so a restarted server
+	// takes back those still running and can still show the output of the
+	// rest. Their output files are kept in JobStateFile.output, and jobs are
+	// left running when the server shuts down.
+	JobStateFile string `json:"jobStateFile,omitempty"`
+
+	// ExecFallback, when the shell isn't found at startup, serves the exec
+	// tool (direct argv execution) in place of the shell tools instead of
+	// advertising tools that can't work.
+	ExecFallback bool `json:"execFallback,omitempty"`
+
+	// Shell is the shell sessions run: a name looked up on PATH or a path
+	// (default "bash"). zsh, sh and dash work too; bash-only features such
+	// as job notices are then unavailable. ShellArgs are passed to it at
+	// start, e.g. ["-l"].
+	Shell     string   `json:"shell,omitempty"`
+	ShellArgs []string `json:"shellArgs,omitempty"`
+
+	// LoginShell starts sessions as login shells (-l), so they read
+	// ~/.bash_profile or ~/.profile. RCFile is a script sourced in every new
+	// session ("~/" is expanded). Anything either prints is discarded
+	// rather than shown with the first command.
+	LoginShell bool   `json:"loginShell,omitempty"`
+	RCFile     string `json:"rcFile,omitempty"`
+
+	// StartupCommands run in every new session, after the profile and
+	// rcFile, e.g. ["source ~/venvs/ai/bin/activate", "cd ~/work"]. A
+	// command exiting non-zero fails session creation with its output;
+	// with StartupCommandsLenient it is only reported as a warning.
+	StartupCommands        []string `json:"startupCommands,omitempty"`
+	StartupCommandsLenient bool     `json:"startupCommandsLenient,omitempty"`
+
+	// FetchAllowHTTP lets fetch_artifact download over plain http (and
+	// follow redirects to it). Only https is allowed by default.
+	FetchAllowHTTP bool `json:"fetchAllowHTTP,omitempty"`
+
+	// RequireInitializedNotification rejects requests (with -32002) until
+	// the client sends notifications/initialized, per the spec. By default
+	// the first request after initialize is taken as confirmation, with a
+	// warning, for clients that skip the notification.
+	RequireInitializedNotification bool `json:"requireInitializedNotification,omitempty"`
+
+	// PathJail presents this directory to the client as "/": commands
+	// start in it with HOME and TMPDIR inside it, file_edit paths,
+	// working_directory and exec cwd are resolved within it, and absolute
+	// paths under it are rewritten in responses. A translation layer for
+	// project sandboxes, not a security boundary.
+	PathJail string `json:"pathJail,omitempty"`
+
+	// SlowCommandThresholdMs records commands that take longer than this
+	// many milliseconds to SlowCommandLog (JSON lines; stderr if unset).
+	// 0 (the default) disables the slow-command log.
+	SlowCommandThresholdMs int    `json:"slowCommandThresholdMs,omitempty"`
+	SlowCommandLog         string `json:"slowCommandLog,omitempty"`
+
+	// MaxOutputBytes caps the output captured from a command (default
+	// 512KB); the rest is dropped with a truncation notice. MaxLineBytes is
+	// the longest single output line the session can read (default 1MB).
+	MaxOutputBytes int `json:"maxOutputBytes,omitempty"`
+	MaxLineBytes   int `json:"maxLineBytes,omitempty"`
+
+	// ReadFileMaxBytes is the largest file the read_file tool returns whole,
+	// and the most text it returns for a range of lines (default 256KB)
+	ReadFileMaxBytes int64 `json:"readFileMaxBytes,omitempty"`
+
+	// TruncationMode says which part of output over maxOutputBytes is kept:
+	// "head" (default), "tail", or "both" (the first and last halves)
+	TruncationMode string `json:"truncationMode,omitempty"`
+
+	// StoredOutputBytes is how much of a truncated command's output the
+	// server keeps so the bash_output tool can page through it (default
+	// 10MB per stream; negative keeps none). StoredOutputTTL is how long it
+	// is kept, in seconds (default 600).
+	StoredOutputBytes int `json:"storedOutputBytes,omitempty"`
+	StoredOutputTTL   int `json:"storedOutputTTL,omitempty"`
+
+	// OutputResources keeps stored output on disk, in private temp files,
+	// and serves it as MCP resources (bash-output://<id>) that truncated
+	// results link to, so clients can read all of it with resources/read.
+	// OutputResourceMaxBytes caps the bytes kept on disk in all (default
+	// 256MB); the oldest output is removed to make room.
+	OutputResources        bool  `json:"outputResources,omitempty"`
+	OutputResourceMaxBytes int64 `json:"outputResourceMaxBytes,omitempty"`
+
+	// GroupReadableFiles makes the files and directories the server creates
+	// for itself (logs, recordings, state and temp files) readable by its
+	// group, 0640 and 0750, rather than private to its user, 0600 and 0700
+	GroupReadableFiles bool `json:"groupReadableFiles,omitempty"`
+
+	// AuditLog, if set, is a file that gets a JSON line for every tool
+	// call: time, session, command, exit code, duration, output size and
+	// hash, and the client. It is rotated to AuditLog.1 when it would grow
+	// past AuditLogMaxBytes (default 100MB). AuditLogHashChain chains the
+	// entries with SHA-256 hashes so that changing, removing or adding one
+	// afterwards shows, with the head of the chain kept in AuditLog.head;
+	// -verify-audit checks a log.
+	AuditLog          string `json:"auditLog,omitempty"`
+	AuditLogMaxBytes  int64  `json:"auditLogMaxBytes,omitempty"`
+	AuditLogHashChain bool   `json:"auditLogHashChain,omitempty"`
+
+	// LogTarget is where the server's own log goes: "stderr" (default) or
+	// "journald", which sends each line to the systemd journal as an entry
+	// with a priority, and falls back to stderr where the journal socket is
+	// absent
+	LogTarget string `json:"logTarget,omitempty"`
+
+	// EventBufferSize is how many server events are buffered for the
+	// events_poll tool before the oldest are dropped (default 1000)
+	EventBufferSize int `json:"eventBufferSize,omitempty"`
+
+	// StripANSI removes ANSI escape sequences from command output and
+	// collapses carriage-return redrawn lines (progress bars) to their final
+	// state. Sessions also get TERM=dumb and NO_COLOR=1 so well-behaved tools
+	// don't emit colors. The bash tool's strip_ansi argument overrides it
+	// per call.
+	StripANSI bool `json:"stripAnsi,omitempty"`
+
+	// PTYRows and PTYCols are the window size of commands run with the bash
+	// tool's pty argument (default 24 rows by 80 columns)
+	PTYRows int `json:"ptyRows,omitempty"`
+	PTYCols int `json:"ptyCols,omitempty"`
+
+	// BypassSessionTimeout caps how long a bypassSession command may run, in
+	// seconds (default 30).
+	BypassSessionTimeout int `json:"bypassSessionTimeout,omitempty"`
+
+	// UpdateCheck enables a periodic check for newer releases (off by default)
+	UpdateCheck *UpdateCheckConfig `json:"updateCheck,omitempty"`
+
+	// DiskCheck tunes the free space warnings attached to responses
+	DiskCheck *DiskCheckConfig `json:"diskCheck,omitempty"`
+
+	// NestedMcp configures nested MCP socket discovery
+	NestedMcp *NestedMcpConfig `json:"nestedMcp,omitempty"`
+
+	// Activity, if set, shares this session's activity with other servers
+	Activity *ActivityConfig `json:"activity,omitempty"`
+
+	// RunAsUser, if set, is the user (name or uid) session shells, one-shot
+	// commands and exec programs run as, instead of the server's user.
+	// RunAsGroup overrides their group (default: the user's groups). Both
+	// need the server to run as root.
+	RunAsUser  string `json:"runAsUser,omitempty"`
+	RunAsGroup string `json:"runAsGroup,omitempty"`
+
+	// LockForceAfter, if set, lets acquire_lock's force option steal locks
+	// whose lease is older than this many seconds. Off by default.
+	LockForceAfter int `json:"lockForceAfter,omitempty"`
+
+	// Sandbox runs sessions in Linux namespaces
+	Sandbox *SandboxConfig `json:"sandbox,omitempty"`
+
+	// NetworkAccess false runs sessions, bypassSession commands and exec
+	// programs in a network namespace of their own (Linux only), so they
+	// can't reach the network. AllowLoopback keeps 127.0.0.1 working inside
+	// it, here or in the sandbox.
+	NetworkAccess *bool `json:"networkAccess,omitempty"`
+	AllowLoopback bool  `json:"allowLoopback,omitempty"`
+
+	// Limits sets rlimits on the bash session
+	Limits *LimitsConfig `json:"limits,omitempty"`
+
+	// Admission, if set, limits how many heavy commands run at once
+	Admission *AdmissionConfig `json:"admission,omitempty"`
+
+	// WriteQuota, if set, interrupts write-heavy commands that write too much
+	WriteQuota *WriteQuotaConfig `json:"writeQuota,omitempty"`
+
+	// Confirmation, if set, makes destructive tools ask for confirmation
+	Confirmation *ConfirmationConfig `json:"confirmation,omitempty"`
+
+	// Watermark, if set, marks tool response text with the call it came
+	// from, as recorded in the audit log
+	Watermark *WatermarkConfig `json:"watermark,omitempty"`
+
+	// PolicyHook, if set, must approve every command before it runs
+	PolicyHook *PolicyHookConfig `json:"policyHook,omitempty"`
+
+	// AllowedRoots, if set, confines tools to these directories: sessions
+	// start in the first, and the file tools, working_directory and exec
+	// cwd must resolve (symlinks and ".." included) to paths under one.
+	// Absolute paths outside them in commands are refused, which the shell
+	// can get around; sandbox.confineWrites closes that gap for writes.
+	AllowedRoots []string `json:"allowedRoots,omitempty"`
+
+	// Secrets are held by the server and redacted from all tool output
+	Secrets *SecretsConfig `json:"secrets,omitempty"`
+
+	// CustomTools are curated commands published as tools of their own
+	CustomTools []CustomToolConfig `json:"customTools,omitempty"`
 }
 
+// Default update check settings
+const (
+	defaultUpdateCheckURL = "https://api.github.com/repos/LaurieRhodes/mcp-bash-go/releases/latest"
+	defaultUpdateInterval = 24 // hours
+)
+
+// defaultWatermarkTag names the watermark markers by default
+const defaultWatermarkTag = "bash-output"
+
+// defaultEmptyOutputText is returned for a successful command with no output
+const defaultEmptyOutputText = "(command completed successfully with no output)"
+
+// defaultConfirmationTTL is how long a confirmation token is valid by default
+const defaultConfirmationTTL = 2 * time.Minute
+
+// defaultAuditLogMaxBytes is the size the audit log is rotated at by default
+const defaultAuditLogMaxBytes = 100 * 1024 * 1024
+
 // Default config file name
 const configFileName = "config.json"
 
@@ -35,39 +511,19 @@ const configFileName = "config.json"
 var ErrBashDisabled = errors.New("bash tool is disabled in configuration")
 
 // LoadConfig loads the configuration from a JSON file
-func LoadConfig() (*Config, error) {
-	// Get the directory of the executable
-	executablePath, err := getExecutablePath()
+func LoadConfig(opts LoadOptions) (*Config, error) {
+	configFilePath, found, searchPaths, err := locateConfigFile()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get executable path: %w", err)
+		return nil, err
 	}
-
-	fmt.Fprintf(os.Stderr, "Executable directory: %s\n", executablePath)
-
-	// Build the path to the config file
-	configFilePath := filepath.Join(executablePath, configFileName)
-	fmt.Fprintf(os.Stderr, "Looking for config file at: %s\n", configFilePath)
-
-	// Check if the config file exists
-	if _, err := os.Stat(configFilePath); os.IsNotExist(err) {
-		// Try in current working directory as fallback
-		cwd, err := os.Getwd()
+	if !found {
+		// Create a default config if none exists
+		fmt.Fprintf(os.Stderr, "No config file found, creating default in executable directory\n")
+		config, err := createDefaultConfig(configFilePath)
 		if err == nil {
-			cwdConfigPath := filepath.Join(cwd, configFileName)
-			fmt.Fprintf(os.Stderr, "Config not found in executable directory, checking current directory: %s\n", cwdConfigPath)
-
-			if _, err := os.Stat(cwdConfigPath); err == nil {
-				configFilePath = cwdConfigPath
-				fmt.Fprintf(os.Stderr, "Found config file in current directory\n")
-			} else {
-				// Create a default config if none exists
-				fmt.Fprintf(os.Stderr, "No config file found, creating default in executable directory\n")
-				return createDefaultConfig(configFilePath)
-			}
-		} else {
-			fmt.Fprintf(os.Stderr, "No config file found, creating default in executable directory\n")
-			return createDefaultConfig(configFilePath)
+			config.Path, config.SearchPaths = configFilePath, searchPaths
 		}
+		return config, err
 	}
 
 	// Read the config file
@@ -77,8 +533,18 @@ func LoadConfig() (*Config, error) {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
+	// Translate settings from older releases, warning once for all of them
+	file, changes, err := migrate(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if len(changes) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %s uses deprecated settings, translated for this run:\n  %s\n"+
+			"Run with -migrate-config to rewrite the file.\n", configFilePath, strings.Join(changes, "\n  "))
+	}
+
 	// Parse the config file
-	config := &Config{}
+	config := &Config{Path: configFilePath, SearchPaths: searchPaths}
 	if err := json.Unmarshal(file, config); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
@@ -92,6 +558,277 @@ func LoadConfig() (*Config, error) {
 		config.CommandTimeout = 600 // default 10 minutes - allows longer workflows
 	}
 
+	switch config.TimeoutMode {
+	case "":
+		config.TimeoutMode = "total"
+	case "total", "idle":
+	default:
+		return nil, fmt.Errorf("invalid timeoutMode %q (expected \"total\" or \"idle\")", config.TimeoutMode)
+	}
+	if config.TimeoutMode == "idle" && config.MaxTotalSeconds == 0 {
+		config.MaxTotalSeconds = 3600 // default 1 hour ceiling for idle mode
+	}
+
+	if config.SessionIdleTimeout < 0 {
+		return nil, fmt.Errorf("invalid sessionIdleTimeout %d (must not be negative)", config.SessionIdleTimeout)
+	}
+	if config.HistorySize < 0 {
+		return nil, fmt.Errorf("invalid historySize %d (must not be negative)", config.HistorySize)
+	}
+	if config.MaxQueuedCommands < 0 {
+		return nil, fmt.Errorf("invalid maxQueuedCommands %d (must not be negative)", config.MaxQueuedCommands)
+	}
+	if config.MaxBackgroundJobs < 0 {
+		return nil, fmt.Errorf("invalid maxBackgroundJobs %d (must not be negative)", config.MaxBackgroundJobs)
+	}
+
+	if config.SlowCommandThresholdMs < 0 {
+		return nil, fmt.Errorf("invalid slowCommandThresholdMs %d (must not be negative)", config.SlowCommandThresholdMs)
+	}
+
+	if config.MaxOutputBytes < 0 {
+		return nil, fmt.Errorf("invalid maxOutputBytes %d (must not be negative)", config.MaxOutputBytes)
+	}
+
+	if config.ReadFileMaxBytes < 0 {
+		return nil, fmt.Errorf("invalid readFileMaxBytes %d (must not be negative)", config.ReadFileMaxBytes)
+	}
+
+	if config.MaxLineBytes < 0 {
+		return nil, fmt.Errorf("invalid maxLineBytes %d (must not be negative)", config.MaxLineBytes)
+	}
+
+	switch config.TruncationMode {
+	case "":
+		config.TruncationMode = "head"
+	case "head", "tail", "both":
+	default:
+		return nil, fmt.Errorf("invalid truncationMode %q (expected \"head\", \"tail\" or \"both\")", config.TruncationMode)
+	}
+
+	switch config.LogTarget {
+	case "", "stderr", "journald":
+	default:
+		return nil, fmt.Errorf("invalid logTarget %q (expected \"stderr\" or \"journald\")", config.LogTarget)
+	}
+
+	if config.PTYRows < 0 || config.PTYRows > 65535 {
+		return nil, fmt.Errorf("invalid ptyRows %d (expected 0-65535)", config.PTYRows)
+	}
+
+	if config.PTYCols < 0 || config.PTYCols > 65535 {
+		return nil, fmt.Errorf("invalid ptyCols %d (expected 0-65535)", config.PTYCols)
+	}
+
+	if config.StoredOutputTTL < 0 {
+		return nil, fmt.Errorf("invalid storedOutputTTL %d (must not be negative)", config.StoredOutputTTL)
+	}
+
+	if config.OutputResourceMaxBytes < 0 {
+		return nil, fmt.Errorf("invalid outputResourceMaxBytes %d (must not be negative)",
+			config.OutputResourceMaxBytes)
+	}
+
+	if config.OutputResources && config.StoredOutputBytes < 0 {
+		return nil, fmt.Errorf("outputResources requires stored output (storedOutputBytes must not be negative)")
+	}
+
+	if limits := config.Limits; limits != nil {
+		if limits.CPUSeconds < 0 || limits.MemoryBytes < 0 || limits.MaxFileSize < 0 ||
+			limits.MaxOpenFiles < 0 || limits.MaxProcesses < 0 {
+			return nil, fmt.Errorf("invalid limits (must not be negative)")
+		}
+	}
+
+	if admission := config.Admission; admission != nil {
+		if admission.Units <= 0 {
+			return nil, fmt.Errorf("invalid admission.units %d (must be positive)", admission.Units)
+		}
+		if admission.MaxWaitSeconds < 0 {
+			return nil, fmt.Errorf("invalid admission.maxWaitSeconds %d (must not be negative)",
+				admission.MaxWaitSeconds)
+		}
+		for i := range admission.HeavyCommands {
+			heavy := &admission.HeavyCommands[i]
+			if _, err := regexp.Compile(heavy.Pattern); err != nil || heavy.Pattern == "" {
+				return nil, fmt.Errorf("invalid admission.heavyCommands pattern %q", heavy.Pattern)
+			}
+			if heavy.Units == 0 {
+				heavy.Units = 1
+			}
+			if heavy.Units < 0 || heavy.Units > admission.Units {
+				return nil, fmt.Errorf("invalid admission.heavyCommands units %d for %q (expected 1-%d)",
+					heavy.Units, heavy.Pattern, admission.Units)
+			}
+			if heavy.Label == "" {
+				heavy.Label = heavy.Pattern
+			}
+		}
+	}
+
+	if quota := config.WriteQuota; quota != nil {
+		if quota.MaxMB <= 0 {
+			return nil, fmt.Errorf("invalid writeQuota.maxMB %d (must be positive)", quota.MaxMB)
+		}
+		if len(quota.Commands) == 0 {
+			return nil, fmt.Errorf("writeQuota.commands must list at least one pattern")
+		}
+		for _, pattern := range quota.Commands {
+			if _, err := regexp.Compile(pattern); err != nil || pattern == "" {
+				return nil, fmt.Errorf("invalid writeQuota.commands pattern %q", pattern)
+			}
+		}
+		if quota.Directory != "" && !filepath.IsAbs(quota.Directory) {
+			return nil, fmt.Errorf("writeQuota.directory %q must be an absolute path", quota.Directory)
+		}
+		if quota.PollIntervalMs < 0 {
+			return nil, fmt.Errorf("invalid writeQuota.pollIntervalMs %d (must not be negative)",
+				quota.PollIntervalMs)
+		}
+	}
+
+	if confirmation := config.Confirmation; confirmation != nil {
+		for _, tool := range confirmation.Tools {
+			if !slices.Contains(ConfirmableTools, tool) {
+				return nil, fmt.Errorf("invalid confirmation.tools entry %q (expected one of %s)", tool,
+					strings.Join(ConfirmableTools, ", "))
+			}
+		}
+		if confirmation.TTLSeconds < 0 {
+			return nil, fmt.Errorf("invalid confirmation.ttlSeconds %d (must not be negative)",
+				confirmation.TTLSeconds)
+		}
+	}
+
+	for i := range config.CustomTools {
+		if err := validateCustomTool(&config.CustomTools[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.LockForceAfter < 0 {
+		return nil, fmt.Errorf("invalid lockForceAfter %d (must not be negative)", config.LockForceAfter)
+	}
+
+	if config.IsSandboxEnabled() {
+		if runtime.GOOS != "linux" {
+			return nil, fmt.Errorf("sandbox is only supported on Linux (it uses Linux namespaces); "+
+				"remove the sandbox section or set enabled to false on %s", runtime.GOOS)
+		}
+		if config.RunAsUser != "" {
+			return nil, fmt.Errorf("sandbox can't be combined with runAsUser")
+		}
+		for _, path := range config.Sandbox.ReadOnlyPaths {
+			if !filepath.IsAbs(path) {
+				return nil, fmt.Errorf("invalid sandbox.readOnlyPaths entry %q (must be absolute)", path)
+			}
+			if info, err := os.Stat(path); err != nil || !info.IsDir() {
+				return nil, fmt.Errorf("invalid sandbox.readOnlyPaths entry %q (not a directory)", path)
+			}
+		}
+	}
+
+	for _, root := range config.AllowedRoots {
+		if !filepath.IsAbs(root) {
+			return nil, fmt.Errorf("invalid allowedRoots entry %q (must be absolute)", root)
+		}
+	}
+	if len(config.AllowedRoots) > 0 && config.PathJail != "" {
+		return nil, fmt.Errorf("allowedRoots can't be combined with pathJail")
+	}
+	if config.IsSandboxEnabled() && config.Sandbox.ConfineWrites && len(config.AllowedRoots) == 0 {
+		return nil, fmt.Errorf("sandbox.confineWrites requires allowedRoots")
+	}
+
+	if config.IsNetworkAccessDisabled() {
+		if runtime.GOOS != "linux" {
+			return nil, fmt.Errorf("networkAccess false is only supported on Linux (it uses a network "+
+				"namespace); remove it on %s", runtime.GOOS)
+		}
+		if config.RunAsUser != "" {
+			return nil, fmt.Errorf("networkAccess false can't be combined with runAsUser")
+		}
+	}
+	if config.AllowLoopback && !config.IsNetworkAccessDisabled() && !config.IsSandboxEnabled() {
+		return nil, fmt.Errorf("allowLoopback only applies with networkAccess false or the sandbox")
+	}
+
+	if config.RunAsGroup != "" && config.RunAsUser == "" {
+		return nil, fmt.Errorf("runAsGroup requires runAsUser")
+	}
+
+	if config.Activity != nil && config.Activity.LoadWarning < 0 {
+		return nil, fmt.Errorf("invalid activity.loadWarning %v (must not be negative)", config.Activity.LoadWarning)
+	}
+
+	if config.AuditLogMaxBytes < 0 {
+		return nil, fmt.Errorf("invalid auditLogMaxBytes %d (must not be negative)", config.AuditLogMaxBytes)
+	}
+	if config.AuditLogHashChain && config.AuditLog == "" {
+		return nil, fmt.Errorf("auditLogHashChain requires auditLog")
+	}
+	if watermark := config.Watermark; watermark != nil {
+		if config.AuditLog == "" {
+			return nil, fmt.Errorf("watermark requires auditLog, which the markers are checked against")
+		}
+		if watermark.Tag != "" && !watermarkTag.MatchString(watermark.Tag) {
+			return nil, fmt.Errorf("invalid watermark.tag %q (expected letters, digits, '_', '.' and '-')",
+				watermark.Tag)
+		}
+	}
+
+	if config.EventBufferSize < 0 {
+		return nil, fmt.Errorf("invalid eventBufferSize %d (must not be negative)", config.EventBufferSize)
+	}
+
+	if config.MaxTimeout < 0 {
+		return nil, fmt.Errorf("invalid maxTimeout %d (must not be negative)", config.MaxTimeout)
+	}
+
+	if config.Shell == "" {
+		config.Shell = "bash"
+	}
+
+	if config.RCFile != "" {
+		if rest, ok := strings.CutPrefix(config.RCFile, "~/"); ok {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, fmt.Errorf("invalid rcFile %q: %w", config.RCFile, err)
+			}
+			config.RCFile = filepath.Join(home, rest)
+		}
+		if info, err := os.Stat(config.RCFile); err != nil || info.IsDir() {
+			return nil, fmt.Errorf("invalid rcFile %q: not a readable file", config.RCFile)
+		}
+	}
+
+	if err := checkIntegrity(config, opts); err != nil {
+		return nil, err
+	}
+
+	for i, command := range config.StartupCommands {
+		if strings.TrimSpace(command) == "" {
+			return nil, fmt.Errorf("invalid startupCommands: entry %d is empty", i)
+		}
+	}
+
+	if config.BypassSessionTimeout == 0 {
+		config.BypassSessionTimeout = 30
+	}
+
+	if config.UpdateCheck != nil && config.UpdateCheck.Enabled {
+		if config.UpdateCheck.URL == "" {
+			config.UpdateCheck.URL = defaultUpdateCheckURL
+		}
+		if config.UpdateCheck.IntervalHours <= 0 {
+			config.UpdateCheck.IntervalHours = defaultUpdateInterval
+		}
+	}
+
+	if config.OrderedResponses && config.OrderedResponseMaxWait == 0 {
+		config.OrderedResponseMaxWait = 5
+	}
+
 	// Set network defaults only when network mode is explicitly configured
 	if config.Network != nil && config.Network.Enabled {
 		if config.Network.Host == "" {
@@ -104,6 +841,9 @@ func LoadConfig() (*Config, error) {
 
 	fmt.Fprintf(os.Stderr, "Configuration loaded successfully\n")
 	fmt.Fprintf(os.Stderr, "Command timeout: %d seconds\n", config.CommandTimeout)
+	if config.TimeoutMode == "idle" {
+		fmt.Fprintf(os.Stderr, "Timeout mode: idle (max total %d seconds)\n", config.MaxTotalSeconds)
+	}
 	if config.Network != nil && config.Network.Enabled {
 		fmt.Fprintf(os.Stderr, "Network mode: enabled (%s:%d)\n", config.Network.Host, config.Network.Port)
 	} else {
@@ -112,11 +852,199 @@ func LoadConfig() (*Config, error) {
 	return config, nil
 }
 
+// validateCustomTool checks a custom tool's declaration, filling in default
+// parameter types. The command template is checked where it is parsed.
+func validateCustomTool(tool *CustomToolConfig) error {
+	if !customToolName.MatchString(tool.Name) {
+		return fmt.Errorf("invalid customTools name %q (expected letters, digits and underscores)", tool.Name)
+	}
+	if strings.TrimSpace(tool.Description) == "" {
+		return fmt.Errorf("customTools %s: description is required", tool.Name)
+	}
+	if strings.TrimSpace(tool.Command) == "" {
+		return fmt.Errorf("customTools %s: command is required", tool.Name)
+	}
+	for name, param := range tool.Parameters {
+		if !customToolName.MatchString(name) {
+			return fmt.Errorf("customTools %s: invalid parameter name %q", tool.Name, name)
+		}
+		if param.Type == "" {
+			param.Type = "string"
+		}
+		if !slices.Contains(CustomToolParameterTypes, param.Type) {
+			return fmt.Errorf("customTools %s: parameter %s has invalid type %q (expected one of %s)", tool.Name,
+				name, param.Type, strings.Join(CustomToolParameterTypes, ", "))
+		}
+		if (len(param.Enum) > 0 || param.Pattern != "") && param.Type != "string" {
+			return fmt.Errorf("customTools %s: parameter %s: enum and pattern only apply to strings", tool.Name, name)
+		}
+		if _, err := regexp.Compile(param.Pattern); err != nil {
+			return fmt.Errorf("customTools %s: parameter %s has invalid pattern: %w", tool.Name, name, err)
+		}
+		if param.Required && param.Default != nil {
+			return fmt.Errorf("customTools %s: parameter %s is required, so can't have a default", tool.Name, name)
+		}
+		tool.Parameters[name] = param
+	}
+	return nil
+}
+
+// LoadCustomTools re-reads the customTools of the config file at path, for
+// a reload, and validates every tool. It returns all the problems found, not
+// just the first, so they can be fixed in one go; the tools are only usable
+// if there are none. The rest of the file is ignored: other settings only
+// change on restart.
+func LoadCustomTools(path string, opts LoadOptions) ([]CustomToolConfig, []error) {
+	if integrityChecked {
+		if info, err := os.Stat(path); err == nil {
+			if exposure := fileExposure(info); exposure != "" {
+				problem := fmt.Errorf("config file %s is %s", path, exposure)
+				if !opts.AllowInsecure {
+					return nil, []error{fmt.Errorf("refusing to reload: %w", problem)}
+				}
+				fmt.Fprintf(os.Stderr, "Warning: other users could change what this server runs: %v\n", problem)
+			}
+		}
+	}
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return nil, []error{fmt.Errorf("failed to read config file: %w", err)}
+	}
+	file, _, err = migrate(file)
+	if err != nil {
+		return nil, []error{fmt.Errorf("failed to parse config file: %w", err)}
+	}
+	var parsed struct {
+		CustomTools []CustomToolConfig `json:"customTools"`
+	}
+	if err := json.Unmarshal(file, &parsed); err != nil {
+		return nil, []error{fmt.Errorf("failed to parse config file: %w", err)}
+	}
+
+	var problems []error
+	seen := make(map[string]bool)
+	for i := range parsed.CustomTools {
+		tool := &parsed.CustomTools[i]
+		if err := validateCustomTool(tool); err != nil {
+			problems = append(problems, err)
+		}
+		if seen[tool.Name] {
+			problems = append(problems, fmt.Errorf("customTools %s is declared twice", tool.Name))
+		}
+		seen[tool.Name] = true
+	}
+	return parsed.CustomTools, problems
+}
+
 // GetTimeout returns the command timeout as a duration
 func (c *Config) GetTimeout() time.Duration {
 	return time.Duration(c.CommandTimeout) * time.Second
 }
 
+// GetMaxTotal returns the idle-mode run time ceiling as a duration
+func (c *Config) GetMaxTotal() time.Duration {
+	return time.Duration(c.MaxTotalSeconds) * time.Second
+}
+
+// GetMaxTimeout returns the per-call timeout cap as a duration (0 = default)
+func (c *Config) GetMaxTimeout() time.Duration {
+	return time.Duration(c.MaxTimeout) * time.Second
+}
+
+// GetSessionIdleTimeout returns the idle session timeout as a duration
+func (c *Config) GetSessionIdleTimeout() time.Duration {
+	return time.Duration(c.SessionIdleTimeout) * time.Second
+}
+
+// GetLockForceAfter returns the lease age after which locks may be stolen,
+// or 0 if they may not
+func (c *Config) GetLockForceAfter() time.Duration {
+	return time.Duration(c.LockForceAfter) * time.Second
+}
+
+// IsSandboxEnabled reports whether sessions run in a namespace sandbox
+func (c *Config) IsSandboxEnabled() bool {
+	return c.Sandbox != nil && c.Sandbox.Enabled
+}
+
+// IsNetworkAccessDisabled reports whether sessions are cut off from the
+// network
+func (c *Config) IsNetworkAccessDisabled() bool {
+	return c.NetworkAccess != nil && !*c.NetworkAccess
+}
+
+// GetEmptyOutputText returns the text returned for a successful command with
+// no output
+func (c *Config) GetEmptyOutputText() string {
+	if c.EmptyOutputText == nil {
+		return defaultEmptyOutputText
+	}
+	return *c.EmptyOutputText
+}
+
+// GetAuditLogMaxBytes returns the size the audit log is rotated at
+func (c *Config) GetAuditLogMaxBytes() int64 {
+	if c.AuditLogMaxBytes == 0 {
+		return defaultAuditLogMaxBytes
+	}
+	return c.AuditLogMaxBytes
+}
+
+// GetTTL returns how long a confirmation token is valid
+func (c *ConfirmationConfig) GetTTL() time.Duration {
+	if c.TTLSeconds == 0 {
+		return defaultConfirmationTTL
+	}
+	return time.Duration(c.TTLSeconds) * time.Second
+}
+
+// GetSlowCommandThreshold returns the slow-command threshold as a duration
+func (c *Config) GetSlowCommandThreshold() time.Duration {
+	return time.Duration(c.SlowCommandThresholdMs) * time.Millisecond
+}
+
+// GetStoredOutputTTL returns how long truncated output is stored (0 = default)
+func (c *Config) GetStoredOutputTTL() time.Duration {
+	return time.Duration(c.StoredOutputTTL) * time.Second
+}
+
+// GetBypassTimeout returns the bypassSession command timeout as a duration
+func (c *Config) GetBypassTimeout() time.Duration {
+	return time.Duration(c.BypassSessionTimeout) * time.Second
+}
+
+// GetOrderedResponseMaxWait returns the ordered-response safety valve as a duration
+func (c *Config) GetOrderedResponseMaxWait() time.Duration {
+	return time.Duration(c.OrderedResponseMaxWait) * time.Second
+}
+
+// GetClientRequestTimeout returns the configured client timeout hint as a duration
+func (c *Config) GetClientRequestTimeout() time.Duration {
+	return time.Duration(c.ClientRequestTimeoutSeconds) * time.Second
+}
+
+// IsUpdateCheckEnabled returns true if the update check is explicitly enabled
+func (c *Config) IsUpdateCheckEnabled() bool {
+	return c.UpdateCheck != nil && c.UpdateCheck.Enabled
+}
+
+// GetWatermarkTag returns the tag of the watermark markers, or "" if
+// watermarking is off
+func (c *Config) GetWatermarkTag() string {
+	if c.Watermark == nil {
+		return ""
+	}
+	if c.Watermark.Tag == "" {
+		return defaultWatermarkTag
+	}
+	return c.Watermark.Tag
+}
+
+// IsDiskCheckEnabled returns true unless the disk space check is disabled
+func (c *Config) IsDiskCheckEnabled() bool {
+	return c.DiskCheck == nil || !c.DiskCheck.Disabled
+}
+
 // IsNetworkEnabled returns true if network mode is explicitly enabled
 func (c *Config) IsNetworkEnabled() bool {
 	return c.Network != nil && c.Network.Enabled
@@ -141,25 +1069,10 @@ func createDefaultConfig(configFilePath string) (*Config, error) {
 	}
 
 	// Write the config file
-	if err := os.WriteFile(configFilePath, jsonData, 0644); err != nil {
+	if err := perms.WriteFile(configFilePath, jsonData); err != nil {
 		return nil, fmt.Errorf("failed to write default config file: %w", err)
 	}
 
 	fmt.Fprintf(os.Stderr, "Created default config file at %s\n", configFilePath)
 	return config, nil
 }
-
-// getExecutablePath returns the directory of the current executable
-func getExecutablePath() (string, error) {
-	execPath, err := os.Executable()
-	if err != nil {
-		return "", err
-	}
-
-	realPath, err := filepath.EvalSymlinks(execPath)
-	if err != nil {
-		realPath = execPath
-	}
-
-	return filepath.Dir(realPath), nil
-}
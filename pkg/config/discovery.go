@@ -0,0 +1,107 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// locateConfigFile returns the config file's path, the first of the search
+// paths that has one, and every candidate checked. If none has one, found is
+// false and the path is where a default should be created: the first
+// candidate.
+func locateConfigFile() (path string, found bool, candidates []string, err error) {
+	dirs, err := configSearchDirs()
+	if err != nil {
+		return "", false, nil, err
+	}
+	for _, dir := range dirs {
+		candidates = append(candidates, filepath.Join(dir, configFileName))
+	}
+
+	for _, candidate := range candidates {
+		_, err := os.Stat(candidate)
+		switch {
+		case err == nil:
+			fmt.Fprintf(os.Stderr, "Config file found at %s (checked: %s)\n", candidate,
+				strings.Join(candidates, ", "))
+			return candidate, true, candidates, nil
+		case os.IsNotExist(err):
+			fmt.Fprintf(os.Stderr, "No config file at %s\n", candidate)
+		default:
+			// Unreadable rather than missing: stop here so a default isn't
+			// created in place of a config the server can't see
+			fmt.Fprintf(os.Stderr, "Config file at %s can't be checked (checked: %s)\n", candidate,
+				strings.Join(candidates, ", "))
+			return candidate, true, candidates, nil
+		}
+	}
+	return candidates[0], false, candidates, nil
+}
+
+// configSearchDirs returns the directories config.json is looked for in, in
+// order, without duplicates:
+//
+//  1. the directory of the executable with every symlink resolved
+//  2. the directory of the symlink it was started through, if any
+//  3. the current directory
+//
+// A symlink that can't be resolved (some network filesystems) is reported
+// and its own directory used, rather than falling back silently.
+func configSearchDirs() ([]string, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get executable path: %w", err)
+	}
+
+	var dirs []string
+	add := func(dir string) {
+		for _, seen := range dirs {
+			if seen == dir {
+				return
+			}
+		}
+		dirs = append(dirs, dir)
+	}
+
+	resolved, err := filepath.EvalSymlinks(executable)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not resolve symlinks in executable path %s: %v\n", executable, err)
+		resolved = executable
+	}
+	add(filepath.Dir(resolved))
+
+	// os.Executable is already resolved on Linux, so the name the server
+	// was started by is the only record of a symlink
+	if invoked := invokedPath(); invoked != "" {
+		add(filepath.Dir(invoked))
+	}
+
+	if cwd, err := os.Getwd(); err == nil {
+		add(cwd)
+	}
+	return dirs, nil
+}
+
+// invokedPath returns the absolute path the server was started by, symlinks
+// left in place, or "" if it can't be told
+func invokedPath() string {
+	if len(os.Args) == 0 || os.Args[0] == "" {
+		return ""
+	}
+	name := os.Args[0]
+	if !strings.ContainsRune(name, filepath.Separator) {
+		found, err := exec.LookPath(name)
+		if err != nil {
+			return ""
+		}
+		name = found
+	}
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return ""
+	}
+	return abs
+}
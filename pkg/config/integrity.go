@@ -0,0 +1,67 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// LoadOptions changes how LoadConfig treats the file it loads
+type LoadOptions struct {
+	// AllowInsecure only warns about a config.json, or a file it names,
+	// that users other than the server's own and root could modify, instead
+	// of refusing to start
+	AllowInsecure bool
+}
+
+// checkIntegrity refuses a config that someone else on the host could have
+// written. The config decides what the server runs (rcFile, policy hook,
+// startup commands), so a config.json or referenced file that other users
+// can modify would let them run commands as the server's user.
+func checkIntegrity(config *Config, opts LoadOptions) error {
+	if !integrityChecked {
+		fmt.Fprintf(os.Stderr, "Note: config file permissions are not checked on %s\n", runtime.GOOS)
+		return nil
+	}
+
+	type trustedFile struct{ what, path string }
+	files := []trustedFile{{"config file", config.Path}}
+	if config.RCFile != "" {
+		files = append(files, trustedFile{"rcFile", config.RCFile})
+	}
+	if config.Secrets != nil && config.Secrets.File != "" {
+		files = append(files, trustedFile{"secrets file", config.Secrets.File})
+	}
+	if hook := config.PolicyHook; hook != nil && len(hook.Command) > 0 {
+		// A bare name is looked up like the hook will be; a program that
+		// can't be found fails when the hook runs instead
+		if program, err := exec.LookPath(hook.Command[0]); err == nil {
+			files = append(files, trustedFile{"policyHook program", program})
+		}
+	}
+
+	var problems []string
+	for _, file := range files {
+		info, err := os.Stat(file.path)
+		if err != nil {
+			continue // reported where the file is used
+		}
+		if exposure := fileExposure(info); exposure != "" {
+			problems = append(problems, fmt.Sprintf("%s %s is %s", file.what, file.path, exposure))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+
+	if opts.AllowInsecure {
+		fmt.Fprintf(os.Stderr, "Warning: other users could change what this server runs:\n  %s\n",
+			strings.Join(problems, "\n  "))
+		return nil
+	}
+	return fmt.Errorf("refusing to load a config other users could change:\n  %s\n"+
+		"Remove group and other write access (chmod go-w) and make the files owned by the server's user or "+
+		"root, or start with -allow-insecure-config to only warn", strings.Join(problems, "\n  "))
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package config
+
+import "os"
+
+// fileExposure is not implemented without Unix permissions: Windows ACLs
+// would need checking instead, so no file is reported
+func fileExposure(info os.FileInfo) string {
+	return ""
+}
+
+// integrityChecked reports whether this platform checks file permissions
+const integrityChecked = false
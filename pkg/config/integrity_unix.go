@@ -0,0 +1,26 @@
+//go:build unix
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// fileExposure says how users other than the server's own and root could
+// modify a file, or returns "" if they can't
+func fileExposure(info os.FileInfo) string {
+	if mode := info.Mode().Perm(); mode&0022 != 0 {
+		return fmt.Sprintf("writable by group or others (mode %04o)", mode)
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		if uid := int(stat.Uid); uid != 0 && uid != os.Geteuid() {
+			return fmt.Sprintf("owned by uid %d, not the server's user (uid %d) or root", uid, os.Geteuid())
+		}
+	}
+	return ""
+}
+
+// integrityChecked reports whether this platform checks file permissions
+const integrityChecked = true
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// migration translates one settings shape from an older release into the
+// current one. apply edits the top-level fields in place and reports whether
+// the file used the old shape; change describes it for the deprecation
+// warning as "old -> new".
+type migration struct {
+	change string
+	apply  func(fields map[string]json.RawMessage) (bool, error)
+}
+
+// migrations are applied in order, so a later one sees the result of the
+// earlier ones
+var migrations = []migration{
+	{
+		// Before 1.1.1 the network section was a struct, so every generated
+		// config.json carried a disabled one
+		change: `"network": {"enabled": false, ...} -> no network section`,
+		apply:  dropDisabledNetwork,
+	},
+}
+
+// dropDisabledNetwork removes a network section that doesn't enable network
+// mode
+func dropDisabledNetwork(fields map[string]json.RawMessage) (bool, error) {
+	raw, ok := fields["network"]
+	if !ok || string(raw) == "null" {
+		return false, nil
+	}
+	var network struct {
+		Enabled bool `json:"enabled"`
+	}
+	if err := json.Unmarshal(raw, &network); err != nil {
+		return false, fmt.Errorf("invalid network section: %w", err)
+	}
+	if network.Enabled {
+		return false, nil
+	}
+	delete(fields, "network")
+	return true, nil
+}
+
+// migrate applies the migrations to a config file's contents. It returns the
+// contents unchanged, and no changes, when none apply.
+func migrate(data []byte) ([]byte, []string, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, nil, err
+	}
+	var changes []string
+	for _, m := range migrations {
+		applied, err := m.apply(fields)
+		if err != nil {
+			return nil, nil, err
+		}
+		if applied {
+			changes = append(changes, m.change)
+		}
+	}
+	if len(changes) == 0 {
+		return data, nil, nil
+	}
+	migrated, err := json.MarshalIndent(fields, "", "  ")
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(migrated, '\n'), changes, nil
+}
+
+// MigrateFile rewrites the config file in the current format, keeping the
+// original as a .bak file alongside it. It returns the file's path and the
+// changes made, none if the file was already current.
+func MigrateFile() (string, []string, error) {
+	path, found, _, err := locateConfigFile()
+	if err != nil {
+		return "", nil, err
+	}
+	if !found {
+		return "", nil, fmt.Errorf("no %s found in the executable's directory or the current one", configFileName)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	migrated, changes, err := migrate(data)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if len(changes) == 0 {
+		return path, nil, nil
+	}
+
+	// The original is loaded through the same migrations, so the rewritten
+	// file loads identically as long as it needs no further migration
+	if _, again, err := migrate(migrated); err != nil || len(again) > 0 {
+		return "", nil, fmt.Errorf("migrating %s left deprecated settings; file left unchanged", path)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", nil, err
+	}
+	// The backup and the rewrite keep the mode the user gave the config
+	if err := os.WriteFile(path+".bak", data, info.Mode().Perm()); err != nil {
+		return "", nil, fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := os.WriteFile(path, migrated, info.Mode().Perm()); err != nil {
+		return "", nil, fmt.Errorf("failed to write migrated config: %w", err)
+	}
+	return path, changes, nil
+}
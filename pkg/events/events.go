@@ -0,0 +1,157 @@
+// Package events buffers server events (session lifecycle, warnings, job
+// completions, policy denials, orphaned processes) for clients that can't
+// receive notifications and poll for them instead, through the events_poll
+// tool.
+//
+// Events are numbered in the order they were published. A client reads the
+// events after the last sequence number it acknowledged; once the buffer is
+// full the oldest events are dropped, and the next poll says how many the
+// client missed.
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultBufferSize is how many events are kept when no size is configured
+const DefaultBufferSize = 1000
+
+// Event kinds
+const (
+	SessionStarted = "session.started"
+	SessionClosed  = "session.closed"
+	SessionOrphans = "session.orphans"
+	Warning        = "warning"
+	JobCompleted   = "job.completed"
+	PolicyDenied   = "policy.denied"
+	// Overflow marks events dropped before they were acknowledged. It is
+	// never published; Poll puts it in front of what survived.
+	Overflow = "overflow"
+)
+
+// Event is one buffered server event
+type Event struct {
+	Seq     uint64                 `json:"seq"`
+	Time    time.Time              `json:"time"`
+	Kind    string                 `json:"kind"`
+	Message string                 `json:"message"`
+	Data    map[string]interface{} `json:"data,omitempty"`
+}
+
+// Bus is a bounded ring buffer of events. A nil *Bus discards everything, so
+// producers needn't check whether polling is enabled.
+type Bus struct {
+	mutex  sync.Mutex
+	events []Event // oldest first
+	size   int
+	seq    uint64
+	acked  uint64
+
+	// droppedFrom and droppedTo are the sequence numbers of events dropped
+	// unacknowledged, while droppedCount is non-zero
+	droppedCount uint64
+	droppedFrom  uint64
+	droppedTo    uint64
+}
+
+// NewBus creates a bus keeping up to size events (DefaultBufferSize if size
+// is not positive)
+func NewBus(size int) *Bus {
+	if size <= 0 {
+		size = DefaultBufferSize
+	}
+	return &Bus{size: size}
+}
+
+// Publish adds an event, dropping the oldest if the buffer is full
+func (b *Bus) Publish(kind, message string, data map[string]interface{}) {
+	if b == nil {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.seq++
+	if len(b.events) == b.size {
+		dropped := b.events[0]
+		b.events = b.events[1:]
+		if dropped.Seq > b.acked {
+			if b.droppedCount == 0 {
+				b.droppedFrom = dropped.Seq
+			}
+			b.droppedCount++
+			b.droppedTo = dropped.Seq
+		}
+	}
+	b.events = append(b.events, Event{
+		Seq:     b.seq,
+		Time:    time.Now().UTC(),
+		Kind:    kind,
+		Message: message,
+		Data:    data,
+	})
+}
+
+// Page is the result of a poll
+type Page struct {
+	Events []Event `json:"events"`
+	// Acked is the sequence number acknowledged so far; pass LastSeq as the
+	// next poll's ack
+	Acked   uint64 `json:"acked"`
+	LastSeq uint64 `json:"lastSeq"`
+	// More is set when events remain beyond limit
+	More bool `json:"more"`
+}
+
+// Poll acknowledges every event up to ack, discarding them, and returns up to
+// limit of the events after the acknowledged one. An ack lower than one
+// already given changes nothing, so a repeated poll returns the same events.
+// Events dropped unacknowledged are reported by an Overflow event first.
+func (b *Bus) Poll(ack uint64, limit int) Page {
+	if b == nil {
+		return Page{Events: []Event{}}
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if ack > b.seq {
+		ack = b.seq
+	}
+	if ack > b.acked {
+		b.acked = ack
+		kept := 0
+		for kept < len(b.events) && b.events[kept].Seq <= ack {
+			kept++
+		}
+		b.events = append([]Event(nil), b.events[kept:]...)
+		if b.droppedCount > 0 && b.droppedTo <= ack {
+			b.droppedCount = 0
+		}
+	}
+
+	page := Page{Events: []Event{}, Acked: b.acked, LastSeq: b.acked}
+	if b.droppedCount > 0 {
+		page.Events = append(page.Events, Event{
+			Seq:     b.droppedTo,
+			Time:    time.Now().UTC(),
+			Kind:    Overflow,
+			Message: "events were dropped before they were acknowledged; the buffer is full",
+			Data: map[string]interface{}{
+				"dropped": b.droppedCount,
+				"fromSeq": b.droppedFrom,
+				"toSeq":   b.droppedTo,
+			},
+		})
+		page.LastSeq = b.droppedTo
+	}
+	for _, event := range b.events {
+		if limit > 0 && len(page.Events) >= limit {
+			page.More = true
+			break
+		}
+		page.Events = append(page.Events, event)
+		page.LastSeq = event.Seq
+	}
+	return page
+}
@@ -0,0 +1,204 @@
+// Package journald sends log entries to the systemd journal over its native
+// protocol: one datagram per entry to the journal socket, with no cgo and no
+// libsystemd. An entry too large for a datagram is written to a sealed
+// memfd (or, failing that, an unlinked file in /dev/shm) whose descriptor
+// is sent instead, as sd_journal_send does.
+//
+// Handler adapts a Writer to log/slog, mapping the record's level to
+// PRIORITY, its message to MESSAGE, and its attributes to fields of their
+// own, so the journal can filter on them (journalctl REQUEST_ID=7).
+package journald
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// DefaultSocket is where journald listens for native protocol entries
+const DefaultSocket = "/run/systemd/journal/socket"
+
+// Syslog priorities, as the PRIORITY field carries them
+const (
+	PriorityErr     = 3
+	PriorityWarning = 4
+	PriorityInfo    = 6
+	PriorityDebug   = 7
+)
+
+// maxFieldName is the longest field name journald accepts
+const maxFieldName = 64
+
+// Field is one field of a journal entry
+type Field struct {
+	Name  string
+	Value string
+}
+
+// Encode serializes fields in the native protocol. A value without a
+// newline is sent as NAME=value; any other as the name, a newline, the
+// value's length as a little-endian 64-bit integer, and the value.
+func Encode(fields []Field) []byte {
+	var buf bytes.Buffer
+	for _, field := range fields {
+		if !strings.ContainsRune(field.Value, '\n') {
+			buf.WriteString(field.Name)
+			buf.WriteByte('=')
+			buf.WriteString(field.Value)
+			buf.WriteByte('\n')
+			continue
+		}
+		buf.WriteString(field.Name)
+		buf.WriteByte('\n')
+		binary.Write(&buf, binary.LittleEndian, uint64(len(field.Value)))
+		buf.WriteString(field.Value)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// FieldName turns an attribute key into a valid journal field name:
+// requestId becomes REQUEST_ID. Field names are upper-case letters, digits
+// and underscores, start with a letter (a leading underscore marks fields
+// only journald may set), and are at most 64 bytes.
+func FieldName(key string) string {
+	var b strings.Builder
+	var prev rune
+	for _, r := range key {
+		switch {
+		case unicode.IsUpper(r) && (unicode.IsLower(prev) || unicode.IsDigit(prev)):
+			b.WriteByte('_')
+			b.WriteRune(r)
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			b.WriteRune(unicode.ToUpper(r))
+		default:
+			b.WriteByte('_')
+		}
+		prev = r
+	}
+	name := strings.TrimLeft(b.String(), "_0123456789")
+	if name == "" {
+		name = "FIELD"
+	}
+	if len(name) > maxFieldName {
+		name = name[:maxFieldName]
+	}
+	return name
+}
+
+// Priority maps a slog level to a syslog priority
+func Priority(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		return PriorityErr
+	case level >= slog.LevelWarn:
+		return PriorityWarning
+	case level >= slog.LevelInfo:
+		return PriorityInfo
+	}
+	return PriorityDebug
+}
+
+// Handler is a slog.Handler that writes each record as a journal entry.
+// Records that can't be sent are written as text to the fallback writer,
+// so nothing is lost when journald goes away.
+type Handler struct {
+	writer     *Writer
+	identifier string
+	level      slog.Leveler
+	fallback   io.Writer
+	fallbackMu *sync.Mutex
+
+	fields []Field // from WithAttrs
+	prefix string  // from WithGroup, for the names of later attributes
+}
+
+// NewHandler creates a handler sending records at level and above, tagged
+// with SYSLOG_IDENTIFIER identifier
+func NewHandler(writer *Writer, identifier string, level slog.Leveler, fallback io.Writer) *Handler {
+	if level == nil {
+		level = slog.LevelInfo
+	}
+	return &Handler{
+		writer:     writer,
+		identifier: identifier,
+		level:      level,
+		fallback:   fallback,
+		fallbackMu: &sync.Mutex{},
+	}
+}
+
+// Enabled reports whether records at level are sent
+func (h *Handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+// Handle sends a record
+func (h *Handler) Handle(_ context.Context, record slog.Record) error {
+	fields := make([]Field, 0, 3+len(h.fields)+record.NumAttrs())
+	fields = append(fields,
+		Field{Name: "MESSAGE", Value: record.Message},
+		Field{Name: "PRIORITY", Value: fmt.Sprint(Priority(record.Level))},
+	)
+	if h.identifier != "" {
+		fields = append(fields, Field{Name: "SYSLOG_IDENTIFIER", Value: h.identifier})
+	}
+	fields = append(fields, h.fields...)
+	record.Attrs(func(attr slog.Attr) bool {
+		fields = appendAttr(fields, h.prefix, attr)
+		return true
+	})
+
+	err := h.writer.Send(fields)
+	if err != nil && h.fallback != nil {
+		h.fallbackMu.Lock()
+		defer h.fallbackMu.Unlock()
+		fmt.Fprintln(h.fallback, record.Message)
+	}
+	return err
+}
+
+// WithAttrs returns a handler that adds attrs to every record
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.fields = append([]Field(nil), h.fields...)
+	for _, attr := range attrs {
+		clone.fields = appendAttr(clone.fields, h.prefix, attr)
+	}
+	return &clone
+}
+
+// WithGroup returns a handler that names later attributes after group
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.prefix = h.prefix + name + "_"
+	return &clone
+}
+
+// appendAttr adds an attribute as a field, and a group's attributes as
+// fields named after it
+func appendAttr(fields []Field, prefix string, attr slog.Attr) []Field {
+	value := attr.Value.Resolve()
+	if value.Kind() == slog.KindGroup {
+		if attr.Key != "" {
+			prefix += attr.Key + "_"
+		}
+		for _, member := range value.Group() {
+			fields = appendAttr(fields, prefix, member)
+		}
+		return fields
+	}
+	if attr.Key == "" {
+		return fields
+	}
+	return append(fields, Field{Name: FieldName(prefix + attr.Key), Value: value.String()})
+}
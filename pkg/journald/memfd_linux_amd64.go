@@ -0,0 +1,5 @@
+package journald
+
+// sysMemfdCreate is memfd_create's system call number, which package syscall
+// doesn't define for this architecture
+const sysMemfdCreate = 319
@@ -0,0 +1,6 @@
+//go:build linux && !amd64 && !arm64
+
+package journald
+
+// sysMemfdCreate is unknown here, so large entries go through /dev/shm
+const sysMemfdCreate = 0
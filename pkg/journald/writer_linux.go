@@ -0,0 +1,120 @@
+//go:build linux
+
+package journald
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"unsafe"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/perms"
+)
+
+// Seals that make a memfd immutable, as journald requires before it maps one
+const (
+	fcntlAddSeals   = 1033 // F_ADD_SEALS
+	sealSeal        = 0x1
+	sealShrink      = 0x2
+	sealGrow        = 0x4
+	sealWrite       = 0x8
+	memfdCloexec    = 0x1
+	memfdAllowSeals = 0x2
+)
+
+// Writer sends entries to journald
+type Writer struct {
+	conn   *net.UnixConn
+	socket *net.UnixAddr
+}
+
+// Dial prepares to send to the journal socket. It fails if there is no
+// socket there, e.g. on a host without systemd.
+func Dial(socket string) (*Writer, error) {
+	if _, err := os.Stat(socket); err != nil {
+		return nil, fmt.Errorf("journal socket %s: %w", socket, err)
+	}
+	// Unconnected, so entries still arrive after journald restarts
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open socket for journal: %w", err)
+	}
+	return &Writer{conn: conn, socket: &net.UnixAddr{Name: socket, Net: "unixgram"}}, nil
+}
+
+// Send writes one entry. An entry too large for a datagram goes through a
+// sealed memfd instead.
+func (w *Writer) Send(fields []Field) error {
+	data := Encode(fields)
+	_, _, err := w.conn.WriteMsgUnix(data, nil, w.socket)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, syscall.EMSGSIZE) && !errors.Is(err, syscall.ENOBUFS) {
+		return fmt.Errorf("failed to send journal entry: %w", err)
+	}
+
+	file, err := largeEntryFile(data)
+	if err != nil {
+		return fmt.Errorf("failed to send large journal entry: %w", err)
+	}
+	defer file.Close()
+	if _, _, err := w.conn.WriteMsgUnix(nil, syscall.UnixRights(int(file.Fd())), w.socket); err != nil {
+		return fmt.Errorf("failed to send large journal entry: %w", err)
+	}
+	return nil
+}
+
+// Close closes the connection
+func (w *Writer) Close() error {
+	return w.conn.Close()
+}
+
+// largeEntryFile returns a file holding data for journald to read: a sealed
+// memfd where the kernel has them, or else an unlinked file in /dev/shm,
+// which journald also accepts
+func largeEntryFile(data []byte) (*os.File, error) {
+	if file, err := sealedMemfd(data); err == nil {
+		return file, nil
+	}
+
+	file, err := perms.CreateTemp("/dev/shm", "journal-")
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(file.Name())
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// sealedMemfd returns a memfd holding data, sealed against any change
+func sealedMemfd(data []byte) (*os.File, error) {
+	if sysMemfdCreate == 0 {
+		return nil, errors.ErrUnsupported
+	}
+	name, err := syscall.BytePtrFromString("journal-entry")
+	if err != nil {
+		return nil, err
+	}
+	fd, _, errno := syscall.Syscall(uintptr(sysMemfdCreate), uintptr(unsafe.Pointer(name)),
+		memfdCloexec|memfdAllowSeals, 0)
+	if errno != 0 {
+		return nil, errno
+	}
+	file := os.NewFile(fd, "journal-entry")
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return nil, err
+	}
+	_, _, errno = syscall.Syscall(syscall.SYS_FCNTL, fd, fcntlAddSeals, sealSeal|sealShrink|sealGrow|sealWrite)
+	if errno != 0 {
+		file.Close()
+		return nil, errno
+	}
+	return file, nil
+}
@@ -0,0 +1,26 @@
+//go:build !linux
+
+package journald
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Writer sends entries to journald, which only runs on Linux
+type Writer struct{}
+
+// Dial fails: there is no journald here
+func Dial(socket string) (*Writer, error) {
+	return nil, fmt.Errorf("journal socket %s: %w", socket, errors.ErrUnsupported)
+}
+
+// Send fails: there is no journald here
+func (w *Writer) Send(fields []Field) error {
+	return errors.ErrUnsupported
+}
+
+// Close does nothing
+func (w *Writer) Close() error {
+	return nil
+}
@@ -0,0 +1,234 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxCanonicalDepth is the deepest nesting Canonicalize accepts, as for
+// encoding/json
+const maxCanonicalDepth = 10000
+
+// Canonicalize re-encodes a JSON value in a canonical form, so two payloads
+// that mean the same thing are equal byte for byte. Every feature that asks
+// whether two argument payloads are the same (replay matching, confirmation
+// tokens) compares this form, so they can't disagree.
+//
+//   - Object keys are sorted by their bytes, after unescaping
+//   - There is no insignificant whitespace
+//   - Numbers are written in one form for each value, exactly: 1, 1.0, 1e0
+//     and 10e-1 are all 1, and 1.5e3 is 1500. No precision is lost, however
+//     many digits a number has.
+//   - Strings are written with literal UTF-8, escaping only what JSON
+//     requires, so "\u00e9" and "é" are the same
+//   - An object with the same key twice is an error, since decoders
+//     disagree on which value wins
+//
+// Empty input is treated as {}.
+func Canonicalize(data json.RawMessage) ([]byte, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return []byte("{}"), nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var buf bytes.Buffer
+	if err := canonicalValue(decoder, &buf, 0); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after JSON value")
+	}
+	return buf.Bytes(), nil
+}
+
+// canonicalValue reads the next value from decoder and writes its canonical
+// form
+func canonicalValue(decoder *json.Decoder, buf *bytes.Buffer, depth int) error {
+	token, err := decoder.Token()
+	if err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	switch token := token.(type) {
+	case json.Delim:
+		if depth >= maxCanonicalDepth {
+			return fmt.Errorf("JSON nested more than %d deep", maxCanonicalDepth)
+		}
+		if token == '[' {
+			return canonicalArray(decoder, buf, depth+1)
+		}
+		return canonicalObject(decoder, buf, depth+1)
+	case string:
+		writeCanonicalString(buf, token)
+	case json.Number:
+		number, err := canonicalNumber(string(token))
+		if err != nil {
+			return err
+		}
+		buf.WriteString(number)
+	case bool:
+		if token {
+			buf.WriteString("true")
+		} else {
+			buf.WriteString("false")
+		}
+	case nil:
+		buf.WriteString("null")
+	}
+	return nil
+}
+
+// canonicalArray writes the rest of an array, whose [ has been read
+func canonicalArray(decoder *json.Decoder, buf *bytes.Buffer, depth int) error {
+	buf.WriteByte('[')
+	for i := 0; decoder.More(); i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := canonicalValue(decoder, buf, depth); err != nil {
+			return err
+		}
+	}
+	if _, err := decoder.Token(); err != nil { // ]
+		return err
+	}
+	buf.WriteByte(']')
+	return nil
+}
+
+// canonicalObject writes the rest of an object, whose { has been read, with
+// its members sorted by key
+func canonicalObject(decoder *json.Decoder, buf *bytes.Buffer, depth int) error {
+	members := map[string][]byte{}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		key := token.(string)
+		if _, ok := members[key]; ok {
+			return fmt.Errorf("duplicate key %q in JSON object", key)
+		}
+		var value bytes.Buffer
+		if err := canonicalValue(decoder, &value, depth); err != nil {
+			return err
+		}
+		members[key] = value.Bytes()
+	}
+	if _, err := decoder.Token(); err != nil { // }
+		return err
+	}
+
+	keys := make([]string, 0, len(members))
+	for key := range members {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	buf.WriteByte('{')
+	for i, key := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		writeCanonicalString(buf, key)
+		buf.WriteByte(':')
+		buf.Write(members[key])
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// writeCanonicalString writes s as a JSON string, escaping only quotes,
+// backslashes and control characters
+func writeCanonicalString(buf *bytes.Buffer, s string) {
+	const hex = "0123456789abcdef"
+	buf.WriteByte('"')
+	for _, r := range strings.ToValidUTF8(s, "�") {
+		switch {
+		case r == '"':
+			buf.WriteString(`\"`)
+		case r == '\\':
+			buf.WriteString(`\\`)
+		case r == '\n':
+			buf.WriteString(`\n`)
+		case r == '\r':
+			buf.WriteString(`\r`)
+		case r == '\t':
+			buf.WriteString(`\t`)
+		case r == '\b':
+			buf.WriteString(`\b`)
+		case r == '\f':
+			buf.WriteString(`\f`)
+		case r < 0x20:
+			buf.WriteString(`\u00`)
+			buf.WriteByte(hex[r>>4])
+			buf.WriteByte(hex[r&0xf])
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	buf.WriteByte('"')
+}
+
+// canonicalNumber rewrites a JSON number as its exact value in one form:
+// an integer or decimal without redundant zeros where that takes at most 21
+// digits, and d.ddde±n otherwise. -0 is 0.
+func canonicalNumber(text string) (string, error) {
+	mantissa, exponent, ok := strings.Cut(strings.ToLower(text), "e")
+	exp := 0
+	if ok {
+		var err error
+		if exp, err = strconv.Atoi(exponent); err != nil || len(exponent) > 9 {
+			return "", fmt.Errorf("number %s has an exponent out of range", text)
+		}
+	}
+	negative := strings.HasPrefix(mantissa, "-")
+	mantissa = strings.TrimPrefix(mantissa, "-")
+	whole, fraction, _ := strings.Cut(mantissa, ".")
+
+	// value = digits × 10^exp
+	digits := strings.TrimLeft(whole+fraction, "0")
+	exp -= len(fraction)
+	trimmed := strings.TrimRight(digits, "0")
+	exp += len(digits) - len(trimmed)
+	digits = trimmed
+	if digits == "" {
+		return "0", nil
+	}
+
+	var b strings.Builder
+	if negative {
+		b.WriteByte('-')
+	}
+	point := len(digits) + exp // digits before the decimal point
+	switch {
+	case exp >= 0 && point <= 21:
+		b.WriteString(digits)
+		b.WriteString(strings.Repeat("0", exp))
+	case exp < 0 && point > 0:
+		b.WriteString(digits[:point])
+		b.WriteByte('.')
+		b.WriteString(digits[point:])
+	case exp < 0 && point > -6:
+		b.WriteString("0.")
+		b.WriteString(strings.Repeat("0", -point))
+		b.WriteString(digits)
+	default:
+		b.WriteString(digits[:1])
+		if len(digits) > 1 {
+			b.WriteByte('.')
+			b.WriteString(digits[1:])
+		}
+		fmt.Fprintf(&b, "e%+d", point-1)
+	}
+	return b.String(), nil
+}
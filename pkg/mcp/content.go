@@ -0,0 +1,43 @@
+package mcp
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+)
+
+// MarshalJSON leaves the text field out of items that aren't text
+func (c ContentItem) MarshalJSON() ([]byte, error) {
+	type item ContentItem
+	if c.Type == "text" {
+		return json.Marshal(item(c))
+	}
+	return json.Marshal(struct {
+		item
+		Text string `json:"text,omitempty"`
+	}{item(c), c.Text})
+}
+
+// BinaryContent returns data as a base64 content item: an image or audio
+// item when mimeType says it is one, otherwise an embedded resource at uri.
+func BinaryContent(data []byte, mimeType, uri string) ContentItem {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return ContentItem{Type: "image", Data: encoded, MimeType: mimeType}
+	case strings.HasPrefix(mimeType, "audio/"):
+		return ContentItem{Type: "audio", Data: encoded, MimeType: mimeType}
+	}
+	return ContentItem{
+		Type:     "resource",
+		Resource: &EmbeddedResource{URI: uri, MimeType: mimeType, Blob: encoded},
+	}
+}
+
+// BinarySize is the size of the base64 data an item carries
+func (c ContentItem) BinarySize() int {
+	if c.Resource != nil {
+		return len(c.Resource.Blob)
+	}
+	return len(c.Data)
+}
@@ -0,0 +1,212 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Network message compression.
+//
+// A connection starts with newline-delimited JSON. A client that wants
+// compression lists the algorithms it accepts in its initialize request:
+//
+//	"capabilities": {"experimental": {"bashServer/compression": {"algorithms": ["gzip"]}}}
+//
+// If the listener has compression enabled and the client offers its
+// algorithm, the server names it in the initialize response:
+//
+//	"capabilities": {"experimental": {"bashServer/compression": {"algorithm": "gzip"}}}
+//
+// Every message after that response, in both directions, is a compressed
+// frame: a 4-byte big-endian length followed by that many bytes of
+// compressed JSON. Clients that don't opt in stay on plain framing.
+const (
+	// CompressionCapability is the capabilities.experimental key used to
+	// negotiate compression at initialize
+	CompressionCapability = "bashServer/compression"
+
+	// CompressionGzip compresses each message as a gzip stream
+	CompressionGzip = "gzip"
+
+	// MaxFrameSize caps a compressed frame and the message it decompresses to
+	MaxFrameSize = 64 * 1024 * 1024
+)
+
+// ValidateCompression checks a configured compression algorithm. The empty
+// string disables compression.
+func ValidateCompression(algorithm string) error {
+	switch algorithm {
+	case "", CompressionGzip:
+		return nil
+	}
+	return fmt.Errorf("unsupported compression %q (expected %q)", algorithm, CompressionGzip)
+}
+
+// framer reads and writes the messages of one connection, plain until
+// compression is negotiated
+type framer struct {
+	reader      *bufio.Reader
+	writer      *bufio.Writer
+	compression string
+	gz          *gzip.Writer
+	buf         bytes.Buffer
+}
+
+func newFramer(r io.Reader, w io.Writer) *framer {
+	return &framer{reader: bufio.NewReader(r), writer: bufio.NewWriter(w)}
+}
+
+// compress switches the connection to compressed frames
+func (f *framer) compress(algorithm string) {
+	f.compression = algorithm
+}
+
+// read returns the next message. Plain framing skips blank lines and
+// returns an empty message for them.
+func (f *framer) read() ([]byte, error) {
+	if f.compression == "" {
+		line, err := f.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		return []byte(strings.TrimRight(line, "\r\n")), nil
+	}
+
+	var header [4]byte
+	if _, err := io.ReadFull(f.reader, header[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size > MaxFrameSize {
+		return nil, fmt.Errorf("compressed frame of %d bytes exceeds the %d byte limit", size, MaxFrameSize)
+	}
+	frame := make([]byte, size)
+	if _, err := io.ReadFull(f.reader, frame); err != nil {
+		return nil, err
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(frame))
+	if err != nil {
+		return nil, fmt.Errorf("invalid compressed frame: %w", err)
+	}
+	defer gz.Close()
+	message, err := io.ReadAll(io.LimitReader(gz, MaxFrameSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("invalid compressed frame: %w", err)
+	}
+	if len(message) > MaxFrameSize {
+		return nil, fmt.Errorf("decompressed message exceeds the %d byte limit", MaxFrameSize)
+	}
+	return message, nil
+}
+
+// write sends one message and flushes it
+func (f *framer) write(message []byte) error {
+	if f.compression == "" {
+		f.writer.Write(message)
+		f.writer.WriteByte('\n')
+		return f.writer.Flush()
+	}
+
+	f.buf.Reset()
+	if f.gz == nil {
+		f.gz = gzip.NewWriter(&f.buf)
+	} else {
+		f.gz.Reset(&f.buf)
+	}
+	if _, err := f.gz.Write(message); err != nil {
+		return err
+	}
+	if err := f.gz.Close(); err != nil {
+		return err
+	}
+	if f.buf.Len() > MaxFrameSize {
+		return fmt.Errorf("compressed frame of %d bytes exceeds the %d byte limit", f.buf.Len(), MaxFrameSize)
+	}
+
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], uint32(f.buf.Len()))
+	f.writer.Write(header[:])
+	f.writer.Write(f.buf.Bytes())
+	return f.writer.Flush()
+}
+
+// clientOffersCompression reports whether message is an initialize request
+// whose client accepts algorithm
+func clientOffersCompression(message []byte, algorithm string) bool {
+	var request struct {
+		Method string `json:"method"`
+		Params struct {
+			Capabilities struct {
+				Experimental map[string]json.RawMessage `json:"experimental"`
+			} `json:"capabilities"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal(message, &request); err != nil || request.Method != "initialize" {
+		return false
+	}
+	var offer struct {
+		Algorithms []string `json:"algorithms"`
+	}
+	raw, ok := request.Params.Capabilities.Experimental[CompressionCapability]
+	if !ok || json.Unmarshal(raw, &offer) != nil {
+		return false
+	}
+	for _, offered := range offer.Algorithms {
+		if offered == algorithm {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptCompression adds the chosen algorithm to a successful initialize
+// response. It fails if the response carries no result, in which case the
+// connection stays plain.
+func acceptCompression(response []byte, algorithm string) ([]byte, error) {
+	var message map[string]json.RawMessage
+	if err := json.Unmarshal(response, &message); err != nil {
+		return nil, err
+	}
+	var result map[string]json.RawMessage
+	if err := json.Unmarshal(message["result"], &result); err != nil || result == nil {
+		return nil, fmt.Errorf("initialize response has no result")
+	}
+	var capabilities map[string]json.RawMessage
+	if raw, ok := result["capabilities"]; ok {
+		if err := json.Unmarshal(raw, &capabilities); err != nil {
+			return nil, err
+		}
+	}
+	if capabilities == nil {
+		capabilities = make(map[string]json.RawMessage)
+	}
+	var experimental map[string]interface{}
+	if raw, ok := capabilities["experimental"]; ok {
+		if err := json.Unmarshal(raw, &experimental); err != nil {
+			return nil, err
+		}
+	}
+	if experimental == nil {
+		experimental = make(map[string]interface{})
+	}
+	experimental[CompressionCapability] = map[string]string{"algorithm": algorithm}
+
+	var err error
+	if capabilities["experimental"], err = json.Marshal(experimental); err != nil {
+		return nil, err
+	}
+	if result["capabilities"], err = json.Marshal(capabilities); err != nil {
+		return nil, err
+	}
+	if message["result"], err = json.Marshal(result); err != nil {
+		return nil, err
+	}
+	return json.Marshal(message)
+}
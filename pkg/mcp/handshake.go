@@ -0,0 +1,100 @@
+package mcp
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// handshakeState is how far the initialize handshake has got
+type handshakeState int
+
+const (
+	// awaitingInitialize: nothing but initialize and ping is served yet
+	awaitingInitialize handshakeState = iota
+	// awaitingInitialized: initialize was answered; the client has yet to
+	// send notifications/initialized
+	awaitingInitialized
+	// ready: the handshake is complete
+	ready
+)
+
+// handshake tracks the initialize handshake. The spec has the client send
+// notifications/initialized after the initialize response and before any
+// other request. Some clients go straight on to tools/list instead; unless
+// strict is set, their first such request is taken as the confirmation, with
+// a one-time warning. Strict mode rejects it, as the spec allows.
+type handshake struct {
+	mutex  sync.Mutex
+	state  handshakeState
+	strict bool
+	warned bool
+}
+
+// handshakeError is a request the handshake refuses
+type handshakeError struct {
+	code    int
+	message string
+}
+
+// initialize records an initialize request. A repeated initialize is
+// answered again, leaving the session as it was, unless strict is set.
+func (h *handshake) initialize() *handshakeError {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.state != awaitingInitialize {
+		if h.strict {
+			return &handshakeError{code: -32600, message: "Server already initialized"}
+		}
+		fmt.Fprintf(os.Stderr, "Warning: repeated initialize request; answering it again\n")
+		return nil
+	}
+	h.state = awaitingInitialized
+	return nil
+}
+
+// initialized records notifications/initialized. One sent before initialize
+// is ignored.
+func (h *handshake) initialized() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	switch h.state {
+	case awaitingInitialize:
+		fmt.Fprintf(os.Stderr, "Warning: initialized notification received before initialize; ignoring it\n")
+	case awaitingInitialized:
+		h.state = ready
+	}
+}
+
+// admit decides whether a request other than initialize may be served
+func (h *handshake) admit(method string) *handshakeError {
+	if method == "ping" {
+		return nil
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	switch h.state {
+	case awaitingInitialize:
+		return &handshakeError{code: -32002, message: "Server not initialized"}
+	case awaitingInitialized:
+		if h.strict {
+			return &handshakeError{code: -32002,
+				message: "Server not initialized: notifications/initialized has not been received"}
+		}
+		if !h.warned {
+			h.warned = true
+			fmt.Fprintf(os.Stderr, "Warning: client sent %s without notifications/initialized; "+
+				"treating it as confirmation\n", method)
+		}
+		h.state = ready
+	}
+	return nil
+}
+
+// started reports whether initialize has been answered, so the client
+// expects notifications
+func (h *handshake) started() bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.state != awaitingInitialize
+}
@@ -0,0 +1,95 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// ContextRequestHandler is a RequestHandler that also receives a context.
+// The context is cancelled when the client sends notifications/cancelled for
+// the request, and carries the request id (see RequestIDFromContext).
+type ContextRequestHandler func(ctx context.Context, params json.RawMessage) (json.RawMessage, error)
+
+type requestIDKey struct{}
+
+// errRequestIDInUse refuses a request reusing the id of one still in flight
+var errRequestIDInUse = errors.New("request id is already in use by an in-flight request")
+
+// RequestIDFromContext returns the JSON-RPC id of the request a
+// ContextRequestHandler is serving
+func RequestIDFromContext(ctx context.Context) (RequestID, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(RequestID)
+	return id, ok
+}
+
+// inflightRequests tracks cancellable requests by connection and JSON-RPC
+// id. Ids are only unique within a connection, so a client can't cancel
+// another client's request by naming the same id.
+type inflightRequests struct {
+	mutex   sync.Mutex
+	cancels map[inflightKey]context.CancelFunc
+}
+
+// inflightKey names a request: the connection it arrived on ("" for
+// single-client transports) and its id
+type inflightKey struct {
+	conn string
+	id   string
+}
+
+// start registers a request and returns its context and a function that
+// must be called when the request finishes. It fails if a request with the
+// same id is still in flight on the connection, since a cancellation naming
+// that id could then mean either.
+func (r *inflightRequests) start(conn string, id RequestID) (context.Context, func(), error) {
+	key := inflightKey{conn: conn, id: id.String()}
+	r.mutex.Lock()
+	if _, ok := r.cancels[key]; ok {
+		r.mutex.Unlock()
+		return nil, nil, fmt.Errorf("%w: %s", errRequestIDInUse, id.String())
+	}
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), requestIDKey{}, id))
+	if r.cancels == nil {
+		r.cancels = make(map[inflightKey]context.CancelFunc)
+	}
+	r.cancels[key] = cancel
+	r.mutex.Unlock()
+
+	return ctx, func() {
+		r.mutex.Lock()
+		delete(r.cancels, key)
+		r.mutex.Unlock()
+		cancel()
+	}, nil
+}
+
+// cancel cancels the in-flight request with the given id on a connection.
+// Reports whether one was found; a request that already finished is not an
+// error.
+func (r *inflightRequests) cancel(conn string, id RequestID) bool {
+	r.mutex.Lock()
+	cancel, ok := r.cancels[inflightKey{conn: conn, id: id.String()}]
+	r.mutex.Unlock()
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// handleCancelled cancels the request named by a notifications/cancelled
+// received on conn
+func (s *Server) handleCancelled(conn string, params json.RawMessage) {
+	var cancelParams struct {
+		RequestID RequestID `json:"requestId"`
+	}
+	if err := json.Unmarshal(params, &cancelParams); err != nil || cancelParams.RequestID.IsEmpty() {
+		return
+	}
+	if s.inflight.cancel(conn, cancelParams.RequestID) {
+		fmt.Fprintf(os.Stderr, "Cancelled in-flight request %s\n", cancelParams.RequestID.String())
+	}
+}
@@ -0,0 +1,91 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInflightRequestsScopedByConnection(t *testing.T) {
+	var r inflightRequests
+	var id RequestID
+	if err := json.Unmarshal([]byte(`7`), &id); err != nil {
+		t.Fatal(err)
+	}
+
+	first, doneFirst, err := r.start("a", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, doneSecond, err := r.start("b", id)
+	if err != nil {
+		t.Fatalf("the same id on another connection was refused: %v", err)
+	}
+	defer doneSecond()
+	if _, _, err := r.start("a", id); err == nil {
+		t.Errorf("a duplicate live id was accepted")
+	}
+
+	if r.cancel("c", id) {
+		t.Errorf("a connection without the request cancelled it")
+	}
+	if !r.cancel("a", id) || first.Err() == nil {
+		t.Errorf("the request was not cancelled")
+	}
+	if second.Err() != nil {
+		t.Errorf("cancelling on one connection cancelled the other's request")
+	}
+
+	// Once finished, the id is free again
+	doneFirst()
+	if r.cancel("a", id) {
+		t.Errorf("a finished request was still registered")
+	}
+	if _, done, err := r.start("a", id); err != nil {
+		t.Errorf("a finished request's id was not freed: %v", err)
+	} else {
+		done()
+	}
+}
+
+func TestServerRefusesDuplicateInflightID(t *testing.T) {
+	s := NewServer(ServerInfo{Name: "test"}, ServerConfig{})
+	started := make(chan struct{}, 1)
+	s.SetContextRequestHandler("slow", func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+		started <- struct{}{}
+		<-ctx.Done()
+		return json.RawMessage(`{}`), nil
+	})
+	if _, err := s.handleRequest([]byte(`{"jsonrpc":"2.0","id":0,"method":"initialize","params":{}}`)); err != nil {
+		t.Fatal(err)
+	}
+	s.handleRequest([]byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`))
+
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		s.handleConnectionRequest("a", []byte(`{"jsonrpc":"2.0","id":1,"method":"slow"}`))
+	}()
+	<-started
+
+	response, err := s.handleConnectionRequest("a", []byte(`{"jsonrpc":"2.0","id":1,"method":"slow"}`))
+	if err != nil || !strings.Contains(string(response), `"code":-32600`) {
+		t.Errorf("duplicate id response = %s, %v; want an invalid request error", response, err)
+	}
+
+	cancel := []byte(`{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":1}}`)
+	s.handleConnectionRequest("b", cancel)
+	select {
+	case <-finished:
+		t.Fatal("another connection cancelled the request")
+	case <-time.After(50 * time.Millisecond):
+	}
+	s.handleConnectionRequest("a", cancel)
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the request was not cancelled")
+	}
+}
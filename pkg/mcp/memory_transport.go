@@ -0,0 +1,224 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultInMemoryCallTimeout bounds how long InMemoryClient.Call waits for a
+// response before giving up.
+const DefaultInMemoryCallTimeout = 30 * time.Second
+
+// InMemoryTransport implements the Transport interface over Go channels, for
+// exercising a Server in-process (e.g. in tests) without spawning a binary.
+// Like StdioTransport, each message is handled in its own goroutine, so
+// notifications are processed while a long request is in flight.
+type InMemoryTransport struct {
+	requests  chan []byte
+	responses chan []byte
+	stopChan  chan struct{}
+	waitGroup sync.WaitGroup
+	mutex     sync.Mutex
+	running   bool
+}
+
+// InMemoryClient is the client end of an in-memory transport. It sends
+// JSON-RPC messages to the server and matches responses to requests by id.
+type InMemoryClient struct {
+	transport *InMemoryTransport
+
+	// Timeout bounds each Call; DefaultInMemoryCallTimeout if zero
+	Timeout time.Duration
+
+	mutex   sync.Mutex
+	nextID  int64
+	pending map[string]chan *ResponseMessage
+	done    chan struct{}
+}
+
+// NewInMemoryTransport returns a connected pair: the client side, used to
+// send requests, and the server side, passed to Server.Connect.
+func NewInMemoryTransport() (*InMemoryClient, *InMemoryTransport) {
+	transport := &InMemoryTransport{
+		requests:  make(chan []byte),
+		responses: make(chan []byte, 16),
+		stopChan:  make(chan struct{}),
+	}
+	client := &InMemoryClient{
+		transport: transport,
+		pending:   make(map[string]chan *ResponseMessage),
+		done:      make(chan struct{}),
+	}
+	go client.routeResponses()
+	return client, transport
+}
+
+// Start starts the transport
+func (t *InMemoryTransport) Start(handler RequestHandlerFunc) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.running {
+		return fmt.Errorf("transport already running")
+	}
+
+	t.running = true
+	t.waitGroup.Add(1)
+
+	go t.processRequests(handler)
+
+	return nil
+}
+
+// Stop stops the transport. Requests still being handled may finish, but
+// their responses are dropped.
+func (t *InMemoryTransport) Stop() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if !t.running {
+		return nil
+	}
+
+	close(t.stopChan)
+	t.waitGroup.Wait()
+	t.running = false
+
+	return nil
+}
+
+// processRequests dispatches each incoming message to its own goroutine
+func (t *InMemoryTransport) processRequests(handler RequestHandlerFunc) {
+	defer t.waitGroup.Done()
+
+	for {
+		select {
+		case <-t.stopChan:
+			return
+		case data := <-t.requests:
+			go func() {
+				response, err := handler(data)
+				if err != nil || len(response) == 0 {
+					return
+				}
+				select {
+				case t.responses <- response:
+				case <-t.stopChan:
+				}
+			}()
+		}
+	}
+}
+
+// send delivers a raw message to the server
+func (t *InMemoryTransport) send(data []byte) error {
+	select {
+	case t.requests <- data:
+		return nil
+	case <-t.stopChan:
+		return fmt.Errorf("transport stopped")
+	}
+}
+
+// SendNotification delivers a notification to the client. The client does
+// not match it to any Call.
+func (t *InMemoryTransport) SendNotification(data []byte) error {
+	select {
+	case t.responses <- data:
+		return nil
+	case <-t.stopChan:
+		return fmt.Errorf("transport stopped")
+	}
+}
+
+// Call sends a request and waits for its response. A JSON-RPC error is
+// returned in the response, not as err; err covers transport failures.
+func (c *InMemoryClient) Call(method string, params interface{}) (*ResponseMessage, error) {
+	c.mutex.Lock()
+	c.nextID++
+	id := c.nextID
+	ch := make(chan *ResponseMessage, 1)
+	c.pending[fmt.Sprintf("%d", id)] = ch
+	c.mutex.Unlock()
+
+	defer func() {
+		c.mutex.Lock()
+		delete(c.pending, fmt.Sprintf("%d", id))
+		c.mutex.Unlock()
+	}()
+
+	data, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	if err := c.transport.send(data); err != nil {
+		return nil, err
+	}
+
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = DefaultInMemoryCallTimeout
+	}
+	select {
+	case response := <-ch:
+		return response, nil
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("no response to %s within %v", method, timeout)
+	case <-c.done:
+		return nil, fmt.Errorf("client closed")
+	}
+}
+
+// Notify sends a notification, which gets no response
+func (c *InMemoryClient) Notify(method string, params interface{}) error {
+	data, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+	return c.transport.send(data)
+}
+
+// Close stops the client; pending calls return an error
+func (c *InMemoryClient) Close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	select {
+	case <-c.done:
+	default:
+		close(c.done)
+	}
+}
+
+// routeResponses hands each response to the Call waiting for its id
+func (c *InMemoryClient) routeResponses() {
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-c.transport.stopChan:
+			return
+		case data := <-c.transport.responses:
+			var response ResponseMessage
+			if err := json.Unmarshal(data, &response); err != nil {
+				continue
+			}
+			c.mutex.Lock()
+			ch, ok := c.pending[response.ID.String()]
+			c.mutex.Unlock()
+			if ok {
+				ch <- &response
+			}
+		}
+	}
+}
@@ -1,13 +1,11 @@
 package mcp
 
 import (
-	"bufio"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net"
 	"os"
-	"strings"
 	"sync"
 )
 
@@ -17,6 +15,10 @@ type NetworkConfig struct {
 	Port           int
 	AllowedIPs     []string
 	AllowedSubnets []*net.IPNet
+
+	// Compression, if set, is offered to clients that ask for it at
+	// initialize (see CompressionCapability)
+	Compression string
 }
 
 // NetworkTransport implements the Transport interface using TCP sockets
@@ -27,11 +29,14 @@ type NetworkTransport struct {
 	stopChan  chan struct{}
 	waitGroup sync.WaitGroup
 	mutex     sync.Mutex
-	handler   RequestHandlerFunc
+	handler   ConnectionHandlerFunc
 }
 
 // NewNetworkTransport creates a new network transport
 func NewNetworkTransport(config NetworkConfig) (*NetworkTransport, error) {
+	if err := ValidateCompression(config.Compression); err != nil {
+		return nil, err
+	}
 	return &NetworkTransport{
 		config:   config,
 		stopChan: make(chan struct{}),
@@ -60,6 +65,14 @@ func ParseNetworkConfig(host string, port int, allowedIPs []string, allowedSubne
 
 // Start starts the network transport
 func (t *NetworkTransport) Start(handler RequestHandlerFunc) error {
+	return t.StartConnections(func(conn string, data []byte) ([]byte, error) {
+		return handler(data)
+	})
+}
+
+// StartConnections starts the network transport, telling handler which
+// connection each request arrived on (the client's address)
+func (t *NetworkTransport) StartConnections(handler ConnectionHandlerFunc) error {
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
 
@@ -85,6 +98,9 @@ func (t *NetworkTransport) Start(handler RequestHandlerFunc) error {
 	} else {
 		fmt.Fprintf(os.Stderr, "WARNING: No IP restrictions configured - all connections allowed\n")
 	}
+	if t.config.Compression != "" {
+		fmt.Fprintf(os.Stderr, "Compression available to clients that request it: %s\n", t.config.Compression)
+	}
 
 	t.waitGroup.Add(1)
 	go t.acceptConnections()
@@ -174,29 +190,33 @@ func (t *NetworkTransport) handleConnection(conn net.Conn) {
 	defer t.waitGroup.Done()
 	defer conn.Close()
 
-	reader := bufio.NewReader(conn)
-	writer := bufio.NewWriter(conn)
+	frames := newFramer(conn, conn)
 
 	for {
 		select {
 		case <-t.stopChan:
 			return
 		default:
-			line, err := reader.ReadString('\n')
+			message, err := frames.read()
 			if err != nil {
 				if err == io.EOF {
 					fmt.Fprintf(os.Stderr, "Client %s disconnected\n", conn.RemoteAddr())
 					return
 				}
+				if frames.compression != "" {
+					fmt.Fprintf(os.Stderr, "Client %s: %v\n", conn.RemoteAddr(), err)
+				}
 				return
 			}
 
-			line = strings.TrimRight(line, "\r\n")
-			if line == "" {
+			if len(message) == 0 {
 				continue
 			}
 
-			response, err := t.handler([]byte(line))
+			negotiate := t.config.Compression != "" && frames.compression == "" &&
+				clientOffersCompression(message, t.config.Compression)
+
+			response, err := t.handler(conn.RemoteAddr().String(), message)
 			if err != nil {
 				errorResp := map[string]interface{}{
 					"jsonrpc": "2.0",
@@ -206,9 +226,7 @@ func (t *NetworkTransport) handleConnection(conn net.Conn) {
 					},
 				}
 				errorBytes, _ := json.Marshal(errorResp)
-				writer.Write(errorBytes)
-				writer.Write([]byte("\n"))
-				writer.Flush()
+				frames.write(errorBytes)
 				continue
 			}
 
@@ -216,9 +234,25 @@ func (t *NetworkTransport) handleConnection(conn net.Conn) {
 				continue
 			}
 
-			response = append(response, '\n')
-			writer.Write(response)
-			writer.Flush()
+			if negotiate {
+				if accepted, err := acceptCompression(response, t.config.Compression); err == nil {
+					response = accepted
+				} else {
+					negotiate = false
+				}
+			}
+
+			if err := frames.write(response); err != nil {
+				fmt.Fprintf(os.Stderr, "Client %s: write failed: %v\n", conn.RemoteAddr(), err)
+				return
+			}
+
+			// The initialize response itself is plain; everything after it
+			// is compressed
+			if negotiate {
+				frames.compress(t.config.Compression)
+				fmt.Fprintf(os.Stderr, "Client %s: %s compression enabled\n", conn.RemoteAddr(), t.config.Compression)
+			}
 		}
 	}
 }
@@ -0,0 +1,138 @@
+package mcp
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// Registry holds listable entities (tools, and prompts or resources should
+// they be added) by unique name in registration order, so list responses are
+// identical from run to run instead of following Go's map iteration order.
+// It is safe for concurrent use, so entities can be replaced while the
+// server runs.
+type Registry[T any] struct {
+	mutex sync.RWMutex
+	order []string
+	items map[string]T
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry[T any]() *Registry[T] {
+	return &Registry[T]{items: make(map[string]T)}
+}
+
+// Add appends an entity. Names must be non-empty and unique.
+func (r *Registry[T]) Add(name string, item T) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if name == "" {
+		return fmt.Errorf("registry entry has no name")
+	}
+	if _, exists := r.items[name]; exists {
+		return fmt.Errorf("%q is registered twice", name)
+	}
+	r.order = append(r.order, name)
+	r.items[name] = item
+	return nil
+}
+
+// Get looks an entity up by name
+func (r *Registry[T]) Get(name string) (T, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	item, ok := r.items[name]
+	return item, ok
+}
+
+// Remove drops an entity, keeping the order of the rest. Removing a name
+// that isn't registered does nothing.
+func (r *Registry[T]) Remove(name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.remove(name)
+}
+
+// remove drops an entity. Caller must hold mutex.
+func (r *Registry[T]) remove(name string) {
+	if _, ok := r.items[name]; !ok {
+		return
+	}
+	delete(r.items, name)
+	for i, registered := range r.order {
+		if registered == name {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// Has reports whether name is registered
+func (r *Registry[T]) Has(name string) bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	_, ok := r.items[name]
+	return ok
+}
+
+// Len returns the number of registered entities
+func (r *Registry[T]) Len() int {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return len(r.order)
+}
+
+// Names returns the registered names in registration order
+func (r *Registry[T]) Names() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return append([]string(nil), r.order...)
+}
+
+// Each calls fn for every entity in registration order. It sees the
+// entities as they were when it was called; fn may use the registry.
+func (r *Registry[T]) Each(fn func(name string, item T)) {
+	r.mutex.RLock()
+	names := slices.Clone(r.order)
+	items := make([]T, len(names))
+	for i, name := range names {
+		items[i] = r.items[name]
+	}
+	r.mutex.RUnlock()
+	for i, name := range names {
+		fn(name, items[i])
+	}
+}
+
+// Replace drops the entities named in remove and appends those of staged,
+// in its order, as one change: concurrent readers see either the old
+// entities or the new. Nothing changes if a staged name would still be
+// registered twice.
+func (r *Registry[T]) Replace(remove []string, staged *Registry[T]) error {
+	staged.mutex.RLock()
+	defer staged.mutex.RUnlock()
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, name := range staged.order {
+		if _, exists := r.items[name]; exists && !slices.Contains(remove, name) {
+			return fmt.Errorf("%q is registered twice", name)
+		}
+	}
+	for _, name := range remove {
+		r.remove(name)
+	}
+	for _, name := range staged.order {
+		r.order = append(r.order, name)
+		r.items[name] = staged.items[name]
+	}
+	return nil
+}
+
+// StableID derives an entity ID from its name, so IDs survive restarts and
+// don't depend on registration order.
+func StableID(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,84 @@
+package mcp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistryKeepsRegistrationOrder(t *testing.T) {
+	r := NewRegistry[int]()
+	for i, name := range []string{"zeta", "alpha", "mid"} {
+		if err := r.Add(name, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Add("alpha", 9); err == nil {
+		t.Errorf("duplicate name accepted")
+	}
+	if err := r.Add("", 9); err == nil {
+		t.Errorf("empty name accepted")
+	}
+
+	if got := strings.Join(r.Names(), ","); got != "zeta,alpha,mid" {
+		t.Errorf("names = %s, want registration order", got)
+	}
+
+	r.Remove("alpha")
+	r.Remove("missing")
+	var visited []string
+	r.Each(func(name string, item int) { visited = append(visited, name) })
+	if got := strings.Join(visited, ","); got != "zeta,mid" || r.Len() != 2 || r.Has("alpha") {
+		t.Errorf("after remove: %s (len %d)", got, r.Len())
+	}
+	if item, ok := r.Get("mid"); !ok || item != 2 {
+		t.Errorf("Get(mid) = %d, %v", item, ok)
+	}
+
+	// Names returns a copy
+	names := r.Names()
+	names[0] = "changed"
+	if r.Names()[0] != "zeta" {
+		t.Errorf("Names exposed the registry's order")
+	}
+}
+
+func TestStableID(t *testing.T) {
+	if StableID("bash") != StableID("bash") {
+		t.Errorf("ID not deterministic")
+	}
+	if StableID("bash") == StableID("exec") {
+		t.Errorf("different names share an ID")
+	}
+	if id := StableID("bash"); len(id) != 16 {
+		t.Errorf("ID %q is not 16 hex digits", id)
+	}
+}
+
+func TestRegistryReplace(t *testing.T) {
+	r := NewRegistry[int]()
+	for i, name := range []string{"builtin", "old", "kept"} {
+		r.Add(name, i)
+	}
+
+	staged := NewRegistry[int]()
+	staged.Add("builtin", 9)
+	if err := r.Replace([]string{"old"}, staged); err == nil {
+		t.Errorf("a staged name colliding with a kept one was accepted")
+	}
+	if got := strings.Join(r.Names(), ","); got != "builtin,old,kept" {
+		t.Errorf("a refused replace changed the registry: %s", got)
+	}
+
+	staged = NewRegistry[int]()
+	staged.Add("old", 10)
+	staged.Add("new", 11)
+	if err := r.Replace([]string{"old"}, staged); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(r.Names(), ","); got != "builtin,kept,old,new" {
+		t.Errorf("names = %s, want the staged entries appended", got)
+	}
+	if item, _ := r.Get("old"); item != 10 {
+		t.Errorf("old = %d, want the staged entry", item)
+	}
+}
@@ -0,0 +1,107 @@
+package mcp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrResourceNotFound is returned by a ResourceProvider for a URI it doesn't
+// serve. The client gets JSON-RPC error -32002 for it, as the spec asks.
+var ErrResourceNotFound = errors.New("resource not found")
+
+// resourceNotFoundCode is the JSON-RPC error code for ErrResourceNotFound
+const resourceNotFoundCode = -32002
+
+// Resource is one entry of a resources/list response
+type Resource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+}
+
+// ResourceContents is a resource in a resources/read response: its Text,
+// or for binary content Blob, base64-encoded
+type ResourceContents struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text"`
+	Blob     string `json:"blob,omitempty"`
+}
+
+// MarshalJSON leaves text out of binary contents, which carry blob instead
+func (c ResourceContents) MarshalJSON() ([]byte, error) {
+	type contents ResourceContents
+	if c.Blob == "" {
+		return json.Marshal(contents(c))
+	}
+	return json.Marshal(struct {
+		URI      string `json:"uri"`
+		MimeType string `json:"mimeType,omitempty"`
+		Blob     string `json:"blob"`
+	}{c.URI, c.MimeType, c.Blob})
+}
+
+// ResourceProvider serves resources/list and resources/read
+type ResourceProvider interface {
+	// ListResources returns the resources that can be read now
+	ListResources() []Resource
+	// ReadResource returns a resource's contents, or an error wrapping
+	// ErrResourceNotFound if there is none at uri
+	ReadResource(uri string) (ResourceContents, error)
+}
+
+// SetResourceProvider serves resources/list and resources/read from provider
+// and advertises the resources capability in initialize
+func (s *Server) SetResourceProvider(provider ResourceProvider) {
+	s.handlersMux.Lock()
+	s.resources = true
+	s.handlersMux.Unlock()
+
+	s.SetRequestHandler("resources/list", func(params json.RawMessage) (json.RawMessage, error) {
+		resources := provider.ListResources()
+		if resources == nil {
+			resources = []Resource{}
+		}
+		return json.Marshal(map[string]interface{}{"resources": resources})
+	})
+	s.SetRequestHandler("resources/read", func(params json.RawMessage) (json.RawMessage, error) {
+		var request struct {
+			URI string `json:"uri"`
+		}
+		if err := json.Unmarshal(params, &request); err != nil || request.URI == "" {
+			return nil, fmt.Errorf("resources/read needs a uri")
+		}
+		contents, err := provider.ReadResource(request.URI)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(map[string]interface{}{"contents": []ResourceContents{contents}})
+	})
+}
+
+// ResourceLink returns a resource_link content item pointing at a resource,
+// for the client to read with resources/read
+func ResourceLink(resource Resource) ContentItem {
+	return ContentItem{
+		Type:        "resource_link",
+		URI:         resource.URI,
+		Name:        resource.Name,
+		Description: resource.Description,
+		MimeType:    resource.MimeType,
+		Size:        resource.Size,
+	}
+}
+
+// errorCode is the JSON-RPC error code for a handler error
+func errorCode(err error) int {
+	if errors.Is(err, ErrResourceNotFound) {
+		return resourceNotFoundCode
+	}
+	if errors.Is(err, errRequestIDInUse) {
+		return -32600
+	}
+	return -32000
+}
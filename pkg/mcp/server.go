@@ -6,6 +6,9 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"time"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/truncate"
 )
 
 // NotificationHandler is a function that handles a notification (fire-and-forget, no response).
@@ -16,10 +19,33 @@ type Server struct {
 	info                 ServerInfo
 	config               ServerConfig
 	handlers             map[string]RequestHandler
+	contextHandlers      map[string]ContextRequestHandler
 	notificationHandlers map[string]NotificationHandler
 	transport            Transport
 	handlersMux          sync.RWMutex
-	initialized          bool
+
+	// handshake tracks initialize and notifications/initialized
+	handshake handshake
+
+	// clientInfo and clientRequestTimeout are captured from initialize.
+	// clientRequestTimeout is zero when the client did not advertise one.
+	clientInfo           ClientInfo
+	clientRequestTimeout time.Duration
+	clientMux            sync.RWMutex
+
+	// experimental holds entries advertised under capabilities.experimental
+	experimental map[string]interface{}
+
+	// resources is set once a resource provider serves resources/list and
+	// resources/read, to advertise the capability
+	resources bool
+
+	// toolsListChanged is set once the tools may change while the server
+	// runs, to advertise notifications/tools/list_changed
+	toolsListChanged bool
+
+	// inflight holds the requests notifications/cancelled can cancel
+	inflight inflightRequests
 }
 
 // NewServer creates a new MCP server
@@ -28,8 +54,9 @@ func NewServer(info ServerInfo, config ServerConfig) *Server {
 		info:                 info,
 		config:               config,
 		handlers:             make(map[string]RequestHandler),
+		contextHandlers:      make(map[string]ContextRequestHandler),
 		notificationHandlers: make(map[string]NotificationHandler),
-		initialized:          false,
+		handshake:            handshake{strict: config.RequireInitializedNotification},
 	}
 }
 
@@ -40,6 +67,15 @@ func (s *Server) SetRequestHandler(method string, handler RequestHandler) {
 	s.handlers[method] = handler
 }
 
+// SetContextRequestHandler sets a cancellable handler for a request method.
+// It replaces any handler set with SetRequestHandler for the same method.
+func (s *Server) SetContextRequestHandler(method string, handler ContextRequestHandler) {
+	s.handlersMux.Lock()
+	defer s.handlersMux.Unlock()
+	delete(s.handlers, method)
+	s.contextHandlers[method] = handler
+}
+
 // SetNotificationHandler sets a handler for a specific notification method.
 // Unlike request handlers, notification handlers are fire-and-forget (no response).
 func (s *Server) SetNotificationHandler(method string, handler NotificationHandler) {
@@ -48,6 +84,33 @@ func (s *Server) SetNotificationHandler(method string, handler NotificationHandl
 	s.notificationHandlers[method] = handler
 }
 
+// SetExperimentalCapability advertises value under capabilities.experimental[name]
+// in the initialize response.
+func (s *Server) SetExperimentalCapability(name string, value interface{}) {
+	s.handlersMux.Lock()
+	defer s.handlersMux.Unlock()
+	if s.experimental == nil {
+		s.experimental = make(map[string]interface{})
+	}
+	s.experimental[name] = value
+}
+
+// AdvertiseToolsListChanged advertises that the server sends
+// notifications/tools/list_changed when its tools change
+func (s *Server) AdvertiseToolsListChanged() {
+	s.handlersMux.Lock()
+	defer s.handlersMux.Unlock()
+	s.toolsListChanged = true
+}
+
+// HasNotificationHandler reports whether a handler is registered for a notification method
+func (s *Server) HasNotificationHandler(method string) bool {
+	s.handlersMux.RLock()
+	defer s.handlersMux.RUnlock()
+	_, ok := s.notificationHandlers[method]
+	return ok
+}
+
 // GetHandler gets a handler for a specific request method
 func (s *Server) GetHandler(method string) RequestHandler {
 	s.handlersMux.RLock()
@@ -55,12 +118,67 @@ func (s *Server) GetHandler(method string) RequestHandler {
 	return s.handlers[method]
 }
 
+// GetContextHandler gets a cancellable handler for a request method
+func (s *Server) GetContextHandler(method string) ContextRequestHandler {
+	s.handlersMux.RLock()
+	defer s.handlersMux.RUnlock()
+	return s.contextHandlers[method]
+}
+
+// ClientInfo returns the client name and version sent in initialize.
+func (s *Server) ClientInfo() ClientInfo {
+	s.clientMux.RLock()
+	defer s.clientMux.RUnlock()
+	return s.clientInfo
+}
+
+// ClientRequestTimeout returns how long the client said it will wait for a
+// response, or zero if it did not say. Clients advertise this as
+// capabilities.experimental.requestTimeoutSeconds in initialize.
+func (s *Server) ClientRequestTimeout() time.Duration {
+	s.clientMux.RLock()
+	defer s.clientMux.RUnlock()
+	return s.clientRequestTimeout
+}
+
 // Connect connects the server to a transport
 func (s *Server) Connect(transport Transport) error {
 	s.transport = transport
+	if multi, ok := transport.(MultiConnectionTransport); ok {
+		return multi.StartConnections(s.handleConnectionRequest)
+	}
 	return s.transport.Start(s.handleRequest)
 }
 
+// SendNotification sends a JSON-RPC notification to the client. It fails if
+// the transport can't send unsolicited messages.
+func (s *Server) SendNotification(method string, params interface{}) error {
+	sender, ok := s.transport.(NotificationSender)
+	if !ok {
+		return fmt.Errorf("transport does not support notifications")
+	}
+
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification params: %w", err)
+	}
+	data, err := json.Marshal(NotificationMessage{
+		JsonRPC: "2.0",
+		Method:  method,
+		Params:  paramsJSON,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+	return sender.SendNotification(data)
+}
+
+// Initialized reports whether the client has completed initialize, so
+// notifications may be sent
+func (s *Server) Initialized() bool {
+	return s.handshake.started()
+}
+
 // Disconnect disconnects the server from its transport
 func (s *Server) Disconnect() error {
 	if s.transport == nil {
@@ -71,6 +189,12 @@ func (s *Server) Disconnect() error {
 
 // handleRequest handles incoming requests
 func (s *Server) handleRequest(data []byte) ([]byte, error) {
+	return s.handleConnectionRequest("", data)
+}
+
+// handleConnectionRequest handles a request that arrived on conn, which
+// scopes its id for cancellation
+func (s *Server) handleConnectionRequest(conn string, data []byte) ([]byte, error) {
 	// Parse the request
 	var request RequestMessage
 	if err := json.Unmarshal(data, &request); err != nil {
@@ -89,14 +213,14 @@ func (s *Server) handleRequest(data []byte) ([]byte, error) {
 	// Handle the initialized notification
 	if request.Method == "notifications/initialized" {
 		fmt.Fprintf(os.Stderr, "Received initialized notification, setting server as ready\n")
-		s.initialized = true
+		s.handshake.initialized()
 		return nil, nil
 	}
 
 	// Handle initialized without the notifications/ prefix (just in case)
 	if request.Method == "initialized" {
 		fmt.Fprintf(os.Stderr, "Received initialized notification (legacy format), setting server as ready\n")
-		s.initialized = true
+		s.handshake.initialized()
 		return nil, nil
 	}
 
@@ -106,6 +230,9 @@ func (s *Server) handleRequest(data []byte) ([]byte, error) {
 	// (e.g. Claude Desktop) to reject the malformed message and corrupt the session.
 	if strings.HasPrefix(request.Method, "notifications/") {
 		fmt.Fprintf(os.Stderr, "Received notification: %s\n", request.Method)
+		if request.Method == "notifications/cancelled" {
+			s.handleCancelled(conn, request.Params)
+		}
 		// Dispatch to registered notification handler if one exists
 		s.handlersMux.RLock()
 		nh, ok := s.notificationHandlers[request.Method]
@@ -116,15 +243,16 @@ func (s *Server) handleRequest(data []byte) ([]byte, error) {
 		return nil, nil
 	}
 
-	// If not initialized and not a ping, reject the request
-	if !s.initialized && request.Method != "ping" {
+	// Until the handshake completes only ping is served (or, for lenient
+	// clients, the request completes it)
+	if refused := s.handshake.admit(request.Method); refused != nil {
 		fmt.Fprintf(os.Stderr, "Rejecting request %s because server is not initialized\n", request.Method)
 		response := ResponseMessage{
 			JsonRPC: "2.0",
 			ID:      request.ID,
 			Error: &ErrorResponse{
-				Code:    -32002,
-				Message: "Server not initialized",
+				Code:    refused.code,
+				Message: refused.message,
 			},
 		}
 		return json.Marshal(response)
@@ -133,8 +261,21 @@ func (s *Server) handleRequest(data []byte) ([]byte, error) {
 	// Get the handler for this method
 	s.handlersMux.RLock()
 	handler, ok := s.handlers[request.Method]
+	contextHandler, hasContext := s.contextHandlers[request.Method]
 	s.handlersMux.RUnlock()
 
+	if hasContext {
+		handler = func(params json.RawMessage) (json.RawMessage, error) {
+			ctx, done, err := s.inflight.start(conn, request.ID)
+			if err != nil {
+				return nil, err
+			}
+			defer done()
+			return contextHandler(ctx, params)
+		}
+		ok = true
+	}
+
 	if !ok {
 		fmt.Fprintf(os.Stderr, "Method not supported: %s\n", request.Method)
 		response := ResponseMessage{
@@ -157,7 +298,7 @@ func (s *Server) handleRequest(data []byte) ([]byte, error) {
 			JsonRPC: "2.0",
 			ID:      request.ID,
 			Error: &ErrorResponse{
-				Code:    -32000,
+				Code:    errorCode(err),
 				Message: err.Error(),
 			},
 		}
@@ -182,7 +323,7 @@ func (s *Server) handleRequest(data []byte) ([]byte, error) {
 	// (e.g., pretty-printed JSON from API queries)
 	const maxLogLen = 500
 	if len(responseBytes) > maxLogLen {
-		fmt.Fprintf(os.Stderr, "Response (%d bytes): %s...[truncated]\n", len(responseBytes), string(responseBytes[:maxLogLen]))
+		fmt.Fprintf(os.Stderr, "Response (%d bytes): %s...[truncated]\n", len(responseBytes), string(truncate.Head(responseBytes, maxLogLen)))
 	} else {
 		fmt.Fprintf(os.Stderr, "Response: %s\n", string(responseBytes))
 	}
@@ -192,8 +333,12 @@ func (s *Server) handleRequest(data []byte) ([]byte, error) {
 // handleInitialize handles the initialize method
 func (s *Server) handleInitialize(request RequestMessage) ([]byte, error) {
 	fmt.Fprintf(os.Stderr, "Parsing initialize params\n")
+	// Some clients send null or no params at all; the handshake still works
+	// with defaults. Only params that are there but malformed are refused.
 	var params InitializeParams
-	if err := json.Unmarshal(request.Params, &params); err != nil {
+	if raw := strings.TrimSpace(string(request.Params)); raw == "" || raw == "null" {
+		fmt.Fprintf(os.Stderr, "Warning: initialize has no params; assuming an unknown client\n")
+	} else if err := json.Unmarshal(request.Params, &params); err != nil {
 		fmt.Fprintf(os.Stderr, "Invalid initialize parameters: %v\n", err)
 		response := ResponseMessage{
 			JsonRPC: "2.0",
@@ -206,13 +351,41 @@ func (s *Server) handleInitialize(request RequestMessage) ([]byte, error) {
 		return json.Marshal(response)
 	}
 
+	if refused := s.handshake.initialize(); refused != nil {
+		fmt.Fprintf(os.Stderr, "Rejecting initialize: %s\n", refused.message)
+		response := ResponseMessage{
+			JsonRPC: "2.0",
+			ID:      request.ID,
+			Error: &ErrorResponse{
+				Code:    refused.code,
+				Message: refused.message,
+			},
+		}
+		return json.Marshal(response)
+	}
+
+	if params.ClientInfo.Name == "" {
+		params.ClientInfo.Name = UnknownClient
+	}
+	if params.ClientInfo.Version == "" {
+		params.ClientInfo.Version = UnknownClient
+	}
 	fmt.Fprintf(os.Stderr, "Client info: %s %s\n", params.ClientInfo.Name, params.ClientInfo.Version)
 	fmt.Fprintf(os.Stderr, "Protocol version: %s\n", params.ProtocolVersion)
 
+	s.clientMux.Lock()
+	s.clientInfo = params.ClientInfo
+	s.clientRequestTimeout = parseClientRequestTimeout(params.Capabilities)
+	s.clientMux.Unlock()
+	if s.clientRequestTimeout > 0 {
+		fmt.Fprintf(os.Stderr, "Client request timeout: %v\n", s.clientRequestTimeout)
+	}
+
 	// Accept the client's protocol version
 	protocolVersion := params.ProtocolVersion
 	if protocolVersion == "" {
-		protocolVersion = "2023-11-05"
+		fmt.Fprintf(os.Stderr, "Warning: initialize has no protocolVersion; using %s\n", LatestProtocolVersion)
+		protocolVersion = LatestProtocolVersion
 	}
 
 	// Create server info
@@ -228,6 +401,17 @@ func (s *Server) handleInitialize(request RequestMessage) ([]byte, error) {
 			"call": true,
 		},
 	}
+	s.handlersMux.RLock()
+	if len(s.experimental) > 0 {
+		capabilities["experimental"] = s.experimental
+	}
+	if s.resources {
+		capabilities["resources"] = map[string]interface{}{}
+	}
+	if s.toolsListChanged {
+		capabilities["tools"].(map[string]interface{})["listChanged"] = true
+	}
+	s.handlersMux.RUnlock()
 
 	// Create the initialize result
 	initializeResult := InitializeResult{
@@ -265,7 +449,22 @@ func (s *Server) handleInitialize(request RequestMessage) ([]byte, error) {
 	}
 
 	fmt.Fprintf(os.Stderr, "Initialize response: %s\n", string(responseBytes))
-	
-	s.initialized = true
 	return responseBytes, nil
 }
+
+// parseClientRequestTimeout extracts capabilities.experimental.requestTimeoutSeconds
+// from the client's initialize capabilities. Returns zero if absent or invalid.
+func parseClientRequestTimeout(capabilities json.RawMessage) time.Duration {
+	if len(capabilities) == 0 {
+		return 0
+	}
+	var caps struct {
+		Experimental struct {
+			RequestTimeoutSeconds float64 `json:"requestTimeoutSeconds"`
+		} `json:"experimental"`
+	}
+	if err := json.Unmarshal(capabilities, &caps); err != nil || caps.Experimental.RequestTimeoutSeconds <= 0 {
+		return 0
+	}
+	return time.Duration(caps.Experimental.RequestTimeoutSeconds * float64(time.Second))
+}
@@ -2,22 +2,43 @@ package mcp
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"strings"
 	"sync"
+	"time"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/truncate"
 )
 
 // RequestHandlerFunc is a function that processes a request and returns a response
 type RequestHandlerFunc func(data []byte) ([]byte, error)
 
+// ConnectionHandlerFunc is a RequestHandlerFunc that is also told which
+// client connection the request arrived on
+type ConnectionHandlerFunc func(conn string, data []byte) ([]byte, error)
+
 // Transport defines the interface for MCP transport mechanisms
 type Transport interface {
 	Start(handler RequestHandlerFunc) error
 	Stop() error
 }
 
+// MultiConnectionTransport is implemented by transports serving several
+// clients at once. Request ids are only unique per client, so the server
+// starts these with StartConnections instead of Start.
+type MultiConnectionTransport interface {
+	StartConnections(handler ConnectionHandlerFunc) error
+}
+
+// NotificationSender is implemented by transports that can write unsolicited
+// messages (notifications) to the client.
+type NotificationSender interface {
+	SendNotification(data []byte) error
+}
+
 // StdioTransport implements the Transport interface using stdin/stdout
 type StdioTransport struct {
 	running   bool
@@ -26,6 +47,10 @@ type StdioTransport struct {
 	reader    *bufio.Reader
 	writer    *bufio.Writer
 	mutex     sync.Mutex
+
+	// sequencer, when set, releases responses in request arrival order.
+	// nil means responses are written as soon as each handler finishes.
+	sequencer *responseSequencer
 }
 
 // NewStdioTransport creates a new stdio transport
@@ -37,6 +62,20 @@ func NewStdioTransport() *StdioTransport {
 	}
 }
 
+// EnableOrderedResponses makes the transport write responses in the order their
+// requests arrived, for clients that assume FIFO replies. A response that has
+// been held back for longer than maxWait (because an earlier request is still
+// running) is written out of order so one slow command can't block the rest.
+// Must be called before Start.
+func (t *StdioTransport) EnableOrderedResponses(maxWait time.Duration) {
+	t.sequencer = &responseSequencer{
+		pending:  make(map[uint64][]byte),
+		released: make(map[uint64]bool),
+		maxWait:  maxWait,
+		write:    t.writeResponse,
+	}
+}
+
 // Start starts the transport
 func (t *StdioTransport) Start(handler RequestHandlerFunc) error {
 	t.mutex.Lock()
@@ -102,28 +141,50 @@ func (t *StdioTransport) processRequests(handler RequestHandlerFunc) {
 			// Log received message (truncated for large payloads)
 			const maxMsgLog = 200
 			if len(line) > maxMsgLog {
-				fmt.Fprintf(os.Stderr, "Received message (%d bytes): %s...[truncated]\n", len(line), line[:maxMsgLog])
+				fmt.Fprintf(os.Stderr, "Received message (%d bytes): %s...[truncated]\n", len(line), truncate.Head(line, maxMsgLog))
 			} else {
 				fmt.Fprintf(os.Stderr, "Received message: %s\n", line)
 			}
 
+			// In ordered mode, reserve a slot in the response order for every
+			// message that expects a reply. Notifications are exempt.
+			seq := uint64(0)
+			ordered := t.sequencer != nil && expectsResponse([]byte(line))
+			if ordered {
+				seq = t.sequencer.assign()
+			}
+
 			// Dispatch to goroutine so we can keep reading stdin.
 			// This allows notifications/cancelled to be processed while
 			// a long-running tools/call is still executing.
-			go t.handleAndRespond(handler, []byte(line))
+			go t.handleAndRespond(handler, []byte(line), ordered, seq)
 		}
 	}
 }
 
 // handleAndRespond processes a single message and writes the response.
-// Thread-safe: uses t.mutex to serialise writes to stdout.
-func (t *StdioTransport) handleAndRespond(handler RequestHandlerFunc, data []byte) {
+// When ordered is set, the response is handed to the sequencer under the
+// given sequence number instead of being written directly.
+func (t *StdioTransport) handleAndRespond(handler RequestHandlerFunc, data []byte, ordered bool, seq uint64) {
 	response, err := handler(data)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error processing request: %v\n", err)
+		response = nil
+	}
+
+	if ordered {
+		// Always complete the slot, even with no response, so later
+		// responses aren't held back waiting for it.
+		t.sequencer.complete(seq, response)
 		return
 	}
 
+	t.writeResponse(response)
+}
+
+// writeResponse writes a single response line to stdout.
+// Thread-safe: uses t.mutex to serialise writes to stdout.
+func (t *StdioTransport) writeResponse(response []byte) {
 	// If empty response, don't send anything (notification)
 	if len(response) == 0 {
 		return
@@ -138,7 +199,7 @@ func (t *StdioTransport) handleAndRespond(handler RequestHandlerFunc, data []byt
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
 
-	_, err = t.writer.Write(response)
+	_, err := t.writer.Write(response)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error writing response: %v\n", err)
 		return
@@ -152,3 +213,111 @@ func (t *StdioTransport) handleAndRespond(handler RequestHandlerFunc, data []byt
 
 	fmt.Fprintf(os.Stderr, "Response sent successfully\n")
 }
+
+// SendNotification writes a notification to stdout, serialised with
+// responses. Notifications bypass response ordering.
+func (t *StdioTransport) SendNotification(data []byte) error {
+	data = append(data, '\n')
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if _, err := t.writer.Write(data); err != nil {
+		return fmt.Errorf("failed to write notification: %w", err)
+	}
+	if err := t.writer.Flush(); err != nil {
+		return fmt.Errorf("failed to flush notification: %w", err)
+	}
+	return nil
+}
+
+// expectsResponse reports whether a raw JSON-RPC message carries an id and
+// therefore expects a reply. Notifications have no id.
+func expectsResponse(data []byte) bool {
+	var msg struct {
+		ID json.RawMessage `json:"id"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		// Unparseable messages still get an error reply from the server
+		return true
+	}
+	return len(msg.ID) > 0 && string(msg.ID) != "null"
+}
+
+// responseSequencer releases responses in the order their requests arrived.
+// Each request is assigned a sequence number on arrival; a completed response
+// is held until every earlier request has completed, or until it has waited
+// maxWait, after which it is flushed out of order.
+type responseSequencer struct {
+	mutex    sync.Mutex
+	nextSeq  uint64            // next sequence number to write
+	assigned uint64            // next sequence number to hand out
+	pending  map[uint64][]byte // completed responses waiting for their turn
+	released map[uint64]bool   // sequence numbers already flushed out of order
+	maxWait  time.Duration
+	write    func([]byte)
+}
+
+// assign reserves the next position in the response order.
+func (rs *responseSequencer) assign() uint64 {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+	seq := rs.assigned
+	rs.assigned++
+	return seq
+}
+
+// complete records the response for seq (which may be empty) and writes every
+// response that is now in order.
+func (rs *responseSequencer) complete(seq uint64, response []byte) {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	if seq != rs.nextSeq {
+		rs.pending[seq] = response
+		if len(response) > 0 && rs.maxWait > 0 {
+			time.AfterFunc(rs.maxWait, func() { rs.expire(seq) })
+		}
+		return
+	}
+
+	rs.write(response)
+	rs.nextSeq++
+	rs.advance()
+}
+
+// advance writes consecutive pending responses starting at nextSeq.
+// Caller must hold rs.mutex.
+func (rs *responseSequencer) advance() {
+	for {
+		if rs.released[rs.nextSeq] {
+			delete(rs.released, rs.nextSeq)
+			rs.nextSeq++
+			continue
+		}
+		response, ok := rs.pending[rs.nextSeq]
+		if !ok {
+			return
+		}
+		delete(rs.pending, rs.nextSeq)
+		rs.write(response)
+		rs.nextSeq++
+	}
+}
+
+// expire flushes a response that has waited too long for earlier requests.
+func (rs *responseSequencer) expire(seq uint64) {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	response, ok := rs.pending[seq]
+	if !ok {
+		return
+	}
+	delete(rs.pending, seq)
+	rs.released[seq] = true
+
+	fmt.Fprintf(os.Stderr, "Ordered responses: flushing response #%d out of order after %v (waiting on #%d)\n",
+		seq, rs.maxWait, rs.nextSeq)
+	rs.write(response)
+}
@@ -0,0 +1,99 @@
+package mcp
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingSequencer returns a sequencer whose writes are collected in order
+func recordingSequencer(maxWait time.Duration) (*responseSequencer, func() []string) {
+	var mutex sync.Mutex
+	var written []string
+	rs := &responseSequencer{
+		pending:  make(map[uint64][]byte),
+		released: make(map[uint64]bool),
+		maxWait:  maxWait,
+		write: func(response []byte) {
+			if len(response) == 0 {
+				return
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			written = append(written, string(response))
+		},
+	}
+	return rs, func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]string(nil), written...)
+	}
+}
+
+func TestResponseSequencerWritesInArrivalOrder(t *testing.T) {
+	rs, written := recordingSequencer(time.Minute)
+
+	first, second, third := rs.assign(), rs.assign(), rs.assign()
+	rs.complete(third, []byte("3"))
+	rs.complete(second, []byte("2"))
+	if got := written(); len(got) != 0 {
+		t.Fatalf("written %v before the first request completed", got)
+	}
+
+	rs.complete(first, []byte("1"))
+	if got := strings.Join(written(), ","); got != "1,2,3" {
+		t.Errorf("written %s, want 1,2,3", got)
+	}
+}
+
+func TestResponseSequencerEmptyResponseReleasesLaterOnes(t *testing.T) {
+	rs, written := recordingSequencer(time.Minute)
+
+	first, second := rs.assign(), rs.assign()
+	rs.complete(second, []byte("2"))
+	rs.complete(first, nil)
+	if got := strings.Join(written(), ","); got != "2" {
+		t.Errorf("written %s, want 2", got)
+	}
+}
+
+func TestResponseSequencerFlushesAfterMaxWait(t *testing.T) {
+	rs, written := recordingSequencer(50 * time.Millisecond)
+
+	slow, fast, after := rs.assign(), rs.assign(), rs.assign()
+	rs.complete(fast, []byte("fast"))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(written()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := strings.Join(written(), ","); got != "fast" {
+		t.Fatalf("written %s, want fast flushed out of order", got)
+	}
+
+	// The flushed slot is skipped rather than written twice
+	rs.complete(slow, []byte("slow"))
+	rs.complete(after, []byte("after"))
+	if got := strings.Join(written(), ","); got != "fast,slow,after" {
+		t.Errorf("written %s, want fast,slow,after", got)
+	}
+}
+
+func TestExpectsResponse(t *testing.T) {
+	tests := []struct {
+		message string
+		want    bool
+	}{
+		{`{"jsonrpc":"2.0","id":1,"method":"ping"}`, true},
+		{`{"jsonrpc":"2.0","id":"a","method":"ping"}`, true},
+		{`{"jsonrpc":"2.0","method":"notifications/initialized"}`, false},
+		{`{"jsonrpc":"2.0","id":null,"method":"ping"}`, false},
+		{`not json`, true},
+	}
+	for _, test := range tests {
+		if got := expectsResponse([]byte(test.message)); got != test.want {
+			t.Errorf("expectsResponse(%s) = %v, want %v", test.message, got, test.want)
+		}
+	}
+}
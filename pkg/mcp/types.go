@@ -87,6 +87,14 @@ type ServerInfo struct {
 	Version string `json:"version"`
 }
 
+// LatestProtocolVersion is the newest MCP protocol version the server
+// supports, assumed for clients that don't say which they speak
+const LatestProtocolVersion = "2025-06-18"
+
+// UnknownClient stands in for a client name or version the client didn't
+// send
+const UnknownClient = "unknown"
+
 // ClientInfo information
 type ClientInfo struct {
 	Name    string `json:"name"`
@@ -107,11 +115,25 @@ type InitializeResult struct {
 	Capabilities    json.RawMessage `json:"capabilities"`
 }
 
+// ToolAnnotations describes a tool's behaviour so clients can decide, for
+// example, whether to auto-approve a call. All hints are always emitted so
+// every tool states them explicitly rather than relying on protocol defaults.
+type ToolAnnotations struct {
+	Title           string `json:"title,omitempty"`
+	ReadOnlyHint    bool   `json:"readOnlyHint"`    // does not modify its environment
+	DestructiveHint bool   `json:"destructiveHint"` // may perform destructive updates
+	IdempotentHint  bool   `json:"idempotentHint"`  // repeating a call has no additional effect
+	OpenWorldHint   bool   `json:"openWorldHint"`   // may interact with external entities
+}
+
 // Tool represents a tool that can be called by the client
 type Tool struct {
-	Name        string          `json:"name"`
-	Description string          `json:"description"`
-	InputSchema json.RawMessage `json:"inputSchema"`
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	InputSchema json.RawMessage  `json:"inputSchema"`
+	Annotations *ToolAnnotations `json:"annotations,omitempty"`
+	// Meta carries server-specific data such as a stable tool ID
+	Meta map[string]interface{} `json:"_meta,omitempty"`
 }
 
 // ListToolsRequest represents a request to list available tools
@@ -128,18 +150,40 @@ type ListToolsResponse struct {
 type CallToolRequest struct {
 	Name      string          `json:"name"`
 	Arguments json.RawMessage `json:"arguments"`
+	Meta      json.RawMessage `json:"_meta,omitempty"`
 }
 
-// ContentItem represents an item in the content array
+// ContentItem represents an item in the content array: text, base64 Data
+// for "image" and "audio" items, an embedded "resource", or a
+// "resource_link" to one the client reads with resources/read
 type ContentItem struct {
-	Type string `json:"type"`
-	Text string `json:"text"`
+	Type     string            `json:"type"`
+	Text     string            `json:"text"`
+	Data     string            `json:"data,omitempty"`
+	MimeType string            `json:"mimeType,omitempty"`
+	Resource *EmbeddedResource `json:"resource,omitempty"`
+
+	// The resource a "resource_link" item points at
+	URI         string `json:"uri,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+}
+
+// EmbeddedResource is the resource of a "resource" content item. Blob holds
+// base64 data.
+type EmbeddedResource struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Blob     string `json:"blob"`
 }
 
 // CallToolResponse represents a response from calling a tool
 type CallToolResponse struct {
-	Content []ContentItem `json:"content"`
-	IsError bool          `json:"isError,omitempty"`
+	Content           []ContentItem          `json:"content"`
+	StructuredContent map[string]interface{} `json:"structuredContent,omitempty"`
+	IsError           bool                   `json:"isError,omitempty"`
+	Meta              map[string]interface{} `json:"_meta,omitempty"`
 }
 
 // RequestHandler is a function that handles a specific request method
@@ -153,4 +197,9 @@ type ServerCapabilities struct {
 // ServerConfig represents the server configuration
 type ServerConfig struct {
 	Capabilities ServerCapabilities `json:"capabilities"`
+
+	// RequireInitializedNotification rejects requests until the client
+	// sends notifications/initialized, as the spec allows. Otherwise the
+	// first request after initialize stands in for it.
+	RequireInitializedNotification bool `json:"-"`
 }
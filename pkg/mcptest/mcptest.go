@@ -0,0 +1,129 @@
+// Package mcptest runs an mcp.Server in-process for integration tests of its
+// handlers, without spawning the binary or juggling pipes.
+//
+//	h := mcptest.New(t, func(s *mcp.Server) {
+//		s.SetRequestHandler("tools/call", myHandler)
+//	})
+//	h.Initialize(t)
+//	result := h.CallTool(t, "bash", map[string]interface{}{"command": "echo hi"})
+package mcptest
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/mcp"
+)
+
+// Harness is a Server connected to an in-memory client
+type Harness struct {
+	Server *mcp.Server
+	Client *mcp.InMemoryClient
+}
+
+// New creates a server, lets setup register its handlers, and connects it
+// to an in-memory transport. The server is shut down when the test ends.
+func New(t testing.TB, setup func(server *mcp.Server)) *Harness {
+	t.Helper()
+
+	server := mcp.NewServer(
+		mcp.ServerInfo{Name: "mcptest", Version: "test"},
+		mcp.ServerConfig{
+			Capabilities: mcp.ServerCapabilities{
+				Tools: map[string]interface{}{
+					"list": true,
+					"call": true,
+				},
+			},
+		},
+	)
+	if setup != nil {
+		setup(server)
+	}
+
+	client, transport := mcp.NewInMemoryTransport()
+	if err := server.Connect(transport); err != nil {
+		t.Fatalf("failed to connect server: %v", err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+		server.Disconnect()
+	})
+
+	return &Harness{Server: server, Client: client}
+}
+
+// Call sends a request and returns its result, failing the test on a
+// transport or JSON-RPC error.
+func (h *Harness) Call(t testing.TB, method string, params interface{}) json.RawMessage {
+	t.Helper()
+
+	response, err := h.Client.Call(method, params)
+	if err != nil {
+		t.Fatalf("%s: %v", method, err)
+	}
+	if response.Error != nil {
+		t.Fatalf("%s: error %d: %s", method, response.Error.Code, response.Error.Message)
+	}
+	return response.Result
+}
+
+// Initialize performs the initialize handshake and sends the initialized
+// notification.
+func (h *Harness) Initialize(t testing.TB) mcp.InitializeResult {
+	t.Helper()
+
+	raw := h.Call(t, "initialize", map[string]interface{}{
+		"protocolVersion": "2024-11-05",
+		"clientInfo":      map[string]string{"name": "mcptest", "version": "test"},
+		"capabilities":    map[string]interface{}{},
+	})
+	var result mcp.InitializeResult
+	if err := json.Unmarshal(raw, &result); err != nil {
+		t.Fatalf("initialize: invalid result: %v", err)
+	}
+
+	if err := h.Client.Notify("notifications/initialized", nil); err != nil {
+		t.Fatalf("notifications/initialized: %v", err)
+	}
+	return result
+}
+
+// ListTools returns the tools advertised by tools/list
+func (h *Harness) ListTools(t testing.TB) []mcp.Tool {
+	t.Helper()
+
+	var result mcp.ListToolsResponse
+	if err := json.Unmarshal(h.Call(t, "tools/list", nil), &result); err != nil {
+		t.Fatalf("tools/list: invalid result: %v", err)
+	}
+	return result.Tools
+}
+
+// CallTool calls a tool and returns its result. Tool-level errors (isError)
+// are returned to the caller to inspect rather than failing the test.
+func (h *Harness) CallTool(t testing.TB, name string, args interface{}) mcp.CallToolResponse {
+	t.Helper()
+
+	raw := h.Call(t, "tools/call", map[string]interface{}{
+		"name":      name,
+		"arguments": args,
+	})
+	var result mcp.CallToolResponse
+	if err := json.Unmarshal(raw, &result); err != nil {
+		t.Fatalf("tools/call %s: invalid result: %v", name, err)
+	}
+	return result
+}
+
+// Text returns the concatenated text content of a tool result
+func Text(response mcp.CallToolResponse) string {
+	var text string
+	for i, item := range response.Content {
+		if i > 0 {
+			text += "\n"
+		}
+		text += item.Text
+	}
+	return text
+}
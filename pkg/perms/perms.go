@@ -0,0 +1,137 @@
+// Package perms creates the files and directories the server keeps for
+// itself: its config, logs, recordings, state, temp files and working
+// directories. Everything it creates is private to the server's user (files
+// 0600, directories 0700), or readable by its group too where the config
+// asks for that, and the mode is set explicitly after creating, so the
+// umask can't change it either way.
+//
+// Files a client asks for (write_file, file_edit, fetch_artifact, extracted
+// archives, lock files) are the client's, with the modes it would expect, and
+// don't go through here.
+package perms
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// Modes of what the server creates, private and group-readable
+const (
+	FileMode      os.FileMode = 0600
+	DirMode       os.FileMode = 0700
+	GroupFileMode os.FileMode = 0640
+	GroupDirMode  os.FileMode = 0750
+)
+
+// groupReadable makes new files and directories readable by the group
+var groupReadable atomic.Bool
+
+// SetGroupReadable makes files and directories created from now on readable
+// by the server's group as well
+func SetGroupReadable(readable bool) {
+	groupReadable.Store(readable)
+}
+
+// fileMode returns the mode new files get
+func fileMode() os.FileMode {
+	if groupReadable.Load() {
+		return GroupFileMode
+	}
+	return FileMode
+}
+
+// dirMode returns the mode new directories get
+func dirMode() os.FileMode {
+	if groupReadable.Load() {
+		return GroupDirMode
+	}
+	return DirMode
+}
+
+// OpenFile opens a file with os.OpenFile, creating it if flag includes
+// O_CREATE, and gives it the server's file mode. A file that already
+// exists is tightened to that mode too, so one left readable by an older
+// version doesn't stay that way.
+func OpenFile(path string, flag int) (*os.File, error) {
+	file, err := os.OpenFile(path, flag, fileMode())
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Chmod(fileMode()); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// WriteFile writes data to a file, creating it or truncating it first, and
+// gives it the server's file mode
+func WriteFile(path string, data []byte) error {
+	file, err := OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// CreateTemp creates a new temp file like os.CreateTemp, with the server's
+// file mode
+func CreateTemp(dir, pattern string) (*os.File, error) {
+	file, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Chmod(fileMode()); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return file, nil
+}
+
+// MkdirTemp creates a new temp directory like os.MkdirTemp, with the
+// server's directory mode
+func MkdirTemp(dir, pattern string) (string, error) {
+	path, err := os.MkdirTemp(dir, pattern)
+	if err != nil {
+		return "", err
+	}
+	if err := os.Chmod(path, dirMode()); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+// MkdirAll creates a directory and any missing parents like os.MkdirAll,
+// giving those it creates the server's directory mode. Directories that
+// already exist are left as they are: they may be shared, or the user's.
+func MkdirAll(path string) error {
+	// Find the directories that don't exist yet, deepest first
+	var missing []string
+	for dir := filepath.Clean(path); ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(dir); err == nil || !errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		missing = append(missing, dir)
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+
+	if err := os.MkdirAll(path, dirMode()); err != nil {
+		return err
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := os.Chmod(missing[i], dirMode()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"time"
+)
+
+const (
+	// DefaultTimeout bounds a policy decision when none is configured
+	DefaultTimeout = 2 * time.Second
+
+	// maxDecisionSize is the largest decision document that will be read
+	maxDecisionSize = 64 * 1024
+)
+
+// Failure modes: what happens when the hook errors, times out, or returns
+// something unparseable.
+const (
+	FailDeny  = "deny"
+	FailAllow = "allow"
+)
+
+// Request is the document sent to the policy hook before a command runs
+type Request struct {
+	Tool      string            `json:"tool"`
+	Command   string            `json:"command"`
+	Session   int               `json:"session,omitempty"` // bash session id; 0 when none yet
+	Cwd       string            `json:"cwd,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Meta      json.RawMessage   `json:"_meta,omitempty"`
+	Caller    Caller            `json:"caller"`
+	Transport string            `json:"transport"`
+	Bypass    bool              `json:"bypassSession,omitempty"`
+}
+
+// Caller identifies who is asking. Without authentication this is only what
+// the client reported in initialize.
+type Caller struct {
+	ClientName    string `json:"clientName,omitempty"`
+	ClientVersion string `json:"clientVersion,omitempty"`
+}
+
+// Decision is the hook's answer
+type Decision struct {
+	Allow     bool       `json:"allow"`
+	Reason    string     `json:"reason,omitempty"`
+	Mutations *Mutations `json:"mutations,omitempty"`
+}
+
+// Mutations are changes an allowing hook asks for
+type Mutations struct {
+	Command *string `json:"command,omitempty"`
+}
+
+// Options configures a Hook. Exactly one of URL or Command must be set.
+type Options struct {
+	URL       string   // POST the request as JSON to this endpoint
+	Command   []string // or pipe it to this program's stdin
+	Timeout   time.Duration
+	OnFailure string // FailDeny (default) or FailAllow
+}
+
+// Hook consults an external policy engine before commands run
+type Hook struct {
+	opts   Options
+	client *http.Client
+}
+
+// New creates a policy hook
+func New(opts Options) (*Hook, error) {
+	if (opts.URL == "") == (len(opts.Command) == 0) {
+		return nil, fmt.Errorf("policy hook needs exactly one of url or command")
+	}
+	if opts.URL != "" {
+		parsed, err := url.Parse(opts.URL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return nil, fmt.Errorf("invalid policy hook url: %s", opts.URL)
+		}
+	}
+	switch opts.OnFailure {
+	case "":
+		opts.OnFailure = FailDeny
+	case FailDeny, FailAllow:
+	default:
+		return nil, fmt.Errorf("invalid policy hook onFailure %q (expected \"deny\" or \"allow\")", opts.OnFailure)
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = DefaultTimeout
+	}
+
+	return &Hook{
+		opts:   opts,
+		client: &http.Client{Timeout: opts.Timeout},
+	}, nil
+}
+
+// Evaluate asks the hook whether req may run. It always returns a decision:
+// if the hook fails, the configured failure mode decides, with the failure
+// given as the reason.
+func (h *Hook) Evaluate(req Request) Decision {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return h.failed(fmt.Errorf("failed to encode request: %w", err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.opts.Timeout)
+	defer cancel()
+
+	var raw []byte
+	if h.opts.URL != "" {
+		raw, err = h.post(ctx, body)
+	} else {
+		raw, err = h.run(ctx, body)
+	}
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("no decision within %v", h.opts.Timeout)
+		}
+		return h.failed(err)
+	}
+
+	var decision Decision
+	if err := json.Unmarshal(raw, &decision); err != nil {
+		return h.failed(fmt.Errorf("invalid decision: %w", err))
+	}
+	if !decision.Allow {
+		decision.Mutations = nil
+	}
+	return decision
+}
+
+// post sends the request to the HTTP endpoint
+func (h *Hook) post(ctx context.Context, body []byte) ([]byte, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, h.opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("policy endpoint returned %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxDecisionSize))
+}
+
+// run pipes the request to the external program and reads its stdout
+func (h *Hook) run(ctx context.Context, body []byte) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, h.opts.Command[0], h.opts.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("policy command failed: %w", err)
+	}
+	if len(out) > maxDecisionSize {
+		return nil, fmt.Errorf("policy decision exceeds %d bytes", maxDecisionSize)
+	}
+	return out, nil
+}
+
+// failed applies the failure mode
+func (h *Hook) failed(err error) Decision {
+	fmt.Fprintf(os.Stderr, "Policy hook failed (%s on failure): %v\n", h.opts.OnFailure, err)
+	return Decision{
+		Allow:  h.opts.OnFailure == FailAllow,
+		Reason: fmt.Sprintf("policy hook unavailable: %v", err),
+	}
+}
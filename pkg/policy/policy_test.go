@@ -0,0 +1,122 @@
+package policy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// endpoint serves decide over HTTP and returns a hook posting to it
+func endpoint(t *testing.T, opts Options, decide func(req Request) (int, string)) *Hook {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		status, body := decide(req)
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	opts.URL = server.URL
+	hook, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hook
+}
+
+func TestHTTPHookDecides(t *testing.T) {
+	hook := endpoint(t, Options{}, func(req Request) (int, string) {
+		if strings.Contains(req.Command, "rm -rf") {
+			return http.StatusOK, `{"allow":false,"reason":"destructive","mutations":{"command":"true"}}`
+		}
+		if req.Tool == "bash" && req.Labels["env"] == "prod" {
+			return http.StatusOK, `{"allow":true,"mutations":{"command":"echo safe"}}`
+		}
+		return http.StatusOK, `{"allow":true}`
+	})
+
+	decision := hook.Evaluate(Request{Tool: "bash", Command: "rm -rf /"})
+	if decision.Allow || decision.Reason != "destructive" {
+		t.Errorf("decision = %+v, want denied as destructive", decision)
+	}
+	if decision.Mutations != nil {
+		t.Errorf("a denying decision kept its mutations")
+	}
+
+	decision = hook.Evaluate(Request{Tool: "bash", Command: "ls", Labels: map[string]string{"env": "prod"}})
+	if !decision.Allow || decision.Mutations == nil || *decision.Mutations.Command != "echo safe" {
+		t.Errorf("decision = %+v, want allowed with a rewrite", decision)
+	}
+
+	if decision := hook.Evaluate(Request{Tool: "exec", Command: "ls"}); !decision.Allow {
+		t.Errorf("decision = %+v, want allowed", decision)
+	}
+}
+
+func TestHookFailureModes(t *testing.T) {
+	broken := func(Request) (int, string) { return http.StatusInternalServerError, "" }
+
+	if decision := endpoint(t, Options{}, broken).Evaluate(Request{Command: "ls"}); decision.Allow {
+		t.Errorf("failing hook allowed by default")
+	} else if !strings.Contains(decision.Reason, "policy hook unavailable") {
+		t.Errorf("reason = %q", decision.Reason)
+	}
+
+	if decision := endpoint(t, Options{OnFailure: FailAllow}, broken).Evaluate(Request{Command: "ls"}); !decision.Allow {
+		t.Errorf("failing hook denied with onFailure allow")
+	}
+
+	garbage := func(Request) (int, string) { return http.StatusOK, "allow" }
+	if decision := endpoint(t, Options{}, garbage).Evaluate(Request{Command: "ls"}); decision.Allow {
+		t.Errorf("unparseable decision allowed")
+	}
+
+	slow := func(Request) (int, string) {
+		time.Sleep(500 * time.Millisecond)
+		return http.StatusOK, `{"allow":true}`
+	}
+	decision := endpoint(t, Options{Timeout: 50 * time.Millisecond}, slow).Evaluate(Request{Command: "ls"})
+	if decision.Allow || !strings.Contains(decision.Reason, "no decision within") {
+		t.Errorf("decision = %+v, want denied for the timeout", decision)
+	}
+}
+
+func TestCommandHook(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip(err)
+	}
+	hook, err := New(Options{Command: []string{"sh", "-c",
+		`if grep -q '"command":"ls"'; then echo '{"allow":true}'; else echo '{"allow":false,"reason":"not ls"}'; fi`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if decision := hook.Evaluate(Request{Tool: "bash", Command: "ls"}); !decision.Allow {
+		t.Errorf("decision = %+v, want allowed", decision)
+	}
+	if decision := hook.Evaluate(Request{Tool: "bash", Command: "rm"}); decision.Allow || decision.Reason != "not ls" {
+		t.Errorf("decision = %+v, want denied", decision)
+	}
+}
+
+func TestNewValidatesOptions(t *testing.T) {
+	for _, opts := range []Options{
+		{},
+		{URL: "https://example.com", Command: []string{"true"}},
+		{URL: "ftp://example.com"},
+		{Command: []string{"true"}, OnFailure: "maybe"},
+	} {
+		if _, err := New(opts); err == nil {
+			t.Errorf("%+v accepted", opts)
+		}
+	}
+}
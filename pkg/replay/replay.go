@@ -0,0 +1,253 @@
+// Package replay records tools/call requests and their responses during a
+// real run, and answers calls from such a recording later without running
+// anything, for deterministic offline testing of agents.
+//
+// A recording is a file of JSON lines, one Entry per call in the order the
+// calls completed.
+package replay
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/mcp"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/perms"
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/truncate"
+)
+
+// maxEntrySize is the longest recording line that can be loaded
+const maxEntrySize = 64 * 1024 * 1024
+
+// Entry is one recorded call
+type Entry struct {
+	Seq           int                  `json:"seq"`
+	RecordedAt    time.Time            `json:"recordedAt"`
+	Tool          string               `json:"tool"`
+	Arguments     json.RawMessage      `json:"arguments"` // canonical JSON
+	ArgumentsHash string               `json:"argumentsHash"`
+	Response      mcp.CallToolResponse `json:"response"`
+}
+
+// hashArguments returns the canonical form of args and its SHA-256
+func hashArguments(args json.RawMessage) (json.RawMessage, string, error) {
+	canonical, err := mcp.Canonicalize(args)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid arguments: %w", err)
+	}
+	sum := sha256.Sum256(canonical)
+	return canonical, hex.EncodeToString(sum[:]), nil
+}
+
+// Recorder appends calls to a recording file
+type Recorder struct {
+	mutex sync.Mutex
+	file  *os.File
+	seq   int
+}
+
+// NewRecorder creates (or truncates) the recording at path. The file is
+// private to the user, since responses can hold anything commands printed.
+func NewRecorder(path string) (*Recorder, error) {
+	file, err := perms.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recording: %w", err)
+	}
+	return &Recorder{file: file}, nil
+}
+
+// Record appends a call and its response. A nil recorder records nothing.
+func (r *Recorder) Record(tool string, args json.RawMessage, response mcp.CallToolResponse) error {
+	if r == nil {
+		return nil
+	}
+	canonical, hash, err := hashArguments(args)
+	if err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.seq++
+	line, err := json.Marshal(Entry{
+		Seq:           r.seq,
+		RecordedAt:    time.Now().UTC(),
+		Tool:          tool,
+		Arguments:     canonical,
+		ArgumentsHash: hash,
+		Response:      response,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode recorded call: %w", err)
+	}
+	if _, err := r.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write recording: %w", err)
+	}
+	return nil
+}
+
+// Close closes the recording file
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	return r.file.Close()
+}
+
+// Player answers calls from a recording. Each recorded call is used once.
+// Strict matching needs the tool name and canonical arguments to match
+// exactly; lenient matching falls back to the unused call for the same tool
+// whose arguments are closest.
+type Player struct {
+	mutex   sync.Mutex
+	entries []Entry
+	used    []bool
+	lenient bool
+}
+
+// LoadPlayer reads the recording at path
+func LoadPlayer(path string, lenient bool) (*Player, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording: %w", err)
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxEntrySize)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("recording line %d: %w", line, err)
+		}
+		// Rehash, so recordings made before a change to the canonical form
+		// still match
+		canonical, hash, err := hashArguments(entry.Arguments)
+		if err != nil {
+			return nil, fmt.Errorf("recording line %d: %w", line, err)
+		}
+		entry.Arguments, entry.ArgumentsHash = canonical, hash
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read recording: %w", err)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Seq < entries[j].Seq })
+
+	return &Player{entries: entries, used: make([]bool, len(entries)), lenient: lenient}, nil
+}
+
+// Len returns the number of recorded calls
+func (p *Player) Len() int {
+	return len(p.entries)
+}
+
+// Play returns the recorded response for a call. When nothing matches, the
+// error describes the nearest recorded call.
+func (p *Player) Play(tool string, args json.RawMessage) (mcp.CallToolResponse, error) {
+	canonical, hash, err := hashArguments(args)
+	if err != nil {
+		return mcp.CallToolResponse{}, err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for i, entry := range p.entries {
+		if !p.used[i] && entry.Tool == tool && entry.ArgumentsHash == hash {
+			p.used[i] = true
+			return entry.Response, nil
+		}
+	}
+
+	nearest, nearestUsed := p.nearest(tool, canonical)
+	if p.lenient && nearest >= 0 && !nearestUsed {
+		p.used[nearest] = true
+		fmt.Fprintf(os.Stderr, "Replay: %s call matched recorded call #%d leniently (arguments differ)\n",
+			tool, p.entries[nearest].Seq)
+		return p.entries[nearest].Response, nil
+	}
+
+	return mcp.CallToolResponse{}, p.mismatch(tool, canonical, nearest, nearestUsed)
+}
+
+// nearest finds the recorded call for tool whose arguments share the most
+// top-level values with args, preferring unused calls and then the
+// earliest. Returns -1 if the tool was never recorded.
+func (p *Player) nearest(tool string, args json.RawMessage) (index int, used bool) {
+	index, best := -1, -1
+	for i, entry := range p.entries {
+		if entry.Tool != tool {
+			continue
+		}
+		score := sharedArguments(args, entry.Arguments)
+		if !p.used[i] {
+			score += 1 << 20 // any unused call beats every used one
+		}
+		if score > best {
+			index, best = i, score
+		}
+	}
+	if index < 0 {
+		return -1, false
+	}
+	return index, p.used[index]
+}
+
+// sharedArguments counts the top-level arguments two calls have in common
+// with equal values
+func sharedArguments(a, b json.RawMessage) int {
+	var left, right map[string]json.RawMessage
+	if json.Unmarshal(a, &left) != nil || json.Unmarshal(b, &right) != nil {
+		return 0
+	}
+	shared := 0
+	for name, value := range left {
+		if other, ok := right[name]; ok && string(other) == string(value) {
+			shared++
+		}
+	}
+	return shared
+}
+
+// mismatch describes why a call has no recorded response
+func (p *Player) mismatch(tool string, args json.RawMessage, nearest int, nearestUsed bool) error {
+	remaining := 0
+	for _, used := range p.used {
+		if !used {
+			remaining++
+		}
+	}
+
+	if nearest < 0 {
+		return fmt.Errorf("replay: no %s call was recorded (%d of %d recorded calls unused); arguments %s",
+			tool, remaining, len(p.entries), preview(args))
+	}
+	entry := p.entries[nearest]
+	if nearestUsed {
+		return fmt.Errorf("replay: recording exhausted for %s: every recorded %s call has been replayed "+
+			"(%d of %d recorded calls unused); nearest was #%d with arguments %s; this call had %s",
+			tool, tool, remaining, len(p.entries), entry.Seq, preview(entry.Arguments), preview(args))
+	}
+	return fmt.Errorf("replay: no recorded %s call has these arguments: %s; nearest unused is #%d with "+
+		"arguments %s (use lenient matching to accept it)", tool, preview(args), entry.Seq, preview(entry.Arguments))
+}
+
+// preview shortens arguments for error messages
+func preview(args json.RawMessage) string {
+	const max = 200
+	if len(args) <= max {
+		return string(args)
+	}
+	return string(truncate.Head(args, max)) + "..."
+}
@@ -0,0 +1,165 @@
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/LaurieRhodes/mcp-bash-go/pkg/collate"
+)
+
+// MinLength is the shortest secret accepted. Shorter values would make
+// redaction rewrite ordinary output.
+const MinLength = 4
+
+// Options says where to load secrets from
+type Options struct {
+	File string   // JSON object of name -> value, readable by the owner only
+	Env  []string // server environment variables, each loaded under its own name
+}
+
+// Store holds secrets by name. Values are never returned to clients: they are
+// injected into a command's environment and redacted from any output.
+type Store struct {
+	values map[string]string
+	order  []string // names, longest value first, for redaction
+}
+
+// Load reads the configured secrets. Environment variables that are loaded
+// are removed from the server's environment so bash sessions don't inherit
+// them; they only reach the commands that ask for them.
+func Load(opts Options) (*Store, error) {
+	store := &Store{values: make(map[string]string)}
+
+	if opts.File != "" {
+		fileValues, err := readFile(opts.File)
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range fileValues {
+			if err := store.add(name, value); err != nil {
+				return nil, fmt.Errorf("%s: %w", opts.File, err)
+			}
+		}
+	}
+
+	for _, name := range opts.Env {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, fmt.Errorf("secret environment variable %s is not set", name)
+		}
+		if err := store.add(name, value); err != nil {
+			return nil, err
+		}
+		os.Unsetenv(name)
+	}
+
+	sort.Slice(store.order, func(i, j int) bool {
+		return len(store.values[store.order[i]]) > len(store.values[store.order[j]])
+	})
+	return store, nil
+}
+
+// readFile loads a secrets file, refusing one that others could read
+func readFile(path string) (map[string]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secrets file: %w", err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("secrets file %s has mode %04o; it must not be accessible to group or others (chmod 600)",
+			path, info.Mode().Perm())
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secrets file: %w", err)
+	}
+	var values map[string]string
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("secrets file %s must be a JSON object of name to value: %w", path, err)
+	}
+	return values, nil
+}
+
+// add registers one secret
+func (s *Store) add(name, value string) error {
+	if name == "" {
+		return fmt.Errorf("secret with an empty name")
+	}
+	if _, exists := s.values[name]; exists {
+		return fmt.Errorf("secret %q is defined twice", name)
+	}
+	if len(value) < MinLength {
+		return fmt.Errorf("secret %q is shorter than %d bytes; too short to redact safely", name, MinLength)
+	}
+	s.values[name] = value
+	s.order = append(s.order, name)
+	return nil
+}
+
+// Len returns the number of secrets held
+func (s *Store) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.values)
+}
+
+// Names returns the secret names, sorted as the server lists names
+func (s *Store) Names() []string {
+	if s == nil {
+		return nil
+	}
+	names := make([]string, 0, len(s.values))
+	for name := range s.values {
+		names = append(names, name)
+	}
+	collate.Strings(names, collate.Natural)
+	return names
+}
+
+// Env resolves a use_secret mapping (secret name -> environment variable)
+// to the variables to set. An unknown name is an error that lists the
+// available names, never values.
+func (s *Store) Env(use map[string]string) (map[string]string, error) {
+	env := make(map[string]string, len(use))
+	for name, variable := range use {
+		value, ok := s.lookup(name)
+		if !ok {
+			available := "none are configured"
+			if s.Len() > 0 {
+				available = "available: " + strings.Join(s.Names(), ", ")
+			}
+			return nil, fmt.Errorf("unknown secret %q (%s)", name, available)
+		}
+		env[variable] = value
+	}
+	return env, nil
+}
+
+// lookup returns a secret's value
+func (s *Store) lookup(name string) (string, bool) {
+	if s == nil {
+		return "", false
+	}
+	value, ok := s.values[name]
+	return value, ok
+}
+
+// Redact replaces every secret value in text with [secret:NAME]. Longer
+// values are replaced first so one secret containing another is fully hidden.
+func (s *Store) Redact(text string) string {
+	if s == nil {
+		return text
+	}
+	for _, name := range s.order {
+		if value := s.values[name]; strings.Contains(text, value) {
+			text = strings.ReplaceAll(text, value, "[secret:"+name+"]")
+		}
+	}
+	return text
+}
@@ -0,0 +1,94 @@
+package secrets
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// secretsFile writes content to a secrets file with the given mode
+func secretsFile(t *testing.T, content string, mode os.FileMode) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	if err := os.WriteFile(path, []byte(content), mode); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFileAndEnv(t *testing.T) {
+	t.Setenv("TEST_SECRET_TOKEN", "from-the-environment")
+	store, err := Load(Options{
+		File: secretsFile(t, `{"api": "key-123456", "db": "hunter22"}`, 0600),
+		Env:  []string{"TEST_SECRET_TOKEN"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.Len() != 3 {
+		t.Errorf("loaded %d secrets, want 3", store.Len())
+	}
+	if _, ok := os.LookupEnv("TEST_SECRET_TOKEN"); ok {
+		t.Errorf("loaded environment secret left in the server's environment")
+	}
+
+	env, err := store.Env(map[string]string{"api": "API_KEY", "TEST_SECRET_TOKEN": "TOKEN"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env["API_KEY"] != "key-123456" || env["TOKEN"] != "from-the-environment" {
+		t.Errorf("env = %v", env)
+	}
+
+	_, err = store.Env(map[string]string{"missing": "X"})
+	if err == nil || !strings.Contains(err.Error(), "available: api, db") {
+		t.Errorf("err = %v, want the available names listed", err)
+	}
+	if strings.Contains(err.Error(), "hunter22") {
+		t.Errorf("error reveals a secret value: %v", err)
+	}
+}
+
+func TestLoadRejects(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		if _, err := Load(Options{File: secretsFile(t, `{"api": "key-123456"}`, 0644)}); err == nil {
+			t.Errorf("world-readable secrets file accepted")
+		}
+	}
+	if _, err := Load(Options{File: secretsFile(t, `{"api": "abc"}`, 0600)}); err == nil {
+		t.Errorf("secret shorter than MinLength accepted")
+	}
+	if _, err := Load(Options{File: secretsFile(t, `["key-123456"]`, 0600)}); err == nil {
+		t.Errorf("non-object secrets file accepted")
+	}
+	if _, err := Load(Options{Env: []string{"TEST_SECRET_NOT_SET"}}); err == nil {
+		t.Errorf("unset environment secret accepted")
+	}
+
+	t.Setenv("api", "key-123456")
+	if _, err := Load(Options{File: secretsFile(t, `{"api": "key-654321"}`, 0600), Env: []string{"api"}}); err == nil {
+		t.Errorf("secret defined twice accepted")
+	}
+}
+
+func TestRedactLongestFirst(t *testing.T) {
+	store, err := Load(Options{File: secretsFile(t, `{"short": "abcd", "long": "abcdefgh"}`, 0600)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := store.Redact("token=abcdefgh prefix=abcd")
+	if want := "token=[secret:long] prefix=[secret:short]"; got != want {
+		t.Errorf("Redact = %q, want %q", got, want)
+	}
+
+	var none *Store
+	if none.Redact("abcd") != "abcd" || none.Len() != 0 {
+		t.Errorf("nil store changed text")
+	}
+}
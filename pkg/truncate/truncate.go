@@ -0,0 +1,102 @@
+// Package truncate cuts text to a byte limit without leaving broken
+// characters at the cut. Every place the server shortens text for a client or
+// a log goes through it, so the result is always valid UTF-8 (given valid
+// input) and no longer than the limit.
+//
+// A cut snaps back to the nearest rune boundary, then past any combining
+// marks so a base character keeps its accents, and never separates a \r\n
+// pair. The result can be a few bytes shorter than the limit; it is never
+// longer.
+package truncate
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// Head returns the longest prefix of s, at most limit bytes, that ends on a
+// clean boundary
+func Head[T ~string | ~[]byte](s T, limit int) T {
+	if limit >= len(s) {
+		return s
+	}
+	if limit <= 0 {
+		return s[:0]
+	}
+	return s[:boundaryAtOrBefore(s, limit)]
+}
+
+// Tail returns the longest suffix of s, at most limit bytes, that starts on a
+// clean boundary
+func Tail[T ~string | ~[]byte](s T, limit int) T {
+	if limit >= len(s) {
+		return s
+	}
+	if limit <= 0 {
+		return s[len(s):]
+	}
+	return s[boundaryAtOrAfter(s, len(s)-limit):]
+}
+
+// boundaryAtOrBefore returns the clean cut point nearest to i, moving
+// towards the start of s
+func boundaryAtOrBefore[T ~string | ~[]byte](s T, i int) int {
+	for {
+		i = runeStartAtOrBefore(s, i)
+		if i == 0 || !splits(s, i) {
+			return i
+		}
+		i--
+	}
+}
+
+// boundaryAtOrAfter returns the clean cut point nearest to i, moving
+// towards the end of s
+func boundaryAtOrAfter[T ~string | ~[]byte](s T, i int) int {
+	for {
+		for i < len(s) && !utf8.RuneStart(s[i]) {
+			i++
+		}
+		if i == len(s) || !splits(s, i) {
+			return i
+		}
+		i++
+	}
+}
+
+// runeStartAtOrBefore moves i back to the start of the rune it falls in.
+// Invalid bytes count as runes of their own, so this is at most three steps.
+func runeStartAtOrBefore[T ~string | ~[]byte](s T, i int) int {
+	for j := i; j >= 0 && i-j < utf8.UTFMax; j-- {
+		if utf8.RuneStart(s[j]) {
+			if r, size := decodeRune(s[j:]); r != utf8.RuneError || size > 1 {
+				if j+size > i {
+					return j
+				}
+			}
+			break
+		}
+	}
+	return i
+}
+
+// splits reports whether cutting s at rune boundary i would separate a \r\n
+// pair or a combining mark from the character it modifies
+func splits[T ~string | ~[]byte](s T, i int) bool {
+	if s[i-1] == '\r' && s[i] == '\n' {
+		return true
+	}
+	r, _ := decodeRune(s[i:])
+	return unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Me, r)
+}
+
+// decodeRune decodes the first rune of s
+func decodeRune[T ~string | ~[]byte](s T) (rune, int) {
+	switch v := any(s).(type) {
+	case string:
+		return utf8.DecodeRuneInString(v)
+	case []byte:
+		return utf8.DecodeRune(v)
+	}
+	return utf8.DecodeRuneInString(string(s))
+}
@@ -0,0 +1,209 @@
+package update
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// requestTimeout bounds each manifest fetch so a slow endpoint can't
+	// hold the checker goroutine for long.
+	requestTimeout = 10 * time.Second
+
+	// maxManifestSize is the largest manifest response that will be read.
+	maxManifestSize = 1024 * 1024 // 1MB
+)
+
+// Status is the result of the most recent update check
+type Status struct {
+	CurrentVersion  string    `json:"currentVersion"`
+	LatestVersion   string    `json:"latestVersion,omitempty"`
+	UpdateAvailable bool      `json:"updateAvailable"`
+	ReleaseURL      string    `json:"releaseUrl,omitempty"`
+	CheckedAt       time.Time `json:"checkedAt,omitempty"`
+	LastError       string    `json:"lastError,omitempty"`
+}
+
+// manifest accepts either a small custom manifest ({"version", "url"}) or a
+// GitHub releases API response ({"tag_name", "html_url"}).
+type manifest struct {
+	Version string `json:"version"`
+	URL     string `json:"url"`
+	TagName string `json:"tag_name"`
+	HTMLURL string `json:"html_url"`
+}
+
+// Checker periodically compares the running version against a release
+// manifest. It only reports; it never downloads or installs anything.
+type Checker struct {
+	url            string
+	interval       time.Duration
+	currentVersion string
+	client         *http.Client
+
+	mutex  sync.RWMutex
+	status Status
+}
+
+// NewChecker creates an update checker. The manifest URL must use HTTPS.
+func NewChecker(manifestURL string, interval time.Duration, currentVersion string) (*Checker, error) {
+	parsed, err := url.Parse(manifestURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid update check url: %w", err)
+	}
+	if parsed.Scheme != "https" {
+		return nil, fmt.Errorf("update check url must use https: %s", manifestURL)
+	}
+
+	return &Checker{
+		url:            manifestURL,
+		interval:       interval,
+		currentVersion: currentVersion,
+		client: &http.Client{
+			Timeout: requestTimeout,
+			// Honour HTTPS_PROXY / NO_PROXY from the environment
+			Transport: &http.Transport{Proxy: http.ProxyFromEnvironment},
+		},
+		status: Status{CurrentVersion: currentVersion},
+	}, nil
+}
+
+// Start runs a check immediately and then every interval until stop is closed.
+// The first result is logged to stderr; later results only when they change.
+func (c *Checker) Start(stop <-chan struct{}) {
+	go func() {
+		c.check()
+		c.logStatus()
+
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				before := c.Status()
+				c.check()
+				if after := c.Status(); after.LatestVersion != before.LatestVersion {
+					c.logStatus()
+				}
+			}
+		}
+	}()
+}
+
+// Status returns the result of the most recent check
+func (c *Checker) Status() Status {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.status
+}
+
+// check fetches the manifest once and records the result. Failures are kept
+// in Status.LastError rather than logged, so an offline host stays quiet.
+func (c *Checker) check() {
+	latest, releaseURL, err := c.fetch()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.status.CheckedAt = time.Now()
+	if err != nil {
+		c.status.LastError = err.Error()
+		return
+	}
+	c.status.LastError = ""
+	c.status.LatestVersion = latest
+	c.status.ReleaseURL = releaseURL
+	c.status.UpdateAvailable = compareVersions(latest, c.currentVersion) > 0
+}
+
+// fetch retrieves the manifest and returns the latest version and its URL.
+func (c *Checker) fetch() (string, string, error) {
+	resp, err := c.client.Get(c.url)
+	if err != nil {
+		return "", "", fmt.Errorf("fetch failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("fetch failed: HTTP %d", resp.StatusCode)
+	}
+
+	var m manifest
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxManifestSize)).Decode(&m); err != nil {
+		return "", "", fmt.Errorf("invalid manifest: %w", err)
+	}
+
+	version, releaseURL := m.Version, m.URL
+	if version == "" {
+		version, releaseURL = m.TagName, m.HTMLURL
+	}
+	if version == "" {
+		return "", "", fmt.Errorf("invalid manifest: no version or tag_name")
+	}
+	return version, releaseURL, nil
+}
+
+// logStatus writes a one-line summary of the current status to stderr
+func (c *Checker) logStatus() {
+	status := c.Status()
+	switch {
+	case status.LastError != "":
+		// Stay quiet about failures; they are visible in Status()
+	case status.UpdateAvailable:
+		fmt.Fprintf(os.Stderr, "Update available: %s (running %s) %s\n",
+			status.LatestVersion, status.CurrentVersion, status.ReleaseURL)
+	default:
+		fmt.Fprintf(os.Stderr, "Version %s is up to date (latest %s)\n", status.CurrentVersion, status.LatestVersion)
+	}
+}
+
+// compareVersions compares two dotted versions such as "v1.2.3", ignoring a
+// leading "v" and any pre-release or build suffix. Returns -1, 0, or 1.
+// Unparseable versions (e.g. "dev") compare as 0 so no update is claimed.
+func compareVersions(a, b string) int {
+	pa, okA := parseVersion(a)
+	pb, okB := parseVersion(b)
+	if !okA || !okB {
+		return 0
+	}
+	for i := 0; i < 3; i++ {
+		if pa[i] != pb[i] {
+			if pa[i] > pb[i] {
+				return 1
+			}
+			return -1
+		}
+	}
+	return 0
+}
+
+// parseVersion parses "v1.2.3-rc1" into [1 2 3]. Missing parts are zero.
+func parseVersion(v string) ([3]int, bool) {
+	var parts [3]int
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	fields := strings.Split(v, ".")
+	if len(fields) == 0 || len(fields) > 3 {
+		return parts, false
+	}
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return parts, false
+		}
+		parts[i] = n
+	}
+	return parts, true
+}
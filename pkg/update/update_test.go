@@ -0,0 +1,98 @@
+package update
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// manifestServer serves body over HTTPS and returns a checker pointed at it
+func manifestServer(t *testing.T, status int, body string, current string) *Checker {
+	t.Helper()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	checker, err := NewChecker(server.URL, 0, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checker.client = server.Client()
+	return checker
+}
+
+func TestCheckerManifests(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		current   string
+		latest    string
+		available bool
+	}{
+		{"custom manifest", `{"version":"1.3.0","url":"https://example.com/r"}`, "1.2.9", "1.3.0", true},
+		{"releases api", `{"tag_name":"v1.2.0","html_url":"https://example.com/r"}`, "v1.2.0", "v1.2.0", false},
+		{"older release", `{"version":"1.0.0"}`, "1.1.0", "1.0.0", false},
+		{"development build", `{"version":"9.0.0"}`, "dev", "9.0.0", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checker := manifestServer(t, http.StatusOK, test.body, test.current)
+			checker.check()
+			status := checker.Status()
+			if status.LastError != "" {
+				t.Fatal(status.LastError)
+			}
+			if status.LatestVersion != test.latest || status.UpdateAvailable != test.available {
+				t.Errorf("latest %q, available %v; want %q, %v", status.LatestVersion, status.UpdateAvailable,
+					test.latest, test.available)
+			}
+			if status.CheckedAt.IsZero() {
+				t.Errorf("check time not recorded")
+			}
+		})
+	}
+}
+
+func TestCheckerFailuresRecorded(t *testing.T) {
+	for _, test := range []struct {
+		status int
+		body   string
+	}{
+		{http.StatusNotFound, ""},
+		{http.StatusOK, "not json"},
+		{http.StatusOK, `{"url":"https://example.com"}`},
+	} {
+		checker := manifestServer(t, test.status, test.body, "1.0.0")
+		checker.check()
+		if status := checker.Status(); status.LastError == "" || status.UpdateAvailable {
+			t.Errorf("HTTP %d %q: status %+v, want an error", test.status, test.body, status)
+		}
+	}
+}
+
+func TestNewCheckerRequiresHTTPS(t *testing.T) {
+	if _, err := NewChecker("http://example.com/latest.json", 0, "1.0.0"); err == nil {
+		t.Errorf("plain http manifest url accepted")
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"v1.10.0", "1.9.9", 1},
+		{"1.2", "1.2.1", -1},
+		{"2.0.0-rc1", "2.0.0", 0},
+		{"dev", "1.0.0", 0},
+		{"1.2.3.4", "1.0.0", 0},
+	}
+	for _, test := range tests {
+		if got := compareVersions(test.a, test.b); got != test.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}